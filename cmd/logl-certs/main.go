@@ -0,0 +1,297 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/oicur0t/logl/pkg/mtls"
+)
+
+const usage = `Usage: logl-certs <command> [flags]
+
+Commands:
+  ca       Create a CA to issue logl certificates from
+  server   Issue the server's certificate, with DNS and IP subject alternative names
+  client   Issue a tailer host's client certificate, optionally with tenant OUs
+
+Each command writes PEM files to -dir and prints the matching mtls config
+snippet. Run logl-certs <command> -h for a command's flags.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	commands := map[string]func([]string) error{
+		"ca":     runCA,
+		"server": runServer,
+		"client": runClient,
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		if os.Args[1] != "-h" && os.Args[1] != "--help" && os.Args[1] != "help" {
+			fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", os.Args[1])
+		}
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err := cmd(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// outputFlags are the flags shared by every command
+type outputFlags struct {
+	dir            string
+	installDir     string
+	days           int
+	force          bool
+	passphraseFile string
+	passphraseEnv  string
+}
+
+// register adds the shared flags to a command's flag set
+func (o *outputFlags) register(fs *flag.FlagSet, defaultDays int) {
+	fs.StringVar(&o.dir, "dir", "certs", "Directory to write certificates and keys to")
+	fs.StringVar(&o.installDir, "install-dir", "/etc/logl/certs", "Directory the files are installed in on their hosts, used in the printed config")
+	fs.IntVar(&o.days, "days", defaultDays, "Days the certificate is valid for")
+	fs.BoolVar(&o.force, "force", false, "Replace existing files")
+	fs.StringVar(&o.passphraseFile, "passphrase-file", "", "Encrypt the key with the passphrase in this file")
+	fs.StringVar(&o.passphraseEnv, "passphrase-env", "", "Encrypt the key with the passphrase in this environment variable")
+}
+
+// write writes a certificate and key named name.crt and name.key to the
+// output directory
+func (o *outputFlags) write(issued *mtls.Issued, name string) error {
+	if err := os.MkdirAll(o.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", o.dir, err)
+	}
+	certPath := filepath.Join(o.dir, name+".crt")
+	keyPath := filepath.Join(o.dir, name+".key")
+	var passphrase []byte
+	if o.passphraseFile != "" || o.passphraseEnv != "" {
+		var err error
+		if passphrase, err = mtls.PassphraseFrom(o.passphraseFile, o.passphraseEnv)(keyPath); err != nil {
+			return err
+		}
+	}
+	if err := issued.WriteFiles(certPath, keyPath, passphrase, o.force); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("%w (use -force to replace it)", err)
+		}
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Wrote %s and %s\n", certPath, keyPath)
+	fmt.Fprintf(os.Stderr, "  subject: %s\n", issued.Cert.Subject)
+	fmt.Fprintf(os.Stderr, "  expires: %s\n", issued.Cert.NotAfter.Format(time.RFC3339))
+	return nil
+}
+
+// installed returns where a file is found on the hosts using it
+func (o *outputFlags) installed(file string) string {
+	return strings.TrimRight(o.installDir, "/") + "/" + file
+}
+
+// passphraseConfig returns the config lines pointing at the key's
+// passphrase, assuming a passphrase file is installed next to the key
+func (o *outputFlags) passphraseConfig() string {
+	switch {
+	case o.passphraseFile != "":
+		return fmt.Sprintf("  key_passphrase_file: %q\n", o.installed(filepath.Base(o.passphraseFile)))
+	case o.passphraseEnv != "":
+		return fmt.Sprintf("  key_passphrase_env: %q\n", o.passphraseEnv)
+	}
+	return ""
+}
+
+// validity converts -days to a duration
+func (o *outputFlags) validity() (time.Duration, error) {
+	if o.days <= 0 {
+		return 0, fmt.Errorf("-days must be positive")
+	}
+	return time.Duration(o.days) * 24 * time.Hour, nil
+}
+
+// caFlags locate the CA that server and client certificates are issued
+// from
+type caFlags struct {
+	cert           string
+	key            string
+	passphraseFile string
+	passphraseEnv  string
+}
+
+// register adds the CA flags to a command's flag set
+func (c *caFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.cert, "ca-cert", "", "CA certificate to issue from (default <dir>/ca.crt)")
+	fs.StringVar(&c.key, "ca-key", "", "CA key to issue from (default <dir>/ca.key)")
+	fs.StringVar(&c.passphraseFile, "ca-passphrase-file", "", "File holding an encrypted CA key's passphrase (prompted for otherwise)")
+	fs.StringVar(&c.passphraseEnv, "ca-passphrase-env", "", "Environment variable holding an encrypted CA key's passphrase")
+}
+
+// load loads the issuing CA, defaulting to the one in the output directory
+func (c *caFlags) load(dir string) (*mtls.Issued, error) {
+	certPath, keyPath := c.cert, c.key
+	if certPath == "" {
+		certPath = filepath.Join(dir, "ca.crt")
+	}
+	if keyPath == "" {
+		keyPath = filepath.Join(dir, "ca.key")
+	}
+	return mtls.LoadCA(certPath, keyPath, mtls.PassphraseFrom(c.passphraseFile, c.passphraseEnv))
+}
+
+// runCA creates a CA
+func runCA(args []string) error {
+	fs := flag.NewFlagSet("ca", flag.ExitOnError)
+	var of outputFlags
+	of.register(fs, 3650)
+	name := fs.String("name", "logl-ca", "CA common name")
+	fs.Parse(args)
+
+	validity, err := of.validity()
+	if err != nil {
+		return err
+	}
+	ca, err := mtls.NewCA(*name, validity)
+	if err != nil {
+		return err
+	}
+	if err := of.write(ca, "ca"); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "\nKeep ca.key off the servers and tailers: only ca.crt is deployed. Next, issue certificates with:\n")
+	fmt.Fprintf(os.Stderr, "  logl-certs server -dir %s -dns <server hostname>\n", of.dir)
+	fmt.Fprintf(os.Stderr, "  logl-certs client -dir %s -host <tailer hostname>\n", of.dir)
+	return nil
+}
+
+// runServer issues the server's certificate
+func runServer(args []string) error {
+	fs := flag.NewFlagSet("server", flag.ExitOnError)
+	var of outputFlags
+	of.register(fs, 365)
+	var cf caFlags
+	cf.register(fs)
+	name := fs.String("name", "logl-server", "Certificate common name")
+	dnsNames := fs.String("dns", "logl-server,localhost", "Comma-separated DNS names tailers connect to; the first is their server_name")
+	ips := fs.String("ip", "127.0.0.1", "Comma-separated IP addresses tailers connect to")
+	fs.Parse(args)
+
+	validity, err := of.validity()
+	if err != nil {
+		return err
+	}
+	opts := mtls.IssueOptions{
+		CommonName: *name,
+		DNSNames:   splitList(*dnsNames),
+		Validity:   validity,
+		Server:     true,
+	}
+	for _, v := range splitList(*ips) {
+		ip := net.ParseIP(v)
+		if ip == nil {
+			return fmt.Errorf("invalid IP address %q", v)
+		}
+		opts.IPAddresses = append(opts.IPAddresses, ip)
+	}
+
+	ca, err := cf.load(of.dir)
+	if err != nil {
+		return err
+	}
+	cert, err := ca.Issue(opts)
+	if err != nil {
+		return err
+	}
+	if err := of.write(cert, "server"); err != nil {
+		return err
+	}
+
+	fmt.Printf(`# server.yaml
+mtls:
+  enabled: true
+  ca_cert: %q
+  server_cert: %q
+  server_key: %q
+%s  client_auth: "require"
+`, of.installed("ca.crt"), of.installed("server.crt"), of.installed("server.key"), of.passphraseConfig())
+	return nil
+}
+
+// runClient issues a tailer host's client certificate
+func runClient(args []string) error {
+	fs := flag.NewFlagSet("client", flag.ExitOnError)
+	var of outputFlags
+	of.register(fs, 365)
+	var cf caFlags
+	cf.register(fs)
+	host := fs.String("host", "", "Tailer hostname, used as the common name (required)")
+	ous := fs.String("ou", "", "Comma-separated organizational units, mapped to tenants by the server's tenancy.tenants[].ous")
+	serverName := fs.String("server-name", "logl-server", "Server DNS name, as issued by logl-certs server -dns")
+	out := fs.String("out", "", "File name, without extension (default the host)")
+	fs.Parse(args)
+
+	if *host == "" {
+		return fmt.Errorf("-host is required")
+	}
+	name := *out
+	if name == "" {
+		name = *host
+	}
+	if strings.ContainsAny(name, `/\`) || name == "ca" || name == "server" {
+		return fmt.Errorf("invalid file name %q (set -out)", name)
+	}
+	validity, err := of.validity()
+	if err != nil {
+		return err
+	}
+
+	ca, err := cf.load(of.dir)
+	if err != nil {
+		return err
+	}
+	cert, err := ca.Issue(mtls.IssueOptions{
+		CommonName:         *host,
+		OrganizationalUnit: splitList(*ous),
+		Validity:           validity,
+	})
+	if err != nil {
+		return err
+	}
+	if err := of.write(cert, name); err != nil {
+		return err
+	}
+
+	fmt.Printf(`# tailer.yaml on %s
+mtls:
+  ca_cert: %q
+  client_cert: %q
+  client_key: %q
+%s  server_name: %q
+`, *host, of.installed("ca.crt"), of.installed(name+".crt"), of.installed(name+".key"), of.passphraseConfig(), *serverName)
+	return nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty items
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,505 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oicur0t/logl/pkg/models"
+)
+
+// filterFlags are the entry filters shared by query, stats, and export
+type filterFlags struct {
+	service  string
+	since    string
+	until    string
+	level    string
+	hostname string
+	filePath string
+	contains string
+	search   string
+	traceID  string
+	region   string
+	labels   labelFilters
+}
+
+// register adds the filter flags to a command's flag set
+func (f *filterFlags) register(fs *flag.FlagSet, defaultSince string) {
+	fs.StringVar(&f.service, "service", "", "Service name (required)")
+	fs.StringVar(&f.since, "since", defaultSince, "Start of the window: a duration ago (30m, 1h, 7d) or an RFC3339 time")
+	fs.StringVar(&f.until, "until", "", "End of the window: a duration ago or an RFC3339 time (default now)")
+	fs.StringVar(&f.level, "level", "", "Comma-separated levels, e.g. error,fatal")
+	fs.StringVar(&f.hostname, "hostname", "", "Hostname")
+	fs.StringVar(&f.filePath, "file", "", "File path")
+	fs.StringVar(&f.contains, "contains", "", "Substring of the line")
+	fs.StringVar(&f.search, "search", "", "Full-text search (requires the server's line text index)")
+	fs.StringVar(&f.traceID, "trace-id", "", "Trace ID")
+	fs.StringVar(&f.region, "region", "", "Region the entries were produced in")
+	fs.Var(&f.labels, "label", "Label filter key:value (repeatable)")
+}
+
+// params returns the filters as query parameters
+func (f *filterFlags) params() (url.Values, error) {
+	if f.service == "" {
+		return nil, fmt.Errorf("-service is required")
+	}
+	params := url.Values{"service": {f.service}}
+	now := time.Now()
+	for name, v := range map[string]string{"from": f.since, "to": f.until} {
+		if v == "" {
+			continue
+		}
+		t, err := parseTime(v, now)
+		if err != nil {
+			return nil, err
+		}
+		params.Set(name, t.UTC().Format(time.RFC3339))
+	}
+	for name, v := range map[string]string{
+		"level":     f.level,
+		"hostname":  f.hostname,
+		"file_path": f.filePath,
+		"contains":  f.contains,
+		"search":    f.search,
+		"trace_id":  f.traceID,
+		"region":    f.region,
+	} {
+		if v != "" {
+			params.Set(name, v)
+		}
+	}
+	for _, l := range f.labels {
+		params.Add("label", l)
+	}
+	return params, nil
+}
+
+// labelFilters collects repeated -label key:value flags
+type labelFilters []string
+
+func (l *labelFilters) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *labelFilters) Set(value string) error {
+	if key, _, ok := strings.Cut(value, ":"); !ok || key == "" {
+		return fmt.Errorf("expected key:value, got %q", value)
+	}
+	*l = append(*l, value)
+	return nil
+}
+
+// parseTime parses an RFC3339 time or a duration before now. Durations
+// also accept a d suffix for days, e.g. 7d.
+func parseTime(v string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("invalid time %q (expected a duration like 1h or 7d, or an RFC3339 time)", v)
+	}
+	return now.Add(-d), nil
+}
+
+// runQuery searches a service's entries, newest first
+func runQuery(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	var cf clientFlags
+	var ff filterFlags
+	cf.register(fs)
+	ff.register(fs, "")
+	limit := fs.Int("limit", 100, "Maximum entries, capped by the server's query.max_limit")
+	fs.Parse(args)
+
+	c, err := cf.newClient()
+	if err != nil {
+		return err
+	}
+	params, err := ff.params()
+	if err != nil {
+		return err
+	}
+	params.Set("limit", strconv.Itoa(*limit))
+
+	entries, err := c.query(ctx, params)
+	if err != nil {
+		return err
+	}
+	if cf.output == "json" {
+		return printJSON(map[string]interface{}{"entries": entries, "count": len(entries)})
+	}
+	printEntries(entries)
+	return nil
+}
+
+// query fetches entries from /v1/logs/query
+func (c *client) query(ctx context.Context, params url.Values) ([]models.LogEntry, error) {
+	resp, err := c.get(ctx, "/v1/logs/query", params, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Entries []models.LogEntry `json:"entries"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return result.Entries, nil
+}
+
+// runTail prints a service's latest entries, oldest first, then follows
+// new entries through live tail with -f
+func runTail(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	var cf clientFlags
+	cf.register(fs)
+	service := fs.String("service", "", "Service name (required)")
+	hostname := fs.String("hostname", "", "Hostname")
+	contains := fs.String("contains", "", "Substring of the line")
+	n := fs.Int("n", 10, "Number of latest entries to print first")
+	follow := fs.Bool("f", false, "Follow new entries")
+	fs.Parse(args)
+
+	if *service == "" {
+		return fmt.Errorf("-service is required")
+	}
+	c, err := cf.newClient()
+	if err != nil {
+		return err
+	}
+	params := url.Values{"service": {*service}}
+	if *hostname != "" {
+		params.Set("hostname", *hostname)
+	}
+	if *contains != "" {
+		params.Set("contains", *contains)
+	}
+
+	if *n > 0 {
+		latest := url.Values{}
+		for k, v := range params {
+			latest[k] = v
+		}
+		latest.Set("limit", strconv.Itoa(*n))
+		entries, err := c.query(ctx, latest)
+		if err != nil {
+			return err
+		}
+		for i := len(entries) - 1; i >= 0; i-- {
+			printEntry(entries[i], cf.output)
+		}
+	}
+	if !*follow {
+		return nil
+	}
+
+	// Reconnect until interrupted, since live tail streams end when the
+	// server restarts
+	for {
+		err := c.follow(ctx, params, func(entry models.LogEntry) {
+			printEntry(entry, cf.output)
+		})
+		if ctx.Err() != nil {
+			return nil
+		}
+		fmt.Fprintf(os.Stderr, "Live tail disconnected: %v; reconnecting\n", err)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// follow streams entries from /v1/logs/tail until the stream ends
+func (c *client) follow(ctx context.Context, params url.Values, fn func(models.LogEntry)) error {
+	resp, err := c.get(ctx, "/v1/logs/tail", params, http.Header{"Accept": {"text/event-stream"}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue // Heartbeats and event separators
+		}
+		var entry models.LogEntry
+		if err := json.Unmarshal([]byte(data), &entry); err != nil {
+			continue
+		}
+		fn(entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("stream closed")
+}
+
+// runStats counts a service's entries in time buckets, by a field, or by
+// the top values of a parsed field
+func runStats(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	var cf clientFlags
+	var ff filterFlags
+	cf.register(fs)
+	ff.register(fs, "1h")
+	interval := fs.String("interval", "", "Histogram bucket size, e.g. 5m (default 1m)")
+	by := fs.String("by", "", "Count by level, hostname, file_path, label:<key>, or parsed.<field>")
+	top := fs.String("top", "", "Most frequent values of a parsed field")
+	n := fs.Int("n", 10, "Number of values for -top")
+	fs.Parse(args)
+
+	modes := 0
+	for _, v := range []string{*interval, *by, *top} {
+		if v != "" {
+			modes++
+		}
+	}
+	if modes > 1 {
+		return fmt.Errorf("-interval, -by, and -top are mutually exclusive")
+	}
+
+	c, err := cf.newClient()
+	if err != nil {
+		return err
+	}
+	params, err := ff.params()
+	if err != nil {
+		return err
+	}
+
+	path := "/v1/logs/stats/histogram"
+	switch {
+	case *by != "":
+		path = "/v1/logs/stats/group"
+		params.Set("by", *by)
+	case *top != "":
+		path = "/v1/logs/stats/top"
+		params.Set("field", *top)
+		params.Set("n", strconv.Itoa(*n))
+	case *interval != "":
+		params.Set("interval", *interval)
+	}
+
+	resp, err := c.get(ctx, path, params, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result statsResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	if cf.output == "json" {
+		return printJSON(result)
+	}
+	if path == "/v1/logs/stats/histogram" {
+		printHistogram(result.Buckets)
+	} else {
+		printValueCounts(result.Values)
+	}
+	return nil
+}
+
+// statsResult is the response of any stats endpoint
+type statsResult struct {
+	Buckets  []models.BucketCount `json:"buckets,omitempty"`
+	Interval string               `json:"interval,omitempty"`
+	By       string               `json:"by,omitempty"`
+	Field    string               `json:"field,omitempty"`
+	Values   []models.ValueCount  `json:"values,omitempty"`
+	From     time.Time            `json:"from"`
+	To       time.Time            `json:"to"`
+}
+
+// runExport streams a service's entries, oldest first, to stdout or a file
+func runExport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	var cf clientFlags
+	var ff filterFlags
+	cf.register(fs)
+	ff.register(fs, "")
+	format := fs.String("format", "ndjson", "Export format: ndjson or csv")
+	gzipped := fs.Bool("gzip", false, "Write gzip-compressed output")
+	limit := fs.Int64("limit", 0, "Maximum entries, 0 for all")
+	out := fs.String("o", "", "Output file (default stdout)")
+	fs.Parse(args)
+
+	c, err := cf.newClient()
+	if err != nil {
+		return err
+	}
+	params, err := ff.params()
+	if err != nil {
+		return err
+	}
+	params.Set("format", *format)
+	if *gzipped {
+		params.Set("gzip", "true")
+	}
+	if *limit > 0 {
+		params.Set("limit", strconv.FormatInt(*limit, 10))
+	}
+
+	resp, err := c.get(ctx, "/v1/logs/export", params, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", *out, err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("export interrupted: %w", err)
+	}
+	return nil
+}
+
+// runFile downloads one host's file in line order, marking missing lines,
+// and reports what was missing on stderr
+func runFile(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("file", flag.ExitOnError)
+	var cf clientFlags
+	cf.register(fs)
+	service := fs.String("service", "", "Service name (required)")
+	hostname := fs.String("hostname", "", "Hostname (required)")
+	filePath := fs.String("file", "", "File path on the host (required)")
+	since := fs.String("since", "", "Only entries since: a duration ago (30m, 1h, 7d) or an RFC3339 time")
+	until := fs.String("until", "", "Only entries until: a duration ago or an RFC3339 time")
+	fromLine := fs.Int64("from-line", 0, "First line number, reporting missing lines from it")
+	toLine := fs.Int64("to-line", 0, "Last line number")
+	format := fs.String("format", "text", "Output format: text (the file's lines) or ndjson (entries and gaps)")
+	omitGaps := fs.Bool("omit-gaps", false, "Don't write markers for missing lines in text output")
+	out := fs.String("o", "", "Output file (default stdout)")
+	fs.Parse(args)
+
+	if *service == "" || *hostname == "" || *filePath == "" {
+		return fmt.Errorf("-service, -hostname, and -file are required")
+	}
+	c, err := cf.newClient()
+	if err != nil {
+		return err
+	}
+	params := url.Values{"service": {*service}, "hostname": {*hostname}, "file_path": {*filePath}, "format": {*format}}
+	now := time.Now()
+	for name, v := range map[string]string{"from": *since, "to": *until} {
+		if v == "" {
+			continue
+		}
+		t, err := parseTime(v, now)
+		if err != nil {
+			return err
+		}
+		params.Set(name, t.UTC().Format(time.RFC3339))
+	}
+	if *fromLine > 0 {
+		params.Set("from_line", strconv.FormatInt(*fromLine, 10))
+	}
+	if *toLine > 0 {
+		params.Set("to_line", strconv.FormatInt(*toLine, 10))
+	}
+	if *omitGaps {
+		params.Set("gaps", "omit")
+	}
+
+	resp, err := c.get(ctx, "/v1/logs/file", params, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", *out, err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("download interrupted: %w", err)
+	}
+
+	// The server sends the summary as trailers once the file is written
+	if entries := resp.Trailer.Get("X-Logl-Entries"); entries != "" {
+		fmt.Fprintf(os.Stderr, "%s entries, %s gaps (%s missing lines), %s duplicates\n",
+			entries, resp.Trailer.Get("X-Logl-Gaps"), resp.Trailer.Get("X-Logl-Missing-Lines"), resp.Trailer.Get("X-Logl-Duplicates"))
+	}
+	return nil
+}
+
+// runFields lists the fields in a service's recent entries, named as the
+// other commands' filters and -by take them, with their frequent values
+func runFields(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("fields", flag.ExitOnError)
+	var cf clientFlags
+	cf.register(fs)
+	service := fs.String("service", "", "Service name (required)")
+	prefix := fs.String("prefix", "", "Only fields starting with this, e.g. parsed.http")
+	names := fs.Bool("names", false, "Print only field names, one per line, for shell completion")
+	fs.Parse(args)
+
+	if *service == "" {
+		return fmt.Errorf("-service is required")
+	}
+	c, err := cf.newClient()
+	if err != nil {
+		return err
+	}
+	params := url.Values{"service": {*service}}
+	if *prefix != "" {
+		params.Set("prefix", *prefix)
+	}
+
+	resp, err := c.get(ctx, "/v1/logs/fields", params, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var catalog models.FieldCatalog
+	if err := json.NewDecoder(resp.Body).Decode(&catalog); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	switch {
+	case cf.output == "json":
+		return printJSON(catalog)
+	case *names:
+		for _, f := range catalog.Fields {
+			fmt.Println(f.Name)
+		}
+	default:
+		printFields(catalog.Fields)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/models"
+	"github.com/oicur0t/logl/pkg/mtls"
+)
+
+const usage = `Usage: logl-cli <command> [flags]
+
+Commands:
+  query    Search a service's entries
+  tail     Print a service's latest entries, following new ones with -f
+  stats    Count entries in time buckets (-interval), by a field (-by), or top values (-top)
+  export   Stream a service's entries as NDJSON or CSV
+  file     Download one host's file in line order, marking missing lines
+  fields   List the fields and frequent values in a service's recent entries
+  replay   Re-ingest NDJSON files: dead-letter files, exports, or sink archives
+
+Run logl-cli <command> -h for a command's flags.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	commands := map[string]func(context.Context, []string) error{
+		"query":  runQuery,
+		"tail":   runTail,
+		"stats":  runStats,
+		"export": runExport,
+		"file":   runFile,
+		"fields": runFields,
+		"replay": runReplay,
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		if os.Args[1] != "-h" && os.Args[1] != "--help" && os.Args[1] != "help" {
+			fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", os.Args[1])
+		}
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if err := cmd(ctx, os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// clientFlags are the connection and output flags shared by every command
+type clientFlags struct {
+	configPath string
+	server     string
+	caCert     string
+	clientCert string
+	clientKey  string
+	serverName string
+	token      string
+	output     string
+}
+
+// register adds the shared flags to a command's flag set
+func (c *clientFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.configPath, "config", "/etc/logl/tailer.yaml", "Tailer configuration file to read the server URL and mTLS settings from")
+	fs.StringVar(&c.server, "server", "", "Server base URL, e.g. https://logl-server:8443 (overrides the config file)")
+	fs.StringVar(&c.caCert, "ca-cert", "", "CA certificate (overrides the config file)")
+	fs.StringVar(&c.clientCert, "client-cert", "", "Client certificate (overrides the config file)")
+	fs.StringVar(&c.clientKey, "client-key", "", "Client key (overrides the config file)")
+	fs.StringVar(&c.serverName, "server-name", "", "TLS server name (overrides the config file)")
+	fs.StringVar(&c.token, "token", os.Getenv("LOGL_TOKEN"), "Access token, instead of a client certificate (default $LOGL_TOKEN)")
+	fs.StringVar(&c.output, "output", "table", "Output format: table or json")
+}
+
+// client is an API client for logl-server
+type client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// newClient builds a client from the config file, overridden by flags. The
+// config file may be missing when -server is given.
+func (c *clientFlags) newClient() (*client, error) {
+	if c.output != "table" && c.output != "json" {
+		return nil, fmt.Errorf("-output must be table or json")
+	}
+
+	cfg := &config.CLIConfig{}
+	if _, err := os.Stat(c.configPath); err == nil || c.server == "" {
+		if cfg, err = config.LoadCLIConfig(c.configPath); err != nil {
+			return nil, err
+		}
+	}
+
+	baseURL := strings.TrimRight(c.server, "/")
+	if baseURL == "" {
+		var err error
+		if baseURL, err = cfg.BaseURL(); err != nil {
+			return nil, err
+		}
+	}
+	override := func(target *string, flagValue string) {
+		if flagValue != "" {
+			*target = flagValue
+		}
+	}
+	override(&cfg.MTLS.CACert, c.caCert)
+	override(&cfg.MTLS.ClientCert, c.clientCert)
+	override(&cfg.MTLS.ClientKey, c.clientKey)
+	override(&cfg.MTLS.ServerName, c.serverName)
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if strings.HasPrefix(baseURL, "https://") {
+		tlsConfig, err := loadTLSConfig(cfg.MTLS, c.token != "")
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &client{baseURL: baseURL, token: c.token, http: &http.Client{Transport: transport}}, nil
+}
+
+// loadTLSConfig loads the mTLS client configuration. Token holders don't
+// need a client certificate, only the CA.
+func loadTLSConfig(cfg config.MTLSConfig, haveToken bool) (*tls.Config, error) {
+	if !haveToken || (cfg.ClientCert != "" && cfg.ClientKey != "") {
+		tlsConfig, err := mtls.LoadClientTLSConfig(cfg.CACert, cfg.ClientCert, cfg.ClientKey, cfg.ServerName, mtls.PassphraseFrom(cfg.KeyPassphraseFile, cfg.KeyPassphraseEnv))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load mTLS config: %w", err)
+		}
+		return tlsConfig, nil
+	}
+
+	tlsConfig := &tls.Config{ServerName: cfg.ServerName, MinVersion: tls.VersionTLS13}
+	if cfg.CACert != "" {
+		caCert, err := os.ReadFile(cfg.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("failed to append CA certificate")
+		}
+	}
+	return tlsConfig, nil
+}
+
+// get issues a GET request, returning the response if it succeeded
+func (c *client) get(ctx context.Context, path string, params url.Values, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var errResp models.ErrorResponse
+		if json.Unmarshal(body, &errResp) == nil && errResp.Error.Message != "" {
+			return nil, fmt.Errorf("server returned %s: %s", resp.Status, errResp.Error.Message)
+		}
+		return nil, fmt.Errorf("server returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
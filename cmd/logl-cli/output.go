@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/oicur0t/logl/pkg/models"
+)
+
+// printJSON writes v as indented JSON
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// printEntries writes entries as a table
+func printEntries(entries []models.LogEntry) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIMESTAMP\tLEVEL\tHOSTNAME\tLINE")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", entry.Timestamp.Local().Format(time.RFC3339Nano), levelOrDash(entry.Level), entry.Hostname, oneLine(entry.Line))
+	}
+	w.Flush()
+}
+
+// printEntry writes one entry as a line, or as compact JSON, for streaming
+func printEntry(entry models.LogEntry, output string) {
+	if output == "json" {
+		data, err := json.Marshal(entry)
+		if err == nil {
+			fmt.Println(string(data))
+		}
+		return
+	}
+	fmt.Printf("%s %-5s %s %s\n", entry.Timestamp.Local().Format(time.RFC3339Nano), levelOrDash(entry.Level), entry.Hostname, oneLine(entry.Line))
+}
+
+// printHistogram writes buckets as a table with a bar scaled to the
+// largest bucket
+func printHistogram(buckets []models.BucketCount) {
+	const barWidth = 40
+	var max int64
+	for _, b := range buckets {
+		if b.Count > max {
+			max = b.Count
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "START\tCOUNT\t")
+	for _, b := range buckets {
+		bar := ""
+		if max > 0 {
+			bar = strings.Repeat("#", int(b.Count*barWidth/max))
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\n", b.Start.Local().Format(time.RFC3339), b.Count, bar)
+	}
+	w.Flush()
+}
+
+// printValueCounts writes value counts as a table
+func printValueCounts(values []models.ValueCount) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VALUE\tCOUNT")
+	for _, v := range values {
+		value := "-"
+		if v.Value != nil {
+			value = fmt.Sprint(v.Value)
+		}
+		fmt.Fprintf(w, "%s\t%d\n", value, v.Count)
+	}
+	w.Flush()
+}
+
+// printFields writes field summaries as a table with their first values
+func printFields(fields []models.FieldSummary) {
+	const shownValues = 5
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FIELD\tTYPE\tCOUNT\tDISTINCT\tVALUES")
+	for _, f := range fields {
+		values := f.Values
+		more := ""
+		if len(values) > shownValues {
+			values = values[:shownValues]
+			more = ", ..."
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s%s\n", f.Name, f.Type, f.Count, f.Distinct, oneLine(strings.Join(values, ", ")), more)
+	}
+	w.Flush()
+}
+
+// levelOrDash returns the level, or - when none was detected
+func levelOrDash(level string) string {
+	if level == "" {
+		return "-"
+	}
+	return level
+}
+
+// oneLine replaces line breaks so multiline entries keep the table aligned
+func oneLine(line string) string {
+	return strings.NewReplacer("\r\n", "⏎", "\n", "⏎", "\t", " ").Replace(line)
+}
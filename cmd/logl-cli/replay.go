@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/oicur0t/logl/internal/tailer"
+	"github.com/oicur0t/logl/pkg/models"
+	"github.com/oicur0t/logl/pkg/retry"
+)
+
+// runReplay re-ingests NDJSON files through the ingest API: tailer
+// dead-letter files, exports, and file or S3 sink output, gzipped or not
+func runReplay(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	var cf clientFlags
+	cf.register(fs)
+	batchSize := fs.Int("batch-size", 500, "Entries per ingest request")
+	rate := fs.Float64("rate", 1000, "Maximum entries per second, 0 for no limit")
+	failed := fs.String("failed", "", "Dead-letter file for batches that could not be ingested, for a later replay")
+	dryRun := fs.Bool("dry-run", false, "Read the files and count entries without sending them")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: logl-cli replay [flags] file... (- for stdin)\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return fmt.Errorf("at least one file is required")
+	}
+	if *batchSize < 1 {
+		return fmt.Errorf("-batch-size must be at least 1")
+	}
+	if *rate < 0 {
+		return fmt.Errorf("-rate must not be negative")
+	}
+
+	r := &replayer{
+		batchSize: *batchSize,
+		rate:      *rate,
+		failed:    tailer.NewDeadLetter(*failed, 0),
+		pending:   make(map[string][]models.LogEntry),
+		start:     time.Now(),
+	}
+	if !*dryRun {
+		c, err := cf.newClient()
+		if err != nil {
+			return err
+		}
+		r.client = c
+	}
+
+	for _, path := range fs.Args() {
+		if err := r.replayFile(ctx, path); err != nil {
+			return err
+		}
+	}
+	if err := r.flushAll(ctx); err != nil {
+		return err
+	}
+
+	verb := "Replayed"
+	if *dryRun {
+		verb = "Would replay"
+	}
+	fmt.Fprintf(os.Stderr, "%s %d entries in %d batches\n", verb, r.entries, r.batches)
+	if r.failedEntries > 0 {
+		if r.failed != nil {
+			return fmt.Errorf("%d entries could not be ingested; see %s", r.failedEntries, *failed)
+		}
+		return fmt.Errorf("%d entries could not be ingested", r.failedEntries)
+	}
+	return nil
+}
+
+// replayer batches entries per service and sends them at a limited rate.
+// A nil client counts entries without sending them.
+type replayer struct {
+	client    *client
+	batchSize int
+	rate      float64
+	failed    *tailer.DeadLetter
+	pending   map[string][]models.LogEntry // service name -> entries
+	start     time.Time
+
+	entries       int // Entries sent, or counted in a dry run
+	batches       int
+	failedEntries int
+}
+
+// replayFile reads one file, which holds dead-letter records or entries
+func (r *replayer) replayFile(ctx context.Context, path string) error {
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	reader := bufio.NewReader(in)
+	if magic, _ := reader.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		defer gz.Close()
+		reader = bufio.NewReader(gz)
+	}
+
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			if err := r.replayLine(ctx, line); err != nil {
+				return fmt.Errorf("%s:%d: %w", path, lineNumber, err)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+	}
+}
+
+// replayLine sends a dead-letter record's batch as it was, or adds an
+// entry to its service's batch
+func (r *replayer) replayLine(ctx context.Context, line []byte) error {
+	var record struct {
+		Batch *models.LogBatch `json:"batch"`
+	}
+	if err := json.Unmarshal(line, &record); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	if record.Batch != nil {
+		return r.send(ctx, *record.Batch)
+	}
+
+	var entry models.LogEntry
+	if err := json.Unmarshal(line, &entry); err != nil {
+		return fmt.Errorf("invalid entry: %w", err)
+	}
+	if entry.ServiceName == "" {
+		return fmt.Errorf("entry has no service_name")
+	}
+	r.pending[entry.ServiceName] = append(r.pending[entry.ServiceName], entry)
+	if len(r.pending[entry.ServiceName]) >= r.batchSize {
+		return r.flush(ctx, entry.ServiceName)
+	}
+	return nil
+}
+
+// flush sends a service's pending entries. The batch ID is derived from
+// the content, so a batch replayed twice is deduplicated by servers with
+// dedup enabled.
+func (r *replayer) flush(ctx context.Context, service string) error {
+	batch := models.LogBatch{ServiceName: service, Entries: r.pending[service]}
+	delete(r.pending, service)
+	batch.ContentHash = batch.HashContent()
+	batch.BatchID = batch.ContentHash[:32]
+	return r.send(ctx, batch)
+}
+
+// flushAll sends every service's pending entries
+func (r *replayer) flushAll(ctx context.Context) error {
+	for service := range r.pending {
+		if err := r.flush(ctx, service); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send ingests a batch, retrying retryable errors. Batches that still
+// fail are counted and kept in the failed file, if any; only
+// cancellation stops the replay.
+func (r *replayer) send(ctx context.Context, batch models.LogBatch) error {
+	r.batches++
+	if r.client == nil {
+		r.entries += len(batch.Entries)
+		return nil
+	}
+	if err := r.wait(ctx); err != nil {
+		return err
+	}
+
+	err := retry.Do(ctx, retry.DefaultConfig(), func() error {
+		err := r.client.ingest(ctx, batch)
+		var rejected *tailer.RejectedError
+		if errors.As(err, &rejected) {
+			return retry.Permanent(err)
+		}
+		return err
+	})
+	if err == nil {
+		r.entries += len(batch.Entries)
+		return nil
+	}
+
+	r.failedEntries += len(batch.Entries)
+	fmt.Fprintf(os.Stderr, "Failed to ingest %d entries for %s: %v\n", len(batch.Entries), batch.ServiceName, err)
+	if r.failed != nil {
+		if writeErr := r.failed.Write(tailer.NewDeadLetterRecord(batch, err)); writeErr != nil {
+			return writeErr
+		}
+	}
+	return ctx.Err()
+}
+
+// wait paces sends so entries average at most rate per second
+func (r *replayer) wait(ctx context.Context) error {
+	if r.rate == 0 {
+		return nil
+	}
+	due := r.start.Add(time.Duration(float64(r.entries+r.failedEntries) / r.rate * float64(time.Second)))
+	delay := time.Until(due)
+	if delay <= 0 {
+		return nil
+	}
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ingest posts a batch to the ingest endpoint. Errors the server marks as
+// not retryable are returned as a *tailer.RejectedError.
+func (c *client) ingest(ctx context.Context, batch models.LogBatch) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("failed to marshal batch: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/v1/logs/ingest", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 300 {
+		return nil
+	}
+
+	apiErr := models.NewAPIError(resp.StatusCode, strings.TrimSpace(string(data)))
+	var errResp models.ErrorResponse
+	if json.Unmarshal(data, &errResp) == nil && errResp.Error.Code != "" {
+		apiErr = errResp.Error
+	}
+	if apiErr.Retryable {
+		return fmt.Errorf("server returned %s: %s", resp.Status, apiErr.Message)
+	}
+	return &tailer.RejectedError{StatusCode: resp.StatusCode, Err: apiErr}
+}
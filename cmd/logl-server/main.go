@@ -2,8 +2,11 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -12,12 +15,14 @@ import (
 	"github.com/oicur0t/logl/internal/config"
 	"github.com/oicur0t/logl/internal/server"
 	"github.com/oicur0t/logl/pkg/mtls"
+	"github.com/oicur0t/logl/pkg/secrets"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
 func main() {
 	configPath := flag.String("config", "/etc/logl/server.yaml", "Path to configuration file")
+	selfTest := flag.Bool("self-test", false, "Check MongoDB access, TLS material, and listen addresses, print a report, and exit")
 	flag.Parse()
 
 	// Load configuration
@@ -27,6 +32,13 @@ func main() {
 		os.Exit(1)
 	}
 
+	if *selfTest {
+		if !runSelfTest(cfg) {
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Initialize logger
 	logger, err := initLogger(cfg.LogLevel, cfg.LogFormat)
 	if err != nil {
@@ -39,6 +51,27 @@ func main() {
 		zap.String("listen", cfg.Server.ListenAddress),
 		zap.String("database", cfg.MongoDB.Database))
 
+	// Create secret manager clients, fetching the MongoDB URI if it's a
+	// secret reference
+	vault, resolver, err := cfg.Secrets.NewClients()
+	if err != nil {
+		logger.Fatal("Failed to configure secrets", zap.Error(err))
+	}
+	if secrets.IsReference(cfg.MongoDB.URI) {
+		secretCtx, cancel := context.WithTimeout(context.Background(), cfg.Secrets.Timeout)
+		cfg.MongoDB.URI, err = resolver.Resolve(secretCtx, cfg.MongoDB.URI)
+		cancel()
+		if err != nil {
+			logger.Fatal("Failed to fetch MongoDB URI", zap.Error(err))
+		}
+	}
+
+	// Compile collection templates
+	templates, err := server.NewCollectionTemplates(cfg.CollectionTemplates)
+	if err != nil {
+		logger.Fatal("Invalid collection templates", zap.Error(err))
+	}
+
 	// Create MongoDB storage
 	storage, err := server.NewStorage(
 		cfg.MongoDB.URI,
@@ -46,18 +79,371 @@ func main() {
 		cfg.MongoDB.CollectionPrefix,
 		cfg.MongoDB.CertificateKeyFile,
 		cfg.MongoDB.MaxPoolSize,
+		cfg.MongoDB.MinPoolSize,
 		cfg.MongoDB.TTLDays,
+		templates,
+		cfg.MongoDB.LabelIndexes,
+		cfg.MongoDB.QuarantineCollection,
 		logger,
 	)
 	if err != nil {
 		logger.Fatal("Failed to create storage", zap.Error(err))
 	}
 
-	// Create log parser
-	parser := server.NewLogParser(cfg.JSONParsing, logger)
+	storage.SetTimeSeries(cfg.MongoDB.TimeSeries)
+	storage.SetPartitioning(cfg.MongoDB.Partitioning)
+	storage.SetRetention(cfg.Retention)
+	storage.SetQuery(cfg.Query)
+	if err := storage.SetIndexes(cfg.MongoDB.Indexes); err != nil {
+		logger.Fatal("Invalid index configuration", zap.Error(err))
+	}
+	retentionCtx, cancelRetention := context.WithTimeout(context.Background(), cfg.MongoDB.Timeout)
+	if err := storage.LoadRetentionOverrides(retentionCtx); err != nil {
+		logger.Warn("Failed to load retention overrides", zap.Error(err))
+	}
+	cancelRetention()
+
+	// Create notifier, shared by quotas, alerts, and certificate monitoring
+	notifier := server.NewNotifier(cfg.Notifications, logger)
+
+	// Isolate tenants, before warmup so their retention applies
+	var tenancy *server.Tenancy
+	if cfg.Tenancy.Enabled {
+		tenancy = server.NewTenancy(storage, cfg.Tenancy, notifier, logger)
+		tenancyCtx, cancel := context.WithTimeout(context.Background(), cfg.MongoDB.Timeout)
+		if err := tenancy.Refresh(tenancyCtx); err != nil {
+			logger.Warn("Failed to load service ownership", zap.Error(err))
+		}
+		cancel()
+		storage.SetTenancy(tenancy)
+	}
+
+	// Coalesce concurrent batches into larger inserts
+	if cfg.BulkWriter.Enabled {
+		storage.SetBulkWriter(server.NewBulkWriter(storage, cfg.BulkWriter, logger))
+	}
+
+	// Warm up collections and indexes before accepting traffic
+	if cfg.Warmup.Enabled {
+		warmupCtx, cancel := context.WithTimeout(context.Background(), cfg.Warmup.Timeout)
+		if err := storage.Warmup(warmupCtx); err != nil {
+			logger.Warn("Storage warmup incomplete", zap.Error(err))
+		}
+		cancel()
+	}
+
+	// Create log parser, with optional level detection
+	var levels *server.LevelDetector
+	if cfg.LevelDetection.Enabled {
+		levels = server.NewLevelDetector(cfg.LevelDetection)
+	}
+	parser, err := server.NewLogParser(cfg.Parsing, levels, logger)
+	if err != nil {
+		logger.Fatal("Invalid parsing configuration", zap.Error(err))
+	}
+
+	// Create query auditor
+	var auditor *server.QueryAuditor
+	if cfg.QueryAudit.Enabled {
+		auditor = server.NewQueryAuditor(storage, cfg.QueryAudit, logger)
+	}
+
+	// Create quota manager
+	var quotas *server.QuotaManager
+	if cfg.Quotas.Enabled {
+		quotas = server.NewQuotaManager(cfg.Quotas, notifier)
+	}
+
+	// Sample and rate limit chatty services
+	var throttle *server.IngestThrottle
+	if cfg.Throttling.Enabled {
+		throttle = server.NewIngestThrottle(cfg.Throttling)
+	}
+
+	// Create reparser for re-running parsing over stored entries
+	reparser := server.NewReparser(storage, parser, logger)
+
+	// Create relabeler for bulk label and service name fixes
+	relabeler := server.NewRelabeler(storage, cfg.Relabel, logger)
+
+	// Create pattern differ for comparing time windows
+	patterns := server.NewPatternDiffer(storage, cfg.PatternDiff, logger)
+
+	// Create live-tail broadcaster
+	var liveTail *server.LiveTail
+	if cfg.LiveTail.Enabled {
+		liveTail = server.NewLiveTail(cfg.LiveTail.BufferSize)
+	}
+
+	// Create access token manager
+	var tokens *server.TokenManager
+	if cfg.Tokens.Enabled {
+		tokens = server.NewTokenManager(storage, cfg.Tokens.Secret, cfg.Tokens.Collection, cfg.Tokens.MaxTTL, logger)
+	}
+
+	// Create server-side redaction
+	redactor, err := server.NewRedactor(cfg.Redaction)
+	if err != nil {
+		logger.Fatal("Failed to configure redaction", zap.Error(err))
+	}
+
+	// Background jobs run until shutdown
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+
+	// Create per-minute rollups, checkpointed in the background
+	var rollups *server.Rollups
+	rollupsDone := make(chan struct{})
+	if cfg.Rollups.Enabled {
+		rollups = server.NewRollups(storage, cfg.Rollups, logger)
+		indexCtx, cancel := context.WithTimeout(context.Background(), cfg.MongoDB.Timeout)
+		if err := rollups.EnsureIndexes(indexCtx); err != nil {
+			logger.Warn("Failed to ensure rollup indexes", zap.Error(err))
+		}
+		cancel()
+
+		go func() {
+			defer close(rollupsDone)
+			rollups.Start(backgroundCtx)
+		}()
+	} else {
+		close(rollupsDone)
+	}
+
+	// Mute notifications and sample entries during maintenance windows
+	var maint *server.MaintenanceManager
+	if cfg.Maintenance.Enabled {
+		maint = server.NewMaintenanceManager(storage, cfg.Maintenance, logger)
+		indexCtx, cancel := context.WithTimeout(context.Background(), cfg.MongoDB.Timeout)
+		if err := maint.EnsureIndexes(indexCtx); err != nil {
+			logger.Warn("Failed to ensure maintenance window indexes", zap.Error(err))
+		}
+		cancel()
+		notifier.SetMaintenance(maint)
+		go maint.Start(backgroundCtx)
+	}
+
+	// Pick up service claims and assignments made on other instances
+	if tenancy != nil {
+		go tenancy.Start(backgroundCtx)
+	}
+
+	// Keep indexes in line with configuration off the insert path; warmup
+	// covers startup unless it is disabled
+	if !cfg.Warmup.Enabled {
+		go func() {
+			if err := storage.EnsureAllIndexes(backgroundCtx); err != nil {
+				logger.Warn("Failed to ensure indexes at startup", zap.Error(err))
+			}
+		}()
+	}
+	if cfg.MongoDB.Indexes.CheckInterval > 0 {
+		go server.NewIndexMaintainer(storage, cfg.MongoDB.Indexes, logger).Start(backgroundCtx)
+	}
+
+	// Drop partitions past retention instead of TTL deletes
+	if cfg.MongoDB.Partitioning.Interval != "" {
+		go server.NewPartitionRetention(storage, cfg.MongoDB.Partitioning, logger).Start(backgroundCtx)
+	}
+
+	// Monitor certificate expiry, alerting through the notifier
+	var certs *server.CertMonitor
+	if cfg.MTLS.Enabled && cfg.CertMonitor.Enabled {
+		certs = server.NewCertMonitor(cfg.CertMonitor, cfg.MTLS, notifier, logger)
+		go certs.Start(backgroundCtx)
+	}
+
+	// Create batch deduplication for idempotent retries
+	var dedup *server.Deduplicator
+	if cfg.Dedup.Enabled {
+		dedup = server.NewDeduplicator(storage, cfg.Dedup, logger)
+		indexCtx, cancel := context.WithTimeout(context.Background(), cfg.MongoDB.Timeout)
+		if err := dedup.EnsureIndexes(indexCtx); err != nil {
+			logger.Warn("Failed to ensure dedup indexes", zap.Error(err))
+		}
+		cancel()
+	}
+
+	// Create batch loss detection, recording gaps in the background
+	var delivery *server.DeliveryTracker
+	if cfg.Delivery.Enabled {
+		delivery = server.NewDeliveryTracker(storage, cfg.Delivery, logger)
+		indexCtx, cancel := context.WithTimeout(context.Background(), cfg.MongoDB.Timeout)
+		if err := delivery.EnsureIndexes(indexCtx); err != nil {
+			logger.Warn("Failed to ensure delivery gap indexes", zap.Error(err))
+		}
+		cancel()
+		go delivery.Start(backgroundCtx)
+	}
+
+	// Buffer batches while MongoDB is unavailable, writing them in the background
+	var buffer *server.WriteBuffer
+	bufferDone := make(chan struct{})
+	if cfg.WriteBuffer.Enabled {
+		buffer, err = server.NewWriteBuffer(storage, cfg.WriteBuffer, logger)
+		if err != nil {
+			logger.Fatal("Failed to create write buffer", zap.Error(err))
+		}
+		go func() {
+			defer close(bufferDone)
+			buffer.Start(backgroundCtx)
+		}()
+	} else {
+		close(bufferDone)
+	}
+
+	// Create compression dictionary trainer, retraining in the background
+	var dicts *server.DictionaryTrainer
+	if cfg.Compression.Dictionaries.Enabled {
+		dicts = server.NewDictionaryTrainer(storage, cfg.Compression.Dictionaries, logger)
+		go dicts.Start(backgroundCtx)
+	}
+
+	// Fault injection, only available in builds with the faults tag
+	faults := server.NewFaultInjector(logger)
+	storage.SetFaultInjector(faults)
+
+	// Sample the server's own metrics into the metrics history
+	var metrics *server.ServerMetrics
+	metricsDone := make(chan struct{})
+	if cfg.MetricsHistory.Enabled {
+		metrics = server.NewServerMetrics(storage, buffer, liveTail, cfg.MetricsHistory, logger)
+		indexCtx, cancel := context.WithTimeout(context.Background(), cfg.MongoDB.Timeout)
+		if err := metrics.EnsureIndexes(indexCtx); err != nil {
+			logger.Warn("Failed to ensure metrics history indexes", zap.Error(err))
+		}
+		cancel()
+	}
+
+	// Map Heroku Logplex drain tokens to services
+	var heroku *server.HerokuDrains
+	if cfg.Heroku.Enabled {
+		heroku = server.NewHerokuDrains(cfg.Heroku)
+	}
+
+	// Evaluate alerting rules on ingest, resolving alerts in the background
+	var alerts *server.Alerter
+	if cfg.Alerting.Enabled {
+		alerts, err = server.NewAlerter(cfg.Alerting, logger)
+		if err != nil {
+			logger.Fatal("Failed to configure alerting", zap.Error(err))
+		}
+		if maint != nil {
+			alerts.SetMaintenance(maint)
+		}
+		go alerts.Start(backgroundCtx)
+	}
+
+	// Forward matching entries to webhooks, sending in the background
+	var forwarder *server.Forwarder
+	forwardDone := make(chan struct{})
+	if cfg.Forwarding.Enabled {
+		forwarder, err = server.NewForwarder(cfg.Forwarding, logger)
+		if err != nil {
+			logger.Fatal("Failed to configure forwarding", zap.Error(err))
+		}
+		go func() {
+			defer close(forwardDone)
+			forwarder.Start(backgroundCtx)
+		}()
+	} else {
+		close(forwardDone)
+	}
+
+	// Publish matching entries to Kafka, writing in the background
+	var kafka *server.KafkaOutput
+	kafkaDone := make(chan struct{})
+	if cfg.Kafka.Enabled {
+		kafka, err = server.NewKafkaOutput(cfg.Kafka, logger)
+		if err != nil {
+			logger.Fatal("Failed to configure Kafka output", zap.Error(err))
+		}
+		go func() {
+			defer close(kafkaDone)
+			kafka.Start(backgroundCtx)
+		}()
+	} else {
+		close(kafkaDone)
+	}
+
+	// Publish matching entries to NATS JetStream, publishing in the background
+	var natsOutput *server.NATSOutput
+	natsDone := make(chan struct{})
+	if cfg.NATS.Enabled {
+		natsOutput, err = server.NewNATSOutput(cfg.NATS, logger)
+		if err != nil {
+			logger.Fatal("Failed to configure NATS output", zap.Error(err))
+		}
+		go func() {
+			defer close(natsDone)
+			natsOutput.Start(backgroundCtx)
+		}()
+	} else {
+		close(natsDone)
+	}
+
+	// Start sampling metrics once the outputs it reports on exist
+	if metrics != nil {
+		metrics.SetOutputs(forwarder, kafka, natsOutput)
+		go func() {
+			defer close(metricsDone)
+			metrics.Start(backgroundCtx)
+		}()
+	} else {
+		close(metricsDone)
+	}
+
+	// Route entries to sinks by rule, writing file and S3 sinks in the
+	// background
+	var router *server.Router
+	routingDone := make(chan struct{})
+	if cfg.Routing.Enabled {
+		router, err = server.NewRouter(cfg.Routing, logger)
+		if err != nil {
+			logger.Fatal("Failed to configure routing", zap.Error(err))
+		}
+		go func() {
+			defer close(routingDone)
+			router.Start(backgroundCtx)
+		}()
+	} else {
+		close(routingDone)
+	}
+
+	// Trust tailers that parse their own entries
+	var preParsed *server.PreParsedTrust
+	if cfg.PreParsed.Enabled {
+		preParsed = server.NewPreParsedTrust(cfg.PreParsed)
+	}
+
+	// Catalog fields and values per service for query autocomplete
+	var fields *server.FieldCatalog
+	if cfg.Autocomplete.Enabled {
+		fields = server.NewFieldCatalog(storage, cfg.Autocomplete, logger)
+	}
+
+	// Advertise the server's region and keep entries within it
+	region := server.NewRegionPolicy(cfg.Region)
+	if region != nil {
+		logger.Info("Serving region",
+			zap.String("region", region.Name()),
+			zap.Bool("reject_foreign", cfg.Region.RejectForeign),
+			zap.Bool("pin_queries", cfg.Region.PinQueries))
+	}
+
+	// Reject revoked client certificates
+	var revocation *server.Revocation
+	if cfg.MTLS.Enabled && cfg.MTLS.Revocation.Enabled {
+		revocation = server.NewRevocation(cfg.MTLS.Revocation, logger)
+		crlCtx, cancel := context.WithTimeout(context.Background(), cfg.MTLS.Revocation.Timeout)
+		if err := revocation.LoadCRL(crlCtx); err != nil {
+			logger.Warn("Failed to load CRL", zap.Error(err))
+		}
+		cancel()
+		go revocation.Start(backgroundCtx)
+	}
 
 	// Create handler
-	handler := server.NewHandler(storage, parser, logger)
+	handler := server.NewHandler(storage, parser, auditor, quotas, reparser, relabeler, liveTail, tokens, redactor, rollups, delivery, dedup, certs, buffer, dicts, patterns, maint, faults, heroku, metrics, alerts, preParsed, fields, forwarder, kafka, natsOutput, region, router, throttle, tenancy, server.NewIngestLimits(cfg.IngestLimits), cfg.Query.MaxLimit, cfg.IndexStats.UnusedDays, logger)
 
 	// Create HTTP mux
 	mux := http.NewServeMux()
@@ -65,21 +451,116 @@ func main() {
 	// Health endpoint without mTLS (for health checks)
 	mux.HandleFunc("/v1/health", handler.Health)
 
-	// Protected endpoints with mTLS
-	ingestHandler := http.HandlerFunc(handler.IngestLogs)
-	if cfg.MTLS.Enabled {
-		ingestHandler = server.MTLSMiddleware(logger)(ingestHandler).(http.HandlerFunc)
+	// Protected endpoints with mTLS. With tenancy, tenant API keys are
+	// accepted in place of a certificate and every request is confined to
+	// its tenant's services.
+	scope := func(h http.Handler, auth func(http.Handler) http.Handler) http.Handler {
+		if tenancy != nil {
+			h = server.TenantMiddleware(tenancy, logger)(h)
+		}
+		if auth != nil {
+			h = auth(h)
+		}
+		if tenancy != nil {
+			h = server.APIKeyMiddleware(tenancy, logger)(h)
+		}
+		return h
 	}
-	mux.Handle("/v1/logs/ingest", ingestHandler)
+	protect := func(h http.HandlerFunc) http.Handler {
+		if cfg.MTLS.Enabled {
+			return scope(h, server.MTLSMiddleware(revocation, logger))
+		}
+		return scope(h, nil)
+	}
+	mux.Handle("/v1/logs/ingest", protect(handler.IngestLogs))
+
+	// Heroku can't present a client certificate, so drains authenticate
+	// with their drain token and basic auth password instead
+	if heroku != nil {
+		mux.HandleFunc("/v1/drains/heroku", handler.HerokuDrain)
+	}
+
+	// Read endpoints also accept scoped access tokens when enabled
+	read := protect
+	if tokens != nil {
+		read = func(h http.HandlerFunc) http.Handler {
+			return scope(h, server.ReadAccessMiddleware(tokens, revocation, cfg.MTLS.Enabled, logger))
+		}
+	}
+	mux.Handle("/v1/logs/query", read(handler.QueryLogs))
+	mux.Handle("/v1/logs/export", read(handler.ExportLogs))
+	mux.Handle("/v1/logs/file", read(handler.FileLines))
+	mux.Handle("/v1/logs/tail", read(handler.LiveTail))
+	mux.Handle("/v1/logs/saved", read(handler.SavedQuery))
+	mux.Handle("/v1/logs/stats", read(handler.Stats))
+	mux.Handle("/v1/logs/stats/histogram", read(handler.StatsHistogram))
+	mux.Handle("/v1/logs/stats/group", read(handler.StatsGroup))
+	mux.Handle("/v1/logs/stats/top", read(handler.StatsTop))
+	mux.Handle("/v1/logs/diff", read(handler.PatternDiff))
+	mux.Handle("/v1/logs/fields", read(handler.Fields))
+	// The web UI authenticates like the read endpoints it calls. Service
+	// token holders open it as /ui?service=<name>&token=<token>.
+	if cfg.UI.Enabled {
+		mux.Handle("/ui", read(handler.UI))
+		mux.Handle("/ui/", read(handler.UI))
+	}
+	// Traces span services, so service-scoped tokens don't apply
+	mux.Handle("/v1/logs/trace", protect(handler.Trace))
+
+	// The admin APIs require an admin identity: a certificate in
+	// admin.clients, the admin token, or an admin tenant. Without one they
+	// are read-only, and the routes that only change things aren't served.
+	adminConfigured := len(cfg.Admin.Clients) > 0 || cfg.Admin.Token != "" ||
+		(tenancy != nil && len(cfg.Tenancy.AdminTenants) > 0)
+	admin := func(h http.HandlerFunc) http.Handler {
+		return scope(h, server.AdminMiddleware(cfg.Admin.Clients, cfg.Admin.Token, tenancy, revocation, logger))
+	}
+	if !adminConfigured {
+		logger.Warn("No admin identity configured; admin APIs are read-only. Set admin.clients or admin.token to enable them.")
+		admin = func(h http.HandlerFunc) http.Handler {
+			return server.ReadOnlyMiddleware()(protect(h))
+		}
+	}
+	destructive := func(pattern string, h http.HandlerFunc) {
+		if adminConfigured {
+			mux.Handle(pattern, admin(h))
+		}
+	}
+	destructive("/v1/admin/tokens", handler.Tokens)
+	mux.Handle("/v1/admin/queries/explain", admin(handler.ExplainQuery))
+	mux.Handle("/v1/admin/retention", admin(handler.Retention))
+	mux.Handle("/v1/admin/retention/preview", admin(handler.RetentionPreview))
+	mux.Handle("/v1/admin/indexes", admin(handler.IndexStats))
+	mux.Handle("/v1/admin/services", admin(handler.Services))
+	destructive("/v1/admin/services/rename", handler.RenameService)
+	destructive("/v1/admin/services/indexes", handler.RebuildIndexes)
+	destructive("/v1/admin/reparse", handler.Reparse)
+	destructive("/v1/admin/relabel", handler.Relabel)
+	mux.Handle("/v1/admin/dictionaries", admin(handler.Dictionaries))
+	mux.Handle("/v1/admin/delivery", admin(handler.Delivery))
+	mux.Handle("/v1/admin/certificates", admin(handler.Certificates))
+	mux.Handle("/v1/admin/metrics", admin(handler.MetricsHistory))
+	mux.Handle("/v1/admin/alerts", admin(handler.Alerts))
+	mux.Handle("/v1/admin/forwarding", admin(handler.Forwarding))
+	mux.Handle("/v1/admin/kafka", admin(handler.Kafka))
+	mux.Handle("/v1/admin/nats", admin(handler.NATS))
+	mux.Handle("/v1/admin/outputs", admin(handler.Outputs))
+	mux.Handle("/v1/admin/routing", admin(handler.Routing))
+	mux.Handle("/v1/admin/throttling", admin(handler.Throttling))
+	mux.Handle("/v1/admin/tenants", admin(handler.Tenants))
+	mux.Handle("/v1/admin/maintenance", admin(handler.Maintenance))
+	destructive("/v1/admin/faults", handler.Faults)
 
 	// Apply global middleware
 	var httpHandler http.Handler = mux
 	httpHandler = server.RecoveryMiddleware(logger)(httpHandler)
+	if metrics != nil {
+		httpHandler = server.MetricsMiddleware(metrics)(httpHandler)
+	}
 	httpHandler = server.LoggingMiddleware(logger)(httpHandler)
 
 	// Create HTTP server
 	httpServer := &http.Server{
-		Addr:         cfg.Server.ListenAddress,
 		Handler:      httpHandler,
 		ReadTimeout:  cfg.Server.ReadTimeout,
 		WriteTimeout: cfg.Server.WriteTimeout,
@@ -88,29 +569,70 @@ func main() {
 	// Load TLS configuration if mTLS is enabled
 	if cfg.MTLS.Enabled {
 		requireClientCert := cfg.MTLS.ClientAuth == "require"
-		tlsConfig, err := mtls.LoadServerTLSConfig(
-			cfg.MTLS.CACert,
-			cfg.MTLS.ServerCert,
-			cfg.MTLS.ServerKey,
-			requireClientCert,
-		)
-		if err != nil {
-			logger.Fatal("Failed to load TLS config", zap.Error(err))
+		var tlsConfig *tls.Config
+		if cfg.MTLS.VaultPKI.Role != "" {
+			tlsConfig, err = vaultServerTLSConfig(backgroundCtx, cfg, vault, certs, logger)
+			if err != nil {
+				logger.Fatal("Failed to issue server certificate", zap.Error(err))
+			}
+		} else {
+			serverCert, err := mtls.LoadKeyPair(cfg.MTLS.ServerCert, cfg.MTLS.ServerKey, mtls.PassphraseFrom(cfg.MTLS.KeyPassphraseFile, cfg.MTLS.KeyPassphraseEnv))
+			if err != nil {
+				logger.Fatal("Failed to load server certificate", zap.Error(err))
+			}
+			tlsConfig, err = mtls.ServerTLSConfig(cfg.MTLS.CACert, serverCert, requireClientCert)
+			if err != nil {
+				logger.Fatal("Failed to load TLS config", zap.Error(err))
+			}
+
+			// Pick up rotated server certificates without a restart
+			hup := make(chan os.Signal, 1)
+			signal.Notify(hup, syscall.SIGHUP)
+			go serverCert.Watch(backgroundCtx, cfg.MTLS.ReloadInterval, hup, func(leaf *x509.Certificate, err error) {
+				if err != nil {
+					logger.Error("Failed to reload server certificate, keeping the current one", zap.Error(err))
+					return
+				}
+				logger.Info("Reloaded server certificate",
+					zap.String("subject", leaf.Subject.String()),
+					zap.Time("not_after", leaf.NotAfter))
+			})
+		}
+		faults.WrapTLSConfig(tlsConfig)
+		if certs != nil {
+			certs.WrapTLSConfig(tlsConfig)
 		}
 		httpServer.TLSConfig = tlsConfig
 	}
 
-	// Start server in a goroutine
-	serverErrors := make(chan error, 1)
-	go func() {
-		logger.Info("HTTP server starting", zap.String("addr", cfg.Server.ListenAddress))
-
-		if cfg.MTLS.Enabled {
-			serverErrors <- httpServer.ListenAndServeTLS("", "") // Certs loaded via TLSConfig
-		} else {
-			serverErrors <- httpServer.ListenAndServe()
+	// Bind every listen address before serving so a bad bind fails startup
+	listeners := make([]net.Listener, 0, len(cfg.Server.Binds))
+	for _, bind := range cfg.Server.Binds {
+		ln, err := net.Listen(bind.Network, bind.Address)
+		if err != nil {
+			logger.Fatal("Failed to listen",
+				zap.String("network", bind.Network),
+				zap.String("addr", bind.Address),
+				zap.Error(err))
 		}
-	}()
+		listeners = append(listeners, ln)
+	}
+
+	// Serve each listener in its own goroutine
+	serverErrors := make(chan error, len(listeners))
+	for _, ln := range listeners {
+		go func(ln net.Listener) {
+			logger.Info("HTTP server starting",
+				zap.String("network", ln.Addr().Network()),
+				zap.String("addr", ln.Addr().String()))
+
+			if cfg.MTLS.Enabled {
+				serverErrors <- httpServer.ServeTLS(ln, "", "") // Certs loaded via TLSConfig
+			} else {
+				serverErrors <- httpServer.Serve(ln)
+			}
+		}(ln)
+	}
 
 	// Setup signal handling
 	sigChan := make(chan os.Signal, 1)
@@ -133,6 +655,19 @@ func main() {
 			httpServer.Close()
 		}
 
+		// Stop background jobs, checkpoint outstanding rollup counts, spill
+		// batches still waiting in the write buffer, write a last metrics
+		// sample, and send entries still queued for forwarding, Kafka, NATS,
+		// and routing sinks
+		stopBackground()
+		<-rollupsDone
+		<-bufferDone
+		<-metricsDone
+		<-forwardDone
+		<-kafkaDone
+		<-natsDone
+		<-routingDone
+
 		// Close MongoDB connection
 		if err := storage.Close(ctx); err != nil {
 			logger.Error("Failed to close MongoDB connection", zap.Error(err))
@@ -143,6 +678,51 @@ func main() {
 }
 
 // initLogger creates a configured zap logger
+// vaultServerTLSConfig issues the server certificate from Vault and keeps
+// renewing it. Clients are verified against ca_cert, or failing that the
+// CA that issued the server certificate.
+func vaultServerTLSConfig(ctx context.Context, cfg *config.ServerConfig, vault *secrets.Vault, certs *server.CertMonitor, logger *zap.Logger) (*tls.Config, error) {
+	req := cfg.MTLS.VaultPKI.Request()
+	issueCtx, cancel := context.WithTimeout(ctx, cfg.Secrets.Timeout)
+	issued, err := vault.IssueCertificate(issueCtx, req)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	serverCert, err := mtls.NewKeyPair(issued.Certificate)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Issued server certificate from Vault",
+		zap.String("subject", issued.Leaf.Subject.String()),
+		zap.Time("not_after", issued.Leaf.NotAfter))
+
+	requireClientCert := cfg.MTLS.ClientAuth == "require"
+	tlsConfig := mtls.ServerTLSConfigWithCAs(issued.CAs, serverCert, requireClientCert)
+	if cfg.MTLS.CACert != "" {
+		if tlsConfig, err = mtls.ServerTLSConfig(cfg.MTLS.CACert, serverCert, requireClientCert); err != nil {
+			return nil, err
+		}
+	}
+	if certs != nil {
+		certs.SetServerCertificate(serverCert)
+	}
+
+	// Renewal isn't triggered by SIGHUP, which would otherwise stop the
+	// server
+	signal.Ignore(syscall.SIGHUP)
+	go vault.RenewCertificate(ctx, req, serverCert, func(leaf *x509.Certificate, err error) {
+		if err != nil {
+			logger.Error("Failed to renew server certificate from Vault, keeping the current one", zap.Error(err))
+			return
+		}
+		logger.Info("Renewed server certificate from Vault",
+			zap.String("subject", leaf.Subject.String()),
+			zap.Time("not_after", leaf.NotAfter))
+	})
+	return tlsConfig, nil
+}
+
 func initLogger(level string, format string) (*zap.Logger, error) {
 	var zapLevel zapcore.Level
 	if err := zapLevel.UnmarshalText([]byte(level)); err != nil {
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/internal/server"
+	"github.com/oicur0t/logl/pkg/mtls"
+	"github.com/oicur0t/logl/pkg/secrets"
+	"github.com/oicur0t/logl/pkg/selftest"
+	"go.uber.org/zap"
+)
+
+// certExpiryWarningDays flags certificates close to expiry in the self-test
+const certExpiryWarningDays = 30
+
+// runSelfTest checks MongoDB access, TLS material, and listen addresses,
+// prints a pass/fail report, and returns false if any check failed
+func runSelfTest(cfg *config.ServerConfig) bool {
+	report := &selftest.Report{}
+
+	vault := checkSecrets(report, cfg)
+	checkMongoDB(report, cfg.MongoDB)
+	if cfg.MTLS.Enabled && cfg.MTLS.VaultPKI.Role != "" {
+		checkVaultCertificate(report, vault, cfg)
+	} else if cfg.MTLS.Enabled {
+		checkCertificates(report, cfg.MTLS)
+	} else {
+		report.Warn("mTLS", "disabled; ingest and query endpoints accept unauthenticated plain HTTP")
+	}
+	checkBinds(report, cfg.Server.Binds)
+
+	report.Print(os.Stdout)
+	return !report.Failed()
+}
+
+// checkSecrets logs in to Vault and fetches a referenced MongoDB URI into
+// cfg, returning the Vault client if one is configured
+func checkSecrets(report *selftest.Report, cfg *config.ServerConfig) *secrets.Vault {
+	vault, resolver, err := cfg.Secrets.NewClients()
+	if err != nil {
+		report.Fail("secrets", "%v", err)
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Secrets.Timeout)
+	defer cancel()
+
+	if vault != nil {
+		if err := vault.Login(ctx); err != nil {
+			report.Fail("vault login", "%v; check secrets.vault", err)
+			vault = nil
+		} else {
+			report.Pass("vault login", "obtained a token from %s", cfg.Secrets.Vault.Address)
+		}
+	}
+	if secrets.IsReference(cfg.MongoDB.URI) {
+		uri, err := resolver.Resolve(ctx, cfg.MongoDB.URI)
+		if err != nil {
+			report.Fail("mongodb uri", "%v", err)
+			return vault
+		}
+		cfg.MongoDB.URI = uri
+		report.Pass("mongodb uri", "fetched from the secret manager")
+	}
+	return vault
+}
+
+// checkVaultCertificate issues a server certificate from the Vault PKI
+// role
+func checkVaultCertificate(report *selftest.Report, vault *secrets.Vault, cfg *config.ServerConfig) {
+	if vault == nil {
+		report.Fail("vault certificate", "can't issue without a Vault login")
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Secrets.Timeout)
+	defer cancel()
+
+	issued, err := vault.IssueCertificate(ctx, cfg.MTLS.VaultPKI.Request())
+	if err != nil {
+		report.Fail("vault certificate", "%v; check mtls.vault_pki and the token's policy", err)
+		return
+	}
+	report.Pass("vault certificate", "issued %s, valid until %s", issued.Leaf.Subject, issued.Leaf.NotAfter.Format(time.RFC3339))
+	if cfg.MTLS.CACert != "" {
+		certs, err := mtls.ParseCertificateFile(cfg.MTLS.CACert)
+		if err != nil {
+			report.Fail("certificate "+cfg.MTLS.CACert, "%v", err)
+			return
+		}
+		report.CheckExpiry(mtls.Describe(cfg.MTLS.CACert, certs[0]), certExpiryWarningDays)
+	}
+}
+
+// checkMongoDB connects and writes to a probe collection
+func checkMongoDB(report *selftest.Report, cfg config.MongoDBConfig) {
+	storage, err := server.NewStorage(
+		cfg.URI,
+		cfg.Database,
+		cfg.CollectionPrefix,
+		cfg.CertificateKeyFile,
+		cfg.MaxPoolSize,
+		0,
+		cfg.TTLDays,
+		nil,
+		nil,
+		cfg.QuarantineCollection,
+		zap.NewNop(),
+	)
+	if err != nil {
+		report.Fail("mongodb connection", "%v; check mongodb.uri, network access, and mongodb.certificate_key_file", err)
+		return
+	}
+	report.Pass("mongodb connection", "connected to database %s", cfg.Database)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+	defer storage.Close(ctx)
+
+	if err := storage.Probe(ctx); err != nil {
+		report.Fail("mongodb permissions", "%v; the user needs readWrite on %s", err, cfg.Database)
+		return
+	}
+	report.Pass("mongodb permissions", "inserted and deleted a probe document")
+}
+
+// checkCertificates verifies the server TLS material loads and is within
+// its validity period
+func checkCertificates(report *selftest.Report, cfg config.ServerMTLSConfig) {
+	if _, err := mtls.LoadServerTLSConfig(cfg.CACert, cfg.ServerCert, cfg.ServerKey, cfg.ClientAuth == "require", mtls.PassphraseFrom(cfg.KeyPassphraseFile, cfg.KeyPassphraseEnv)); err != nil {
+		report.Fail("mTLS material", "%v", err)
+		return
+	}
+	report.Pass("mTLS material", "CA, server certificate, and key load")
+
+	if err := mtls.VerifyCertificateFile(cfg.ServerCert, cfg.CACert, x509.ExtKeyUsageServerAuth); err != nil {
+		// The client CA need not have issued the server certificate
+		report.Warn("server certificate chain", "%v", err)
+	} else {
+		report.Pass("server certificate chain", "verifies against the CA for server auth")
+	}
+
+	for _, path := range []string{cfg.CACert, cfg.ServerCert} {
+		certs, err := mtls.ParseCertificateFile(path)
+		if err != nil {
+			report.Fail("certificate "+path, "%v", err)
+			continue
+		}
+		report.CheckExpiry(mtls.Describe(path, certs[0]), certExpiryWarningDays)
+	}
+}
+
+// checkBinds verifies every listen address can be bound
+func checkBinds(report *selftest.Report, binds []config.ListenBindConfig) {
+	for _, bind := range binds {
+		check := "listen " + bind.Network + " " + bind.Address
+
+		ln, err := net.Listen(bind.Network, bind.Address)
+		switch {
+		case errors.Is(err, syscall.EADDRINUSE):
+			report.Fail(check, "address already in use; is another logl-server running?")
+		case errors.Is(err, syscall.EACCES):
+			report.Fail(check, "permission denied; ports below 1024 need elevated privileges")
+		case err != nil:
+			report.Fail(check, "%v", err)
+		default:
+			ln.Close()
+			report.Pass(check, "bindable")
+		}
+	}
+}
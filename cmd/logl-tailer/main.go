@@ -2,44 +2,109 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"runtime"
+	"runtime/debug"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/oicur0t/logl/internal/config"
 	"github.com/oicur0t/logl/internal/tailer"
+	"github.com/oicur0t/logl/pkg/awsauth"
+	"github.com/oicur0t/logl/pkg/ids"
 	"github.com/oicur0t/logl/pkg/mtls"
+	"github.com/oicur0t/logl/pkg/secrets"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
+// shutdownGrace is how much longer than batching.drain_timeout shutdown
+// may take before the tailer exits anyway
+const shutdownGrace = 5 * time.Second
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		if err := runReplay(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Replay failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	configPath := flag.String("config", "/etc/logl/tailer.yaml", "Path to configuration file")
+	serviceCmd := flag.String("service", "", "Manage the Windows service: install or uninstall")
+	selfTest := flag.Bool("self-test", false, "Check files, certificates, servers, and the state file, print a report, and exit")
+	backfill := flag.Bool("backfill", false, "Ship the existing content and rotated files of every log file without saved state, as with log_files[].backfill")
+	stdinMode := flag.Bool("stdin", false, "Ship lines read from stdin and exit at EOF (no config file or state)")
+	stdinService := flag.String("service-name", "", "Service name for --stdin mode")
+	stdinServer := flag.String("server-url", "", "Server ingest URL for --stdin mode")
+	stdinHostname := flag.String("hostname", "", "Hostname for --stdin mode (defaults to system hostname)")
+	caCert := flag.String("ca-cert", "/etc/logl/certs/ca.crt", "CA certificate for --stdin mode")
+	clientCert := flag.String("client-cert", "/etc/logl/certs/client.crt", "Client certificate for --stdin mode")
+	clientKey := flag.String("client-key", "/etc/logl/certs/client.key", "Client key for --stdin mode")
+	keyPassphraseFile := flag.String("key-passphrase-file", "", "File holding the client key's passphrase for --stdin mode")
+	keyPassphraseEnv := flag.String("key-passphrase-env", "", "Environment variable holding the client key's passphrase for --stdin mode")
+	serverName := flag.String("server-name", "logl-server", "TLS server name for --stdin mode")
+	stdinLabels := labelFlags{}
+	flag.Var(stdinLabels, "label", "Label key=value added to every line in --stdin mode (repeatable)")
 	flag.Parse()
 
-	// Load configuration
-	cfg, err := config.LoadTailerConfig(*configPath)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
-		os.Exit(1)
+	if *serviceCmd != "" {
+		if err := controlService(*serviceCmd, *configPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to %s service: %v\n", *serviceCmd, err)
+			os.Exit(1)
+		}
+		return
 	}
 
-	// Initialize logger
-	logger, err := initLogger(cfg.LogLevel, cfg.LogFormat)
+	if *selfTest {
+		cfg, err := config.LoadTailerConfig(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "FAIL  config %s: %v\n", *configPath, err)
+			os.Exit(1)
+		}
+		if !runSelfTest(cfg) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Running under the Windows service manager
+	if isWindowsService() {
+		if err := runService(*configPath); err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
+	var cfg *config.TailerConfig
+	var logger *zap.Logger
+	var err error
+	if *stdinMode {
+		cfg, logger, err = setupStdin(*stdinService, *stdinHostname, *stdinServer, stdinLabels, config.MTLSConfig{
+			CACert:            *caCert,
+			ClientCert:        *clientCert,
+			ClientKey:         *clientKey,
+			KeyPassphraseFile: *keyPassphraseFile,
+			KeyPassphraseEnv:  *keyPassphraseEnv,
+			ServerName:        *serverName,
+		})
+	} else {
+		cfg, logger, err = setup(*configPath)
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to initialize logger: %v\n", err)
+		fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(1)
 	}
 	defer logger.Sync()
 
-	logger.Info("Starting logl-tailer",
-		zap.String("service", cfg.ServiceName),
-		zap.String("hostname", cfg.Hostname),
-		zap.Int("log_files", len(cfg.LogFiles)))
-
 	// Create context with cancellation
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -53,85 +118,683 @@ func main() {
 		logger.Info("Received signal, shutting down", zap.String("signal", sig.String()))
 		cancel()
 
-		// Give 30 seconds for graceful shutdown
-		time.Sleep(30 * time.Second)
+		// Give the final flush its drain timeout, then force an exit
+		time.Sleep(cfg.Batching.DrainTimeout + shutdownGrace)
 		logger.Error("Forced shutdown after timeout")
 		os.Exit(1)
 	}()
 
+	if *stdinMode {
+		if err := runStdin(ctx, cfg, logger); err != nil {
+			logger.Error("Failed to ship stdin", zap.Error(err))
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := run(ctx, cfg, *configPath, *backfill, logger); err != nil {
+		logger.Error("Tailer failed", zap.Error(err))
+		os.Exit(1)
+	}
+
+	logger.Info("Tailer stopped gracefully")
+}
+
+// labelFlags collects repeated -label key=value flags
+type labelFlags map[string]string
+
+func (l labelFlags) String() string {
+	pairs := make([]string, 0, len(l))
+	for k, v := range l {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (l labelFlags) Set(value string) error {
+	key, v, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	l[key] = v
+	return nil
+}
+
+// setup loads the configuration and initializes the logger
+func setup(configPath string) (*config.TailerConfig, *zap.Logger, error) {
+	// Load configuration
+	cfg, err := config.LoadTailerConfig(configPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to load config: %w", err)
+	}
+
+	// Initialize logger
+	logger, err := initLogger(cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to initialize logger: %w", err)
+	}
+
+	logger.Info("Starting logl-tailer",
+		zap.String("service", cfg.ServiceName),
+		zap.String("hostname", cfg.Hostname),
+		zap.Int("log_files", len(cfg.LogFiles)),
+		zap.Int("event_logs", len(cfg.EventLogs)),
+		zap.Int("listeners", len(cfg.Listeners)),
+		zap.Int("generators", len(cfg.Generators)),
+		zap.Int("cloudwatch", len(cfg.CloudWatch)),
+		zap.Int("snmp_traps", len(cfg.SNMPTraps)),
+		zap.Bool("host_events", cfg.HostEvents.Enabled))
+
+	applyResourceLimits(cfg.Resources, logger)
+
+	return cfg, logger, nil
+}
+
+// applyResourceLimits sets GOMAXPROCS and the Go soft memory limit
+func applyResourceLimits(cfg config.ResourcesConfig, logger *zap.Logger) {
+	if cfg.MaxProcs > 0 {
+		runtime.GOMAXPROCS(cfg.MaxProcs)
+		logger.Info("Limited CPU parallelism", zap.Int("max_procs", cfg.MaxProcs))
+	}
+	if cfg.MaxMemoryMB > 0 {
+		debug.SetMemoryLimit(cfg.MaxMemoryMB << 20)
+		logger.Info("Set soft memory limit", zap.Int64("max_memory_mb", cfg.MaxMemoryMB))
+	}
+}
+
+// setupStdin builds the configuration for --stdin mode from flags
+func setupStdin(serviceName, hostname, serverURL string, labels map[string]string, mtlsConfig config.MTLSConfig) (*config.TailerConfig, *zap.Logger, error) {
+	cfg, err := config.NewStdinTailerConfig(serviceName, hostname, serverURL, labels, mtlsConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Invalid --stdin options: %w", err)
+	}
+
+	logger, err := initLogger(cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to initialize logger: %w", err)
+	}
+
+	return cfg, logger, nil
+}
+
+// runStdin ships stdin until EOF, then flushes and returns
+func runStdin(ctx context.Context, cfg *config.TailerConfig, logger *zap.Logger) error {
+	clientCert, err := mtls.LoadKeyPair(cfg.MTLS.ClientCert, cfg.MTLS.ClientKey, mtls.PassphraseFrom(cfg.MTLS.KeyPassphraseFile, cfg.MTLS.KeyPassphraseEnv))
+	if err != nil {
+		return fmt.Errorf("failed to load client certificate: %w", err)
+	}
+	httpClient, err := newClient(cfg, clientCert, nil, logger)
+	if err != nil {
+		return err
+	}
+	batcher, _, err := newBatcher(cfg, httpClient, logger)
+	if err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- batcher.Start(ctx)
+	}()
+
+	lineChan := batcher.GetLineChan()
+	reader := tailer.NewStdinReader(os.Stdin, cfg.ServiceName, cfg.Hostname, logger, lineChan)
+	lines, readErr := reader.Start(ctx)
+
+	// Closing the channel makes the batcher flush everything and stop
+	close(lineChan)
+	if err := <-done; err != nil {
+		return fmt.Errorf("failed to ship %d lines: %w", lines, err)
+	}
+	if readErr != nil {
+		return readErr
+	}
+
+	logger.Info("Shipped stdin", zap.Int64("lines", lines), zap.String("service", cfg.ServiceName))
+	return nil
+}
+
+// loadClientCertificate issues the client certificate from Vault, also
+// returning the CA that issued it, or loads it from files
+func loadClientCertificate(ctx context.Context, cfg *config.TailerConfig, vault *secrets.Vault, logger *zap.Logger) (*mtls.KeyPair, *x509.CertPool, error) {
+	if cfg.MTLS.VaultPKI.Role == "" {
+		clientCert, err := mtls.LoadKeyPair(cfg.MTLS.ClientCert, cfg.MTLS.ClientKey, mtls.PassphraseFrom(cfg.MTLS.KeyPassphraseFile, cfg.MTLS.KeyPassphraseEnv))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		return clientCert, nil, nil
+	}
+
+	issueCtx, cancel := context.WithTimeout(ctx, cfg.Secrets.Timeout)
+	issued, err := vault.IssueCertificate(issueCtx, cfg.MTLS.VaultPKI.Request())
+	cancel()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to issue client certificate: %w", err)
+	}
+	clientCert, err := mtls.NewKeyPair(issued.Certificate)
+	if err != nil {
+		return nil, nil, err
+	}
+	logger.Info("Issued client certificate from Vault",
+		zap.String("subject", issued.Leaf.Subject.String()),
+		zap.Time("not_after", issued.Leaf.NotAfter))
+	return clientCert, issued.CAs, nil
+}
+
+// newClient creates the upstream client, presenting clientCert. vaultCAs,
+// the CA that issued a Vault certificate, verifies the server when ca_cert
+// isn't set.
+func newClient(cfg *config.TailerConfig, clientCert *mtls.KeyPair, vaultCAs *x509.CertPool, logger *zap.Logger) (*tailer.Client, error) {
 	// Load mTLS configuration
-	tlsConfig, err := mtls.LoadClientTLSConfig(
-		cfg.MTLS.CACert,
-		cfg.MTLS.ClientCert,
-		cfg.MTLS.ClientKey,
-		cfg.MTLS.ServerName,
-	)
+	var tlsConfig *tls.Config
+	if vaultCAs != nil && cfg.MTLS.CACert == "" {
+		tlsConfig = mtls.ClientTLSConfigWithCAs(vaultCAs, clientCert, cfg.MTLS.ServerName)
+	} else {
+		var err error
+		if tlsConfig, err = mtls.ClientTLSConfig(cfg.MTLS.CACert, clientCert, cfg.MTLS.ServerName); err != nil {
+			return nil, fmt.Errorf("failed to load mTLS config: %w", err)
+		}
+	}
+
+	// Configure the egress proxy, if any
+	proxy, err := newProxyFunc(cfg.Server.Proxy)
 	if err != nil {
-		logger.Fatal("Failed to load mTLS config", zap.Error(err))
+		return nil, fmt.Errorf("failed to configure proxy: %w", err)
+	}
+
+	// Dial with the configured address-family preference
+	dial, err := tailer.NewDialFunc(cfg.Server.IPFamily, cfg.Server.FallbackDelay, cfg.Server.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure dialer: %w", err)
 	}
 
 	// Create HTTP client
 	httpClient := tailer.NewClient(
-		cfg.Server.URL,
+		cfg.Server.ServerURLs(),
+		cfg.Server.Routing,
+		cfg.Server.VirtualNodes,
 		tlsConfig,
+		proxy,
+		dial,
 		cfg.Server.Timeout,
 		cfg.Server.MaxRetries,
+		cfg.Server.CircuitBreaker,
 		logger,
 	)
+	if cfg.Region != "" {
+		httpClient.SetRegion(cfg.Region, cfg.Server.PinRegion)
+	}
+	return httpClient, nil
+}
+
+// newBatcher creates the batcher feeding httpClient, and returns the
+// processor attaching metadata labels so reloads can change them
+func newBatcher(cfg *config.TailerConfig, httpClient *tailer.Client, logger *zap.Logger) (*tailer.Batcher, *tailer.LabelProcessor, error) {
+	// Build processors applied to every entry before batching
+	var processors []tailer.Processor
+	redactor, err := cfg.Redaction.NewRedactor()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to configure redaction: %w", err)
+	}
+	if !redactor.Empty() {
+		processors = append(processors, tailer.NewRedactionProcessor(redactor))
+	}
+
+	// Parse after redaction so parsed fields only hold redacted values
+	if cfg.PreParse.Enabled {
+		processors = append(processors, tailer.NewParseProcessor(cfg.PreParse.LevelFields))
+	}
+
+	labels, err := metadataLabels(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(labels) > 0 {
+		logger.Info("Attaching metadata labels", zap.Any("labels", labels))
+	}
+	labeler := tailer.NewLabelProcessor(labels)
+	processors = append(processors, labeler)
+
+	// IDs are assigned last so dropped entries don't consume them
+	if cfg.EntryIDs != "" {
+		generator, err := ids.NewGenerator(cfg.EntryIDs)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to configure entry IDs: %w", err)
+		}
+		processors = append(processors, tailer.NewIDProcessor(generator))
+	}
 
 	// Create batcher
 	batcher := tailer.NewBatcher(
 		cfg.ServiceName,
+		cfg.AgentID,
 		cfg.Batching.MaxSize,
 		cfg.Batching.MaxWait,
 		cfg.Batching.QueueSize,
 		logger,
 		httpClient,
+		processors...,
 	)
+	batcher.SetPreParsed(cfg.PreParse.Enabled)
+	batcher.SetFlushWorkers(cfg.Batching.FlushWorkers, cfg.Batching.MaxPending)
+	batcher.SetMaxBytes(cfg.Batching.MaxBytes)
+	batcher.SetDrainTimeout(cfg.Batching.DrainTimeout)
+	deadLetter := tailer.NewDeadLetter(cfg.DeadLetter.Path, cfg.DeadLetter.MaxBytes)
+	if deadLetter != nil {
+		deadLetter.SetLimits(cfg.DeadLetter.MaxDiskPercent, cfg.DeadLetter.Overflow)
+	}
+	batcher.SetDeadLetter(deadLetter)
+
+	return batcher, labeler, nil
+}
+
+// metadataLabels resolves the labels attached to every entry, including
+// the region
+func metadataLabels(cfg *config.TailerConfig) (map[string]string, error) {
+	labels, err := resolveLabels(cfg.Metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve metadata labels: %w", err)
+	}
+	if cfg.Region != "" {
+		labels["region"] = cfg.Region
+	}
+	return labels, nil
+}
+
+// resolveLabels gathers static, environment, file, Kubernetes, and cloud
+// labels at startup and on reload. Later sources override earlier ones.
+func resolveLabels(cfg config.MetadataConfig) (map[string]string, error) {
+	labels := make(map[string]string)
+	merge := func(m map[string]string) {
+		for k, v := range m {
+			labels[k] = v
+		}
+	}
+
+	merge(cfg.Labels)
+	merge(tailer.EnvLabels(cfg.Env))
+
+	files, err := tailer.FileLabels(cfg.Files)
+	if err != nil {
+		return nil, err
+	}
+	merge(files)
 
-	// Get enabled log files and build service name mapping
-	var enabledLogFiles []string
-	serviceNames := make(map[string]string)
+	if cfg.KubernetesLabelsFile != "" {
+		k8s, err := tailer.KubernetesLabels(cfg.KubernetesLabelsFile, "k8s_")
+		if err != nil {
+			return nil, err
+		}
+		merge(k8s)
+	}
+	if cfg.KubernetesAnnotationsFile != "" {
+		k8s, err := tailer.KubernetesLabels(cfg.KubernetesAnnotationsFile, "k8s_annotation_")
+		if err != nil {
+			return nil, err
+		}
+		merge(k8s)
+	}
+
+	if cfg.Cloud != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.CloudTimeout)
+		defer cancel()
+		cloud, err := tailer.CloudLabels(ctx, cfg.Cloud)
+		if err != nil {
+			return nil, err
+		}
+		merge(cloud)
+	}
+
+	return labels, nil
+}
+
+// newProxyFunc builds the proxy selector for upstream requests
+func newProxyFunc(cfg config.ProxyConfig) (tailer.ProxyFunc, error) {
+	if cfg.URL != "" {
+		return tailer.NewProxyFunc(cfg.URL, cfg.Username, cfg.Password, cfg.NoProxy)
+	}
+	if cfg.FromEnvironment {
+		// HTTPS_PROXY, HTTP_PROXY, and NO_PROXY
+		return http.ProxyFromEnvironment, nil
+	}
+	return nil, nil
+}
+
+// fileSources returns the enabled log files
+func fileSources(cfg *config.TailerConfig) ([]tailer.FileSource, error) {
+	var sources []tailer.FileSource
 	for _, lf := range cfg.LogFiles {
 		if lf.Enabled {
-			enabledLogFiles = append(enabledLogFiles, lf.Path)
+			filter, err := tailer.NewLineFilter(lf.Include, lf.Exclude)
+			if err != nil {
+				return nil, fmt.Errorf("log file %s: %w", lf.Path, err)
+			}
+
+			source := tailer.FileSource{
+				Pattern:      lf.Path,
+				ServiceName:  lf.ServiceName,
+				Framing:      lf.Framing,
+				Filter:       filter,
+				Labels:       lf.Labels,
+				Backpressure: lf.Backpressure,
+				Backfill:     lf.Backfill,
+				ReadFrom:     lf.ReadFrom,
+			}
 			// Use per-file service name if set, otherwise use global service name
-			if lf.ServiceName != "" {
-				serviceNames[lf.Path] = lf.ServiceName
-			} else {
-				serviceNames[lf.Path] = cfg.ServiceName
+			if source.ServiceName == "" {
+				source.ServiceName = cfg.ServiceName
 			}
+			sources = append(sources, source)
 		}
 	}
+	return sources, nil
+}
 
-	if len(enabledLogFiles) == 0 {
-		logger.Fatal("No enabled log files configured")
+// run starts all inputs and blocks until the context is cancelled. Changes
+// to log_files and metadata in the file at configPath are applied on
+// SIGHUP and every reload_interval. With backfill, files without saved
+// state ship their existing content and rotated files.
+func run(ctx context.Context, cfg *config.TailerConfig, configPath string, backfill bool, logger *zap.Logger) error {
+	vault, _, err := cfg.Secrets.NewClients()
+	if err != nil {
+		return fmt.Errorf("failed to configure secrets: %w", err)
+	}
+	clientCert, vaultCAs, err := loadClientCertificate(ctx, cfg, vault, logger)
+	if err != nil {
+		return err
+	}
+	httpClient, err := newClient(cfg, clientCert, vaultCAs, logger)
+	if err != nil {
+		return err
+	}
+	batcher, labeler, err := newBatcher(cfg, httpClient, logger)
+	if err != nil {
+		return err
+	}
+
+	// Get enabled log files
+	sources, err := fileSources(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Get enabled event log channels
+	var eventLogs []*tailer.EventLogReader
+	for _, el := range cfg.EventLogs {
+		if el.Enabled {
+			serviceName := el.ServiceName
+			if serviceName == "" {
+				serviceName = cfg.ServiceName
+			}
+			eventLogs = append(eventLogs, tailer.NewEventLogReader(
+				el.Channel,
+				el.Query,
+				serviceName,
+				cfg.Hostname,
+				logger,
+				batcher.GetLineChan(),
+			))
+		}
+	}
+
+	// Get enabled socket listeners
+	var listeners []*tailer.SocketListener
+	for _, lc := range cfg.Listeners {
+		if lc.Enabled {
+			serviceName := lc.ServiceName
+			if serviceName == "" {
+				serviceName = cfg.ServiceName
+			}
+			listeners = append(listeners, tailer.NewSocketListener(
+				lc.Network,
+				lc.Address,
+				serviceName,
+				cfg.Hostname,
+				logger,
+				batcher.GetLineChan(),
+			))
+		}
+	}
+
+	// Get enabled synthetic generators
+	var generators []*tailer.Generator
+	for _, gc := range cfg.Generators {
+		if gc.Enabled {
+			serviceName := gc.ServiceName
+			if serviceName == "" {
+				serviceName = cfg.ServiceName
+			}
+			generators = append(generators, tailer.NewGenerator(
+				gc.Format,
+				gc.Rate,
+				gc.Count,
+				serviceName,
+				cfg.Hostname,
+				logger,
+				batcher.GetLineChan(),
+			))
+		}
+	}
+
+	// Get enabled CloudWatch Logs log groups, sharing one credential cache
+	var cloudWatch []*tailer.CloudWatchReader
+	var awsCredentials *awsauth.Credentials
+	for _, cw := range cfg.CloudWatch {
+		if cw.Enabled {
+			serviceName := cw.ServiceName
+			if serviceName == "" {
+				serviceName = cfg.ServiceName
+			}
+			if awsCredentials == nil {
+				awsCredentials = awsauth.NewCredentials()
+			}
+			cloudWatch = append(cloudWatch, tailer.NewCloudWatchReader(
+				cw.LogGroup,
+				cw.StreamPrefix,
+				cw.FilterPattern,
+				cw.Region,
+				cw.Endpoint,
+				cw.PollInterval,
+				cw.Overlap,
+				cw.Lookback,
+				serviceName,
+				cfg.Hostname,
+				tailer.CloudWatchStateFile(cfg.StateFile, cw.LogGroup),
+				awsCredentials,
+				logger,
+				batcher.GetLineChan(),
+			))
+		}
+	}
+
+	// Get enabled SNMP trap receivers
+	var snmpTraps []*tailer.SNMPTrapReceiver
+	for _, st := range cfg.SNMPTraps {
+		if st.Enabled {
+			serviceName := st.ServiceName
+			if serviceName == "" {
+				serviceName = cfg.ServiceName
+			}
+			mib, err := tailer.LoadMIBs(st.MIBs)
+			if err != nil {
+				return fmt.Errorf("snmp_traps %s: %w", st.Address, err)
+			}
+			users := make([]tailer.SNMPUser, 0, len(st.Users))
+			for _, u := range st.Users {
+				users = append(users, tailer.SNMPUser{
+					Username:       u.Username,
+					AuthProtocol:   u.AuthProtocol,
+					AuthPassphrase: u.AuthPassphrase,
+					PrivProtocol:   u.PrivProtocol,
+					PrivPassphrase: u.PrivPassphrase,
+				})
+			}
+			receiver, err := tailer.NewSNMPTrapReceiver(
+				st.Address,
+				st.Communities,
+				users,
+				mib,
+				serviceName,
+				cfg.Hostname,
+				logger,
+				batcher.GetLineChan(),
+			)
+			if err != nil {
+				return fmt.Errorf("snmp_traps %s: %w", st.Address, err)
+			}
+			snmpTraps = append(snmpTraps, receiver)
+		}
+	}
+
+	// Host events always ship under the reserved host-events service
+	var hostEvents *tailer.HostEventsReader
+	if cfg.HostEvents.Enabled {
+		hostEvents = tailer.NewHostEventsReader(
+			cfg.HostEvents.CoredumpDir,
+			cfg.HostEvents.PollInterval,
+			config.HostEventsService,
+			cfg.Hostname,
+			tailer.HostEventsStateFile(cfg.StateFile),
+			logger,
+			batcher.GetLineChan(),
+		)
+	}
+
+	if len(sources) == 0 && len(eventLogs) == 0 && len(listeners) == 0 && len(generators) == 0 && len(cloudWatch) == 0 && len(snmpTraps) == 0 && hostEvents == nil {
+		return fmt.Errorf("no enabled log files, event logs, listeners, generators, CloudWatch log groups, SNMP trap receivers, or host events configured")
 	}
 
 	// Create watcher
 	watcher := tailer.NewWatcher(
-		serviceNames,
+		sources,
 		cfg.Hostname,
-		enabledLogFiles,
+		cfg.RescanInterval,
 		cfg.StateFile,
 		logger,
 		batcher.GetLineChan(),
 	)
+	watcher.SetBackpressure(cfg.Backpressure.Policy, cfg.Backpressure.Timeout, cfg.Backpressure.QueueSize)
+	watcher.SetBackfill(backfill)
+	watcher.SetTailing(cfg.Tailing.Mode, cfg.Tailing.PollInterval, cfg.Tailing.Reopen)
+
+	// Pace file reads when a line rate, CPU, or memory limit is set
+	if r := cfg.Resources; r.MaxLinesPerSecond > 0 || r.MaxCPUPercent > 0 || r.MaxMemoryMB > 0 {
+		throttle := tailer.NewThrottle(r, logger)
+		watcher.SetThrottle(throttle)
+		go throttle.Start(ctx)
+	}
+
+	// Apply log_files and metadata changes without a restart
+	go newReloader(configPath, cfg, watcher, labeler, logger).Start(ctx)
+
+	// Pick up rotated client certificates without a restart, or renew one
+	// issued by Vault before it expires
+	if cfg.MTLS.VaultPKI.Role != "" {
+		go vault.RenewCertificate(ctx, cfg.MTLS.VaultPKI.Request(), clientCert, func(leaf *x509.Certificate, err error) {
+			if err != nil {
+				logger.Error("Failed to renew client certificate from Vault, keeping the current one", zap.Error(err))
+				return
+			}
+			logger.Info("Renewed client certificate from Vault",
+				zap.String("subject", leaf.Subject.String()),
+				zap.Time("not_after", leaf.NotAfter))
+		})
+	} else {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+		go clientCert.Watch(ctx, cfg.MTLS.ReloadInterval, hup, func(leaf *x509.Certificate, err error) {
+			if err != nil {
+				logger.Error("Failed to reload client certificate, keeping the current one", zap.Error(err))
+				return
+			}
+			logger.Info("Reloaded client certificate",
+				zap.String("subject", leaf.Subject.String()),
+				zap.Time("not_after", leaf.NotAfter))
+		})
+	}
+
+	// Serve the local control API for pausing and resuming files
+	if cfg.Control.Enabled {
+		control := tailer.NewControlServer(cfg.Control.Address, watcher, httpClient, batcher.GetDeadLetter(), logger)
+		go func() {
+			if err := control.Start(ctx); err != nil {
+				logger.Error("Control API failed", zap.Error(err))
+			}
+		}()
+	}
 
 	// Start batcher in background
+	batcherDone := make(chan struct{})
 	go func() {
+		defer close(batcherDone)
 		if err := batcher.Start(ctx); err != nil && err != context.Canceled {
 			logger.Error("Batcher failed", zap.Error(err))
 		}
 	}()
 
+	// Start event log subscriptions in background
+	for _, reader := range eventLogs {
+		go func(reader *tailer.EventLogReader) {
+			if err := reader.Start(ctx); err != nil && err != context.Canceled {
+				logger.Error("Event log reader failed", zap.Error(err))
+			}
+		}(reader)
+	}
+
+	// Start socket listeners in background
+	for _, listener := range listeners {
+		go func(listener *tailer.SocketListener) {
+			if err := listener.Start(ctx); err != nil && err != context.Canceled {
+				logger.Error("Socket listener failed", zap.Error(err))
+			}
+		}(listener)
+	}
+
+	// Start generators in background
+	for _, generator := range generators {
+		go func(generator *tailer.Generator) {
+			if err := generator.Start(ctx); err != nil && err != context.Canceled {
+				logger.Error("Generator failed", zap.Error(err))
+			}
+		}(generator)
+	}
+
+	// Start CloudWatch Logs readers in background
+	for _, reader := range cloudWatch {
+		go func(reader *tailer.CloudWatchReader) {
+			if err := reader.Start(ctx); err != nil && err != context.Canceled {
+				logger.Error("CloudWatch reader failed", zap.Error(err))
+			}
+		}(reader)
+	}
+
+	// Start SNMP trap receivers in background
+	for _, receiver := range snmpTraps {
+		go func(receiver *tailer.SNMPTrapReceiver) {
+			if err := receiver.Start(ctx); err != nil && err != context.Canceled {
+				logger.Error("SNMP trap receiver failed", zap.Error(err))
+			}
+		}(receiver)
+	}
+
+	// Start host events reader in background
+	if hostEvents != nil {
+		go func() {
+			if err := hostEvents.Start(ctx); err != nil && err != context.Canceled {
+				logger.Error("Host events reader failed", zap.Error(err))
+			}
+		}()
+	}
+
 	// Start watcher (blocks until context is cancelled)
 	if err := watcher.Start(ctx); err != nil && err != context.Canceled {
-		logger.Error("Watcher failed", zap.Error(err))
-		os.Exit(1)
+		return fmt.Errorf("watcher failed: %w", err)
 	}
 
-	logger.Info("Tailer stopped gracefully")
+	// Wait for the batcher's final flush
+	<-batcherDone
+	return nil
 }
 
 // initLogger creates a configured zap logger
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/internal/tailer"
+	"go.uber.org/zap"
+)
+
+// reloader applies changes to log_files and metadata from the config file
+// without restarting the tailer, so files already being tailed carry on
+// from where they are
+type reloader struct {
+	configPath string
+	running    config.TailerConfig // The configuration in effect
+	watcher    *tailer.Watcher
+	labeler    *tailer.LabelProcessor
+	logger     *zap.Logger
+
+	modTime time.Time
+	size    int64
+}
+
+// newReloader creates a new config reloader
+func newReloader(configPath string, cfg *config.TailerConfig, watcher *tailer.Watcher, labeler *tailer.LabelProcessor, logger *zap.Logger) *reloader {
+	r := &reloader{
+		configPath: configPath,
+		running:    *cfg,
+		watcher:    watcher,
+		labeler:    labeler,
+		logger:     logger,
+	}
+	r.changed()
+	return r
+}
+
+// Start reloads the configuration on SIGHUP and, with reload_interval set,
+// whenever the config file changes, until the context is cancelled
+func (r *reloader) Start(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var poll <-chan time.Time
+	if r.running.ReloadInterval > 0 {
+		ticker := time.NewTicker(r.running.ReloadInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	for {
+		select {
+		case <-hup:
+			r.changed()
+			r.reload()
+		case <-poll:
+			if r.changed() {
+				r.reload()
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// changed reports whether the config file's modification time or size
+// changed since it was last checked
+func (r *reloader) changed() bool {
+	info, err := os.Stat(r.configPath)
+	if err != nil {
+		return false
+	}
+	if info.ModTime().Equal(r.modTime) && info.Size() == r.size {
+		return false
+	}
+	r.modTime, r.size = info.ModTime(), info.Size()
+	return true
+}
+
+// reload loads the config file and applies its log_files and metadata. An
+// invalid file is logged and the running configuration kept.
+func (r *reloader) reload() {
+	cfg, err := config.LoadTailerConfig(r.configPath)
+	if err != nil {
+		r.logger.Error("Failed to reload config, keeping the running configuration", zap.Error(err))
+		return
+	}
+	sources, err := fileSources(cfg)
+	if err != nil {
+		r.logger.Error("Failed to reload config, keeping the running configuration", zap.Error(err))
+		return
+	}
+	labels, err := metadataLabels(cfg)
+	if err != nil {
+		r.logger.Error("Failed to reload config, keeping the running configuration", zap.Error(err))
+		return
+	}
+
+	r.watcher.SetSources(sources)
+	r.labeler.SetLabels(labels)
+	r.logger.Info("Reloaded configuration",
+		zap.Int("log_files", len(sources)),
+		zap.Any("labels", labels))
+
+	if needsRestart(r.running, *cfg) {
+		r.logger.Warn("Config changes outside log_files and metadata take effect after a restart")
+	}
+	r.running.LogFiles = cfg.LogFiles
+	r.running.Metadata = cfg.Metadata
+}
+
+// needsRestart reports whether two configurations differ outside log_files
+// and metadata
+func needsRestart(running, loaded config.TailerConfig) bool {
+	running.LogFiles, loaded.LogFiles = nil, nil
+	running.Metadata, loaded.Metadata = config.MetadataConfig{}, config.MetadataConfig{}
+	return !reflect.DeepEqual(running, loaded)
+}
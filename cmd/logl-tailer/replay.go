@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/internal/tailer"
+	"go.uber.org/zap"
+)
+
+// runReplay implements "logl-tailer replay": resend the batches in the
+// dead-letter file to the configured servers
+func runReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	configPath := fs.String("config", "/etc/logl/tailer.yaml", "Path to configuration file")
+	file := fs.String("file", "", "Dead-letter file to replay (defaults to dead_letter.path)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: logl-tailer replay [--config path] [--file path]\n\nResend batches kept in the dead-letter file. Batches that fail again are\nwritten back for the next replay.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	cfg, err := config.LoadTailerConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if *file == "" {
+		*file = cfg.DeadLetter.Path
+	}
+	deadLetter := tailer.NewDeadLetter(*file, cfg.DeadLetter.MaxBytes)
+	if deadLetter == nil {
+		return fmt.Errorf("dead_letter.path is not set; pass --file")
+	}
+	deadLetter.SetLimits(cfg.DeadLetter.MaxDiskPercent, cfg.DeadLetter.Overflow)
+
+	logger, err := initLogger(cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	defer logger.Sync()
+
+	// Stop sending on a signal; unsent batches are written back
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	vault, _, err := cfg.Secrets.NewClients()
+	if err != nil {
+		return fmt.Errorf("failed to configure secrets: %w", err)
+	}
+	clientCert, vaultCAs, err := loadClientCertificate(ctx, cfg, vault, logger)
+	if err != nil {
+		return err
+	}
+	client, err := newClient(cfg, clientCert, vaultCAs, logger)
+	if err != nil {
+		return err
+	}
+
+	result, err := deadLetter.Replay(ctx, client, logger)
+	logger.Info("Replayed dead-letter file",
+		zap.String("file", *file),
+		zap.Int("sent", result.Sent),
+		zap.Int("failed", result.Failed),
+		zap.Int("malformed", result.Malformed))
+	if err != nil {
+		return err
+	}
+	if result.Failed > 0 || result.Malformed > 0 {
+		return fmt.Errorf("%d batches were not delivered and remain in %s", result.Failed+result.Malformed, *file)
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/internal/tailer"
+	"github.com/oicur0t/logl/pkg/mtls"
+	"github.com/oicur0t/logl/pkg/selftest"
+)
+
+// certExpiryWarningDays flags certificates close to expiry in the self-test
+const certExpiryWarningDays = 30
+
+// runSelfTest checks that the configuration can work on this host and
+// prints a pass/fail report, returning false if any check failed
+func runSelfTest(cfg *config.TailerConfig) bool {
+	report := &selftest.Report{}
+	passphrase := mtls.PassphraseFrom(cfg.MTLS.KeyPassphraseFile, cfg.MTLS.KeyPassphraseEnv)
+
+	checkLogFiles(report, cfg.LogFiles)
+	var tlsConfig *tls.Config
+	if cfg.MTLS.VaultPKI.Role != "" {
+		tlsConfig = checkVaultCertificate(report, cfg)
+	} else {
+		tlsConfig = checkCertificates(report, cfg.MTLS, passphrase)
+	}
+	checkServers(report, cfg, tlsConfig)
+	checkWritable(report, "state file "+cfg.StateFile, cfg.StateFile)
+	if cfg.DeadLetter.Path != "" {
+		checkWritable(report, "dead-letter file "+cfg.DeadLetter.Path, cfg.DeadLetter.Path)
+	}
+
+	report.Print(os.Stdout)
+	return !report.Failed()
+}
+
+// checkLogFiles verifies every configured path can be opened for reading
+func checkLogFiles(report *selftest.Report, logFiles []config.LogFileConfig) {
+	for _, lf := range logFiles {
+		if !lf.Enabled {
+			continue
+		}
+		check := "log file " + lf.Path
+
+		paths, err := tailer.ExpandPattern(lf.Path)
+		if err != nil {
+			report.Fail(check, "%v", err)
+			continue
+		}
+		if len(paths) == 0 {
+			report.Warn(check, "pattern matches no files yet")
+			continue
+		}
+
+		for _, path := range paths {
+			f, err := os.Open(path)
+			switch {
+			case os.IsNotExist(err):
+				report.Warn("log file "+path, "does not exist yet; it will be tailed once created")
+			case err != nil:
+				report.Fail("log file "+path, "not readable: %v", err)
+			default:
+				f.Close()
+				report.Pass("log file "+path, "readable")
+			}
+		}
+	}
+}
+
+// checkCertificates verifies the mTLS material loads, chains to the CA,
+// and is within its validity period, returning its TLS config if it loads
+func checkCertificates(report *selftest.Report, cfg config.MTLSConfig, passphrase mtls.Passphrase) *tls.Config {
+	tlsConfig, err := mtls.LoadClientTLSConfig(cfg.CACert, cfg.ClientCert, cfg.ClientKey, cfg.ServerName, passphrase)
+	if err != nil {
+		report.Fail("mTLS material", "%v", err)
+		return nil
+	}
+	report.Pass("mTLS material", "CA, client certificate, and key load")
+
+	if err := mtls.VerifyCertificateFile(cfg.ClientCert, cfg.CACert, x509.ExtKeyUsageClientAuth); err != nil {
+		report.Fail("client certificate chain", "%v", err)
+	} else {
+		report.Pass("client certificate chain", "verifies against the CA for client auth")
+	}
+
+	for _, path := range []string{cfg.CACert, cfg.ClientCert} {
+		certs, err := mtls.ParseCertificateFile(path)
+		if err != nil {
+			report.Fail("certificate "+path, "%v", err)
+			continue
+		}
+		report.CheckExpiry(mtls.Describe(path, certs[0]), certExpiryWarningDays)
+	}
+	return tlsConfig
+}
+
+// checkVaultCertificate logs in to Vault and issues a client certificate
+// from the PKI role, returning its TLS config if it is issued
+func checkVaultCertificate(report *selftest.Report, cfg *config.TailerConfig) *tls.Config {
+	vault, _, err := cfg.Secrets.NewClients()
+	if err != nil {
+		report.Fail("vault certificate", "%v", err)
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Secrets.Timeout)
+	defer cancel()
+
+	issued, err := vault.IssueCertificate(ctx, cfg.MTLS.VaultPKI.Request())
+	if err != nil {
+		report.Fail("vault certificate", "%v; check secrets.vault, mtls.vault_pki, and the token's policy", err)
+		return nil
+	}
+	report.Pass("vault certificate", "issued %s, valid until %s", issued.Leaf.Subject, issued.Leaf.NotAfter.Format(time.RFC3339))
+
+	pair, err := mtls.NewKeyPair(issued.Certificate)
+	if err != nil {
+		report.Fail("vault certificate", "%v", err)
+		return nil
+	}
+	if cfg.MTLS.CACert == "" {
+		return mtls.ClientTLSConfigWithCAs(issued.CAs, pair, cfg.MTLS.ServerName)
+	}
+	tlsConfig, err := mtls.ClientTLSConfig(cfg.MTLS.CACert, pair, cfg.MTLS.ServerName)
+	if err != nil {
+		report.Fail("mTLS material", "%v", err)
+		return nil
+	}
+	return tlsConfig
+}
+
+// checkServers calls each server's health endpoint over the configured
+// proxy, dialer, and mTLS
+func checkServers(report *selftest.Report, cfg *config.TailerConfig, tlsConfig *tls.Config) {
+	if tlsConfig == nil {
+		report.Fail("server reachability", "skipped, mTLS material does not load")
+		return
+	}
+	proxy, err := newProxyFunc(cfg.Server.Proxy)
+	if err != nil {
+		report.Fail("server reachability", "invalid proxy: %v", err)
+		return
+	}
+	dial, err := tailer.NewDialFunc(cfg.Server.IPFamily, cfg.Server.FallbackDelay, cfg.Server.Timeout)
+	if err != nil {
+		report.Fail("server reachability", "invalid dialer: %v", err)
+		return
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:           proxy,
+			DialContext:     dial,
+			TLSClientConfig: tlsConfig,
+		},
+		Timeout: cfg.Server.Timeout,
+	}
+
+	for _, serverURL := range cfg.Server.ServerURLs() {
+		check := "server " + serverURL
+		healthURL, err := tailer.HealthURL(serverURL)
+		if err != nil {
+			report.Fail(check, "%v", err)
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.Timeout)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, healthURL, nil)
+		if err != nil {
+			cancel()
+			report.Fail(check, "%v", err)
+			continue
+		}
+
+		start := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			cancel()
+			report.Fail(check, "unreachable: %v", err)
+			continue
+		}
+		var health struct {
+			Region string `json:"region"`
+		}
+		json.NewDecoder(resp.Body).Decode(&health)
+		resp.Body.Close()
+		cancel()
+		elapsed := time.Since(start).Round(time.Millisecond)
+
+		switch {
+		case resp.StatusCode != http.StatusOK:
+			report.Fail(check, "health check returned %d", resp.StatusCode)
+		case cfg.Server.PinRegion && health.Region != cfg.Region:
+			report.Warn(check, "healthy, but not in region %s, so never used (%s)", cfg.Region, elapsed)
+		case health.Region != "":
+			report.Pass(check, "healthy, region %s (%s)", health.Region, elapsed)
+		default:
+			report.Pass(check, "healthy (%s)", elapsed)
+		}
+	}
+}
+
+// checkWritable verifies a file the tailer writes, such as the state file,
+// can be written
+func checkWritable(report *selftest.Report, check, path string) {
+	if _, err := os.Stat(path); err == nil {
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			report.Fail(check, "not writable: %v", err)
+			return
+		}
+		f.Close()
+		report.Pass(check, "writable")
+		return
+	}
+
+	// Not created yet: the directory must allow creating it
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, ".logl-selftest-*")
+	if err != nil {
+		report.Fail(check, "cannot create files in %s: %v", dir, err)
+		return
+	}
+	f.Close()
+	os.Remove(f.Name())
+	report.Pass(check, "will be created in %s", dir)
+}
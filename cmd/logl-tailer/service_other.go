@@ -0,0 +1,20 @@
+//go:build !windows
+
+package main
+
+import "fmt"
+
+// isWindowsService reports whether the process was started by the Windows service manager
+func isWindowsService() bool {
+	return false
+}
+
+// runService is only available on Windows
+func runService(configPath string) error {
+	return fmt.Errorf("running as a service is only supported on Windows")
+}
+
+// controlService is only available on Windows
+func controlService(command, configPath string) error {
+	return fmt.Errorf("service management is only supported on Windows")
+}
@@ -0,0 +1,153 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const serviceName = "logl-tailer"
+
+// isWindowsService reports whether the process was started by the Windows service manager
+func isWindowsService() bool {
+	ok, err := svc.IsWindowsService()
+	return err == nil && ok
+}
+
+// runService runs the tailer under the Windows service manager
+func runService(configPath string) error {
+	return svc.Run(serviceName, &tailerService{configPath: configPath})
+}
+
+// tailerService implements svc.Handler
+type tailerService struct {
+	configPath string
+}
+
+// Execute runs the tailer until the service manager asks it to stop
+func (s *tailerService) Execute(args []string, requests <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+
+	cfg, logger, err := setup(s.configPath)
+	if err != nil {
+		return true, 1
+	}
+	defer logger.Sync()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- run(ctx, cfg, s.configPath, false, logger)
+	}()
+
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				changes <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				logger.Info("Service stop requested, shutting down")
+				changes <- svc.Status{State: svc.StopPending}
+				cancel()
+
+				// Give the final flush its drain timeout
+				select {
+				case <-done:
+					logger.Info("Tailer stopped gracefully")
+				case <-time.After(cfg.Batching.DrainTimeout + shutdownGrace):
+					logger.Error("Forced shutdown after timeout")
+				}
+				return false, 0
+			}
+
+		case err := <-done:
+			if err != nil {
+				logger.Error("Tailer failed", zap.Error(err))
+				return true, 1
+			}
+			return false, 0
+		}
+	}
+}
+
+// controlService installs or uninstalls the Windows service
+func controlService(command, configPath string) error {
+	switch command {
+	case "install":
+		return installService(configPath)
+	case "uninstall":
+		return removeService()
+	default:
+		return fmt.Errorf("unknown service command %q (use install or uninstall)", command)
+	}
+}
+
+// installService registers the current executable as an auto-start service
+func installService(configPath string) error {
+	exePath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate executable: %w", err)
+	}
+
+	absConfig, err := filepath.Abs(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve config path: %w", err)
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(serviceName); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s already exists", serviceName)
+	}
+
+	s, err := m.CreateService(serviceName, exePath, mgr.Config{
+		DisplayName: "logl tailer",
+		Description: "Ships log files and Windows Event Log entries to logl-server",
+		StartType:   mgr.StartAutomatic,
+	}, "-config", absConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create service: %w", err)
+	}
+	defer s.Close()
+
+	return nil
+}
+
+// removeService deletes the Windows service
+func removeService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed: %w", serviceName, err)
+	}
+	defer s.Close()
+
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("failed to delete service: %w", err)
+	}
+
+	return nil
+}
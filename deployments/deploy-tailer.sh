@@ -88,7 +88,7 @@ mkdir -p "$CONFIG_DIR"
 
 cat > "$CONFIG_DIR/tailer.yaml" <<EOF
 service_name: "$SERVICE_NAME"
-hostname: "\${HOSTNAME}"
+hostname: "\${HOSTNAME:-}"
 
 log_files:
   - path: "/var/log/syslog"
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/spf13/viper"
+)
+
+// CLIConfig holds logl-cli settings. The CLI reads the tailer configuration
+// file, so it reuses the tailer's server URL and mTLS client certificate.
+type CLIConfig struct {
+	Server UpstreamServerConfig `mapstructure:"server"`
+	MTLS   MTLSConfig           `mapstructure:"mtls"`
+}
+
+// LoadCLIConfig loads the server URL and mTLS settings from a tailer
+// configuration file, ignoring its inputs
+func LoadCLIConfig(configPath string) (*CLIConfig, error) {
+	v := viper.New()
+	v.AutomaticEnv()
+
+	if err := readConfig(v, configPath); err != nil {
+		return nil, err
+	}
+
+	var config CLIConfig
+	if err := v.Unmarshal(&config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+	return &config, nil
+}
+
+// BaseURL returns the scheme and host of the first configured server, since
+// tailer server URLs point at the ingest endpoint
+func (c *CLIConfig) BaseURL() (string, error) {
+	urls := c.Server.ServerURLs()
+	if len(urls) == 0 {
+		return "", fmt.Errorf("server.url is not configured")
+	}
+	u, err := url.Parse(urls[0])
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid server.url %q", urls[0])
+	}
+	return u.Scheme + "://" + u.Host, nil
+}
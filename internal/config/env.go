@@ -0,0 +1,129 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// errEnvUnset is returned for a reference to a variable that isn't set
+var errEnvUnset = errors.New("not set")
+
+// envReference matches ${VAR} and ${VAR:-default} in config values; $${
+// is a literal ${
+var envReference = regexp.MustCompile(`\$?\$\{([^}]*)\}`)
+
+// readConfig reads the config file into v, expanding environment variable
+// references in its string values
+func readConfig(v *viper.Viper, configPath string) error {
+	raw := viper.New()
+	raw.SetConfigFile(configPath)
+	if err := raw.ReadInConfig(); err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	settings, err := expandEnv(raw.AllSettings(), "")
+	if err != nil {
+		return err
+	}
+	return v.MergeConfigMap(settings.(map[string]interface{}))
+}
+
+// expandEnv replaces ${VAR} in every string within a config value. VAR is
+// read from the environment or, when unset, from the file named by
+// VAR_FILE, as with Docker and Kubernetes secrets. ${VAR:-default} falls
+// back to default when neither is set.
+func expandEnv(value interface{}, key string) (interface{}, error) {
+	switch value := value.(type) {
+	case string:
+		return expandString(value, key)
+	case map[string]interface{}:
+		for k, item := range value {
+			expanded, err := expandEnv(item, joinKey(key, k))
+			if err != nil {
+				return nil, err
+			}
+			value[k] = expanded
+		}
+	case map[interface{}]interface{}:
+		for k, item := range value {
+			expanded, err := expandEnv(item, joinKey(key, fmt.Sprint(k)))
+			if err != nil {
+				return nil, err
+			}
+			value[k] = expanded
+		}
+	case []interface{}:
+		for i, item := range value {
+			expanded, err := expandEnv(item, key+"["+strconv.Itoa(i)+"]")
+			if err != nil {
+				return nil, err
+			}
+			value[i] = expanded
+		}
+	}
+	return value, nil
+}
+
+// expandString expands the references in one string
+func expandString(s, key string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+
+	var err error
+	expanded := envReference.ReplaceAllStringFunc(s, func(ref string) string {
+		if strings.HasPrefix(ref, "$$") {
+			return ref[1:]
+		}
+		name, fallback, hasFallback := strings.Cut(ref[2:len(ref)-1], ":-")
+		value, lookupErr := lookupEnv(name)
+		if errors.Is(lookupErr, errEnvUnset) && hasFallback {
+			return fallback
+		}
+		if lookupErr != nil && err == nil {
+			err = fmt.Errorf("%s: %w", key, lookupErr)
+		}
+		return value
+	})
+	if err != nil {
+		return "", err
+	}
+	return expanded, nil
+}
+
+// lookupEnv returns a variable's value, or the contents of the file named
+// by its _FILE variable without trailing newlines
+func lookupEnv(name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("empty ${} reference")
+	}
+	value, set := os.LookupEnv(name)
+	path, fileSet := os.LookupEnv(name + "_FILE")
+	switch {
+	case set && fileSet:
+		return "", fmt.Errorf("both %s and %s_FILE are set", name, name)
+	case set:
+		return value, nil
+	case fileSet:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s_FILE: %w", name, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	return "", fmt.Errorf("${%s} is %w, nor is %s_FILE", name, errEnvUnset, name)
+}
+
+// joinKey appends a map key to a dotted config key
+func joinKey(key, k string) string {
+	if key == "" {
+		return k
+	}
+	return key + "." + k
+}
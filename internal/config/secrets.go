@@ -0,0 +1,137 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/oicur0t/logl/pkg/secrets"
+	"github.com/spf13/viper"
+)
+
+// SecretsConfig holds the secret managers that certificates and secret
+// references such as mongodb.uri: "vault:secret/data/logl#mongodb_uri"
+// are fetched from
+type SecretsConfig struct {
+	Vault   VaultConfig      `mapstructure:"vault"`
+	AWS     AWSSecretsConfig `mapstructure:"aws"`
+	Timeout time.Duration    `mapstructure:"timeout"` // Per request
+}
+
+// VaultConfig holds HashiCorp Vault connection and login settings
+type VaultConfig struct {
+	Address      string `mapstructure:"address"`        // Enables Vault
+	Namespace    string `mapstructure:"namespace"`      // Vault Enterprise namespace
+	AuthMethod   string `mapstructure:"auth_method"`    // token, approle, or kubernetes
+	AuthMount    string `mapstructure:"auth_mount"`     // Defaults to the method's name
+	TokenFile    string `mapstructure:"token_file"`     // token: defaults to $VAULT_TOKEN
+	RoleID       string `mapstructure:"role_id"`        // approle
+	SecretIDFile string `mapstructure:"secret_id_file"` // approle
+	Role         string `mapstructure:"role"`           // kubernetes
+	JWTFile      string `mapstructure:"jwt_file"`       // kubernetes: defaults to the pod's service account token
+	CACert       string `mapstructure:"ca_cert"`        // Verifies Vault instead of the system roots
+}
+
+// AWSSecretsConfig holds AWS Secrets Manager settings
+type AWSSecretsConfig struct {
+	Region   string `mapstructure:"region"`   // Enables Secrets Manager
+	Endpoint string `mapstructure:"endpoint"` // Defaults to the region's
+}
+
+// VaultPKIConfig issues the mTLS certificate from a Vault PKI role instead
+// of reading it from files. It is renewed after two thirds of its
+// lifetime.
+type VaultPKIConfig struct {
+	Mount      string        `mapstructure:"mount"` // Where the PKI secrets engine is mounted
+	Role       string        `mapstructure:"role"`  // Enables issuing
+	CommonName string        `mapstructure:"common_name"`
+	AltNames   []string      `mapstructure:"alt_names"`
+	IPSANs     []string      `mapstructure:"ip_sans"`
+	TTL        time.Duration `mapstructure:"ttl"` // 0 uses the role's default
+}
+
+// setSecretsDefaults sets the defaults shared by the tailer and server
+func setSecretsDefaults(v *viper.Viper) {
+	v.SetDefault("secrets.timeout", "10s")
+	v.SetDefault("secrets.vault.auth_method", "token")
+	v.SetDefault("mtls.vault_pki.mount", "pki")
+}
+
+// validateSecrets checks the secret managers' settings and that a Vault
+// PKI certificate has Vault to come from
+func validateSecrets(s *SecretsConfig, pki *VaultPKIConfig) error {
+	if s.Timeout <= 0 {
+		return fmt.Errorf("secrets.timeout must be positive")
+	}
+	if s.Vault.Address != "" {
+		switch s.Vault.AuthMethod {
+		case "token":
+		case "approle":
+			if s.Vault.RoleID == "" || s.Vault.SecretIDFile == "" {
+				return fmt.Errorf("secrets.vault auth_method approle requires role_id and secret_id_file")
+			}
+		case "kubernetes":
+			if s.Vault.Role == "" {
+				return fmt.Errorf("secrets.vault auth_method kubernetes requires role")
+			}
+		default:
+			return fmt.Errorf("secrets.vault.auth_method must be token, approle, or kubernetes")
+		}
+	}
+
+	if pki.Role == "" {
+		return nil
+	}
+	if s.Vault.Address == "" {
+		return fmt.Errorf("mtls.vault_pki requires secrets.vault.address")
+	}
+	if pki.Mount == "" || pki.CommonName == "" {
+		return fmt.Errorf("mtls.vault_pki requires mount and common_name")
+	}
+	if pki.TTL < 0 {
+		return fmt.Errorf("mtls.vault_pki.ttl must not be negative")
+	}
+	return nil
+}
+
+// NewClients creates the configured secret manager clients and a resolver
+// for secret references. The Vault client is nil when Vault isn't
+// configured.
+func (s SecretsConfig) NewClients() (*secrets.Vault, *secrets.Resolver, error) {
+	var vault *secrets.Vault
+	if s.Vault.Address != "" {
+		var err error
+		vault, err = secrets.NewVault(secrets.VaultOptions{
+			Address:      s.Vault.Address,
+			Namespace:    s.Vault.Namespace,
+			AuthMethod:   s.Vault.AuthMethod,
+			AuthMount:    s.Vault.AuthMount,
+			TokenFile:    s.Vault.TokenFile,
+			RoleID:       s.Vault.RoleID,
+			SecretIDFile: s.Vault.SecretIDFile,
+			Role:         s.Vault.Role,
+			JWTFile:      s.Vault.JWTFile,
+			CACert:       s.Vault.CACert,
+			Timeout:      s.Timeout,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	var aws *secrets.AWSSecretsManager
+	if s.AWS.Region != "" {
+		aws = secrets.NewAWSSecretsManager(s.AWS.Region, s.AWS.Endpoint, s.Timeout)
+	}
+	return vault, secrets.NewResolver(vault, aws), nil
+}
+
+// Request returns the certificate request for the PKI role
+func (p VaultPKIConfig) Request() secrets.PKIRequest {
+	return secrets.PKIRequest{
+		Mount:      p.Mount,
+		Role:       p.Role,
+		CommonName: p.CommonName,
+		AltNames:   p.AltNames,
+		IPSANs:     p.IPSANs,
+		TTL:        p.TTL,
+	}
+}
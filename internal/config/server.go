@@ -2,66 +2,692 @@ package config
 
 import (
 	"fmt"
+	"math"
+	"path"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
 )
 
+// ListenBindConfig is a single address the HTTP server listens on
+type ListenBindConfig struct {
+	Network string `mapstructure:"network"` // tcp (dual-stack), tcp4, or tcp6 (IPv6 only)
+	Address string `mapstructure:"address"`
+}
+
 // HTTPServerConfig holds HTTP server settings
 type HTTPServerConfig struct {
-	ListenAddress   string        `mapstructure:"listen_address"`
-	ReadTimeout     time.Duration `mapstructure:"read_timeout"`
-	WriteTimeout    time.Duration `mapstructure:"write_timeout"`
-	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+	ListenAddress   string             `mapstructure:"listen_address"`
+	Binds           []ListenBindConfig `mapstructure:"binds"` // Overrides listen_address when set
+	ReadTimeout     time.Duration      `mapstructure:"read_timeout"`
+	WriteTimeout    time.Duration      `mapstructure:"write_timeout"`
+	ShutdownTimeout time.Duration      `mapstructure:"shutdown_timeout"`
 }
 
 // MongoDBConfig holds MongoDB connection settings
 type MongoDBConfig struct {
-	URI                 string `mapstructure:"uri"`
-	Database            string `mapstructure:"database"`
-	CollectionPrefix    string `mapstructure:"collection_prefix"`
-	CertificateKeyFile  string `mapstructure:"certificate_key_file"`
-	Timeout             time.Duration `mapstructure:"timeout"`
-	MaxPoolSize         int    `mapstructure:"max_pool_size"`
-	TTLDays             int    `mapstructure:"ttl_days"`
+	URI                  string             `mapstructure:"uri"`
+	Database             string             `mapstructure:"database"`
+	CollectionPrefix     string             `mapstructure:"collection_prefix"`
+	CertificateKeyFile   string             `mapstructure:"certificate_key_file"`
+	Timeout              time.Duration      `mapstructure:"timeout"`
+	MaxPoolSize          int                `mapstructure:"max_pool_size"`
+	MinPoolSize          int                `mapstructure:"min_pool_size"`
+	TTLDays              int                `mapstructure:"ttl_days"`
+	LabelIndexes         []string           `mapstructure:"label_indexes"`         // Label keys indexed with timestamp, e.g. env
+	QuarantineCollection string             `mapstructure:"quarantine_collection"` // Documents rejected on insert (validation, size)
+	TimeSeries           TimeSeriesConfig   `mapstructure:"time_series"`
+	Partitioning         PartitioningConfig `mapstructure:"partitioning"`
+	Indexes              IndexesConfig      `mapstructure:"indexes"`
+}
+
+// IndexesConfig controls the indexes created on every log collection.
+// Indexes are built in the background when a collection is first seen,
+// and re-ensured at startup and every check_interval.
+type IndexesConfig struct {
+	Builtin       []string              `mapstructure:"builtin"`        // Built-in indexes to create, by name; empty creates all
+	LineText      bool                  `mapstructure:"line_text"`      // Text index on line for search queries
+	Custom        []IndexTemplateConfig `mapstructure:"custom"`         // Additional indexes, e.g. partial ones
+	CheckInterval time.Duration         `mapstructure:"check_interval"` // 0 only ensures indexes at startup
+	BuildTimeout  time.Duration         `mapstructure:"build_timeout"`  // Per collection
+}
+
+// PartitioningConfig controls writing each service's entries to
+// time-bucketed collections, e.g. logs_web_api_2024_06_01, which are
+// dropped whole once past retention
+type PartitioningConfig struct {
+	Interval      string        `mapstructure:"interval"`       // day or month; empty disables partitioning
+	CheckInterval time.Duration `mapstructure:"check_interval"` // How often expired partitions are dropped
+}
+
+// TimeSeriesConfig controls creating new log collections as MongoDB
+// time-series collections (MongoDB 6.0+)
+type TimeSeriesConfig struct {
+	Enabled     bool   `mapstructure:"enabled"`
+	MetaField   string `mapstructure:"meta_field"`  // hostname or labels
+	Granularity string `mapstructure:"granularity"` // seconds, minutes, or hours
 }
 
 // ServerMTLSConfig holds mTLS configuration for the server
 type ServerMTLSConfig struct {
-	Enabled    bool   `mapstructure:"enabled"`
-	CACert     string `mapstructure:"ca_cert"`
-	ServerCert string `mapstructure:"server_cert"`
-	ServerKey  string `mapstructure:"server_key"`
-	ClientAuth string `mapstructure:"client_auth"` // require, request, or none
+	Enabled           bool             `mapstructure:"enabled"`
+	CACert            string           `mapstructure:"ca_cert"`
+	ServerCert        string           `mapstructure:"server_cert"`
+	ServerKey         string           `mapstructure:"server_key"`
+	KeyPassphraseFile string           `mapstructure:"key_passphrase_file"` // Passphrase of an encrypted server_key
+	KeyPassphraseEnv  string           `mapstructure:"key_passphrase_env"`  // Environment variable holding it instead
+	ClientAuth        string           `mapstructure:"client_auth"`         // require, request, or none
+	ReloadInterval    time.Duration    `mapstructure:"reload_interval"`     // How often the server certificate is checked for rotation; 0 reloads on SIGHUP only
+	VaultPKI          VaultPKIConfig   `mapstructure:"vault_pki"`           // Issues the server certificate from Vault instead of server_cert and server_key
+	Revocation        RevocationConfig `mapstructure:"revocation"`
+}
+
+// RevocationConfig holds client certificate revocation checking settings
+type RevocationConfig struct {
+	Enabled         bool          `mapstructure:"enabled"`
+	CRLFile         string        `mapstructure:"crl_file"`
+	CRLURL          string        `mapstructure:"crl_url"`
+	OCSP            bool          `mapstructure:"ocsp"`             // Query the OCSP responder named in each certificate
+	OCSPURL         string        `mapstructure:"ocsp_url"`         // Responder used instead of the certificates' own
+	FailMode        string        `mapstructure:"fail_mode"`        // open or closed, when status can't be determined
+	CacheTTL        time.Duration `mapstructure:"cache_ttl"`        // How long OCSP answers are reused, at most until their next update
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"` // How often the CRL is reloaded
+	Timeout         time.Duration `mapstructure:"timeout"`
 }
 
 // RateLimitConfig holds rate limiting settings
 type RateLimitConfig struct {
-	Enabled            bool `mapstructure:"enabled"`
-	RequestsPerMinute  int  `mapstructure:"requests_per_minute"`
-	Burst              int  `mapstructure:"burst"`
+	Enabled           bool `mapstructure:"enabled"`
+	RequestsPerMinute int  `mapstructure:"requests_per_minute"`
+	Burst             int  `mapstructure:"burst"`
+}
+
+// IngestLimitsConfig bounds what a single ingest request may carry, so one
+// misbehaving client can't exhaust the server's memory
+type IngestLimitsConfig struct {
+	MaxRequestBytes int64  `mapstructure:"max_request_bytes"` // Larger bodies are rejected with 413; 0 is unlimited
+	MaxEntries      int    `mapstructure:"max_entries"`       // Larger batches are rejected with 413; 0 is unlimited
+	MaxLineBytes    int    `mapstructure:"max_line_bytes"`    // Longer lines are handled per long_lines; 0 is unlimited
+	LongLines       string `mapstructure:"long_lines"`        // truncate (with a marker) or reject
+}
+
+// ParseStageConfig describes one stage of a parsing pipeline
+type ParseStageConfig struct {
+	Type      string   `mapstructure:"type"`      // json, regex, grok, kv, timestamp, rename, drop, or geoip
+	Source    string   `mapstructure:"source"`    // line (default) or a parsed field path
+	Target    string   `mapstructure:"target"`    // Optional parsed field to nest results under
+	Pattern   string   `mapstructure:"pattern"`   // regex (named groups) or grok expression
+	Separator string   `mapstructure:"separator"` // kv pair separator, defaults to whitespace
+	Delimiter string   `mapstructure:"delimiter"` // kv key/value delimiter, defaults to =
+	Field     string   `mapstructure:"field"`     // timestamp/geoip: parsed field holding the time or IP
+	Layout    string   `mapstructure:"layout"`    // timestamp: rfc3339 (default), unix, unix_ms, or a Go layout
+	From      string   `mapstructure:"from"`      // rename: parsed field to move
+	To        string   `mapstructure:"to"`        // rename: new parsed field path
+	Fields    []string `mapstructure:"fields"`    // drop: parsed fields to remove
+}
+
+// GrokPatternConfig defines a named grok pattern usable as %{NAME}
+type GrokPatternConfig struct {
+	Name    string `mapstructure:"name"`
+	Pattern string `mapstructure:"pattern"`
+}
+
+// GeoIPConfig holds MaxMind database paths for geoip stages
+type GeoIPConfig struct {
+	CityDatabase string `mapstructure:"city_database"` // e.g. GeoLite2-City.mmdb
+	ASNDatabase  string `mapstructure:"asn_database"`  // e.g. GeoLite2-ASN.mmdb
+}
+
+// ParsingConfig holds the default and per-service parsing pipelines
+type ParsingConfig struct {
+	Default      []ParseStageConfig            `mapstructure:"default"`
+	Services     map[string][]ParseStageConfig `mapstructure:"services"`
+	GrokPatterns []GrokPatternConfig           `mapstructure:"grok_patterns"` // Added to the bundled library
+	GeoIP        GeoIPConfig                   `mapstructure:"geoip"`
+}
+
+// LevelDetectionConfig holds log level detection settings
+type LevelDetectionConfig struct {
+	Enabled bool     `mapstructure:"enabled"`
+	Fields  []string `mapstructure:"fields"` // Parsed JSON fields checked in order, dotted paths allowed
+}
+
+// RollupsConfig holds materialized per-minute count settings
+type RollupsConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	Collection    string        `mapstructure:"collection"`
+	FlushInterval time.Duration `mapstructure:"flush_interval"` // How often counts are checkpointed
+	RetentionDays int           `mapstructure:"retention_days"` // 0 keeps summaries forever
+}
+
+// PatternDiffConfig holds settings for comparing log patterns between windows
+type PatternDiffConfig struct {
+	SampleSize  int     `mapstructure:"sample_size"`  // Entries sampled per window
+	MinCount    int64   `mapstructure:"min_count"`    // Estimated occurrences for a pattern to be reported
+	MinRatio    float64 `mapstructure:"min_ratio"`    // Share change reported as a shift, either direction
+	MaxPatterns int     `mapstructure:"max_patterns"` // Per category
+}
+
+// RelabelConfig holds settings for bulk relabel jobs
+type RelabelConfig struct {
+	BatchSize        int `mapstructure:"batch_size"`          // Entries per update
+	MaxDocsPerSecond int `mapstructure:"max_docs_per_second"` // Per job
+}
+
+// BulkWriterConfig holds insert coalescing settings
+type BulkWriterConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	MaxDocs      int           `mapstructure:"max_docs"`      // Entries per InsertMany
+	MaxDelay     time.Duration `mapstructure:"max_delay"`     // Longest a batch waits for others to join
+	WriteTimeout time.Duration `mapstructure:"write_timeout"` // Per InsertMany
+}
+
+// WriteBufferConfig holds settings for buffering batches while MongoDB is unavailable
+type WriteBufferConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	MaxBatches    int           `mapstructure:"max_batches"`     // Batches held in memory
+	SpillDir      string        `mapstructure:"spill_dir"`       // Directory for batches beyond max_batches, empty disables spilling
+	MaxSpillBytes int64         `mapstructure:"max_spill_bytes"` // 0 is unlimited
+	RetryInterval time.Duration `mapstructure:"retry_interval"`  // Wait between write attempts while MongoDB is down
+	InsertTimeout time.Duration `mapstructure:"insert_timeout"`  // Per-batch write timeout while draining
+}
+
+// CertMonitorConfig holds certificate expiry monitoring settings
+type CertMonitorConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	WarnDays      int           `mapstructure:"warn_days"`      // Notify when a certificate expires within this many days
+	CheckInterval time.Duration `mapstructure:"check_interval"` // How often expiry is checked
+}
+
+// DedupConfig holds idempotent ingestion settings
+type DedupConfig struct {
+	Enabled        bool          `mapstructure:"enabled"`
+	Collection     string        `mapstructure:"collection"`
+	Window         time.Duration `mapstructure:"window"`          // How long batch IDs are remembered
+	PendingTimeout time.Duration `mapstructure:"pending_timeout"` // When an uncommitted claim is considered abandoned
 }
 
-// JSONParsingConfig holds JSON log parsing configuration
-type JSONParsingConfig struct {
+// DeliveryConfig holds batch loss detection settings
+type DeliveryConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	Collection    string        `mapstructure:"collection"`
+	GapGrace      time.Duration `mapstructure:"gap_grace"`      // How long a skipped batch may arrive late before it is a gap
+	CheckInterval time.Duration `mapstructure:"check_interval"` // How often expired gaps are recorded
+	RetentionDays int           `mapstructure:"retention_days"` // 0 keeps gap records forever
+}
+
+// DictionaryConfig holds per-service compression dictionary training settings
+type DictionaryConfig struct {
+	Enabled         bool          `mapstructure:"enabled"`
+	Collection      string        `mapstructure:"collection"`
+	SampleSize      int           `mapstructure:"sample_size"`      // Lines sampled per training run
+	DictSize        int           `mapstructure:"dict_size"`        // Maximum dictionary size in bytes
+	KeepVersions    int           `mapstructure:"keep_versions"`    // Versions kept per collection, 0 keeps all
+	RetrainInterval time.Duration `mapstructure:"retrain_interval"` // How often every collection is retrained
+}
+
+// CompressionConfig holds stored-line compression settings
+type CompressionConfig struct {
+	Dictionaries DictionaryConfig `mapstructure:"dictionaries"`
+}
+
+// QueryConfig holds log query API settings
+type QueryConfig struct {
+	MaxLimit     int64         `mapstructure:"max_limit"`
+	MaxBuckets   int           `mapstructure:"max_buckets"`   // Histogram buckets or groups returned by stats queries
+	StatsTimeout time.Duration `mapstructure:"stats_timeout"` // Server-side time limit for stats aggregations
+	ExportBatch  int32         `mapstructure:"export_batch"`  // Entries fetched per cursor batch by exports
+}
+
+// QueryAuditConfig holds query audit and slow-query log settings
+type QueryAuditConfig struct {
+	Enabled           bool          `mapstructure:"enabled"`
+	Collection        string        `mapstructure:"collection"`
+	SessionCollection string        `mapstructure:"session_collection"` // Live-tail session records
+	SlowThreshold     time.Duration `mapstructure:"slow_threshold"`
+	ExplainInterval   time.Duration `mapstructure:"explain_interval"` // How often fast queries of each shape are explained for docs examined; 0 disables
+}
+
+// LiveTailConfig holds live-tail streaming settings
+type LiveTailConfig struct {
+	Enabled    bool `mapstructure:"enabled"`
+	BufferSize int  `mapstructure:"buffer_size"` // Per-session entry buffer before dropping
+}
+
+// AutocompleteConfig holds settings for the field and value catalog used
+// for query autocomplete
+type AutocompleteConfig struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	SampleSize int64         `mapstructure:"sample_size"` // Newest entries sampled per service
+	MaxValues  int           `mapstructure:"max_values"`  // Values listed per field
+	CacheTTL   time.Duration `mapstructure:"cache_ttl"`   // How long a service's catalog is reused
+}
+
+// UIConfig holds embedded web UI settings
+type UIConfig struct {
 	Enabled bool `mapstructure:"enabled"`
 }
 
+// IndexStatsConfig holds index usage reporting settings
+type IndexStatsConfig struct {
+	UnusedDays int `mapstructure:"unused_days"` // Flag indexes with no operations for this many days
+}
+
+// QuotaConfig holds per-service ingest quota settings
+type QuotaConfig struct {
+	Enabled      bool             `mapstructure:"enabled"`
+	Window       time.Duration    `mapstructure:"window"`
+	DefaultLimit int64            `mapstructure:"default_limit"` // Entries per window, 0 = unlimited
+	WarnRatio    float64          `mapstructure:"warn_ratio"`    // Fraction of the limit that triggers a warning
+	Services     map[string]int64 `mapstructure:"services"`      // Per-service limit overrides
+}
+
+// ThrottlingConfig holds per-service ingest sampling and rate limits
+type ThrottlingConfig struct {
+	Enabled  bool                             `mapstructure:"enabled"`
+	Default  ServiceThrottleConfig            `mapstructure:",squash"`
+	Services map[string]ServiceThrottleConfig `mapstructure:"services"` // Per-service settings, replacing the defaults
+}
+
+// ServiceThrottleConfig holds a service's sampling and rate limit
+type ServiceThrottleConfig struct {
+	EntriesPerSecond float64        `mapstructure:"entries_per_second"` // 0 = unlimited
+	Burst            int64          `mapstructure:"burst"`              // Entries accepted at once above the rate; defaults to one second's worth
+	Sample           map[string]int `mapstructure:"sample"`             // Level -> keep 1 in N entries
+}
+
+// AdminConfig holds who may call the admin APIs under /v1/admin/. Without
+// either setting, or admin tenants under tenancy, the admin APIs are
+// read-only.
+type AdminConfig struct {
+	Clients []string `mapstructure:"clients"` // Client certificate common names or DNS names
+	Token   string   `mapstructure:"token"`   // Bearer token, e.g. ${LOGL_ADMIN_TOKEN}
+}
+
+// TenancyConfig holds multi-tenant isolation settings. Each service is
+// owned by the tenant that first sends it entries; tenants other than
+// admins can only ingest to and query their own services.
+type TenancyConfig struct {
+	Enabled         bool           `mapstructure:"enabled"`
+	Collection      string         `mapstructure:"collection"`       // Service ownership
+	AdminTenants    []string       `mapstructure:"admin_tenants"`    // Tenants with access to every service and the admin APIs
+	QuotaWindow     time.Duration  `mapstructure:"quota_window"`     // Window tenant quotas are counted over
+	RefreshInterval time.Duration  `mapstructure:"refresh_interval"` // How often ownership changed on other instances is picked up
+	Tenants         []TenantConfig `mapstructure:"tenants"`
+}
+
+// TenantConfig describes a tenant, how its clients are recognized, and its
+// limits
+type TenantConfig struct {
+	Name    string         `mapstructure:"name"`
+	OUs     []string       `mapstructure:"ous"`      // Client certificate organizational units; defaults to the name
+	APIKeys []APIKeyConfig `mapstructure:"api_keys"` // For clients without a certificate
+	Quota   int64          `mapstructure:"quota"`    // Entries per quota window across the tenant's services, 0 = unlimited
+	TTLDays int            `mapstructure:"ttl_days"` // Retention for the tenant's services without their own, 0 = the server default
+}
+
+// APIKeyConfig is a tenant API key, sent in the X-Logl-Api-Key header
+type APIKeyConfig struct {
+	ID  string `mapstructure:"id"` // Recorded as the sender, never the key itself
+	Key string `mapstructure:"key"`
+}
+
+// NotificationsConfig holds operator notification settings
+type NotificationsConfig struct {
+	WebhookURL string `mapstructure:"webhook_url"`
+	Format     string `mapstructure:"format"` // json, cloudevents (structured mode), or cloudevents-binary
+	Source     string `mapstructure:"source"` // CloudEvents source, defaults to /logl-server/<hostname>
+}
+
+// AlertingConfig holds ingest alerting settings. Rules are evaluated
+// against every accepted batch, on each server separately.
+type AlertingConfig struct {
+	Enabled       bool                 `mapstructure:"enabled"`
+	CheckInterval time.Duration        `mapstructure:"check_interval"` // How often firing alerts are checked for resolution
+	Rules         []AlertRuleConfig    `mapstructure:"rules"`
+	Channels      []AlertChannelConfig `mapstructure:"channels"`
+}
+
+// EntryFilterConfig selects entries by service, level, labels, and a
+// pattern or value on the line or a parsed field. Every condition set must
+// match.
+type EntryFilterConfig struct {
+	Service string            `mapstructure:"service"` // Glob, empty matches every service
+	Pattern string            `mapstructure:"pattern"` // Regex on the line, or on the field when one is set
+	Field   string            `mapstructure:"field"`   // Parsed field, dotted paths allowed
+	Value   string            `mapstructure:"value"`   // Exact match on the field
+	Levels  []string          `mapstructure:"levels"`
+	Labels  map[string]string `mapstructure:"labels"` // Exact label values
+}
+
+// validate checks that the filter is well formed and, when required,
+// selects something
+func (f EntryFilterConfig) validate(name string, required bool) error {
+	if required && f.Pattern == "" && f.Field == "" && len(f.Levels) == 0 && len(f.Labels) == 0 {
+		return fmt.Errorf("%s: a pattern, field, levels, or labels is required", name)
+	}
+	if f.Value != "" && f.Field == "" {
+		return fmt.Errorf("%s: value requires a field", name)
+	}
+	if _, err := path.Match(f.Service, ""); err != nil {
+		return fmt.Errorf("%s: invalid service pattern %q", name, f.Service)
+	}
+	return nil
+}
+
+// AlertRuleConfig fires when matching entries for a service reach the
+// threshold within the window
+type AlertRuleConfig struct {
+	EntryFilterConfig `mapstructure:",squash"`
+	Name              string        `mapstructure:"name"`
+	Description       string        `mapstructure:"description"`
+	Threshold         int64         `mapstructure:"threshold"` // Matches within the window
+	Window            time.Duration `mapstructure:"window"`
+	Cooldown          time.Duration `mapstructure:"cooldown"` // Minimum time between notifications while firing
+	Severity          string        `mapstructure:"severity"` // critical, error, warning, or info
+	Channels          []string      `mapstructure:"channels"`
+}
+
+// AlertChannelConfig is a destination for alert notifications
+type AlertChannelConfig struct {
+	Name       string `mapstructure:"name"`
+	Type       string `mapstructure:"type"`        // webhook, slack, or pagerduty
+	URL        string `mapstructure:"url"`         // Defaults to the PagerDuty Events API v2 for pagerduty
+	RoutingKey string `mapstructure:"routing_key"` // PagerDuty integration key
+}
+
+// ForwardingConfig holds settings for forwarding matching entries to webhooks
+type ForwardingConfig struct {
+	Enabled bool                  `mapstructure:"enabled"`
+	Targets []ForwardTargetConfig `mapstructure:"targets"`
+}
+
+// ForwardTargetConfig is a webhook receiving batches of the entries that
+// match its filter
+type ForwardTargetConfig struct {
+	EntryFilterConfig `mapstructure:",squash"`
+	Name              string        `mapstructure:"name"`
+	URL               string        `mapstructure:"url"`
+	Secret            string        `mapstructure:"secret"`         // HMAC-SHA256 signing key; empty sends batches unsigned
+	BatchSize         int           `mapstructure:"batch_size"`     // Entries per request
+	FlushInterval     time.Duration `mapstructure:"flush_interval"` // Longest an entry waits for a batch to fill
+	QueueSize         int           `mapstructure:"queue_size"`     // Entries held while the webhook is slow; more are dropped
+	MaxRetries        int           `mapstructure:"max_retries"`
+	Timeout           time.Duration `mapstructure:"timeout"` // Per request
+}
+
+// KafkaConfig holds settings for publishing accepted entries to Kafka, one
+// topic per service
+type KafkaConfig struct {
+	Enabled          bool            `mapstructure:"enabled"`
+	Brokers          []string        `mapstructure:"brokers"`
+	Topic            string          `mapstructure:"topic"` // {service} is replaced with the service name
+	AutoCreateTopics bool            `mapstructure:"auto_create_topics"`
+	Compression      string          `mapstructure:"compression"`   // none, gzip, snappy, lz4, or zstd
+	RequiredAcks     string          `mapstructure:"required_acks"` // none, leader, or all
+	BatchSize        int             `mapstructure:"batch_size"`
+	FlushInterval    time.Duration   `mapstructure:"flush_interval"` // Longest an entry waits for a batch to fill
+	QueueSize        int             `mapstructure:"queue_size"`     // Entries held while Kafka is slow; more are dropped
+	MaxRetries       int             `mapstructure:"max_retries"`
+	Timeout          time.Duration   `mapstructure:"timeout"` // Per write
+	TLS              OutputTLSConfig `mapstructure:"tls"`
+	SASL             KafkaSASLConfig `mapstructure:"sasl"`
+
+	// Optional; an empty filter publishes every entry
+	EntryFilterConfig `mapstructure:",squash"`
+}
+
+// RoutingConfig directs entries to sinks by rules. Without routing, every
+// entry is stored in MongoDB and published to the enabled outputs.
+type RoutingConfig struct {
+	Enabled bool                `mapstructure:"enabled"`
+	Default []string            `mapstructure:"default"` // Sinks for entries no rule matches
+	Rules   []RoutingRuleConfig `mapstructure:"rules"`
+	Sinks   []RoutingSinkConfig `mapstructure:"sinks"`
+}
+
+// RoutingRuleConfig sends the entries matching its filter to its sinks.
+// Rules are evaluated in order and the first match wins, unless it
+// continues to later rules.
+type RoutingRuleConfig struct {
+	EntryFilterConfig `mapstructure:",squash"`
+	Name              string   `mapstructure:"name"`
+	Sinks             []string `mapstructure:"sinks"`    // mongo, kafka, nats, drop, or a configured sink
+	Continue          bool     `mapstructure:"continue"` // Also apply later matching rules
+}
+
+// RoutingSinkConfig is a file or S3 destination for routed entries
+type RoutingSinkConfig struct {
+	Name          string        `mapstructure:"name"`
+	Type          string        `mapstructure:"type"`     // file or s3
+	Path          string        `mapstructure:"path"`     // file: {service} and {date} are replaced
+	Bucket        string        `mapstructure:"bucket"`   // s3
+	Prefix        string        `mapstructure:"prefix"`   // s3: key prefix
+	Region        string        `mapstructure:"region"`   // s3
+	Endpoint      string        `mapstructure:"endpoint"` // s3: optional, e.g. MinIO, addressed path-style
+	BatchSize     int           `mapstructure:"batch_size"`
+	FlushInterval time.Duration `mapstructure:"flush_interval"` // Longest an entry waits for a batch to fill
+	QueueSize     int           `mapstructure:"queue_size"`     // Entries held while the sink is slow; more are dropped
+	MaxRetries    int           `mapstructure:"max_retries"`
+	Timeout       time.Duration `mapstructure:"timeout"` // Per write
+}
+
+// OutputTLSConfig holds TLS settings for connections to an output's
+// brokers or servers
+type OutputTLSConfig struct {
+	Enabled           bool   `mapstructure:"enabled"`
+	CACert            string `mapstructure:"ca_cert"`     // Empty uses the system roots
+	ClientCert        string `mapstructure:"client_cert"` // Optional, with client_key
+	ClientKey         string `mapstructure:"client_key"`
+	KeyPassphraseFile string `mapstructure:"key_passphrase_file"` // Passphrase of an encrypted client_key
+	KeyPassphraseEnv  string `mapstructure:"key_passphrase_env"`  // Environment variable holding it instead
+}
+
+// KafkaSASLConfig holds SASL authentication settings for brokers
+type KafkaSASLConfig struct {
+	Mechanism string `mapstructure:"mechanism"` // plain, scram-sha-256, or scram-sha-512; empty disables SASL
+	Username  string `mapstructure:"username"`
+	Password  string `mapstructure:"password"`
+}
+
+// NATSConfig holds settings for publishing accepted entries to NATS
+// JetStream subjects
+type NATSConfig struct {
+	Enabled       bool              `mapstructure:"enabled"`
+	URL           string            `mapstructure:"url"`     // Comma-separated server URLs
+	Subject       string            `mapstructure:"subject"` // {service} is replaced with the service name
+	Routes        []NATSRouteConfig `mapstructure:"routes"`  // Empty publishes every entry to subject
+	Stream        NATSStreamConfig  `mapstructure:"stream"`
+	CredsFile     string            `mapstructure:"creds_file"`
+	Token         string            `mapstructure:"token"`
+	Username      string            `mapstructure:"username"`
+	Password      string            `mapstructure:"password"`
+	TLS           OutputTLSConfig   `mapstructure:"tls"`
+	BatchSize     int               `mapstructure:"batch_size"`     // Publishes awaiting acknowledgement at once
+	FlushInterval time.Duration     `mapstructure:"flush_interval"` // Longest an entry waits for a batch to fill
+	QueueSize     int               `mapstructure:"queue_size"`     // Entries held while NATS is slow; more are dropped
+	MaxRetries    int               `mapstructure:"max_retries"`
+	Timeout       time.Duration     `mapstructure:"timeout"` // For a batch's acknowledgements
+}
+
+// NATSRouteConfig publishes the entries matching its filter, typically a
+// service glob, to a subject
+type NATSRouteConfig struct {
+	Subject string `mapstructure:"subject"` // Defaults to nats.subject
+
+	EntryFilterConfig `mapstructure:",squash"`
+}
+
+// NATSStreamConfig describes the JetStream stream created at startup when
+// it does not exist
+type NATSStreamConfig struct {
+	Name     string        `mapstructure:"name"`     // Empty leaves stream management to operators
+	Subjects []string      `mapstructure:"subjects"` // Defaults to the routes' subjects with {service} as a wildcard
+	MaxAge   time.Duration `mapstructure:"max_age"`  // 0 keeps messages until other limits apply
+}
+
+// RegionConfig names the region a server runs in. Servers advertise it
+// from /v1/health and label entries that arrive without a region with it.
+type RegionConfig struct {
+	Name          string `mapstructure:"name"`
+	RejectForeign bool   `mapstructure:"reject_foreign"` // Reject batches with entries labelled with another region
+	PinQueries    bool   `mapstructure:"pin_queries"`    // Only return entries labelled with this region
+}
+
+// RetentionConfig holds per-service retention settings
+type RetentionConfig struct {
+	Services   map[string]int `mapstructure:"services"`   // Days by service name or glob, overriding templates and mongodb.ttl_days; 0 keeps forever
+	Collection string         `mapstructure:"collection"` // Overrides set through the API
+}
+
+// MaintenanceConfig holds maintenance window settings
+type MaintenanceConfig struct {
+	Enabled         bool                      `mapstructure:"enabled"`
+	Collection      string                    `mapstructure:"collection"`
+	RefreshInterval time.Duration             `mapstructure:"refresh_interval"` // How often windows created on other instances are picked up
+	MaxDuration     time.Duration             `mapstructure:"max_duration"`     // Longest window the API accepts
+	Windows         []MaintenanceWindowConfig `mapstructure:"windows"`
+}
+
+// MaintenanceWindowConfig describes a window defined in configuration
+type MaintenanceWindowConfig struct {
+	Service    string  `mapstructure:"service"`  // Glob
+	Hostname   string  `mapstructure:"hostname"` // Glob
+	Reason     string  `mapstructure:"reason"`
+	SampleRate float64 `mapstructure:"sample_rate"` // Fraction of entries kept; 0 keeps all
+	StartsAt   string  `mapstructure:"starts_at"`   // RFC3339
+	EndsAt     string  `mapstructure:"ends_at"`     // RFC3339
+}
+
+// TokensConfig holds read-only access token settings
+type TokensConfig struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	Secret     string        `mapstructure:"secret"` // HMAC signing key
+	Collection string        `mapstructure:"collection"`
+	MaxTTL     time.Duration `mapstructure:"max_ttl"`
+}
+
+// MetricsHistoryConfig holds settings for keeping the server's own
+// operational metrics, sampled every interval
+type MetricsHistoryConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	Collection    string        `mapstructure:"collection"`
+	Interval      time.Duration `mapstructure:"interval"`
+	RetentionDays int           `mapstructure:"retention_days"` // 0 keeps samples forever
+}
+
+// PreParsedConfig holds settings for storing batches that tailers parsed
+// themselves without running the parsing pipelines again
+type PreParsedConfig struct {
+	Enabled        bool     `mapstructure:"enabled"`
+	TrustedClients []string `mapstructure:"trusted_clients"` // Client certificate common names, globs allowed
+}
+
+// HerokuConfig holds Heroku Logplex HTTPS drain settings. Heroku can't
+// present a client certificate, so drains authenticate with the basic auth
+// password in the drain URL instead.
+type HerokuConfig struct {
+	Enabled bool                `mapstructure:"enabled"`
+	Drains  []HerokuDrainConfig `mapstructure:"drains"`
+}
+
+// HerokuDrainConfig maps a Logplex drain token to the service its entries
+// are stored under
+type HerokuDrainConfig struct {
+	Token    string `mapstructure:"token"` // Logplex-Drain-Token, e.g. d.01234567-89ab-cdef-0123-456789abcdef
+	Service  string `mapstructure:"service"`
+	Password string `mapstructure:"password"` // Basic auth password in the drain URL
+}
+
+// WarmupConfig holds startup warmup settings
+type WarmupConfig struct {
+	Enabled bool          `mapstructure:"enabled"`
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// ServerRedactionConfig holds server-side redaction settings. Default rules
+// apply to every service; per-service rules are applied after them.
+type ServerRedactionConfig struct {
+	RedactionConfig `mapstructure:",squash"`
+	Services        map[string]RedactionConfig `mapstructure:"services"`
+}
+
+// IndexTemplateConfig describes an index created by a collection template
+// or mongodb.indexes.custom
+type IndexTemplateConfig struct {
+	Name          string   `mapstructure:"name"`
+	Keys          []string `mapstructure:"keys"` // field:1, field:-1, field:hashed, or field:text
+	Unique        bool     `mapstructure:"unique"`
+	Sparse        bool     `mapstructure:"sparse"`
+	PartialFilter string   `mapstructure:"partial_filter"` // MongoDB Extended JSON, e.g. {"level": "error"}
+}
+
+// CollectionTemplateConfig describes how collections for matching services are created
+type CollectionTemplateConfig struct {
+	Name             string                `mapstructure:"name"`
+	Match            string                `mapstructure:"match"`       // Glob on service name, e.g. payment-*
+	TTLDays          *int                  `mapstructure:"ttl_days"`    // Overrides mongodb.ttl_days
+	TimeSeries       *bool                 `mapstructure:"time_series"` // Overrides mongodb.time_series.enabled
+	Indexes          []IndexTemplateConfig `mapstructure:"indexes"`
+	ShardKey         []string              `mapstructure:"shard_key"`
+	Validator        string                `mapstructure:"validator"` // MongoDB Extended JSON
+	ValidationLevel  string                `mapstructure:"validation_level"`
+	ValidationAction string                `mapstructure:"validation_action"`
+}
+
 // ServerConfig represents the complete server configuration
 type ServerConfig struct {
-	Server       HTTPServerConfig  `mapstructure:"server"`
-	MongoDB      MongoDBConfig     `mapstructure:"mongodb"`
-	MTLS         ServerMTLSConfig  `mapstructure:"mtls"`
-	RateLimiting RateLimitConfig   `mapstructure:"rate_limiting"`
-	JSONParsing  JSONParsingConfig `mapstructure:"json_parsing"`
-	LogLevel     string            `mapstructure:"log_level"`
-	LogFormat    string            `mapstructure:"log_format"`
+	Server              HTTPServerConfig           `mapstructure:"server"`
+	MongoDB             MongoDBConfig              `mapstructure:"mongodb"`
+	MTLS                ServerMTLSConfig           `mapstructure:"mtls"`
+	Secrets             SecretsConfig              `mapstructure:"secrets"`
+	RateLimiting        RateLimitConfig            `mapstructure:"rate_limiting"`
+	IngestLimits        IngestLimitsConfig         `mapstructure:"ingest_limits"`
+	Parsing             ParsingConfig              `mapstructure:"parsing"`
+	LevelDetection      LevelDetectionConfig       `mapstructure:"level_detection"`
+	PreParsed           PreParsedConfig            `mapstructure:"pre_parsed"`
+	Rollups             RollupsConfig              `mapstructure:"rollups"`
+	MetricsHistory      MetricsHistoryConfig       `mapstructure:"metrics_history"`
+	Delivery            DeliveryConfig             `mapstructure:"delivery"`
+	Dedup               DedupConfig                `mapstructure:"dedup"`
+	CertMonitor         CertMonitorConfig          `mapstructure:"cert_monitor"`
+	WriteBuffer         WriteBufferConfig          `mapstructure:"write_buffer"`
+	BulkWriter          BulkWriterConfig           `mapstructure:"bulk_writer"`
+	Relabel             RelabelConfig              `mapstructure:"relabel"`
+	PatternDiff         PatternDiffConfig          `mapstructure:"pattern_diff"`
+	Compression         CompressionConfig          `mapstructure:"compression"`
+	Query               QueryConfig                `mapstructure:"query"`
+	QueryAudit          QueryAuditConfig           `mapstructure:"query_audit"`
+	Autocomplete        AutocompleteConfig         `mapstructure:"autocomplete"`
+	IndexStats          IndexStatsConfig           `mapstructure:"index_stats"`
+	Quotas              QuotaConfig                `mapstructure:"quotas"`
+	Throttling          ThrottlingConfig           `mapstructure:"throttling"`
+	Admin               AdminConfig                `mapstructure:"admin"`
+	Tenancy             TenancyConfig              `mapstructure:"tenancy"`
+	LiveTail            LiveTailConfig             `mapstructure:"live_tail"`
+	UI                  UIConfig                   `mapstructure:"ui"`
+	Tokens              TokensConfig               `mapstructure:"tokens"`
+	Heroku              HerokuConfig               `mapstructure:"heroku"`
+	Warmup              WarmupConfig               `mapstructure:"warmup"`
+	Redaction           ServerRedactionConfig      `mapstructure:"redaction"`
+	CollectionTemplates []CollectionTemplateConfig `mapstructure:"collection_templates"`
+	Notifications       NotificationsConfig        `mapstructure:"notifications"`
+	Alerting            AlertingConfig             `mapstructure:"alerting"`
+	Forwarding          ForwardingConfig           `mapstructure:"forwarding"`
+	Kafka               KafkaConfig                `mapstructure:"kafka"`
+	NATS                NATSConfig                 `mapstructure:"nats"`
+	Routing             RoutingConfig              `mapstructure:"routing"`
+	Maintenance         MaintenanceConfig          `mapstructure:"maintenance"`
+	Retention           RetentionConfig            `mapstructure:"retention"`
+	Region              RegionConfig               `mapstructure:"region"`
+	LogLevel            string                     `mapstructure:"log_level"`
+	LogFormat           string                     `mapstructure:"log_format"`
 }
 
 // LoadServerConfig loads the server configuration from a file
 func LoadServerConfig(configPath string) (*ServerConfig, error) {
 	v := viper.New()
-	v.SetConfigFile(configPath)
 	v.AutomaticEnv()
 
 	// Set defaults
@@ -73,18 +699,141 @@ func LoadServerConfig(configPath string) (*ServerConfig, error) {
 	v.SetDefault("mongodb.collection_prefix", "logs_")
 	v.SetDefault("mongodb.timeout", "10s")
 	v.SetDefault("mongodb.max_pool_size", 100)
+	v.SetDefault("mongodb.min_pool_size", 0)
 	v.SetDefault("mongodb.ttl_days", 30)
+	v.SetDefault("mongodb.quarantine_collection", "quarantine")
+	v.SetDefault("mongodb.time_series.enabled", false)
+	v.SetDefault("mongodb.partitioning.interval", "")
+	v.SetDefault("mongodb.partitioning.check_interval", "1h")
+	v.SetDefault("mongodb.indexes.check_interval", "1h")
+	v.SetDefault("mongodb.indexes.build_timeout", "5m")
+	v.SetDefault("mongodb.time_series.meta_field", "hostname")
+	v.SetDefault("mongodb.time_series.granularity", "seconds")
 	v.SetDefault("mtls.enabled", true)
 	v.SetDefault("mtls.client_auth", "require")
+	v.SetDefault("mtls.reload_interval", "1m")
+	setSecretsDefaults(v)
+	v.SetDefault("mtls.revocation.enabled", false)
+	v.SetDefault("mtls.revocation.fail_mode", "open")
+	v.SetDefault("mtls.revocation.cache_ttl", "1h")
+	v.SetDefault("mtls.revocation.refresh_interval", "1h")
+	v.SetDefault("mtls.revocation.timeout", "5s")
 	v.SetDefault("rate_limiting.enabled", false)
 	v.SetDefault("rate_limiting.requests_per_minute", 1000)
 	v.SetDefault("rate_limiting.burst", 100)
-	v.SetDefault("json_parsing.enabled", false)
+	v.SetDefault("ingest_limits.max_request_bytes", 16<<20)
+	v.SetDefault("ingest_limits.max_entries", 10000)
+	v.SetDefault("ingest_limits.max_line_bytes", 256<<10)
+	v.SetDefault("ingest_limits.long_lines", "truncate")
+	v.SetDefault("level_detection.enabled", true)
+	v.SetDefault("level_detection.fields", []string{"level", "severity", "lvl", "log.level"})
+	v.SetDefault("pre_parsed.enabled", false)
+	v.SetDefault("rollups.enabled", true)
+	v.SetDefault("rollups.collection", "rollup_minute")
+	v.SetDefault("rollups.flush_interval", "10s")
+	v.SetDefault("rollups.retention_days", 90)
+	v.SetDefault("metrics_history.enabled", true)
+	v.SetDefault("metrics_history.collection", "server_metrics")
+	v.SetDefault("metrics_history.interval", "1m")
+	v.SetDefault("metrics_history.retention_days", 14)
+	v.SetDefault("retention.collection", "retention_overrides")
+	v.SetDefault("maintenance.enabled", true)
+	v.SetDefault("maintenance.collection", "maintenance_windows")
+	v.SetDefault("maintenance.refresh_interval", "30s")
+	v.SetDefault("maintenance.max_duration", "168h")
+	v.SetDefault("pattern_diff.sample_size", 20000)
+	v.SetDefault("pattern_diff.min_count", 5)
+	v.SetDefault("pattern_diff.min_ratio", 2.0)
+	v.SetDefault("pattern_diff.max_patterns", 50)
+	v.SetDefault("relabel.batch_size", 500)
+	v.SetDefault("relabel.max_docs_per_second", 2000)
+	v.SetDefault("bulk_writer.enabled", true)
+	v.SetDefault("bulk_writer.max_docs", 10000)
+	v.SetDefault("bulk_writer.max_delay", "20ms")
+	v.SetDefault("bulk_writer.write_timeout", "30s")
+	v.SetDefault("write_buffer.enabled", true)
+	v.SetDefault("write_buffer.max_batches", 10000)
+	v.SetDefault("write_buffer.max_spill_bytes", 1<<30)
+	v.SetDefault("write_buffer.retry_interval", "5s")
+	v.SetDefault("write_buffer.insert_timeout", "10s")
+	v.SetDefault("cert_monitor.enabled", true)
+	v.SetDefault("cert_monitor.warn_days", 30)
+	v.SetDefault("cert_monitor.check_interval", "1h")
+	v.SetDefault("dedup.enabled", true)
+	v.SetDefault("dedup.collection", "ingest_dedup")
+	v.SetDefault("dedup.window", "10m")
+	v.SetDefault("dedup.pending_timeout", "1m")
+	v.SetDefault("delivery.enabled", true)
+	v.SetDefault("delivery.collection", "delivery_gaps")
+	v.SetDefault("delivery.gap_grace", "2m")
+	v.SetDefault("delivery.check_interval", "30s")
+	v.SetDefault("delivery.retention_days", 30)
+	v.SetDefault("compression.dictionaries.enabled", false)
+	v.SetDefault("compression.dictionaries.collection", "compression_dicts")
+	v.SetDefault("compression.dictionaries.sample_size", 5000)
+	v.SetDefault("compression.dictionaries.dict_size", 65536)
+	v.SetDefault("compression.dictionaries.keep_versions", 3)
+	v.SetDefault("compression.dictionaries.retrain_interval", "24h")
+	v.SetDefault("query.max_limit", 1000)
+	v.SetDefault("query.max_buckets", 1000)
+	v.SetDefault("query.stats_timeout", 30*time.Second)
+	v.SetDefault("query.export_batch", 1000)
+	v.SetDefault("autocomplete.enabled", true)
+	v.SetDefault("autocomplete.sample_size", 1000)
+	v.SetDefault("autocomplete.max_values", 20)
+	v.SetDefault("autocomplete.cache_ttl", "5m")
+	v.SetDefault("query_audit.enabled", true)
+	v.SetDefault("query_audit.collection", "query_audit")
+	v.SetDefault("query_audit.session_collection", "stream_audit")
+	v.SetDefault("query_audit.slow_threshold", "1s")
+	v.SetDefault("query_audit.explain_interval", "10m")
+	v.SetDefault("live_tail.enabled", true)
+	v.SetDefault("live_tail.buffer_size", 1000)
+	v.SetDefault("ui.enabled", false)
+	v.SetDefault("warmup.enabled", true)
+	v.SetDefault("warmup.timeout", "30s")
+	v.SetDefault("tokens.enabled", false)
+	v.SetDefault("tokens.collection", "access_tokens")
+	v.SetDefault("tokens.max_ttl", "720h")
+	v.SetDefault("heroku.enabled", false)
+	v.SetDefault("index_stats.unused_days", 7)
+	v.SetDefault("quotas.enabled", false)
+	v.SetDefault("quotas.window", "24h")
+	v.SetDefault("quotas.default_limit", 0)
+	v.SetDefault("quotas.warn_ratio", 0.8)
+	v.SetDefault("throttling.enabled", false)
+	v.SetDefault("tenancy.enabled", false)
+	v.SetDefault("tenancy.collection", "tenant_services")
+	v.SetDefault("tenancy.quota_window", "24h")
+	v.SetDefault("tenancy.refresh_interval", "1m")
+	v.SetDefault("notifications.format", "json")
+	v.SetDefault("alerting.enabled", false)
+	v.SetDefault("alerting.check_interval", "15s")
+	v.SetDefault("forwarding.enabled", false)
+	v.SetDefault("kafka.enabled", false)
+	v.SetDefault("kafka.topic", "logl.{service}")
+	v.SetDefault("kafka.auto_create_topics", true)
+	v.SetDefault("kafka.compression", "snappy")
+	v.SetDefault("kafka.required_acks", "all")
+	v.SetDefault("kafka.batch_size", 100)
+	v.SetDefault("kafka.flush_interval", "1s")
+	v.SetDefault("kafka.queue_size", 10000)
+	v.SetDefault("kafka.max_retries", 5)
+	v.SetDefault("kafka.timeout", "10s")
+	v.SetDefault("nats.enabled", false)
+	v.SetDefault("nats.url", "nats://127.0.0.1:4222")
+	v.SetDefault("nats.subject", "logl.{service}")
+	v.SetDefault("nats.batch_size", 256)
+	v.SetDefault("nats.flush_interval", "1s")
+	v.SetDefault("nats.queue_size", 10000)
+	v.SetDefault("nats.max_retries", 5)
+	v.SetDefault("nats.timeout", "10s")
+	v.SetDefault("routing.enabled", false)
 	v.SetDefault("log_level", "info")
 	v.SetDefault("log_format", "json")
 
-	if err := v.ReadInConfig(); err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+	if err := readConfig(v, configPath); err != nil {
+		return nil, err
 	}
 
 	var config ServerConfig
@@ -92,15 +841,614 @@ func LoadServerConfig(configPath string) (*ServerConfig, error) {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
+	// Legacy json_parsing.enabled maps onto a default json stage
+	if v.GetBool("json_parsing.enabled") && len(config.Parsing.Default) == 0 {
+		config.Parsing.Default = []ParseStageConfig{{Type: "json"}}
+	}
+
+	// A single listen_address is a dual-stack bind
+	if len(config.Server.Binds) == 0 {
+		config.Server.Binds = []ListenBindConfig{{Network: "tcp", Address: config.Server.ListenAddress}}
+	}
+
 	// Validate required fields
 	if config.MongoDB.URI == "" {
 		return nil, fmt.Errorf("mongodb.uri is required")
 	}
+	if err := validateSecrets(&config.Secrets, &config.MTLS.VaultPKI); err != nil {
+		return nil, err
+	}
 	if config.MTLS.Enabled {
-		if config.MTLS.CACert == "" || config.MTLS.ServerCert == "" || config.MTLS.ServerKey == "" {
+		// A Vault PKI certificate comes with its issuing CA
+		if config.MTLS.VaultPKI.Role == "" && (config.MTLS.CACert == "" || config.MTLS.ServerCert == "" || config.MTLS.ServerKey == "") {
 			return nil, fmt.Errorf("mTLS certificates are required when mTLS is enabled")
 		}
+		if config.MTLS.ReloadInterval < 0 {
+			return nil, fmt.Errorf("mtls.reload_interval must not be negative")
+		}
+		if config.MTLS.KeyPassphraseFile != "" && config.MTLS.KeyPassphraseEnv != "" {
+			return nil, fmt.Errorf("mtls.key_passphrase_file and mtls.key_passphrase_env are mutually exclusive")
+		}
+		if err := validateRevocation(&config.MTLS.Revocation); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, bind := range config.Server.Binds {
+		if bind.Network != "tcp" && bind.Network != "tcp4" && bind.Network != "tcp6" {
+			return nil, fmt.Errorf("server.binds network must be tcp, tcp4, or tcp6")
+		}
+		if bind.Address == "" {
+			return nil, fmt.Errorf("server.binds entries require an address")
+		}
+	}
+	if ts := config.MongoDB.TimeSeries; ts.MetaField != "hostname" && ts.MetaField != "labels" {
+		return nil, fmt.Errorf("mongodb.time_series.meta_field must be hostname or labels")
+	}
+	switch config.MongoDB.TimeSeries.Granularity {
+	case "seconds", "minutes", "hours":
+	default:
+		return nil, fmt.Errorf("mongodb.time_series.granularity must be seconds, minutes, or hours")
+	}
+	if p := config.MongoDB.Partitioning; p.Interval != "" {
+		if p.Interval != "day" && p.Interval != "month" {
+			return nil, fmt.Errorf("mongodb.partitioning.interval must be day or month")
+		}
+		if p.CheckInterval <= 0 {
+			return nil, fmt.Errorf("mongodb.partitioning.check_interval must be positive")
+		}
+	}
+	for _, label := range config.MongoDB.LabelIndexes {
+		if label == "" || strings.ContainsAny(label, ".$ ") {
+			return nil, fmt.Errorf("mongodb.label_indexes entry %q is not a valid label key", label)
+		}
+	}
+	if config.Query.MaxLimit <= 0 {
+		return nil, fmt.Errorf("query.max_limit must be positive")
+	}
+	if config.Query.MaxBuckets <= 0 {
+		return nil, fmt.Errorf("query.max_buckets must be positive")
+	}
+	if config.Query.StatsTimeout <= 0 {
+		return nil, fmt.Errorf("query.stats_timeout must be positive")
+	}
+	if config.Query.ExportBatch <= 0 {
+		return nil, fmt.Errorf("query.export_batch must be positive")
+	}
+	if config.MongoDB.Indexes.CheckInterval < 0 {
+		return nil, fmt.Errorf("mongodb.indexes.check_interval must not be negative")
+	}
+	if config.MongoDB.Indexes.BuildTimeout <= 0 {
+		return nil, fmt.Errorf("mongodb.indexes.build_timeout must be positive")
+	}
+	for service, days := range config.Retention.Services {
+		if _, err := path.Match(service, ""); err != nil {
+			return nil, fmt.Errorf("retention.services: invalid pattern %q", service)
+		}
+		if days < 0 {
+			return nil, fmt.Errorf("retention.services.%s must not be negative", service)
+		}
+	}
+	if config.Quotas.Enabled {
+		if config.Quotas.Window <= 0 {
+			return nil, fmt.Errorf("quotas.window must be positive")
+		}
+		if config.Quotas.WarnRatio <= 0 || config.Quotas.WarnRatio > 1 {
+			return nil, fmt.Errorf("quotas.warn_ratio must be between 0 and 1")
+		}
+	}
+	if l := config.IngestLimits; l.MaxRequestBytes < 0 || l.MaxEntries < 0 || l.MaxLineBytes < 0 {
+		return nil, fmt.Errorf("ingest_limits must not be negative")
+	}
+	if l := config.IngestLimits; l.MaxLineBytes > 0 && l.MaxLineBytes < 64 {
+		return nil, fmt.Errorf("ingest_limits.max_line_bytes must be at least 64")
+	}
+	if l := config.IngestLimits.LongLines; l != "truncate" && l != "reject" {
+		return nil, fmt.Errorf("ingest_limits.long_lines must be truncate or reject")
+	}
+	if config.Throttling.Enabled {
+		if err := config.Throttling.Default.validate("throttling"); err != nil {
+			return nil, err
+		}
+		for service, t := range config.Throttling.Services {
+			if err := t.validate("throttling.services." + service); err != nil {
+				return nil, err
+			}
+			config.Throttling.Services[service] = t
+		}
+	}
+	if config.Tenancy.Enabled {
+		if err := validateTenancy(&config); err != nil {
+			return nil, err
+		}
+	}
+	if len(config.Admin.Clients) > 0 && !config.MTLS.Enabled {
+		return nil, fmt.Errorf("admin.clients requires mtls, since admins are identified by certificate")
+	}
+	if config.Admin.Token != "" && len(config.Admin.Token) < 32 {
+		return nil, fmt.Errorf("admin.token must be at least 32 characters")
+	}
+	if config.Tokens.Enabled && len(config.Tokens.Secret) < 32 {
+		return nil, fmt.Errorf("tokens.secret must be at least 32 characters when tokens are enabled")
+	}
+	if p := config.PreParsed; p.Enabled {
+		if !config.MTLS.Enabled {
+			return nil, fmt.Errorf("pre_parsed requires mtls, since trusted clients are identified by certificate")
+		}
+		if len(p.TrustedClients) == 0 {
+			return nil, fmt.Errorf("pre_parsed.trusted_clients is required when pre_parsed is enabled")
+		}
+		for _, client := range p.TrustedClients {
+			if _, err := path.Match(client, ""); err != nil || client == "" {
+				return nil, fmt.Errorf("pre_parsed.trusted_clients: invalid pattern %q", client)
+			}
+		}
+	}
+	if h := config.Heroku; h.Enabled {
+		if len(h.Drains) == 0 {
+			return nil, fmt.Errorf("heroku.drains is required when heroku is enabled")
+		}
+		if config.MTLS.Enabled && config.MTLS.ClientAuth == "require" {
+			return nil, fmt.Errorf("heroku drains require mtls.client_auth request or none, since Heroku can't present a client certificate")
+		}
+		seen := make(map[string]bool)
+		for _, drain := range h.Drains {
+			if drain.Token == "" || drain.Service == "" {
+				return nil, fmt.Errorf("heroku.drains entries require a token and service")
+			}
+			if len(drain.Password) < 16 {
+				return nil, fmt.Errorf("heroku.drains %s: password must be at least 16 characters", drain.Token)
+			}
+			if seen[drain.Token] {
+				return nil, fmt.Errorf("heroku.drains: duplicate token %s", drain.Token)
+			}
+			seen[drain.Token] = true
+		}
+	}
+	switch config.Notifications.Format {
+	case "json", "cloudevents", "cloudevents-binary":
+	default:
+		return nil, fmt.Errorf("notifications.format must be json, cloudevents, or cloudevents-binary")
+	}
+	if a := config.Alerting; a.Enabled {
+		if a.CheckInterval <= 0 {
+			return nil, fmt.Errorf("alerting.check_interval must be positive")
+		}
+		channels := make(map[string]bool)
+		for _, c := range a.Channels {
+			if c.Name == "" || channels[c.Name] {
+				return nil, fmt.Errorf("alerting.channels entries require a unique name")
+			}
+			channels[c.Name] = true
+			switch c.Type {
+			case "webhook", "slack":
+				if c.URL == "" {
+					return nil, fmt.Errorf("alerting.channels %s: url is required", c.Name)
+				}
+			case "pagerduty":
+				if c.RoutingKey == "" {
+					return nil, fmt.Errorf("alerting.channels %s: routing_key is required", c.Name)
+				}
+			default:
+				return nil, fmt.Errorf("alerting.channels %s: type must be webhook, slack, or pagerduty", c.Name)
+			}
+		}
+		rules := make(map[string]bool)
+		for i := range a.Rules {
+			rule := &config.Alerting.Rules[i]
+			if rule.Name == "" || rules[rule.Name] {
+				return nil, fmt.Errorf("alerting.rules entries require a unique name")
+			}
+			rules[rule.Name] = true
+			if err := rule.EntryFilterConfig.validate("alerting.rules "+rule.Name, true); err != nil {
+				return nil, err
+			}
+			if rule.Threshold == 0 {
+				rule.Threshold = 1
+			}
+			if rule.Window == 0 {
+				rule.Window = 5 * time.Minute
+			}
+			if rule.Cooldown == 0 {
+				rule.Cooldown = time.Hour
+			}
+			if rule.Severity == "" {
+				rule.Severity = "error"
+			}
+			if rule.Threshold < 0 || rule.Window < time.Second || rule.Cooldown < 0 {
+				return nil, fmt.Errorf("alerting.rules %s: threshold must be positive and window at least 1s", rule.Name)
+			}
+			switch rule.Severity {
+			case "critical", "error", "warning", "info":
+			default:
+				return nil, fmt.Errorf("alerting.rules %s: severity must be critical, error, warning, or info", rule.Name)
+			}
+			for _, name := range rule.Channels {
+				if !channels[name] {
+					return nil, fmt.Errorf("alerting.rules %s: unknown channel %s", rule.Name, name)
+				}
+			}
+		}
+	}
+	if f := config.Forwarding; f.Enabled {
+		if len(f.Targets) == 0 {
+			return nil, fmt.Errorf("forwarding.targets is required when forwarding is enabled")
+		}
+		names := make(map[string]bool)
+		for i := range f.Targets {
+			target := &config.Forwarding.Targets[i]
+			if target.Name == "" || names[target.Name] {
+				return nil, fmt.Errorf("forwarding.targets entries require a unique name")
+			}
+			names[target.Name] = true
+			if err := target.EntryFilterConfig.validate("forwarding.targets "+target.Name, true); err != nil {
+				return nil, err
+			}
+			if !strings.HasPrefix(target.URL, "https://") && !strings.HasPrefix(target.URL, "http://") {
+				return nil, fmt.Errorf("forwarding.targets %s: url must be http or https", target.Name)
+			}
+			if target.Secret != "" && len(target.Secret) < 16 {
+				return nil, fmt.Errorf("forwarding.targets %s: secret must be at least 16 characters", target.Name)
+			}
+			if target.BatchSize == 0 {
+				target.BatchSize = 100
+			}
+			if target.FlushInterval == 0 {
+				target.FlushInterval = 5 * time.Second
+			}
+			if target.QueueSize == 0 {
+				target.QueueSize = 10000
+			}
+			if target.MaxRetries == 0 {
+				target.MaxRetries = 5
+			}
+			if target.Timeout == 0 {
+				target.Timeout = 10 * time.Second
+			}
+			if target.BatchSize < 0 || target.FlushInterval < 0 || target.QueueSize < target.BatchSize || target.MaxRetries < 0 || target.Timeout < 0 {
+				return nil, fmt.Errorf("forwarding.targets %s: batch_size, flush_interval, max_retries, and timeout must be positive and queue_size at least batch_size", target.Name)
+			}
+		}
+	}
+	if k := config.Kafka; k.Enabled {
+		if len(k.Brokers) == 0 {
+			return nil, fmt.Errorf("kafka.brokers is required when kafka is enabled")
+		}
+		if k.Topic == "" {
+			return nil, fmt.Errorf("kafka.topic is required when kafka is enabled")
+		}
+		if err := k.EntryFilterConfig.validate("kafka", false); err != nil {
+			return nil, err
+		}
+		switch k.Compression {
+		case "none", "gzip", "snappy", "lz4", "zstd":
+		default:
+			return nil, fmt.Errorf("kafka.compression must be none, gzip, snappy, lz4, or zstd")
+		}
+		switch k.RequiredAcks {
+		case "none", "leader", "all":
+		default:
+			return nil, fmt.Errorf("kafka.required_acks must be none, leader, or all")
+		}
+		if k.BatchSize <= 0 || k.FlushInterval <= 0 || k.QueueSize < k.BatchSize || k.MaxRetries < 0 || k.Timeout <= 0 {
+			return nil, fmt.Errorf("kafka.batch_size, flush_interval, and timeout must be positive and queue_size at least batch_size")
+		}
+		if (k.TLS.ClientCert == "") != (k.TLS.ClientKey == "") {
+			return nil, fmt.Errorf("kafka.tls.client_cert and kafka.tls.client_key must be set together")
+		}
+		if k.TLS.KeyPassphraseFile != "" && k.TLS.KeyPassphraseEnv != "" {
+			return nil, fmt.Errorf("kafka.tls.key_passphrase_file and kafka.tls.key_passphrase_env are mutually exclusive")
+		}
+		switch k.SASL.Mechanism {
+		case "":
+		case "plain", "scram-sha-256", "scram-sha-512":
+			if k.SASL.Username == "" {
+				return nil, fmt.Errorf("kafka.sasl.username is required when kafka.sasl.mechanism is set")
+			}
+		default:
+			return nil, fmt.Errorf("kafka.sasl.mechanism must be plain, scram-sha-256, or scram-sha-512")
+		}
+	}
+	if n := config.NATS; n.Enabled {
+		if n.URL == "" || n.Subject == "" {
+			return nil, fmt.Errorf("nats.url and nats.subject are required when nats is enabled")
+		}
+		for i := range n.Routes {
+			route := &config.NATS.Routes[i]
+			if route.Subject == "" {
+				route.Subject = n.Subject
+			}
+			if err := route.EntryFilterConfig.validate(fmt.Sprintf("nats.routes[%d]", i), false); err != nil {
+				return nil, err
+			}
+		}
+		if n.Stream.MaxAge < 0 {
+			return nil, fmt.Errorf("nats.stream.max_age must not be negative")
+		}
+		if n.BatchSize <= 0 || n.FlushInterval <= 0 || n.QueueSize < n.BatchSize || n.MaxRetries < 0 || n.Timeout <= 0 {
+			return nil, fmt.Errorf("nats.batch_size, flush_interval, and timeout must be positive and queue_size at least batch_size")
+		}
+		if (n.TLS.ClientCert == "") != (n.TLS.ClientKey == "") {
+			return nil, fmt.Errorf("nats.tls.client_cert and nats.tls.client_key must be set together")
+		}
+		if n.TLS.KeyPassphraseFile != "" && n.TLS.KeyPassphraseEnv != "" {
+			return nil, fmt.Errorf("nats.tls.key_passphrase_file and nats.tls.key_passphrase_env are mutually exclusive")
+		}
+		if n.CredsFile != "" && (n.Token != "" || n.Username != "") {
+			return nil, fmt.Errorf("nats.creds_file, nats.token, and nats.username are mutually exclusive")
+		}
+		if n.Token != "" && n.Username != "" {
+			return nil, fmt.Errorf("nats.token and nats.username are mutually exclusive")
+		}
+	}
+	if config.Routing.Enabled {
+		if err := validateRouting(&config); err != nil {
+			return nil, err
+		}
+	}
+	if config.Rollups.Enabled && (config.Rollups.Collection == "" || config.Rollups.FlushInterval <= 0) {
+		return nil, fmt.Errorf("rollups.collection and a positive rollups.flush_interval are required when rollups are enabled")
+	}
+	if m := config.MetricsHistory; m.Enabled && (m.Collection == "" || m.Interval < time.Second || m.RetentionDays < 0) {
+		return nil, fmt.Errorf("metrics_history.collection, an interval of at least 1s, and a non-negative retention_days are required when metrics history is enabled")
+	}
+	if m := config.Maintenance; m.Enabled {
+		if m.RefreshInterval <= 0 || m.MaxDuration <= 0 {
+			return nil, fmt.Errorf("maintenance.refresh_interval and max_duration must be positive")
+		}
+		for _, w := range m.Windows {
+			if w.Service == "" && w.Hostname == "" {
+				return nil, fmt.Errorf("maintenance.windows entries require a service or hostname")
+			}
+			if w.SampleRate < 0 || w.SampleRate > 1 {
+				return nil, fmt.Errorf("maintenance.windows sample_rate must be between 0 and 1")
+			}
+			starts, err := time.Parse(time.RFC3339, w.StartsAt)
+			if err != nil {
+				return nil, fmt.Errorf("maintenance.windows starts_at: %w", err)
+			}
+			ends, err := time.Parse(time.RFC3339, w.EndsAt)
+			if err != nil {
+				return nil, fmt.Errorf("maintenance.windows ends_at: %w", err)
+			}
+			if !ends.After(starts) {
+				return nil, fmt.Errorf("maintenance.windows ends_at must be after starts_at")
+			}
+		}
+	}
+	if d := config.PatternDiff; d.SampleSize <= 0 || d.MaxPatterns <= 0 || d.MinRatio <= 1 {
+		return nil, fmt.Errorf("pattern_diff.sample_size and max_patterns must be positive and min_ratio greater than 1")
+	}
+	if config.Relabel.BatchSize <= 0 || config.Relabel.MaxDocsPerSecond <= 0 {
+		return nil, fmt.Errorf("relabel.batch_size and max_docs_per_second must be positive")
+	}
+	if b := config.BulkWriter; b.Enabled && (b.MaxDocs <= 0 || b.MaxDelay <= 0 || b.WriteTimeout <= 0) {
+		return nil, fmt.Errorf("bulk_writer.max_docs, max_delay, and write_timeout must be positive when the bulk writer is enabled")
+	}
+	if b := config.WriteBuffer; b.Enabled && (b.MaxBatches <= 0 || b.RetryInterval <= 0 || b.InsertTimeout <= 0) {
+		return nil, fmt.Errorf("write_buffer.max_batches, retry_interval, and insert_timeout must be positive when the write buffer is enabled")
+	}
+	if c := config.CertMonitor; c.Enabled && (c.WarnDays <= 0 || c.CheckInterval <= 0) {
+		return nil, fmt.Errorf("cert_monitor.warn_days and cert_monitor.check_interval must be positive when certificate monitoring is enabled")
+	}
+	if d := config.Dedup; d.Enabled && (d.Collection == "" || d.Window < time.Second || d.PendingTimeout <= 0) {
+		return nil, fmt.Errorf("dedup.collection, a dedup.window of at least 1s, and a positive dedup.pending_timeout are required when dedup is enabled")
+	}
+	if d := config.Delivery; d.Enabled && (d.Collection == "" || d.GapGrace <= 0 || d.CheckInterval <= 0) {
+		return nil, fmt.Errorf("delivery.collection and positive delivery.gap_grace and delivery.check_interval are required when delivery tracking is enabled")
+	}
+	if d := config.Compression.Dictionaries; d.Enabled {
+		if d.SampleSize < 500 || d.DictSize < 1024 || d.RetrainInterval <= 0 {
+			return nil, fmt.Errorf("compression.dictionaries requires sample_size >= 500, dict_size >= 1024, and a positive retrain_interval")
+		}
+	}
+	if a := config.Autocomplete; a.Enabled && (a.SampleSize <= 0 || a.MaxValues <= 0 || a.CacheTTL < 0) {
+		return nil, fmt.Errorf("autocomplete.sample_size and max_values must be positive and cache_ttl non-negative when autocomplete is enabled")
+	}
+	if config.QueryAudit.Enabled && config.QueryAudit.Collection == "" {
+		return nil, fmt.Errorf("query_audit.collection is required when query auditing is enabled")
+	}
+	if config.QueryAudit.ExplainInterval < 0 {
+		return nil, fmt.Errorf("query_audit.explain_interval must not be negative")
+	}
+	if r := config.Region; r.Name == "" && (r.RejectForeign || r.PinQueries) {
+		return nil, fmt.Errorf("region.name is required for region.reject_foreign and region.pin_queries")
 	}
 
 	return &config, nil
 }
+
+// validate checks a service's throttling settings and defaults its burst
+// to one second of entries
+func (t *ServiceThrottleConfig) validate(name string) error {
+	if t.EntriesPerSecond < 0 || t.Burst < 0 {
+		return fmt.Errorf("%s: entries_per_second and burst must not be negative", name)
+	}
+	if t.Burst == 0 {
+		t.Burst = int64(math.Ceil(t.EntriesPerSecond))
+	}
+	for level, n := range t.Sample {
+		switch level {
+		case "trace", "debug", "info", "warn", "error", "fatal":
+		default:
+			return fmt.Errorf("%s.sample: unknown level %q", name, level)
+		}
+		if n < 1 {
+			return fmt.Errorf("%s.sample.%s must be at least 1", name, level)
+		}
+	}
+	return nil
+}
+
+// validateTenancy checks that tenants are uniquely named and recognized,
+// and defaults each tenant's OUs to its name
+func validateTenancy(config *ServerConfig) error {
+	t := &config.Tenancy
+	if t.Collection == "" || t.QuotaWindow <= 0 || t.RefreshInterval <= 0 {
+		return fmt.Errorf("tenancy.collection, tenancy.quota_window, and tenancy.refresh_interval are required")
+	}
+	if len(t.Tenants) == 0 {
+		return fmt.Errorf("tenancy.tenants must list at least one tenant")
+	}
+
+	names := make(map[string]bool)
+	ous := make(map[string]string)
+	keyIDs := make(map[string]bool)
+	keys := make(map[string]bool)
+	hasKeys := false
+	for i := range t.Tenants {
+		tenant := &t.Tenants[i]
+		if tenant.Name == "" || names[tenant.Name] {
+			return fmt.Errorf("tenancy.tenants entries require a unique name")
+		}
+		names[tenant.Name] = true
+		if tenant.Quota < 0 || tenant.TTLDays < 0 {
+			return fmt.Errorf("tenancy.tenants %s: quota and ttl_days must not be negative", tenant.Name)
+		}
+		if len(tenant.OUs) == 0 {
+			tenant.OUs = []string{tenant.Name}
+		}
+		for _, ou := range tenant.OUs {
+			if other, ok := ous[ou]; ok {
+				return fmt.Errorf("tenancy.tenants %s: OU %q is already mapped to %s", tenant.Name, ou, other)
+			}
+			ous[ou] = tenant.Name
+		}
+		for _, key := range tenant.APIKeys {
+			if key.ID == "" || keyIDs[key.ID] {
+				return fmt.Errorf("tenancy.tenants %s: api_keys entries require a unique id", tenant.Name)
+			}
+			if len(key.Key) < 32 || keys[key.Key] {
+				return fmt.Errorf("tenancy.tenants %s: api key %s must be unique and at least 32 characters", tenant.Name, key.ID)
+			}
+			keyIDs[key.ID] = true
+			keys[key.Key] = true
+			hasKeys = true
+		}
+	}
+	for _, admin := range t.AdminTenants {
+		if !names[admin] {
+			return fmt.Errorf("tenancy.admin_tenants: unknown tenant %q", admin)
+		}
+	}
+	if !config.MTLS.Enabled && !hasKeys {
+		return fmt.Errorf("tenancy requires mtls or tenant api_keys, since clients are recognized by certificate OU or API key")
+	}
+	return nil
+}
+
+// validateRouting checks that routing rules name known sinks and fills in
+// sink defaults
+func validateRouting(config *ServerConfig) error {
+	builtin := map[string]bool{
+		"mongo": true,
+		"kafka": config.Kafka.Enabled,
+		"nats":  config.NATS.Enabled,
+		"drop":  true,
+	}
+	sinks := make(map[string]bool)
+	for i := range config.Routing.Sinks {
+		sink := &config.Routing.Sinks[i]
+		if sink.Name == "" || sinks[sink.Name] {
+			return fmt.Errorf("routing.sinks entries require a unique name")
+		}
+		if _, ok := builtin[sink.Name]; ok {
+			return fmt.Errorf("routing.sinks %s: name is reserved", sink.Name)
+		}
+		sinks[sink.Name] = true
+
+		switch sink.Type {
+		case "file":
+			if sink.Path == "" {
+				return fmt.Errorf("routing.sinks %s: path is required for file sinks", sink.Name)
+			}
+		case "s3":
+			if sink.Bucket == "" || sink.Region == "" {
+				return fmt.Errorf("routing.sinks %s: bucket and region are required for s3 sinks", sink.Name)
+			}
+		default:
+			return fmt.Errorf("routing.sinks %s: type must be file or s3", sink.Name)
+		}
+		if sink.BatchSize == 0 {
+			sink.BatchSize = 1000
+		}
+		if sink.FlushInterval == 0 {
+			sink.FlushInterval = 10 * time.Second
+		}
+		if sink.QueueSize == 0 {
+			sink.QueueSize = 100000
+		}
+		if sink.MaxRetries == 0 {
+			sink.MaxRetries = 5
+		}
+		if sink.Timeout == 0 {
+			sink.Timeout = 30 * time.Second
+		}
+		if sink.BatchSize < 0 || sink.FlushInterval < 0 || sink.QueueSize < sink.BatchSize || sink.MaxRetries < 0 || sink.Timeout < 0 {
+			return fmt.Errorf("routing.sinks %s: batch_size, flush_interval, max_retries, and timeout must be positive and queue_size at least batch_size", sink.Name)
+		}
+	}
+
+	checkSinks := func(name string, targets []string) error {
+		if len(targets) == 0 {
+			return fmt.Errorf("%s: sinks are required", name)
+		}
+		for _, target := range targets {
+			enabled, ok := builtin[target]
+			switch {
+			case ok && !enabled:
+				return fmt.Errorf("%s: sink %s requires %s.enabled", name, target, target)
+			case !ok && !sinks[target]:
+				return fmt.Errorf("%s: unknown sink %s", name, target)
+			case target == "drop" && len(targets) > 1:
+				return fmt.Errorf("%s: drop cannot be combined with other sinks", name)
+			}
+		}
+		return nil
+	}
+
+	if len(config.Routing.Default) == 0 {
+		config.Routing.Default = []string{"mongo"}
+	}
+	if err := checkSinks("routing.default", config.Routing.Default); err != nil {
+		return err
+	}
+	names := make(map[string]bool)
+	for _, rule := range config.Routing.Rules {
+		if rule.Name == "" || names[rule.Name] {
+			return fmt.Errorf("routing.rules entries require a unique name")
+		}
+		names[rule.Name] = true
+		if err := rule.EntryFilterConfig.validate("routing.rules "+rule.Name, false); err != nil {
+			return err
+		}
+		if err := checkSinks("routing.rules "+rule.Name, rule.Sinks); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateRevocation checks that revocation checking has one CRL source or
+// OCSP, and a known failure mode. An OCSP URL implies OCSP.
+func validateRevocation(r *RevocationConfig) error {
+	if !r.Enabled {
+		return nil
+	}
+	if r.OCSPURL != "" {
+		r.OCSP = true
+	}
+	if r.CRLFile != "" && r.CRLURL != "" {
+		return fmt.Errorf("mtls.revocation takes crl_file or crl_url, not both")
+	}
+	if r.CRLFile == "" && r.CRLURL == "" && !r.OCSP {
+		return fmt.Errorf("mtls.revocation requires crl_file, crl_url, or ocsp")
+	}
+	if r.FailMode != "open" && r.FailMode != "closed" {
+		return fmt.Errorf("mtls.revocation.fail_mode must be open or closed")
+	}
+	if r.CacheTTL <= 0 || r.RefreshInterval <= 0 || r.Timeout <= 0 {
+		return fmt.Errorf("mtls.revocation.cache_ttl, refresh_interval, and timeout must be positive")
+	}
+	return nil
+}
@@ -2,59 +2,290 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/oicur0t/logl/pkg/redact"
 	"github.com/spf13/viper"
 )
 
-// LogFileConfig represents a single log file to tail
+// LogFileConfig represents a log file, glob, or directory to tail
 type LogFileConfig struct {
-	Path        string `mapstructure:"path"`
+	Path         string            `mapstructure:"path"` // File path, glob (/var/log/app/*.log), or directory
+	Enabled      bool              `mapstructure:"enabled"`
+	ServiceName  string            `mapstructure:"service_name"` // Optional override, defaults to global service_name
+	Framing      string            `mapstructure:"framing"`      // line (default) or json for multi-line JSON documents
+	Include      []string          `mapstructure:"include"`      // Regexes; if set, only matching lines are shipped
+	Exclude      []string          `mapstructure:"exclude"`      // Regexes; matching lines are dropped
+	Labels       map[string]string `mapstructure:"labels"`       // Labels added to entries from this file, e.g. component: api
+	Backpressure string            `mapstructure:"backpressure"` // Overrides backpressure.policy for this file
+	Backfill     bool              `mapstructure:"backfill"`     // Ship rotated files (including .gz and .zst) and the whole file when first seen
+	ReadFrom     string            `mapstructure:"read_from"`    // end (default) ships only new lines of a file first seen; beginning ships its existing content too
+}
+
+// EventLogConfig represents a Windows Event Log channel to subscribe to
+type EventLogConfig struct {
+	Channel     string `mapstructure:"channel"` // e.g. Application, System, Security
+	Query       string `mapstructure:"query"`   // Optional XPath filter, defaults to all events
 	Enabled     bool   `mapstructure:"enabled"`
 	ServiceName string `mapstructure:"service_name"` // Optional override, defaults to global service_name
 }
 
+// ListenerConfig represents a TCP or Unix socket accepting newline-delimited log lines
+type ListenerConfig struct {
+	Network     string `mapstructure:"network"` // tcp, tcp4, tcp6, or unix
+	Address     string `mapstructure:"address"` // host:port or socket path
+	Enabled     bool   `mapstructure:"enabled"`
+	ServiceName string `mapstructure:"service_name"` // Optional override, defaults to global service_name
+}
+
+// GeneratorConfig represents a synthetic log line source for demos and load tests
+type GeneratorConfig struct {
+	Format      string  `mapstructure:"format"` // json, apache, or random
+	Rate        float64 `mapstructure:"rate"`   // Lines per second
+	Count       int64   `mapstructure:"count"`  // Stop after this many lines, 0 for unlimited
+	Enabled     bool    `mapstructure:"enabled"`
+	ServiceName string  `mapstructure:"service_name"` // Optional override, defaults to global service_name
+}
+
+// CloudWatchConfig represents a CloudWatch Logs log group polled for events
+type CloudWatchConfig struct {
+	LogGroup      string        `mapstructure:"log_group"`
+	StreamPrefix  string        `mapstructure:"stream_prefix"`  // Optional log stream name prefix
+	FilterPattern string        `mapstructure:"filter_pattern"` // Optional CloudWatch filter pattern
+	Region        string        `mapstructure:"region"`         // Defaults to AWS_REGION or AWS_DEFAULT_REGION
+	Endpoint      string        `mapstructure:"endpoint"`       // Optional, e.g. a VPC endpoint
+	PollInterval  time.Duration `mapstructure:"poll_interval"`
+	Overlap       time.Duration `mapstructure:"overlap"`  // Reread before the checkpoint to catch late events
+	Lookback      time.Duration `mapstructure:"lookback"` // How far back the first poll starts without a checkpoint
+	Enabled       bool          `mapstructure:"enabled"`
+	ServiceName   string        `mapstructure:"service_name"` // Optional override, defaults to global service_name
+}
+
+// SNMPTrapConfig represents a UDP address receiving SNMP traps
+type SNMPTrapConfig struct {
+	Address     string           `mapstructure:"address"`     // UDP host:port, e.g. :162
+	Communities []string         `mapstructure:"communities"` // Accepted v2c communities; empty accepts any
+	Users       []SNMPUserConfig `mapstructure:"users"`       // SNMPv3 users; v3 traps from others are dropped
+	MIBs        []string         `mapstructure:"mibs"`        // MIB files or directories used to name OIDs
+	Enabled     bool             `mapstructure:"enabled"`
+	ServiceName string           `mapstructure:"service_name"` // Optional override, defaults to global service_name
+}
+
+// SNMPUserConfig represents an SNMPv3 user traps are accepted from
+type SNMPUserConfig struct {
+	Username       string `mapstructure:"username"`
+	AuthProtocol   string `mapstructure:"auth_protocol"` // md5, sha, sha224, sha256, sha384, or sha512; empty for noAuthNoPriv
+	AuthPassphrase string `mapstructure:"auth_passphrase"`
+	PrivProtocol   string `mapstructure:"priv_protocol"` // des or aes (AES-128); empty for authNoPriv
+	PrivPassphrase string `mapstructure:"priv_passphrase"`
+}
+
+// HostEventsConfig enables the Linux host-events input, which ships kernel
+// OOM kills, segfaults, coredumps, and reboots under the reserved
+// host-events service
+type HostEventsConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	CoredumpDir  string        `mapstructure:"coredump_dir"`  // systemd-coredump storage; empty disables coredump events
+	PollInterval time.Duration `mapstructure:"poll_interval"` // How often coredump_dir is scanned
+}
+
+// MetadataConfig holds labels attached to every entry the tailer ships
+type MetadataConfig struct {
+	Labels                    map[string]string `mapstructure:"labels"`                      // Static labels
+	Env                       map[string]string `mapstructure:"env"`                         // Label -> environment variable
+	Files                     map[string]string `mapstructure:"files"`                       // Label -> file whose content is the value
+	KubernetesLabelsFile      string            `mapstructure:"kubernetes_labels_file"`      // Downward API pod labels, added as k8s_<key>
+	KubernetesAnnotationsFile string            `mapstructure:"kubernetes_annotations_file"` // Downward API pod annotations, added as k8s_annotation_<key>
+	Cloud                     string            `mapstructure:"cloud"`                       // aws, gcp, or azure instance metadata
+	CloudTimeout              time.Duration     `mapstructure:"cloud_timeout"`
+}
+
+// ProxyConfig holds egress proxy settings for reaching the server
+type ProxyConfig struct {
+	URL             string   `mapstructure:"url"` // http://, https://, or socks5:// proxy
+	Username        string   `mapstructure:"username"`
+	Password        string   `mapstructure:"password"`
+	NoProxy         []string `mapstructure:"no_proxy"`         // Hosts, domains, IPs, or CIDRs reached directly
+	FromEnvironment bool     `mapstructure:"from_environment"` // Use HTTPS_PROXY/NO_PROXY when url is unset
+}
+
 // UpstreamServerConfig holds server connection settings
 type UpstreamServerConfig struct {
-	URL          string        `mapstructure:"url"`
-	Timeout      time.Duration `mapstructure:"timeout"`
-	MaxRetries   int           `mapstructure:"max_retries"`
-	RetryBackoff time.Duration `mapstructure:"retry_backoff"`
+	URL            string               `mapstructure:"url"`
+	URLs           []string             `mapstructure:"urls"`          // Optional additional servers
+	Routing        string               `mapstructure:"routing"`       // failover or consistent_hash
+	VirtualNodes   int                  `mapstructure:"virtual_nodes"` // Ring points per server for consistent_hash
+	Timeout        time.Duration        `mapstructure:"timeout"`
+	MaxRetries     int                  `mapstructure:"max_retries"`
+	RetryBackoff   time.Duration        `mapstructure:"retry_backoff"`
+	Proxy          ProxyConfig          `mapstructure:"proxy"`
+	IPFamily       string               `mapstructure:"ip_family"`      // any, ipv4, ipv6, prefer_ipv4, or prefer_ipv6
+	FallbackDelay  time.Duration        `mapstructure:"fallback_delay"` // Happy-eyeballs delay before racing the other family
+	PinRegion      bool                 `mapstructure:"pin_region"`     // Only send to servers in the tailer's region, never failing over to others
+	CircuitBreaker CircuitBreakerConfig `mapstructure:"circuit_breaker"`
+}
+
+// CircuitBreakerConfig holds when a failing server is skipped, and how it
+// is probed before batches are sent to it again
+type CircuitBreakerConfig struct {
+	FailureThreshold int           `mapstructure:"failure_threshold"` // Consecutive failed requests that open the breaker
+	OpenTimeout      time.Duration `mapstructure:"open_timeout"`      // How long an open breaker skips the server before probing it
+	HalfOpenProbes   int           `mapstructure:"half_open_probes"`  // Requests sent at once while probing
+	SuccessThreshold int           `mapstructure:"success_threshold"` // Successful probes in a row that close the breaker
+}
+
+// ServerURLs returns all configured upstream server URLs in priority order
+func (c UpstreamServerConfig) ServerURLs() []string {
+	var urls []string
+	if c.URL != "" {
+		urls = append(urls, c.URL)
+	}
+	for _, u := range c.URLs {
+		if u != "" && u != c.URL {
+			urls = append(urls, u)
+		}
+	}
+	return urls
 }
 
 // BatchingConfig holds batching configuration
 type BatchingConfig struct {
-	MaxSize   int           `mapstructure:"max_size"`
-	MaxWait   time.Duration `mapstructure:"max_wait"`
-	QueueSize int           `mapstructure:"queue_size"`
+	MaxSize      int           `mapstructure:"max_size"`
+	MaxBytes     int           `mapstructure:"max_bytes"` // Encoded size at which a batch is sent before max_size; 0 is unlimited
+	MaxWait      time.Duration `mapstructure:"max_wait"`
+	QueueSize    int           `mapstructure:"queue_size"`
+	FlushWorkers int           `mapstructure:"flush_workers"` // Batches sent at once, one per service at a time
+	MaxPending   int           `mapstructure:"max_pending"`   // Entries buffered per service while its last batch is sent
+	DrainTimeout time.Duration `mapstructure:"drain_timeout"` // How long the final flush at shutdown may take
+}
+
+// BackpressureConfig holds what file reads do when the batcher falls
+// behind
+type BackpressureConfig struct {
+	Policy    string        `mapstructure:"policy"`     // block, drop_oldest, or drop_newest
+	Timeout   time.Duration `mapstructure:"timeout"`    // How long drop_newest waits before dropping a line
+	QueueSize int           `mapstructure:"queue_size"` // Lines drop_oldest holds before dropping the oldest
+}
+
+// TailingConfig holds how log files are watched for new lines
+type TailingConfig struct {
+	Mode         string        `mapstructure:"mode"`          // poll, inotify, or auto (inotify, polling files it can't watch)
+	PollInterval time.Duration `mapstructure:"poll_interval"` // How often polled files are checked
+	Reopen       bool          `mapstructure:"reopen"`        // Follow the path to a recreated file, as tail -F does
+}
+
+// DeadLetterConfig holds where batches the server rejects are kept, and
+// how much disk they may take
+type DeadLetterConfig struct {
+	Path           string  `mapstructure:"path"`             // JSON lines file for rejected batches; empty only logs them
+	MaxBytes       int64   `mapstructure:"max_bytes"`        // Rotates the file to path.1 past this size; 0 never rotates
+	MaxDiskPercent float64 `mapstructure:"max_disk_percent"` // Drops batches while the file's filesystem is fuller than this; 0 disables
+	Overflow       string  `mapstructure:"overflow"`         // drop_oldest replaces path.1 when rotating, drop_newest keeps it and drops new batches
+}
+
+// RedactionRuleConfig replaces regex matches before lines leave the host
+type RedactionRuleConfig struct {
+	Name        string `mapstructure:"name"`
+	Pattern     string `mapstructure:"pattern"`
+	Replacement string `mapstructure:"replacement"`
+}
+
+// RedactionConfig holds redaction settings
+type RedactionConfig struct {
+	Builtins []string              `mapstructure:"builtins"` // credit_card, email, bearer_token
+	Rules    []RedactionRuleConfig `mapstructure:"rules"`
+}
+
+// NewRedactor compiles the configured rules
+func (c RedactionConfig) NewRedactor() (*redact.Redactor, error) {
+	rules := make([]redact.Rule, len(c.Rules))
+	for i, r := range c.Rules {
+		rules[i] = redact.Rule{Name: r.Name, Pattern: r.Pattern, Replacement: r.Replacement}
+	}
+	return redact.New(c.Builtins, rules)
+}
+
+// PreParseConfig holds settings for parsing JSON lines on the host. Servers
+// that trust this tailer's certificate store its entries without parsing
+// them again.
+type PreParseConfig struct {
+	Enabled     bool     `mapstructure:"enabled"`
+	LevelFields []string `mapstructure:"level_fields"` // Parsed fields checked in order for the level, dotted paths allowed
+}
+
+// ResourcesConfig limits the tailer's own CPU and memory use, so it never
+// competes with the workload it observes
+type ResourcesConfig struct {
+	MaxProcs          int           `mapstructure:"max_procs"`            // GOMAXPROCS; 0 keeps the Go default
+	MaxMemoryMB       int64         `mapstructure:"max_memory_mb"`        // Soft memory limit, as GOMEMLIMIT; 0 keeps the Go default
+	MaxCPUPercent     float64       `mapstructure:"max_cpu_percent"`      // Of one core; file reads slow down as use nears it, 0 disables
+	MaxLinesPerSecond int           `mapstructure:"max_lines_per_second"` // Cap on file lines read; 0 is unlimited
+	CheckInterval     time.Duration `mapstructure:"check_interval"`       // How often CPU and memory use are sampled
+}
+
+// ControlConfig holds the local control API, for pausing and resuming
+// files at runtime and checking upstream servers
+type ControlConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Address string `mapstructure:"address"` // Loopback host:port; the API has no authentication
 }
 
 // MTLSConfig holds mTLS configuration
 type MTLSConfig struct {
-	CACert     string `mapstructure:"ca_cert"`
-	ClientCert string `mapstructure:"client_cert"`
-	ClientKey  string `mapstructure:"client_key"`
-	ServerName string `mapstructure:"server_name"`
+	CACert            string         `mapstructure:"ca_cert"`
+	ClientCert        string         `mapstructure:"client_cert"`
+	ClientKey         string         `mapstructure:"client_key"`
+	KeyPassphraseFile string         `mapstructure:"key_passphrase_file"` // Passphrase of an encrypted client_key
+	KeyPassphraseEnv  string         `mapstructure:"key_passphrase_env"`  // Environment variable holding it instead
+	ServerName        string         `mapstructure:"server_name"`
+	ReloadInterval    time.Duration  `mapstructure:"reload_interval"` // How often the client certificate is checked for rotation; 0 reloads on SIGHUP only
+	VaultPKI          VaultPKIConfig `mapstructure:"vault_pki"`       // Issues the client certificate from Vault instead; common_name defaults to hostname
 }
 
 // TailerConfig represents the complete tailer configuration
 type TailerConfig struct {
-	ServiceName string                `mapstructure:"service_name"`
-	Hostname    string                `mapstructure:"hostname"`
-	LogFiles    []LogFileConfig       `mapstructure:"log_files"`
-	Server      UpstreamServerConfig  `mapstructure:"server"`
-	Batching    BatchingConfig        `mapstructure:"batching"`
-	MTLS        MTLSConfig            `mapstructure:"mtls"`
-	StateFile   string                `mapstructure:"state_file"`
-	LogLevel    string                `mapstructure:"log_level"`
-	LogFormat   string                `mapstructure:"log_format"`
+	ServiceName    string               `mapstructure:"service_name"`
+	Hostname       string               `mapstructure:"hostname"`
+	AgentID        string               `mapstructure:"agent_id"`  // Identifies this tailer in delivery reports, defaults to hostname
+	EntryIDs       string               `mapstructure:"entry_ids"` // "ulid" or "uuidv7" to assign IDs before sending; empty leaves IDs to the server
+	Region         string               `mapstructure:"region"`    // Labels entries and prefers servers advertising the same region
+	LogFiles       []LogFileConfig      `mapstructure:"log_files"`
+	EventLogs      []EventLogConfig     `mapstructure:"event_logs"`
+	Listeners      []ListenerConfig     `mapstructure:"listeners"`
+	Generators     []GeneratorConfig    `mapstructure:"generators"`
+	CloudWatch     []CloudWatchConfig   `mapstructure:"cloudwatch"`
+	SNMPTraps      []SNMPTrapConfig     `mapstructure:"snmp_traps"`
+	HostEvents     HostEventsConfig     `mapstructure:"host_events"`
+	Server         UpstreamServerConfig `mapstructure:"server"`
+	Batching       BatchingConfig       `mapstructure:"batching"`
+	Backpressure   BackpressureConfig   `mapstructure:"backpressure"`
+	Tailing        TailingConfig        `mapstructure:"tailing"`
+	DeadLetter     DeadLetterConfig     `mapstructure:"dead_letter"`
+	MTLS           MTLSConfig           `mapstructure:"mtls"`
+	Secrets        SecretsConfig        `mapstructure:"secrets"`
+	Redaction      RedactionConfig      `mapstructure:"redaction"`
+	PreParse       PreParseConfig       `mapstructure:"pre_parse"`
+	Resources      ResourcesConfig      `mapstructure:"resources"`
+	Metadata       MetadataConfig       `mapstructure:"metadata"`
+	Control        ControlConfig        `mapstructure:"control"`
+	StateFile      string               `mapstructure:"state_file"`
+	RescanInterval time.Duration        `mapstructure:"rescan_interval"`
+	ReloadInterval time.Duration        `mapstructure:"reload_interval"` // How often the config file is checked for changes; 0 reloads on SIGHUP only
+	LogLevel       string               `mapstructure:"log_level"`
+	LogFormat      string               `mapstructure:"log_format"`
+}
+
+// validBackpressure reports whether policy is a backpressure policy
+func validBackpressure(policy string) bool {
+	return policy == "block" || policy == "drop_oldest" || policy == "drop_newest"
 }
 
 // LoadTailerConfig loads the tailer configuration from a file
 func LoadTailerConfig(configPath string) (*TailerConfig, error) {
 	v := viper.New()
-	v.SetConfigFile(configPath)
 	v.AutomaticEnv()
 
 	// Set defaults
@@ -62,15 +293,48 @@ func LoadTailerConfig(configPath string) (*TailerConfig, error) {
 	v.SetDefault("server.timeout", "30s")
 	v.SetDefault("server.max_retries", 5)
 	v.SetDefault("server.retry_backoff", "1s")
+	v.SetDefault("server.routing", "failover")
+	v.SetDefault("server.virtual_nodes", 100)
+	v.SetDefault("server.ip_family", "any")
+	v.SetDefault("server.fallback_delay", "300ms")
+	v.SetDefault("server.circuit_breaker.failure_threshold", 5)
+	v.SetDefault("server.circuit_breaker.open_timeout", "60s")
+	v.SetDefault("server.circuit_breaker.half_open_probes", 1)
+	v.SetDefault("server.circuit_breaker.success_threshold", 2)
+	v.SetDefault("mtls.reload_interval", "1m")
+	setSecretsDefaults(v)
 	v.SetDefault("batching.max_size", 100)
+	v.SetDefault("batching.max_bytes", 1<<20)
 	v.SetDefault("batching.max_wait", "5s")
 	v.SetDefault("batching.queue_size", 1000)
+	v.SetDefault("batching.flush_workers", 4)
+	v.SetDefault("batching.max_pending", 10000)
+	v.SetDefault("batching.drain_timeout", "10s")
+	v.SetDefault("backpressure.policy", "drop_newest")
+	v.SetDefault("backpressure.timeout", "5s")
+	v.SetDefault("backpressure.queue_size", 1000)
+	v.SetDefault("tailing.mode", "poll")
+	v.SetDefault("tailing.poll_interval", "250ms")
+	v.SetDefault("tailing.reopen", true)
+	v.SetDefault("dead_letter.path", "/var/lib/logl/dead-letter.jsonl")
+	v.SetDefault("dead_letter.max_bytes", 100<<20)
+	v.SetDefault("dead_letter.max_disk_percent", 90)
+	v.SetDefault("dead_letter.overflow", "drop_oldest")
+	v.SetDefault("pre_parse.enabled", false)
+	v.SetDefault("pre_parse.level_fields", []string{"level", "severity", "lvl", "log.level"})
+	v.SetDefault("resources.check_interval", "1s")
+	v.SetDefault("metadata.cloud_timeout", "2s")
+	v.SetDefault("host_events.coredump_dir", "/var/lib/systemd/coredump")
+	v.SetDefault("host_events.poll_interval", "10s")
+	v.SetDefault("control.enabled", false)
+	v.SetDefault("control.address", "127.0.0.1:7071")
 	v.SetDefault("state_file", "/var/lib/logl/tailer-state.json")
+	v.SetDefault("rescan_interval", "10s")
 	v.SetDefault("log_level", "info")
 	v.SetDefault("log_format", "json")
 
-	if err := v.ReadInConfig(); err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+	if err := readConfig(v, configPath); err != nil {
+		return nil, err
 	}
 
 	var config TailerConfig
@@ -82,16 +346,303 @@ func LoadTailerConfig(configPath string) (*TailerConfig, error) {
 	if config.ServiceName == "" {
 		return nil, fmt.Errorf("service_name is required")
 	}
-	if config.Server.URL == "" {
-		return nil, fmt.Errorf("server.url is required")
+	if len(config.Server.ServerURLs()) == 0 {
+		return nil, fmt.Errorf("server.url or server.urls is required")
+	}
+	if config.Server.Routing != "failover" && config.Server.Routing != "consistent_hash" {
+		return nil, fmt.Errorf("server.routing must be failover or consistent_hash")
+	}
+	if cb := config.Server.CircuitBreaker; cb.FailureThreshold < 1 || cb.HalfOpenProbes < 1 || cb.SuccessThreshold < 1 {
+		return nil, fmt.Errorf("server.circuit_breaker thresholds and half_open_probes must be at least 1")
+	}
+	if config.Server.CircuitBreaker.OpenTimeout <= 0 {
+		return nil, fmt.Errorf("server.circuit_breaker.open_timeout must be positive")
+	}
+	if config.Server.PinRegion && config.Region == "" {
+		return nil, fmt.Errorf("region is required for server.pin_region")
+	}
+	if len(config.LogFiles) == 0 && len(config.EventLogs) == 0 && len(config.Listeners) == 0 && len(config.Generators) == 0 && len(config.CloudWatch) == 0 && len(config.SNMPTraps) == 0 && !config.HostEvents.Enabled {
+		return nil, fmt.Errorf("at least one log file, event log, listener, generator, CloudWatch log group, SNMP trap receiver, or host_events must be configured")
+	}
+	if config.Batching.MaxBytes < 0 {
+		return nil, fmt.Errorf("batching.max_bytes must not be negative")
 	}
-	if len(config.LogFiles) == 0 {
-		return nil, fmt.Errorf("at least one log file must be configured")
+	if config.Batching.FlushWorkers < 1 {
+		return nil, fmt.Errorf("batching.flush_workers must be at least 1")
+	}
+	if config.Batching.MaxPending < config.Batching.MaxSize {
+		return nil, fmt.Errorf("batching.max_pending must be at least batching.max_size")
+	}
+	if config.Batching.DrainTimeout <= 0 {
+		return nil, fmt.Errorf("batching.drain_timeout must be positive")
+	}
+	if config.DeadLetter.MaxBytes < 0 {
+		return nil, fmt.Errorf("dead_letter.max_bytes must not be negative")
+	}
+	if p := config.DeadLetter.MaxDiskPercent; p < 0 || p > 100 {
+		return nil, fmt.Errorf("dead_letter.max_disk_percent must be between 0 and 100")
+	}
+	if o := config.DeadLetter.Overflow; o != "drop_oldest" && o != "drop_newest" {
+		return nil, fmt.Errorf("dead_letter.overflow must be drop_oldest or drop_newest")
+	}
+	if config.Control.Enabled {
+		host, _, err := net.SplitHostPort(config.Control.Address)
+		if err != nil {
+			return nil, fmt.Errorf("control.address: %w", err)
+		}
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			return nil, fmt.Errorf("control.address must be a loopback address, since the control API has no authentication")
+		}
+	}
+	if config.HostEvents.Enabled && config.HostEvents.PollInterval <= 0 {
+		return nil, fmt.Errorf("host_events.poll_interval must be positive")
+	}
+	if err := checkReservedServices(&config); err != nil {
+		return nil, err
+	}
+	if !validBackpressure(config.Backpressure.Policy) {
+		return nil, fmt.Errorf("backpressure.policy must be block, drop_oldest, or drop_newest")
+	}
+	if config.Backpressure.Timeout < 0 || config.Backpressure.QueueSize < 1 {
+		return nil, fmt.Errorf("backpressure.timeout must not be negative and backpressure.queue_size must be at least 1")
+	}
+	switch config.Tailing.Mode {
+	case "poll", "inotify", "auto":
+	default:
+		return nil, fmt.Errorf("tailing.mode must be poll, inotify, or auto")
+	}
+	if config.Tailing.PollInterval <= 0 {
+		return nil, fmt.Errorf("tailing.poll_interval must be positive")
+	}
+	for _, lf := range config.LogFiles {
+		if lf.Framing != "" && lf.Framing != "line" && lf.Framing != "json" {
+			return nil, fmt.Errorf("log_files framing for %s must be line or json", lf.Path)
+		}
+		if lf.Backpressure != "" && !validBackpressure(lf.Backpressure) {
+			return nil, fmt.Errorf("log_files backpressure for %s must be block, drop_oldest, or drop_newest", lf.Path)
+		}
+		if lf.ReadFrom != "" && lf.ReadFrom != "beginning" && lf.ReadFrom != "end" {
+			return nil, fmt.Errorf("log_files read_from for %s must be beginning or end", lf.Path)
+		}
+	}
+	for _, l := range config.Listeners {
+		switch l.Network {
+		case "tcp", "tcp4", "tcp6", "unix":
+		default:
+			return nil, fmt.Errorf("listeners network must be tcp, tcp4, tcp6, or unix")
+		}
+		if l.Address == "" {
+			return nil, fmt.Errorf("listeners entries require an address")
+		}
+	}
+	for _, g := range config.Generators {
+		if g.Format != "json" && g.Format != "apache" && g.Format != "random" {
+			return nil, fmt.Errorf("generators format must be json, apache, or random")
+		}
+		if g.Rate <= 0 {
+			return nil, fmt.Errorf("generators rate must be positive")
+		}
+	}
+	for i := range config.CloudWatch {
+		cw := &config.CloudWatch[i]
+		if cw.LogGroup == "" {
+			return nil, fmt.Errorf("cloudwatch entries require a log_group")
+		}
+		if cw.Region == "" {
+			cw.Region = os.Getenv("AWS_REGION")
+		}
+		if cw.Region == "" {
+			cw.Region = os.Getenv("AWS_DEFAULT_REGION")
+		}
+		if cw.Region == "" {
+			return nil, fmt.Errorf("cloudwatch log group %s requires a region", cw.LogGroup)
+		}
+		if cw.PollInterval == 0 {
+			cw.PollInterval = 30 * time.Second
+		}
+		if cw.Overlap == 0 {
+			cw.Overlap = 5 * time.Minute
+		}
+		if cw.PollInterval < 0 || cw.Overlap < 0 || cw.Lookback < 0 {
+			return nil, fmt.Errorf("cloudwatch durations for %s must not be negative", cw.LogGroup)
+		}
+	}
+	for _, st := range config.SNMPTraps {
+		if st.Address == "" {
+			return nil, fmt.Errorf("snmp_traps entries require an address")
+		}
+		for _, u := range st.Users {
+			if err := validateSNMPUser(u); err != nil {
+				return nil, fmt.Errorf("snmp_traps %s: %w", st.Address, err)
+			}
+		}
+	}
+	for _, el := range config.EventLogs {
+		if el.Channel == "" {
+			return nil, fmt.Errorf("event_logs entries require a channel")
+		}
+	}
+	if r := config.Resources; r.MaxProcs < 0 || r.MaxMemoryMB < 0 || r.MaxCPUPercent < 0 || r.MaxLinesPerSecond < 0 {
+		return nil, fmt.Errorf("resources limits must not be negative")
+	}
+	if config.Resources.CheckInterval < 100*time.Millisecond {
+		return nil, fmt.Errorf("resources.check_interval must be at least 100ms")
+	}
+	switch config.Metadata.Cloud {
+	case "", "aws", "gcp", "azure":
+	default:
+		return nil, fmt.Errorf("metadata.cloud must be aws, gcp, or azure")
+	}
+	if config.Hostname == "" {
+		config.Hostname = getHostname() // e.g. "${HOSTNAME:-}" with HOSTNAME unset
+	}
+	if config.AgentID == "" {
+		config.AgentID = config.Hostname
+	}
+	switch config.EntryIDs {
+	case "", "ulid", "uuidv7":
+	default:
+		return nil, fmt.Errorf("entry_ids must be ulid or uuidv7")
+	}
+	if config.RescanInterval <= 0 {
+		return nil, fmt.Errorf("rescan_interval must be positive")
+	}
+	if config.ReloadInterval < 0 {
+		return nil, fmt.Errorf("reload_interval must not be negative")
+	}
+	if config.MTLS.ReloadInterval < 0 {
+		return nil, fmt.Errorf("mtls.reload_interval must not be negative")
+	}
+	if config.MTLS.KeyPassphraseFile != "" && config.MTLS.KeyPassphraseEnv != "" {
+		return nil, fmt.Errorf("mtls.key_passphrase_file and mtls.key_passphrase_env are mutually exclusive")
+	}
+	if config.MTLS.VaultPKI.Role != "" && config.MTLS.VaultPKI.CommonName == "" {
+		config.MTLS.VaultPKI.CommonName = config.Hostname
+	}
+	if err := validateSecrets(&config.Secrets, &config.MTLS.VaultPKI); err != nil {
+		return nil, err
 	}
 
 	return &config, nil
 }
 
+// validateSNMPUser checks an SNMPv3 user's protocols and passphrases
+func validateSNMPUser(u SNMPUserConfig) error {
+	if u.Username == "" {
+		return fmt.Errorf("users entries require a username")
+	}
+	switch strings.ToLower(u.AuthProtocol) {
+	case "":
+		if u.PrivProtocol != "" {
+			return fmt.Errorf("user %s: priv_protocol requires auth_protocol", u.Username)
+		}
+		return nil
+	case "md5", "sha", "sha224", "sha256", "sha384", "sha512":
+	default:
+		return fmt.Errorf("user %s: auth_protocol must be md5, sha, sha224, sha256, sha384, or sha512", u.Username)
+	}
+	// RFC 3414 requires passphrases of at least 8 characters
+	if len(u.AuthPassphrase) < 8 {
+		return fmt.Errorf("user %s: auth_passphrase must be at least 8 characters", u.Username)
+	}
+	switch strings.ToLower(u.PrivProtocol) {
+	case "":
+	case "des", "aes":
+		if len(u.PrivPassphrase) < 8 {
+			return fmt.Errorf("user %s: priv_passphrase must be at least 8 characters", u.Username)
+		}
+	default:
+		return fmt.Errorf("user %s: priv_protocol must be des or aes", u.Username)
+	}
+	return nil
+}
+
+// HostEventsService is the service host events are shipped under. Other
+// inputs can't use it, so its entries always come from the host-events input.
+const HostEventsService = "host-events"
+
+// checkReservedServices rejects inputs shipping under HostEventsService
+func checkReservedServices(config *TailerConfig) error {
+	names := []string{config.ServiceName}
+	for _, lf := range config.LogFiles {
+		names = append(names, lf.ServiceName)
+	}
+	for _, el := range config.EventLogs {
+		names = append(names, el.ServiceName)
+	}
+	for _, l := range config.Listeners {
+		names = append(names, l.ServiceName)
+	}
+	for _, g := range config.Generators {
+		names = append(names, g.ServiceName)
+	}
+	for _, cw := range config.CloudWatch {
+		names = append(names, cw.ServiceName)
+	}
+	for _, st := range config.SNMPTraps {
+		names = append(names, st.ServiceName)
+	}
+	for _, name := range names {
+		if strings.EqualFold(name, HostEventsService) {
+			return fmt.Errorf("service name %s is reserved for host_events", HostEventsService)
+		}
+	}
+	return nil
+}
+
+// NewStdinTailerConfig builds a configuration for one-shot stdin shipping,
+// which runs without a config file or state tracking
+func NewStdinTailerConfig(serviceName, hostname, serverURL string, labels map[string]string, mtls MTLSConfig) (*TailerConfig, error) {
+	if serviceName == "" {
+		return nil, fmt.Errorf("service name is required")
+	}
+	if serverURL == "" {
+		return nil, fmt.Errorf("server URL is required")
+	}
+	if mtls.KeyPassphraseFile != "" && mtls.KeyPassphraseEnv != "" {
+		return nil, fmt.Errorf("key passphrase file and variable are mutually exclusive")
+	}
+	if hostname == "" {
+		hostname = getHostname()
+	}
+
+	return &TailerConfig{
+		ServiceName: serviceName,
+		Hostname:    hostname,
+		AgentID:     hostname,
+		Server: UpstreamServerConfig{
+			URL:           serverURL,
+			Routing:       "failover",
+			VirtualNodes:  100,
+			Timeout:       30 * time.Second,
+			MaxRetries:    5,
+			RetryBackoff:  1 * time.Second,
+			Proxy:         ProxyConfig{FromEnvironment: true},
+			IPFamily:      "any",
+			FallbackDelay: 300 * time.Millisecond,
+			CircuitBreaker: CircuitBreakerConfig{
+				FailureThreshold: 5,
+				OpenTimeout:      60 * time.Second,
+				HalfOpenProbes:   1,
+				SuccessThreshold: 2,
+			},
+		},
+		Batching: BatchingConfig{
+			MaxSize:      100,
+			MaxBytes:     1 << 20,
+			MaxWait:      1 * time.Second,
+			QueueSize:    1000,
+			FlushWorkers: 4,
+			MaxPending:   10000,
+			DrainTimeout: 10 * time.Second,
+		},
+		Metadata:  MetadataConfig{Labels: labels},
+		MTLS:      mtls,
+		LogLevel:  "warn",
+		LogFormat: "text",
+	}, nil
+}
+
 func getHostname() string {
 	hostname, err := os.Hostname()
 	if err != nil {
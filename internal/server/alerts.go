@@ -0,0 +1,389 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/models"
+	"github.com/oicur0t/logl/pkg/retry"
+	"go.uber.org/zap"
+)
+
+// pagerDutyEventsURL is the PagerDuty Events API v2 endpoint used when a
+// pagerduty channel has no url
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// alertRetry bounds redelivery of a notification to a failing channel
+var alertRetry = retry.Config{
+	MaxRetries:  3,
+	InitialWait: time.Second,
+	MaxWait:     10 * time.Second,
+	Multiplier:  2.0,
+}
+
+// alertRule is a configured rule with its filter compiled
+type alertRule struct {
+	config.AlertRuleConfig
+	matcher  *entryMatcher
+	channels []config.AlertChannelConfig
+}
+
+// alertState counts a rule's matches for one service in one-second
+// buckets covering the rule's window
+type alertState struct {
+	rule         *alertRule
+	service      string
+	buckets      []alertBucket
+	count        int64
+	firing       bool
+	startedAt    time.Time
+	lastNotified time.Time
+	hostname     string // Of the latest match
+	sample       string
+}
+
+type alertBucket struct {
+	second int64
+	count  int64
+}
+
+// Alerter evaluates alerting rules against ingested entries and notifies
+// the rules' channels when they fire and resolve. Counts are kept in
+// memory, so each server alerts on the traffic it receives.
+type Alerter struct {
+	rules         []*alertRule
+	checkInterval time.Duration
+	httpClient    *http.Client
+	maintenance   *MaintenanceManager // nil when maintenance windows are disabled
+	logger        *zap.Logger
+
+	mu     sync.Mutex
+	states map[string]*alertState // By rule name and service
+}
+
+// NewAlerter creates a new alerter, compiling the rules' filters
+func NewAlerter(cfg config.AlertingConfig, logger *zap.Logger) (*Alerter, error) {
+	channels := make(map[string]config.AlertChannelConfig)
+	for _, c := range cfg.Channels {
+		if c.Type == "pagerduty" && c.URL == "" {
+			c.URL = pagerDutyEventsURL
+		}
+		channels[c.Name] = c
+	}
+
+	a := &Alerter{
+		checkInterval: cfg.CheckInterval,
+		httpClient:    &http.Client{Timeout: 10 * time.Second},
+		logger:        logger,
+		states:        make(map[string]*alertState),
+	}
+	for _, rc := range cfg.Rules {
+		matcher, err := newEntryMatcher(rc.EntryFilterConfig)
+		if err != nil {
+			return nil, fmt.Errorf("alert rule %s: %w", rc.Name, err)
+		}
+		rule := &alertRule{AlertRuleConfig: rc, matcher: matcher}
+		for _, name := range rc.Channels {
+			rule.channels = append(rule.channels, channels[name])
+		}
+		a.rules = append(a.rules, rule)
+	}
+	return a, nil
+}
+
+// SetMaintenance mutes alerts covered by maintenance windows
+func (a *Alerter) SetMaintenance(maintenance *MaintenanceManager) {
+	a.maintenance = maintenance
+}
+
+// Evaluate counts a batch's matching entries against every rule for its
+// service and fires rules that reach their threshold
+func (a *Alerter) Evaluate(batch models.LogBatch) {
+	now := time.Now()
+	for _, rule := range a.rules {
+		if !rule.matcher.matchesService(batch.ServiceName) {
+			continue
+		}
+
+		var matched int64
+		var last *models.LogEntry
+		for i := range batch.Entries {
+			if rule.matcher.matches(&batch.Entries[i]) {
+				matched++
+				last = &batch.Entries[i]
+			}
+		}
+		if matched == 0 {
+			continue
+		}
+
+		if alert, ok := a.record(rule, batch.ServiceName, matched, last, now); ok {
+			a.send(rule, alert)
+		}
+	}
+}
+
+// record adds matches to a rule's window for a service and returns the
+// alert to send, if the rule fired or is still firing past its cooldown
+func (a *Alerter) record(rule *alertRule, service string, matched int64, last *models.LogEntry, now time.Time) (models.Alert, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key := rule.Name + "\x00" + service
+	state, ok := a.states[key]
+	if !ok {
+		state = &alertState{rule: rule, service: service}
+		a.states[key] = state
+	}
+	state.add(now, matched, rule.Window)
+	state.hostname = last.Hostname
+	state.sample = last.Line
+
+	if state.count < rule.Threshold {
+		return models.Alert{}, false
+	}
+	if state.firing && now.Sub(state.lastNotified) < rule.Cooldown {
+		return models.Alert{}, false
+	}
+
+	if a.maintenance != nil {
+		if window, muted := a.maintenance.Muted(service, last.Hostname); muted {
+			a.logger.Info("Alert muted by maintenance window",
+				zap.String("rule", rule.Name),
+				zap.String("service", service),
+				zap.String("window", window.ID))
+			return models.Alert{}, false
+		}
+	}
+
+	if !state.firing {
+		state.firing = true
+		state.startedAt = now
+	}
+	state.lastNotified = now
+	return state.alert("firing"), true
+}
+
+// add counts matches in the current second and drops buckets older than the window
+func (s *alertState) add(now time.Time, matched int64, window time.Duration) {
+	second := now.Unix()
+	if n := len(s.buckets); n > 0 && s.buckets[n-1].second == second {
+		s.buckets[n-1].count += matched
+	} else {
+		s.buckets = append(s.buckets, alertBucket{second: second, count: matched})
+	}
+	s.count += matched
+	s.expire(now, window)
+}
+
+// expire drops buckets older than the window
+func (s *alertState) expire(now time.Time, window time.Duration) {
+	oldest := now.Add(-window).Unix()
+	drop := 0
+	for drop < len(s.buckets) && s.buckets[drop].second <= oldest {
+		s.count -= s.buckets[drop].count
+		drop++
+	}
+	s.buckets = s.buckets[drop:]
+}
+
+// alert describes the state as an alert with the given status
+func (s *alertState) alert(status string) models.Alert {
+	rule := s.rule
+	return models.Alert{
+		Rule:        rule.Name,
+		Service:     s.service,
+		Status:      status,
+		Severity:    rule.Severity,
+		Description: rule.Description,
+		Count:       s.count,
+		Threshold:   rule.Threshold,
+		Window:      rule.Window.String(),
+		Hostname:    s.hostname,
+		Sample:      s.sample,
+		StartedAt:   s.startedAt,
+	}
+}
+
+// Start resolves firing alerts whose counts drop below their threshold
+// until the context is cancelled
+func (a *Alerter) Start(ctx context.Context) {
+	ticker := time.NewTicker(a.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.resolve(time.Now())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// resolve sends resolve events for alerts back under their threshold and
+// forgets services with no matches left in the window
+func (a *Alerter) resolve(now time.Time) {
+	type resolved struct {
+		rule  *alertRule
+		alert models.Alert
+	}
+	var toSend []resolved
+
+	a.mu.Lock()
+	for key, state := range a.states {
+		state.expire(now, state.rule.Window)
+		if state.firing && state.count < state.rule.Threshold {
+			alert := state.alert("resolved")
+			resolvedAt := now
+			alert.ResolvedAt = &resolvedAt
+			toSend = append(toSend, resolved{rule: state.rule, alert: alert})
+			state.firing = false
+		}
+		if !state.firing && len(state.buckets) == 0 {
+			delete(a.states, key)
+		}
+	}
+	a.mu.Unlock()
+
+	for _, r := range toSend {
+		a.send(r.rule, r.alert)
+	}
+}
+
+// Firing returns the alerts currently firing, by rule and service
+func (a *Alerter) Firing() []models.Alert {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	alerts := []models.Alert{}
+	for _, state := range a.states {
+		if state.firing {
+			alerts = append(alerts, state.alert("firing"))
+		}
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].Rule != alerts[j].Rule {
+			return alerts[i].Rule < alerts[j].Rule
+		}
+		return alerts[i].Service < alerts[j].Service
+	})
+	return alerts
+}
+
+// send logs the alert and delivers it to the rule's channels in the background
+func (a *Alerter) send(rule *alertRule, alert models.Alert) {
+	a.logger.Warn("Alert",
+		zap.String("rule", alert.Rule),
+		zap.String("service", alert.Service),
+		zap.String("status", alert.Status),
+		zap.Int64("count", alert.Count))
+
+	for _, channel := range rule.channels {
+		channel := channel
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			err := retry.Do(ctx, alertRetry, func() error {
+				return a.post(ctx, channel, alert)
+			})
+			if err != nil {
+				a.logger.Error("Failed to deliver alert",
+					zap.String("channel", channel.Name),
+					zap.String("rule", alert.Rule),
+					zap.Error(err))
+			}
+		}()
+	}
+}
+
+// post sends an alert to a channel in the channel's format
+func (a *Alerter) post(ctx context.Context, channel config.AlertChannelConfig, alert models.Alert) error {
+	var payload interface{} = alert
+	switch channel.Type {
+	case "slack":
+		payload = map[string]string{"text": slackAlertText(alert)}
+	case "pagerduty":
+		payload = pagerDutyEvent(channel.RoutingKey, alert)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, channel.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", channel.Type, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned status %d", channel.Type, resp.StatusCode)
+	}
+	return nil
+}
+
+// alertSummary describes an alert in one line
+func alertSummary(alert models.Alert) string {
+	if alert.Status == "resolved" {
+		return fmt.Sprintf("%s resolved for %s", alert.Rule, alert.Service)
+	}
+	return fmt.Sprintf("%s firing for %s: %d matches in %s (threshold %d)", alert.Rule, alert.Service, alert.Count, alert.Window, alert.Threshold)
+}
+
+// slackAlertText formats an alert as a Slack incoming webhook message
+func slackAlertText(alert models.Alert) string {
+	text := "[" + alert.Severity + "] " + alertSummary(alert)
+	if alert.Status == "resolved" {
+		text = ":white_check_mark: " + alertSummary(alert)
+	}
+	if alert.Description != "" {
+		text += "\n" + alert.Description
+	}
+	if alert.Status == "firing" && alert.Sample != "" {
+		text += "\n```" + alert.Hostname + ": " + alert.Sample + "```"
+	}
+	return text
+}
+
+// pagerDutyEvent builds an Events API v2 trigger or resolve event. The
+// dedup key ties a resolve to the incident its trigger opened.
+func pagerDutyEvent(routingKey string, alert models.Alert) map[string]interface{} {
+	event := map[string]interface{}{
+		"routing_key":  routingKey,
+		"event_action": "trigger",
+		"dedup_key":    "logl/" + alert.Rule + "/" + alert.Service,
+	}
+	if alert.Status == "resolved" {
+		event["event_action"] = "resolve"
+		return event
+	}
+
+	source := alert.Hostname
+	if source == "" {
+		source = alert.Service
+	}
+	event["payload"] = map[string]interface{}{
+		"summary":        alertSummary(alert),
+		"source":         source,
+		"severity":       alert.Severity,
+		"component":      alert.Service,
+		"group":          alert.Rule,
+		"custom_details": alert,
+	}
+	return event
+}
@@ -0,0 +1,252 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+)
+
+// QueryAuditor records executed queries in an audit/slow-query collection
+// and live-tail sessions in a stream audit collection
+type QueryAuditor struct {
+	storage         *Storage
+	collection      *mongo.Collection
+	sessions        *mongo.Collection
+	slowThreshold   time.Duration
+	explainInterval time.Duration
+	logger          *zap.Logger
+
+	mu         sync.Mutex
+	samples    map[string]explainSample // Query shape -> its latest explain
+	explaining map[string]bool          // Query shapes being explained
+}
+
+// explainSample is the docs examined by one explained query of a shape
+type explainSample struct {
+	docsExamined int64
+	at           time.Time
+}
+
+// maxExplainShapes bounds how many query shapes keep an explain sample
+const maxExplainShapes = 1000
+
+// NewQueryAuditor creates a new query auditor
+func NewQueryAuditor(storage *Storage, cfg config.QueryAuditConfig, logger *zap.Logger) *QueryAuditor {
+	return &QueryAuditor{
+		storage:         storage,
+		collection:      storage.database.Collection(cfg.Collection),
+		sessions:        storage.database.Collection(cfg.SessionCollection),
+		slowThreshold:   cfg.SlowThreshold,
+		explainInterval: cfg.ExplainInterval,
+		logger:          logger,
+		samples:         make(map[string]explainSample),
+		explaining:      make(map[string]bool),
+	}
+}
+
+// auditKindExport marks audit entries recorded for exports
+const auditKindExport = "export"
+
+// Record stores an audit entry in the background so queries are not slowed
+// down. Queries other than exports, which are expected to be slow, get the
+// docs examined by explaining them or by the latest explain of their shape.
+func (a *QueryAuditor) Record(entry models.QueryAuditEntry, duration time.Duration) {
+	entry.DurationMS = duration.Milliseconds()
+	entry.DocsExamined = -1
+	entry.DocsExaminedSampled = -1
+	entry.Slow = duration >= a.slowThreshold && entry.Kind != auditKindExport
+	entry.Timestamp = time.Now()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if entry.Slow {
+			a.logger.Warn("Slow query",
+				zap.String("identity", entry.Identity),
+				zap.String("collection", entry.Collection),
+				zap.Duration("duration", duration))
+		}
+		if entry.Kind != auditKindExport {
+			a.sampleDocsExamined(ctx, &entry)
+		}
+
+		if _, err := a.collection.InsertOne(ctx, entry); err != nil {
+			a.logger.Error("Failed to record query audit", zap.Error(err))
+		}
+	}()
+}
+
+// sampleDocsExamined fills in the docs examined by the entry's query.
+// Explaining runs the query again, so only one query per shape is explained
+// at a time. Slow queries are always explained; fast ones at most once per
+// shape per explain interval, and otherwise get the latest sample of their
+// shape, queries that differ only in their values.
+func (a *QueryAuditor) sampleDocsExamined(ctx context.Context, entry *models.QueryAuditEntry) {
+	shape := queryShape(entry.Collection, entry.Filter, entry.Limit)
+
+	a.mu.Lock()
+	sample, sampled := a.samples[shape]
+	explain := a.explainInterval > 0 && !a.explaining[shape] &&
+		(entry.Slow || !sampled || time.Since(sample.at) >= a.explainInterval)
+	if explain {
+		a.explaining[shape] = true
+	}
+	a.mu.Unlock()
+
+	if explain {
+		plan, err := a.storage.ExplainFind(ctx, entry.Collection, entry.Filter, entry.Limit)
+		a.mu.Lock()
+		delete(a.explaining, shape)
+		if err == nil {
+			sample = explainSample{docsExamined: docsExamined(plan), at: time.Now()}
+			a.storeSample(shape, sample)
+		}
+		a.mu.Unlock()
+		if err != nil {
+			a.logger.Warn("Failed to explain query", zap.String("collection", entry.Collection), zap.Error(err))
+		} else {
+			if sample.docsExamined >= 0 {
+				entry.DocsExamined = sample.docsExamined
+				entry.ExplainedAt = &sample.at
+			}
+			return
+		}
+	}
+
+	if sampled && sample.docsExamined >= 0 {
+		entry.DocsExaminedSampled = sample.docsExamined
+		entry.ExplainedAt = &sample.at
+	}
+}
+
+// storeSample keeps a shape's explain sample, dropping expired samples
+// when there are too many shapes. The caller holds a.mu.
+func (a *QueryAuditor) storeSample(shape string, sample explainSample) {
+	if _, known := a.samples[shape]; !known && len(a.samples) >= maxExplainShapes {
+		for s, old := range a.samples {
+			if time.Since(old.at) >= a.explainInterval {
+				delete(a.samples, s)
+			}
+		}
+		if len(a.samples) >= maxExplainShapes {
+			return
+		}
+	}
+	a.samples[shape] = sample
+}
+
+// queryShape identifies a query by its collection, limit, and the fields
+// and operators of its filter, leaving out their values
+func queryShape(collection string, filter map[string]interface{}, limit int64) string {
+	var b strings.Builder
+	b.WriteString(collection)
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatInt(limit, 10))
+	b.WriteByte(' ')
+	writeShape(&b, filter)
+	return b.String()
+}
+
+// writeShape writes a filter value with its scalars replaced by ?
+func writeShape(b *strings.Builder, value interface{}) {
+	switch v := value.(type) {
+	case bson.M:
+		writeShape(b, map[string]interface{}(v))
+	case bson.D:
+		fields := make(map[string]interface{}, len(v))
+		for _, e := range v {
+			fields[e.Key] = e.Value
+		}
+		writeShape(b, fields)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		b.WriteByte('{')
+		for _, key := range keys {
+			b.WriteString(key)
+			b.WriteByte(':')
+			writeShape(b, v[key])
+			b.WriteByte(',')
+		}
+		b.WriteByte('}')
+	case bson.A:
+		writeShape(b, []interface{}(v))
+	case []interface{}:
+		// Lists of values, as for $in, have one shape whatever their length
+		b.WriteByte('[')
+		for i, item := range v {
+			var elem strings.Builder
+			writeShape(&elem, item)
+			if elem.String() != "?" || i == 0 {
+				b.WriteString(elem.String())
+				b.WriteByte(',')
+			}
+		}
+		b.WriteByte(']')
+	default:
+		if kind := reflect.ValueOf(value).Kind(); kind == reflect.Slice || kind == reflect.Array {
+			b.WriteString("[?,]") // Typed lists, such as []string, hold only scalars
+			return
+		}
+		b.WriteByte('?')
+	}
+}
+
+// RecordSession stores a finished live-tail session
+func (a *QueryAuditor) RecordSession(session models.StreamSessionEntry) {
+	session.DurationMS = session.EndedAt.Sub(session.StartedAt).Milliseconds()
+
+	a.logger.Info("Live tail session ended",
+		zap.String("identity", session.Identity),
+		zap.String("service", session.Service),
+		zap.Int64("delivered", session.EntriesDelivered),
+		zap.Int64("duration_ms", session.DurationMS))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := a.sessions.InsertOne(ctx, session); err != nil {
+		a.logger.Error("Failed to record live tail session", zap.Error(err))
+	}
+}
+
+// Get returns a recorded query by its audit ID
+func (a *QueryAuditor) Get(ctx context.Context, id string) (*models.QueryAuditEntry, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query id: %w", err)
+	}
+
+	var entry models.QueryAuditEntry
+	if err := a.collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&entry); err != nil {
+		return nil, fmt.Errorf("failed to load query: %w", err)
+	}
+
+	return &entry, nil
+}
+
+// Explain returns the current explain plan for a recorded query
+func (a *QueryAuditor) Explain(ctx context.Context, id string) (bson.M, error) {
+	entry, err := a.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.storage.ExplainFind(ctx, entry.Collection, entry.Filter, entry.Limit)
+}
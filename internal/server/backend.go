@@ -0,0 +1,41 @@
+package server
+
+import (
+	"context"
+
+	"github.com/oicur0t/logl/pkg/logstore"
+	"github.com/oicur0t/logl/pkg/models"
+)
+
+// MongoBackend presents the MongoDB storage as a logstore.Backend
+type MongoBackend struct {
+	storage *Storage
+}
+
+var _ logstore.Backend = (*MongoBackend)(nil)
+
+// NewMongoBackend creates a new backend over the MongoDB storage
+func NewMongoBackend(storage *Storage) *MongoBackend {
+	return &MongoBackend{storage: storage}
+}
+
+// InsertBatch stores a batch's entries through the same path as ingestion
+func (b *MongoBackend) InsertBatch(ctx context.Context, batch models.LogBatch) error {
+	return b.storage.InsertBatch(ctx, batch)
+}
+
+// Query returns a service's newest entries matching the query
+func (b *MongoBackend) Query(ctx context.Context, q models.LogQuery) ([]models.LogEntry, error) {
+	return b.storage.FindServiceLogs(ctx, q.ServiceName, q.From, q.To, BuildQueryFilter(q), q.Limit)
+}
+
+// SetRetention overrides a service's retention
+func (b *MongoBackend) SetRetention(ctx context.Context, service string, ttlDays int) error {
+	_, err := b.storage.SetServiceRetention(ctx, service, ttlDays, "logstore")
+	return err
+}
+
+// Retention returns the retention in effect for a service
+func (b *MongoBackend) Retention(_ context.Context, service string) (int, error) {
+	return b.storage.RetentionFor(service).TTLDays, nil
+}
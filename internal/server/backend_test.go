@@ -0,0 +1,43 @@
+package server
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/storagetest"
+	"go.uber.org/zap"
+)
+
+// mongoURIEnv names the MongoDB deployment the backend tests run against;
+// they are skipped when it is unset
+const mongoURIEnv = "LOGL_TEST_MONGODB_URI"
+
+func TestMongoBackendConformance(t *testing.T) {
+	t.Run("Collections", func(t *testing.T) {
+		storagetest.RunConformance(t, newTestBackend(t, false))
+	})
+	t.Run("TimeSeries", func(t *testing.T) {
+		storagetest.RunConformance(t, newTestBackend(t, true))
+	})
+}
+
+// newTestBackend connects to the test deployment, creating new collections
+// as time-series collections when timeSeries is set
+func newTestBackend(t *testing.T, timeSeries bool) *MongoBackend {
+	uri := os.Getenv(mongoURIEnv)
+	if uri == "" {
+		t.Skipf("%s is not set", mongoURIEnv)
+	}
+
+	storage, err := NewStorage(uri, "logl_conformance", "logs_", "", 10, 0, 30, nil, nil, "quarantine", zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+	t.Cleanup(func() { storage.Close(context.Background()) })
+
+	storage.SetTimeSeries(config.TimeSeriesConfig{Enabled: timeSeries, MetaField: "hostname", Granularity: "seconds"})
+	storage.SetRetention(config.RetentionConfig{Collection: "retention_overrides"})
+	return NewMongoBackend(storage)
+}
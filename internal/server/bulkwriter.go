@@ -0,0 +1,238 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/models"
+	"go.uber.org/zap"
+)
+
+// errBulkWriterClosed is returned for batches submitted during shutdown
+var errBulkWriterClosed = errors.New("bulk writer is closed")
+
+// bulkWriterIdleTimeout is how long a collection's writer waits for a batch
+// before it stops, so collections no longer written to, such as expired
+// partitions, don't keep one
+const bulkWriterIdleTimeout = 5 * time.Minute
+
+// insertRequest is one HTTP batch waiting to be written
+type insertRequest struct {
+	batch models.LogBatch
+	done  chan error
+}
+
+// collectionWriter is the queue of a collection's writer goroutine
+type collectionWriter struct {
+	queue   chan insertRequest
+	senders int // Submit calls that may still send to queue
+}
+
+// BulkWriter coalesces batches for the same collection into larger
+// InsertMany calls. Each collection has one writer goroutine: the first
+// waiting batch opens a window of at most maxDelay, and the write goes out
+// when the window closes or maxDocs entries are pending. Batches arriving
+// during a write are picked up by the next one, so coalescing grows with load.
+// Writers left idle stop and are started again by the next batch.
+type BulkWriter struct {
+	storage      *Storage
+	maxDocs      int
+	maxDelay     time.Duration
+	writeTimeout time.Duration
+	logger       *zap.Logger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	writers map[string]*collectionWriter // collection -> writer
+}
+
+// NewBulkWriter creates a coalescing writer for storage
+func NewBulkWriter(storage *Storage, cfg config.BulkWriterConfig, logger *zap.Logger) *BulkWriter {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &BulkWriter{
+		storage:      storage,
+		maxDocs:      cfg.MaxDocs,
+		maxDelay:     cfg.MaxDelay,
+		writeTimeout: cfg.WriteTimeout,
+		logger:       logger,
+		ctx:          ctx,
+		cancel:       cancel,
+		writers:      make(map[string]*collectionWriter),
+	}
+}
+
+// Submit queues a batch and waits for the write that includes it
+func (w *BulkWriter) Submit(ctx context.Context, collName string, batch models.LogBatch) error {
+	req := insertRequest{batch: batch, done: make(chan error, 1)}
+
+	writer := w.acquire(collName)
+	select {
+	case writer.queue <- req:
+		w.release(writer)
+	case <-ctx.Done():
+		w.release(writer)
+		return ctx.Err()
+	case <-w.ctx.Done():
+		w.release(writer)
+		return errBulkWriterClosed
+	}
+
+	// The write completes even if the caller gives up waiting
+	select {
+	case err := <-req.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// acquire returns a collection's writer, starting it if it isn't running,
+// and keeps it running until release
+func (w *BulkWriter) acquire(collName string) *collectionWriter {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	writer, exists := w.writers[collName]
+	if !exists {
+		writer = &collectionWriter{queue: make(chan insertRequest, 1024)}
+		w.writers[collName] = writer
+		w.wg.Add(1)
+		go w.run(collName, writer)
+	}
+	writer.senders++
+	return writer
+}
+
+// release lets a writer stop once it is idle
+func (w *BulkWriter) release(writer *collectionWriter) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	writer.senders--
+}
+
+// retire removes an idle writer, reporting false if a batch may still
+// arrive for it
+func (w *BulkWriter) retire(collName string, writer *collectionWriter) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if writer.senders > 0 || len(writer.queue) > 0 {
+		return false
+	}
+	delete(w.writers, collName)
+	return true
+}
+
+// Queued returns the number of batches waiting in every collection's queue
+func (w *BulkWriter) Queued() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	queued := 0
+	for _, writer := range w.writers {
+		queued += len(writer.queue)
+	}
+	return queued
+}
+
+// run writes a collection's queued batches until the writer is closed or
+// left idle
+func (w *BulkWriter) run(collName string, writer *collectionWriter) {
+	defer w.wg.Done()
+
+	queue := writer.queue
+	idle := time.NewTimer(bulkWriterIdleTimeout)
+	defer idle.Stop()
+	for {
+		var pending []insertRequest
+		select {
+		case req := <-queue:
+			pending = append(pending, req)
+		case <-idle.C:
+			if w.retire(collName, writer) {
+				return
+			}
+			idle.Reset(bulkWriterIdleTimeout)
+			continue
+		case <-w.ctx.Done():
+			w.drainClosed(queue)
+			return
+		}
+
+		// Collect more batches until the window closes or enough are pending
+		docs := len(pending[0].batch.Entries)
+		window := time.NewTimer(w.maxDelay)
+	collect:
+		for docs < w.maxDocs {
+			select {
+			case req := <-queue:
+				pending = append(pending, req)
+				docs += len(req.batch.Entries)
+			case <-window.C:
+				break collect
+			case <-w.ctx.Done():
+				break collect
+			}
+		}
+		window.Stop()
+
+		w.write(collName, pending, docs)
+
+		if !idle.Stop() {
+			select {
+			case <-idle.C:
+			default:
+			}
+		}
+		idle.Reset(bulkWriterIdleTimeout)
+	}
+}
+
+// write inserts the pending batches in one call and reports the result to
+// each waiting request
+func (w *BulkWriter) write(collName string, pending []insertRequest, docs int) {
+	merged := models.LogBatch{
+		ServiceName: pending[0].batch.ServiceName,
+		Entries:     make([]models.LogEntry, 0, docs),
+	}
+	for _, req := range pending {
+		merged.Entries = append(merged.Entries, req.batch.Entries...)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), w.writeTimeout)
+	err := w.storage.insertEntries(ctx, collName, merged)
+	cancel()
+
+	if len(pending) > 1 {
+		w.logger.Debug("Coalesced batches",
+			zap.String("collection", collName),
+			zap.Int("batches", len(pending)),
+			zap.Int("entries", docs))
+	}
+	for _, req := range pending {
+		req.done <- err
+	}
+}
+
+// drainClosed fails requests still queued when the writer closes
+func (w *BulkWriter) drainClosed(queue chan insertRequest) {
+	for {
+		select {
+		case req := <-queue:
+			req.done <- errBulkWriterClosed
+		default:
+			return
+		}
+	}
+}
+
+// Close stops the writers after their in-flight writes finish
+func (w *BulkWriter) Close() {
+	w.cancel()
+	w.wg.Wait()
+}
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/models"
+	"github.com/oicur0t/logl/pkg/mtls"
+	"go.uber.org/zap"
+)
+
+// Bounds on observed client certificate tracking
+const (
+	maxObservedClients = 10000
+	clientForgetAfter  = 30 * 24 * time.Hour
+	alertRepeat        = 24 * time.Hour
+)
+
+// observedCert is a client certificate seen during a TLS handshake
+type observedCert struct {
+	cert     *x509.Certificate
+	lastSeen time.Time
+}
+
+// CertMonitor tracks expiry of the CA, server, and client certificates and
+// notifies operators when any is within the warning window. Configured
+// certificates are re-read on every check so rotations are picked up.
+type CertMonitor struct {
+	caPath        string
+	serverPath    string
+	serverPair    *mtls.KeyPair // Set when the server certificate isn't from a file
+	warnDays      int
+	checkInterval time.Duration
+	notifier      *Notifier
+	logger        *zap.Logger
+
+	mu       sync.Mutex
+	clients  map[string]*observedCert // issuer + serial -> certificate
+	notified map[string]time.Time     // issuer + serial -> last alert
+}
+
+// NewCertMonitor creates a new certificate expiry monitor
+func NewCertMonitor(cfg config.CertMonitorConfig, mtlsCfg config.ServerMTLSConfig, notifier *Notifier, logger *zap.Logger) *CertMonitor {
+	serverPath := mtlsCfg.ServerCert
+	if mtlsCfg.VaultPKI.Role != "" {
+		serverPath = "" // Issued by Vault; see SetServerCertificate
+	}
+	return &CertMonitor{
+		caPath:        mtlsCfg.CACert,
+		serverPath:    serverPath,
+		warnDays:      cfg.WarnDays,
+		checkInterval: cfg.CheckInterval,
+		notifier:      notifier,
+		logger:        logger,
+		clients:       make(map[string]*observedCert),
+		notified:      make(map[string]time.Time),
+	}
+}
+
+// SetServerCertificate tracks a server certificate that isn't read from
+// server_cert, such as one issued by Vault
+func (m *CertMonitor) SetServerCertificate(pair *mtls.KeyPair) {
+	m.mu.Lock()
+	m.serverPair = pair
+	m.mu.Unlock()
+}
+
+// WrapTLSConfig observes the client certificate of every handshake
+func (m *CertMonitor) WrapTLSConfig(tlsConfig *tls.Config) {
+	tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) > 0 {
+			m.ObserveClient(cs.PeerCertificates[0])
+		}
+		return nil
+	}
+}
+
+// ObserveClient records a client certificate
+func (m *CertMonitor) ObserveClient(cert *x509.Certificate) {
+	key := certKey(cert)
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if observed, exists := m.clients[key]; exists {
+		observed.lastSeen = now
+		return
+	}
+	if len(m.clients) >= maxObservedClients {
+		return
+	}
+	m.clients[key] = &observedCert{cert: cert, lastSeen: now}
+}
+
+// certKey identifies a certificate by issuer and serial number
+func certKey(cert *x509.Certificate) string {
+	return cert.Issuer.String() + "/" + cert.SerialNumber.String()
+}
+
+// Start checks expiry every check interval until the context is cancelled
+func (m *CertMonitor) Start(ctx context.Context) {
+	m.Check()
+
+	ticker := time.NewTicker(m.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.Check()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Check notifies about expiring certificates, at most once a day each
+func (m *CertMonitor) Check() {
+	statuses := m.Status()
+	now := time.Now()
+
+	for _, status := range statuses {
+		if !status.Expiring {
+			continue
+		}
+
+		key := status.Issuer + "/" + status.Serial
+		m.mu.Lock()
+		last, notified := m.notified[key]
+		if notified && now.Sub(last) < alertRepeat {
+			m.mu.Unlock()
+			continue
+		}
+		m.notified[key] = now
+		m.mu.Unlock()
+
+		message := fmt.Sprintf("%s certificate %s expires in %d days", status.Role, status.Subject, status.DaysRemaining)
+		if status.DaysRemaining < 0 {
+			message = fmt.Sprintf("%s certificate %s expired %d days ago", status.Role, status.Subject, -status.DaysRemaining)
+		}
+		m.notifier.Notify(Notification{
+			Type:    "certificate_expiry",
+			Message: message,
+			Details: map[string]interface{}{
+				"role":           status.Role,
+				"subject":        status.Subject,
+				"serial":         status.Serial,
+				"path":           status.Path,
+				"not_after":      status.NotAfter,
+				"days_remaining": status.DaysRemaining,
+			},
+		})
+	}
+}
+
+// Status returns every tracked certificate, soonest expiry first. Clients
+// not seen for 30 days are forgotten.
+func (m *CertMonitor) Status() []models.CertificateStatus {
+	now := time.Now()
+	var statuses []models.CertificateStatus
+
+	for role, path := range map[string]string{"ca": m.caPath, "server": m.serverPath} {
+		if path == "" {
+			continue
+		}
+		certs, err := mtls.ParseCertificateFile(path)
+		if err != nil {
+			m.logger.Warn("Failed to read certificate for expiry check", zap.String("path", path), zap.Error(err))
+			continue
+		}
+		status := m.status(role, certs[0], now)
+		status.Path = path
+		statuses = append(statuses, status)
+	}
+
+	m.mu.Lock()
+	if m.serverPair != nil {
+		statuses = append(statuses, m.status("server", m.serverPair.Leaf(), now))
+	}
+	for key, observed := range m.clients {
+		if now.Sub(observed.lastSeen) > clientForgetAfter {
+			delete(m.clients, key)
+			delete(m.notified, key)
+			continue
+		}
+		status := m.status("client", observed.cert, now)
+		status.LastSeen = observed.lastSeen
+		statuses = append(statuses, status)
+	}
+	m.mu.Unlock()
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].NotAfter.Before(statuses[j].NotAfter)
+	})
+	return statuses
+}
+
+// status describes one certificate
+func (m *CertMonitor) status(role string, cert *x509.Certificate, now time.Time) models.CertificateStatus {
+	days := mtls.Describe("", cert).DaysRemaining(now)
+	return models.CertificateStatus{
+		Role:          role,
+		Subject:       cert.Subject.String(),
+		Issuer:        cert.Issuer.String(),
+		Serial:        cert.SerialNumber.String(),
+		NotAfter:      cert.NotAfter,
+		DaysRemaining: days,
+		Expiring:      days < m.warnDays,
+	}
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/oicur0t/logl/pkg/models"
+	"go.uber.org/zap"
+)
+
+// CloudEvents HTTP binding content types (CloudEvents 1.0)
+const (
+	cloudEventsSpecVersion = "1.0"
+	cloudEventsContentType = "application/cloudevents+json"
+	cloudEventsBatchType   = "application/cloudevents-batch+json"
+	cloudEventsHeader      = "Ce-Specversion" // Present on binary-mode requests
+)
+
+// cloudEvent is a CloudEvents 1.0 event in structured JSON form
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            *time.Time      `json:"time,omitempty"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	DataBase64      string          `json:"data_base64,omitempty"`
+}
+
+// isCloudEventsRequest reports whether an ingest request carries
+// CloudEvents in structured, batch, or binary mode
+func isCloudEventsRequest(r *http.Request) bool {
+	ct := r.Header.Get("Content-Type")
+	return strings.HasPrefix(ct, cloudEventsContentType) ||
+		strings.HasPrefix(ct, cloudEventsBatchType) ||
+		r.Header.Get(cloudEventsHeader) != ""
+}
+
+// decodeCloudEvents reads the events of a CloudEvents HTTP request
+func decodeCloudEvents(r *http.Request) ([]cloudEvent, error) {
+	ct := r.Header.Get("Content-Type")
+	var events []cloudEvent
+	switch {
+	case strings.HasPrefix(ct, cloudEventsBatchType):
+		if err := json.NewDecoder(r.Body).Decode(&events); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+	case strings.HasPrefix(ct, cloudEventsContentType):
+		var event cloudEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		events = append(events, event)
+	default:
+		// Binary mode: attributes are ce- headers and the body is the data
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read body: %w", err)
+		}
+		event := cloudEvent{
+			SpecVersion:     r.Header.Get("Ce-Specversion"),
+			ID:              r.Header.Get("Ce-Id"),
+			Source:          r.Header.Get("Ce-Source"),
+			Type:            r.Header.Get("Ce-Type"),
+			Subject:         r.Header.Get("Ce-Subject"),
+			DataContentType: ct,
+		}
+		if ts := r.Header.Get("Ce-Time"); ts != "" {
+			t, err := time.Parse(time.RFC3339Nano, ts)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ce-time: %w", err)
+			}
+			event.Time = &t
+		}
+		if len(data) > 0 {
+			event.DataBase64 = base64.StdEncoding.EncodeToString(data)
+		}
+		events = append(events, event)
+	}
+
+	for i, event := range events {
+		if event.SpecVersion != cloudEventsSpecVersion {
+			return nil, fmt.Errorf("event %d: unsupported specversion %q", i, event.SpecVersion)
+		}
+		if event.ID == "" || event.Source == "" || event.Type == "" {
+			return nil, fmt.Errorf("event %d: id, source, and type are required", i)
+		}
+	}
+	return events, nil
+}
+
+// line returns the event's data as a log line. JSON data is kept as JSON
+// so parsing stages can read it; binary data that isn't UTF-8 stays
+// base64-encoded.
+func (e cloudEvent) line() string {
+	if e.DataBase64 != "" {
+		data, err := base64.StdEncoding.DecodeString(e.DataBase64)
+		if err != nil || !utf8.Valid(data) {
+			return e.DataBase64
+		}
+		return strings.TrimRight(string(data), "\r\n")
+	}
+	var s string
+	if err := json.Unmarshal(e.Data, &s); err == nil {
+		return s
+	}
+	return string(bytes.TrimSpace(e.Data))
+}
+
+// cloudEventsBatch converts events into a batch for a service. The event ID
+// becomes the entry ID, so redelivered events aren't stored twice.
+func cloudEventsBatch(service string, events []cloudEvent) models.LogBatch {
+	batch := models.LogBatch{ServiceName: service, Entries: make([]models.LogEntry, 0, len(events))}
+	now := time.Now().UTC()
+	for i, event := range events {
+		entry := models.LogEntry{
+			EntryID:     event.ID,
+			ServiceName: service,
+			Hostname:    event.Source,
+			FilePath:    "cloudevents://" + event.Type,
+			Line:        event.line(),
+			Timestamp:   now,
+			LineNumber:  int64(i + 1),
+			Labels: map[string]string{
+				"ce_source": event.Source,
+				"ce_type":   event.Type,
+			},
+		}
+		if event.Time != nil {
+			entry.Timestamp = event.Time.UTC()
+		}
+		if event.Subject != "" {
+			entry.Labels["ce_subject"] = event.Subject
+		}
+		batch.Entries = append(batch.Entries, entry)
+	}
+	return batch
+}
+
+// ingestCloudEvents ingests CloudEvents under the service named by the
+// service query parameter
+func (h *Handler) ingestCloudEvents(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	service := r.URL.Query().Get("service")
+	if service == "" {
+		writeError(w, http.StatusBadRequest, "service query parameter is required for CloudEvents")
+		return
+	}
+
+	events, err := decodeCloudEvents(r)
+	if err != nil {
+		if h.rejectOverLimit(w, r, h.bodyLimitError(err)) {
+			return
+		}
+		h.logger.Error("Failed to decode CloudEvents", zap.String("service", service), zap.Error(err))
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(events) == 0 {
+		writeError(w, http.StatusBadRequest, "events cannot be empty")
+		return
+	}
+
+	h.ingestBatch(w, r, cloudEventsBatch(service, events))
+}
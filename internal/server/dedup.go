@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// Outcomes of claiming a batch ID
+const (
+	ClaimNew        = "new"         // First sight; the caller must Commit or Release
+	ClaimDuplicate  = "duplicate"   // Already stored; acknowledge without storing
+	ClaimInProgress = "in_progress" // Another request is storing it right now
+	ClaimConflict   = "conflict"    // Same batch ID, different content
+)
+
+// dedupRecord marks a batch ID as being or having been stored
+type dedupRecord struct {
+	BatchID     string    `bson:"_id"`
+	ContentHash string    `bson:"content_hash"`
+	Service     string    `bson:"service"`
+	Entries     int       `bson:"entries"`
+	Committed   bool      `bson:"committed"`
+	ClaimedAt   time.Time `bson:"claimed_at"`
+}
+
+// Deduplicator makes ingestion idempotent. A batch ID is claimed before
+// insert and committed after, so a retry of a batch whose response was
+// lost (timed out but stored) is acknowledged instead of stored twice.
+// Records expire after the dedup window.
+type Deduplicator struct {
+	collection     *mongo.Collection
+	window         time.Duration
+	pendingTimeout time.Duration
+	logger         *zap.Logger
+}
+
+// NewDeduplicator creates a new batch deduplicator
+func NewDeduplicator(storage *Storage, cfg config.DedupConfig, logger *zap.Logger) *Deduplicator {
+	return &Deduplicator{
+		collection:     storage.database.Collection(cfg.Collection),
+		window:         cfg.Window,
+		pendingTimeout: cfg.PendingTimeout,
+		logger:         logger,
+	}
+}
+
+// EnsureIndexes creates the TTL index expiring records after the window
+func (d *Deduplicator) EnsureIndexes(ctx context.Context) error {
+	_, err := d.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "claimed_at", Value: 1}},
+		Options: options.Index().SetName("ttl_index").SetExpireAfterSeconds(int32(d.window.Seconds())),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create dedup indexes: %w", err)
+	}
+	return nil
+}
+
+// Claim records that a batch is about to be stored and reports whether it
+// was seen before. Claims left uncommitted for longer than the pending
+// timeout (a server that died mid-insert) are taken over.
+func (d *Deduplicator) Claim(ctx context.Context, batch models.LogBatch, contentHash string) (string, error) {
+	now := time.Now()
+	record := dedupRecord{
+		BatchID:     batch.BatchID,
+		ContentHash: contentHash,
+		Service:     batch.ServiceName,
+		Entries:     len(batch.Entries),
+		ClaimedAt:   now,
+	}
+
+	_, err := d.collection.InsertOne(ctx, record)
+	if err == nil {
+		return ClaimNew, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return "", fmt.Errorf("failed to claim batch: %w", err)
+	}
+
+	var existing dedupRecord
+	if err := d.collection.FindOne(ctx, bson.M{"_id": batch.BatchID}).Decode(&existing); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			// Expired or released between the insert and the lookup
+			return d.Claim(ctx, batch, contentHash)
+		}
+		return "", fmt.Errorf("failed to read batch claim: %w", err)
+	}
+
+	switch {
+	case existing.ContentHash != contentHash:
+		return ClaimConflict, nil
+	case existing.Committed:
+		return ClaimDuplicate, nil
+	case now.Sub(existing.ClaimedAt) < d.pendingTimeout:
+		return ClaimInProgress, nil
+	}
+
+	// Take over an abandoned claim, unless another retry just did
+	res, err := d.collection.UpdateOne(ctx,
+		bson.M{"_id": batch.BatchID, "committed": false, "claimed_at": existing.ClaimedAt},
+		bson.M{"$set": bson.M{"claimed_at": now}})
+	if err != nil {
+		return "", fmt.Errorf("failed to take over batch claim: %w", err)
+	}
+	if res.ModifiedCount == 0 {
+		return ClaimInProgress, nil
+	}
+	return ClaimNew, nil
+}
+
+// Commit marks a claimed batch as stored
+func (d *Deduplicator) Commit(ctx context.Context, batchID string) {
+	if _, err := d.collection.UpdateOne(ctx, bson.M{"_id": batchID}, bson.M{"$set": bson.M{"committed": true}}); err != nil {
+		// The claim will be taken over after the pending timeout, which
+		// may store a retry twice
+		d.logger.Warn("Failed to commit batch claim", zap.String("batch_id", batchID), zap.Error(err))
+	}
+}
+
+// Release drops a claim after a failed insert so a retry can store the batch
+func (d *Deduplicator) Release(ctx context.Context, batchID string) {
+	if _, err := d.collection.DeleteOne(ctx, bson.M{"_id": batchID, "committed": false}); err != nil {
+		d.logger.Warn("Failed to release batch claim", zap.String("batch_id", batchID), zap.Error(err))
+	}
+}
@@ -0,0 +1,271 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// Bounds on per-session tracking state
+const (
+	maxPendingSequences = 10000
+	sessionIdleTimeout  = time.Hour
+)
+
+// deliverySession tracks the batch sequence numbers seen from one tailer run
+type deliverySession struct {
+	agentID  string
+	highest  uint64
+	pending  map[uint64]time.Time // missing sequence -> when it was first missed
+	lastSeen time.Time
+}
+
+// DeliveryTracker detects batches lost between tailers and this server.
+// Sequence numbers skipped by a session are held for a grace period, in
+// case they arrive late (retries, failover), and are then recorded as gaps.
+// Tracking is per server: batches a tailer fails over to another server
+// show up as gaps here.
+type DeliveryTracker struct {
+	collection    *mongo.Collection
+	grace         time.Duration
+	checkInterval time.Duration
+	retention     time.Duration
+	logger        *zap.Logger
+
+	mu       sync.Mutex
+	sessions map[string]*deliverySession // session ID -> state
+}
+
+// NewDeliveryTracker creates a new delivery tracker
+func NewDeliveryTracker(storage *Storage, cfg config.DeliveryConfig, logger *zap.Logger) *DeliveryTracker {
+	return &DeliveryTracker{
+		collection:    storage.database.Collection(cfg.Collection),
+		grace:         cfg.GapGrace,
+		checkInterval: cfg.CheckInterval,
+		retention:     time.Duration(cfg.RetentionDays) * 24 * time.Hour,
+		logger:        logger,
+		sessions:      make(map[string]*deliverySession),
+	}
+}
+
+// EnsureIndexes creates the lookup index and, with a retention, a TTL on detected_at
+func (d *DeliveryTracker) EnsureIndexes(ctx context.Context) error {
+	indexModels := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "agent_id", Value: 1},
+				{Key: "detected_at", Value: -1},
+			},
+			Options: options.Index().SetName("agent_detected_at"),
+		},
+	}
+	if d.retention > 0 {
+		indexModels = append(indexModels, mongo.IndexModel{
+			Keys:    bson.D{{Key: "detected_at", Value: 1}},
+			Options: options.Index().SetName("ttl_index").SetExpireAfterSeconds(int32(d.retention.Seconds())),
+		})
+	}
+
+	if _, err := d.collection.Indexes().CreateMany(ctx, indexModels); err != nil {
+		return fmt.Errorf("failed to create delivery gap indexes: %w", err)
+	}
+	return nil
+}
+
+// Record notes a stored batch's sequence number. Batches without delivery
+// metadata (older tailers, direct API clients) are ignored.
+func (d *DeliveryTracker) Record(batch models.LogBatch) {
+	if batch.SessionID == "" || batch.Sequence == 0 {
+		return
+	}
+
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	session, exists := d.sessions[batch.SessionID]
+	if !exists {
+		// Earlier sequences may have been delivered before this server
+		// started, so a new session starts from wherever it is first seen
+		d.sessions[batch.SessionID] = &deliverySession{
+			agentID:  batch.AgentID,
+			highest:  batch.Sequence,
+			pending:  make(map[uint64]time.Time),
+			lastSeen: now,
+		}
+		return
+	}
+
+	session.lastSeen = now
+	if batch.Sequence <= session.highest {
+		// Late arrival (or a duplicate) filling an earlier gap
+		delete(session.pending, batch.Sequence)
+		return
+	}
+
+	for seq := session.highest + 1; seq < batch.Sequence && len(session.pending) < maxPendingSequences; seq++ {
+		session.pending[seq] = now
+	}
+	session.highest = batch.Sequence
+}
+
+// Start records expired gaps every check interval until the context is
+// cancelled
+func (d *DeliveryTracker) Start(ctx context.Context) {
+	ticker := time.NewTicker(d.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := d.Check(ctx); err != nil {
+				d.logger.Error("Failed to record delivery gaps", zap.Error(err))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Check records missing sequences older than the grace period as gaps,
+// coalescing consecutive sequences, and forgets idle sessions
+func (d *DeliveryTracker) Check(ctx context.Context) error {
+	now := time.Now()
+	var gaps []interface{}
+
+	d.mu.Lock()
+	for sessionID, session := range d.sessions {
+		var expired []uint64
+		for seq, missedAt := range session.pending {
+			if now.Sub(missedAt) >= d.grace {
+				expired = append(expired, seq)
+				delete(session.pending, seq)
+			}
+		}
+		for _, gap := range coalesceGaps(session.agentID, sessionID, expired, now) {
+			gaps = append(gaps, gap)
+		}
+
+		if len(session.pending) == 0 && now.Sub(session.lastSeen) > sessionIdleTimeout {
+			delete(d.sessions, sessionID)
+		}
+	}
+	d.mu.Unlock()
+
+	if len(gaps) == 0 {
+		return nil
+	}
+
+	for _, gap := range gaps {
+		g := gap.(models.DeliveryGap)
+		d.logger.Warn("Batches lost in transit",
+			zap.String("agent_id", g.AgentID),
+			zap.String("session_id", g.SessionID),
+			zap.Uint64("first_sequence", g.FirstSequence),
+			zap.Uint64("last_sequence", g.LastSequence))
+	}
+
+	if _, err := d.collection.InsertMany(ctx, gaps); err != nil {
+		return fmt.Errorf("failed to write delivery gaps: %w", err)
+	}
+	return nil
+}
+
+// coalesceGaps turns missing sequence numbers into runs of consecutive numbers
+func coalesceGaps(agentID, sessionID string, missing []uint64, now time.Time) []models.DeliveryGap {
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i] < missing[j] })
+
+	var gaps []models.DeliveryGap
+	for _, seq := range missing {
+		if n := len(gaps); n > 0 && gaps[n-1].LastSequence+1 == seq {
+			gaps[n-1].LastSequence = seq
+			gaps[n-1].Missing++
+			continue
+		}
+		gaps = append(gaps, models.DeliveryGap{
+			AgentID:       agentID,
+			SessionID:     sessionID,
+			FirstSequence: seq,
+			LastSequence:  seq,
+			Missing:       1,
+			DetectedAt:    now,
+		})
+	}
+	return gaps
+}
+
+// Report returns per-agent delivery summaries for gaps detected in
+// [from, to), optionally restricted to one agent. Agents with active
+// sessions are included even without gaps.
+func (d *DeliveryTracker) Report(ctx context.Context, agentID string, from, to time.Time) ([]models.DeliveryReport, error) {
+	filter := bson.M{"detected_at": bson.M{"$gte": from, "$lt": to}}
+	if agentID != "" {
+		filter["agent_id"] = agentID
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "detected_at", Value: -1}})
+	cursor, err := d.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query delivery gaps: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var gaps []models.DeliveryGap
+	if err := cursor.All(ctx, &gaps); err != nil {
+		return nil, fmt.Errorf("failed to decode delivery gaps: %w", err)
+	}
+
+	reports := make(map[string]*models.DeliveryReport)
+	reportFor := func(agent string) *models.DeliveryReport {
+		report, exists := reports[agent]
+		if !exists {
+			report = &models.DeliveryReport{AgentID: agent, Gaps: make([]models.DeliveryGap, 0)}
+			reports[agent] = report
+		}
+		return report
+	}
+
+	for _, gap := range gaps {
+		report := reportFor(gap.AgentID)
+		report.MissingBatches += gap.Missing
+		report.Gaps = append(report.Gaps, gap)
+	}
+
+	d.mu.Lock()
+	for _, session := range d.sessions {
+		if agentID != "" && session.agentID != agentID {
+			continue
+		}
+		report := reportFor(session.agentID)
+		report.PendingBatches += len(session.pending)
+		if session.lastSeen.After(report.LastSeen) {
+			report.LastSeen = session.lastSeen
+			report.HighestSequence = session.highest
+		}
+	}
+	d.mu.Unlock()
+
+	result := make([]models.DeliveryReport, 0, len(reports))
+	for _, report := range reports {
+		result = append(result, *report)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].MissingBatches != result[j].MissingBatches {
+			return result[i].MissingBatches > result[j].MissingBatches
+		}
+		return result[i].AgentID < result[j].AgentID
+	})
+	return result, nil
+}
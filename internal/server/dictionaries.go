@@ -0,0 +1,259 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// minDictionarySamples is the fewest lines worth training a dictionary on
+const minDictionarySamples = 100
+
+// DictionaryTrainer trains per-collection zstd dictionaries from samples of
+// stored lines. Short, repetitive log lines compress poorly on their own;
+// a shared dictionary lets each line be compressed individually at a good
+// ratio. Every training run stores a new version.
+type DictionaryTrainer struct {
+	storage         *Storage
+	collection      *mongo.Collection
+	sampleSize      int
+	dictSize        int
+	keepVersions    int
+	retrainInterval time.Duration
+	logger          *zap.Logger
+}
+
+// NewDictionaryTrainer creates a new dictionary trainer
+func NewDictionaryTrainer(storage *Storage, cfg config.DictionaryConfig, logger *zap.Logger) *DictionaryTrainer {
+	return &DictionaryTrainer{
+		storage:         storage,
+		collection:      storage.database.Collection(cfg.Collection),
+		sampleSize:      cfg.SampleSize,
+		dictSize:        cfg.DictSize,
+		keepVersions:    cfg.KeepVersions,
+		retrainInterval: cfg.RetrainInterval,
+		logger:          logger,
+	}
+}
+
+// Start retrains every log collection each retrain interval until the
+// context is cancelled
+func (t *DictionaryTrainer) Start(ctx context.Context) {
+	ticker := time.NewTicker(t.retrainInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.retrainAll(ctx)
+		}
+	}
+}
+
+// retrainAll trains a new dictionary version for every log collection
+func (t *DictionaryTrainer) retrainAll(ctx context.Context) {
+	names, err := t.storage.ListLogCollections(ctx)
+	if err != nil {
+		t.logger.Error("Failed to list collections for dictionary training", zap.Error(err))
+		return
+	}
+
+	for _, collName := range names {
+		if ctx.Err() != nil {
+			return
+		}
+		if _, err := t.Train(ctx, collName); err != nil {
+			t.logger.Warn("Dictionary training failed", zap.String("collection", collName), zap.Error(err))
+		}
+	}
+}
+
+// Train samples a collection's lines, trains a dictionary on most of them,
+// measures it against the rest, and stores it as the next version
+func (t *DictionaryTrainer) Train(ctx context.Context, collName string) (*models.CompressionDictionary, error) {
+	samples, err := t.sampleLines(ctx, collName)
+	if err != nil {
+		return nil, err
+	}
+	if len(samples) < minDictionarySamples {
+		return nil, fmt.Errorf("only %d lines in %s, need at least %d", len(samples), collName, minDictionarySamples)
+	}
+
+	// Hold out a fifth of the samples to measure the dictionary honestly
+	holdout := len(samples) / 5
+	training, evaluation := samples[holdout:], samples[:holdout]
+
+	version, err := t.nextVersion(ctx, collName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Raw content dictionaries: the encoder and decoder prime their history
+	// with the content, so lines are matched against recurring samples
+	id := dictionaryID(collName, version)
+	dict := dictionaryContent(training, t.dictSize)
+
+	ratio, baseline, err := measureDictionary(id, dict, evaluation)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &models.CompressionDictionary{
+		Collection:    collName,
+		Version:       version,
+		ID:            id,
+		Dictionary:    dict,
+		Size:          len(dict),
+		Samples:       len(training),
+		Ratio:         ratio,
+		BaselineRatio: baseline,
+		TrainedAt:     time.Now(),
+	}
+	if _, err := t.collection.InsertOne(ctx, entry); err != nil {
+		return nil, fmt.Errorf("failed to store dictionary for %s: %w", collName, err)
+	}
+
+	// Drop versions beyond the retention count
+	if t.keepVersions > 0 {
+		_, err := t.collection.DeleteMany(ctx, bson.M{
+			"collection": collName,
+			"version":    bson.M{"$lte": version - t.keepVersions},
+		})
+		if err != nil {
+			t.logger.Warn("Failed to prune old dictionaries", zap.String("collection", collName), zap.Error(err))
+		}
+	}
+
+	t.logger.Info("Trained compression dictionary",
+		zap.String("collection", collName),
+		zap.Int("version", version),
+		zap.Int("size", len(dict)),
+		zap.Float64("ratio", ratio),
+		zap.Float64("baseline_ratio", baseline))
+
+	return entry, nil
+}
+
+// List returns a collection's stored dictionary versions, newest first
+func (t *DictionaryTrainer) List(ctx context.Context, collName string) ([]models.CompressionDictionary, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "version", Value: -1}}).
+		SetProjection(bson.M{"dictionary": 0})
+
+	cursor, err := t.collection.Find(ctx, bson.M{"collection": collName}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dictionaries: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	dicts := make([]models.CompressionDictionary, 0)
+	if err := cursor.All(ctx, &dicts); err != nil {
+		return nil, fmt.Errorf("failed to decode dictionaries: %w", err)
+	}
+	return dicts, nil
+}
+
+// sampleLines returns a random sample of a collection's lines
+func (t *DictionaryTrainer) sampleLines(ctx context.Context, collName string) ([][]byte, error) {
+	pipeline := bson.A{
+		bson.M{"$sample": bson.M{"size": t.sampleSize}},
+		bson.M{"$project": bson.M{"_id": 0, "line": 1}},
+	}
+
+	cursor, err := t.storage.database.Collection(collName).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample %s: %w", collName, err)
+	}
+	defer cursor.Close(ctx)
+
+	var samples [][]byte
+	for cursor.Next(ctx) {
+		var doc struct {
+			Line string `bson:"line"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode sample: %w", err)
+		}
+		if doc.Line != "" {
+			samples = append(samples, []byte(doc.Line))
+		}
+	}
+	return samples, cursor.Err()
+}
+
+// nextVersion returns one past the collection's newest dictionary version
+func (t *DictionaryTrainer) nextVersion(ctx context.Context, collName string) (int, error) {
+	var latest models.CompressionDictionary
+	opts := options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}})
+	err := t.collection.FindOne(ctx, bson.M{"collection": collName}, opts).Decode(&latest)
+	if err == mongo.ErrNoDocuments {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to load dictionary version: %w", err)
+	}
+	return latest.Version + 1, nil
+}
+
+// dictionaryID derives a zstd dictionary ID outside the reserved range
+func dictionaryID(collName string, version int) uint32 {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s:%d", collName, version)
+	return h.Sum32() | 1<<31
+}
+
+// dictionaryContent concatenates distinct samples into raw dictionary
+// content of up to size bytes
+func dictionaryContent(samples [][]byte, size int) []byte {
+	seen := make(map[string]bool)
+	content := make([]byte, 0, size)
+	for _, sample := range samples {
+		if seen[string(sample)] || len(content)+len(sample) > size {
+			continue
+		}
+		seen[string(sample)] = true
+		content = append(content, sample...)
+	}
+	return content
+}
+
+// measureDictionary compresses each line on its own with and without the
+// dictionary, returning the uncompressed-to-compressed size ratios
+func measureDictionary(id uint32, dict []byte, lines [][]byte) (float64, float64, error) {
+	withDict, err := zstd.NewWriter(nil, zstd.WithEncoderDictRaw(id, dict))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to load dictionary: %w", err)
+	}
+	defer withDict.Close()
+
+	plain, err := zstd.NewWriter(nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to create encoder: %w", err)
+	}
+	defer plain.Close()
+
+	var raw, compressed, baseline int
+	var buf []byte
+	for _, line := range lines {
+		raw += len(line)
+		buf = withDict.EncodeAll(line, buf[:0])
+		compressed += len(buf)
+		buf = plain.EncodeAll(line, buf[:0])
+		baseline += len(buf)
+	}
+	if compressed == 0 || baseline == 0 {
+		return 0, 0, nil
+	}
+	return float64(raw) / float64(compressed), float64(raw) / float64(baseline), nil
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/oicur0t/logl/pkg/models"
+)
+
+// writeError writes an error response whose code follows from the status
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeAPIError(w, status, models.NewAPIError(status, message))
+}
+
+// writeErrorCode writes an error response with a specific code
+func writeErrorCode(w http.ResponseWriter, status int, code, message string) {
+	apiErr := models.NewAPIError(status, message)
+	apiErr.Code = code
+	writeAPIError(w, status, apiErr)
+}
+
+// writeAPIError writes an error response in the JSON envelope every
+// endpoint uses
+func writeAPIError(w http.ResponseWriter, status int, apiErr models.APIError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(models.ErrorResponse{Error: apiErr})
+}
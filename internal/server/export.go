@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/oicur0t/logl/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// exportColumns are the CSV export columns, in order
+var exportColumns = []string{
+	"timestamp", "service_name", "hostname", "file_path", "line_number",
+	"level", "trace_id", "span_id", "entry_id", "labels", "parsed", "line",
+}
+
+// ExportServiceLogs streams a service's entries matching the filter to fn,
+// oldest first across its partitions, fetching query.export_batch entries
+// at a time. A positive limit stops the export after that many entries.
+func (s *Storage) ExportServiceLogs(ctx context.Context, serviceName string, from, to time.Time, filter bson.M, limit int64, fn func(models.LogEntry) error) (int64, error) {
+	collections, err := s.CollectionsFor(ctx, serviceName, from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	var exported int64
+	// CollectionsFor lists the newest partition first
+	for i := len(collections) - 1; i >= 0; i-- {
+		opts := options.Find().
+			SetSort(bson.D{{Key: "timestamp", Value: 1}}).
+			SetBatchSize(s.query.ExportBatch)
+		if limit > 0 {
+			opts.SetLimit(limit - exported)
+		}
+
+		cursor, err := s.database.Collection(collections[i]).Find(ctx, filter, opts)
+		if err != nil {
+			return exported, fmt.Errorf("collection %s: failed to query logs: %w", collections[i], err)
+		}
+		for cursor.Next(ctx) {
+			var entry models.LogEntry
+			if err := cursor.Decode(&entry); err != nil {
+				cursor.Close(ctx)
+				return exported, fmt.Errorf("collection %s: failed to decode log: %w", collections[i], err)
+			}
+			if err := fn(entry); err != nil {
+				cursor.Close(ctx)
+				return exported, err
+			}
+			exported++
+		}
+		err = cursor.Err()
+		cursor.Close(ctx)
+		if err != nil {
+			return exported, fmt.Errorf("collection %s: failed to read logs: %w", collections[i], err)
+		}
+		if limit > 0 && exported >= limit {
+			break
+		}
+	}
+	return exported, nil
+}
+
+// exportWriter writes exported entries in one format
+type exportWriter interface {
+	Write(entry models.LogEntry) error
+	Flush() error
+}
+
+// newExportWriter returns a writer for "ndjson" or "csv"
+func newExportWriter(format string, w io.Writer) (exportWriter, error) {
+	switch format {
+	case "ndjson":
+		return &ndjsonExportWriter{encoder: json.NewEncoder(w)}, nil
+	case "csv":
+		cw := csv.NewWriter(w)
+		if err := cw.Write(exportColumns); err != nil {
+			return nil, err
+		}
+		return &csvExportWriter{writer: cw}, nil
+	default:
+		return nil, fmt.Errorf("invalid format: %s (expected ndjson or csv)", format)
+	}
+}
+
+// ndjsonExportWriter writes one JSON entry per line
+type ndjsonExportWriter struct {
+	encoder *json.Encoder
+}
+
+func (w *ndjsonExportWriter) Write(entry models.LogEntry) error {
+	return w.encoder.Encode(entry)
+}
+
+func (w *ndjsonExportWriter) Flush() error {
+	return nil
+}
+
+// csvExportWriter writes one row per entry, with labels and parsed fields
+// as JSON objects
+type csvExportWriter struct {
+	writer *csv.Writer
+}
+
+func (w *csvExportWriter) Write(entry models.LogEntry) error {
+	var labels, parsed string
+	if len(entry.Labels) > 0 {
+		data, err := json.Marshal(entry.Labels)
+		if err != nil {
+			return err
+		}
+		labels = string(data)
+	}
+	if len(entry.Parsed) > 0 {
+		data, err := json.Marshal(entry.Parsed)
+		if err != nil {
+			return err
+		}
+		parsed = string(data)
+	}
+
+	return w.writer.Write([]string{
+		entry.Timestamp.UTC().Format(time.RFC3339Nano),
+		entry.ServiceName,
+		entry.Hostname,
+		entry.FilePath,
+		strconv.FormatInt(entry.LineNumber, 10),
+		entry.Level,
+		entry.TraceID,
+		entry.SpanID,
+		entry.EntryID,
+		labels,
+		parsed,
+		entry.Line,
+	})
+}
+
+func (w *csvExportWriter) Flush() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
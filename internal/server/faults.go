@@ -0,0 +1,152 @@
+//go:build faults
+
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// errInjectedDrop marks an insert discarded by fault injection
+var errInjectedDrop = errors.New("insert dropped by fault injection")
+
+// FaultSettings controls injected failures. Percentages are 0-100.
+type FaultSettings struct {
+	InsertFailurePercent float64 `json:"insert_failure_percent"` // Inserts that return an error
+	InsertDropPercent    float64 `json:"insert_drop_percent"`    // Inserts silently discarded but acknowledged
+	InsertLatencyMs      int64   `json:"insert_latency_ms"`      // Delay added before every insert
+	TLSFailurePercent    float64 `json:"tls_failure_percent"`    // TLS handshakes rejected
+}
+
+// FaultInjector injects storage and TLS failures for chaos testing. It is
+// only compiled into builds with the faults tag.
+type FaultInjector struct {
+	mu       sync.RWMutex
+	settings FaultSettings
+	rng      *rand.Rand
+	rngMu    sync.Mutex
+	logger   *zap.Logger
+}
+
+// NewFaultInjector creates a fault injector with no faults active
+func NewFaultInjector(logger *zap.Logger) *FaultInjector {
+	logger.Warn("Fault injection is compiled in; do not run this build in production")
+	return &FaultInjector{
+		rng:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		logger: logger,
+	}
+}
+
+// Settings returns the active fault settings
+func (f *FaultInjector) Settings() FaultSettings {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.settings
+}
+
+// SetSettings replaces the active fault settings
+func (f *FaultInjector) SetSettings(settings FaultSettings) error {
+	for name, pct := range map[string]float64{
+		"insert_failure_percent": settings.InsertFailurePercent,
+		"insert_drop_percent":    settings.InsertDropPercent,
+		"tls_failure_percent":    settings.TLSFailurePercent,
+	} {
+		if pct < 0 || pct > 100 {
+			return fmt.Errorf("%s must be between 0 and 100", name)
+		}
+	}
+	if settings.InsertLatencyMs < 0 {
+		return fmt.Errorf("insert_latency_ms must not be negative")
+	}
+
+	f.mu.Lock()
+	f.settings = settings
+	f.mu.Unlock()
+
+	f.logger.Warn("Fault injection settings changed", zap.Any("settings", settings))
+	return nil
+}
+
+// roll reports whether an event with the given percentage chance happens
+func (f *FaultInjector) roll(pct float64) bool {
+	if pct <= 0 {
+		return false
+	}
+	f.rngMu.Lock()
+	defer f.rngMu.Unlock()
+	return f.rng.Float64()*100 < pct
+}
+
+// BeforeInsert applies insert latency and failures. It returns
+// errInjectedDrop when the insert should be skipped but acknowledged.
+func (f *FaultInjector) BeforeInsert(ctx context.Context) error {
+	if f == nil {
+		return nil
+	}
+	settings := f.Settings()
+
+	if settings.InsertLatencyMs > 0 {
+		select {
+		case <-time.After(time.Duration(settings.InsertLatencyMs) * time.Millisecond):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if f.roll(settings.InsertFailurePercent) {
+		return fmt.Errorf("injected insert failure")
+	}
+	if f.roll(settings.InsertDropPercent) {
+		return errInjectedDrop
+	}
+	return nil
+}
+
+// WrapTLSConfig rejects a share of TLS handshakes before certificates are exchanged
+func (f *FaultInjector) WrapTLSConfig(tlsConfig *tls.Config) {
+	if f == nil || tlsConfig == nil {
+		return
+	}
+	tlsConfig.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		if f.roll(f.Settings().TLSFailurePercent) {
+			return nil, fmt.Errorf("injected TLS handshake failure")
+		}
+		return nil, nil
+	}
+}
+
+// Faults handles GET/PUT/DELETE /v1/admin/faults
+func (h *Handler) Faults(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+
+	case http.MethodPut:
+		var settings FaultSettings
+		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		if err := h.faults.SetSettings(settings); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+	case http.MethodDelete:
+		h.faults.SetSettings(FaultSettings{})
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.faults.Settings())
+}
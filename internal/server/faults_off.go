@@ -0,0 +1,36 @@
+//go:build !faults
+
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// errInjectedDrop is never returned without the faults build tag
+var errInjectedDrop = errors.New("insert dropped by fault injection")
+
+// FaultInjector is a no-op unless built with the faults tag
+type FaultInjector struct{}
+
+// NewFaultInjector returns nil since fault injection is not compiled in
+func NewFaultInjector(logger *zap.Logger) *FaultInjector {
+	return nil
+}
+
+// BeforeInsert never injects faults
+func (f *FaultInjector) BeforeInsert(ctx context.Context) error {
+	return nil
+}
+
+// WrapTLSConfig leaves the TLS configuration unchanged
+func (f *FaultInjector) WrapTLSConfig(tlsConfig *tls.Config) {}
+
+// Faults reports that fault injection is unavailable in this build
+func (h *Handler) Faults(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusNotFound, "Fault injection is not compiled in; build with -tags faults")
+}
@@ -0,0 +1,286 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxTrackedValues caps the distinct values counted per field, so
+	// high-cardinality fields like request IDs stay cheap
+	maxTrackedValues = 1000
+
+	// maxValueLength skips longer values, which are no use for autocomplete
+	maxValueLength = 200
+
+	// maxFieldDepth bounds how deep nested parsed objects are walked
+	maxFieldDepth = 8
+)
+
+// FieldCatalog samples each service's newest entries for the fields and
+// values they hold, caching the result per service
+type FieldCatalog struct {
+	storage    *Storage
+	sampleSize int64
+	maxValues  int
+	cacheTTL   time.Duration
+	logger     *zap.Logger
+
+	mu    sync.Mutex
+	cache map[string]models.FieldCatalog
+}
+
+// NewFieldCatalog creates a new field catalog
+func NewFieldCatalog(storage *Storage, cfg config.AutocompleteConfig, logger *zap.Logger) *FieldCatalog {
+	return &FieldCatalog{
+		storage:    storage,
+		sampleSize: cfg.SampleSize,
+		maxValues:  cfg.MaxValues,
+		cacheTTL:   cfg.CacheTTL,
+		logger:     logger,
+		cache:      make(map[string]models.FieldCatalog),
+	}
+}
+
+// Fields returns the catalog for a service, sampling it again once the
+// cached one is older than the cache TTL
+func (c *FieldCatalog) Fields(ctx context.Context, service string) (models.FieldCatalog, error) {
+	c.mu.Lock()
+	cached, ok := c.cache[service]
+	c.mu.Unlock()
+	if ok && time.Since(cached.SampledAt) < c.cacheTTL {
+		return cached, nil
+	}
+
+	catalog, err := c.sample(ctx, service)
+	if err != nil {
+		return models.FieldCatalog{}, err
+	}
+
+	c.mu.Lock()
+	c.cache[service] = catalog
+	c.mu.Unlock()
+	return catalog, nil
+}
+
+// sampledEntry holds the fields of an entry the catalog describes
+type sampledEntry struct {
+	Hostname string            `bson:"hostname"`
+	FilePath string            `bson:"file_path"`
+	Level    string            `bson:"level"`
+	Labels   map[string]string `bson:"labels"`
+	Parsed   bson.M            `bson:"parsed"`
+}
+
+// sample reads the service's newest entries, across partitions, and
+// summarizes their fields
+func (c *FieldCatalog) sample(ctx context.Context, service string) (models.FieldCatalog, error) {
+	collections, err := c.storage.CollectionsFor(ctx, service, time.Time{}, time.Time{})
+	if err != nil {
+		return models.FieldCatalog{}, err
+	}
+
+	stats := newFieldStats()
+	sampled := 0
+	for _, collName := range collections {
+		remaining := c.sampleSize - int64(sampled)
+		if remaining <= 0 {
+			break
+		}
+		opts := options.Find().
+			SetSort(bson.D{{Key: "timestamp", Value: -1}}).
+			SetLimit(remaining).
+			SetProjection(bson.M{"hostname": 1, "file_path": 1, "level": 1, "labels": 1, "parsed": 1})
+
+		cursor, err := c.storage.database.Collection(collName).Find(ctx, bson.M{}, opts)
+		if err != nil {
+			return models.FieldCatalog{}, fmt.Errorf("failed to sample %s: %w", collName, err)
+		}
+		for cursor.Next(ctx) {
+			var entry sampledEntry
+			if err := cursor.Decode(&entry); err != nil {
+				cursor.Close(ctx)
+				return models.FieldCatalog{}, fmt.Errorf("failed to decode sampled entry: %w", err)
+			}
+			stats.addEntry(entry)
+			sampled++
+		}
+		err = cursor.Err()
+		cursor.Close(ctx)
+		if err != nil {
+			return models.FieldCatalog{}, fmt.Errorf("failed to sample %s: %w", collName, err)
+		}
+	}
+
+	return models.FieldCatalog{
+		Service:    service,
+		SampleSize: sampled,
+		SampledAt:  time.Now(),
+		Fields:     stats.summaries(c.maxValues),
+	}, nil
+}
+
+// fieldStats accumulates the types and values seen per field
+type fieldStats struct {
+	fields map[string]*fieldStat
+}
+
+type fieldStat struct {
+	types  map[string]bool
+	count  int
+	values map[string]int
+}
+
+func newFieldStats() *fieldStats {
+	return &fieldStats{fields: make(map[string]*fieldStat)}
+}
+
+// addEntry records each field an entry holds
+func (s *fieldStats) addEntry(entry sampledEntry) {
+	for name, value := range map[string]string{"hostname": entry.Hostname, "file_path": entry.FilePath, "level": entry.Level} {
+		if value != "" {
+			s.add(name, value)
+		}
+	}
+	for key, value := range entry.Labels {
+		s.add("label:"+key, value)
+	}
+	s.addParsed("parsed", entry.Parsed, 0)
+}
+
+// addParsed walks nested parsed objects, recording leaves by dotted path
+func (s *fieldStats) addParsed(prefix string, value interface{}, depth int) {
+	switch v := value.(type) {
+	case bson.M:
+		s.addObject(prefix, v, depth)
+	case map[string]interface{}:
+		s.addObject(prefix, v, depth)
+	case primitive.D:
+		s.addObject(prefix, v.Map(), depth)
+	default:
+		if prefix != "parsed" {
+			s.add(prefix, v)
+		}
+	}
+}
+
+func (s *fieldStats) addObject(prefix string, object map[string]interface{}, depth int) {
+	if depth >= maxFieldDepth {
+		return
+	}
+	for key, value := range object {
+		s.addParsed(prefix+"."+key, value, depth+1)
+	}
+}
+
+// add records one value of a field
+func (s *fieldStats) add(name string, value interface{}) {
+	stat, ok := s.fields[name]
+	if !ok {
+		stat = &fieldStat{types: make(map[string]bool), values: make(map[string]int)}
+		s.fields[name] = stat
+	}
+	stat.count++
+
+	var text string
+	switch v := value.(type) {
+	case nil:
+		return
+	case string:
+		stat.types["string"] = true
+		text = v
+	case bool:
+		stat.types["bool"] = true
+		text = fmt.Sprint(v)
+	case int32, int64, float64:
+		stat.types["number"] = true
+		text = fmt.Sprint(v)
+	case primitive.A, []interface{}:
+		stat.types["array"] = true
+		return
+	default:
+		stat.types["string"] = true
+		text = fmt.Sprint(v)
+	}
+
+	if len(text) > maxValueLength {
+		return
+	}
+	if _, seen := stat.values[text]; seen || len(stat.values) < maxTrackedValues {
+		stat.values[text]++
+	}
+}
+
+// summaries returns the fields sorted by name, each with its most
+// frequent values
+func (s *fieldStats) summaries(maxValues int) []models.FieldSummary {
+	summaries := make([]models.FieldSummary, 0, len(s.fields))
+	for name, stat := range s.fields {
+		summary := models.FieldSummary{
+			Name:     name,
+			Type:     fieldType(stat.types),
+			Count:    stat.count,
+			Distinct: len(stat.values),
+		}
+
+		values := make([]string, 0, len(stat.values))
+		for value := range stat.values {
+			values = append(values, value)
+		}
+		sort.Slice(values, func(i, j int) bool {
+			if stat.values[values[i]] != stat.values[values[j]] {
+				return stat.values[values[i]] > stat.values[values[j]]
+			}
+			return values[i] < values[j]
+		})
+		if len(values) > maxValues {
+			values = values[:maxValues]
+		}
+		summary.Values = values
+
+		summaries = append(summaries, summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Name < summaries[j].Name
+	})
+	return summaries
+}
+
+// fieldType names the type of a field's values, or mixed
+func fieldType(types map[string]bool) string {
+	if len(types) != 1 {
+		if len(types) == 0 {
+			return "null"
+		}
+		return "mixed"
+	}
+	for t := range types {
+		return t
+	}
+	return ""
+}
+
+// filterFields returns the fields whose names start with prefix
+func filterFields(fields []models.FieldSummary, prefix string) []models.FieldSummary {
+	if prefix == "" {
+		return fields
+	}
+	matched := []models.FieldSummary{}
+	for _, f := range fields {
+		if strings.HasPrefix(f.Name, prefix) {
+			matched = append(matched, f)
+		}
+	}
+	return matched
+}
@@ -0,0 +1,233 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/oicur0t/logl/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// fileLinesFilter selects a query's host and file, within its time range,
+// between two line numbers; 0 leaves a bound open
+func fileLinesFilter(query models.LogQuery, fromLine, toLine int64) bson.M {
+	filter := BuildQueryFilter(query)
+	lineRange := bson.M{}
+	if fromLine > 0 {
+		lineRange["$gte"] = fromLine
+	}
+	if toLine > 0 {
+		lineRange["$lte"] = toLine
+	}
+	if len(lineRange) > 0 {
+		filter["line_number"] = lineRange
+	}
+	return filter
+}
+
+// fileDownloadName returns the base name of a file path from any platform
+func fileDownloadName(filePath string) string {
+	return path.Base(strings.ReplaceAll(filePath, "\\", "/"))
+}
+
+// fileCursor reads one partition's entries for a file in line order
+type fileCursor struct {
+	collection string
+	cursor     *mongo.Cursor
+	entry      models.LogEntry
+	ok         bool
+}
+
+// advance decodes the cursor's next entry, clearing ok when it is done
+func (c *fileCursor) advance(ctx context.Context) error {
+	c.ok = c.cursor.Next(ctx)
+	if !c.ok {
+		if err := c.cursor.Err(); err != nil {
+			return fmt.Errorf("collection %s: failed to read logs: %w", c.collection, err)
+		}
+		return nil
+	}
+	c.entry = models.LogEntry{}
+	if err := c.cursor.Decode(&c.entry); err != nil {
+		return fmt.Errorf("collection %s: failed to decode log: %w", c.collection, err)
+	}
+	return nil
+}
+
+// ReadFileLines streams a service's entries matching the filter, which
+// should select one host's file, to fn in line number order. A file's
+// lines can span partitions, so each partition is read in line order and
+// the cursors are merged.
+func (s *Storage) ReadFileLines(ctx context.Context, serviceName string, from, to time.Time, filter bson.M, fn func(models.LogEntry) error) (int64, error) {
+	collections, err := s.CollectionsFor(ctx, serviceName, from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	var cursors []*fileCursor
+	defer func() {
+		for _, c := range cursors {
+			c.cursor.Close(ctx)
+		}
+	}()
+	for _, collName := range collections {
+		opts := options.Find().
+			SetSort(bson.D{{Key: "line_number", Value: 1}}).
+			SetBatchSize(s.query.ExportBatch)
+		cursor, err := s.database.Collection(collName).Find(ctx, filter, opts)
+		if err != nil {
+			return 0, fmt.Errorf("collection %s: failed to query logs: %w", collName, err)
+		}
+		c := &fileCursor{collection: collName, cursor: cursor}
+		cursors = append(cursors, c)
+		if err := c.advance(ctx); err != nil {
+			return 0, err
+		}
+	}
+
+	var read int64
+	for {
+		// Take the lowest line number, the earliest entry on ties
+		var next *fileCursor
+		for _, c := range cursors {
+			if !c.ok {
+				continue
+			}
+			if next == nil || c.entry.LineNumber < next.entry.LineNumber ||
+				(c.entry.LineNumber == next.entry.LineNumber && c.entry.Timestamp.Before(next.entry.Timestamp)) {
+				next = c
+			}
+		}
+		if next == nil {
+			return read, nil
+		}
+
+		if err := fn(next.entry); err != nil {
+			return read, err
+		}
+		read++
+		if err := next.advance(ctx); err != nil {
+			return read, err
+		}
+	}
+}
+
+// fileLinesWriter writes a file's entries and the gaps between them in one
+// format
+type fileLinesWriter interface {
+	Entry(entry models.LogEntry) error
+	Gap(fromLine, toLine int64) error
+	Flush() error
+}
+
+// newFileLinesWriter returns a writer for "text", which reproduces the
+// file, or "ndjson". Text gaps are written as marker lines unless
+// markGaps is false.
+func newFileLinesWriter(format string, markGaps bool, w io.Writer) (fileLinesWriter, error) {
+	switch format {
+	case "text":
+		return &textFileLinesWriter{writer: bufio.NewWriter(w), markGaps: markGaps}, nil
+	case "ndjson":
+		buffered := bufio.NewWriter(w)
+		return &ndjsonFileLinesWriter{writer: buffered, encoder: json.NewEncoder(buffered)}, nil
+	default:
+		return nil, fmt.Errorf("invalid format: %s (expected text or ndjson)", format)
+	}
+}
+
+// textFileLinesWriter writes each entry's line as it appeared in the file
+type textFileLinesWriter struct {
+	writer   *bufio.Writer
+	markGaps bool
+}
+
+func (w *textFileLinesWriter) Entry(entry models.LogEntry) error {
+	w.writer.WriteString(entry.Line)
+	return w.writer.WriteByte('\n')
+}
+
+func (w *textFileLinesWriter) Gap(fromLine, toLine int64) error {
+	if !w.markGaps {
+		return nil
+	}
+	if fromLine == toLine {
+		_, err := fmt.Fprintf(w.writer, "[logl: line %d missing]\n", fromLine)
+		return err
+	}
+	_, err := fmt.Fprintf(w.writer, "[logl: lines %d-%d missing]\n", fromLine, toLine)
+	return err
+}
+
+func (w *textFileLinesWriter) Flush() error {
+	return w.writer.Flush()
+}
+
+// ndjsonFileLinesWriter writes entries as JSON lines, with gaps as
+// {"gap": {"from_line": ..., "to_line": ...}} objects between them
+type ndjsonFileLinesWriter struct {
+	writer  *bufio.Writer
+	encoder *json.Encoder
+}
+
+func (w *ndjsonFileLinesWriter) Entry(entry models.LogEntry) error {
+	return w.encoder.Encode(entry)
+}
+
+func (w *ndjsonFileLinesWriter) Gap(fromLine, toLine int64) error {
+	return w.encoder.Encode(map[string]models.FileGap{"gap": {FromLine: fromLine, ToLine: toLine}})
+}
+
+func (w *ndjsonFileLinesWriter) Flush() error {
+	return w.writer.Flush()
+}
+
+// fileReassembler passes a file's entries, in line order, to a writer,
+// reporting the lines missing between them and dropping entries stored
+// twice
+type fileReassembler struct {
+	writer  fileLinesWriter
+	summary models.FileReadSummary
+	next    int64 // First line not yet covered; 0 before the first entry
+	last    models.LogEntry
+}
+
+// newFileReassembler returns a reassembler for a read starting at
+// fromLine, so lines missing before the first entry are reported; 0 starts
+// at the first entry
+func newFileReassembler(writer fileLinesWriter, fromLine int64) *fileReassembler {
+	return &fileReassembler{writer: writer, next: fromLine}
+}
+
+// add writes an entry, preceded by a gap when lines are missing before it
+func (a *fileReassembler) add(entry models.LogEntry) error {
+	if a.summary.Entries > 0 && entry.LineNumber == a.last.LineNumber && entry.Line == a.last.Line {
+		a.summary.Duplicates++
+		return nil
+	}
+	if a.next > 0 && entry.LineNumber > a.next {
+		if err := a.writer.Gap(a.next, entry.LineNumber-1); err != nil {
+			return err
+		}
+		a.summary.Gaps++
+		a.summary.MissingLines += entry.LineNumber - a.next
+	}
+	if err := a.writer.Entry(entry); err != nil {
+		return err
+	}
+	a.summary.Entries++
+
+	// Framed entries span several lines of the file
+	if end := entry.LineNumber + 1 + int64(strings.Count(entry.Line, "\n")); end > a.next {
+		a.next = end
+	}
+	a.last = entry
+	return nil
+}
@@ -0,0 +1,279 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/ids"
+	"github.com/oicur0t/logl/pkg/models"
+	"github.com/oicur0t/logl/pkg/retry"
+	"go.uber.org/zap"
+)
+
+// forwardTarget is a webhook with its filter compiled and its queue of
+// entries waiting to be sent
+type forwardTarget struct {
+	config.ForwardTargetConfig
+	matcher    *entryMatcher
+	queue      chan queuedEntry
+	httpClient *http.Client
+
+	sent     atomic.Int64
+	dropped  atomic.Int64
+	failed   atomic.Int64
+	progress *outputProgress
+
+	mu          sync.Mutex
+	lastError   string
+	lastErrorAt time.Time
+}
+
+// queuedEntry is an entry with the time it was queued
+type queuedEntry struct {
+	entry    models.LogEntry
+	queuedAt time.Time
+}
+
+// forwardPayload is the body of a forwarded batch
+type forwardPayload struct {
+	Target     string            `json:"target"`
+	DeliveryID string            `json:"delivery_id"` // The same across retries of a batch
+	Count      int               `json:"count"`
+	Entries    []models.LogEntry `json:"entries"`
+}
+
+// Forwarder sends ingested entries matching each target's filter to its
+// webhook in batches. Each target has its own queue and sender, so a slow
+// webhook only delays and, once its queue is full, drops its own entries.
+type Forwarder struct {
+	targets     []*forwardTarget
+	deliveryIDs ids.UUIDv7
+	logger      *zap.Logger
+}
+
+// NewForwarder creates a new forwarder, compiling the targets' filters
+func NewForwarder(cfg config.ForwardingConfig, logger *zap.Logger) (*Forwarder, error) {
+	f := &Forwarder{logger: logger}
+	for _, tc := range cfg.Targets {
+		matcher, err := newEntryMatcher(tc.EntryFilterConfig)
+		if err != nil {
+			return nil, fmt.Errorf("forwarding target %s: %w", tc.Name, err)
+		}
+		f.targets = append(f.targets, &forwardTarget{
+			ForwardTargetConfig: tc,
+			matcher:             matcher,
+			queue:               make(chan queuedEntry, tc.QueueSize),
+			httpClient:          &http.Client{Timeout: tc.Timeout},
+			progress:            newOutputProgress(tc.QueueSize),
+		})
+	}
+	return f, nil
+}
+
+// Forward queues a batch's matching entries for each target, dropping
+// them when a target's queue is full
+func (f *Forwarder) Forward(batch models.LogBatch) {
+	for _, t := range f.targets {
+		if !t.matcher.matchesService(batch.ServiceName) {
+			continue
+		}
+		for i := range batch.Entries {
+			if !t.matcher.matches(&batch.Entries[i]) {
+				continue
+			}
+			select {
+			case t.queue <- queuedEntry{entry: batch.Entries[i], queuedAt: time.Now()}:
+			default:
+				t.dropped.Add(1)
+			}
+		}
+	}
+}
+
+// Start sends each target's batches until the context is cancelled, then
+// makes one attempt to send what is still queued
+func (f *Forwarder) Start(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, t := range f.targets {
+		wg.Add(1)
+		go func(t *forwardTarget) {
+			defer wg.Done()
+			f.run(ctx, t)
+		}(t)
+	}
+	wg.Wait()
+}
+
+// run batches a target's queue, sending when a batch is full or the
+// flush interval passes
+func (f *Forwarder) run(ctx context.Context, t *forwardTarget) {
+	ticker := time.NewTicker(t.FlushInterval)
+	defer ticker.Stop()
+
+	retryConfig := retry.Config{
+		MaxRetries:  t.MaxRetries,
+		InitialWait: time.Second,
+		MaxWait:     30 * time.Second,
+		Multiplier:  2.0,
+	}
+	entries := make([]models.LogEntry, 0, t.BatchSize)
+	var reportedDrops int64
+
+	for {
+		select {
+		case queued := <-t.queue:
+			t.progress.queued(queued.queuedAt)
+			entries = append(entries, queued.entry)
+			if len(entries) >= t.BatchSize {
+				f.deliver(ctx, t, entries, retryConfig)
+				entries = make([]models.LogEntry, 0, t.BatchSize)
+			}
+		case <-ticker.C:
+			if len(entries) > 0 {
+				f.deliver(ctx, t, entries, retryConfig)
+				entries = make([]models.LogEntry, 0, t.BatchSize)
+			}
+			if dropped := t.dropped.Load(); dropped > reportedDrops {
+				f.logger.Warn("Forwarding queue full, dropped entries",
+					zap.String("target", t.Name),
+					zap.Int64("dropped", dropped-reportedDrops))
+				reportedDrops = dropped
+			}
+			t.progress.checkBacklog(len(t.queue), f.logger, zap.String("output", "forward:"+t.Name))
+		case <-ctx.Done():
+		drain:
+			for {
+				select {
+				case queued := <-t.queue:
+					t.progress.queued(queued.queuedAt)
+					entries = append(entries, queued.entry)
+				default:
+					break drain
+				}
+			}
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), t.Timeout)
+			for len(entries) > 0 && shutdownCtx.Err() == nil {
+				n := min(len(entries), t.BatchSize)
+				f.deliver(shutdownCtx, t, entries[:n], retry.Config{})
+				entries = entries[n:]
+			}
+			cancel()
+			return
+		}
+	}
+}
+
+// deliver sends a batch to a target, retrying with backoff, and records
+// the outcome
+func (f *Forwarder) deliver(ctx context.Context, t *forwardTarget, entries []models.LogEntry, retryConfig retry.Config) {
+	body, err := json.Marshal(forwardPayload{
+		Target:     t.Name,
+		DeliveryID: f.deliveryIDs.New(),
+		Count:      len(entries),
+		Entries:    entries,
+	})
+	if err != nil {
+		t.recordFailure(len(entries), fmt.Errorf("failed to marshal batch: %w", err))
+		t.progress.finish(0)
+		return
+	}
+
+	t.progress.send(len(entries))
+	err = retry.Do(ctx, retryConfig, func() error {
+		err := t.post(ctx, body)
+		if err != nil {
+			t.progress.attemptsFailed(1, len(entries))
+		}
+		return err
+	})
+	if err != nil {
+		t.recordFailure(len(entries), err)
+		t.progress.finish(0)
+		f.logger.Error("Failed to forward entries",
+			zap.String("target", t.Name),
+			zap.Int("entries", len(entries)),
+			zap.Error(err))
+		return
+	}
+	t.sent.Add(int64(len(entries)))
+	t.progress.finish(len(entries))
+}
+
+// post sends one request, signed when the target has a secret
+func (t *forwardTarget) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if t.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Logl-Timestamp", timestamp)
+		req.Header.Set("X-Logl-Signature", "sha256="+signForward(t.Secret, timestamp, body))
+	}
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// signForward returns the hex HMAC-SHA256 of "<timestamp>.<body>". Signing
+// the timestamp lets receivers reject replayed requests.
+func signForward(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// recordFailure counts entries that could not be delivered
+func (t *forwardTarget) recordFailure(entries int, err error) {
+	t.failed.Add(int64(entries))
+	t.mu.Lock()
+	t.lastError = err.Error()
+	t.lastErrorAt = time.Now()
+	t.mu.Unlock()
+}
+
+// Status returns each target's delivery counters
+func (f *Forwarder) Status() []models.ForwardTargetStatus {
+	statuses := make([]models.ForwardTargetStatus, 0, len(f.targets))
+	for _, t := range f.targets {
+		status := models.ForwardTargetStatus{
+			Name:    t.Name,
+			Queued:  len(t.queue),
+			Sent:    t.sent.Load(),
+			Dropped: t.dropped.Load(),
+			Failed:  t.failed.Load(),
+		}
+		status.OutputProgress = t.progress.status(status.Queued)
+		t.mu.Lock()
+		if t.lastError != "" {
+			at := t.lastErrorAt
+			status.LastError = t.lastError
+			status.LastErrorAt = &at
+		}
+		t.mu.Unlock()
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/geoip"
+	"github.com/oicur0t/logl/pkg/models"
+)
+
+// GeoIP holds the MaxMind databases used by geoip stages
+type GeoIP struct {
+	city *geoip.Reader // nil when no city database is configured
+	asn  *geoip.Reader // nil when no ASN database is configured
+}
+
+// NewGeoIP opens the configured databases. It returns nil when none are configured.
+func NewGeoIP(cfg config.GeoIPConfig) (*GeoIP, error) {
+	g := &GeoIP{}
+	var err error
+
+	if cfg.CityDatabase != "" {
+		if g.city, err = geoip.Open(cfg.CityDatabase); err != nil {
+			return nil, fmt.Errorf("failed to open city database: %w", err)
+		}
+	}
+	if cfg.ASNDatabase != "" {
+		if g.asn, err = geoip.Open(cfg.ASNDatabase); err != nil {
+			return nil, fmt.Errorf("failed to open ASN database: %w", err)
+		}
+	}
+
+	if g.city == nil && g.asn == nil {
+		return nil, nil
+	}
+	return g, nil
+}
+
+// Lookup returns country, city, and ASN fields for an IP
+func (g *GeoIP) Lookup(ip net.IP) map[string]interface{} {
+	fields := make(map[string]interface{})
+
+	if g.city != nil {
+		if record, err := g.city.Lookup(ip); err == nil && record != nil {
+			if v, ok := lookupParsed(record, "country.iso_code").(string); ok {
+				fields["country"] = v
+			}
+			if v, ok := lookupParsed(record, "country.names.en").(string); ok {
+				fields["country_name"] = v
+			}
+			if v, ok := lookupParsed(record, "city.names.en").(string); ok {
+				fields["city"] = v
+			}
+			if v, ok := lookupParsed(record, "location.latitude").(float64); ok {
+				fields["latitude"] = v
+			}
+			if v, ok := lookupParsed(record, "location.longitude").(float64); ok {
+				fields["longitude"] = v
+			}
+		}
+	}
+
+	if g.asn != nil {
+		if record, err := g.asn.Lookup(ip); err == nil && record != nil {
+			if v, ok := record["autonomous_system_number"].(uint64); ok {
+				fields["asn"] = int64(v)
+			}
+			if v, ok := record["autonomous_system_organization"].(string); ok {
+				fields["as_org"] = v
+			}
+		}
+	}
+
+	return fields
+}
+
+// geoIPStage enriches entries with the location of an IP held in a parsed field
+type geoIPStage struct {
+	geo    *GeoIP
+	field  string
+	target string
+}
+
+// Apply implements Stage
+func (s *geoIPStage) Apply(entry *models.LogEntry) {
+	text, ok := lookupParsed(entry.Parsed, s.field).(string)
+	if !ok {
+		return
+	}
+	ip := net.ParseIP(text)
+	if ip == nil || ip.IsPrivate() || ip.IsLoopback() {
+		return
+	}
+
+	if fields := s.geo.Lookup(ip); len(fields) > 0 {
+		setParsed(entry, s.target, fields)
+	}
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/oicur0t/logl/internal/config"
+)
+
+// grokReference matches %{PATTERN} and %{PATTERN:field} references
+var grokReference = regexp.MustCompile(`%\{(\w+)(?::(\w+))?\}`)
+
+// grokPatternName matches valid user-defined pattern names
+var grokPatternName = regexp.MustCompile(`^\w+$`)
+
+// grokBuiltins is the bundled pattern library
+var grokBuiltins = map[string]string{
+	// Base patterns
+	"WORD":         `\b\w+\b`,
+	"NOTSPACE":     `\S+`,
+	"SPACE":        `\s*`,
+	"DATA":         `.*?`,
+	"GREEDYDATA":   `.*`,
+	"INT":          `[+-]?\d+`,
+	"NUMBER":       `[+-]?(?:\d+(?:\.\d*)?|\.\d+)`,
+	"QUOTEDSTRING": `"(?:[^"\\]|\\.)*"`,
+	"UUID":         `[A-Fa-f0-9]{8}-(?:[A-Fa-f0-9]{4}-){3}[A-Fa-f0-9]{12}`,
+	"USER":         `[a-zA-Z0-9._-]+`,
+	"IPV4":         `(?:\d{1,3}\.){3}\d{1,3}`,
+	"IPV6":         `[0-9A-Fa-f:]*:[0-9A-Fa-f:.]+`,
+	"IP":           `(?:%{IPV6}|%{IPV4})`,
+	"HOSTNAME":     `\b[0-9A-Za-z][0-9A-Za-z-]{0,62}(?:\.[0-9A-Za-z][0-9A-Za-z-]{0,62})*\.?\b`,
+	"IPORHOST":     `(?:%{IP}|%{HOSTNAME})`,
+	"URIPATHPARAM": `\S+`,
+	"LOGLEVEL":     `(?i:trace|debug|info|notice|warn(?:ing)?|err(?:or)?|crit(?:ical)?|fatal|panic|emerg|severe)`,
+	"JAVACLASS":    `(?:[a-zA-Z$_][a-zA-Z$_0-9]*\.)*[a-zA-Z$_][a-zA-Z$_0-9]*`,
+	"GOFILE":       `[\w./-]+\.go:\d+`,
+
+	// Dates and times
+	"MONTH":             `\b(?:Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec)[a-z]*\b`,
+	"MONTHDAY":          `(?:0[1-9]|[12]\d|3[01]|[1-9])`,
+	"YEAR":              `\d{4}`,
+	"TIME":              `\d{2}:\d{2}:\d{2}(?:[.,]\d+)?`,
+	"TIMESTAMP_ISO8601": `\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}(?::\d{2}(?:[.,]\d+)?)?(?:Z|[+-]\d{2}:?\d{2})?`,
+	"HTTPDATE":          `%{MONTHDAY}/%{MONTH}/%{YEAR}:%{TIME} [+-]\d{4}`,
+	"SYSLOGTIMESTAMP":   `%{MONTH} +%{MONTHDAY} %{TIME}`,
+
+	// nginx and apache access logs
+	"COMMONAPACHELOG":   `%{IPORHOST:client_ip} %{NOTSPACE:ident} %{NOTSPACE:auth} \[%{HTTPDATE:time}\] "(?:%{WORD:method} %{NOTSPACE:path}(?: HTTP/%{NUMBER:http_version})?|%{DATA:request})" %{INT:status} (?:%{INT:bytes}|-)`,
+	"COMBINEDAPACHELOG": `%{COMMONAPACHELOG} "%{DATA:referrer}" "%{DATA:user_agent}"`,
+	"NGINXACCESS":       `%{COMBINEDAPACHELOG}`,
+	"NGINXERROR":        `(?P<time>\d{4}/\d{2}/\d{2} %{TIME}) \[%{LOGLEVEL:level}\] %{INT:pid}#%{INT:tid}: (?:\*%{INT:connection_id} )?%{GREEDYDATA:message}`,
+	"APACHEERROR":       `\[(?P<time>[^\]]+)\] \[(?:%{WORD:module}:)?%{LOGLEVEL:level}\] (?:\[pid %{INT:pid}(?::tid %{INT:tid})?\] )?(?:\[client %{NOTSPACE:client}\] )?%{GREEDYDATA:message}`,
+
+	// syslog
+	"PROG":       `[^\s\[\]:]+`,
+	"SYSLOGPROG": `%{PROG:program}(?:\[%{INT:pid}\])?`,
+	"SYSLOGLINE": `(?:<%{INT:priority}>)?%{SYSLOGTIMESTAMP:time} %{IPORHOST:host} %{SYSLOGPROG}: %{GREEDYDATA:message}`,
+	"SYSLOG5424": `<%{INT:priority}>%{INT:version} %{TIMESTAMP_ISO8601:time} %{NOTSPACE:host} %{NOTSPACE:app} %{NOTSPACE:pid} %{NOTSPACE:msgid} (?:-|\[.*?\]) ?%{GREEDYDATA:message}`,
+
+	// Go standard log and zap console encoders
+	"GOLOG": `(?P<time>\d{4}/\d{2}/\d{2} %{TIME})(?: %{GOFILE:caller}:)? %{GREEDYDATA:message}`,
+	"GOZAP": `%{TIMESTAMP_ISO8601:time}\s+%{LOGLEVEL:level}\s+(?:%{GOFILE:caller}\s+)?%{GREEDYDATA:message}`,
+
+	// Java logback/log4j default layouts
+	"JAVALOG":        `%{TIMESTAMP_ISO8601:time}\s+\[%{DATA:thread}\]\s+%{LOGLEVEL:level}\s+%{JAVACLASS:logger}\s+-\s+%{GREEDYDATA:message}`,
+	"JAVALOG4J":      `%{TIMESTAMP_ISO8601:time}\s+%{LOGLEVEL:level}\s+\[%{DATA:thread}\]\s+%{JAVACLASS:logger}(?::%{INT:line})?\s+-\s+%{GREEDYDATA:message}`,
+	"JAVASTACKTRACE": `\s+at %{JAVACLASS:class}\.(?P<method>[\w$<>]+)\((?P<source>[^)]*)\)`,
+}
+
+// maxGrokDepth bounds pattern expansion to catch recursive definitions
+const maxGrokDepth = 16
+
+// GrokLibrary resolves pattern references in grok expressions
+type GrokLibrary struct {
+	patterns map[string]string
+}
+
+// NewGrokLibrary creates a library of the bundled patterns plus custom
+// ones, which may reference bundled patterns and override them by name
+func NewGrokLibrary(custom []config.GrokPatternConfig) (*GrokLibrary, error) {
+	patterns := make(map[string]string, len(grokBuiltins)+len(custom))
+	for name, pattern := range grokBuiltins {
+		patterns[name] = pattern
+	}
+
+	for _, c := range custom {
+		if !grokPatternName.MatchString(c.Name) {
+			return nil, fmt.Errorf("invalid grok pattern name %q", c.Name)
+		}
+		if c.Pattern == "" {
+			return nil, fmt.Errorf("grok pattern %s is empty", c.Name)
+		}
+		patterns[c.Name] = c.Pattern
+	}
+
+	lib := &GrokLibrary{patterns: patterns}
+
+	// Expand custom patterns up front so mistakes fail at startup
+	for _, c := range custom {
+		if _, err := lib.Compile(c.Pattern); err != nil {
+			return nil, fmt.Errorf("grok pattern %s: %w", c.Name, err)
+		}
+	}
+	return lib, nil
+}
+
+// Compile expands a grok expression into a regular expression whose
+// named groups are the expression's field names
+func (l *GrokLibrary) Compile(expr string) (*regexp.Regexp, error) {
+	expanded, err := l.expand(expr, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	re, err := regexp.Compile(expanded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid grok expression: %w", err)
+	}
+	return re, nil
+}
+
+// expand replaces pattern references with their definitions
+func (l *GrokLibrary) expand(expr string, depth int) (string, error) {
+	if depth > maxGrokDepth {
+		return "", fmt.Errorf("grok patterns nested too deeply")
+	}
+
+	var expandErr error
+	expanded := grokReference.ReplaceAllStringFunc(expr, func(ref string) string {
+		parts := grokReference.FindStringSubmatch(ref)
+		name, field := parts[1], parts[2]
+
+		definition, exists := l.patterns[name]
+		if !exists {
+			expandErr = fmt.Errorf("unknown grok pattern %s", name)
+			return ""
+		}
+		inner, err := l.expand(definition, depth+1)
+		if err != nil {
+			expandErr = err
+			return ""
+		}
+
+		if field == "" {
+			return "(?:" + inner + ")"
+		}
+		return "(?P<" + field + ">" + inner + ")"
+	})
+	if expandErr != nil {
+		return "", expandErr
+	}
+	return expanded, nil
+}
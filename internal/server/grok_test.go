@@ -0,0 +1,252 @@
+package server
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/oicur0t/logl/internal/config"
+)
+
+// grokFields returns the named groups a compiled grok expression captures
+// from a line, or nil if it doesn't match
+func grokFields(re *regexp.Regexp, line string) map[string]string {
+	match := re.FindStringSubmatch(line)
+	if match == nil {
+		return nil
+	}
+	fields := make(map[string]string)
+	for i, name := range re.SubexpNames() {
+		if name != "" && match[i] != "" {
+			fields[name] = match[i]
+		}
+	}
+	return fields
+}
+
+func TestGrokBuiltinsCompile(t *testing.T) {
+	lib, err := NewGrokLibrary(nil)
+	if err != nil {
+		t.Fatalf("NewGrokLibrary: %v", err)
+	}
+	for name := range grokBuiltins {
+		if _, err := lib.Compile("%{" + name + "}"); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestGrokCompile(t *testing.T) {
+	lib, err := NewGrokLibrary([]config.GrokPatternConfig{
+		{Name: "REQUESTID", Pattern: `req-%{INT}`},
+		{Name: "TAGGED", Pattern: `%{REQUESTID:request_id} %{IPORHOST:peer}`},
+	})
+	if err != nil {
+		t.Fatalf("NewGrokLibrary: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		line string
+		want map[string]string // nil when the line must not match
+	}{
+		{
+			name: "combined apache log",
+			expr: "%{COMBINEDAPACHELOG}",
+			line: `203.0.113.9 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08 [en] (Win98; I ;Nav)"`,
+			want: map[string]string{
+				"client_ip": "203.0.113.9", "ident": "-", "auth": "frank", "time": "10/Oct/2000:13:55:36 -0700",
+				"method": "GET", "path": "/apache_pb.gif", "http_version": "1.0", "status": "200", "bytes": "2326",
+				"referrer": "http://www.example.com/start.html", "user_agent": "Mozilla/4.08 [en] (Win98; I ;Nav)",
+			},
+		},
+		{
+			name: "nested IPv6 client and no bytes",
+			expr: "%{NGINXACCESS}",
+			line: `2001:db8::1 - - [02/Jan/2024:03:04:05 +0000] "GET / HTTP/1.1" 304 - "-" "curl/8.0"`,
+			want: map[string]string{
+				"client_ip": "2001:db8::1", "ident": "-", "auth": "-", "time": "02/Jan/2024:03:04:05 +0000",
+				"method": "GET", "path": "/", "http_version": "1.1", "status": "304", "referrer": "-", "user_agent": "curl/8.0",
+			},
+		},
+		{
+			name: "malformed request line",
+			expr: "%{COMMONAPACHELOG}",
+			line: `host.example.com - - [02/Jan/2024:03:04:05 +0000] "\x16\x03\x01" 400 0`,
+			want: map[string]string{
+				"client_ip": "host.example.com", "ident": "-", "auth": "-", "time": "02/Jan/2024:03:04:05 +0000",
+				"request": `\x16\x03\x01`, "status": "400", "bytes": "0",
+			},
+		},
+		{
+			name: "nginx error",
+			expr: "%{NGINXERROR}",
+			line: `2024/01/02 03:04:05 [error] 123#0: *45 open() "/srv/x" failed (2: No such file or directory), client: 1.2.3.4`,
+			want: map[string]string{
+				"time": "2024/01/02 03:04:05", "level": "error", "pid": "123", "tid": "0", "connection_id": "45",
+				"message": `open() "/srv/x" failed (2: No such file or directory), client: 1.2.3.4`,
+			},
+		},
+		{
+			name: "syslog with priority and pid",
+			expr: "%{SYSLOGLINE}",
+			line: `<34>Oct 11 22:14:15 mymachine su[230]: 'su root' failed for lonvick on /dev/pts/8`,
+			want: map[string]string{
+				"priority": "34", "time": "Oct 11 22:14:15", "host": "mymachine", "program": "su", "pid": "230",
+				"message": "'su root' failed for lonvick on /dev/pts/8",
+			},
+		},
+		{
+			name: "syslog with single digit day",
+			expr: "%{SYSLOGLINE}",
+			line: `Feb  3 01:02:03 web-1 cron: job done`,
+			want: map[string]string{"time": "Feb  3 01:02:03", "host": "web-1", "program": "cron", "message": "job done"},
+		},
+		{
+			name: "RFC 5424 syslog with structured data",
+			expr: "%{SYSLOG5424}",
+			line: `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="Application"] An application event`,
+			want: map[string]string{
+				"priority": "165", "version": "1", "time": "2003-10-11T22:14:15.003Z", "host": "mymachine.example.com",
+				"app": "evntslog", "pid": "-", "msgid": "ID47", "message": "An application event",
+			},
+		},
+		{
+			name: "not a syslog line",
+			expr: "^%{SYSLOGLINE}",
+			line: `GET / HTTP/1.1`,
+		},
+		{
+			name: "zap console",
+			expr: "%{GOZAP}",
+			line: "2024-01-02T03:04:05.678Z\tINFO\tserver/main.go:42\tstarted listening",
+			want: map[string]string{"time": "2024-01-02T03:04:05.678Z", "level": "INFO", "caller": "server/main.go:42", "message": "started listening"},
+		},
+		{
+			name: "logback",
+			expr: "%{JAVALOG}",
+			line: `2024-01-02 03:04:05,678 [http-nio-8080-exec-1] ERROR com.example.App$Inner - boom`,
+			want: map[string]string{
+				"time": "2024-01-02 03:04:05,678", "thread": "http-nio-8080-exec-1", "level": "ERROR",
+				"logger": "com.example.App$Inner", "message": "boom",
+			},
+		},
+		{
+			name: "java stack frame",
+			expr: "%{JAVASTACKTRACE}",
+			line: "\tat com.example.App.<init>(App.java:12)",
+			want: map[string]string{"class": "com.example.App", "method": "<init>", "source": "App.java:12"},
+		},
+		{
+			name: "custom patterns nested in custom patterns",
+			expr: `%{TAGGED} %{GREEDYDATA:rest}`,
+			line: `req-42 10.0.0.1 hello`,
+			want: map[string]string{"request_id": "req-42", "peer": "10.0.0.1", "rest": "hello"},
+		},
+		{
+			name: "escaped quotes in a quoted string",
+			expr: `%{QUOTEDSTRING:quoted} %{GREEDYDATA:rest}`,
+			line: `"say \"hi\" \\ now" tail`,
+			want: map[string]string{"quoted": `"say \"hi\" \\ now"`, "rest": "tail"},
+		},
+		{
+			name: "escaped regex metacharacters around references",
+			expr: `\[%{WORD:a}\] \{%{INT:b}\} \(%{NUMBER:c}\)`,
+			line: `[abc] {-5} (1.25)`,
+			want: map[string]string{"a": "abc", "b": "-5", "c": "1.25"},
+		},
+		{
+			name: "literal percent and braces that aren't references",
+			expr: `100% %{WORD:w} %{} %{`,
+			line: `100% done %{} %{`,
+			want: map[string]string{"w": "done"},
+		},
+		{
+			name: "regex named groups alongside grok fields",
+			expr: `(?P<day>\d+)/%{MONTH:month}`,
+			line: `10/Oct`,
+			want: map[string]string{"day": "10", "month": "Oct"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			re, err := lib.Compile(tt.expr)
+			if err != nil {
+				t.Fatalf("Compile(%q): %v", tt.expr, err)
+			}
+			got := grokFields(re, tt.line)
+			if tt.want == nil {
+				if got != nil {
+					t.Fatalf("matched %q with %v, want no match", tt.line, got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatalf("no match for %q with %s", tt.line, re)
+			}
+			for field, want := range tt.want {
+				if got[field] != want {
+					t.Errorf("%s = %q, want %q", field, got[field], want)
+				}
+			}
+			for field := range got {
+				if _, ok := tt.want[field]; !ok {
+					t.Errorf("unexpected field %s = %q", field, got[field])
+				}
+			}
+		})
+	}
+}
+
+func TestGrokOverride(t *testing.T) {
+	// Overrides apply to the builtins that reference the pattern too
+	lib, err := NewGrokLibrary([]config.GrokPatternConfig{{Name: "WORD", Pattern: `[a-z]+`}})
+	if err != nil {
+		t.Fatalf("NewGrokLibrary: %v", err)
+	}
+	re, err := lib.Compile("%{COMMONAPACHELOG}")
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	got := grokFields(re, `10.0.0.1 - - [02/Jan/2024:03:04:05 +0000] "GET / HTTP/1.1" 200 5`)
+	if got["method"] != "" || got["request"] != "GET / HTTP/1.1" {
+		t.Errorf("fields = %v, want the request unparsed", got)
+	}
+	if got := grokFields(re, `10.0.0.1 - - [02/Jan/2024:03:04:05 +0000] "get / HTTP/1.1" 200 5`); got["method"] != "get" {
+		t.Errorf("fields = %v, want method get", got)
+	}
+}
+
+func TestGrokErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		custom []config.GrokPatternConfig
+		expr   string
+	}{
+		{name: "unknown pattern", expr: "%{NOPE:x}"},
+		{name: "unknown pattern nested in a custom one", custom: []config.GrokPatternConfig{{Name: "OUTER", Pattern: "%{NOPE}"}}},
+		{name: "recursive patterns", custom: []config.GrokPatternConfig{{Name: "A", Pattern: "a%{B}"}, {Name: "B", Pattern: "b%{A}"}}},
+		{name: "self reference", custom: []config.GrokPatternConfig{{Name: "LOOP", Pattern: "x%{LOOP}"}}},
+		{name: "invalid name", custom: []config.GrokPatternConfig{{Name: "BAD-NAME", Pattern: "x"}}},
+		{name: "empty pattern", custom: []config.GrokPatternConfig{{Name: "EMPTY", Pattern: ""}}},
+		{name: "invalid regex in a custom pattern", custom: []config.GrokPatternConfig{{Name: "BROKEN", Pattern: "(unclosed"}}},
+		{name: "invalid regex in the expression", expr: `%{WORD:w} [`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lib, err := NewGrokLibrary(tt.custom)
+			if tt.expr == "" {
+				if err == nil {
+					t.Fatal("NewGrokLibrary succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewGrokLibrary: %v", err)
+			}
+			if _, err := lib.Compile(tt.expr); err == nil {
+				t.Errorf("Compile(%q) succeeded", tt.expr)
+			}
+		})
+	}
+}
@@ -1,9 +1,18 @@
 package server
 
 import (
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/oicur0t/logl/pkg/models"
 	"go.uber.org/zap"
@@ -11,75 +20,2332 @@ import (
 
 // Handler handles HTTP requests
 type Handler struct {
-	storage *Storage
-	parser  *LogParser
-	logger  *zap.Logger
+	storage    *Storage
+	parser     *LogParser
+	auditor    *QueryAuditor // nil when query auditing is disabled
+	quotas     *QuotaManager // nil when quotas are disabled
+	reparser   *Reparser
+	relabeler  *Relabeler
+	liveTail   *LiveTail          // nil when live tail is disabled
+	tokens     *TokenManager      // nil when access tokens are disabled
+	redactor   *Redactor          // nil when no redaction rules are configured
+	rollups    *Rollups           // nil when rollups are disabled
+	delivery   *DeliveryTracker   // nil when delivery tracking is disabled
+	dedup      *Deduplicator      // nil when dedup is disabled
+	certs      *CertMonitor       // nil when mTLS or certificate monitoring is disabled
+	buffer     *WriteBuffer       // nil when the write buffer is disabled
+	dicts      *DictionaryTrainer // nil when dictionary training is disabled
+	patterns   *PatternDiffer
+	maint      *MaintenanceManager // nil when maintenance windows are disabled
+	faults     *FaultInjector      // nil unless built with the faults tag
+	heroku     *HerokuDrains       // nil when Heroku drains are disabled
+	metrics    *ServerMetrics      // nil when metrics history is disabled
+	alerts     *Alerter            // nil when alerting is disabled
+	preParsed  *PreParsedTrust     // nil when pre-parsed batches are parsed like any other
+	fields     *FieldCatalog       // nil when autocomplete is disabled
+	forwarder  *Forwarder          // nil when forwarding is disabled
+	kafka      *KafkaOutput        // nil when the Kafka output is disabled
+	nats       *NATSOutput         // nil when the NATS output is disabled
+	region     *RegionPolicy       // nil when the server has no region
+	router     *Router             // nil when routing is disabled
+	throttle   *IngestThrottle     // nil when throttling is disabled
+	tenancy    *Tenancy            // nil when tenancy is disabled
+	limits     *IngestLimits       // nil when ingest requests are unlimited
+	queryLimit int64
+	unusedDays int
+	logger     *zap.Logger
 }
 
 // NewHandler creates a new HTTP handler
-func NewHandler(storage *Storage, parser *LogParser, logger *zap.Logger) *Handler {
+func NewHandler(storage *Storage, parser *LogParser, auditor *QueryAuditor, quotas *QuotaManager, reparser *Reparser, relabeler *Relabeler, liveTail *LiveTail, tokens *TokenManager, redactor *Redactor, rollups *Rollups, delivery *DeliveryTracker, dedup *Deduplicator, certs *CertMonitor, buffer *WriteBuffer, dicts *DictionaryTrainer, patterns *PatternDiffer, maint *MaintenanceManager, faults *FaultInjector, heroku *HerokuDrains, metrics *ServerMetrics, alerts *Alerter, preParsed *PreParsedTrust, fields *FieldCatalog, forwarder *Forwarder, kafka *KafkaOutput, nats *NATSOutput, region *RegionPolicy, router *Router, throttle *IngestThrottle, tenancy *Tenancy, limits *IngestLimits, queryLimit int64, unusedDays int, logger *zap.Logger) *Handler {
 	return &Handler{
-		storage: storage,
-		parser:  parser,
-		logger:  logger,
+		storage:    storage,
+		parser:     parser,
+		auditor:    auditor,
+		quotas:     quotas,
+		reparser:   reparser,
+		relabeler:  relabeler,
+		liveTail:   liveTail,
+		tokens:     tokens,
+		redactor:   redactor,
+		rollups:    rollups,
+		delivery:   delivery,
+		dedup:      dedup,
+		certs:      certs,
+		buffer:     buffer,
+		dicts:      dicts,
+		patterns:   patterns,
+		maint:      maint,
+		faults:     faults,
+		heroku:     heroku,
+		metrics:    metrics,
+		alerts:     alerts,
+		preParsed:  preParsed,
+		fields:     fields,
+		forwarder:  forwarder,
+		kafka:      kafka,
+		nats:       nats,
+		region:     region,
+		router:     router,
+		throttle:   throttle,
+		tenancy:    tenancy,
+		limits:     limits,
+		queryLimit: queryLimit,
+		unusedDays: unusedDays,
+		logger:     logger,
 	}
 }
 
-// IngestLogs handles log ingestion requests
+// IngestLogs handles log ingestion requests, as a LogBatch or CloudEvents
 func (h *Handler) IngestLogs(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if h.limits != nil {
+		h.limits.LimitBody(w, r)
+	}
+	if isCloudEventsRequest(r) {
+		h.ingestCloudEvents(w, r)
 		return
 	}
 
 	// Decode the request body
 	var batch models.LogBatch
 	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		if h.rejectOverLimit(w, r, h.bodyLimitError(err)) {
+			return
+		}
 		h.logger.Error("Failed to decode request", zap.Error(err))
-		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %v", err))
 		return
 	}
 	defer r.Body.Close()
 
 	// Validate batch
 	if batch.ServiceName == "" {
-		http.Error(w, "service_name is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "service_name is required")
 		return
 	}
 
 	if len(batch.Entries) == 0 {
-		http.Error(w, "entries cannot be empty", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "entries cannot be empty")
 		return
 	}
 
+	h.ingestBatch(w, r, batch)
+}
+
+// ingestBatch stores a validated batch and writes the ingest response.
+// It is shared by every ingest path.
+func (h *Handler) ingestBatch(w http.ResponseWriter, r *http.Request, batch models.LogBatch) {
 	h.logger.Debug("Received batch",
 		zap.String("service", batch.ServiceName),
 		zap.Int("entries", len(batch.Entries)))
 
-	// Parse JSON logs if enabled
+	// Hash the content as sent, before parsing and redaction change it
+	contentHash := batch.HashContent()
+	if batch.ContentHash != "" && batch.ContentHash != contentHash {
+		writeErrorCode(w, http.StatusBadRequest, models.ErrCodeContentHashMismatch, "content_hash does not match entries")
+		return
+	}
+
+	// Reject oversized batches and cut long lines before anything holds on
+	// to them
+	truncated := 0
+	if h.limits != nil {
+		var limitErr *models.APIError
+		truncated, limitErr = h.limits.Check(&batch)
+		if h.rejectOverLimit(w, r, limitErr) {
+			return
+		}
+		if truncated > 0 {
+			h.logger.Debug("Truncated long lines",
+				zap.String("service", batch.ServiceName),
+				zap.Int("lines", truncated))
+		}
+	}
+
+	// Keep entries in the region they were produced in. Tailers take 421 as
+	// a cue to try another server.
+	if h.region != nil {
+		w.Header().Set("X-Logl-Region", h.region.Name())
+		if region, foreign := h.region.Foreign(batch); foreign {
+			writeErrorCode(w, http.StatusMisdirectedRequest, models.ErrCodeRegionMismatch, fmt.Sprintf("entries from region %s are not accepted in region %s", region, h.region.Name()))
+			return
+		}
+		h.region.Label(&batch)
+	}
+
+	// Record who sent each entry, replacing anything the client claimed
+	sender := ingestIdentity(r)
+	for i := range batch.Entries {
+		batch.Entries[i].IngestedBy = sender
+	}
+
+	// Keep tenants to their own services, claiming unowned ones for the sender
+	tenant := requestTenant(r)
+	if h.tenancy != nil {
+		owner, err := h.tenancy.Claim(r.Context(), batch.ServiceName, tenant, sender)
+		if err != nil {
+			h.logger.Error("Failed to check service owner", zap.String("service", batch.ServiceName), zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		if tenant != "" && owner != tenant && !h.tenancy.IsAdmin(tenant) {
+			writeErrorCode(w, http.StatusForbidden, models.ErrCodeWrongTenant, "Service is owned by another tenant")
+			return
+		}
+		for i := range batch.Entries {
+			batch.Entries[i].Tenant = owner
+		}
+		tenant = owner
+	}
+
+	// Acknowledge retries of batches that were already stored
+	claimed := false
+	if h.dedup != nil && batch.BatchID != "" {
+		claim, err := h.dedup.Claim(r.Context(), batch, contentHash)
+		if err != nil {
+			h.logger.Error("Failed to check batch for duplicates", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		switch claim {
+		case ClaimDuplicate:
+			h.logger.Info("Ignoring duplicate batch",
+				zap.String("service", batch.ServiceName),
+				zap.String("batch_id", batch.BatchID))
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status":   "duplicate",
+				"received": len(batch.Entries),
+			})
+			return
+		case ClaimInProgress:
+			w.Header().Set("Retry-After", "1")
+			writeErrorCode(w, http.StatusServiceUnavailable, models.ErrCodeBatchInProgress, "Batch is already being stored")
+			return
+		case ClaimConflict:
+			writeErrorCode(w, http.StatusConflict, models.ErrCodeBatchIDConflict, "batch_id was already used for different entries")
+			return
+		}
+		claimed = true
+	}
+	release := func() {
+		if claimed {
+			h.dedup.Release(context.Background(), batch.BatchID)
+		}
+	}
+
+	// Sample hosts under maintenance before they count against quotas
+	received := len(batch.Entries)
+	if h.maint != nil {
+		if dropped := h.maint.Sample(&batch); dropped > 0 {
+			h.logger.Debug("Sampled batch during maintenance",
+				zap.String("service", batch.ServiceName),
+				zap.Int("dropped", dropped))
+		}
+	}
+
+	// Enforce quotas, warning the tailer before it is cut off. Entries are
+	// charged once the batch is accepted, counted as they were checked,
+	// before the level sampling below.
+	quotaEntries := len(batch.Entries)
+	if h.quotas != nil {
+		status := h.quotas.Check(batch.ServiceName, quotaEntries)
+		if status.Limit > 0 {
+			w.Header().Set("X-Logl-Quota-Limit", strconv.FormatInt(status.Limit, 10))
+			w.Header().Set("X-Logl-Quota-Used", strconv.FormatInt(status.Used, 10))
+		}
+		if status.Warning {
+			w.Header().Set("X-Logl-Quota-Warning", "true")
+		}
+		if status.Exceeded {
+			release()
+			writeQuotaError(w, models.ErrCodeQuotaExceeded, "Quota exceeded", status)
+			return
+		}
+	}
+	if h.tenancy != nil && tenant != "" {
+		status := h.tenancy.CheckQuota(tenant, quotaEntries)
+		if status.Limit > 0 {
+			w.Header().Set("X-Logl-Tenant-Quota-Limit", strconv.FormatInt(status.Limit, 10))
+			w.Header().Set("X-Logl-Tenant-Quota-Used", strconv.FormatInt(status.Used, 10))
+		}
+		if status.Warning {
+			w.Header().Set("X-Logl-Tenant-Quota-Warning", "true")
+		}
+		if status.Exceeded {
+			release()
+			writeQuotaError(w, models.ErrCodeTenantQuotaExceeded, "Tenant quota exceeded", status)
+			return
+		}
+	}
+
+	// Correlate entries with the sender's trace, unless they carry their own
+	if trace, ok := traceContextFromHeaders(r.Header); ok {
+		for i := range batch.Entries {
+			if batch.Entries[i].TraceID == "" {
+				batch.Entries[i].TraceID = trace.TraceID
+				batch.Entries[i].SpanID = trace.SpanID
+			}
+		}
+	}
+
+	// Parse JSON logs if enabled, then mask sensitive data before storage.
+	// Batches trusted tailers already parsed skip the parsing pipeline.
+	preParsed := batch.PreParsed && h.preParsed != nil && h.preParsed.Trusts(r)
+	if batch.PreParsed && !preParsed {
+		h.logger.Debug("Parsing pre-parsed batch from untrusted client",
+			zap.String("service", batch.ServiceName),
+			zap.String("identity", clientIdentity(r)))
+	}
 	for i := range batch.Entries {
-		h.parser.ParseLogEntry(&batch.Entries[i])
+		if preParsed {
+			h.parser.AcceptPreParsed(&batch.Entries[i])
+		} else {
+			h.parser.ParseLogEntry(&batch.Entries[i])
+		}
+		if h.redactor != nil {
+			h.redactor.RedactEntry(&batch.Entries[i])
+		}
+	}
+
+	// Sample chatty levels, then hold the service to its entry rate. Both
+	// need the levels parsing detected.
+	if h.throttle != nil {
+		if dropped := h.throttle.Sample(&batch); dropped > 0 {
+			h.logger.Debug("Sampled batch",
+				zap.String("service", batch.ServiceName),
+				zap.Int("dropped", dropped))
+		}
+		if retryAfter, ok := h.throttle.Allow(batch.ServiceName, len(batch.Entries)); !ok {
+			release()
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			writeError(w, http.StatusTooManyRequests, "Entry rate limit exceeded")
+			return
+		}
+	}
+
+	// Split entries by the sinks routing rules send them to. Without
+	// routing, every entry is stored and published.
+	stored, kafkaBatch, natsBatch := batch, batch, batch
+	var routed map[string]models.LogBatch
+	if h.router != nil {
+		routed = h.router.Route(batch)
+		stored, kafkaBatch, natsBatch = routed[sinkMongo], routed[sinkKafka], routed[sinkNATS]
+	}
+
+	// Insert into MongoDB. While it is unavailable, batches queue in the
+	// write buffer (behind any already waiting) and are written later.
+	buffered := h.buffer != nil && h.buffer.Active() && len(stored.Entries) > 0
+	if !buffered && len(stored.Entries) > 0 {
+		if err := h.storage.InsertBatch(r.Context(), stored); err != nil {
+			if h.buffer == nil {
+				release()
+				h.logger.Error("Failed to insert batch", zap.Error(err))
+				writeError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			h.logger.Warn("Failed to insert batch, buffering until MongoDB recovers", zap.Error(err))
+			buffered = true
+		}
+	}
+	if buffered {
+		if err := h.buffer.Enqueue(stored); err != nil {
+			release()
+			h.logger.Error("Failed to buffer batch", zap.String("service", batch.ServiceName), zap.Error(err))
+			writeErrorCode(w, http.StatusServiceUnavailable, models.ErrCodeBufferFull, "Storage unavailable and write buffer full")
+			return
+		}
+	}
+
+	if claimed {
+		h.dedup.Commit(r.Context(), batch.BatchID)
+	}
+
+	// Count the accepted entries against quotas
+	if h.quotas != nil {
+		h.quotas.Charge(batch.ServiceName, quotaEntries)
+	}
+	if h.tenancy != nil && tenant != "" {
+		h.tenancy.ChargeQuota(tenant, quotaEntries)
+	}
+
+	// Count into per-minute rollups, whether the batch was stored or
+	// buffered
+	if h.rollups != nil {
+		h.rollups.Record(batch)
+	}
+
+	// Track batch sequence numbers for loss detection
+	if h.delivery != nil {
+		h.delivery.Record(batch)
+	}
+
+	// Fan out to live-tail sessions
+	if h.liveTail != nil {
+		h.liveTail.Publish(batch)
+	}
+
+	// Count matches for alerting rules
+	if h.alerts != nil {
+		h.alerts.Evaluate(batch)
+	}
+
+	// Queue matching entries for forwarding webhooks
+	if h.forwarder != nil {
+		h.forwarder.Forward(batch)
+	}
+
+	// Queue matching entries for Kafka
+	if h.kafka != nil && len(kafkaBatch.Entries) > 0 {
+		h.kafka.Publish(kafkaBatch)
+	}
+
+	// Queue matching entries for NATS JetStream
+	if h.nats != nil && len(natsBatch.Entries) > 0 {
+		h.nats.Publish(natsBatch)
+	}
+
+	// Queue routed entries for file and S3 sinks
+	if h.router != nil {
+		h.router.Deliver(routed)
+	}
+
+	if h.metrics != nil {
+		h.metrics.RecordIngest(len(batch.Entries))
+	}
+
+	// Return success; 202 when the batch is buffered rather than stored
+	status, statusCode := "success", http.StatusOK
+	if buffered {
+		status, statusCode = "buffered", http.StatusAccepted
+	}
+	response := map[string]interface{}{
+		"status":   status,
+		"received": received,
+	}
+	if truncated > 0 {
+		response["truncated"] = truncated
+	}
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(response)
+}
+
+// bodyLimitError returns the limit error for a failed body read, or nil
+// when the body wasn't too large
+func (h *Handler) bodyLimitError(err error) *models.APIError {
+	if h.limits == nil {
+		return nil
+	}
+	return h.limits.BodyError(err)
+}
+
+// rejectOverLimit answers a request that exceeded an ingest limit,
+// returning false when limitErr is nil
+func (h *Handler) rejectOverLimit(w http.ResponseWriter, r *http.Request, limitErr *models.APIError) bool {
+	if limitErr == nil {
+		return false
 	}
+	h.logger.Warn("Rejected ingest request over limit",
+		zap.String("identity", clientIdentity(r)),
+		zap.String("limit", limitErr.Code),
+		zap.Error(limitErr))
+	writeAPIError(w, http.StatusRequestEntityTooLarge, *limitErr)
+	return true
+}
 
-	// Insert into MongoDB
-	if err := h.storage.InsertBatch(r.Context(), batch); err != nil {
-		h.logger.Error("Failed to insert batch", zap.Error(err))
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+// QueryLogs handles log search requests
+func (h *Handler) QueryLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
-	// Return success
-	w.WriteHeader(http.StatusOK)
+	query, err := h.parseLogQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	collName := h.storage.CollectionFor(query.ServiceName)
+	filter := BuildQueryFilter(query)
+
+	start := time.Now()
+	entries, err := h.storage.FindServiceLogs(r.Context(), query.ServiceName, query.From, query.To, filter, query.Limit)
+	duration := time.Since(start)
+	if err != nil {
+		h.logger.Error("Failed to query logs", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	if h.auditor != nil {
+		h.auditor.Record(models.QueryAuditEntry{
+			Identity:     clientIdentity(r),
+			Collection:   collName,
+			Filter:       filter,
+			Limit:        query.Limit,
+			DocsReturned: len(entries),
+		}, duration)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":   "success",
-		"received": len(batch.Entries),
+		"entries": entries,
+		"count":   len(entries),
 	})
 }
 
-// Health handles health check requests
-func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{
-		"status": "healthy",
+// ExportLogs streams a service's entries matching the query filters as
+// NDJSON or CSV, oldest first, optionally gzipped. Entries are streamed as
+// they are read, so exports aren't capped by query.max_limit.
+func (h *Handler) ExportLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	query, err := h.parseLogQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params := r.URL.Query()
+	var limit int64
+	if v := params.Get("limit"); v != "" {
+		limit, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || limit <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid limit: %s", v))
+			return
+		}
+	}
+	format := params.Get("format")
+	if format == "" {
+		format = "ndjson"
+	}
+	compress := false
+	if v := params.Get("gzip"); v != "" {
+		if compress, err = strconv.ParseBool(v); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid gzip: %s", v))
+			return
+		}
+	}
+
+	filename := h.storage.CollectionFor(query.ServiceName) + "." + format
+	contentType := map[string]string{"ndjson": "application/x-ndjson", "csv": "text/csv"}[format]
+	var out io.Writer = w
+	var gz *gzip.Writer
+	if compress {
+		filename += ".gz"
+		contentType = "application/gzip"
+		gz = gzip.NewWriter(w)
+		out = gz
+	}
+
+	writer, err := newExportWriter(format, out)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	// Flush each batch so large exports stream instead of buffering
+	flusher, _ := w.(http.Flusher)
+	var pending int32
+	flush := func() error {
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+		if gz != nil {
+			if err := gz.Flush(); err != nil {
+				return err
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+
+	filter := BuildQueryFilter(query)
+	start := time.Now()
+	exported, err := h.storage.ExportServiceLogs(r.Context(), query.ServiceName, query.From, query.To, filter, limit, func(entry models.LogEntry) error {
+		if err := writer.Write(entry); err != nil {
+			return err
+		}
+		if pending++; pending >= h.storage.query.ExportBatch {
+			pending = 0
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err == nil && gz != nil {
+		err = gz.Close()
+	}
+	duration := time.Since(start)
+
+	// Headers are sent, so a failure can only cut the export short
+	if err != nil {
+		h.logger.Error("Export failed",
+			zap.String("service", query.ServiceName),
+			zap.Int64("exported", exported),
+			zap.Error(err))
+	}
+
+	if h.auditor != nil {
+		h.auditor.Record(models.QueryAuditEntry{
+			Identity:     clientIdentity(r),
+			Collection:   h.storage.CollectionFor(query.ServiceName),
+			Kind:         auditKindExport,
+			Filter:       filter,
+			Limit:        limit,
+			DocsReturned: int(exported),
+		}, duration)
+	}
+}
+
+// FileLines streams one host's file in line order, with markers where
+// lines are missing, so the file can be downloaded as it was written
+func (h *Handler) FileLines(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	query, err := h.parseLogQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if query.Hostname == "" || query.FilePath == "" {
+		writeError(w, http.StatusBadRequest, "hostname and file_path are required")
+		return
+	}
+	// Content filters would leave holes indistinguishable from lost lines
+	if query.Contains != "" || query.Search != "" || query.TraceID != "" || query.EntryID != "" || len(query.Levels) > 0 || len(query.Labels) > 0 {
+		writeError(w, http.StatusBadRequest, "file reads select by hostname, file_path, time, and line only")
+		return
+	}
+
+	params := r.URL.Query()
+	var fromLine, toLine int64
+	for name, dst := range map[string]*int64{"from_line": &fromLine, "to_line": &toLine} {
+		if v := params.Get(name); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n <= 0 {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid %s: %s", name, v))
+				return
+			}
+			*dst = n
+		}
+	}
+	if toLine > 0 && toLine < fromLine {
+		writeError(w, http.StatusBadRequest, "to_line must not be before from_line")
+		return
+	}
+	format := params.Get("format")
+	if format == "" {
+		format = "text"
+	}
+	markGaps := true
+	if v := params.Get("gaps"); v != "" {
+		switch v {
+		case "marker":
+		case "omit":
+			markGaps = false
+		default:
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid gaps: %s (expected marker or omit)", v))
+			return
+		}
+	}
+	compress := false
+	if v := params.Get("gzip"); v != "" {
+		if compress, err = strconv.ParseBool(v); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid gzip: %s", v))
+			return
+		}
+	}
+
+	filename := fileDownloadName(query.FilePath)
+	contentType := "text/plain; charset=utf-8"
+	if format == "ndjson" {
+		filename += ".ndjson"
+		contentType = "application/x-ndjson"
+	}
+	var out io.Writer = w
+	var gz *gzip.Writer
+	if compress {
+		filename += ".gz"
+		contentType = "application/gzip"
+		gz = gzip.NewWriter(w)
+		out = gz
+	}
+
+	writer, err := newFileLinesWriter(format, markGaps, out)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter := fileLinesFilter(query, fromLine, toLine)
+
+	// The summary is only known once the body is written
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Trailer", "X-Logl-Entries, X-Logl-Gaps, X-Logl-Missing-Lines, X-Logl-Duplicates")
+
+	flusher, _ := w.(http.Flusher)
+	var pending int32
+	flush := func() error {
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+		if gz != nil {
+			if err := gz.Flush(); err != nil {
+				return err
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+
+	reassembler := newFileReassembler(writer, fromLine)
+	start := time.Now()
+	read, err := h.storage.ReadFileLines(r.Context(), query.ServiceName, query.From, query.To, filter, func(entry models.LogEntry) error {
+		if err := reassembler.add(entry); err != nil {
+			return err
+		}
+		if pending++; pending >= h.storage.query.ExportBatch {
+			pending = 0
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err == nil && gz != nil {
+		err = gz.Close()
+	}
+	duration := time.Since(start)
+
+	summary := reassembler.summary
+	w.Header().Set("X-Logl-Entries", strconv.FormatInt(summary.Entries, 10))
+	w.Header().Set("X-Logl-Gaps", strconv.FormatInt(summary.Gaps, 10))
+	w.Header().Set("X-Logl-Missing-Lines", strconv.FormatInt(summary.MissingLines, 10))
+	w.Header().Set("X-Logl-Duplicates", strconv.FormatInt(summary.Duplicates, 10))
+
+	// Headers are sent, so a failure can only cut the read short
+	if err != nil {
+		h.logger.Error("File read failed",
+			zap.String("service", query.ServiceName),
+			zap.String("file", query.FilePath),
+			zap.Int64("read", read),
+			zap.Error(err))
+	}
+
+	if h.auditor != nil {
+		h.auditor.Record(models.QueryAuditEntry{
+			Identity:     clientIdentity(r),
+			Collection:   h.storage.CollectionFor(query.ServiceName),
+			Kind:         auditKindExport,
+			Filter:       filter,
+			DocsReturned: int(read),
+		}, duration)
+	}
+}
+
+// Trace returns every entry for a trace ID across all services, oldest first
+func (h *Handler) Trace(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	params := r.URL.Query()
+	traceID := padTraceID(strings.ToLower(params.Get("trace_id")))
+	if !validTraceID(traceID, 32) {
+		writeError(w, http.StatusBadRequest, "trace_id must be a 16 or 32 character hex trace ID")
+		return
+	}
+
+	region, err := h.queryRegion(params.Get("region"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	limit := h.queryLimit
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		if n < limit {
+			limit = n
+		}
+	}
+
+	start := time.Now()
+	var include func(collName string) bool
+	if tenant := requestTenant(r); h.tenancy != nil && tenant != "" {
+		include = func(collName string) bool {
+			return h.tenancy.CanRead(r.Context(), tenant, collName)
+		}
+	}
+	entries, err := h.storage.FindTrace(r.Context(), traceID, region, include, limit)
+	duration := time.Since(start)
+	if err != nil {
+		h.logger.Error("Failed to query trace", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	if h.auditor != nil {
+		filter := map[string]interface{}{"trace_id": traceID}
+		if region != "" {
+			filter["labels."+regionLabel] = region
+		}
+		h.auditor.Record(models.QueryAuditEntry{
+			Identity:     clientIdentity(r),
+			Collection:   "*",
+			Filter:       filter,
+			Limit:        limit,
+			DocsReturned: len(entries),
+		}, duration)
+	}
+
+	services := make(map[string]bool)
+	for _, entry := range entries {
+		services[entry.ServiceName] = true
+	}
+	serviceNames := make([]string, 0, len(services))
+	for name := range services {
+		serviceNames = append(serviceNames, name)
+	}
+	sort.Strings(serviceNames)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"trace_id": traceID,
+		"services": serviceNames,
+		"entries":  entries,
+		"count":    len(entries),
+	})
+}
+
+// Delivery reports batches lost between tailers and this server, by
+// agent, defaulting to gaps detected in the last 24 hours
+func (h *Handler) Delivery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if h.delivery == nil {
+		writeError(w, http.StatusNotFound, "Delivery tracking is disabled")
+		return
+	}
+
+	params := r.URL.Query()
+	to := time.Now()
+	from := to.Add(-24 * time.Hour)
+	if v := params.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid from: %v", err))
+			return
+		}
+		from = t
+	}
+	if v := params.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid to: %v", err))
+			return
+		}
+		to = t
+	}
+
+	reports, err := h.delivery.Report(r.Context(), params.Get("agent_id"), from, to)
+	if err != nil {
+		h.logger.Error("Failed to build delivery report", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"from":   from,
+		"to":     to,
+		"agents": reports,
+	})
+}
+
+// MetricsHistory returns the server's sampled operational metrics, oldest
+// first, defaulting to the last 24 hours
+func (h *Handler) MetricsHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if h.metrics == nil {
+		writeError(w, http.StatusNotFound, "Metrics history is disabled")
+		return
+	}
+
+	params := r.URL.Query()
+	to := time.Now()
+	from := to.Add(-24 * time.Hour)
+	for name, target := range map[string]*time.Time{"from": &from, "to": &to} {
+		if v := params.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid %s: %v", name, err))
+				return
+			}
+			*target = t
+		}
+	}
+
+	var limit int64
+	if v := params.Get("limit"); v != "" {
+		var err error
+		limit, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || limit <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid limit: %s", v))
+			return
+		}
+	}
+
+	samples, err := h.metrics.History(r.Context(), params.Get("instance"), from, to, limit)
+	if err != nil {
+		h.logger.Error("Failed to query metrics history", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"samples": samples,
+		"from":    from,
+		"to":      to,
+	})
+}
+
+// Alerts lists the alerts currently firing on this server
+func (h *Handler) Alerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if h.alerts == nil {
+		writeError(w, http.StatusNotFound, "Alerting is disabled")
+		return
+	}
+
+	alerts := h.alerts.Firing()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"alerts": alerts,
+		"count":  len(alerts),
+	})
+}
+
+// Forwarding reports each forwarding webhook's delivery counters
+func (h *Handler) Forwarding(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if h.forwarder == nil {
+		writeError(w, http.StatusNotFound, "Forwarding is disabled")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"targets": h.forwarder.Status(),
+	})
+}
+
+// Kafka reports the Kafka output's delivery counters
+func (h *Handler) Kafka(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if h.kafka == nil {
+		writeError(w, http.StatusNotFound, "Kafka output is disabled")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.kafka.Status())
+}
+
+// NATS reports the NATS output's connection and delivery counters
+func (h *Handler) NATS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if h.nats == nil {
+		writeError(w, http.StatusNotFound, "NATS output is disabled")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.nats.Status())
+}
+
+// Outputs reports delivery progress for every downstream destination, so
+// a failing or slow one is spotted before its queue overflows
+func (h *Handler) Outputs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	outputs := outputStatuses(h.forwarder, h.kafka, h.nats)
+	unhealthy := 0
+	for _, o := range outputs {
+		if o.State != "ok" {
+			unhealthy++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"outputs":   outputs,
+		"count":     len(outputs),
+		"unhealthy": unhealthy,
 	})
 }
+
+// Throttling reports per-service sampling and rate limit counters
+func (h *Handler) Throttling(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if h.throttle == nil {
+		writeError(w, http.StatusNotFound, "Throttling is disabled")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"services": h.throttle.Status(),
+	})
+}
+
+// Tenants lists tenants and the services they own (GET), assigns a
+// service to a tenant (PUT), or leaves a service unowned (DELETE)
+func (h *Handler) Tenants(w http.ResponseWriter, r *http.Request) {
+	if h.tenancy == nil {
+		writeError(w, http.StatusNotFound, "Tenancy is disabled")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"tenants": h.tenancy.List(),
+		})
+
+	case http.MethodPut:
+		var req struct {
+			Service string `json:"service"`
+			Tenant  string `json:"tenant"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %v", err))
+			return
+		}
+		if req.Service == "" || req.Tenant == "" {
+			writeError(w, http.StatusBadRequest, "service and tenant are required")
+			return
+		}
+
+		identity := clientIdentity(r)
+		err := h.tenancy.Assign(r.Context(), req.Service, req.Tenant, identity)
+		if errors.Is(err, errUnknownTenant) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			h.logger.Error("Failed to assign service", zap.String("service", req.Service), zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		h.logger.Info("Service assigned to tenant",
+			zap.String("identity", identity),
+			zap.String("service", req.Service),
+			zap.String("tenant", req.Tenant))
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodDelete:
+		service := r.URL.Query().Get("service")
+		if service == "" {
+			writeError(w, http.StatusBadRequest, "service is required")
+			return
+		}
+		if err := h.tenancy.Unassign(r.Context(), service); err != nil {
+			h.logger.Error("Failed to unassign service", zap.String("service", service), zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		h.logger.Info("Service unassigned from tenant",
+			zap.String("identity", clientIdentity(r)),
+			zap.String("service", service))
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// Routing reports each routing rule's matches and each sink's delivery
+// counters
+func (h *Handler) Routing(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if h.router == nil {
+		writeError(w, http.StatusNotFound, "Routing is disabled")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.router.Status())
+}
+
+// Certificates reports expiry of the CA, server, and observed client certificates
+func (h *Handler) Certificates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if h.certs == nil {
+		writeError(w, http.StatusNotFound, "Certificate monitoring is disabled")
+		return
+	}
+
+	certs := h.certs.Status()
+	expiring := 0
+	for _, cert := range certs {
+		if cert.Expiring {
+			expiring++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"certificates": certs,
+		"expiring":     expiring,
+	})
+}
+
+// Stats returns materialized per-minute counts for a service, defaulting
+// to the last hour
+func (h *Handler) Stats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if h.rollups == nil {
+		writeError(w, http.StatusNotFound, "Rollups are disabled")
+		return
+	}
+
+	params := r.URL.Query()
+	service := params.Get("service")
+	if service == "" {
+		writeError(w, http.StatusBadRequest, "service is required")
+		return
+	}
+
+	to := time.Now()
+	from := to.Add(-time.Hour)
+	for name, target := range map[string]*time.Time{"from": &from, "to": &to} {
+		if v := params.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid %s: %v", name, err))
+				return
+			}
+			*target = t
+		}
+	}
+
+	level := ""
+	if v := params.Get("level"); v != "" {
+		if level = NormalizeLevel(v); level == "" {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid level: %s", v))
+			return
+		}
+	}
+
+	counts, err := h.rollups.Counts(r.Context(), service, params.Get("hostname"), level, from, to)
+	if err != nil {
+		h.logger.Error("Failed to query rollups", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"counts": counts,
+		"from":   from,
+		"to":     to,
+	})
+}
+
+// Fields lists the fields and frequent values in a service's newest
+// entries, for autocomplete
+func (h *Handler) Fields(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if h.fields == nil {
+		writeError(w, http.StatusNotFound, "Autocomplete is disabled")
+		return
+	}
+
+	params := r.URL.Query()
+	service := params.Get("service")
+	if service == "" {
+		writeError(w, http.StatusBadRequest, "service is required")
+		return
+	}
+
+	catalog, err := h.fields.Fields(r.Context(), service)
+	if err != nil {
+		h.logger.Error("Failed to sample fields", zap.String("service", service), zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	catalog.Fields = filterFields(catalog.Fields, params.Get("prefix"))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(catalog)
+}
+
+// StatsHistogram counts a service's entries matching the query filters in
+// time buckets
+func (h *Handler) StatsHistogram(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	query, err := h.parseStatsQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	bucket := time.Minute
+	if v := r.URL.Query().Get("interval"); v != "" {
+		bucket, err = time.ParseDuration(v)
+		if err != nil || bucket < time.Second {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid interval: %s (expected a duration of at least 1s)", v))
+			return
+		}
+	}
+
+	buckets, err := h.storage.Histogram(r.Context(), query, bucket)
+	if errors.Is(err, errTooManyBuckets) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to aggregate histogram", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"buckets":  buckets,
+		"interval": bucket.String(),
+		"from":     query.From,
+		"to":       query.To,
+	})
+}
+
+// StatsGroup counts a service's entries matching the query filters by
+// level, host, file, label, or parsed field
+func (h *Handler) StatsGroup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	query, err := h.parseStatsQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	by := r.URL.Query().Get("by")
+	if by == "" {
+		writeError(w, http.StatusBadRequest, "by is required")
+		return
+	}
+	field, err := statsField(by)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.writeValueCounts(w, r, query, "by", by, field, false, 0)
+}
+
+// StatsTop returns the most frequent values of a parsed field in a
+// service's entries matching the query filters
+func (h *Handler) StatsTop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	query, err := h.parseStatsQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params := r.URL.Query()
+	name := strings.TrimPrefix(params.Get("field"), "parsed.")
+	if name == "" {
+		writeError(w, http.StatusBadRequest, "field is required")
+		return
+	}
+	field, err := parsedField(name)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	n := 10
+	if v := params.Get("n"); v != "" {
+		n, err = strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid n: %s", v))
+			return
+		}
+	}
+
+	h.writeValueCounts(w, r, query, "field", field, field, true, n)
+}
+
+// writeValueCounts runs a value count and writes it with the query window
+func (h *Handler) writeValueCounts(w http.ResponseWriter, r *http.Request, query models.LogQuery, param, name, field string, present bool, limit int) {
+	values, err := h.storage.CountValues(r.Context(), query, field, present, limit)
+	if err != nil {
+		h.logger.Error("Failed to aggregate counts", zap.String("field", field), zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		param:    name,
+		"values": values,
+		"from":   query.From,
+		"to":     query.To,
+	})
+}
+
+// parseStatsQuery parses query filters for stats endpoints, defaulting the
+// window to the last hour
+func (h *Handler) parseStatsQuery(r *http.Request) (models.LogQuery, error) {
+	query, err := h.parseLogQuery(r)
+	if err != nil {
+		return query, err
+	}
+	if query.To.IsZero() {
+		query.To = time.Now()
+	}
+	if query.From.IsZero() {
+		query.From = query.To.Add(-time.Hour)
+	}
+	if !query.From.Before(query.To) {
+		return query, fmt.Errorf("from must be before to")
+	}
+	return query, nil
+}
+
+// PatternDiff compares a service's log patterns in a window with a baseline
+// window, by default the window of the same length just before it
+func (h *Handler) PatternDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	params := r.URL.Query()
+	service := params.Get("service")
+	if service == "" {
+		writeError(w, http.StatusBadRequest, "service is required")
+		return
+	}
+
+	var from, to, baselineFrom, baselineTo time.Time
+	for name, target := range map[string]*time.Time{"from": &from, "to": &to, "baseline_from": &baselineFrom, "baseline_to": &baselineTo} {
+		if v := params.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid %s: %v", name, err))
+				return
+			}
+			*target = t
+		}
+	}
+
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.Add(-time.Hour)
+	}
+	if baselineTo.IsZero() {
+		baselineTo = from
+	}
+	if baselineFrom.IsZero() {
+		baselineFrom = baselineTo.Add(-to.Sub(from))
+	}
+	if !from.Before(to) || !baselineFrom.Before(baselineTo) {
+		writeError(w, http.StatusBadRequest, "from must be before to in both windows")
+		return
+	}
+
+	diff, err := h.patterns.Diff(r.Context(), service, baselineFrom, baselineTo, from, to)
+	if err != nil {
+		h.logger.Error("Failed to diff patterns", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(diff)
+}
+
+// SavedQuery re-runs a previously audited query by its id
+func (h *Handler) SavedQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if h.auditor == nil {
+		writeError(w, http.StatusNotFound, "Query auditing is disabled")
+		return
+	}
+
+	saved, err := h.auditor.Get(r.Context(), r.URL.Query().Get("id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Saved query not found")
+		return
+	}
+	if tenant := requestTenant(r); h.tenancy != nil && tenant != "" && !h.tenancy.CanRead(r.Context(), tenant, saved.Collection) {
+		writeError(w, http.StatusNotFound, "Saved query not found")
+		return
+	}
+
+	entries, err := h.storage.FindLogs(r.Context(), saved.Collection, saved.Filter, saved.Limit)
+	if err != nil {
+		h.logger.Error("Failed to run saved query", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"entries": entries,
+		"count":   len(entries),
+	})
+}
+
+// parseLogQuery reads a log query from URL parameters
+func (h *Handler) parseLogQuery(r *http.Request) (models.LogQuery, error) {
+	params := r.URL.Query()
+	query := models.LogQuery{
+		ServiceName: params.Get("service"),
+		Hostname:    params.Get("hostname"),
+		FilePath:    params.Get("file_path"),
+		Contains:    params.Get("contains"),
+		Search:      params.Get("search"),
+		TraceID:     strings.ToLower(params.Get("trace_id")),
+		EntryID:     params.Get("entry_id"),
+		IngestedBy:  params.Get("ingested_by"),
+		Limit:       h.queryLimit,
+	}
+
+	if query.ServiceName == "" {
+		return query, fmt.Errorf("service is required")
+	}
+	if query.Search != "" && !h.storage.LineTextIndexed() {
+		return query, fmt.Errorf("search requires mongodb.indexes.line_text")
+	}
+
+	// level accepts a comma-separated list, e.g. level=error,fatal
+	if v := params.Get("level"); v != "" {
+		for _, name := range strings.Split(v, ",") {
+			level := NormalizeLevel(name)
+			if level == "" {
+				return query, fmt.Errorf("invalid level: %s", name)
+			}
+			query.Levels = append(query.Levels, level)
+		}
+	}
+
+	// label may repeat, e.g. label=env:prod&label=component:api
+	for _, v := range params["label"] {
+		key, value, ok := strings.Cut(v, ":")
+		if !ok || !validLabelKey(key) {
+			return query, fmt.Errorf("invalid label filter: %s (expected key:value)", v)
+		}
+		if query.Labels == nil {
+			query.Labels = make(map[string]string)
+		}
+		query.Labels[key] = value
+	}
+
+	// region is shorthand for label=region:<name>
+	region := params.Get("region")
+	if region == "" {
+		region = query.Labels[regionLabel]
+	}
+	region, err := h.queryRegion(region)
+	if err != nil {
+		return query, err
+	}
+	if region != "" {
+		if query.Labels == nil {
+			query.Labels = make(map[string]string)
+		}
+		query.Labels[regionLabel] = region
+	}
+
+	if v := params.Get("from"); v != "" {
+		from, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return query, fmt.Errorf("invalid from: %w", err)
+		}
+		query.From = from
+	}
+
+	if v := params.Get("to"); v != "" {
+		to, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return query, fmt.Errorf("invalid to: %w", err)
+		}
+		query.To = to
+	}
+
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || limit <= 0 {
+			return query, fmt.Errorf("invalid limit: %s", v)
+		}
+		if limit < h.queryLimit {
+			query.Limit = limit
+		}
+	}
+
+	return query, nil
+}
+
+// ExplainQuery returns the MongoDB explain plan for an audited query
+func (h *Handler) ExplainQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if h.auditor == nil {
+		writeError(w, http.StatusNotFound, "Query auditing is disabled")
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeError(w, http.StatusBadRequest, "id is required")
+		return
+	}
+
+	plan, err := h.auditor.Explain(r.Context(), id)
+	if err != nil {
+		h.logger.Warn("Failed to explain query", zap.String("id", id), zap.Error(err))
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plan)
+}
+
+// RetentionPreview reports how much data a retention policy would delete,
+// without changing anything
+func (h *Handler) RetentionPreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Default to the retention in effect for the service
+	service := r.URL.Query().Get("service")
+	currentTTL := h.storage.TTLDays()
+	if service != "" {
+		currentTTL = h.storage.RetentionFor(service).TTLDays
+	}
+
+	ttlDays := currentTTL
+	if v := r.URL.Query().Get("ttl_days"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid ttl_days: %s", v))
+			return
+		}
+		ttlDays = days
+	}
+	if ttlDays <= 0 {
+		writeError(w, http.StatusBadRequest, "ttl_days is required when no TTL is configured")
+		return
+	}
+
+	var collections []string
+	if service != "" {
+		collections = []string{h.storage.CollectionFor(service)}
+	} else {
+		names, err := h.storage.ListLogCollections(r.Context())
+		if err != nil {
+			h.logger.Error("Failed to list collections", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		collections = names
+	}
+
+	previews := make([]models.RetentionPreview, 0, len(collections))
+	var totalDocs, totalBytes int64
+	for _, collName := range collections {
+		preview, err := h.storage.PreviewRetention(r.Context(), collName, ttlDays)
+		if err != nil {
+			h.logger.Error("Failed to preview retention", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		previews = append(previews, preview)
+		totalDocs += preview.Documents
+		totalBytes += preview.Bytes
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ttl_days":        ttlDays,
+		"current_ttl":     currentTTL,
+		"collections":     previews,
+		"total_documents": totalDocs,
+		"total_bytes":     totalBytes,
+	})
+}
+
+// Retention lists (GET), overrides (PUT), or clears (DELETE) per-service retention
+func (h *Handler) Retention(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if service := r.URL.Query().Get("service"); service != "" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(h.storage.RetentionFor(service))
+			return
+		}
+		services, err := h.storage.ListRetention(r.Context())
+		if err != nil {
+			h.logger.Error("Failed to list retention", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"default_ttl_days": h.storage.TTLDays(),
+			"services":         services,
+		})
+
+	case http.MethodPut:
+		var req struct {
+			Service string `json:"service"`
+			TTLDays *int   `json:"ttl_days"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %v", err))
+			return
+		}
+		if req.Service == "" || req.TTLDays == nil || *req.TTLDays < 0 {
+			writeError(w, http.StatusBadRequest, "service and a non-negative ttl_days are required")
+			return
+		}
+
+		identity := clientIdentity(r)
+		retention, err := h.storage.SetServiceRetention(r.Context(), req.Service, *req.TTLDays, identity)
+		if err != nil {
+			h.logger.Error("Failed to set retention", zap.String("service", req.Service), zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		h.logger.Info("Retention overridden",
+			zap.String("identity", identity),
+			zap.String("service", req.Service),
+			zap.Int("ttl_days", *req.TTLDays))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(retention)
+
+	case http.MethodDelete:
+		service := r.URL.Query().Get("service")
+		if service == "" {
+			writeError(w, http.StatusBadRequest, "service is required")
+			return
+		}
+		retention, err := h.storage.ClearServiceRetention(r.Context(), service)
+		if errors.Is(err, errNoRetentionOverride) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			h.logger.Error("Failed to clear retention", zap.String("service", service), zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		h.logger.Info("Retention override cleared",
+			zap.String("identity", clientIdentity(r)),
+			zap.String("service", service),
+			zap.Int("ttl_days", retention.TTLDays))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(retention)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// Services lists services with their collection sizes (GET) or purges a
+// service's logs (DELETE)
+func (h *Handler) Services(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		services, err := h.storage.ListServices(r.Context())
+		if err != nil {
+			h.logger.Error("Failed to list services", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"services": services,
+			"count":    len(services),
+		})
+
+	case http.MethodDelete:
+		service := r.URL.Query().Get("service")
+		if service == "" {
+			writeError(w, http.StatusBadRequest, "service is required")
+			return
+		}
+		dropped, err := h.storage.PurgeService(r.Context(), service)
+		if errors.Is(err, errUnknownService) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			h.logger.Error("Failed to purge service", zap.String("service", service), zap.Strings("dropped", dropped), zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		h.logger.Info("Service purged",
+			zap.String("identity", clientIdentity(r)),
+			zap.String("service", service),
+			zap.Strings("collections", dropped))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"service":     service,
+			"collections": dropped,
+		})
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// RenameService moves a service's logs to another service name
+func (h *Handler) RenameService(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %v", err))
+		return
+	}
+	if req.From == "" || req.To == "" {
+		writeError(w, http.StatusBadRequest, "from and to are required")
+		return
+	}
+	if h.storage.CollectionFor(req.From) == h.storage.CollectionFor(req.To) {
+		writeError(w, http.StatusBadRequest, "from and to map to the same collection")
+		return
+	}
+
+	renamed, err := h.storage.RenameService(r.Context(), req.From, req.To)
+	switch {
+	case errors.Is(err, errUnknownService):
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, errServiceExists):
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		h.logger.Error("Failed to rename service",
+			zap.String("from", req.From),
+			zap.String("to", req.To),
+			zap.Strings("renamed", renamed),
+			zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	h.logger.Info("Service renamed",
+		zap.String("identity", clientIdentity(r)),
+		zap.String("from", req.From),
+		zap.String("to", req.To),
+		zap.Strings("collections", renamed))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"from":        req.From,
+		"to":          req.To,
+		"collections": renamed,
+	})
+}
+
+// RebuildIndexes starts an index rebuild for a service, or for every
+// service when none is given
+func (h *Handler) RebuildIndexes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req struct {
+		Service string `json:"service"`
+		Drop    bool   `json:"drop"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %v", err))
+			return
+		}
+	}
+
+	if req.Service != "" {
+		collections, err := h.storage.serviceCollections(r.Context(), req.Service)
+		if err != nil {
+			h.logger.Error("Failed to list service collections", zap.String("service", req.Service), zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		if len(collections) == 0 {
+			writeError(w, http.StatusNotFound, errUnknownService.Error())
+			return
+		}
+	}
+
+	identity := clientIdentity(r)
+	h.logger.Info("Index rebuild started",
+		zap.String("identity", identity),
+		zap.String("service", req.Service),
+		zap.Bool("drop", req.Drop))
+
+	// Builds can outlast the request, so they run in the background
+	go func() {
+		start := time.Now()
+		if err := h.storage.RebuildIndexes(context.Background(), req.Service, req.Drop); err != nil {
+			h.logger.Error("Index rebuild failed", zap.String("service", req.Service), zap.Error(err))
+			return
+		}
+		h.logger.Info("Index rebuild complete",
+			zap.String("service", req.Service),
+			zap.Duration("duration", time.Since(start)))
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"service": req.Service,
+		"drop":    req.Drop,
+		"status":  "started",
+	})
+}
+
+// Dictionaries lists (GET) or trains (POST) a service's compression dictionaries
+func (h *Handler) Dictionaries(w http.ResponseWriter, r *http.Request) {
+	if h.dicts == nil {
+		writeError(w, http.StatusNotFound, "Dictionary training is disabled")
+		return
+	}
+
+	service := r.URL.Query().Get("service")
+	if service == "" {
+		writeError(w, http.StatusBadRequest, "service is required")
+		return
+	}
+	collName := h.storage.CollectionFor(service)
+
+	switch r.Method {
+	case http.MethodGet:
+		dicts, err := h.dicts.List(r.Context(), collName)
+		if err != nil {
+			h.logger.Error("Failed to list dictionaries", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"collection":   collName,
+			"dictionaries": dicts,
+		})
+
+	case http.MethodPost:
+		dict, err := h.dicts.Train(r.Context(), collName)
+		if err != nil {
+			h.logger.Warn("Failed to train dictionary", zap.String("collection", collName), zap.Error(err))
+			writeError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(dict)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// IndexStats reports per-index usage for log collections and flags indexes
+// that have not been used for the configured number of days
+func (h *Handler) IndexStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	unusedDays := h.unusedDays
+	if v := r.URL.Query().Get("unused_days"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid unused_days: %s", v))
+			return
+		}
+		unusedDays = days
+	}
+	unusedAfter := time.Duration(unusedDays) * 24 * time.Hour
+
+	var collections []string
+	if service := r.URL.Query().Get("service"); service != "" {
+		collections = []string{h.storage.CollectionFor(service)}
+	} else {
+		names, err := h.storage.ListLogCollections(r.Context())
+		if err != nil {
+			h.logger.Error("Failed to list collections", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		collections = names
+	}
+
+	indexes := make([]models.IndexUsage, 0)
+	unused := make([]models.IndexUsage, 0)
+	for _, collName := range collections {
+		usage, err := h.storage.IndexStats(r.Context(), collName, unusedAfter)
+		if err != nil {
+			h.logger.Error("Failed to get index stats", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		for _, u := range usage {
+			indexes = append(indexes, u)
+			if u.Unused {
+				unused = append(unused, u)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"unused_days": unusedDays,
+		"indexes":     indexes,
+		"unused":      unused,
+	})
+}
+
+// Reparse starts a re-parse job (POST) or reports a job's progress (GET)
+func (h *Handler) Reparse(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		job, exists := h.reparser.Get(r.URL.Query().Get("id"))
+		if !exists {
+			writeError(w, http.StatusNotFound, "Job not found")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(job)
+
+	case http.MethodPost:
+		var req struct {
+			Service string    `json:"service"`
+			From    time.Time `json:"from"`
+			To      time.Time `json:"to"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %v", err))
+			return
+		}
+		if req.Service == "" {
+			writeError(w, http.StatusBadRequest, "service is required")
+			return
+		}
+
+		job := h.reparser.Start(req.Service, req.From, req.To)
+		h.logger.Info("Reparse requested",
+			zap.String("identity", clientIdentity(r)),
+			zap.String("service", req.Service),
+			zap.String("job", job.ID))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(job)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// Relabel starts a relabel job (POST), reports a job's progress (GET), or
+// cancels a running job (DELETE)
+func (h *Handler) Relabel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		job, exists := h.relabeler.Get(r.URL.Query().Get("id"))
+		if !exists {
+			writeError(w, http.StatusNotFound, "Job not found")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(job)
+
+	case http.MethodPost:
+		var req RelabelRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %v", err))
+			return
+		}
+		if err := req.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		job := h.relabeler.Start(req)
+		h.logger.Info("Relabel requested",
+			zap.String("identity", clientIdentity(r)),
+			zap.String("service", req.Service),
+			zap.String("job", job.ID))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(job)
+
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if !h.relabeler.Cancel(id) {
+			writeError(w, http.StatusNotFound, "Job not found or not running")
+			return
+		}
+		h.logger.Info("Relabel cancelled",
+			zap.String("identity", clientIdentity(r)),
+			zap.String("job", id))
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// LiveTail streams newly ingested entries for a service as Server-Sent Events.
+// Each session is recorded in the audit subsystem when it ends.
+func (h *Handler) LiveTail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if h.liveTail == nil {
+		writeError(w, http.StatusNotFound, "Live tail is disabled")
+		return
+	}
+
+	params := r.URL.Query()
+	service := params.Get("service")
+	if service == "" {
+		writeError(w, http.StatusBadRequest, "service is required")
+		return
+	}
+
+	// Streams outlive the server's write timeout
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		h.logger.Debug("Unable to clear write deadline", zap.Error(err))
+	}
+
+	sub := h.liveTail.Subscribe(service, params.Get("hostname"), params.Get("contains"))
+	defer h.liveTail.Unsubscribe(sub)
+
+	session := models.StreamSessionEntry{
+		Identity: clientIdentity(r),
+		Service:  service,
+		Filter: map[string]string{
+			"hostname": sub.Hostname,
+			"contains": sub.Contains,
+		},
+		StartedAt: time.Now(),
+	}
+	defer func() {
+		session.EndedAt = time.Now()
+		session.EntriesDropped = sub.Dropped()
+		if h.auditor != nil {
+			h.auditor.RecordSession(session)
+		}
+	}()
+
+	h.logger.Info("Live tail session started",
+		zap.String("identity", session.Identity),
+		zap.String("service", service))
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case entry := <-sub.Entries:
+			data, err := json.Marshal(entry)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+				return
+			}
+			rc.Flush()
+			session.EntriesDelivered++
+
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			rc.Flush()
+		}
+	}
+}
+
+// Tokens issues (POST), lists (GET), and revokes (DELETE) read-only access tokens
+func (h *Handler) Tokens(w http.ResponseWriter, r *http.Request) {
+	if h.tokens == nil {
+		writeError(w, http.StatusNotFound, "Access tokens are disabled")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		tokens, err := h.tokens.List(r.Context())
+		if err != nil {
+			h.logger.Error("Failed to list tokens", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"tokens": tokens})
+
+	case http.MethodPost:
+		var req struct {
+			Scope  string `json:"scope"`
+			Target string `json:"target"`
+			TTL    string `json:"ttl"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %v", err))
+			return
+		}
+		ttl, err := time.ParseDuration(req.TTL)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid ttl: %v", err))
+			return
+		}
+
+		token, record, err := h.tokens.Issue(r.Context(), req.Scope, req.Target, ttl, clientIdentity(r))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		h.logger.Info("Access token issued",
+			zap.String("identity", record.CreatedBy),
+			zap.String("id", record.ID),
+			zap.String("scope", record.Scope),
+			zap.String("target", record.Target))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"token":  token,
+			"record": record,
+		})
+
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if err := h.tokens.Revoke(r.Context(), id); err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		h.logger.Info("Access token revoked", zap.String("identity", clientIdentity(r)), zap.String("id", id))
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// Maintenance lists (GET), creates (POST), or ends (DELETE) maintenance windows
+func (h *Handler) Maintenance(w http.ResponseWriter, r *http.Request) {
+	if h.maint == nil {
+		writeError(w, http.StatusNotFound, "Maintenance windows are disabled")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"windows": h.maint.List()})
+
+	case http.MethodPost:
+		var req struct {
+			models.MaintenanceWindow
+			Duration string `json:"duration"` // Alternative to ends_at, from starts_at
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %v", err))
+			return
+		}
+		window := req.MaintenanceWindow
+		if req.Duration != "" {
+			duration, err := time.ParseDuration(req.Duration)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid duration: %v", err))
+				return
+			}
+			if window.StartsAt.IsZero() {
+				window.StartsAt = time.Now()
+			}
+			window.EndsAt = window.StartsAt.Add(duration)
+		}
+		window.CreatedBy = clientIdentity(r)
+
+		window, err := h.maint.Create(r.Context(), window)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		h.logger.Info("Maintenance window created",
+			zap.String("identity", window.CreatedBy),
+			zap.String("id", window.ID),
+			zap.String("service", window.Service),
+			zap.String("hostname", window.Hostname),
+			zap.Time("ends_at", window.EndsAt))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(window)
+
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if err := h.maint.Delete(r.Context(), id); err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		h.logger.Info("Maintenance window ended", zap.String("identity", clientIdentity(r)), zap.String("id", id))
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// Health handles health check requests
+func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
+	health := map[string]string{
+		"status": "healthy",
+	}
+	if h.region != nil {
+		health["region"] = h.region.Name()
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(health)
+}
+
+// queryRegion returns the region a query is restricted to, empty for none
+func (h *Handler) queryRegion(requested string) (string, error) {
+	if h.region == nil {
+		return requested, nil
+	}
+	return h.region.QueryRegion(requested)
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/models"
+	"go.uber.org/zap"
+)
+
+// Logplex drain request headers
+const (
+	logplexTokenHeader   = "Logplex-Drain-Token"
+	logplexFrameHeader   = "Logplex-Frame-Id"
+	logplexCountHeader   = "Logplex-Msg-Count"
+	logplexContentType   = "application/logplex-1"
+	maxLogplexFrameBytes = 1 << 20
+)
+
+// HerokuDrains authenticates Logplex HTTPS drains and maps their drain
+// tokens to services
+type HerokuDrains struct {
+	drains map[string]config.HerokuDrainConfig // Drain token -> drain
+}
+
+// NewHerokuDrains creates a drain registry from configuration
+func NewHerokuDrains(cfg config.HerokuConfig) *HerokuDrains {
+	drains := make(map[string]config.HerokuDrainConfig, len(cfg.Drains))
+	for _, drain := range cfg.Drains {
+		drains[drain.Token] = drain
+	}
+	return &HerokuDrains{drains: drains}
+}
+
+// Authenticate returns the drain a request is from, checking the basic
+// auth password from the drain URL. The username is ignored.
+func (d *HerokuDrains) Authenticate(r *http.Request) (config.HerokuDrainConfig, bool) {
+	drain, ok := d.drains[r.Header.Get(logplexTokenHeader)]
+	if !ok {
+		return config.HerokuDrainConfig{}, false
+	}
+	_, password, ok := r.BasicAuth()
+	if !ok || subtle.ConstantTimeCompare([]byte(password), []byte(drain.Password)) != 1 {
+		return config.HerokuDrainConfig{}, false
+	}
+	return drain, true
+}
+
+// logplexMessage is one RFC 5424 syslog message from a Logplex frame.
+// Logplex omits structured data, so the message follows the MSGID.
+type logplexMessage struct {
+	timestamp time.Time
+	app       string // "app" for application output, "heroku" for platform logs
+	procID    string // Dyno or component, e.g. web.1 or router
+	msg       string
+}
+
+// readLogplexFrame splits a drain body into its octet-counted messages:
+// "<length> <syslog message>" repeated
+func readLogplexFrame(body io.Reader) ([]logplexMessage, error) {
+	br := bufio.NewReader(body)
+	var messages []logplexMessage
+	for {
+		prefix, err := br.ReadString(' ')
+		if err == io.EOF && strings.TrimSpace(prefix) == "" {
+			return messages, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("truncated frame")
+		}
+		length, err := strconv.Atoi(strings.TrimSpace(prefix))
+		if err != nil || length <= 0 || length > maxLogplexFrameBytes {
+			return nil, fmt.Errorf("invalid message length %q", strings.TrimSpace(prefix))
+		}
+		buf := make([]byte, length)
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return nil, fmt.Errorf("truncated message")
+		}
+		msg, err := parseLogplexMessage(string(buf))
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+}
+
+// parseLogplexMessage parses "<PRI>1 TIMESTAMP HOST APP PROCID MSGID MSG".
+// HOST is always "host" from Logplex, so the dyno stands in for it.
+func parseLogplexMessage(s string) (logplexMessage, error) {
+	if !strings.HasPrefix(s, "<") {
+		return logplexMessage{}, errors.New("message is missing its syslog priority")
+	}
+	fields := strings.SplitN(s, " ", 7)
+	if len(fields) < 6 {
+		return logplexMessage{}, errors.New("message is missing syslog header fields")
+	}
+	msg := logplexMessage{app: fields[3], procID: fields[4]}
+	if len(fields) == 7 {
+		msg.msg = strings.TrimRight(fields[6], "\r\n")
+	}
+	ts, err := time.Parse(time.RFC3339Nano, fields[1])
+	if err != nil {
+		ts = time.Now()
+	}
+	msg.timestamp = ts.UTC()
+	return msg, nil
+}
+
+// batch converts a frame's messages into a batch for the drain's service.
+// The frame ID makes Logplex retries of a frame idempotent.
+func (d *HerokuDrains) batch(drain config.HerokuDrainConfig, frameID string, messages []logplexMessage) models.LogBatch {
+	batch := models.LogBatch{ServiceName: drain.Service, Entries: make([]models.LogEntry, 0, len(messages))}
+	if frameID != "" {
+		batch.BatchID = "heroku-" + frameID
+	}
+	for i, msg := range messages {
+		entry := models.LogEntry{
+			ServiceName: drain.Service,
+			Hostname:    msg.procID,
+			FilePath:    "heroku://" + msg.app,
+			Line:        msg.msg,
+			Timestamp:   msg.timestamp,
+			LineNumber:  int64(i + 1),
+			Labels: map[string]string{
+				"heroku_source": msg.app,
+				"heroku_dyno":   msg.procID,
+			},
+		}
+		if frameID != "" {
+			entry.EntryID = fmt.Sprintf("%s-%d", frameID, i+1)
+		}
+		batch.Entries = append(batch.Entries, entry)
+	}
+	return batch
+}
+
+// HerokuDrain ingests Logplex HTTPS drain frames, storing each under the
+// service its drain token is mapped to
+func (h *Handler) HerokuDrain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if h.heroku == nil {
+		writeError(w, http.StatusNotFound, "Heroku drains are not enabled")
+		return
+	}
+
+	drain, ok := h.heroku.Authenticate(r)
+	if !ok {
+		h.logger.Warn("Rejected Heroku drain request",
+			zap.String("remote_addr", r.RemoteAddr),
+			zap.String("drain_token", r.Header.Get(logplexTokenHeader)))
+		w.Header().Set("WWW-Authenticate", `Basic realm="logl"`)
+		writeError(w, http.StatusUnauthorized, "Unknown drain token or invalid credentials")
+		return
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "" && !strings.HasPrefix(ct, logplexContentType) {
+		writeError(w, http.StatusUnsupportedMediaType, "Content-Type must be "+logplexContentType)
+		return
+	}
+	defer r.Body.Close()
+
+	messages, err := readLogplexFrame(http.MaxBytesReader(w, r.Body, maxLogplexFrameBytes))
+	if err != nil {
+		h.logger.Warn("Failed to parse Heroku drain frame", zap.String("service", drain.Service), zap.Error(err))
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid logplex frame: %v", err))
+		return
+	}
+	if count := r.Header.Get(logplexCountHeader); count != "" && count != strconv.Itoa(len(messages)) {
+		h.logger.Warn("Heroku drain frame message count mismatch",
+			zap.String("service", drain.Service),
+			zap.String("expected", count),
+			zap.Int("received", len(messages)))
+	}
+	if len(messages) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	r = r.WithContext(context.WithValue(r.Context(), drainContextKey{}, drain.Token))
+	h.ingestBatch(w, r, h.heroku.batch(drain, r.Header.Get(logplexFrameHeader), messages))
+}
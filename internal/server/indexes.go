@@ -0,0 +1,220 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/oicur0t/logl/internal/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// defaultIndexBuildTimeout bounds background index builds when
+// mongodb.indexes.build_timeout isn't applied
+const defaultIndexBuildTimeout = 5 * time.Minute
+
+// builtinIndexes are created on every log collection unless
+// mongodb.indexes.builtin selects a subset by name
+var builtinIndexes = []mongo.IndexModel{
+	{
+		Keys:    bson.D{{Key: "timestamp", Value: -1}},
+		Options: options.Index().SetName("timestamp_desc"),
+	},
+	{
+		Keys: bson.D{
+			{Key: "hostname", Value: 1},
+			{Key: "timestamp", Value: -1},
+		},
+		Options: options.Index().SetName("hostname_timestamp"),
+	},
+	{
+		Keys: bson.D{
+			{Key: "hostname", Value: 1},
+			{Key: "file_path", Value: 1},
+			{Key: "line_number", Value: 1},
+		},
+		Options: options.Index().SetName("hostname_file_line"),
+	},
+	// Detected severity (sparse since plain lines may have no level)
+	{
+		Keys: bson.D{
+			{Key: "level", Value: 1},
+			{Key: "timestamp", Value: -1},
+		},
+		Options: options.Index().SetName("level_timestamp").SetSparse(true),
+	},
+	// Trace correlation (sparse since most entries are untraced)
+	{
+		Keys:    bson.D{{Key: "trace_id", Value: 1}},
+		Options: options.Index().SetName("trace_id").SetSparse(true),
+	},
+	// Client-generated entry IDs; unique so a resent entry is stored once
+	{
+		Keys:    bson.D{{Key: "entry_id", Value: 1}},
+		Options: options.Index().SetName("entry_id").SetUnique(true).SetSparse(true),
+	},
+	// Indexes for parsed JSON fields (sparse to only index documents that have these fields)
+	{
+		Keys:    bson.D{{Key: "parsed.level", Value: 1}},
+		Options: options.Index().SetName("parsed_level").SetSparse(true),
+	},
+	{
+		Keys:    bson.D{{Key: "parsed.timestamp", Value: -1}},
+		Options: options.Index().SetName("parsed_timestamp").SetSparse(true),
+	},
+	{
+		Keys:    bson.D{{Key: "parsed.request_id", Value: 1}},
+		Options: options.Index().SetName("parsed_request_id").SetSparse(true),
+	},
+	{
+		Keys:    bson.D{{Key: "parsed.user_id", Value: 1}},
+		Options: options.Index().SetName("parsed_user_id").SetSparse(true),
+	},
+	{
+		Keys: bson.D{
+			{Key: "parsed.level", Value: 1},
+			{Key: "parsed.timestamp", Value: -1},
+		},
+		Options: options.Index().SetName("parsed_level_timestamp").SetSparse(true),
+	},
+}
+
+// entryIDIndex names the index dedup relies on
+const entryIDIndex = "entry_id"
+
+// ensureEntryIDIndex builds a collection's unique entry_id index, which
+// ensureIndexes leaves out, so its build can't hold back the others.
+// Time-series collections can't have a unique index, so entry IDs already
+// stored are left out of their inserts instead. An existing collection
+// already holding duplicate IDs fails the build and goes without dedup.
+func (s *Storage) ensureEntryIDIndex(ctx context.Context, collName string, timeSeries bool) {
+	if s.builtinEnabled != nil && !s.builtinEnabled[entryIDIndex] {
+		return
+	}
+
+	if !timeSeries {
+		for _, model := range builtinIndexes {
+			if *model.Options.Name != entryIDIndex {
+				continue
+			}
+			if _, err := s.database.Collection(collName).Indexes().CreateOne(ctx, model); err != nil {
+				s.logger.Error("Failed to build unique entry_id index; entry IDs won't be deduplicated",
+					zap.String("collection", collName), zap.Error(err))
+			}
+		}
+	}
+
+	s.indexedMu.Lock()
+	defer s.indexedMu.Unlock()
+	s.filterIDs[collName] = timeSeries
+}
+
+// SetIndexes selects the built-in indexes and adds the custom indexes
+// created on every log collection
+func (s *Storage) SetIndexes(cfg config.IndexesConfig) error {
+	if len(cfg.Builtin) > 0 {
+		known := make(map[string]bool, len(builtinIndexes))
+		for _, model := range builtinIndexes {
+			known[*model.Options.Name] = true
+		}
+		s.builtinEnabled = make(map[string]bool, len(cfg.Builtin))
+		for _, name := range cfg.Builtin {
+			if !known[name] {
+				return fmt.Errorf("mongodb.indexes.builtin: unknown index %q", name)
+			}
+			s.builtinEnabled[name] = true
+		}
+	}
+
+	custom, err := compileIndexes(cfg.Custom)
+	if err != nil {
+		return fmt.Errorf("mongodb.indexes.custom %w", err)
+	}
+	s.customIndexes = custom
+	s.indexes = cfg
+	return nil
+}
+
+// LineTextIndexed reports whether collections have a text index on line,
+// which search queries need
+func (s *Storage) LineTextIndexed() bool {
+	return s.indexes.LineText
+}
+
+// indexBuildTimeout returns how long a collection's index build may take
+func (s *Storage) indexBuildTimeout() time.Duration {
+	if s.indexes.BuildTimeout > 0 {
+		return s.indexes.BuildTimeout
+	}
+	return defaultIndexBuildTimeout
+}
+
+// EnsureAllIndexes ensures the indexes and retention of every log
+// collection, including those first written by other instances
+func (s *Storage) EnsureAllIndexes(ctx context.Context) error {
+	collections, err := s.ListLogCollections(ctx)
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, collName := range collections {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := s.prepareCollection(ctx, collName, strings.TrimPrefix(collName, s.collectionPrefix)); err != nil {
+			s.logger.Warn("Failed to ensure indexes", zap.String("collection", collName), zap.Error(err))
+			failed++
+			continue
+		}
+		s.markIndexed(collName)
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to ensure indexes on %d of %d collections", failed, len(collections))
+	}
+	return nil
+}
+
+// IndexMaintainer re-ensures every collection's indexes periodically, so
+// configuration changes and collections created elsewhere are picked up
+// without touching the insert path
+type IndexMaintainer struct {
+	storage  *Storage
+	interval time.Duration
+	logger   *zap.Logger
+}
+
+// NewIndexMaintainer creates a new index maintainer
+func NewIndexMaintainer(storage *Storage, cfg config.IndexesConfig, logger *zap.Logger) *IndexMaintainer {
+	return &IndexMaintainer{
+		storage:  storage,
+		interval: cfg.CheckInterval,
+		logger:   logger,
+	}
+}
+
+// Start ensures indexes every interval until ctx is cancelled. The first
+// pass runs after one interval, since startup warmup covers it.
+func (m *IndexMaintainer) Start(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		start := time.Now()
+		if err := m.storage.EnsureAllIndexes(ctx); err != nil {
+			m.logger.Error("Index maintenance incomplete", zap.Error(err))
+			continue
+		}
+		m.logger.Debug("Index maintenance complete", zap.Duration("duration", time.Since(start)))
+	}
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/oicur0t/logl/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// IndexStats returns $indexStats for a collection. An index is flagged as
+// unused when it has served no operations for at least unusedAfter.
+func (s *Storage) IndexStats(ctx context.Context, collName string, unusedAfter time.Duration) ([]models.IndexUsage, error) {
+	pipeline := bson.A{bson.M{"$indexStats": bson.M{}}}
+
+	cursor, err := s.database.Collection(collName).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get index stats for %s: %w", collName, err)
+	}
+	defer cursor.Close(ctx)
+
+	var stats []struct {
+		Name     string `bson:"name"`
+		Key      bson.M `bson:"key"`
+		Accesses struct {
+			Ops   int64     `bson:"ops"`
+			Since time.Time `bson:"since"`
+		} `bson:"accesses"`
+	}
+	if err := cursor.All(ctx, &stats); err != nil {
+		return nil, fmt.Errorf("failed to decode index stats for %s: %w", collName, err)
+	}
+
+	usage := make([]models.IndexUsage, 0, len(stats))
+	for _, st := range stats {
+		usage = append(usage, models.IndexUsage{
+			Collection: collName,
+			Name:       st.Name,
+			Key:        st.Key,
+			Ops:        st.Accesses.Ops,
+			Since:      st.Accesses.Since,
+			Unused:     st.Name != "_id_" && st.Accesses.Ops == 0 && time.Since(st.Accesses.Since) >= unusedAfter,
+		})
+	}
+
+	return usage, nil
+}
@@ -0,0 +1,322 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/models"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+	"go.uber.org/zap"
+)
+
+// KafkaOutput publishes accepted entries matching its filter to a Kafka
+// topic per service. Entries are keyed by hostname, so each host's entries
+// stay in order within a partition. Like forwarding webhooks, it queues
+// entries and drops them once the queue is full rather than slowing
+// ingestion.
+type KafkaOutput struct {
+	writer        *kafka.Writer
+	matcher       *entryMatcher
+	topic         string
+	queue         chan queuedKafkaMessage
+	batchSize     int
+	flushInterval time.Duration
+	timeout       time.Duration
+	logger        *zap.Logger
+
+	sent     atomic.Int64
+	dropped  atomic.Int64
+	failed   atomic.Int64
+	progress *outputProgress
+
+	mu          sync.Mutex
+	topics      map[string]string // By service
+	lastError   string
+	lastErrorAt time.Time
+}
+
+// queuedKafkaMessage is a message with the time it was queued
+type queuedKafkaMessage struct {
+	msg      kafka.Message
+	queuedAt time.Time
+}
+
+// NewKafkaOutput creates a new Kafka output, loading its TLS and SASL
+// credentials
+func NewKafkaOutput(cfg config.KafkaConfig, logger *zap.Logger) (*KafkaOutput, error) {
+	matcher, err := newEntryMatcher(cfg.EntryFilterConfig)
+	if err != nil {
+		return nil, fmt.Errorf("kafka: %w", err)
+	}
+
+	transport := &kafka.Transport{
+		DialTimeout: cfg.Timeout,
+		ClientID:    "logl-server",
+	}
+	if cfg.TLS.Enabled {
+		transport.TLS, err = outputTLSConfig(cfg.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("kafka: %w", err)
+		}
+	}
+	if cfg.SASL.Mechanism != "" {
+		transport.SASL, err = kafkaSASLMechanism(cfg.SASL)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	acks := kafka.RequireAll
+	switch cfg.RequiredAcks {
+	case "none":
+		acks = kafka.RequireNone
+	case "leader":
+		acks = kafka.RequireOne
+	}
+
+	return &KafkaOutput{
+		writer: &kafka.Writer{
+			Addr:                   kafka.TCP(cfg.Brokers...),
+			Balancer:               &kafka.Murmur2Balancer{}, // Partitions keys as the Java client does
+			MaxAttempts:            cfg.MaxRetries + 1,
+			BatchSize:              cfg.BatchSize,
+			BatchTimeout:           10 * time.Millisecond, // Batches are already formed by Start
+			WriteTimeout:           cfg.Timeout,
+			RequiredAcks:           acks,
+			Compression:            kafkaCompression(cfg.Compression),
+			Transport:              transport,
+			AllowAutoTopicCreation: cfg.AutoCreateTopics,
+		},
+		matcher:       matcher,
+		topic:         cfg.Topic,
+		queue:         make(chan queuedKafkaMessage, cfg.QueueSize),
+		batchSize:     cfg.BatchSize,
+		flushInterval: cfg.FlushInterval,
+		timeout:       cfg.Timeout,
+		logger:        logger,
+		progress:      newOutputProgress(cfg.QueueSize),
+		topics:        make(map[string]string),
+	}, nil
+}
+
+// kafkaSASLMechanism returns the configured SASL mechanism
+func kafkaSASLMechanism(cfg config.KafkaSASLConfig) (sasl.Mechanism, error) {
+	switch cfg.Mechanism {
+	case "plain":
+		return plain.Mechanism{Username: cfg.Username, Password: cfg.Password}, nil
+	case "scram-sha-256":
+		return scram.Mechanism(scram.SHA256, cfg.Username, cfg.Password)
+	case "scram-sha-512":
+		return scram.Mechanism(scram.SHA512, cfg.Username, cfg.Password)
+	}
+	return nil, fmt.Errorf("unsupported kafka SASL mechanism %q", cfg.Mechanism)
+}
+
+// kafkaCompression maps a compression name to its codec; none is zero
+func kafkaCompression(name string) kafka.Compression {
+	switch name {
+	case "gzip":
+		return kafka.Gzip
+	case "snappy":
+		return kafka.Snappy
+	case "lz4":
+		return kafka.Lz4
+	case "zstd":
+		return kafka.Zstd
+	}
+	return 0
+}
+
+// Publish queues a batch's matching entries, dropping them when the queue
+// is full
+func (k *KafkaOutput) Publish(batch models.LogBatch) {
+	if !k.matcher.matchesService(batch.ServiceName) {
+		return
+	}
+
+	var topic string
+	for i := range batch.Entries {
+		if !k.matcher.matches(&batch.Entries[i]) {
+			continue
+		}
+		if topic == "" {
+			topic = k.topicFor(batch.ServiceName)
+		}
+		entry := batch.Entries[i]
+		if entry.ServiceName == "" {
+			entry.ServiceName = batch.ServiceName
+		}
+		value, err := json.Marshal(entry)
+		if err != nil {
+			k.failed.Add(1)
+			continue
+		}
+
+		msg := kafka.Message{
+			Topic:   topic,
+			Key:     []byte(entry.Hostname),
+			Value:   value,
+			Headers: []kafka.Header{{Key: "service", Value: []byte(batch.ServiceName)}},
+			Time:    entry.Timestamp,
+		}
+		select {
+		case k.queue <- queuedKafkaMessage{msg: msg, queuedAt: time.Now()}:
+		default:
+			k.dropped.Add(1)
+		}
+	}
+}
+
+// topicFor returns the service's topic, caching the result
+func (k *KafkaOutput) topicFor(service string) string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	topic, ok := k.topics[service]
+	if !ok {
+		topic = kafkaTopic(k.topic, service)
+		k.topics[service] = topic
+	}
+	return topic
+}
+
+// kafkaTopic expands the topic template for a service, replacing
+// characters Kafka does not allow in topic names
+func kafkaTopic(template, service string) string {
+	topic := strings.ReplaceAll(template, "{service}", service)
+	topic = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		}
+		return '_'
+	}, topic)
+	if len(topic) > 249 {
+		topic = topic[:249]
+	}
+	return topic
+}
+
+// Start writes queued entries in batches until the context is cancelled,
+// then makes one attempt to write what is still queued
+func (k *KafkaOutput) Start(ctx context.Context) {
+	ticker := time.NewTicker(k.flushInterval)
+	defer ticker.Stop()
+
+	messages := make([]kafka.Message, 0, k.batchSize)
+	var reportedDrops int64
+
+	for {
+		select {
+		case queued := <-k.queue:
+			k.progress.queued(queued.queuedAt)
+			messages = append(messages, queued.msg)
+			if len(messages) >= k.batchSize {
+				k.write(ctx, messages)
+				messages = make([]kafka.Message, 0, k.batchSize)
+			}
+		case <-ticker.C:
+			if len(messages) > 0 {
+				k.write(ctx, messages)
+				messages = make([]kafka.Message, 0, k.batchSize)
+			}
+			if dropped := k.dropped.Load(); dropped > reportedDrops {
+				k.logger.Warn("Kafka queue full, dropped entries",
+					zap.Int64("dropped", dropped-reportedDrops))
+				reportedDrops = dropped
+			}
+			k.progress.checkBacklog(len(k.queue), k.logger, zap.String("output", "kafka"))
+		case <-ctx.Done():
+		drain:
+			for {
+				select {
+				case queued := <-k.queue:
+					k.progress.queued(queued.queuedAt)
+					messages = append(messages, queued.msg)
+				default:
+					break drain
+				}
+			}
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), k.timeout)
+			if len(messages) > 0 {
+				k.write(shutdownCtx, messages)
+			}
+			cancel()
+			if err := k.writer.Close(); err != nil {
+				k.logger.Error("Failed to close Kafka writer", zap.Error(err))
+			}
+			return
+		}
+	}
+}
+
+// write sends a batch, which the writer retries, and records the outcome
+func (k *KafkaOutput) write(ctx context.Context, messages []kafka.Message) {
+	k.progress.send(len(messages))
+	err := k.writer.WriteMessages(ctx, messages...)
+
+	// The writer retries internally, so its failed attempts are counted
+	// from its stats
+	failedAttempts := k.writer.Stats().Retries
+	if err != nil {
+		failedAttempts++
+	}
+	if failedAttempts > 0 {
+		k.progress.attemptsFailed(failedAttempts, 0)
+	}
+
+	if err == nil {
+		k.sent.Add(int64(len(messages)))
+		k.progress.finish(len(messages))
+		return
+	}
+
+	failed := len(messages)
+	var writeErrs kafka.WriteErrors
+	if errors.As(err, &writeErrs) {
+		failed = writeErrs.Count()
+	}
+	k.sent.Add(int64(len(messages) - failed))
+	k.failed.Add(int64(failed))
+	k.progress.finish(len(messages) - failed)
+
+	k.mu.Lock()
+	k.lastError = err.Error()
+	k.lastErrorAt = time.Now()
+	k.mu.Unlock()
+
+	k.logger.Error("Failed to publish entries to Kafka",
+		zap.Int("entries", failed),
+		zap.Error(err))
+}
+
+// Status returns the output's delivery counters
+func (k *KafkaOutput) Status() models.KafkaStatus {
+	status := models.KafkaStatus{
+		Queued:  len(k.queue),
+		Sent:    k.sent.Load(),
+		Dropped: k.dropped.Load(),
+		Failed:  k.failed.Load(),
+	}
+	status.OutputProgress = k.progress.status(status.Queued)
+
+	k.mu.Lock()
+	status.Topics = len(k.topics)
+	if k.lastError != "" {
+		at := k.lastErrorAt
+		status.LastError = k.lastError
+		status.LastErrorAt = &at
+	}
+	k.mu.Unlock()
+	return status
+}
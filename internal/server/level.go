@@ -0,0 +1,81 @@
+package server
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/models"
+)
+
+// levelPattern matches a severity keyword in plain-text lines, e.g.
+// "[ERROR]", "level=warn", or "2024-01-01 12:00:00 INFO ..."
+var levelPattern = regexp.MustCompile(`(?i)\b(trace|debug|info|notice|warn|warning|error|err|fatal|crit|critical|panic|emerg)\b`)
+
+// levelAliases maps detected severities onto canonical level names
+var levelAliases = map[string]string{
+	"trace":    "trace",
+	"debug":    "debug",
+	"info":     "info",
+	"notice":   "info",
+	"warn":     "warn",
+	"warning":  "warn",
+	"error":    "error",
+	"err":      "error",
+	"fatal":    "fatal",
+	"crit":     "fatal",
+	"critical": "fatal",
+	"panic":    "fatal",
+	"emerg":    "fatal",
+}
+
+// LevelDetector promotes a log entry's severity to its level field
+type LevelDetector struct {
+	fields []string
+}
+
+// NewLevelDetector creates a new level detector
+func NewLevelDetector(cfg config.LevelDetectionConfig) *LevelDetector {
+	return &LevelDetector{fields: cfg.Fields}
+}
+
+// Detect sets entry.Level from the first configured parsed field holding a
+// known severity, falling back to scanning the raw line. Entries with no
+// recognizable severity are left without a level.
+func (d *LevelDetector) Detect(entry *models.LogEntry) {
+	entry.Level = ""
+
+	for _, field := range d.fields {
+		value, ok := lookupParsed(entry.Parsed, field).(string)
+		if !ok {
+			continue
+		}
+		if level := NormalizeLevel(value); level != "" {
+			entry.Level = level
+			return
+		}
+	}
+
+	if match := levelPattern.FindString(entry.Line); match != "" {
+		entry.Level = NormalizeLevel(match)
+	}
+}
+
+// NormalizeLevel maps a severity name onto trace, debug, info, warn, error,
+// or fatal, returning "" for unknown values
+func NormalizeLevel(value string) string {
+	return levelAliases[strings.ToLower(strings.TrimSpace(value))]
+}
+
+// lookupParsed returns the value at a dotted path in parsed JSON
+func lookupParsed(parsed map[string]interface{}, path string) interface{} {
+	var current interface{} = parsed
+	for _, key := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = m[key]
+	}
+	return current
+}
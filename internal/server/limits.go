@@ -0,0 +1,99 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/models"
+)
+
+// truncatedMarker ends lines cut to max_line_bytes
+const truncatedMarker = "...[truncated]"
+
+// IngestLimits bounds the request size, entry count, and line length of
+// ingest requests
+type IngestLimits struct {
+	maxRequestBytes int64
+	maxEntries      int
+	maxLineBytes    int
+	rejectLongLines bool
+}
+
+// NewIngestLimits creates ingest limits, or returns nil when nothing is
+// limited
+func NewIngestLimits(cfg config.IngestLimitsConfig) *IngestLimits {
+	if cfg.MaxRequestBytes == 0 && cfg.MaxEntries == 0 && cfg.MaxLineBytes == 0 {
+		return nil
+	}
+	return &IngestLimits{
+		maxRequestBytes: cfg.MaxRequestBytes,
+		maxEntries:      cfg.MaxEntries,
+		maxLineBytes:    cfg.MaxLineBytes,
+		rejectLongLines: cfg.LongLines == "reject",
+	}
+}
+
+// limitError describes a request over a limit, answered with 413
+func limitError(code, message string, limit int64) *models.APIError {
+	apiErr := models.NewAPIError(http.StatusRequestEntityTooLarge, message)
+	apiErr.Code = code
+	apiErr.Details = map[string]interface{}{"limit": limit}
+	return &apiErr
+}
+
+// LimitBody caps how much of the request body can be read
+func (l *IngestLimits) LimitBody(w http.ResponseWriter, r *http.Request) {
+	if l.maxRequestBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, l.maxRequestBytes)
+	}
+}
+
+// BodyError returns the limit error for a body read that failed because
+// it exceeded the request size limit, or nil for any other error
+func (l *IngestLimits) BodyError(err error) *models.APIError {
+	var tooLarge *http.MaxBytesError
+	if !errors.As(err, &tooLarge) {
+		return nil
+	}
+	return limitError(models.ErrCodeRequestTooLarge, fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit), tooLarge.Limit)
+}
+
+// Check rejects batches with too many entries and truncates or rejects
+// long lines, returning the number of lines truncated
+func (l *IngestLimits) Check(batch *models.LogBatch) (int, *models.APIError) {
+	if l.maxEntries > 0 && len(batch.Entries) > l.maxEntries {
+		return 0, limitError(models.ErrCodeTooManyEntries, fmt.Sprintf("batch has %d entries, more than %d", len(batch.Entries), l.maxEntries), int64(l.maxEntries))
+	}
+	if l.maxLineBytes == 0 {
+		return 0, nil
+	}
+
+	truncated := 0
+	for i := range batch.Entries {
+		line := batch.Entries[i].Line
+		if len(line) <= l.maxLineBytes {
+			continue
+		}
+		if l.rejectLongLines {
+			apiErr := limitError(models.ErrCodeLineTooLong, fmt.Sprintf("entry %d has a %d byte line, longer than %d", i, len(line), l.maxLineBytes), int64(l.maxLineBytes))
+			apiErr.Details["entry"] = i
+			return 0, apiErr
+		}
+		batch.Entries[i].Line = truncateLine(line, l.maxLineBytes)
+		truncated++
+	}
+	return truncated, nil
+}
+
+// truncateLine cuts a line to max bytes including the marker, without
+// splitting a UTF-8 sequence
+func truncateLine(line string, max int) string {
+	cut := max - len(truncatedMarker)
+	for cut > 0 && !utf8.RuneStart(line[cut]) {
+		cut--
+	}
+	return line[:cut] + truncatedMarker
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/oicur0t/logl/pkg/models"
+)
+
+// LiveTail fans out freshly ingested entries to live-tail subscribers
+type LiveTail struct {
+	bufferSize int
+
+	mu          sync.RWMutex
+	subscribers map[*TailSubscription]struct{}
+}
+
+// TailSubscription receives entries matching its filters until unsubscribed
+type TailSubscription struct {
+	Service  string
+	Hostname string
+	Contains string
+	Entries  chan models.LogEntry
+	dropped  atomic.Int64
+}
+
+// NewLiveTail creates a new live-tail broadcaster
+func NewLiveTail(bufferSize int) *LiveTail {
+	return &LiveTail{
+		bufferSize:  bufferSize,
+		subscribers: make(map[*TailSubscription]struct{}),
+	}
+}
+
+// Subscribe registers a new subscription
+func (t *LiveTail) Subscribe(service, hostname, contains string) *TailSubscription {
+	sub := &TailSubscription{
+		Service:  service,
+		Hostname: hostname,
+		Contains: contains,
+		Entries:  make(chan models.LogEntry, t.bufferSize),
+	}
+
+	t.mu.Lock()
+	t.subscribers[sub] = struct{}{}
+	t.mu.Unlock()
+
+	return sub
+}
+
+// Unsubscribe removes a subscription
+func (t *LiveTail) Unsubscribe(sub *TailSubscription) {
+	t.mu.Lock()
+	delete(t.subscribers, sub)
+	t.mu.Unlock()
+}
+
+// Sessions returns the number of active subscriptions
+func (t *LiveTail) Sessions() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.subscribers)
+}
+
+// Publish delivers a batch to matching subscribers. Slow subscribers never
+// block ingestion; entries that don't fit in their buffer are dropped.
+func (t *LiveTail) Publish(batch models.LogBatch) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	for sub := range t.subscribers {
+		if !strings.EqualFold(sub.Service, batch.ServiceName) {
+			continue
+		}
+		for _, entry := range batch.Entries {
+			if !sub.matches(entry) {
+				continue
+			}
+			select {
+			case sub.Entries <- entry:
+			default:
+				sub.dropped.Add(1)
+			}
+		}
+	}
+}
+
+// Dropped returns how many entries were dropped because the subscriber fell behind
+func (s *TailSubscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// matches applies the subscription's entry filters
+func (s *TailSubscription) matches(entry models.LogEntry) bool {
+	if s.Hostname != "" && s.Hostname != entry.Hostname {
+		return false
+	}
+	if s.Contains != "" && !strings.Contains(entry.Line, s.Contains) {
+		return false
+	}
+	return true
+}
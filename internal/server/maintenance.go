@@ -0,0 +1,260 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// MaintenanceManager tracks maintenance windows, during which notifications
+// for matching services and hosts are muted and their entries optionally
+// sampled. Windows expire on their own once they end.
+type MaintenanceManager struct {
+	collection      *mongo.Collection
+	static          []models.MaintenanceWindow
+	refreshInterval time.Duration
+	maxDuration     time.Duration
+	logger          *zap.Logger
+
+	mu      sync.RWMutex
+	windows []models.MaintenanceWindow // static and stored windows that haven't ended
+}
+
+// NewMaintenanceManager creates a new maintenance manager with the
+// configured static windows
+func NewMaintenanceManager(storage *Storage, cfg config.MaintenanceConfig, logger *zap.Logger) *MaintenanceManager {
+	m := &MaintenanceManager{
+		collection:      storage.database.Collection(cfg.Collection),
+		refreshInterval: cfg.RefreshInterval,
+		maxDuration:     cfg.MaxDuration,
+		logger:          logger,
+	}
+
+	// Times were validated when the configuration was loaded
+	for i, w := range cfg.Windows {
+		startsAt, _ := time.Parse(time.RFC3339, w.StartsAt)
+		endsAt, _ := time.Parse(time.RFC3339, w.EndsAt)
+		m.static = append(m.static, models.MaintenanceWindow{
+			ID:         fmt.Sprintf("static-%d", i),
+			Service:    w.Service,
+			Hostname:   w.Hostname,
+			Reason:     w.Reason,
+			SampleRate: w.SampleRate,
+			StartsAt:   startsAt,
+			EndsAt:     endsAt,
+			Static:     true,
+		})
+	}
+	m.windows = m.static
+	return m
+}
+
+// EnsureIndexes expires stored windows once they end
+func (m *MaintenanceManager) EnsureIndexes(ctx context.Context) error {
+	_, err := m.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "ends_at", Value: 1}},
+		Options: options.Index().SetName("ends_at_ttl").SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create maintenance indexes: %w", err)
+	}
+	return nil
+}
+
+// Start reloads stored windows every refresh interval until ctx is cancelled
+func (m *MaintenanceManager) Start(ctx context.Context) {
+	ticker := time.NewTicker(m.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.Refresh(ctx); err != nil {
+			m.logger.Error("Failed to refresh maintenance windows", zap.Error(err))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Refresh reloads the windows that haven't ended
+func (m *MaintenanceManager) Refresh(ctx context.Context) error {
+	now := time.Now()
+	cursor, err := m.collection.Find(ctx, bson.M{"ends_at": bson.M{"$gt": now}})
+	if err != nil {
+		return fmt.Errorf("failed to load maintenance windows: %w", err)
+	}
+	var stored []models.MaintenanceWindow
+	if err := cursor.All(ctx, &stored); err != nil {
+		return fmt.Errorf("failed to decode maintenance windows: %w", err)
+	}
+
+	windows := make([]models.MaintenanceWindow, 0, len(m.static)+len(stored))
+	for _, w := range m.static {
+		if w.EndsAt.After(now) {
+			windows = append(windows, w)
+		}
+	}
+	windows = append(windows, stored...)
+
+	m.mu.Lock()
+	m.windows = windows
+	m.mu.Unlock()
+	return nil
+}
+
+// Create validates and stores a new window
+func (m *MaintenanceManager) Create(ctx context.Context, w models.MaintenanceWindow) (models.MaintenanceWindow, error) {
+	if w.Service == "" && w.Hostname == "" {
+		return w, fmt.Errorf("service or hostname is required")
+	}
+	for _, pattern := range []string{w.Service, w.Hostname} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return w, fmt.Errorf("invalid pattern %q", pattern)
+		}
+	}
+	if w.SampleRate < 0 || w.SampleRate > 1 {
+		return w, fmt.Errorf("sample_rate must be between 0 and 1")
+	}
+
+	now := time.Now()
+	if w.StartsAt.IsZero() {
+		w.StartsAt = now
+	}
+	if !w.EndsAt.After(w.StartsAt) || !w.EndsAt.After(now) {
+		return w, fmt.Errorf("ends_at must be in the future and after starts_at")
+	}
+	if w.EndsAt.Sub(w.StartsAt) > m.maxDuration {
+		return w, fmt.Errorf("windows can last at most %s", m.maxDuration)
+	}
+
+	w.ID = primitive.NewObjectID().Hex()
+	w.CreatedAt = now
+	w.Static = false
+	if _, err := m.collection.InsertOne(ctx, w); err != nil {
+		return w, fmt.Errorf("failed to store maintenance window: %w", err)
+	}
+
+	m.mu.Lock()
+	m.windows = append(m.windows, w)
+	m.mu.Unlock()
+	return w, nil
+}
+
+// Delete ends a stored window early
+func (m *MaintenanceManager) Delete(ctx context.Context, id string) error {
+	result, err := m.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete maintenance window: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("maintenance window not found")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	windows := make([]models.MaintenanceWindow, 0, len(m.windows))
+	for _, w := range m.windows {
+		if w.ID != id {
+			windows = append(windows, w)
+		}
+	}
+	m.windows = windows
+	return nil
+}
+
+// List returns active and scheduled windows, soonest first
+func (m *MaintenanceManager) List() []models.MaintenanceWindow {
+	now := time.Now()
+
+	m.mu.RLock()
+	windows := make([]models.MaintenanceWindow, 0, len(m.windows))
+	for _, w := range m.windows {
+		if w.EndsAt.After(now) {
+			windows = append(windows, w)
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(windows, func(i, j int) bool {
+		return windows[i].StartsAt.Before(windows[j].StartsAt)
+	})
+	return windows
+}
+
+// active returns the windows in effect now for a service and host. Windows
+// scoped to a host only match when a hostname is given.
+func (m *MaintenanceManager) active(service, hostname string) []models.MaintenanceWindow {
+	now := time.Now()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var matched []models.MaintenanceWindow
+	for _, w := range m.windows {
+		if now.Before(w.StartsAt) || !now.Before(w.EndsAt) {
+			continue
+		}
+		if w.Service != "" {
+			if ok, _ := path.Match(w.Service, service); !ok {
+				continue
+			}
+		}
+		if w.Hostname != "" {
+			if ok, _ := path.Match(w.Hostname, hostname); !ok || hostname == "" {
+				continue
+			}
+		}
+		matched = append(matched, w)
+	}
+	return matched
+}
+
+// Muted returns the window muting notifications for a service and host, if any
+func (m *MaintenanceManager) Muted(service, hostname string) (models.MaintenanceWindow, bool) {
+	windows := m.active(service, hostname)
+	if len(windows) == 0 {
+		return models.MaintenanceWindow{}, false
+	}
+	return windows[0], true
+}
+
+// Sample drops entries from hosts under sampling windows, keeping each with
+// the lowest matching window's sample rate, and returns how many it dropped
+func (m *MaintenanceManager) Sample(batch *models.LogBatch) int {
+	rates := make(map[string]float64) // hostname -> rate, 0 keeps all
+	kept := batch.Entries[:0]
+	for _, entry := range batch.Entries {
+		rate, seen := rates[entry.Hostname]
+		if !seen {
+			for _, w := range m.active(batch.ServiceName, entry.Hostname) {
+				if w.SampleRate > 0 && (rate == 0 || w.SampleRate < rate) {
+					rate = w.SampleRate
+				}
+			}
+			rates[entry.Hostname] = rate
+		}
+
+		if rate == 0 || rand.Float64() < rate {
+			kept = append(kept, entry)
+		}
+	}
+
+	dropped := len(batch.Entries) - len(kept)
+	batch.Entries = kept
+	return dropped
+}
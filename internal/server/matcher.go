@@ -0,0 +1,74 @@
+package server
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/models"
+)
+
+// entryMatcher is an entry filter with its pattern compiled
+type entryMatcher struct {
+	service string
+	field   string
+	value   string
+	pattern *regexp.Regexp // nil when the filter has no pattern
+	levels  map[string]bool
+	labels  map[string]string
+}
+
+// newEntryMatcher compiles an entry filter
+func newEntryMatcher(cfg config.EntryFilterConfig) (*entryMatcher, error) {
+	m := &entryMatcher{service: cfg.Service, field: cfg.Field, value: cfg.Value, labels: cfg.Labels}
+	if cfg.Pattern != "" {
+		re, err := regexp.Compile(cfg.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile pattern: %w", err)
+		}
+		m.pattern = re
+	}
+	if len(cfg.Levels) > 0 {
+		m.levels = make(map[string]bool)
+		for _, level := range cfg.Levels {
+			m.levels[NormalizeLevel(level)] = true
+		}
+	}
+	return m, nil
+}
+
+// matchesService reports whether the filter applies to a service
+func (m *entryMatcher) matchesService(service string) bool {
+	if m.service == "" {
+		return true
+	}
+	ok, _ := path.Match(m.service, service)
+	return ok
+}
+
+// matches reports whether an entry matches the filter's levels, labels,
+// field, and pattern
+func (m *entryMatcher) matches(entry *models.LogEntry) bool {
+	if m.levels != nil && !m.levels[entry.Level] {
+		return false
+	}
+	for key, value := range m.labels {
+		if v, ok := entry.Labels[key]; !ok || v != value {
+			return false
+		}
+	}
+	if m.field == "" {
+		return m.pattern == nil || m.pattern.MatchString(entry.Line)
+	}
+
+	value := lookupParsed(entry.Parsed, m.field)
+	if value == nil {
+		return false
+	}
+	s := fmt.Sprint(value)
+	if m.value != "" && s != m.value {
+		return false
+	}
+	return m.pattern == nil || m.pattern.MatchString(s)
+}
@@ -0,0 +1,252 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// ServerMetrics counts requests and ingested entries in memory and writes
+// a sample with the current queue depths to the metrics history every
+// interval, so basic trends are available without an external monitoring
+// system
+type ServerMetrics struct {
+	collection *mongo.Collection
+	interval   time.Duration
+	retention  time.Duration
+	instance   string
+	storage    *Storage
+	buffer     *WriteBuffer // nil when the write buffer is disabled
+	liveTail   *LiveTail    // nil when live tail is disabled
+	forwarder  *Forwarder   // nil when forwarding is disabled
+	kafka      *KafkaOutput // nil when the Kafka output is disabled
+	nats       *NATSOutput  // nil when the NATS output is disabled
+	logger     *zap.Logger
+
+	requests      atomic.Int64
+	clientErrors  atomic.Int64
+	serverErrors  atomic.Int64
+	ingestBatches atomic.Int64
+	ingestEntries atomic.Int64
+	ingestErrors  atomic.Int64
+	lastSample    time.Time
+	outputTotals  map[string]models.OutputSample // Counters at the last sample, by output
+}
+
+// NewServerMetrics creates a new metrics collector
+func NewServerMetrics(storage *Storage, buffer *WriteBuffer, liveTail *LiveTail, cfg config.MetricsHistoryConfig, logger *zap.Logger) *ServerMetrics {
+	instance, err := os.Hostname()
+	if err != nil {
+		instance = "unknown"
+	}
+	return &ServerMetrics{
+		collection:   storage.database.Collection(cfg.Collection),
+		interval:     cfg.Interval,
+		retention:    time.Duration(cfg.RetentionDays) * 24 * time.Hour,
+		instance:     instance,
+		storage:      storage,
+		buffer:       buffer,
+		liveTail:     liveTail,
+		logger:       logger,
+		lastSample:   time.Now(),
+		outputTotals: make(map[string]models.OutputSample),
+	}
+}
+
+// SetOutputs adds the downstream outputs' delivery to samples. Any may be
+// nil when disabled.
+func (m *ServerMetrics) SetOutputs(forwarder *Forwarder, kafka *KafkaOutput, nats *NATSOutput) {
+	m.forwarder = forwarder
+	m.kafka = kafka
+	m.nats = nats
+}
+
+// EnsureIndexes creates the lookup index and, with a retention, a TTL on timestamp
+func (m *ServerMetrics) EnsureIndexes(ctx context.Context) error {
+	indexModels := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "instance", Value: 1}, {Key: "timestamp", Value: 1}},
+			Options: options.Index().SetName("instance_timestamp"),
+		},
+	}
+	if m.retention > 0 {
+		indexModels = append(indexModels, mongo.IndexModel{
+			Keys:    bson.D{{Key: "timestamp", Value: 1}},
+			Options: options.Index().SetName("ttl_index").SetExpireAfterSeconds(int32(m.retention.Seconds())),
+		})
+	}
+
+	if _, err := m.collection.Indexes().CreateMany(ctx, indexModels); err != nil {
+		return fmt.Errorf("failed to create metrics history indexes: %w", err)
+	}
+	return nil
+}
+
+// RecordIngest counts a stored or buffered batch
+func (m *ServerMetrics) RecordIngest(entries int) {
+	m.ingestBatches.Add(1)
+	m.ingestEntries.Add(int64(entries))
+}
+
+// RecordRequest counts a completed request by its response status
+func (m *ServerMetrics) RecordRequest(path string, status int) {
+	m.requests.Add(1)
+	switch {
+	case status >= 500:
+		m.serverErrors.Add(1)
+		if isIngestPath(path) {
+			m.ingestErrors.Add(1)
+		}
+	case status >= 400:
+		m.clientErrors.Add(1)
+	}
+}
+
+// isIngestPath reports whether a request path is an ingest endpoint
+func isIngestPath(path string) bool {
+	return path == "/v1/logs/ingest" || strings.HasPrefix(path, "/v1/drains/")
+}
+
+// Start writes a sample every interval until the context is cancelled,
+// then writes a final partial one
+func (m *ServerMetrics) Start(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := m.write(ctx, m.sample(time.Now())); err != nil {
+				m.logger.Error("Failed to write metrics sample", zap.Error(err))
+			}
+		case <-ctx.Done():
+			writeCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if err := m.write(writeCtx, m.sample(time.Now())); err != nil {
+				m.logger.Error("Failed to write metrics sample on shutdown", zap.Error(err))
+			}
+			cancel()
+			return
+		}
+	}
+}
+
+// sample takes and resets the counters and reads the queue depths
+func (m *ServerMetrics) sample(now time.Time) models.MetricsSample {
+	elapsed := now.Sub(m.lastSample).Seconds()
+	m.lastSample = now
+
+	s := models.MetricsSample{
+		Instance:      m.instance,
+		Timestamp:     now.UTC(),
+		Interval:      elapsed,
+		Requests:      m.requests.Swap(0),
+		ClientErrors:  m.clientErrors.Swap(0),
+		ServerErrors:  m.serverErrors.Swap(0),
+		IngestBatches: m.ingestBatches.Swap(0),
+		IngestEntries: m.ingestEntries.Swap(0),
+		IngestErrors:  m.ingestErrors.Swap(0),
+	}
+	if s.Requests > 0 {
+		s.ErrorRate = float64(s.ServerErrors) / float64(s.Requests)
+	}
+	if elapsed > 0 {
+		s.IngestRate = float64(s.IngestEntries) / elapsed
+	}
+
+	if m.buffer != nil {
+		s.WriteBufferBatches, s.WriteBufferSpilled = m.buffer.Pending()
+	}
+	s.BulkWriterQueued = m.storage.QueuedInserts()
+	if m.liveTail != nil {
+		s.LiveTailSessions = m.liveTail.Sessions()
+	}
+	s.Outputs = m.sampleOutputs()
+	return s
+}
+
+// sampleOutputs reads each output's queue and lag, with its counters since
+// the last sample
+func (m *ServerMetrics) sampleOutputs() []models.OutputSample {
+	var samples []models.OutputSample
+	for _, o := range outputStatuses(m.forwarder, m.kafka, m.nats) {
+		last := m.outputTotals[o.Output]
+		m.outputTotals[o.Output] = models.OutputSample{
+			Sent:           o.Sent,
+			Dropped:        o.Dropped,
+			Failed:         o.Failed,
+			FailedAttempts: o.FailedAttempts,
+		}
+		samples = append(samples, models.OutputSample{
+			Output:         o.Output,
+			State:          o.State,
+			Queued:         o.Queued,
+			QueueUsage:     o.QueueUsage,
+			Retrying:       o.Retrying,
+			LagSeconds:     o.LagSeconds,
+			PendingSeconds: o.PendingSeconds,
+			Sent:           o.Sent - last.Sent,
+			Dropped:        o.Dropped - last.Dropped,
+			Failed:         o.Failed - last.Failed,
+			FailedAttempts: o.FailedAttempts - last.FailedAttempts,
+		})
+	}
+	return samples
+}
+
+// write stores a sample
+func (m *ServerMetrics) write(ctx context.Context, sample models.MetricsSample) error {
+	if _, err := m.collection.InsertOne(ctx, sample); err != nil {
+		return fmt.Errorf("failed to insert metrics sample: %w", err)
+	}
+	return nil
+}
+
+// History returns samples in [from, to), oldest first, optionally for one
+// server instance
+func (m *ServerMetrics) History(ctx context.Context, instance string, from, to time.Time, limit int64) ([]models.MetricsSample, error) {
+	filter := bson.M{"timestamp": bson.M{"$gte": from, "$lt": to}}
+	if instance != "" {
+		filter["instance"] = instance
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: 1}}).
+		SetProjection(bson.M{"_id": 0}).
+		SetLimit(limit)
+
+	cursor, err := m.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query metrics history: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	samples := []models.MetricsSample{}
+	if err := cursor.All(ctx, &samples); err != nil {
+		return nil, fmt.Errorf("failed to decode metrics history: %w", err)
+	}
+	return samples, nil
+}
+
+// MetricsMiddleware counts completed requests by response status
+func MetricsMiddleware(metrics *ServerMetrics) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			wrapped := &responseWriter{
+				ResponseWriter: w,
+				statusCode:     http.StatusOK,
+			}
+			next.ServeHTTP(wrapped, r)
+			metrics.RecordRequest(r.URL.Path, wrapped.statusCode)
+		})
+	}
+}
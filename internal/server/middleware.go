@@ -1,12 +1,27 @@
 package server
 
 import (
+	"context"
+	"crypto/subtle"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/oicur0t/logl/pkg/models"
 	"go.uber.org/zap"
 )
 
+// tokenContextKey carries a verified access token in the request context
+type tokenContextKey struct{}
+
+// adminContextKey marks a request admitted by admin.token or admin.clients
+type adminContextKey struct{}
+
+// drainContextKey carries an authenticated Heroku drain token in the
+// request context
+type drainContextKey struct{}
+
 // LoggingMiddleware logs HTTP requests
 func LoggingMiddleware(logger *zap.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -34,21 +49,32 @@ func LoggingMiddleware(logger *zap.Logger) func(http.Handler) http.Handler {
 	}
 }
 
-// MTLSMiddleware verifies client certificates
-func MTLSMiddleware(logger *zap.Logger) func(http.Handler) http.Handler {
+// MTLSMiddleware verifies client certificates, rejecting revoked ones when
+// revocation is set, and lets through requests already authenticated with a
+// tenant API key
+func MTLSMiddleware(revocation *Revocation, logger *zap.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := r.Context().Value(apiKeyContextKey{}).(string); ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			// Check if TLS is used
 			if r.TLS == nil {
 				logger.Warn("Request without TLS", zap.String("remote_addr", r.RemoteAddr))
-				http.Error(w, "TLS required", http.StatusForbidden)
+				writeError(w, http.StatusForbidden, "TLS required")
 				return
 			}
 
 			// Check if client certificate is present
 			if len(r.TLS.PeerCertificates) == 0 {
 				logger.Warn("Request without client certificate", zap.String("remote_addr", r.RemoteAddr))
-				http.Error(w, "Client certificate required", http.StatusForbidden)
+				writeError(w, http.StatusForbidden, "Client certificate required")
+				return
+			}
+
+			if !revocation.allow(w, r) {
 				return
 			}
 
@@ -66,6 +92,124 @@ func MTLSMiddleware(logger *zap.Logger) func(http.Handler) http.Handler {
 	}
 }
 
+// ReadAccessMiddleware admits clients with a certificate, or holders of a
+// valid access token scoped to the requested service or saved query.
+// Revoked certificates are rejected when revocation is set.
+func ReadAccessMiddleware(tokens *TokenManager, revocation *Revocation, mtlsEnabled bool, logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Certificate and API key holders have full read access
+			if _, ok := r.Context().Value(apiKeyContextKey{}).(string); ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+				if revocation.allow(w, r) {
+					next.ServeHTTP(w, r)
+				}
+				return
+			}
+
+			raw := r.URL.Query().Get("token")
+			if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+				raw = strings.TrimPrefix(auth, "Bearer ")
+			}
+
+			if raw == "" {
+				if !mtlsEnabled {
+					next.ServeHTTP(w, r)
+					return
+				}
+				logger.Warn("Request without client certificate or token", zap.String("remote_addr", r.RemoteAddr))
+				writeError(w, http.StatusForbidden, "Client certificate or access token required")
+				return
+			}
+
+			token, err := tokens.Verify(r.Context(), raw)
+			if err != nil {
+				logger.Warn("Rejected access token", zap.String("remote_addr", r.RemoteAddr), zap.Error(err))
+				writeError(w, http.StatusUnauthorized, "Invalid access token")
+				return
+			}
+
+			if !tokenAllows(token, r) {
+				writeError(w, http.StatusForbidden, "Access token does not grant this resource")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tokenContextKey{}, token)))
+		})
+	}
+}
+
+// AdminMiddleware admits callers of the admin APIs: clients whose verified
+// certificate has a common name or DNS name in clients, holders of the
+// admin token, and admin tenants. Revoked certificates are rejected when
+// revocation is set.
+func AdminMiddleware(clients []string, token string, tenancy *Tenancy, revocation *Revocation, logger *zap.Logger) func(http.Handler) http.Handler {
+	allowed := make(map[string]bool, len(clients))
+	for _, client := range clients {
+		allowed[client] = true
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tenancy != nil {
+				tenant := requestTenant(r)
+				if tenant == "" {
+					tenant, _ = tenancy.certTenant(r)
+				}
+				if tenant != "" && tenancy.IsAdmin(tenant) {
+					if revocation.allow(w, r) {
+						next.ServeHTTP(w, r)
+					}
+					return
+				}
+			}
+
+			if token != "" {
+				if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") &&
+					subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) == 1 {
+					next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), adminContextKey{}, true)))
+					return
+				}
+			}
+
+			if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+				cert := r.TLS.VerifiedChains[0][0]
+				admin := allowed[cert.Subject.CommonName]
+				for _, name := range cert.DNSNames {
+					admin = admin || allowed[name]
+				}
+				if admin {
+					if revocation.allow(w, r) {
+						next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), adminContextKey{}, true)))
+					}
+					return
+				}
+			}
+
+			logger.Warn("Rejected admin request",
+				zap.String("identity", clientIdentity(r)),
+				zap.String("path", r.URL.Path))
+			writeError(w, http.StatusForbidden, "Admin access required")
+		})
+	}
+}
+
+// ReadOnlyMiddleware rejects requests that could change anything, for the
+// admin APIs when no admin identity is configured
+func ReadOnlyMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				writeError(w, http.StatusForbidden, "Admin APIs are read-only without admin.clients, admin.token, or admin tenants")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // RecoveryMiddleware recovers from panics
 func RecoveryMiddleware(logger *zap.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -76,7 +220,7 @@ func RecoveryMiddleware(logger *zap.Logger) func(http.Handler) http.Handler {
 						zap.Any("error", err),
 						zap.String("path", r.URL.Path),
 					)
-					http.Error(w, "Internal server error", http.StatusInternalServerError)
+					writeError(w, http.StatusInternalServerError, "Internal server error")
 				}
 			}()
 
@@ -85,6 +229,42 @@ func RecoveryMiddleware(logger *zap.Logger) func(http.Handler) http.Handler {
 	}
 }
 
+// clientIdentity returns the client certificate subject, the access token
+// used, or the remote address when the request carries neither
+func clientIdentity(r *http.Request) string {
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return r.TLS.PeerCertificates[0].Subject.String()
+	}
+	if token, ok := r.Context().Value(tokenContextKey{}).(*models.AccessToken); ok {
+		return "token:" + token.ID
+	}
+	return r.RemoteAddr
+}
+
+// ingestIdentity returns the authenticated sender of ingested entries: the
+// client certificate's common name, the tenant API key, the Heroku drain
+// token, or failing those the peer IP address
+func ingestIdentity(r *http.Request) string {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		cert := r.TLS.VerifiedChains[0][0]
+		if cert.Subject.CommonName != "" {
+			return cert.Subject.CommonName
+		}
+		return cert.Subject.String()
+	}
+	if key, ok := r.Context().Value(apiKeyContextKey{}).(string); ok {
+		return "key:" + key
+	}
+	if drain, ok := r.Context().Value(drainContextKey{}).(string); ok {
+		return "heroku:" + drain
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
 // responseWriter is a wrapper around http.ResponseWriter to capture status code
 type responseWriter struct {
 	http.ResponseWriter
@@ -95,3 +275,8 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.statusCode = code
 	rw.ResponseWriter.WriteHeader(code)
 }
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
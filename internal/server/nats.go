@@ -0,0 +1,404 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/models"
+	"github.com/oicur0t/logl/pkg/retry"
+	"go.uber.org/zap"
+)
+
+// natsRoute is a route with its filter compiled
+type natsRoute struct {
+	subject string
+	matcher *entryMatcher
+}
+
+// NATSOutput publishes accepted entries to NATS JetStream subjects chosen
+// per service by its routes. Entries with an entry_id carry it as
+// Nats-Msg-Id, so JetStream drops copies republished by retries. Like the
+// Kafka output, it queues entries and drops them once the queue is full
+// rather than slowing ingestion.
+type NATSOutput struct {
+	conn          *nats.Conn
+	js            nats.JetStreamContext
+	routes        []natsRoute
+	stream        config.NATSStreamConfig
+	streamReady   bool
+	queue         chan queuedNATSMessage
+	batchSize     int
+	flushInterval time.Duration
+	timeout       time.Duration
+	retryConfig   retry.Config
+	logger        *zap.Logger
+
+	sent     atomic.Int64
+	dropped  atomic.Int64
+	failed   atomic.Int64
+	progress *outputProgress
+
+	mu          sync.Mutex
+	subjects    map[string]string // By route subject and service
+	lastError   string
+	lastErrorAt time.Time
+}
+
+// queuedNATSMessage is a message with the time it was queued
+type queuedNATSMessage struct {
+	msg      *nats.Msg
+	queuedAt time.Time
+}
+
+// NewNATSOutput creates a new NATS output. The connection is made in the
+// background, so the server starts while NATS is unreachable.
+func NewNATSOutput(cfg config.NATSConfig, logger *zap.Logger) (*NATSOutput, error) {
+	routeConfigs := cfg.Routes
+	if len(routeConfigs) == 0 {
+		routeConfigs = []config.NATSRouteConfig{{Subject: cfg.Subject}}
+	}
+	n := &NATSOutput{
+		stream:        cfg.Stream,
+		queue:         make(chan queuedNATSMessage, cfg.QueueSize),
+		batchSize:     cfg.BatchSize,
+		flushInterval: cfg.FlushInterval,
+		timeout:       cfg.Timeout,
+		retryConfig: retry.Config{
+			MaxRetries:  cfg.MaxRetries,
+			InitialWait: time.Second,
+			MaxWait:     30 * time.Second,
+			Multiplier:  2.0,
+		},
+		logger:   logger,
+		progress: newOutputProgress(cfg.QueueSize),
+		subjects: make(map[string]string),
+	}
+	for i, rc := range routeConfigs {
+		matcher, err := newEntryMatcher(rc.EntryFilterConfig)
+		if err != nil {
+			return nil, fmt.Errorf("nats route %d: %w", i, err)
+		}
+		n.routes = append(n.routes, natsRoute{subject: rc.Subject, matcher: matcher})
+	}
+	if n.stream.Name != "" && len(n.stream.Subjects) == 0 {
+		n.stream.Subjects = natsStreamSubjects(n.routes)
+	}
+
+	opts := []nats.Option{
+		nats.Name("logl-server"),
+		nats.Timeout(cfg.Timeout),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				logger.Warn("Disconnected from NATS", zap.Error(err))
+			}
+		}),
+		nats.ReconnectHandler(func(c *nats.Conn) {
+			logger.Info("Reconnected to NATS", zap.String("url", c.ConnectedUrlRedacted()))
+		}),
+	}
+	switch {
+	case cfg.CredsFile != "":
+		opts = append(opts, nats.UserCredentials(cfg.CredsFile))
+	case cfg.Token != "":
+		opts = append(opts, nats.Token(cfg.Token))
+	case cfg.Username != "":
+		opts = append(opts, nats.UserInfo(cfg.Username, cfg.Password))
+	}
+	if cfg.TLS.Enabled {
+		tlsConfig, err := outputTLSConfig(cfg.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("nats: %w", err)
+		}
+		opts = append(opts, nats.Secure(tlsConfig))
+	}
+
+	conn, err := nats.Connect(cfg.URL, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	js, err := conn.JetStream(nats.PublishAsyncMaxPending(cfg.BatchSize))
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open JetStream context: %w", err)
+	}
+	n.conn = conn
+	n.js = js
+	return n, nil
+}
+
+// natsStreamSubjects returns the routes' subjects with {service} as a
+// single-token wildcard
+func natsStreamSubjects(routes []natsRoute) []string {
+	seen := make(map[string]bool)
+	var subjects []string
+	for _, r := range routes {
+		subject := strings.ReplaceAll(r.subject, "{service}", "*")
+		if !seen[subject] {
+			seen[subject] = true
+			subjects = append(subjects, subject)
+		}
+	}
+	return subjects
+}
+
+// Publish queues a batch's entries for every route they match, dropping
+// them when the queue is full
+func (n *NATSOutput) Publish(batch models.LogBatch) {
+	for _, route := range n.routes {
+		if !route.matcher.matchesService(batch.ServiceName) {
+			continue
+		}
+
+		var subject string
+		for i := range batch.Entries {
+			if !route.matcher.matches(&batch.Entries[i]) {
+				continue
+			}
+			if subject == "" {
+				subject = n.subjectFor(route.subject, batch.ServiceName)
+			}
+			entry := batch.Entries[i]
+			if entry.ServiceName == "" {
+				entry.ServiceName = batch.ServiceName
+			}
+			data, err := json.Marshal(entry)
+			if err != nil {
+				n.failed.Add(1)
+				continue
+			}
+
+			msg := &nats.Msg{Subject: subject, Data: data, Header: nats.Header{}}
+			msg.Header.Set("Logl-Service", batch.ServiceName)
+			if entry.EntryID != "" {
+				msg.Header.Set(nats.MsgIdHdr, entry.EntryID+"/"+subject)
+			}
+			select {
+			case n.queue <- queuedNATSMessage{msg: msg, queuedAt: time.Now()}:
+			default:
+				n.dropped.Add(1)
+			}
+		}
+	}
+}
+
+// subjectFor returns a route's subject for a service, caching the result
+func (n *NATSOutput) subjectFor(template, service string) string {
+	key := template + "\x00" + service
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	subject, ok := n.subjects[key]
+	if !ok {
+		subject = natsSubject(template, service)
+		n.subjects[key] = subject
+	}
+	return subject
+}
+
+// natsSubject expands a subject template for a service. Characters that
+// would split the service into several tokens or act as wildcards are
+// replaced, so each service is one subject token.
+func natsSubject(template, service string) string {
+	token := strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', ' ', '\t', '\r', '\n':
+			return '_'
+		}
+		return r
+	}, service)
+	if token == "" {
+		token = "_"
+	}
+	return strings.ReplaceAll(template, "{service}", token)
+}
+
+// Start publishes queued entries in batches until the context is
+// cancelled, then makes one attempt to publish what is still queued and
+// closes the connection
+func (n *NATSOutput) Start(ctx context.Context) {
+	ticker := time.NewTicker(n.flushInterval)
+	defer ticker.Stop()
+
+	messages := make([]*nats.Msg, 0, n.batchSize)
+	var reportedDrops int64
+
+	for {
+		select {
+		case queued := <-n.queue:
+			n.progress.queued(queued.queuedAt)
+			messages = append(messages, queued.msg)
+			if len(messages) >= n.batchSize {
+				n.publish(ctx, messages, n.retryConfig)
+				messages = make([]*nats.Msg, 0, n.batchSize)
+			}
+		case <-ticker.C:
+			if len(messages) > 0 {
+				n.publish(ctx, messages, n.retryConfig)
+				messages = make([]*nats.Msg, 0, n.batchSize)
+			}
+			if dropped := n.dropped.Load(); dropped > reportedDrops {
+				n.logger.Warn("NATS queue full, dropped entries",
+					zap.Int64("dropped", dropped-reportedDrops))
+				reportedDrops = dropped
+			}
+			n.progress.checkBacklog(len(n.queue), n.logger, zap.String("output", "nats"))
+		case <-ctx.Done():
+		drain:
+			for {
+				select {
+				case queued := <-n.queue:
+					n.progress.queued(queued.queuedAt)
+					messages = append(messages, queued.msg)
+				default:
+					break drain
+				}
+			}
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), n.timeout)
+			for len(messages) > 0 && shutdownCtx.Err() == nil {
+				count := min(len(messages), n.batchSize)
+				n.publish(shutdownCtx, messages[:count], retry.Config{})
+				messages = messages[count:]
+			}
+			cancel()
+			n.conn.Close()
+			return
+		}
+	}
+}
+
+// ensureStream creates the configured stream if it does not exist. An
+// existing stream is left as operators configured it.
+func (n *NATSOutput) ensureStream() error {
+	if n.stream.Name == "" || n.streamReady {
+		return nil
+	}
+
+	_, err := n.js.StreamInfo(n.stream.Name)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		_, err = n.js.AddStream(&nats.StreamConfig{
+			Name:     n.stream.Name,
+			Subjects: n.stream.Subjects,
+			MaxAge:   n.stream.MaxAge,
+		})
+		if err == nil {
+			n.logger.Info("Created NATS stream",
+				zap.String("stream", n.stream.Name),
+				zap.Strings("subjects", n.stream.Subjects))
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to ensure stream %s: %w", n.stream.Name, err)
+	}
+	n.streamReady = true
+	return nil
+}
+
+// publish sends a batch, retrying the messages JetStream did not
+// acknowledge, and records the outcome
+func (n *NATSOutput) publish(ctx context.Context, messages []*nats.Msg, retryConfig retry.Config) {
+	if err := n.ensureStream(); err != nil {
+		n.logger.Warn("NATS stream not ready", zap.Error(err))
+	}
+
+	n.progress.send(len(messages))
+	pending := messages
+	err := retry.Do(ctx, retryConfig, func() error {
+		var err error
+		pending, err = n.publishOnce(ctx, pending)
+		if err != nil {
+			n.progress.attemptsFailed(1, len(pending))
+		}
+		return err
+	})
+	n.sent.Add(int64(len(messages) - len(pending)))
+	n.progress.finish(len(messages) - len(pending))
+	if err == nil {
+		return
+	}
+
+	n.failed.Add(int64(len(pending)))
+	n.mu.Lock()
+	n.lastError = err.Error()
+	n.lastErrorAt = time.Now()
+	n.mu.Unlock()
+
+	n.logger.Error("Failed to publish entries to NATS",
+		zap.Int("entries", len(pending)),
+		zap.Error(err))
+}
+
+// publishOnce publishes messages asynchronously and waits for their
+// acknowledgements, returning those that were not acknowledged
+func (n *NATSOutput) publishOnce(ctx context.Context, messages []*nats.Msg) ([]*nats.Msg, error) {
+	var failed []*nats.Msg
+	var lastErr error
+	futures := make([]nats.PubAckFuture, 0, len(messages))
+	for _, msg := range messages {
+		future, err := n.js.PublishMsgAsync(msg)
+		if err != nil {
+			failed = append(failed, msg)
+			lastErr = err
+			continue
+		}
+		futures = append(futures, future)
+	}
+
+	timer := time.NewTimer(n.timeout)
+	defer timer.Stop()
+	select {
+	case <-n.js.PublishAsyncComplete():
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	for _, future := range futures {
+		select {
+		case <-future.Ok():
+		case err := <-future.Err():
+			failed = append(failed, future.Msg())
+			lastErr = err
+		default:
+			failed = append(failed, future.Msg())
+			lastErr = fmt.Errorf("no acknowledgement within %s", n.timeout)
+		}
+	}
+	if len(failed) > 0 {
+		return failed, fmt.Errorf("%d of %d publishes failed: %w", len(failed), len(messages), lastErr)
+	}
+	return nil, nil
+}
+
+// Status returns the output's delivery counters
+func (n *NATSOutput) Status() models.NATSStatus {
+	status := models.NATSStatus{
+		Connected: n.conn.IsConnected(),
+		Queued:    len(n.queue),
+		Sent:      n.sent.Load(),
+		Dropped:   n.dropped.Load(),
+		Failed:    n.failed.Load(),
+	}
+	status.OutputProgress = n.progress.status(status.Queued)
+	if !status.Connected {
+		status.State = "failing"
+	}
+
+	n.mu.Lock()
+	status.Subjects = len(n.subjects)
+	if n.lastError != "" {
+		at := n.lastErrorAt
+		status.LastError = n.lastError
+		status.LastErrorAt = &at
+	}
+	n.mu.Unlock()
+	return status
+}
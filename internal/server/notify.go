@@ -0,0 +1,158 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/ids"
+	"go.uber.org/zap"
+)
+
+// Notification is an operator-facing event sent to the configured webhook
+type Notification struct {
+	Type      string                 `json:"type"`
+	Service   string                 `json:"service,omitempty"`
+	Hostname  string                 `json:"hostname,omitempty"`
+	Message   string                 `json:"message"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	Timestamp time.Time              `json:"timestamp"`
+}
+
+// Notifier delivers notifications to the log and, if configured, a webhook
+type Notifier struct {
+	webhookURL  string
+	format      string // json, cloudevents, or cloudevents-binary
+	source      string // CloudEvents source
+	eventIDs    ids.UUIDv7
+	httpClient  *http.Client
+	maintenance *MaintenanceManager // nil when maintenance windows are disabled
+	logger      *zap.Logger
+}
+
+// NewNotifier creates a new notifier. An empty webhook URL only logs.
+func NewNotifier(cfg config.NotificationsConfig, logger *zap.Logger) *Notifier {
+	source := cfg.Source
+	if source == "" {
+		hostname, _ := os.Hostname()
+		source = "/logl-server/" + hostname
+	}
+	return &Notifier{
+		webhookURL: cfg.WebhookURL,
+		format:     cfg.Format,
+		source:     source,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		logger:     logger,
+	}
+}
+
+// SetMaintenance mutes notifications covered by maintenance windows
+func (n *Notifier) SetMaintenance(maintenance *MaintenanceManager) {
+	n.maintenance = maintenance
+}
+
+// Notify logs the notification and posts it to the webhook in the background
+func (n *Notifier) Notify(notification Notification) {
+	if notification.Timestamp.IsZero() {
+		notification.Timestamp = time.Now()
+	}
+
+	if n.maintenance != nil {
+		if window, muted := n.maintenance.Muted(notification.Service, notification.Hostname); muted {
+			n.logger.Info("Notification muted by maintenance window",
+				zap.String("type", notification.Type),
+				zap.String("service", notification.Service),
+				zap.String("window", window.ID),
+				zap.String("message", notification.Message))
+			return
+		}
+	}
+
+	n.logger.Warn("Notification",
+		zap.String("type", notification.Type),
+		zap.String("service", notification.Service),
+		zap.String("message", notification.Message))
+
+	if n.webhookURL == "" {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := n.post(ctx, notification); err != nil {
+			n.logger.Error("Failed to deliver notification", zap.Error(err))
+		}
+	}()
+}
+
+// post sends a notification to the webhook
+func (n *Notifier) post(ctx context.Context, notification Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	contentType := "application/json"
+	var headers map[string]string
+	switch n.format {
+	case "cloudevents":
+		event := cloudEvent{
+			SpecVersion:     cloudEventsSpecVersion,
+			ID:              n.eventIDs.New(),
+			Source:          n.source,
+			Type:            notificationEventType(notification.Type),
+			Subject:         notification.Service,
+			Time:            &notification.Timestamp,
+			DataContentType: "application/json",
+			Data:            body,
+		}
+		if body, err = json.Marshal(event); err != nil {
+			return fmt.Errorf("failed to marshal cloud event: %w", err)
+		}
+		contentType = cloudEventsContentType
+	case "cloudevents-binary":
+		headers = map[string]string{
+			"Ce-Specversion": cloudEventsSpecVersion,
+			"Ce-Id":          n.eventIDs.New(),
+			"Ce-Source":      n.source,
+			"Ce-Type":        notificationEventType(notification.Type),
+			"Ce-Time":        notification.Timestamp.UTC().Format(time.RFC3339Nano),
+		}
+		if notification.Service != "" {
+			headers["Ce-Subject"] = notification.Service
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// notificationEventType returns the CloudEvents type for a notification
+// type, e.g. io.logl.notification.quota_warning
+func notificationEventType(notificationType string) string {
+	return "io.logl.notification." + notificationType
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/models"
+	"github.com/oicur0t/logl/pkg/mtls"
+	"go.uber.org/zap"
+)
+
+// backlogThreshold is the share of an output's queue in use at which it is
+// reported as backlogged and a warning logged, ahead of entries being
+// dropped
+const backlogThreshold = 0.8
+
+// outputTLSConfig builds the TLS configuration for connections to an
+// output's brokers or servers
+func outputTLSConfig(cfg config.OutputTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.CACert != "" {
+		caCert, err := os.ReadFile(cfg.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("failed to append CA certificate")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.ClientCert != "" {
+		cert, err := mtls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey, mtls.PassphraseFrom(cfg.KeyPassphraseFile, cfg.KeyPassphraseEnv))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// outputProgress tracks how far an output's deliveries trail ingestion. Its
+// sender records the batch it is working on while status requests and
+// metrics samples read it.
+type outputProgress struct {
+	capacity       int
+	pendingSince   atomic.Int64 // Unix nanoseconds the oldest undelivered entry was queued; 0 when idle
+	lag            atomic.Int64 // Of the last delivered batch
+	sending        atomic.Int64
+	retrying       atomic.Int64
+	failedAttempts atomic.Int64
+	lastDelivered  atomic.Int64 // Unix nanoseconds
+	lastFailed     atomic.Int64 // Unix nanoseconds of the last failed attempt
+	backlogged     bool         // Whether a backlog warning is outstanding; sender only
+}
+
+// newOutputProgress creates progress tracking for a queue of a capacity
+func newOutputProgress(capacity int) *outputProgress {
+	return &outputProgress{capacity: capacity}
+}
+
+// queued notes when an entry taken from the queue was queued. The first
+// entry of a batch is the oldest one not yet delivered.
+func (p *outputProgress) queued(at time.Time) {
+	p.pendingSince.CompareAndSwap(0, at.UnixNano())
+}
+
+// send notes that a batch is being sent
+func (p *outputProgress) send(entries int) {
+	p.sending.Store(int64(entries))
+}
+
+// attemptsFailed counts failed send attempts, with the entries left to
+// retry
+func (p *outputProgress) attemptsFailed(attempts int64, retrying int) {
+	p.failedAttempts.Add(attempts)
+	p.retrying.Store(int64(retrying))
+	p.lastFailed.Store(time.Now().UnixNano())
+}
+
+// finish records the end of a batch, delivered in part or full when
+// delivered is positive
+func (p *outputProgress) finish(delivered int) {
+	now := time.Now().UnixNano()
+	if since := p.pendingSince.Load(); delivered > 0 && since > 0 {
+		p.lag.Store(now - since)
+		p.lastDelivered.Store(now)
+	}
+	p.pendingSince.Store(0)
+	p.sending.Store(0)
+	p.retrying.Store(0)
+}
+
+// checkBacklog logs a warning when the queue passes the backlog threshold,
+// and again once it has drained to half of it
+func (p *outputProgress) checkBacklog(queued int, logger *zap.Logger, fields ...zap.Field) {
+	if p.capacity == 0 {
+		return
+	}
+	usage := float64(queued) / float64(p.capacity)
+	switch {
+	case usage >= backlogThreshold && !p.backlogged:
+		p.backlogged = true
+		logger.Warn("Output queue filling, downstream may be failing or too slow",
+			append(fields, zap.Int("queued", queued), zap.Int("capacity", p.capacity))...)
+	case usage < backlogThreshold/2 && p.backlogged:
+		p.backlogged = false
+		logger.Info("Output queue drained", append(fields, zap.Int("queued", queued))...)
+	}
+}
+
+// status reports progress for a queue holding queued entries. An output
+// whose last attempt failed is failing; one with its queue past the
+// backlog threshold is backlogged.
+func (p *outputProgress) status(queued int) models.OutputProgress {
+	now := time.Now()
+	status := models.OutputProgress{
+		State:          "ok",
+		QueueCapacity:  p.capacity,
+		Sending:        p.sending.Load(),
+		Retrying:       p.retrying.Load(),
+		FailedAttempts: p.failedAttempts.Load(),
+		LagSeconds:     time.Duration(p.lag.Load()).Seconds(),
+	}
+	if p.capacity > 0 {
+		status.QueueUsage = float64(queued) / float64(p.capacity)
+	}
+	if since := p.pendingSince.Load(); since > 0 {
+		status.PendingSeconds = now.Sub(time.Unix(0, since)).Seconds()
+	}
+	lastDelivered := p.lastDelivered.Load()
+	if lastDelivered > 0 {
+		at := time.Unix(0, lastDelivered)
+		status.LastDeliveredAt = &at
+	}
+
+	switch {
+	case p.lastFailed.Load() > lastDelivered:
+		status.State = "failing"
+	case status.QueueUsage >= backlogThreshold:
+		status.State = "backlogged"
+	}
+	return status
+}
+
+// outputStatuses lists every enabled downstream destination. Any output
+// may be nil when disabled.
+func outputStatuses(forwarder *Forwarder, kafka *KafkaOutput, nats *NATSOutput) []models.OutputStatus {
+	statuses := []models.OutputStatus{}
+	if forwarder != nil {
+		for _, t := range forwarder.Status() {
+			statuses = append(statuses, models.OutputStatus{
+				Output:         "forward:" + t.Name,
+				Queued:         t.Queued,
+				Sent:           t.Sent,
+				Dropped:        t.Dropped,
+				Failed:         t.Failed,
+				LastError:      t.LastError,
+				LastErrorAt:    t.LastErrorAt,
+				OutputProgress: t.OutputProgress,
+			})
+		}
+	}
+	if kafka != nil {
+		k := kafka.Status()
+		statuses = append(statuses, models.OutputStatus{
+			Output:         "kafka",
+			Queued:         k.Queued,
+			Sent:           k.Sent,
+			Dropped:        k.Dropped,
+			Failed:         k.Failed,
+			LastError:      k.LastError,
+			LastErrorAt:    k.LastErrorAt,
+			OutputProgress: k.OutputProgress,
+		})
+	}
+	if nats != nil {
+		n := nats.Status()
+		statuses = append(statuses, models.OutputStatus{
+			Output:         "nats",
+			Queued:         n.Queued,
+			Sent:           n.Sent,
+			Dropped:        n.Dropped,
+			Failed:         n.Failed,
+			LastError:      n.LastError,
+			LastErrorAt:    n.LastErrorAt,
+			OutputProgress: n.OutputProgress,
+		})
+	}
+	return statuses
+}
@@ -1,7 +1,8 @@
 package server
 
 import (
-	"encoding/json"
+	"fmt"
+	"strings"
 
 	"github.com/oicur0t/logl/internal/config"
 	"github.com/oicur0t/logl/pkg/models"
@@ -10,34 +11,63 @@ import (
 
 // LogParser handles parsing of log entries
 type LogParser struct {
-	config config.JSONParsingConfig
-	logger *zap.Logger
+	defaults Pipeline
+	services map[string]Pipeline // lowercased service name -> pipeline
+	levels   *LevelDetector      // nil when level detection is disabled
+	logger   *zap.Logger
 }
 
-// NewLogParser creates a new log parser
-func NewLogParser(config config.JSONParsingConfig, logger *zap.Logger) *LogParser {
-	return &LogParser{
-		config: config,
-		logger: logger,
+// NewLogParser compiles the default and per-service parsing pipelines
+func NewLogParser(cfg config.ParsingConfig, levels *LevelDetector, logger *zap.Logger) (*LogParser, error) {
+	grok, err := NewGrokLibrary(cfg.GrokPatterns)
+	if err != nil {
+		return nil, err
+	}
+
+	geo, err := NewGeoIP(cfg.GeoIP)
+	if err != nil {
+		return nil, err
+	}
+
+	defaults, err := NewPipeline(cfg.Default, grok, geo)
+	if err != nil {
+		return nil, fmt.Errorf("default pipeline: %w", err)
 	}
+
+	services := make(map[string]Pipeline, len(cfg.Services))
+	for service, stages := range cfg.Services {
+		pipeline, err := NewPipeline(stages, grok, geo)
+		if err != nil {
+			return nil, fmt.Errorf("service %s pipeline: %w", service, err)
+		}
+		services[strings.ToLower(service)] = pipeline
+	}
+
+	return &LogParser{
+		defaults: defaults,
+		services: services,
+		levels:   levels,
+		logger:   logger,
+	}, nil
 }
 
-// ParseLogEntry attempts to parse a log entry's line as JSON
-// If parsing succeeds, it populates the Parsed field
-// If parsing fails or is disabled, the entry is left unchanged
+// ParseLogEntry runs the service's pipeline (or the default pipeline) over
+// an entry, populating its Parsed field. Level detection then runs on the
+// parsed fields or the raw line, and trace IDs found in parsed fields
+// replace any taken from the ingest request.
 func (p *LogParser) ParseLogEntry(entry *models.LogEntry) {
-	if !p.config.Enabled {
-		return
+	pipeline, exists := p.services[strings.ToLower(entry.ServiceName)]
+	if !exists {
+		pipeline = p.defaults
 	}
+	pipeline.Apply(entry)
 
-	// Try to parse the line as JSON
-	var parsed map[string]interface{}
-	if err := json.Unmarshal([]byte(entry.Line), &parsed); err != nil {
-		// Not valid JSON - this is fine, just skip parsing
-		// Don't log errors as many logs won't be JSON (nginx, etc.)
-		return
+	if p.levels != nil {
+		p.levels.Detect(entry)
 	}
 
-	// Successfully parsed - store the parsed data
-	entry.Parsed = parsed
+	if trace, ok := traceContextFromParsed(entry.Parsed); ok {
+		entry.TraceID = trace.TraceID
+		entry.SpanID = trace.SpanID
+	}
 }
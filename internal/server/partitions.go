@@ -0,0 +1,219 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
+)
+
+// partitionPattern matches a partition suffix: _YYYY_MM_DD (day) or _YYYY_MM (month)
+var partitionPattern = regexp.MustCompile(`^(.+)_(\d{4})_(\d{2})(?:_(\d{2}))?$`)
+
+// partitionName returns the collection a service's entries at t are written
+// to: the service collection itself, or its partition when partitioning
+func (s *Storage) partitionName(collName string, t time.Time) string {
+	t = t.UTC()
+	switch s.partitioning.Interval {
+	case "day":
+		return fmt.Sprintf("%s_%04d_%02d_%02d", collName, t.Year(), t.Month(), t.Day())
+	case "month":
+		return fmt.Sprintf("%s_%04d_%02d", collName, t.Year(), t.Month())
+	default:
+		return collName
+	}
+}
+
+// parsePartition splits a partition collection name into its service
+// collection and the time range it covers
+func parsePartition(collName string) (base string, start, end time.Time, ok bool) {
+	m := partitionPattern.FindStringSubmatch(collName)
+	if m == nil {
+		return "", time.Time{}, time.Time{}, false
+	}
+
+	layout, value := "2006_01", m[2]+"_"+m[3]
+	if m[4] != "" {
+		layout, value = "2006_01_02", value+"_"+m[4]
+	}
+	start, err := time.Parse(layout, value)
+	if err != nil {
+		return "", time.Time{}, time.Time{}, false
+	}
+
+	if m[4] != "" {
+		end = start.AddDate(0, 0, 1)
+	} else {
+		end = start.AddDate(0, 1, 0)
+	}
+	return m[1], start, end, true
+}
+
+// partitionBatch splits a batch by the partition each entry belongs to,
+// keeping entry order within each partition
+func (s *Storage) partitionBatch(collName string, batch models.LogBatch) map[string]models.LogBatch {
+	parts := make(map[string]models.LogBatch)
+	for _, entry := range batch.Entries {
+		name := s.partitionName(collName, entry.Timestamp)
+		part, exists := parts[name]
+		if !exists {
+			part = models.LogBatch{ServiceName: batch.ServiceName}
+		}
+		part.Entries = append(part.Entries, entry)
+		parts[name] = part
+	}
+	return parts
+}
+
+// CollectionsFor returns the collections holding a service's entries in
+// [from, to), newest first: its partitions overlapping the range, then the
+// unpartitioned collection if it exists. Zero times leave the range open.
+func (s *Storage) CollectionsFor(ctx context.Context, serviceName string, from, to time.Time) ([]string, error) {
+	base := s.CollectionFor(serviceName)
+	if s.partitioning.Interval == "" {
+		return []string{base}, nil
+	}
+
+	filter := bson.M{"name": bson.M{"$regex": "^" + regexp.QuoteMeta(base) + `(_\d{4}_\d{2}(_\d{2})?)?$`}}
+	names, err := s.database.ListCollectionNames(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list partitions: %w", err)
+	}
+
+	type partition struct {
+		name  string
+		start time.Time
+	}
+	var partitions []partition
+	hasBase := false
+	for _, name := range names {
+		if name == base {
+			hasBase = true
+			continue
+		}
+		partBase, start, end, ok := parsePartition(name)
+		if !ok || partBase != base {
+			continue
+		}
+		if (!from.IsZero() && !end.After(from)) || (!to.IsZero() && !start.Before(to)) {
+			continue
+		}
+		partitions = append(partitions, partition{name: name, start: start})
+	}
+
+	sort.Slice(partitions, func(i, j int) bool {
+		return partitions[i].start.After(partitions[j].start)
+	})
+	collections := make([]string, 0, len(partitions)+1)
+	for _, p := range partitions {
+		collections = append(collections, p.name)
+	}
+	if hasBase {
+		collections = append(collections, base)
+	}
+	return collections, nil
+}
+
+// FindServiceLogs returns the newest entries for a service matching the
+// filter, across its partitions
+func (s *Storage) FindServiceLogs(ctx context.Context, serviceName string, from, to time.Time, filter bson.M, limit int64) ([]models.LogEntry, error) {
+	collections, err := s.CollectionsFor(ctx, serviceName, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]models.LogEntry, 0)
+	for _, collName := range collections {
+		found, err := s.FindLogs(ctx, collName, filter, limit-int64(len(entries)))
+		if err != nil {
+			return nil, fmt.Errorf("collection %s: %w", collName, err)
+		}
+		entries = append(entries, found...)
+
+		// Partitions don't overlap, so older ones can't hold newer entries
+		if int64(len(entries)) >= limit {
+			break
+		}
+	}
+	return entries, nil
+}
+
+// PartitionRetention drops partitions once all of their entries are older
+// than the service's retention, instead of deleting entries one by one
+type PartitionRetention struct {
+	storage  *Storage
+	interval time.Duration
+	logger   *zap.Logger
+}
+
+// NewPartitionRetention creates a new partition retention job
+func NewPartitionRetention(storage *Storage, cfg config.PartitioningConfig, logger *zap.Logger) *PartitionRetention {
+	return &PartitionRetention{
+		storage:  storage,
+		interval: cfg.CheckInterval,
+		logger:   logger,
+	}
+}
+
+// Start drops expired partitions every interval until ctx is cancelled
+func (p *PartitionRetention) Start(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.DropExpired(ctx); err != nil {
+			p.logger.Error("Failed to drop expired partitions", zap.Error(err))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// DropExpired drops every partition that ended before its retention cutoff
+func (p *PartitionRetention) DropExpired(ctx context.Context) error {
+	s := p.storage
+
+	// Pick up overrides set through the API on other instances
+	if err := s.LoadRetentionOverrides(ctx); err != nil {
+		p.logger.Warn("Using cached retention overrides", zap.Error(err))
+	}
+
+	names, err := s.ListLogCollections(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, name := range names {
+		base, _, end, ok := parsePartition(name)
+		if !ok {
+			continue
+		}
+
+		ttlDays := s.RetentionFor(strings.TrimPrefix(base, s.collectionPrefix)).TTLDays
+		if ttlDays <= 0 || end.After(now.AddDate(0, 0, -ttlDays)) {
+			continue
+		}
+
+		if err := s.database.Collection(name).Drop(ctx); err != nil {
+			return fmt.Errorf("failed to drop partition %s: %w", name, err)
+		}
+		s.markUnindexed(name)
+		p.logger.Info("Dropped expired partition",
+			zap.String("collection", name),
+			zap.Time("ended", end),
+			zap.Int("ttl_days", ttlDays))
+	}
+	return nil
+}
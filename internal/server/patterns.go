@@ -0,0 +1,234 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
+)
+
+// maxPatternLength caps how much of a line contributes to its pattern
+const maxPatternLength = 512
+
+// patternReplacements mask variable tokens so lines that differ only in
+// IDs, numbers, addresses, and times share a pattern. Order matters: more
+// specific shapes are replaced before the numbers inside them.
+var patternReplacements = []struct {
+	re          *regexp.Regexp
+	placeholder string
+}{
+	{regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?`), "<ts>"},
+	{regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`), "<uuid>"},
+	{regexp.MustCompile(`\b\d{1,3}(\.\d{1,3}){3}(:\d+)?\b`), "<ip>"},
+	{regexp.MustCompile(`\b(0x[0-9a-fA-F]+|[0-9a-fA-F]*\d[0-9a-fA-F]*[a-fA-F][0-9a-fA-F]*|[0-9a-fA-F]*[a-fA-F][0-9a-fA-F]*\d[0-9a-fA-F]*)\b`), "<hex>"},
+	{regexp.MustCompile(`(?i)\b\d+(\.\d+)*(ns|us|ms|s|m|h|b|kb|mb|gb)?\b`), "<num>"},
+}
+
+// LinePattern reduces a log line to its pattern by masking variable tokens
+func LinePattern(line string) string {
+	if len(line) > maxPatternLength {
+		line = line[:maxPatternLength]
+	}
+	for _, r := range patternReplacements {
+		line = r.re.ReplaceAllString(line, r.placeholder)
+	}
+	return line
+}
+
+// patternCounts is the pattern distribution of one window
+type patternCounts struct {
+	total    int64 // Entries in the window
+	sampled  int64 // Entries counted
+	counts   map[string]int64
+	examples map[string]string
+}
+
+// share returns the fraction of the window's entries with a pattern
+func (c patternCounts) share(pattern string) float64 {
+	if c.sampled == 0 {
+		return 0
+	}
+	return float64(c.counts[pattern]) / float64(c.sampled)
+}
+
+// estimate scales a pattern's sampled count to the whole window
+func (c patternCounts) estimate(pattern string) int64 {
+	return int64(math.Round(c.share(pattern) * float64(c.total)))
+}
+
+// PatternDiffer compares log pattern distributions between time windows
+type PatternDiffer struct {
+	storage *Storage
+	cfg     config.PatternDiffConfig
+	logger  *zap.Logger
+}
+
+// NewPatternDiffer creates a new pattern differ
+func NewPatternDiffer(storage *Storage, cfg config.PatternDiffConfig, logger *zap.Logger) *PatternDiffer {
+	return &PatternDiffer{
+		storage: storage,
+		cfg:     cfg,
+		logger:  logger,
+	}
+}
+
+// Diff compares a service's patterns in [baselineFrom, baselineTo) with
+// [currentFrom, currentTo). Shares rather than counts are compared, so the
+// windows may differ in length and volume.
+func (d *PatternDiffer) Diff(ctx context.Context, service string, baselineFrom, baselineTo, currentFrom, currentTo time.Time) (*models.PatternDiff, error) {
+	baseline, err := d.countPatterns(ctx, service, baselineFrom, baselineTo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count baseline patterns: %w", err)
+	}
+	current, err := d.countPatterns(ctx, service, currentFrom, currentTo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count current patterns: %w", err)
+	}
+
+	diff := &models.PatternDiff{
+		Service:       service,
+		BaselineFrom:  baselineFrom,
+		BaselineTo:    baselineTo,
+		CurrentFrom:   currentFrom,
+		CurrentTo:     currentTo,
+		BaselineTotal: baseline.total,
+		CurrentTotal:  current.total,
+		Sampled:       baseline.sampled < baseline.total || current.sampled < current.total,
+		New:           []models.PatternChange{},
+		Vanished:      []models.PatternChange{},
+		Shifted:       []models.PatternChange{},
+	}
+
+	change := func(pattern, example string) models.PatternChange {
+		return models.PatternChange{
+			Pattern:       pattern,
+			Example:       example,
+			BaselineCount: baseline.estimate(pattern),
+			CurrentCount:  current.estimate(pattern),
+			BaselineShare: baseline.share(pattern),
+			CurrentShare:  current.share(pattern),
+		}
+	}
+
+	for pattern := range current.counts {
+		c := change(pattern, current.examples[pattern])
+		switch {
+		case baseline.counts[pattern] == 0:
+			if c.CurrentCount >= d.cfg.MinCount {
+				diff.New = append(diff.New, c)
+			}
+		case c.CurrentCount >= d.cfg.MinCount || c.BaselineCount >= d.cfg.MinCount:
+			c.Ratio = c.CurrentShare / c.BaselineShare
+			if c.Ratio >= d.cfg.MinRatio || c.Ratio <= 1/d.cfg.MinRatio {
+				diff.Shifted = append(diff.Shifted, c)
+			}
+		}
+	}
+	for pattern := range baseline.counts {
+		if current.counts[pattern] > 0 {
+			continue
+		}
+		if c := change(pattern, baseline.examples[pattern]); c.BaselineCount >= d.cfg.MinCount {
+			diff.Vanished = append(diff.Vanished, c)
+		}
+	}
+
+	// Largest first, by volume for new and vanished and by size of shift
+	sort.Slice(diff.New, func(i, j int) bool { return diff.New[i].CurrentCount > diff.New[j].CurrentCount })
+	sort.Slice(diff.Vanished, func(i, j int) bool { return diff.Vanished[i].BaselineCount > diff.Vanished[j].BaselineCount })
+	sort.Slice(diff.Shifted, func(i, j int) bool {
+		return math.Abs(math.Log(diff.Shifted[i].Ratio)) > math.Abs(math.Log(diff.Shifted[j].Ratio))
+	})
+	diff.New = truncateChanges(diff.New, d.cfg.MaxPatterns)
+	diff.Vanished = truncateChanges(diff.Vanished, d.cfg.MaxPatterns)
+	diff.Shifted = truncateChanges(diff.Shifted, d.cfg.MaxPatterns)
+
+	d.logger.Debug("Pattern diff computed",
+		zap.String("service", service),
+		zap.Int("baseline_patterns", len(baseline.counts)),
+		zap.Int("current_patterns", len(current.counts)))
+
+	return diff, nil
+}
+
+// countPatterns counts patterns in a window. Windows larger than the sample
+// size are sampled, from each collection in proportion to its entries.
+func (d *PatternDiffer) countPatterns(ctx context.Context, service string, from, to time.Time) (patternCounts, error) {
+	result := patternCounts{
+		counts:   make(map[string]int64),
+		examples: make(map[string]string),
+	}
+
+	collections, err := d.storage.CollectionsFor(ctx, service, from, to)
+	if err != nil {
+		return result, err
+	}
+
+	filter := BuildQueryFilter(models.LogQuery{From: from, To: to})
+	totals := make([]int64, len(collections))
+	for i, collName := range collections {
+		n, err := d.storage.database.Collection(collName).CountDocuments(ctx, filter)
+		if err != nil {
+			return result, fmt.Errorf("failed to count %s: %w", collName, err)
+		}
+		totals[i] = n
+		result.total += n
+	}
+
+	for i, collName := range collections {
+		if totals[i] == 0 {
+			continue
+		}
+		size := totals[i]
+		if result.total > int64(d.cfg.SampleSize) {
+			size = int64(math.Ceil(float64(d.cfg.SampleSize) * float64(totals[i]) / float64(result.total)))
+		}
+
+		pipeline := bson.A{
+			bson.M{"$match": filter},
+			bson.M{"$sample": bson.M{"size": size}},
+			bson.M{"$project": bson.M{"_id": 0, "line": 1}},
+		}
+		cursor, err := d.storage.database.Collection(collName).Aggregate(ctx, pipeline)
+		if err != nil {
+			return result, fmt.Errorf("failed to sample %s: %w", collName, err)
+		}
+
+		for cursor.Next(ctx) {
+			var doc struct {
+				Line string `bson:"line"`
+			}
+			if err := cursor.Decode(&doc); err != nil {
+				cursor.Close(ctx)
+				return result, fmt.Errorf("failed to decode sample: %w", err)
+			}
+			pattern := LinePattern(doc.Line)
+			result.counts[pattern]++
+			result.sampled++
+			if _, exists := result.examples[pattern]; !exists {
+				result.examples[pattern] = doc.Line
+			}
+		}
+		err = cursor.Err()
+		cursor.Close(ctx)
+		if err != nil {
+			return result, fmt.Errorf("failed to sample %s: %w", collName, err)
+		}
+	}
+	return result, nil
+}
+
+// truncateChanges keeps the first max changes
+func truncateChanges(changes []models.PatternChange, max int) []models.PatternChange {
+	if len(changes) > max {
+		return changes[:max]
+	}
+	return changes
+}
@@ -0,0 +1,335 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/models"
+)
+
+// Stage is one step of a parsing pipeline. Stages that don't apply to an
+// entry (e.g. a regex that doesn't match) leave it unchanged.
+type Stage interface {
+	Apply(entry *models.LogEntry)
+}
+
+// Pipeline runs its stages in order
+type Pipeline []Stage
+
+// Apply runs every stage over the entry
+func (p Pipeline) Apply(entry *models.LogEntry) {
+	for _, stage := range p {
+		stage.Apply(entry)
+	}
+}
+
+// NewPipeline compiles stage configuration into a pipeline, resolving grok
+// expressions against the given library. geo may be nil when no geoip
+// stages are used.
+func NewPipeline(stages []config.ParseStageConfig, grok *GrokLibrary, geo *GeoIP) (Pipeline, error) {
+	pipeline := make(Pipeline, 0, len(stages))
+	for i, cfg := range stages {
+		stage, err := newStage(cfg, grok, geo)
+		if err != nil {
+			return nil, fmt.Errorf("stage %d (%s): %w", i+1, cfg.Type, err)
+		}
+		pipeline = append(pipeline, stage)
+	}
+	return pipeline, nil
+}
+
+// newStage compiles a single stage
+func newStage(cfg config.ParseStageConfig, grok *GrokLibrary, geo *GeoIP) (Stage, error) {
+	switch cfg.Type {
+	case "json":
+		return &jsonStage{source: cfg.Source, target: cfg.Target}, nil
+	case "regex":
+		re, err := regexp.Compile(cfg.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern: %w", err)
+		}
+		return newCaptureStage(cfg.Source, cfg.Target, re)
+	case "grok":
+		re, err := grok.Compile(cfg.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		return newCaptureStage(cfg.Source, cfg.Target, re)
+	case "kv":
+		delimiter := cfg.Delimiter
+		if delimiter == "" {
+			delimiter = "="
+		}
+		return &kvStage{source: cfg.Source, target: cfg.Target, separator: cfg.Separator, delimiter: delimiter}, nil
+	case "timestamp":
+		if cfg.Field == "" {
+			return nil, fmt.Errorf("field is required")
+		}
+		layout := cfg.Layout
+		if layout == "" {
+			layout = "rfc3339"
+		}
+		return &timestampStage{field: cfg.Field, layout: layout}, nil
+	case "rename":
+		if cfg.From == "" || cfg.To == "" {
+			return nil, fmt.Errorf("from and to are required")
+		}
+		return &renameStage{from: cfg.From, to: cfg.To}, nil
+	case "drop":
+		if len(cfg.Fields) == 0 {
+			return nil, fmt.Errorf("fields is required")
+		}
+		return &dropStage{fields: cfg.Fields}, nil
+	case "geoip":
+		if geo == nil {
+			return nil, fmt.Errorf("parsing.geoip databases are not configured")
+		}
+		if cfg.Field == "" {
+			return nil, fmt.Errorf("field is required")
+		}
+		target := cfg.Target
+		if target == "" {
+			target = "geo"
+		}
+		return &geoIPStage{geo: geo, field: cfg.Field, target: target}, nil
+	default:
+		return nil, fmt.Errorf("unknown stage type, expected json, regex, grok, kv, timestamp, rename, drop, or geoip")
+	}
+}
+
+// jsonStage parses a JSON object out of the source
+type jsonStage struct {
+	source string
+	target string
+}
+
+// Apply implements Stage
+func (s *jsonStage) Apply(entry *models.LogEntry) {
+	text, ok := sourceText(entry, s.source)
+	if !ok {
+		return
+	}
+
+	var parsed map[string]interface{}
+	if err := json.Unmarshal([]byte(text), &parsed); err != nil {
+		// Not valid JSON - many logs won't be (nginx, etc.)
+		return
+	}
+	mergeParsed(entry, s.target, parsed)
+}
+
+// captureStage extracts named capture groups (regex and grok stages)
+type captureStage struct {
+	source string
+	target string
+	re     *regexp.Regexp
+	names  []string
+}
+
+// newCaptureStage requires the expression to have named groups
+func newCaptureStage(source, target string, re *regexp.Regexp) (*captureStage, error) {
+	names := re.SubexpNames()
+	named := false
+	for _, name := range names {
+		if name != "" {
+			named = true
+			break
+		}
+	}
+	if !named {
+		return nil, fmt.Errorf("pattern has no named captures")
+	}
+	return &captureStage{source: source, target: target, re: re, names: names}, nil
+}
+
+// Apply implements Stage
+func (s *captureStage) Apply(entry *models.LogEntry) {
+	text, ok := sourceText(entry, s.source)
+	if !ok {
+		return
+	}
+
+	match := s.re.FindStringSubmatch(text)
+	if match == nil {
+		return
+	}
+
+	fields := make(map[string]interface{})
+	for i, name := range s.names {
+		if name != "" && match[i] != "" {
+			fields[name] = match[i]
+		}
+	}
+	mergeParsed(entry, s.target, fields)
+}
+
+// kvStage parses key=value pairs
+type kvStage struct {
+	source    string
+	target    string
+	separator string // empty splits on whitespace
+	delimiter string
+}
+
+// Apply implements Stage
+func (s *kvStage) Apply(entry *models.LogEntry) {
+	text, ok := sourceText(entry, s.source)
+	if !ok {
+		return
+	}
+
+	var pairs []string
+	if s.separator == "" {
+		pairs = strings.Fields(text)
+	} else {
+		pairs = strings.Split(text, s.separator)
+	}
+
+	fields := make(map[string]interface{})
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), s.delimiter)
+		if !ok || key == "" {
+			continue
+		}
+		fields[key] = strings.Trim(value, `"'`)
+	}
+	if len(fields) > 0 {
+		mergeParsed(entry, s.target, fields)
+	}
+}
+
+// timestampStage replaces the entry timestamp with a parsed field
+type timestampStage struct {
+	field  string
+	layout string // Go layout, or rfc3339, unix, unix_ms
+}
+
+// Apply implements Stage
+func (s *timestampStage) Apply(entry *models.LogEntry) {
+	var ts time.Time
+	var err error
+
+	switch value := lookupParsed(entry.Parsed, s.field).(type) {
+	case string:
+		ts, err = s.parse(value)
+	case float64:
+		ts, err = s.parse(strconv.FormatFloat(value, 'f', -1, 64))
+	default:
+		return
+	}
+	if err == nil {
+		entry.Timestamp = ts
+	}
+}
+
+// parse converts a value using the stage's layout
+func (s *timestampStage) parse(value string) (time.Time, error) {
+	switch s.layout {
+	case "rfc3339":
+		return time.Parse(time.RFC3339Nano, value)
+	case "unix", "unix_ms":
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if s.layout == "unix_ms" {
+			return time.UnixMilli(int64(f)), nil
+		}
+		return time.Unix(0, int64(f*float64(time.Second))), nil
+	default:
+		return time.Parse(s.layout, value)
+	}
+}
+
+// renameStage moves a parsed field
+type renameStage struct {
+	from string
+	to   string
+}
+
+// Apply implements Stage
+func (s *renameStage) Apply(entry *models.LogEntry) {
+	value := lookupParsed(entry.Parsed, s.from)
+	if value == nil {
+		return
+	}
+	deleteParsed(entry.Parsed, s.from)
+	setParsed(entry, s.to, value)
+}
+
+// dropStage removes parsed fields
+type dropStage struct {
+	fields []string
+}
+
+// Apply implements Stage
+func (s *dropStage) Apply(entry *models.LogEntry) {
+	for _, field := range s.fields {
+		deleteParsed(entry.Parsed, field)
+	}
+	if len(entry.Parsed) == 0 {
+		entry.Parsed = nil
+	}
+}
+
+// sourceText returns the text a stage reads: the raw line, or a string
+// parsed field when source is set
+func sourceText(entry *models.LogEntry, source string) (string, bool) {
+	if source == "" || source == "line" {
+		return entry.Line, true
+	}
+	text, ok := lookupParsed(entry.Parsed, source).(string)
+	return text, ok
+}
+
+// mergeParsed adds fields to the entry's parsed data, nested under target if set
+func mergeParsed(entry *models.LogEntry, target string, fields map[string]interface{}) {
+	if target != "" {
+		setParsed(entry, target, fields)
+		return
+	}
+	if entry.Parsed == nil {
+		entry.Parsed = make(map[string]interface{}, len(fields))
+	}
+	for k, v := range fields {
+		entry.Parsed[k] = v
+	}
+}
+
+// setParsed stores a value at a dotted path, creating intermediate objects
+func setParsed(entry *models.LogEntry, path string, value interface{}) {
+	if entry.Parsed == nil {
+		entry.Parsed = make(map[string]interface{})
+	}
+
+	keys := strings.Split(path, ".")
+	current := entry.Parsed
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := current[key].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			current[key] = next
+		}
+		current = next
+	}
+	current[keys[len(keys)-1]] = value
+}
+
+// deleteParsed removes the value at a dotted path
+func deleteParsed(parsed map[string]interface{}, path string) {
+	keys := strings.Split(path, ".")
+	current := parsed
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := current[key].(map[string]interface{})
+		if !ok {
+			return
+		}
+		current = next
+	}
+	delete(current, keys[len(keys)-1])
+}
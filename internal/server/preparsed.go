@@ -0,0 +1,52 @@
+package server
+
+import (
+	"net/http"
+	"path"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/models"
+)
+
+// PreParsedTrust decides whose pre-parsed batches are stored without
+// running the parsing pipelines. Only senders identified by a verified
+// client certificate can be trusted.
+type PreParsedTrust struct {
+	clients []string // Common name globs
+}
+
+// NewPreParsedTrust creates a new trust list
+func NewPreParsedTrust(cfg config.PreParsedConfig) *PreParsedTrust {
+	return &PreParsedTrust{clients: cfg.TrustedClients}
+}
+
+// Trusts reports whether the request's client certificate common name
+// matches a trusted client
+func (t *PreParsedTrust) Trusts(r *http.Request) bool {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return false
+	}
+	name := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	for _, client := range t.clients {
+		if ok, _ := path.Match(client, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// AcceptPreParsed completes an entry parsed by a trusted sender without
+// running its service's pipeline. The sent level is mapped onto the
+// canonical names and only detected when missing; trace context is read
+// from parsed fields as usual.
+func (p *LogParser) AcceptPreParsed(entry *models.LogEntry) {
+	entry.Level = NormalizeLevel(entry.Level)
+	if entry.Level == "" && p.levels != nil {
+		p.levels.Detect(entry)
+	}
+
+	if trace, ok := traceContextFromParsed(entry.Parsed); ok {
+		entry.TraceID = trace.TraceID
+		entry.SpanID = trace.SpanID
+	}
+}
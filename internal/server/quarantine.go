@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/oicur0t/logl/pkg/models"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+)
+
+// MongoDB write error codes
+const (
+	codeDuplicateKey       = 11000
+	codeObjectTooLarge     = 10334
+	maxQuarantineLineBytes = 64 * 1024
+)
+
+// handleWriteErrors quarantines entries MongoDB rejected individually
+// within an unordered InsertMany. The remaining entries were already
+// inserted, so the batch is treated as stored.
+func (s *Storage) handleWriteErrors(ctx context.Context, collName string, batch models.LogBatch, writeErrors []mongo.BulkWriteError) {
+	duplicates := 0
+	var quarantined []interface{}
+	now := time.Now()
+
+	for _, we := range writeErrors {
+		// Duplicates are already stored, which is fine for idempotency
+		if we.Code == codeDuplicateKey {
+			duplicates++
+			continue
+		}
+		if we.Index < 0 || we.Index >= len(batch.Entries) {
+			continue
+		}
+		quarantined = append(quarantined, quarantineEntry(collName, batch.Entries[we.Index], we.WriteError, now))
+	}
+
+	if duplicates > 0 {
+		s.logger.Warn("Duplicate key error, some documents already exist",
+			zap.String("collection", collName),
+			zap.Int("duplicates", duplicates))
+	}
+	if len(quarantined) == 0 {
+		return
+	}
+
+	s.logger.Warn("Quarantining rejected documents",
+		zap.String("collection", collName),
+		zap.Int("rejected", len(quarantined)),
+		zap.Int("batch_size", len(batch.Entries)),
+		zap.String("first_error", writeErrors[0].Message))
+
+	if _, err := s.database.Collection(s.quarantineCollection).InsertMany(ctx, quarantined); err != nil {
+		s.logger.Error("Failed to quarantine rejected documents",
+			zap.String("collection", collName),
+			zap.Int("rejected", len(quarantined)),
+			zap.Error(err))
+	}
+}
+
+// quarantineEntry wraps a rejected entry, shrinking it when it was too large to store
+func quarantineEntry(collName string, entry models.LogEntry, we mongo.WriteError, now time.Time) models.QuarantinedEntry {
+	q := models.QuarantinedEntry{
+		Collection:    collName,
+		Code:          we.Code,
+		Error:         we.Message,
+		Entry:         entry,
+		QuarantinedAt: now,
+	}
+	if we.Code == codeObjectTooLarge {
+		q.Entry.Parsed = nil
+		q.Truncated = true
+	}
+	if len(q.Entry.Line) > maxQuarantineLineBytes {
+		q.Entry.Line = q.Entry.Line[:maxQuarantineLineBytes]
+		q.Truncated = true
+	}
+	return q
+}
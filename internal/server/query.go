@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/oicur0t/logl/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// validLabelKey reports whether a label key is safe to use in a field path
+func validLabelKey(key string) bool {
+	return key != "" && !strings.ContainsAny(key, ".$")
+}
+
+// BuildQueryFilter converts a log query into a MongoDB filter
+func BuildQueryFilter(q models.LogQuery) bson.M {
+	filter := bson.M{}
+
+	if q.Hostname != "" {
+		filter["hostname"] = q.Hostname
+	}
+	if q.FilePath != "" {
+		filter["file_path"] = q.FilePath
+	}
+	if q.Contains != "" {
+		filter["line"] = bson.M{"$regex": regexp.QuoteMeta(q.Contains)}
+	}
+	if q.Search != "" {
+		filter["$text"] = bson.M{"$search": q.Search}
+	}
+	if q.TraceID != "" {
+		filter["trace_id"] = q.TraceID
+	}
+	if q.EntryID != "" {
+		filter["entry_id"] = q.EntryID
+	}
+	if q.IngestedBy != "" {
+		filter["ingested_by"] = q.IngestedBy
+	}
+	for k, v := range q.Labels {
+		filter["labels."+k] = v
+	}
+	if len(q.Levels) == 1 {
+		filter["level"] = q.Levels[0]
+	} else if len(q.Levels) > 1 {
+		filter["level"] = bson.M{"$in": q.Levels}
+	}
+
+	timeRange := bson.M{}
+	if !q.From.IsZero() {
+		timeRange["$gte"] = q.From
+	}
+	if !q.To.IsZero() {
+		timeRange["$lt"] = q.To
+	}
+	if len(timeRange) > 0 {
+		filter["timestamp"] = timeRange
+	}
+
+	return filter
+}
+
+// CollectionFor returns the collection name used for a service
+func (s *Storage) CollectionFor(serviceName string) string {
+	return s.sanitizeCollectionName(serviceName)
+}
+
+// FindLogs returns the newest entries in a collection matching the filter
+func (s *Storage) FindLogs(ctx context.Context, collName string, filter bson.M, limit int64) ([]models.LogEntry, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: -1}}).
+		SetLimit(limit)
+
+	cursor, err := s.database.Collection(collName).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query logs: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	entries := make([]models.LogEntry, 0)
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, fmt.Errorf("failed to decode logs: %w", err)
+	}
+
+	return entries, nil
+}
+
+// FindTrace returns entries for a trace ID across every log collection
+// include accepts (every collection when nil), oldest first, up to limit
+func (s *Storage) FindTrace(ctx context.Context, traceID, region string, include func(collName string) bool, limit int64) ([]models.LogEntry, error) {
+	collections, err := s.ListLogCollections(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{"trace_id": traceID}
+	if region != "" {
+		filter["labels."+regionLabel] = region
+	}
+	entries := make([]models.LogEntry, 0)
+	for _, collName := range collections {
+		if include != nil && !include(collName) {
+			continue
+		}
+		found, err := s.FindLogs(ctx, collName, filter, limit)
+		if err != nil {
+			return nil, fmt.Errorf("collection %s: %w", collName, err)
+		}
+		entries = append(entries, found...)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+	if int64(len(entries)) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+// ExplainFind returns the executionStats explain plan for a find query
+func (s *Storage) ExplainFind(ctx context.Context, collName string, filter interface{}, limit int64) (bson.M, error) {
+	cmd := bson.D{
+		{Key: "explain", Value: bson.D{
+			{Key: "find", Value: collName},
+			{Key: "filter", Value: filter},
+			{Key: "sort", Value: bson.D{{Key: "timestamp", Value: -1}}},
+			{Key: "limit", Value: limit},
+		}},
+		{Key: "verbosity", Value: "executionStats"},
+	}
+
+	var plan bson.M
+	if err := s.database.RunCommand(ctx, cmd).Decode(&plan); err != nil {
+		return nil, fmt.Errorf("failed to explain query: %w", err)
+	}
+
+	return plan, nil
+}
+
+// docsExamined extracts totalDocsExamined from an executionStats explain plan
+func docsExamined(plan bson.M) int64 {
+	stats, ok := plan["executionStats"].(bson.M)
+	if !ok {
+		return -1
+	}
+
+	switch v := stats["totalDocsExamined"].(type) {
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	default:
+		return -1
+	}
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/models"
+)
+
+// QuotaStatus describes a service's quota usage after an ingest check
+type QuotaStatus struct {
+	Limit    int64
+	Used     int64 // usage once the batch is charged, or before it when it was rejected
+	Warning  bool  // usage is at or above the warning threshold
+	Exceeded bool  // the batch was rejected
+}
+
+// QuotaManager enforces per-service entry quotas over a fixed window and
+// warns services approaching their limit. Services are keyed by their
+// normalized name, as their collections are, so names differing only in
+// case or punctuation share a quota.
+type QuotaManager struct {
+	key          func(name string) string // Maps a name to its usage and limit key
+	window       time.Duration
+	defaultLimit int64
+	limits       map[string]int64
+	warnRatio    float64
+	notifier     *Notifier
+	subject      string // What limits are keyed by, "service" or "tenant"
+
+	mu    sync.Mutex
+	usage map[string]*quotaUsage
+}
+
+// quotaUsage tracks entries accepted for a service in the current window
+type quotaUsage struct {
+	windowStart time.Time
+	entries     int64
+	warned      bool
+	exceeded    bool
+}
+
+// NewQuotaManager creates a new quota manager
+func NewQuotaManager(cfg config.QuotaConfig, notifier *Notifier) *QuotaManager {
+	return newQuotaManager(cfg, notifier, "service", normalizeServiceName)
+}
+
+// newQuotaManager creates a quota manager for limits of the subject, keyed
+// by key
+func newQuotaManager(cfg config.QuotaConfig, notifier *Notifier, subject string, key func(string) string) *QuotaManager {
+	limits := make(map[string]int64, len(cfg.Services))
+	for name, limit := range cfg.Services {
+		limits[key(name)] = limit
+	}
+	return &QuotaManager{
+		key:          key,
+		window:       cfg.Window,
+		defaultLimit: cfg.DefaultLimit,
+		limits:       limits,
+		warnRatio:    cfg.WarnRatio,
+		notifier:     notifier,
+		subject:      subject,
+		usage:        make(map[string]*quotaUsage),
+	}
+}
+
+// limitFor returns the entry limit for a key, 0 meaning
+// unlimited
+func (q *QuotaManager) limitFor(key string) int64 {
+	if limit, ok := q.limits[key]; ok {
+		return limit
+	}
+	return q.defaultLimit
+}
+
+// current returns a key's usage in the current window, starting a new
+// window once the last has ended. The caller holds q.mu.
+func (q *QuotaManager) current(key string) *quotaUsage {
+	now := time.Now()
+	u, exists := q.usage[key]
+	if !exists || now.Sub(u.windowStart) >= q.window {
+		u = &quotaUsage{windowStart: now}
+		q.usage[key] = u
+	}
+	return u
+}
+
+// Check reports whether a batch of entries fits in the quota. Nothing is
+// counted until Charge, so batches rejected here or later in ingestion,
+// and the retries that follow, don't use up the quota. Batches checked
+// at the same time may together overshoot it slightly.
+func (q *QuotaManager) Check(name string, entries int) QuotaStatus {
+	key := q.key(name)
+	limit := q.limitFor(key)
+	if limit <= 0 {
+		return QuotaStatus{}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	u := q.current(key)
+	status := QuotaStatus{Limit: limit}
+	if u.entries+int64(entries) > limit {
+		status.Used = u.entries
+		status.Warning = true
+		status.Exceeded = true
+		if !u.exceeded {
+			u.exceeded = true
+			q.notify(name, "quota_exceeded", fmt.Sprintf("%s %s exceeded its quota of %d entries", q.subject, name, limit), u.entries, limit)
+		}
+		return status
+	}
+
+	status.Used = u.entries + int64(entries)
+	status.Warning = float64(status.Used) >= float64(limit)*q.warnRatio
+	return status
+}
+
+// Charge counts an accepted batch's entries against the quota, warning
+// once usage reaches the warning threshold
+func (q *QuotaManager) Charge(name string, entries int) {
+	key := q.key(name)
+	limit := q.limitFor(key)
+	if limit <= 0 || entries == 0 {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	u := q.current(key)
+	u.entries += int64(entries)
+	if !u.warned && float64(u.entries) >= float64(limit)*q.warnRatio {
+		u.warned = true
+		q.notify(name, "quota_warning", fmt.Sprintf("%s %s has used %.0f%% of its quota of %d entries", q.subject, name, 100*float64(u.entries)/float64(limit), limit), u.entries, limit)
+	}
+}
+
+// Usage returns the entries counted for a name in its current window
+func (q *QuotaManager) Usage(name string) int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	u, ok := q.usage[q.key(name)]
+	if !ok || time.Since(u.windowStart) >= q.window {
+		return 0
+	}
+	return u.entries
+}
+
+// notify sends a quota notification if a notifier is configured
+func (q *QuotaManager) notify(key, kind, message string, used, limit int64) {
+	if q.notifier == nil {
+		return
+	}
+	details := map[string]interface{}{
+		"used":   used,
+		"limit":  limit,
+		"window": q.window.String(),
+	}
+	notification := Notification{Type: kind, Message: message, Details: details}
+	if q.subject == "service" {
+		notification.Service = key
+	} else {
+		details[q.subject] = key
+	}
+	q.notifier.Notify(notification)
+}
+
+// writeQuotaError rejects a batch over quota. Retrying doesn't help until
+// the window resets, so the error isn't retryable.
+func writeQuotaError(w http.ResponseWriter, code, message string, status QuotaStatus) {
+	apiErr := models.NewAPIError(http.StatusTooManyRequests, message)
+	apiErr.Code = code
+	apiErr.Details = map[string]interface{}{"limit": status.Limit, "used": status.Used}
+	apiErr.Retryable = false
+	writeAPIError(w, http.StatusTooManyRequests, apiErr)
+}
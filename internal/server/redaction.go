@@ -0,0 +1,78 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/models"
+	"github.com/oicur0t/logl/pkg/redact"
+)
+
+// Redactor masks sensitive data in entries before they are stored
+type Redactor struct {
+	defaults *redact.Redactor
+	services map[string]*redact.Redactor // lowercased service name -> rules
+}
+
+// NewRedactor compiles the default and per-service redaction rules.
+// It returns nil when no rules are configured.
+func NewRedactor(cfg config.ServerRedactionConfig) (*Redactor, error) {
+	defaults, err := cfg.NewRedactor()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Redactor{services: make(map[string]*redact.Redactor)}
+	if !defaults.Empty() {
+		r.defaults = defaults
+	}
+
+	for service, serviceCfg := range cfg.Services {
+		rules, err := serviceCfg.NewRedactor()
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %w", service, err)
+		}
+		if !rules.Empty() {
+			r.services[strings.ToLower(service)] = rules
+		}
+	}
+
+	if r.defaults == nil && len(r.services) == 0 {
+		return nil, nil
+	}
+	return r, nil
+}
+
+// RedactEntry masks the entry's line and every string in its parsed fields
+func (r *Redactor) RedactEntry(entry *models.LogEntry) {
+	for _, rules := range []*redact.Redactor{r.defaults, r.services[strings.ToLower(entry.ServiceName)]} {
+		if rules == nil {
+			continue
+		}
+		entry.Line = rules.Redact(entry.Line)
+		if entry.Parsed != nil {
+			entry.Parsed = redactValue(rules, entry.Parsed).(map[string]interface{})
+		}
+	}
+}
+
+// redactValue walks parsed JSON values, redacting strings in place
+func redactValue(rules *redact.Redactor, v interface{}) interface{} {
+	switch val := v.(type) {
+	case string:
+		return rules.Redact(val)
+	case map[string]interface{}:
+		for k, item := range val {
+			val[k] = redactValue(rules, item)
+		}
+		return val
+	case []interface{}:
+		for i, item := range val {
+			val[i] = redactValue(rules, item)
+		}
+		return val
+	default:
+		return v
+	}
+}
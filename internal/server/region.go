@@ -0,0 +1,77 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/models"
+)
+
+// regionLabel is the label holding the region an entry was produced in
+const regionLabel = "region"
+
+// RegionPolicy applies the server's region to ingested batches and to
+// queries
+type RegionPolicy struct {
+	name          string
+	rejectForeign bool
+	pinQueries    bool
+}
+
+// NewRegionPolicy creates a region policy, or returns nil when the server
+// has no region
+func NewRegionPolicy(cfg config.RegionConfig) *RegionPolicy {
+	if cfg.Name == "" {
+		return nil
+	}
+	return &RegionPolicy{
+		name:          cfg.Name,
+		rejectForeign: cfg.RejectForeign,
+		pinQueries:    cfg.PinQueries,
+	}
+}
+
+// Name returns the server's region
+func (p *RegionPolicy) Name() string {
+	return p.name
+}
+
+// Foreign returns another region a batch's entries are labelled with, when
+// batches from other regions are rejected
+func (p *RegionPolicy) Foreign(batch models.LogBatch) (string, bool) {
+	if !p.rejectForeign {
+		return "", false
+	}
+	for i := range batch.Entries {
+		if region, ok := batch.Entries[i].Labels[regionLabel]; ok && region != p.name {
+			return region, true
+		}
+	}
+	return "", false
+}
+
+// Label labels entries that carry no region with the server's region
+func (p *RegionPolicy) Label(batch *models.LogBatch) {
+	for i := range batch.Entries {
+		entry := &batch.Entries[i]
+		if _, ok := entry.Labels[regionLabel]; ok {
+			continue
+		}
+		if entry.Labels == nil {
+			entry.Labels = make(map[string]string)
+		}
+		entry.Labels[regionLabel] = p.name
+	}
+}
+
+// QueryRegion returns the region a query is restricted to. Servers pinning
+// queries restrict every query to their own region and refuse others.
+func (p *RegionPolicy) QueryRegion(requested string) (string, error) {
+	if !p.pinQueries {
+		return requested, nil
+	}
+	if requested != "" && requested != p.name {
+		return "", fmt.Errorf("queries on this server are pinned to region %s", p.name)
+	}
+	return p.name, nil
+}
@@ -0,0 +1,388 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// RelabelRequest describes changes to apply to a service's stored entries.
+// Entries matching Match (all of its labels) within [From, To) get SetLabels
+// added, RenameLabels renamed, and, with ServiceName set, are moved to that
+// service's collection.
+type RelabelRequest struct {
+	Service      string            `json:"service"`
+	From         time.Time         `json:"from"`
+	To           time.Time         `json:"to"`
+	Match        map[string]string `json:"match,omitempty"`
+	SetLabels    map[string]string `json:"set_labels,omitempty"`
+	RenameLabels map[string]string `json:"rename_labels,omitempty"` // old key -> new key
+	ServiceName  string            `json:"service_name,omitempty"`
+}
+
+// Validate checks that a request changes something and uses safe label keys
+func (r RelabelRequest) Validate() error {
+	if r.Service == "" {
+		return fmt.Errorf("service is required")
+	}
+	if len(r.SetLabels) == 0 && len(r.RenameLabels) == 0 && r.ServiceName == "" {
+		return fmt.Errorf("set_labels, rename_labels, or service_name is required")
+	}
+	for k := range r.Match {
+		if !validLabelKey(k) {
+			return fmt.Errorf("invalid label key %q", k)
+		}
+	}
+	for k := range r.SetLabels {
+		if !validLabelKey(k) {
+			return fmt.Errorf("invalid label key %q", k)
+		}
+	}
+	for from, to := range r.RenameLabels {
+		if !validLabelKey(from) || !validLabelKey(to) || from == to {
+			return fmt.Errorf("invalid label rename %q to %q", from, to)
+		}
+		// MongoDB rejects updates that touch the same field twice
+		_, setFrom := r.SetLabels[from]
+		_, setTo := r.SetLabels[to]
+		if setFrom || setTo {
+			return fmt.Errorf("label rename %q to %q conflicts with set_labels", from, to)
+		}
+	}
+	return nil
+}
+
+// RelabelJob tracks a background relabel of stored entries
+type RelabelJob struct {
+	ID         string         `json:"id"`
+	Request    RelabelRequest `json:"request"`
+	Collection string         `json:"collection"`
+	Target     string         `json:"target,omitempty"` // Destination service collection when moving entries
+	Status     string         `json:"status"`           // running, completed, cancelled, or failed
+	Total      int64          `json:"total"`            // Matching entries when the job started
+	Scanned    int64          `json:"scanned"`
+	Updated    int64          `json:"updated"`
+	Error      string         `json:"error,omitempty"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt time.Time      `json:"finished_at,omitempty"`
+}
+
+// Relabeler applies label and service name changes to historical entries,
+// rate limited so it doesn't compete with ingestion
+type Relabeler struct {
+	storage *Storage
+	cfg     config.RelabelConfig
+	logger  *zap.Logger
+
+	mu      sync.Mutex
+	jobs    map[string]*RelabelJob
+	cancels map[string]context.CancelFunc // running jobs
+}
+
+// NewRelabeler creates a new relabeler
+func NewRelabeler(storage *Storage, cfg config.RelabelConfig, logger *zap.Logger) *Relabeler {
+	return &Relabeler{
+		storage: storage,
+		cfg:     cfg,
+		logger:  logger,
+		jobs:    make(map[string]*RelabelJob),
+		cancels: make(map[string]context.CancelFunc),
+	}
+}
+
+// Start launches a background relabel job
+func (r *Relabeler) Start(req RelabelRequest) RelabelJob {
+	job := &RelabelJob{
+		ID:         primitive.NewObjectID().Hex(),
+		Request:    req,
+		Collection: r.storage.CollectionFor(req.Service),
+		Status:     "running",
+		StartedAt:  time.Now(),
+	}
+	if req.ServiceName != "" {
+		if target := r.storage.CollectionFor(req.ServiceName); target != job.Collection {
+			job.Target = target
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r.mu.Lock()
+	r.jobs[job.ID] = job
+	r.cancels[job.ID] = cancel
+	snapshot := *job
+	r.mu.Unlock()
+
+	go r.run(ctx, job)
+	return snapshot
+}
+
+// Get returns a snapshot of a job
+func (r *Relabeler) Get(id string) (RelabelJob, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, exists := r.jobs[id]
+	if !exists {
+		return RelabelJob{}, false
+	}
+	return *job, true
+}
+
+// Cancel stops a running job after its current batch
+func (r *Relabeler) Cancel(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cancel, running := r.cancels[id]
+	if running {
+		cancel()
+	}
+	return running
+}
+
+// run executes a job to completion
+func (r *Relabeler) run(ctx context.Context, job *RelabelJob) {
+	r.logger.Info("Relabel job started",
+		zap.String("job", job.ID),
+		zap.String("collection", job.Collection),
+		zap.String("target", job.Target))
+
+	err := r.relabel(ctx, job)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cancels[job.ID]()
+	delete(r.cancels, job.ID)
+	job.FinishedAt = time.Now()
+
+	switch {
+	case err != nil && ctx.Err() != nil:
+		job.Status = "cancelled"
+		r.logger.Info("Relabel job cancelled", zap.String("job", job.ID), zap.Int64("updated", job.Updated))
+	case err != nil:
+		job.Status = "failed"
+		job.Error = err.Error()
+		r.logger.Error("Relabel job failed", zap.String("job", job.ID), zap.Error(err))
+	default:
+		job.Status = "completed"
+		r.logger.Info("Relabel job completed",
+			zap.String("job", job.ID),
+			zap.Int64("scanned", job.Scanned),
+			zap.Int64("updated", job.Updated))
+	}
+}
+
+// relabel applies the changes to each collection holding matching entries
+func (r *Relabeler) relabel(ctx context.Context, job *RelabelJob) error {
+	req := job.Request
+	filter := BuildQueryFilter(models.LogQuery{From: req.From, To: req.To, Labels: req.Match})
+
+	// Partitioned services are relabeled one partition at a time
+	collections, err := r.storage.CollectionsFor(ctx, req.Service, req.From, req.To)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, collName := range collections {
+		n, err := r.storage.database.Collection(collName).CountDocuments(ctx, filter)
+		if err != nil {
+			return fmt.Errorf("failed to count %s: %w", collName, err)
+		}
+		total += n
+	}
+	r.mu.Lock()
+	job.Total = total
+	r.mu.Unlock()
+
+	for _, collName := range collections {
+		if err := r.relabelCollection(ctx, job, collName, filter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// relabelCollection streams a collection's matching entries and applies the
+// changes in batches, pausing between batches to stay under the configured rate
+func (r *Relabeler) relabelCollection(ctx context.Context, job *RelabelJob, collName string, filter bson.M) error {
+	req := job.Request
+	collection := r.storage.database.Collection(collName)
+
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to scan %s: %w", collName, err)
+	}
+	defer cursor.Close(ctx)
+
+	batchInterval := time.Duration(float64(time.Second) * float64(r.cfg.BatchSize) / float64(r.cfg.MaxDocsPerSecond))
+	batch := make([]bson.M, 0, r.cfg.BatchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		started := time.Now()
+
+		var n int64
+		var err error
+		if job.Target != "" {
+			n, err = r.move(ctx, collection, job.Target, batch, req)
+		} else {
+			n, err = r.update(ctx, collection, batch, req)
+		}
+		if err != nil {
+			return err
+		}
+
+		r.mu.Lock()
+		job.Scanned += int64(len(batch))
+		job.Updated += n
+		r.mu.Unlock()
+		batch = batch[:0]
+
+		// Pace batches to max_docs_per_second
+		if wait := batchInterval - time.Since(started); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	}
+
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return fmt.Errorf("failed to decode entry: %w", err)
+		}
+		batch = append(batch, doc)
+
+		if len(batch) >= r.cfg.BatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to scan %s: %w", collName, err)
+	}
+	return flush()
+}
+
+// update applies the changes in place with one update over the batch's IDs
+func (r *Relabeler) update(ctx context.Context, collection *mongo.Collection, batch []bson.M, req RelabelRequest) (int64, error) {
+	ids := make([]interface{}, len(batch))
+	for i, doc := range batch {
+		ids[i] = doc["_id"]
+	}
+
+	update := bson.M{}
+	set := bson.M{}
+	for k, v := range req.SetLabels {
+		set["labels."+k] = v
+	}
+	if req.ServiceName != "" {
+		set["service_name"] = req.ServiceName
+	}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(req.RenameLabels) > 0 {
+		rename := bson.M{}
+		for from, to := range req.RenameLabels {
+			rename["labels."+from] = "labels." + to
+		}
+		update["$rename"] = rename
+	}
+
+	result, err := collection.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": ids}}, update)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update %s: %w", collection.Name(), err)
+	}
+	return result.ModifiedCount, nil
+}
+
+// move copies the batch, relabeled, into the target service's collection
+// (or its partitions) and then deletes it from the source. IDs are kept, so
+// a batch interrupted between the two steps is skipped as duplicates when
+// the job is run again.
+func (r *Relabeler) move(ctx context.Context, source *mongo.Collection, target string, batch []bson.M, req RelabelRequest) (int64, error) {
+	parts := make(map[string][]interface{})
+	ids := make([]interface{}, len(batch))
+	for i, doc := range batch {
+		relabelDocument(doc, req)
+		ids[i] = doc["_id"]
+
+		var timestamp time.Time
+		if ts, ok := doc["timestamp"].(primitive.DateTime); ok {
+			timestamp = ts.Time()
+		}
+		name := r.storage.partitionName(target, timestamp)
+		parts[name] = append(parts[name], doc)
+	}
+
+	for name, docs := range parts {
+		r.storage.ensurePrepared(ctx, name, req.ServiceName)
+		_, err := r.storage.database.Collection(name).InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+		if err != nil && !onlyDuplicateKeyErrors(err) {
+			return 0, fmt.Errorf("failed to copy entries to %s: %w", name, err)
+		}
+	}
+
+	result, err := source.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove moved entries from %s: %w", source.Name(), err)
+	}
+	return result.DeletedCount, nil
+}
+
+// relabelDocument applies a request's changes to a raw stored entry
+func relabelDocument(doc bson.M, req RelabelRequest) {
+	labels, _ := doc["labels"].(bson.M)
+	if labels == nil {
+		labels = bson.M{}
+	}
+	for from, to := range req.RenameLabels {
+		if v, exists := labels[from]; exists {
+			labels[to] = v
+			delete(labels, from)
+		}
+	}
+	for k, v := range req.SetLabels {
+		labels[k] = v
+	}
+	if len(labels) > 0 {
+		doc["labels"] = labels
+	}
+	if req.ServiceName != "" {
+		doc["service_name"] = req.ServiceName
+	}
+}
+
+// onlyDuplicateKeyErrors reports whether an insert failed only on
+// documents that already exist
+func onlyDuplicateKeyErrors(err error) bool {
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil || len(bulkErr.WriteErrors) == 0 {
+		return false
+	}
+	for _, we := range bulkErr.WriteErrors {
+		if we.Code != codeDuplicateKey {
+			return false
+		}
+	}
+	return true
+}
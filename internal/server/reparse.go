@@ -0,0 +1,215 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/oicur0t/logl/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// reparseBatchSize is the number of updates sent per bulk write
+const reparseBatchSize = 500
+
+// ReparseJob tracks a background re-parse of stored entries
+type ReparseJob struct {
+	ID         string    `json:"id"`
+	Service    string    `json:"service"`
+	Collection string    `json:"collection"`
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+	Status     string    `json:"status"` // running, completed, or failed
+	Scanned    int64     `json:"scanned"`
+	Updated    int64     `json:"updated"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+}
+
+// Reparser re-runs the parsing pipeline over already-stored entries
+type Reparser struct {
+	storage *Storage
+	parser  *LogParser
+	logger  *zap.Logger
+
+	mu   sync.Mutex
+	jobs map[string]*ReparseJob
+}
+
+// NewReparser creates a new reparser
+func NewReparser(storage *Storage, parser *LogParser, logger *zap.Logger) *Reparser {
+	return &Reparser{
+		storage: storage,
+		parser:  parser,
+		logger:  logger,
+		jobs:    make(map[string]*ReparseJob),
+	}
+}
+
+// Start launches a background job re-parsing a service's entries in [from, to)
+func (r *Reparser) Start(service string, from, to time.Time) ReparseJob {
+	job := &ReparseJob{
+		ID:         primitive.NewObjectID().Hex(),
+		Service:    service,
+		Collection: r.storage.CollectionFor(service),
+		From:       from,
+		To:         to,
+		Status:     "running",
+		StartedAt:  time.Now(),
+	}
+
+	r.mu.Lock()
+	r.jobs[job.ID] = job
+	snapshot := *job
+	r.mu.Unlock()
+
+	go r.run(job)
+	return snapshot
+}
+
+// Get returns a snapshot of a job
+func (r *Reparser) Get(id string) (ReparseJob, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, exists := r.jobs[id]
+	if !exists {
+		return ReparseJob{}, false
+	}
+	return *job, true
+}
+
+// run executes a job to completion
+func (r *Reparser) run(job *ReparseJob) {
+	r.logger.Info("Reparse job started",
+		zap.String("job", job.ID),
+		zap.String("collection", job.Collection))
+
+	ctx := context.Background()
+	filter := BuildQueryFilter(models.LogQuery{From: job.From, To: job.To})
+
+	// Partitioned services are rewritten one partition at a time
+	collections, err := r.storage.CollectionsFor(ctx, job.Service, job.From, job.To)
+	var doneScanned, doneUpdated int64
+	for _, collName := range collections {
+		err = r.storage.RewriteEntries(ctx, collName, filter, r.reparse, func(scanned, updated int64) {
+			r.mu.Lock()
+			job.Scanned = doneScanned + scanned
+			job.Updated = doneUpdated + updated
+			r.mu.Unlock()
+		})
+		if err != nil {
+			break
+		}
+		r.mu.Lock()
+		doneScanned, doneUpdated = job.Scanned, job.Updated
+		r.mu.Unlock()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job.FinishedAt = time.Now()
+	if err != nil {
+		job.Status = "failed"
+		job.Error = err.Error()
+		r.logger.Error("Reparse job failed", zap.String("job", job.ID), zap.Error(err))
+		return
+	}
+	job.Status = "completed"
+	r.logger.Info("Reparse job completed",
+		zap.String("job", job.ID),
+		zap.Int64("scanned", job.Scanned),
+		zap.Int64("updated", job.Updated))
+}
+
+// reparse runs the parser over a stored entry and returns the fields to update
+func (r *Reparser) reparse(entry *models.LogEntry) bson.M {
+	timestamp := entry.Timestamp
+	entry.Parsed = nil
+	r.parser.ParseLogEntry(entry)
+
+	set := bson.M{}
+	if !entry.Timestamp.Equal(timestamp) {
+		set["timestamp"] = entry.Timestamp
+	}
+	if entry.Parsed != nil {
+		set["parsed"] = entry.Parsed
+	}
+	if entry.Level != "" {
+		set["level"] = entry.Level
+	}
+	if entry.TraceID != "" {
+		set["trace_id"] = entry.TraceID
+		if entry.SpanID != "" {
+			set["span_id"] = entry.SpanID
+		}
+	}
+	if len(set) == 0 {
+		return nil
+	}
+	return set
+}
+
+// RewriteEntries streams entries matching filter through transform and writes
+// back the fields it returns. A nil result leaves the entry unchanged.
+func (s *Storage) RewriteEntries(ctx context.Context, collName string, filter bson.M, transform func(*models.LogEntry) bson.M, progress func(scanned, updated int64)) error {
+	collection := s.database.Collection(collName)
+
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to scan %s: %w", collName, err)
+	}
+	defer cursor.Close(ctx)
+
+	var scanned, updated int64
+	writes := make([]mongo.WriteModel, 0, reparseBatchSize)
+
+	flush := func() error {
+		if len(writes) == 0 {
+			return nil
+		}
+		result, err := collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+		if err != nil {
+			return fmt.Errorf("failed to update %s: %w", collName, err)
+		}
+		updated += result.ModifiedCount
+		writes = writes[:0]
+		progress(scanned, updated)
+		return nil
+	}
+
+	for cursor.Next(ctx) {
+		var entry models.LogEntry
+		if err := cursor.Decode(&entry); err != nil {
+			return fmt.Errorf("failed to decode entry: %w", err)
+		}
+		scanned++
+
+		if set := transform(&entry); set != nil {
+			writes = append(writes, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": entry.ID}).
+				SetUpdate(bson.M{"$set": set}))
+		}
+
+		if len(writes) >= reparseBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to scan %s: %w", collName, err)
+	}
+
+	if err := flush(); err != nil {
+		return err
+	}
+	progress(scanned, updated)
+	return nil
+}
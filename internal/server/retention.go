@@ -0,0 +1,353 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ListLogCollections returns the names of all log collections
+func (s *Storage) ListLogCollections(ctx context.Context) ([]string, error) {
+	filter := bson.M{"name": bson.M{"$regex": "^" + regexp.QuoteMeta(s.collectionPrefix)}}
+	names, err := s.database.ListCollectionNames(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+	return names, nil
+}
+
+// PreviewRetention reports how many documents and bytes in a collection are
+// older than ttlDays and would be removed by a TTL of that length
+func (s *Storage) PreviewRetention(ctx context.Context, collName string, ttlDays int) (models.RetentionPreview, error) {
+	cutoff := time.Now().Add(-time.Duration(ttlDays) * 24 * time.Hour)
+	preview := models.RetentionPreview{
+		Collection: collName,
+		Cutoff:     cutoff,
+	}
+
+	pipeline := bson.A{
+		bson.M{"$match": bson.M{"timestamp": bson.M{"$lt": cutoff}}},
+		bson.M{"$group": bson.M{
+			"_id":       nil,
+			"documents": bson.M{"$sum": 1},
+			"bytes":     bson.M{"$sum": bson.M{"$bsonSize": "$$ROOT"}},
+		}},
+	}
+
+	cursor, err := s.database.Collection(collName).Aggregate(ctx, pipeline)
+	if err != nil {
+		return preview, fmt.Errorf("failed to preview retention for %s: %w", collName, err)
+	}
+	defer cursor.Close(ctx)
+
+	var result struct {
+		Documents int64 `bson:"documents"`
+		Bytes     int64 `bson:"bytes"`
+	}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&result); err != nil {
+			return preview, fmt.Errorf("failed to decode retention preview: %w", err)
+		}
+	}
+
+	preview.Documents = result.Documents
+	preview.Bytes = result.Bytes
+	return preview, cursor.Err()
+}
+
+// TTLDays returns the currently configured retention in days
+func (s *Storage) TTLDays() int {
+	return s.ttlDays
+}
+
+// Retention sources, in order of precedence
+const (
+	retentionOverride = "override"
+	retentionConfig   = "config"
+	retentionTemplate = "template"
+	retentionTenant   = "tenant"
+	retentionDefault  = "default"
+)
+
+// codeIndexNotFound is returned when modifying or dropping a missing index
+const codeIndexNotFound = 27
+
+// SetRetention applies per-service retention from configuration. Exact
+// service names take precedence over globs, and longer globs over shorter.
+func (s *Storage) SetRetention(cfg config.RetentionConfig) {
+	s.retention = cfg
+	s.retentionPatterns = make([]string, 0, len(cfg.Services))
+	for pattern := range cfg.Services {
+		s.retentionPatterns = append(s.retentionPatterns, pattern)
+	}
+	sort.Slice(s.retentionPatterns, func(i, j int) bool {
+		a, b := s.retentionPatterns[i], s.retentionPatterns[j]
+		if isGlob(a) != isGlob(b) {
+			return !isGlob(a)
+		}
+		if len(a) != len(b) {
+			return len(a) > len(b)
+		}
+		return a < b
+	})
+}
+
+// isGlob reports whether a service pattern contains glob metacharacters
+func isGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[\`)
+}
+
+// LoadRetentionOverrides reads the retention overrides set through the API,
+// including those set on other instances
+func (s *Storage) LoadRetentionOverrides(ctx context.Context) error {
+	cursor, err := s.database.Collection(s.retention.Collection).Find(ctx, bson.M{})
+	if err != nil {
+		return fmt.Errorf("failed to load retention overrides: %w", err)
+	}
+	var stored []models.RetentionOverride
+	if err := cursor.All(ctx, &stored); err != nil {
+		return fmt.Errorf("failed to decode retention overrides: %w", err)
+	}
+
+	overrides := make(map[string]models.RetentionOverride, len(stored))
+	for _, o := range stored {
+		overrides[o.Collection] = o
+	}
+
+	s.retentionMu.Lock()
+	s.retentionOverrides = overrides
+	s.retentionMu.Unlock()
+	return nil
+}
+
+// RetentionFor returns the retention in effect for a service (or the
+// unprefixed collection name, for collections discovered at startup): an
+// API override, then retention.services, then its collection template,
+// then its owning tenant's ttl_days, then mongodb.ttl_days
+func (s *Storage) RetentionFor(name string) models.ServiceRetention {
+	collName := s.CollectionFor(name)
+	retention := models.ServiceRetention{Collection: collName}
+
+	s.retentionMu.RLock()
+	override, overridden := s.retentionOverrides[collName]
+	s.retentionMu.RUnlock()
+	if overridden {
+		retention.Service = override.Service
+		retention.TTLDays = override.TTLDays
+		retention.Source = retentionOverride
+		retention.UpdatedBy = override.UpdatedBy
+		retention.UpdatedAt = override.UpdatedAt
+		return retention
+	}
+
+	for _, pattern := range s.retentionPatterns {
+		matched := s.CollectionFor(pattern) == collName
+		if isGlob(pattern) {
+			matched, _ = path.Match(pattern, strings.ToLower(name))
+		}
+		if matched {
+			retention.TTLDays = s.retention.Services[pattern]
+			retention.Source = retentionConfig
+			return retention
+		}
+	}
+
+	if tmpl := s.templateFor(name); tmpl != nil && tmpl.TTLDays != nil {
+		retention.TTLDays = *tmpl.TTLDays
+		retention.Source = retentionTemplate
+		return retention
+	}
+
+	if s.tenancy != nil {
+		if ttlDays, ok := s.tenancy.RetentionFor(collName); ok {
+			retention.TTLDays = ttlDays
+			retention.Source = retentionTenant
+			return retention
+		}
+	}
+
+	retention.TTLDays = s.ttlDays
+	retention.Source = retentionDefault
+	return retention
+}
+
+// ListRetention returns the retention in effect for every service
+// collection, and for overridden services without one yet
+func (s *Storage) ListRetention(ctx context.Context) ([]models.ServiceRetention, error) {
+	names, err := s.ListLogCollections(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var services []string
+	for _, name := range names {
+		// Partitions share their service collection's retention
+		if base, _, _, ok := parsePartition(name); ok && s.partitioning.Interval != "" {
+			name = base
+		}
+		if !seen[name] {
+			seen[name] = true
+			services = append(services, strings.TrimPrefix(name, s.collectionPrefix))
+		}
+	}
+
+	s.retentionMu.RLock()
+	for collName, o := range s.retentionOverrides {
+		if !seen[collName] {
+			seen[collName] = true
+			services = append(services, o.Service)
+		}
+	}
+	s.retentionMu.RUnlock()
+
+	retention := make([]models.ServiceRetention, 0, len(services))
+	for _, service := range services {
+		retention = append(retention, s.RetentionFor(service))
+	}
+	sort.Slice(retention, func(i, j int) bool {
+		return retention[i].Collection < retention[j].Collection
+	})
+	return retention, nil
+}
+
+// SetServiceRetention overrides a service's retention and applies it to its
+// existing collection
+func (s *Storage) SetServiceRetention(ctx context.Context, service string, ttlDays int, updatedBy string) (models.ServiceRetention, error) {
+	override := models.RetentionOverride{
+		Collection: s.CollectionFor(service),
+		Service:    service,
+		TTLDays:    ttlDays,
+		UpdatedBy:  updatedBy,
+		UpdatedAt:  time.Now(),
+	}
+
+	_, err := s.database.Collection(s.retention.Collection).ReplaceOne(ctx,
+		bson.M{"_id": override.Collection}, override, options.Replace().SetUpsert(true))
+	if err != nil {
+		return models.ServiceRetention{}, fmt.Errorf("failed to store retention override: %w", err)
+	}
+
+	s.retentionMu.Lock()
+	s.retentionOverrides[override.Collection] = override
+	s.retentionMu.Unlock()
+
+	if err := s.applyRetention(ctx, override.Collection, ttlDays); err != nil {
+		return models.ServiceRetention{}, err
+	}
+	return s.RetentionFor(service), nil
+}
+
+// ClearServiceRetention removes a service's override, returning it to its
+// configured retention
+func (s *Storage) ClearServiceRetention(ctx context.Context, service string) (models.ServiceRetention, error) {
+	collName := s.CollectionFor(service)
+	result, err := s.database.Collection(s.retention.Collection).DeleteOne(ctx, bson.M{"_id": collName})
+	if err != nil {
+		return models.ServiceRetention{}, fmt.Errorf("failed to delete retention override: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return models.ServiceRetention{}, errNoRetentionOverride
+	}
+
+	s.retentionMu.Lock()
+	delete(s.retentionOverrides, collName)
+	s.retentionMu.Unlock()
+
+	retention := s.RetentionFor(service)
+	if err := s.applyRetention(ctx, collName, retention.TTLDays); err != nil {
+		return models.ServiceRetention{}, err
+	}
+	return retention, nil
+}
+
+// errNoRetentionOverride is returned when clearing a service without an override
+var errNoRetentionOverride = errors.New("service has no retention override")
+
+// applyRetention updates an existing collection's expiry to ttlDays:
+// expireAfterSeconds for time-series collections, the TTL index otherwise.
+// Partitioned services need nothing here, since partitions are dropped by
+// the retention job.
+func (s *Storage) applyRetention(ctx context.Context, collName string, ttlDays int) error {
+	if s.partitioning.Interval != "" {
+		return nil
+	}
+
+	existing, err := s.database.ListCollectionSpecifications(ctx, bson.M{"name": collName})
+	if err != nil {
+		return fmt.Errorf("failed to check collection %s: %w", collName, err)
+	}
+	if len(existing) == 0 {
+		return nil // Created with this retention on first write
+	}
+
+	if existing[0].Type == "timeseries" {
+		return s.syncTimeSeriesExpiry(ctx, collName, ttlDays)
+	}
+	return s.syncTTLIndex(ctx, s.database.Collection(collName), ttlDays)
+}
+
+// syncTimeSeriesExpiry sets a time-series collection's expireAfterSeconds
+// to ttlDays, 0 keeping entries forever
+func (s *Storage) syncTimeSeriesExpiry(ctx context.Context, collName string, ttlDays int) error {
+	var expireAfter interface{} = "off"
+	if ttlDays > 0 {
+		expireAfter = int64(ttlDays) * 24 * 60 * 60
+	}
+	cmd := bson.D{{Key: "collMod", Value: collName}, {Key: "expireAfterSeconds", Value: expireAfter}}
+	if err := s.database.RunCommand(ctx, cmd).Err(); err != nil {
+		return fmt.Errorf("failed to update expiry on %s: %w", collName, err)
+	}
+	return nil
+}
+
+// syncTTLIndex creates, updates, or drops a collection's TTL index so it
+// expires entries after ttlDays, 0 keeping them forever
+func (s *Storage) syncTTLIndex(ctx context.Context, collection *mongo.Collection, ttlDays int) error {
+	if ttlDays <= 0 {
+		_, err := collection.Indexes().DropOne(ctx, "ttl_index")
+		if err != nil && !hasErrorCode(err, codeIndexNotFound) {
+			return fmt.Errorf("failed to drop TTL index on %s: %w", collection.Name(), err)
+		}
+		return nil
+	}
+
+	ttlSeconds := int32(ttlDays * 24 * 60 * 60)
+	cmd := bson.D{
+		{Key: "collMod", Value: collection.Name()},
+		{Key: "index", Value: bson.D{
+			{Key: "name", Value: "ttl_index"},
+			{Key: "expireAfterSeconds", Value: ttlSeconds},
+		}},
+	}
+	err := s.database.RunCommand(ctx, cmd).Err()
+	if hasErrorCode(err, codeIndexNotFound) {
+		_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{{Key: "timestamp", Value: 1}},
+			Options: options.Index().
+				SetName("ttl_index").
+				SetExpireAfterSeconds(ttlSeconds),
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update TTL index on %s: %w", collection.Name(), err)
+	}
+	return nil
+}
+
+// hasErrorCode reports whether err is a server error with the given code
+func hasErrorCode(err error, code int) bool {
+	var serverErr mongo.ServerError
+	return errors.As(err, &serverErr) && serverErr.HasErrorCode(code)
+}
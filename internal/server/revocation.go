@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/models"
+	"github.com/oicur0t/logl/pkg/mtls"
+	"go.uber.org/zap"
+)
+
+// revocationWarnEvery limits warnings about undetermined revocation status
+// under fail_mode open, which would otherwise be logged on every request
+const revocationWarnEvery = time.Minute
+
+// Revocation rejects requests presenting a client certificate revoked in
+// the configured CRL or by its OCSP responder. When status can't be
+// determined, fail_mode open lets the request through and closed rejects
+// it.
+type Revocation struct {
+	checker         *mtls.RevocationChecker
+	failClosed      bool
+	refreshInterval time.Duration
+	logger          *zap.Logger
+
+	lastWarned atomic.Int64 // Unix nanoseconds
+}
+
+// NewRevocation creates a new revocation checker
+func NewRevocation(cfg config.RevocationConfig, logger *zap.Logger) *Revocation {
+	return &Revocation{
+		checker: mtls.NewRevocationChecker(mtls.RevocationOptions{
+			CRLFile:  cfg.CRLFile,
+			CRLURL:   cfg.CRLURL,
+			OCSP:     cfg.OCSP,
+			OCSPURL:  cfg.OCSPURL,
+			CacheTTL: cfg.CacheTTL,
+			Timeout:  cfg.Timeout,
+		}),
+		failClosed:      cfg.FailMode == "closed",
+		refreshInterval: cfg.RefreshInterval,
+		logger:          logger,
+	}
+}
+
+// LoadCRL loads the configured CRL, if any
+func (v *Revocation) LoadCRL(ctx context.Context) error {
+	crl, err := v.checker.RefreshCRL(ctx)
+	if err != nil {
+		return err
+	}
+	if crl != nil {
+		v.logger.Info("Loaded CRL",
+			zap.String("issuer", crl.Issuer.String()),
+			zap.Int("revoked", len(crl.RevokedCertificateEntries)),
+			zap.Time("next_update", crl.NextUpdate))
+	}
+	return nil
+}
+
+// Start reloads the CRL every refresh interval until the context is
+// cancelled
+func (v *Revocation) Start(ctx context.Context) {
+	if !v.checker.HasCRL() {
+		return
+	}
+
+	ticker := time.NewTicker(v.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := v.LoadCRL(ctx); err != nil {
+				v.logger.Error("Failed to reload CRL, keeping the current one", zap.Error(err))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// allow reports whether a request's verified client certificate may be
+// used, writing the rejection when it may not. v may be nil when
+// revocation checking is disabled.
+func (v *Revocation) allow(w http.ResponseWriter, r *http.Request) bool {
+	if v == nil || r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return true
+	}
+	chain := r.TLS.VerifiedChains[0]
+	if len(chain) < 2 {
+		return true // The CA itself, which has no issuer to revoke it
+	}
+	cert := chain[0]
+
+	err := v.checker.Check(r.Context(), cert, chain[1])
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, mtls.ErrRevoked):
+		v.logger.Warn("Rejected revoked client certificate",
+			zap.String("subject", cert.Subject.String()),
+			zap.String("serial", cert.SerialNumber.String()),
+			zap.String("remote_addr", r.RemoteAddr),
+			zap.Error(err))
+		writeErrorCode(w, http.StatusForbidden, models.ErrCodeCertificateRevoked, "Client certificate revoked")
+		return false
+	case v.failClosed:
+		v.logger.Warn("Rejected client certificate with unknown revocation status",
+			zap.String("subject", cert.Subject.String()),
+			zap.String("serial", cert.SerialNumber.String()),
+			zap.Error(err))
+		writeError(w, http.StatusServiceUnavailable, "Client certificate revocation status unavailable")
+		return false
+	}
+
+	now := time.Now().UnixNano()
+	if last := v.lastWarned.Load(); now-last >= int64(revocationWarnEvery) && v.lastWarned.CompareAndSwap(last, now) {
+		v.logger.Warn("Revocation status unknown, allowing client certificate (fail_mode open)",
+			zap.String("subject", cert.Subject.String()),
+			zap.Error(err))
+	}
+	return true
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// rollupKey identifies one per-minute counter
+type rollupKey struct {
+	service  string
+	hostname string
+	level    string
+	minute   time.Time
+}
+
+// Rollups maintains per-minute entry counts by service, host, and level.
+// Counts accumulate in memory at ingest time and are checkpointed to the
+// summary collection with $inc upserts every flush interval.
+type Rollups struct {
+	collection    *mongo.Collection
+	flushInterval time.Duration
+	retention     time.Duration
+	logger        *zap.Logger
+
+	mu      sync.Mutex
+	pending map[rollupKey]int64
+}
+
+// NewRollups creates a new rollup maintainer
+func NewRollups(storage *Storage, cfg config.RollupsConfig, logger *zap.Logger) *Rollups {
+	return &Rollups{
+		collection:    storage.database.Collection(cfg.Collection),
+		flushInterval: cfg.FlushInterval,
+		retention:     time.Duration(cfg.RetentionDays) * 24 * time.Hour,
+		logger:        logger,
+		pending:       make(map[rollupKey]int64),
+	}
+}
+
+// EnsureIndexes creates the lookup index and, with a retention, a TTL on minute
+func (r *Rollups) EnsureIndexes(ctx context.Context) error {
+	indexModels := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "service", Value: 1},
+				{Key: "minute", Value: 1},
+				{Key: "hostname", Value: 1},
+				{Key: "level", Value: 1},
+			},
+			Options: options.Index().SetName("service_minute").SetUnique(true),
+		},
+	}
+	if r.retention > 0 {
+		indexModels = append(indexModels, mongo.IndexModel{
+			Keys:    bson.D{{Key: "minute", Value: 1}},
+			Options: options.Index().SetName("ttl_index").SetExpireAfterSeconds(int32(r.retention.Seconds())),
+		})
+	}
+
+	if _, err := r.collection.Indexes().CreateMany(ctx, indexModels); err != nil {
+		return fmt.Errorf("failed to create rollup indexes: %w", err)
+	}
+	return nil
+}
+
+// Record counts a stored batch
+func (r *Rollups) Record(batch models.LogBatch) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, entry := range batch.Entries {
+		key := rollupKey{
+			service:  strings.ToLower(batch.ServiceName),
+			hostname: entry.Hostname,
+			level:    entry.Level,
+			minute:   entry.Timestamp.UTC().Truncate(time.Minute),
+		}
+		r.pending[key]++
+	}
+}
+
+// Start checkpoints counts every flush interval until the context is
+// cancelled, then flushes once more
+func (r *Rollups) Start(ctx context.Context) {
+	ticker := time.NewTicker(r.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.Flush(ctx); err != nil {
+				r.logger.Error("Failed to flush rollups", zap.Error(err))
+			}
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if err := r.Flush(flushCtx); err != nil {
+				r.logger.Error("Failed to flush rollups on shutdown", zap.Error(err))
+			}
+			cancel()
+			return
+		}
+	}
+}
+
+// Flush writes accumulated counts. Counts that fail to write are kept
+// for the next checkpoint.
+func (r *Rollups) Flush(ctx context.Context) error {
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = make(map[rollupKey]int64)
+	r.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	writes := make([]mongo.WriteModel, 0, len(pending))
+	for key, count := range pending {
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{
+				"service":  key.service,
+				"minute":   key.minute,
+				"hostname": key.hostname,
+				"level":    key.level,
+			}).
+			SetUpdate(bson.M{"$inc": bson.M{"count": count}}).
+			SetUpsert(true))
+	}
+
+	if _, err := r.collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+		// Requeue so counts aren't lost; a partially applied write may double count
+		r.mu.Lock()
+		for key, count := range pending {
+			r.pending[key] += count
+		}
+		r.mu.Unlock()
+		return fmt.Errorf("failed to write rollups: %w", err)
+	}
+	return nil
+}
+
+// Counts returns a service's per-minute counts in [from, to), optionally
+// restricted to one host or level
+func (r *Rollups) Counts(ctx context.Context, service, hostname, level string, from, to time.Time) ([]models.MinuteCount, error) {
+	filter := bson.M{
+		"service": strings.ToLower(service),
+		"minute":  bson.M{"$gte": from, "$lt": to},
+	}
+	if hostname != "" {
+		filter["hostname"] = hostname
+	}
+	if level != "" {
+		filter["level"] = level
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "minute", Value: 1}})
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rollups: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	counts := make([]models.MinuteCount, 0)
+	if err := cursor.All(ctx, &counts); err != nil {
+		return nil, fmt.Errorf("failed to decode rollups: %w", err)
+	}
+	return counts, nil
+}
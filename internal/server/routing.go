@@ -0,0 +1,321 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/models"
+	"github.com/oicur0t/logl/pkg/retry"
+	"go.uber.org/zap"
+)
+
+// Built-in routing sinks
+const (
+	sinkMongo = "mongo"
+	sinkKafka = "kafka"
+	sinkNATS  = "nats"
+	sinkDrop  = "drop"
+)
+
+// routeRule is a routing rule with its filter compiled
+type routeRule struct {
+	name    string
+	matcher *entryMatcher
+	sinks   []string
+	cont    bool // Later rules are still evaluated after a match
+	matched atomic.Int64
+}
+
+// sinkWriter writes routed entries to a sink, returning those it could
+// not write so only they are retried
+type sinkWriter interface {
+	write(ctx context.Context, entries []models.LogEntry) ([]models.LogEntry, error)
+}
+
+// routeSink is a file or S3 sink with its queue of entries waiting to be
+// written
+type routeSink struct {
+	config.RoutingSinkConfig
+	writer sinkWriter
+	queue  chan models.LogEntry
+
+	sent    atomic.Int64
+	dropped atomic.Int64
+	failed  atomic.Int64
+
+	mu          sync.Mutex
+	lastError   string
+	lastErrorAt time.Time
+}
+
+// Router sends each accepted entry to the sinks of the rules it matches:
+// MongoDB, the Kafka and NATS outputs, file and S3 sinks, or nowhere.
+// Entries no rule matches go to the default sinks. File and S3 sinks queue
+// entries and drop them once the queue is full rather than slowing
+// ingestion.
+type Router struct {
+	rules       []*routeRule
+	fallback    []string
+	unmatched   atomic.Int64
+	sinks       []*routeSink
+	sinksByName map[string]*routeSink
+	logger      *zap.Logger
+}
+
+// NewRouter creates a new router, compiling the rules' filters and
+// creating the file and S3 sinks
+func NewRouter(cfg config.RoutingConfig, logger *zap.Logger) (*Router, error) {
+	r := &Router{
+		fallback:    cfg.Default,
+		sinksByName: make(map[string]*routeSink),
+		logger:      logger,
+	}
+	for _, rc := range cfg.Rules {
+		matcher, err := newEntryMatcher(rc.EntryFilterConfig)
+		if err != nil {
+			return nil, fmt.Errorf("routing rule %s: %w", rc.Name, err)
+		}
+		r.rules = append(r.rules, &routeRule{name: rc.Name, matcher: matcher, sinks: rc.Sinks, cont: rc.Continue})
+	}
+	for _, sc := range cfg.Sinks {
+		var writer sinkWriter
+		switch sc.Type {
+		case "file":
+			writer = newFileSinkWriter(sc.Path)
+		case "s3":
+			writer = newS3SinkWriter(sc)
+		}
+		sink := &routeSink{
+			RoutingSinkConfig: sc,
+			writer:            writer,
+			queue:             make(chan models.LogEntry, sc.QueueSize),
+		}
+		r.sinks = append(r.sinks, sink)
+		r.sinksByName[sc.Name] = sink
+	}
+	return r, nil
+}
+
+// Route splits a batch's entries by the sinks they are routed to. The
+// built-in mongo, kafka, and nats sinks are always present, possibly with
+// no entries.
+func (r *Router) Route(batch models.LogBatch) map[string]models.LogBatch {
+	routed := make(map[string]models.LogBatch)
+	header := batch
+	header.Entries = nil
+	for _, sink := range []string{sinkMongo, sinkKafka, sinkNATS} {
+		routed[sink] = header
+	}
+
+	// Rules for other services never match this batch
+	var rules []*routeRule
+	for _, rule := range r.rules {
+		if rule.matcher.matchesService(batch.ServiceName) {
+			rules = append(rules, rule)
+		}
+	}
+
+	var targets []string
+	for i := range batch.Entries {
+		entry := &batch.Entries[i]
+		targets = targets[:0]
+		matched := false
+		for _, rule := range rules {
+			if !rule.matcher.matches(entry) {
+				continue
+			}
+			rule.matched.Add(1)
+			matched = true
+			targets = append(targets, rule.sinks...)
+			if !rule.cont {
+				break
+			}
+		}
+		if !matched {
+			r.unmatched.Add(1)
+			targets = append(targets, r.fallback...)
+		}
+
+		for j, sink := range targets {
+			if sink == sinkDrop || containsString(targets[:j], sink) {
+				continue
+			}
+			b, ok := routed[sink]
+			if !ok {
+				b = header
+			}
+			b.Entries = append(b.Entries, *entry)
+			routed[sink] = b
+		}
+	}
+	return routed
+}
+
+// containsString reports whether a slice holds a string
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Deliver queues routed entries for the file and S3 sinks, dropping them
+// when a sink's queue is full
+func (r *Router) Deliver(routed map[string]models.LogBatch) {
+	for name, batch := range routed {
+		sink, ok := r.sinksByName[name]
+		if !ok {
+			continue
+		}
+		for _, entry := range batch.Entries {
+			if entry.ServiceName == "" {
+				entry.ServiceName = batch.ServiceName
+			}
+			select {
+			case sink.queue <- entry:
+			default:
+				sink.dropped.Add(1)
+			}
+		}
+	}
+}
+
+// Start writes each sink's batches until the context is cancelled, then
+// makes one attempt to write what is still queued
+func (r *Router) Start(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, sink := range r.sinks {
+		wg.Add(1)
+		go func(sink *routeSink) {
+			defer wg.Done()
+			r.run(ctx, sink)
+		}(sink)
+	}
+	wg.Wait()
+}
+
+// run batches a sink's queue, writing when a batch is full or the flush
+// interval passes
+func (r *Router) run(ctx context.Context, sink *routeSink) {
+	ticker := time.NewTicker(sink.FlushInterval)
+	defer ticker.Stop()
+
+	retryConfig := retry.Config{
+		MaxRetries:  sink.MaxRetries,
+		InitialWait: time.Second,
+		MaxWait:     30 * time.Second,
+		Multiplier:  2.0,
+	}
+	entries := make([]models.LogEntry, 0, sink.BatchSize)
+	var reportedDrops int64
+
+	for {
+		select {
+		case entry := <-sink.queue:
+			entries = append(entries, entry)
+			if len(entries) >= sink.BatchSize {
+				r.write(ctx, sink, entries, retryConfig)
+				entries = make([]models.LogEntry, 0, sink.BatchSize)
+			}
+		case <-ticker.C:
+			if len(entries) > 0 {
+				r.write(ctx, sink, entries, retryConfig)
+				entries = make([]models.LogEntry, 0, sink.BatchSize)
+			}
+			if dropped := sink.dropped.Load(); dropped > reportedDrops {
+				r.logger.Warn("Routing sink queue full, dropped entries",
+					zap.String("sink", sink.Name),
+					zap.Int64("dropped", dropped-reportedDrops))
+				reportedDrops = dropped
+			}
+		case <-ctx.Done():
+		drain:
+			for {
+				select {
+				case entry := <-sink.queue:
+					entries = append(entries, entry)
+				default:
+					break drain
+				}
+			}
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), sink.Timeout)
+			for len(entries) > 0 && shutdownCtx.Err() == nil {
+				n := min(len(entries), sink.BatchSize)
+				r.write(shutdownCtx, sink, entries[:n], retry.Config{})
+				entries = entries[n:]
+			}
+			cancel()
+			return
+		}
+	}
+}
+
+// write sends a batch to a sink, retrying the entries that were not
+// written, and records the outcome
+func (r *Router) write(ctx context.Context, sink *routeSink, entries []models.LogEntry, retryConfig retry.Config) {
+	pending := entries
+	err := retry.Do(ctx, retryConfig, func() error {
+		writeCtx, cancel := context.WithTimeout(ctx, sink.Timeout)
+		defer cancel()
+
+		var err error
+		pending, err = sink.writer.write(writeCtx, pending)
+		return err
+	})
+	sink.sent.Add(int64(len(entries) - len(pending)))
+	if err == nil {
+		return
+	}
+
+	sink.failed.Add(int64(len(pending)))
+	sink.mu.Lock()
+	sink.lastError = err.Error()
+	sink.lastErrorAt = time.Now()
+	sink.mu.Unlock()
+
+	r.logger.Error("Failed to write routed entries",
+		zap.String("sink", sink.Name),
+		zap.Int("entries", len(pending)),
+		zap.Error(err))
+}
+
+// Status returns each rule's match count and each sink's delivery counters
+func (r *Router) Status() models.RoutingStatus {
+	status := models.RoutingStatus{
+		Rules:     make([]models.RoutingRuleStatus, 0, len(r.rules)),
+		Unmatched: r.unmatched.Load(),
+		Sinks:     make([]models.RoutingSinkStatus, 0, len(r.sinks)),
+	}
+	for _, rule := range r.rules {
+		status.Rules = append(status.Rules, models.RoutingRuleStatus{
+			Name:    rule.name,
+			Sinks:   rule.sinks,
+			Matched: rule.matched.Load(),
+		})
+	}
+	for _, sink := range r.sinks {
+		s := models.RoutingSinkStatus{
+			Name:    sink.Name,
+			Type:    sink.Type,
+			Queued:  len(sink.queue),
+			Sent:    sink.sent.Load(),
+			Dropped: sink.dropped.Load(),
+			Failed:  sink.failed.Load(),
+		}
+		sink.mu.Lock()
+		if sink.lastError != "" {
+			at := sink.lastErrorAt
+			s.LastError = sink.lastError
+			s.LastErrorAt = &at
+		}
+		sink.mu.Unlock()
+		status.Sinks = append(status.Sinks, s)
+	}
+	return status
+}
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/oicur0t/logl/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
+)
+
+var (
+	// errUnknownService is returned for a service without log collections
+	errUnknownService = errors.New("service has no log collections")
+	// errServiceExists is returned when renaming onto a service with log collections
+	errServiceExists = errors.New("target service already has log collections")
+)
+
+// ListServices returns every service with a log collection, with document
+// counts and sizes summed over its partitions
+func (s *Storage) ListServices(ctx context.Context) ([]models.ServiceInfo, error) {
+	names, err := s.ListLogCollections(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byBase := make(map[string]*models.ServiceInfo)
+	for _, name := range names {
+		base := name
+		if partBase, _, _, ok := parsePartition(name); ok {
+			base = partBase
+		}
+		info, ok := byBase[base]
+		if !ok {
+			service := strings.TrimPrefix(base, s.collectionPrefix)
+			info = &models.ServiceInfo{
+				Service: service,
+				TTLDays: s.RetentionFor(service).TTLDays,
+			}
+			byBase[base] = info
+		}
+		info.Collections = append(info.Collections, name)
+
+		if err := s.addCollectionStats(ctx, name, info); err != nil {
+			return nil, err
+		}
+	}
+
+	services := make([]models.ServiceInfo, 0, len(byBase))
+	for _, info := range byBase {
+		sort.Strings(info.Collections)
+		services = append(services, *info)
+	}
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].Service < services[j].Service
+	})
+	return services, nil
+}
+
+// addCollectionStats adds a collection's collStats counts and sizes to info
+func (s *Storage) addCollectionStats(ctx context.Context, collName string, info *models.ServiceInfo) error {
+	var stats bson.M
+	if err := s.database.RunCommand(ctx, bson.D{{Key: "collStats", Value: collName}}).Decode(&stats); err != nil {
+		return fmt.Errorf("failed to get stats for %s: %w", collName, err)
+	}
+	info.Documents += bsonInt64(stats["count"])
+	info.SizeBytes += bsonInt64(stats["size"])
+	info.StorageBytes += bsonInt64(stats["storageSize"])
+	info.IndexBytes += bsonInt64(stats["totalIndexSize"])
+	return nil
+}
+
+// bsonInt64 converts a numeric BSON value to int64, 0 for other types
+func bsonInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int32:
+		return int64(n)
+	case int64:
+		return n
+	case float64:
+		return int64(n)
+	default:
+		return 0
+	}
+}
+
+// serviceCollections returns a service's collection and its partitions,
+// whether or not partitioning is currently enabled
+func (s *Storage) serviceCollections(ctx context.Context, service string) ([]string, error) {
+	base := s.CollectionFor(service)
+	filter := bson.M{"name": bson.M{"$regex": "^" + regexp.QuoteMeta(base) + `(_\d{4}_\d{2}(_\d{2})?)?$`}}
+	names, err := s.database.ListCollectionNames(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// PurgeService drops a service's collection and partitions, returning the
+// dropped collections. Its retention override is kept, so a service that
+// writes again keeps its retention.
+func (s *Storage) PurgeService(ctx context.Context, service string) ([]string, error) {
+	collections, err := s.serviceCollections(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+	if len(collections) == 0 {
+		return nil, errUnknownService
+	}
+
+	for i, collName := range collections {
+		if err := s.database.Collection(collName).Drop(ctx); err != nil {
+			return collections[:i], fmt.Errorf("failed to drop %s: %w", collName, err)
+		}
+		s.markUnindexed(collName)
+		s.logger.Info("Dropped collection", zap.String("collection", collName), zap.String("service", service))
+	}
+	return collections, nil
+}
+
+// RenameService moves a service's collection and partitions to another
+// service name, along with its retention override, returning the new
+// collections. service_name is rewritten in existing entries, except in
+// time-series collections, which don't allow it.
+func (s *Storage) RenameService(ctx context.Context, from, to string) ([]string, error) {
+	collections, err := s.serviceCollections(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	if len(collections) == 0 {
+		return nil, errUnknownService
+	}
+	existing, err := s.serviceCollections(ctx, to)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) > 0 {
+		return nil, errServiceExists
+	}
+
+	oldBase, newBase := s.CollectionFor(from), s.CollectionFor(to)
+	renamed := make([]string, 0, len(collections))
+	for _, collName := range collections {
+		newName := newBase + strings.TrimPrefix(collName, oldBase)
+		cmd := bson.D{
+			{Key: "renameCollection", Value: s.database.Name() + "." + collName},
+			{Key: "to", Value: s.database.Name() + "." + newName},
+		}
+		if err := s.client.Database("admin").RunCommand(ctx, cmd).Err(); err != nil {
+			return renamed, fmt.Errorf("failed to rename %s to %s: %w", collName, newName, err)
+		}
+		s.markUnindexed(collName)
+		renamed = append(renamed, newName)
+		s.logger.Info("Renamed collection", zap.String("from", collName), zap.String("to", newName))
+
+		specs, err := s.database.ListCollectionSpecifications(ctx, bson.M{"name": newName})
+		if err != nil || len(specs) == 0 || specs[0].Type == "timeseries" {
+			continue
+		}
+		if _, err := s.database.Collection(newName).UpdateMany(ctx, bson.M{}, bson.M{"$set": bson.M{"service_name": to}}); err != nil {
+			s.logger.Warn("Failed to rewrite service_name", zap.String("collection", newName), zap.Error(err))
+		}
+	}
+
+	if err := s.moveRetentionOverride(ctx, from, to); err != nil {
+		return renamed, err
+	}
+	return renamed, nil
+}
+
+// moveRetentionOverride moves a renamed service's retention override, if any
+func (s *Storage) moveRetentionOverride(ctx context.Context, from, to string) error {
+	s.retentionMu.RLock()
+	override, ok := s.retentionOverrides[s.CollectionFor(from)]
+	s.retentionMu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	if _, err := s.SetServiceRetention(ctx, to, override.TTLDays, override.UpdatedBy); err != nil {
+		return err
+	}
+	if _, err := s.ClearServiceRetention(ctx, from); err != nil && !errors.Is(err, errNoRetentionOverride) {
+		return err
+	}
+	return nil
+}
+
+// RebuildIndexes ensures the indexes and retention of a service's
+// collections, or of every log collection when service is empty. With
+// drop set, existing indexes other than _id are dropped first, so indexes
+// whose options changed are rebuilt.
+func (s *Storage) RebuildIndexes(ctx context.Context, service string, drop bool) error {
+	var collections []string
+	var err error
+	if service != "" {
+		collections, err = s.serviceCollections(ctx, service)
+	} else {
+		collections, err = s.ListLogCollections(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	if len(collections) == 0 {
+		return errUnknownService
+	}
+
+	var failed int
+	for _, collName := range collections {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s.markUnindexed(collName)
+		if drop {
+			if _, err := s.database.Collection(collName).Indexes().DropAll(ctx); err != nil {
+				s.logger.Warn("Failed to drop indexes", zap.String("collection", collName), zap.Error(err))
+				failed++
+				continue
+			}
+		}
+		name := strings.TrimPrefix(collName, s.collectionPrefix)
+		if base, _, _, ok := parsePartition(collName); ok {
+			name = strings.TrimPrefix(base, s.collectionPrefix)
+		}
+		if err := s.prepareCollection(ctx, collName, name); err != nil {
+			s.logger.Warn("Failed to rebuild indexes", zap.String("collection", collName), zap.Error(err))
+			failed++
+			continue
+		}
+		s.markIndexed(collName)
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to rebuild indexes on %d of %d collections", failed, len(collections))
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/awsauth"
+	"github.com/oicur0t/logl/pkg/ids"
+	"github.com/oicur0t/logl/pkg/models"
+)
+
+// fileSinkWriter appends routed entries as JSON lines to files named by
+// service and day
+type fileSinkWriter struct {
+	path string
+}
+
+// newFileSinkWriter creates a new file sink writer for a path template
+func newFileSinkWriter(path string) *fileSinkWriter {
+	return &fileSinkWriter{path: path}
+}
+
+// write appends entries to their files, returning the entries of files
+// that could not be written
+func (w *fileSinkWriter) write(_ context.Context, entries []models.LogEntry) ([]models.LogEntry, error) {
+	var order []string
+	byPath := make(map[string][]models.LogEntry)
+	for _, entry := range entries {
+		path := sinkFilePath(w.path, entry.ServiceName, entry.Timestamp)
+		if _, ok := byPath[path]; !ok {
+			order = append(order, path)
+		}
+		byPath[path] = append(byPath[path], entry)
+	}
+
+	var failed []models.LogEntry
+	var lastErr error
+	for _, path := range order {
+		if err := appendJSONLines(path, byPath[path]); err != nil {
+			failed = append(failed, byPath[path]...)
+			lastErr = err
+		}
+	}
+	if len(failed) > 0 {
+		return failed, lastErr
+	}
+	return nil, nil
+}
+
+// sinkFilePath expands a file sink's path template for an entry. Services
+// are reduced to characters safe in a file name.
+func sinkFilePath(template, service string, timestamp time.Time) string {
+	path := strings.ReplaceAll(template, "{service}", sinkPathToken(service))
+	return strings.ReplaceAll(path, "{date}", timestamp.UTC().Format("2006-01-02"))
+}
+
+// sinkPathToken replaces characters that are not safe in a path segment
+func sinkPathToken(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		}
+		return '_'
+	}, s)
+	if s == "" || s == "." || s == ".." {
+		return "_"
+	}
+	return s
+}
+
+// appendJSONLines appends entries to a file as JSON lines, creating the
+// file and its directory if needed
+func appendJSONLines(path string, entries []models.LogEntry) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			return fmt.Errorf("failed to encode entry: %w", err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", path, err)
+	}
+	return nil
+}
+
+// s3SinkWriter uploads routed entries to S3 as gzipped JSON lines, one
+// object per service and day for each batch
+type s3SinkWriter struct {
+	bucket      string
+	prefix      string
+	region      string
+	endpoint    string
+	credentials *awsauth.Credentials
+	objectIDs   ids.UUIDv7
+	httpClient  *http.Client
+}
+
+// newS3SinkWriter creates a new S3 sink writer
+func newS3SinkWriter(cfg config.RoutingSinkConfig) *s3SinkWriter {
+	return &s3SinkWriter{
+		bucket:      cfg.Bucket,
+		prefix:      cfg.Prefix,
+		region:      cfg.Region,
+		endpoint:    strings.TrimRight(cfg.Endpoint, "/"),
+		credentials: awsauth.NewCredentials(),
+		httpClient:  &http.Client{},
+	}
+}
+
+// write uploads entries, returning the entries of objects that could not
+// be uploaded
+func (w *s3SinkWriter) write(ctx context.Context, entries []models.LogEntry) ([]models.LogEntry, error) {
+	var order []string
+	byKey := make(map[string][]models.LogEntry)
+	for _, entry := range entries {
+		prefix := fmt.Sprintf("%sservice=%s/dt=%s/", w.prefix, sinkPathToken(entry.ServiceName), entry.Timestamp.UTC().Format("2006-01-02"))
+		if _, ok := byKey[prefix]; !ok {
+			order = append(order, prefix)
+		}
+		byKey[prefix] = append(byKey[prefix], entry)
+	}
+
+	var failed []models.LogEntry
+	var lastErr error
+	for _, prefix := range order {
+		key := prefix + w.objectIDs.New() + ".ndjson.gz"
+		if err := w.put(ctx, key, byKey[prefix]); err != nil {
+			failed = append(failed, byKey[prefix]...)
+			lastErr = err
+		}
+	}
+	if len(failed) > 0 {
+		return failed, lastErr
+	}
+	return nil, nil
+}
+
+// put uploads entries as one gzipped object
+func (w *s3SinkWriter) put(ctx context.Context, key string, entries []models.LogEntry) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(gz)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			return fmt.Errorf("failed to encode entry: %w", err)
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to compress object: %w", err)
+	}
+	body := buf.Bytes()
+
+	creds, err := w.credentials.Get(ctx)
+	if err != nil {
+		return err
+	}
+
+	objectURL := fmt.Sprintf("https://%s.s3.%s.amazonaws.com", w.bucket, w.region)
+	path := "/" + key
+	if w.endpoint != "" {
+		objectURL = w.endpoint // Path-style, as S3-compatible stores expect
+		path = "/" + w.bucket + "/" + key
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, objectURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.URL.Path = path
+	req.URL.RawPath = s3EscapePath(path)
+
+	bodyHash := sha256.Sum256(body)
+	req.Header.Set("Content-Type", "application/gzip")
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(bodyHash[:]))
+	awsauth.Sign(req, body, creds, w.region, "s3", time.Now())
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		return fmt.Errorf("upload of %s returned %d: %s", key, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return nil
+}
+
+// s3EscapePath percent-encodes an object path as S3 signs it: everything
+// but unreserved characters and slashes
+func s3EscapePath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/oicur0t/logl/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// errTooManyBuckets is returned when a histogram would exceed query.max_buckets
+var errTooManyBuckets = errors.New("too many buckets")
+
+// statsGroup is one row of a $group stage counting entries
+type statsGroup struct {
+	Key   interface{} `bson:"_id"`
+	Count int64       `bson:"count"`
+}
+
+// Histogram counts a service's entries matching the query in buckets of
+// the given width, aligned to the Unix epoch. Every bucket between from and
+// to is returned, including empty ones.
+func (s *Storage) Histogram(ctx context.Context, q models.LogQuery, bucket time.Duration) ([]models.BucketCount, error) {
+	ms := bucket.Milliseconds()
+	from := time.UnixMilli(q.From.UnixMilli() - q.From.UnixMilli()%ms)
+	if n := int((q.To.Sub(from) + bucket - 1) / bucket); n > s.query.MaxBuckets {
+		return nil, fmt.Errorf("%w: %d buckets of %s exceed query.max_buckets (%d)", errTooManyBuckets, n, bucket, s.query.MaxBuckets)
+	}
+
+	// Dates minus milliseconds are dates, so this works before $dateTrunc
+	key := bson.M{"$subtract": bson.A{"$timestamp", bson.M{"$mod": bson.A{bson.M{"$toLong": "$timestamp"}, ms}}}}
+
+	groups, err := s.countBy(ctx, q, bson.M{}, key, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[int64]int64, len(groups))
+	for _, g := range groups {
+		if t, ok := g.Key.(time.Time); ok {
+			counts[t.UnixMilli()] += g.Count
+		}
+	}
+
+	buckets := make([]models.BucketCount, 0)
+	for t := from; t.Before(q.To); t = t.Add(bucket) {
+		buckets = append(buckets, models.BucketCount{Start: t.UTC(), Count: counts[t.UnixMilli()]})
+	}
+	return buckets, nil
+}
+
+// CountValues counts a service's entries matching the query by the value
+// of a field, most frequent first. field is a document path such as
+// "level", "labels.env", or "parsed.status". With present set, entries
+// without the field are left out. At most query.max_buckets values are
+// returned, or limit if it is lower.
+func (s *Storage) CountValues(ctx context.Context, q models.LogQuery, field string, present bool, limit int) ([]models.ValueCount, error) {
+	if limit <= 0 || limit > s.query.MaxBuckets {
+		limit = s.query.MaxBuckets
+	}
+
+	match := bson.M{}
+	if present {
+		match[field] = bson.M{"$exists": true}
+	}
+	groups, err := s.countBy(ctx, q, match, "$"+field, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]models.ValueCount, 0, len(groups))
+	for _, g := range groups {
+		values = append(values, models.ValueCount{Value: g.Key, Count: g.Count})
+	}
+	sort.SliceStable(values, func(i, j int) bool {
+		return values[i].Count > values[j].Count
+	})
+	if len(values) > limit {
+		values = values[:limit]
+	}
+	return values, nil
+}
+
+// countBy groups a service's entries matching the query and extra by key
+// across its partitions, merging groups with equal keys. With limit set,
+// each partition contributes only its limit largest groups, so counts of
+// values near the cutoff can be low when the window spans partitions.
+func (s *Storage) countBy(ctx context.Context, q models.LogQuery, extra bson.M, key interface{}, limit int) ([]statsGroup, error) {
+	collections, err := s.CollectionsFor(ctx, q.ServiceName, q.From, q.To)
+	if err != nil {
+		return nil, err
+	}
+
+	match := BuildQueryFilter(q)
+	for k, v := range extra {
+		match[k] = v
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{"_id": key, "count": bson.M{"$sum": 1}}}},
+	}
+	if limit > 0 {
+		pipeline = append(pipeline,
+			bson.D{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+			bson.D{{Key: "$limit", Value: limit}})
+	}
+	opts := options.Aggregate().SetMaxTime(s.query.StatsTimeout)
+
+	merged := make(map[string]*statsGroup)
+	order := make([]string, 0)
+	for _, collName := range collections {
+		cursor, err := s.database.Collection(collName).Aggregate(ctx, pipeline, opts)
+		if err != nil {
+			return nil, fmt.Errorf("collection %s: failed to aggregate logs: %w", collName, err)
+		}
+		var groups []statsGroup
+		err = cursor.All(ctx, &groups)
+		cursor.Close(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("collection %s: failed to decode counts: %w", collName, err)
+		}
+
+		for _, g := range groups {
+			k := fmt.Sprintf("%T:%v", g.Key, g.Key)
+			if m, ok := merged[k]; ok {
+				m.Count += g.Count
+				continue
+			}
+			g := g
+			merged[k] = &g
+			order = append(order, k)
+		}
+	}
+
+	groups := make([]statsGroup, 0, len(order))
+	for _, k := range order {
+		groups = append(groups, *merged[k])
+	}
+	return groups, nil
+}
+
+// statsField maps a group-by parameter to a document path: level,
+// hostname, file_path, label:<key>, or parsed.<path>
+func statsField(by string) (string, error) {
+	switch by {
+	case "level", "hostname", "file_path":
+		return by, nil
+	}
+	if key, ok := strings.CutPrefix(by, "label:"); ok {
+		if !validLabelKey(key) {
+			return "", fmt.Errorf("invalid label key: %s", key)
+		}
+		return "labels." + key, nil
+	}
+	if path, ok := strings.CutPrefix(by, "parsed."); ok {
+		return parsedField(path)
+	}
+	return "", fmt.Errorf("invalid by: %s (expected level, hostname, file_path, label:<key>, or parsed.<field>)", by)
+}
+
+// parsedField maps a dotted path within parsed fields to a document path
+func parsedField(path string) (string, error) {
+	for _, part := range strings.Split(path, ".") {
+		if part == "" || strings.HasPrefix(part, "$") {
+			return "", fmt.Errorf("invalid field: %s", path)
+		}
+	}
+	return "parsed." + path, nil
+}
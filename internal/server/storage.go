@@ -2,11 +2,14 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/oicur0t/logl/internal/config"
 	"github.com/oicur0t/logl/pkg/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -16,23 +19,50 @@ import (
 
 // Storage handles MongoDB operations
 type Storage struct {
-	client           *mongo.Client
-	database         *mongo.Database
-	collectionPrefix string
-	logger           *zap.Logger
-	ttlDays          int
+	client               *mongo.Client
+	database             *mongo.Database
+	collectionPrefix     string
+	logger               *zap.Logger
+	ttlDays              int
+	templates            []CollectionTemplate
+	labelIndexes         []string
+	quarantineCollection string         // Documents MongoDB rejected on insert
+	faults               *FaultInjector // nil unless built with the faults tag
+	tenancy              *Tenancy       // nil unless tenancy is enabled
+	bulkWriter           *BulkWriter    // nil writes each batch with its own InsertMany
+	timeSeries           config.TimeSeriesConfig
+	partitioning         config.PartitioningConfig
+	retention            config.RetentionConfig
+	query                config.QueryConfig
+	retentionPatterns    []string // retention.services keys, most specific first
+
+	retentionMu        sync.RWMutex
+	retentionOverrides map[string]models.RetentionOverride // by collection
+
+	indexes        config.IndexesConfig
+	builtinEnabled map[string]bool // nil creates every built-in index
+	customIndexes  []mongo.IndexModel
+
+	indexedMu sync.RWMutex
+	indexed   map[string]bool // collections whose indexes are known to exist
+	filterIDs map[string]bool // collections whose inserts leave out entry IDs already stored, lacking a unique index
+
+	preparingMu sync.Mutex
+	preparing   map[string]chan struct{} // closed once the collection exists
 }
 
 // NewStorage creates a new MongoDB storage instance
-func NewStorage(uri, database, collectionPrefix, certKeyFile string, maxPoolSize, ttlDays int, logger *zap.Logger) (*Storage, error) {
+func NewStorage(uri, database, collectionPrefix, certKeyFile string, maxPoolSize, minPoolSize, ttlDays int, templates []CollectionTemplate, labelIndexes []string, quarantineCollection string, logger *zap.Logger) (*Storage, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	// Build connection options
 	clientOpts := options.Client().ApplyURI(uri)
 
-	// Set max pool size
+	// Set pool size; idle connections up to the minimum are opened in the
+	// background so the first requests after startup don't pay for dialing
 	clientOpts.SetMaxPoolSize(uint64(maxPoolSize))
+	clientOpts.SetMinPoolSize(uint64(minPoolSize))
 
 	// If certificate key file is provided, use X.509 authentication
 	if certKeyFile != "" {
@@ -68,11 +98,18 @@ func NewStorage(uri, database, collectionPrefix, certKeyFile string, maxPoolSize
 		zap.Int("max_pool_size", maxPoolSize))
 
 	return &Storage{
-		client:           client,
-		database:         client.Database(database),
-		collectionPrefix: collectionPrefix,
-		logger:           logger,
-		ttlDays:          ttlDays,
+		client:               client,
+		database:             client.Database(database),
+		collectionPrefix:     collectionPrefix,
+		logger:               logger,
+		ttlDays:              ttlDays,
+		templates:            templates,
+		labelIndexes:         labelIndexes,
+		quarantineCollection: quarantineCollection,
+		indexed:              make(map[string]bool),
+		filterIDs:            make(map[string]bool),
+		preparing:            make(map[string]chan struct{}),
+		retentionOverrides:   make(map[string]models.RetentionOverride),
 	}, nil
 }
 
@@ -84,13 +121,117 @@ func (s *Storage) InsertBatch(ctx context.Context, batch models.LogBatch) error
 
 	// Get or create collection for this service
 	collName := s.sanitizeCollectionName(batch.ServiceName)
-	collection := s.database.Collection(collName)
 
-	// Ensure indexes exist
-	if err := s.ensureIndexes(ctx, collection); err != nil {
-		s.logger.Error("Failed to ensure indexes", zap.Error(err), zap.String("collection", collName))
-		// Don't fail the insert if index creation fails
+	// Injected faults for chaos testing
+	if err := s.faults.BeforeInsert(ctx); err != nil {
+		if errors.Is(err, errInjectedDrop) {
+			s.logger.Warn("Dropping batch by fault injection",
+				zap.String("collection", collName),
+				zap.Int("batch_size", len(batch.Entries)))
+			return nil
+		}
+		return fmt.Errorf("failed to insert batch: %w", err)
+	}
+
+	// Partitioned services split the batch by entry timestamp
+	parts := map[string]models.LogBatch{collName: batch}
+	if s.partitioning.Interval != "" {
+		parts = s.partitionBatch(collName, batch)
+	}
+
+	for name, part := range parts {
+		s.ensurePrepared(ctx, name, batch.ServiceName)
+		if s.filtersIDs(name) {
+			entries, err := s.unstoredEntries(ctx, name, part.Entries)
+			if err != nil {
+				return err
+			}
+			if len(entries) == 0 {
+				continue
+			}
+			part.Entries = entries
+		}
+
+		// Coalesce with concurrent batches for the same collection
+		var err error
+		if s.bulkWriter != nil {
+			err = s.bulkWriter.Submit(ctx, name, part)
+		} else {
+			err = s.insertEntries(ctx, name, part)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensurePrepared prepares an unseen collection once per collection per
+// process. The collection and its unique entry_id index are created before
+// its first insert, since its options can only be set at creation and
+// dedup needs the index before the first retry arrives; its other indexes
+// are built in the background so inserts don't wait on them. Failures are
+// logged but don't block writes, and are retried on the next batch.
+func (s *Storage) ensurePrepared(ctx context.Context, collName, serviceName string) {
+	if s.isIndexed(collName) {
+		return
+	}
+
+	s.preparingMu.Lock()
+	created, preparing := s.preparing[collName]
+	if !preparing {
+		created = make(chan struct{})
+		s.preparing[collName] = created
+	}
+	s.preparingMu.Unlock()
+
+	// Wait for another batch to create the collection, so this one doesn't
+	// create it first with default options
+	if preparing {
+		select {
+		case <-created:
+		case <-ctx.Done():
+		}
+		return
+	}
+
+	timeSeries, existed, err := s.createCollection(ctx, collName, serviceName)
+	if err == nil {
+		s.ensureEntryIDIndex(ctx, collName, timeSeries)
 	}
+	close(created)
+	if err != nil {
+		s.logger.Error("Failed to create collection", zap.Error(err), zap.String("collection", collName))
+		s.donePreparing(collName)
+		return
+	}
+
+	go func() {
+		defer s.donePreparing(collName)
+
+		buildCtx, cancel := context.WithTimeout(context.Background(), s.indexBuildTimeout())
+		defer cancel()
+		if err := s.prepareIndexes(buildCtx, collName, serviceName, timeSeries, existed); err != nil {
+			s.logger.Error("Failed to ensure indexes", zap.Error(err), zap.String("collection", collName))
+			return
+		}
+		s.markIndexed(collName)
+		s.logger.Debug("Indexes ensured", zap.String("collection", collName))
+	}()
+}
+
+// donePreparing lets the next batch for a collection prepare it again if
+// it wasn't marked indexed
+func (s *Storage) donePreparing(collName string) {
+	s.preparingMu.Lock()
+	defer s.preparingMu.Unlock()
+	delete(s.preparing, collName)
+}
+
+// insertEntries writes a batch's entries with one unordered InsertMany,
+// quarantining documents rejected individually
+func (s *Storage) insertEntries(ctx context.Context, collName string, batch models.LogBatch) error {
+	collection := s.database.Collection(collName)
 
 	// Convert to interface slice for bulk insert
 	docs := make([]interface{}, len(batch.Entries))
@@ -99,77 +240,179 @@ func (s *Storage) InsertBatch(ctx context.Context, batch models.LogBatch) error
 	}
 
 	// Bulk insert
-	result, err := collection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	_, err := collection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	inserted := len(docs)
 	if err != nil {
-		// Check if it's a duplicate key error (which is fine for idempotency)
-		if mongo.IsDuplicateKeyError(err) {
-			s.logger.Warn("Duplicate key error, some documents already exist",
-				zap.String("collection", collName),
-				zap.Int("batch_size", len(batch.Entries)))
-			return nil
+		// Unordered inserts store every document not individually rejected,
+		// so only per-document errors are handled here. Anything else (write
+		// concern, network) fails the whole batch for a retry.
+		var bulkErr mongo.BulkWriteException
+		if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil || len(bulkErr.WriteErrors) == 0 {
+			return fmt.Errorf("failed to insert batch: %w", err)
 		}
-		return fmt.Errorf("failed to insert batch: %w", err)
+		s.handleWriteErrors(ctx, collName, batch, bulkErr.WriteErrors)
+		inserted -= len(bulkErr.WriteErrors)
 	}
 
 	s.logger.Info("Batch inserted",
 		zap.String("collection", collName),
-		zap.Int("inserted", len(result.InsertedIDs)),
+		zap.Int("inserted", inserted),
 		zap.String("service", batch.ServiceName))
 
 	return nil
 }
 
-// ensureIndexes creates necessary indexes on a collection
-func (s *Storage) ensureIndexes(ctx context.Context, collection *mongo.Collection) error {
-	indexModels := []mongo.IndexModel{
-		{
-			Keys: bson.D{{Key: "timestamp", Value: -1}},
-			Options: options.Index().SetName("timestamp_desc"),
-		},
-		{
+// unstoredEntries returns entries without those whose entry ID is already
+// stored in a collection or repeated earlier in the batch. Concurrent
+// inserts of the same ID can still both be stored.
+func (s *Storage) unstoredEntries(ctx context.Context, collName string, entries []models.LogEntry) ([]models.LogEntry, error) {
+	var ids []string
+	for _, entry := range entries {
+		if entry.EntryID != "" {
+			ids = append(ids, entry.EntryID)
+		}
+	}
+	if len(ids) == 0 {
+		return entries, nil
+	}
+
+	stored, err := s.database.Collection(collName).Distinct(ctx, "entry_id", bson.M{"entry_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to check entry IDs: %w", err)
+	}
+	seen := make(map[string]bool, len(ids))
+	for _, id := range stored {
+		if id, ok := id.(string); ok {
+			seen[id] = true
+		}
+	}
+
+	kept := make([]models.LogEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.EntryID != "" {
+			if seen[entry.EntryID] {
+				continue
+			}
+			seen[entry.EntryID] = true
+		}
+		kept = append(kept, entry)
+	}
+	if dropped := len(entries) - len(kept); dropped > 0 {
+		s.logger.Debug("Skipped entries already stored",
+			zap.String("collection", collName),
+			zap.Int("skipped", dropped))
+	}
+	return kept, nil
+}
+
+// Probe inserts and deletes a document in a probe collection, verifying
+// the credentials can write to the database
+func (s *Storage) Probe(ctx context.Context) error {
+	collection := s.database.Collection("selftest_probe")
+
+	result, err := collection.InsertOne(ctx, bson.M{"probe": true, "at": time.Now()})
+	if err != nil {
+		return fmt.Errorf("failed to insert probe document: %w", err)
+	}
+	if _, err := collection.DeleteOne(ctx, bson.M{"_id": result.InsertedID}); err != nil {
+		return fmt.Errorf("failed to delete probe document: %w", err)
+	}
+	return nil
+}
+
+// SetTimeSeries creates new log collections as time-series collections
+// when enabled, unless their template says otherwise
+func (s *Storage) SetTimeSeries(cfg config.TimeSeriesConfig) {
+	s.timeSeries = cfg
+}
+
+// SetPartitioning writes entries to time-bucketed collections per service
+// when an interval is set
+func (s *Storage) SetPartitioning(cfg config.PartitioningConfig) {
+	s.partitioning = cfg
+}
+
+// SetQuery sets the limits applied to stats aggregations
+func (s *Storage) SetQuery(cfg config.QueryConfig) {
+	s.query = cfg
+}
+
+// SetBulkWriter coalesces inserts through a bulk writer
+func (s *Storage) SetBulkWriter(writer *BulkWriter) {
+	s.bulkWriter = writer
+}
+
+// QueuedInserts returns the number of batches waiting for the bulk writer
+func (s *Storage) QueuedInserts() int {
+	if s.bulkWriter == nil {
+		return 0
+	}
+	return s.bulkWriter.Queued()
+}
+
+// SetFaultInjector routes inserts through a fault injector
+func (s *Storage) SetFaultInjector(faults *FaultInjector) {
+	s.faults = faults
+}
+
+// SetTenancy applies owning tenants' retention to their services
+func (s *Storage) SetTenancy(tenancy *Tenancy) {
+	s.tenancy = tenancy
+}
+
+// ensureIndexes creates necessary indexes on a collection, plus any
+// indexes from its template. The TTL index is kept in sync with the
+// service's retention separately.
+func (s *Storage) ensureIndexes(ctx context.Context, collection *mongo.Collection, tmpl *CollectionTemplate, timeSeries bool) error {
+	indexModels := make([]mongo.IndexModel, 0, len(builtinIndexes))
+	for _, model := range builtinIndexes {
+		name := *model.Options.Name
+		if name == entryIDIndex && !timeSeries {
+			continue // Built by ensureEntryIDIndex
+		}
+		if s.builtinEnabled == nil || s.builtinEnabled[name] {
+			indexModels = append(indexModels, model)
+		}
+	}
+
+	// Selected labels, sparse since entries may not carry them
+	for _, label := range s.labelIndexes {
+		indexModels = append(indexModels, mongo.IndexModel{
 			Keys: bson.D{
-				{Key: "hostname", Value: 1},
+				{Key: "labels." + label, Value: 1},
 				{Key: "timestamp", Value: -1},
 			},
-			Options: options.Index().SetName("hostname_timestamp"),
-		},
-		// Indexes for parsed JSON fields (sparse to only index documents that have these fields)
-		{
-			Keys:    bson.D{{Key: "parsed.level", Value: 1}},
-			Options: options.Index().SetName("parsed_level").SetSparse(true),
-		},
-		{
-			Keys:    bson.D{{Key: "parsed.timestamp", Value: -1}},
-			Options: options.Index().SetName("parsed_timestamp").SetSparse(true),
-		},
-		{
-			Keys:    bson.D{{Key: "parsed.request_id", Value: 1}},
-			Options: options.Index().SetName("parsed_request_id").SetSparse(true),
-		},
-		{
-			Keys:    bson.D{{Key: "parsed.user_id", Value: 1}},
-			Options: options.Index().SetName("parsed_user_id").SetSparse(true),
-		},
-		{
-			Keys: bson.D{
-				{Key: "parsed.level", Value: 1},
-				{Key: "parsed.timestamp", Value: -1},
-			},
-			Options: options.Index().SetName("parsed_level_timestamp").SetSparse(true),
-		},
+			Options: options.Index().SetName("labels_" + label + "_timestamp").SetSparse(true),
+		})
 	}
 
-	// Add TTL index if configured
-	if s.ttlDays > 0 {
-		ttlSeconds := int32(s.ttlDays * 24 * 60 * 60)
+	indexModels = append(indexModels, s.customIndexes...)
+	if tmpl != nil {
+		indexModels = append(indexModels, tmpl.Indexes...)
+	}
+
+	// Time-series collections don't support text indexes
+	if s.indexes.LineText && !timeSeries {
 		indexModels = append(indexModels, mongo.IndexModel{
-			Keys: bson.D{{Key: "timestamp", Value: 1}},
-			Options: options.Index().
-				SetName("ttl_index").
-				SetExpireAfterSeconds(ttlSeconds),
+			Keys:    bson.D{{Key: "line", Value: "text"}},
+			Options: options.Index().SetName("line_text").SetDefaultLanguage("none"),
 		})
 	}
 
+	// Time-series collections reject unique secondary indexes, and sparse
+	// ones on some server versions, so both are built as plain indexes
+	if timeSeries {
+		for i, model := range indexModels {
+			if model.Options == nil {
+				continue
+			}
+			opts := *model.Options
+			opts.Unique = nil
+			opts.Sparse = nil
+			indexModels[i].Options = &opts
+		}
+	}
+
 	// Create indexes (this is idempotent)
 	_, err := collection.Indexes().CreateMany(ctx, indexModels)
 	if err != nil {
@@ -179,20 +422,55 @@ func (s *Storage) ensureIndexes(ctx context.Context, collection *mongo.Collectio
 	return nil
 }
 
+// isIndexed reports whether a collection's indexes have already been ensured
+func (s *Storage) isIndexed(collName string) bool {
+	s.indexedMu.RLock()
+	defer s.indexedMu.RUnlock()
+	return s.indexed[collName]
+}
+
+// markIndexed records that a collection's indexes exist
+func (s *Storage) markIndexed(collName string) {
+	s.indexedMu.Lock()
+	defer s.indexedMu.Unlock()
+	s.indexed[collName] = true
+}
+
+// markUnindexed forgets a dropped collection so it is prepared again if reused
+func (s *Storage) markUnindexed(collName string) {
+	s.indexedMu.Lock()
+	defer s.indexedMu.Unlock()
+	delete(s.indexed, collName)
+	delete(s.filterIDs, collName)
+}
+
+// filtersIDs reports whether inserts into a collection leave out entry IDs
+// already stored, as it has no unique entry_id index
+func (s *Storage) filtersIDs(collName string) bool {
+	s.indexedMu.RLock()
+	defer s.indexedMu.RUnlock()
+	return s.filterIDs[collName]
+}
+
 // sanitizeCollectionName creates a valid collection name from service name
 func (s *Storage) sanitizeCollectionName(serviceName string) string {
-	// Convert to lowercase
-	name := strings.ToLower(serviceName)
+	return s.collectionPrefix + normalizeServiceName(serviceName)
+}
 
-	// Replace invalid characters with underscore
-	reg := regexp.MustCompile(`[^a-z0-9_]`)
-	name = reg.ReplaceAllString(name, "_")
+// invalidNameChars matches characters replaced in collection names
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9_]`)
 
-	// Add prefix
-	return s.collectionPrefix + name
+// normalizeServiceName lowercases a service name and replaces characters
+// other than letters, digits, and underscores, so names stored in the same
+// collection are treated as one service
+func normalizeServiceName(serviceName string) string {
+	return invalidNameChars.ReplaceAllString(strings.ToLower(serviceName), "_")
 }
 
 // Close closes the MongoDB connection
 func (s *Storage) Close(ctx context.Context) error {
+	if s.bulkWriter != nil {
+		s.bulkWriter.Close()
+	}
 	return s.client.Disconnect(ctx)
 }
@@ -0,0 +1,240 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/oicur0t/logl/internal/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// CollectionTemplate describes how a new service's collection is created
+type CollectionTemplate struct {
+	Name             string
+	Match            string // glob matched against the service name
+	TTLDays          *int   // nil inherits mongodb.ttl_days
+	TimeSeries       *bool  // nil inherits mongodb.time_series.enabled
+	Indexes          []mongo.IndexModel
+	ShardKey         bson.D
+	Validator        bson.M
+	ValidationLevel  string
+	ValidationAction string
+}
+
+// NewCollectionTemplates compiles template configuration
+func NewCollectionTemplates(cfgs []config.CollectionTemplateConfig) ([]CollectionTemplate, error) {
+	templates := make([]CollectionTemplate, 0, len(cfgs))
+	for _, c := range cfgs {
+		if _, err := path.Match(c.Match, ""); err != nil || c.Match == "" {
+			return nil, fmt.Errorf("template %s: invalid match pattern %q", c.Name, c.Match)
+		}
+
+		t := CollectionTemplate{
+			Name:             c.Name,
+			Match:            c.Match,
+			TTLDays:          c.TTLDays,
+			TimeSeries:       c.TimeSeries,
+			ValidationLevel:  c.ValidationLevel,
+			ValidationAction: c.ValidationAction,
+		}
+
+		indexes, err := compileIndexes(c.Indexes)
+		if err != nil {
+			return nil, fmt.Errorf("template %s %w", c.Name, err)
+		}
+		t.Indexes = indexes
+
+		if len(c.ShardKey) > 0 {
+			keys, err := parseIndexKeys(c.ShardKey)
+			if err != nil {
+				return nil, fmt.Errorf("template %s shard key: %w", c.Name, err)
+			}
+			t.ShardKey = keys
+		}
+
+		if c.Validator != "" {
+			if err := bson.UnmarshalExtJSON([]byte(c.Validator), false, &t.Validator); err != nil {
+				return nil, fmt.Errorf("template %s validator: %w", c.Name, err)
+			}
+		}
+
+		templates = append(templates, t)
+	}
+	return templates, nil
+}
+
+// compileIndexes converts index configuration into index models
+func compileIndexes(cfgs []config.IndexTemplateConfig) ([]mongo.IndexModel, error) {
+	indexes := make([]mongo.IndexModel, 0, len(cfgs))
+	for _, idx := range cfgs {
+		keys, err := parseIndexKeys(idx.Keys)
+		if err != nil {
+			return nil, fmt.Errorf("index %s: %w", idx.Name, err)
+		}
+		opts := options.Index().SetName(idx.Name)
+		if idx.Unique {
+			opts.SetUnique(true)
+		}
+		if idx.Sparse {
+			opts.SetSparse(true)
+		}
+		if idx.PartialFilter != "" {
+			var filter bson.M
+			if err := bson.UnmarshalExtJSON([]byte(idx.PartialFilter), false, &filter); err != nil {
+				return nil, fmt.Errorf("index %s partial filter: %w", idx.Name, err)
+			}
+			opts.SetPartialFilterExpression(filter)
+		}
+		indexes = append(indexes, mongo.IndexModel{Keys: keys, Options: opts})
+	}
+	return indexes, nil
+}
+
+// parseIndexKeys parses "field:1", "field:-1", "field:hashed", or
+// "field:text" specs
+func parseIndexKeys(specs []string) (bson.D, error) {
+	keys := bson.D{}
+	for _, spec := range specs {
+		field, dir, ok := strings.Cut(spec, ":")
+		if !ok || field == "" {
+			return nil, fmt.Errorf("invalid key %q, expected field:direction", spec)
+		}
+		if dir == "hashed" || dir == "text" {
+			keys = append(keys, bson.E{Key: field, Value: dir})
+			continue
+		}
+		n, err := strconv.Atoi(dir)
+		if err != nil || (n != 1 && n != -1) {
+			return nil, fmt.Errorf("invalid direction in %q, expected 1, -1, hashed, or text", spec)
+		}
+		keys = append(keys, bson.E{Key: field, Value: n})
+	}
+	return keys, nil
+}
+
+// templateFor returns the first template matching a service (or the
+// unprefixed collection name, for collections discovered at startup)
+func (s *Storage) templateFor(name string) *CollectionTemplate {
+	for i := range s.templates {
+		if ok, _ := path.Match(s.templates[i].Match, name); ok {
+			return &s.templates[i]
+		}
+	}
+	return nil
+}
+
+// prepareCollection creates a previously unseen collection and ensures its
+// indexes and retention. name is the service, or the unprefixed collection
+// name for collections discovered at startup.
+func (s *Storage) prepareCollection(ctx context.Context, collName, name string) error {
+	timeSeries, existed, err := s.createCollection(ctx, collName, name)
+	if err != nil {
+		return err
+	}
+	s.ensureEntryIDIndex(ctx, collName, timeSeries)
+	return s.prepareIndexes(ctx, collName, name, timeSeries, existed)
+}
+
+// createCollection creates a previously unseen collection from its
+// template, or as a time-series collection, reporting whether it is a
+// time-series collection and whether it already existed. Collections
+// without either are left to be created by their first insert.
+func (s *Storage) createCollection(ctx context.Context, collName, name string) (timeSeries, existed bool, err error) {
+	tmpl := s.templateFor(name)
+	existing, err := s.database.ListCollectionSpecifications(ctx, bson.M{"name": collName})
+	if err != nil {
+		return false, false, fmt.Errorf("failed to check collection %s: %w", collName, err)
+	}
+
+	// Existing collections keep the type they were created with
+	if len(existing) > 0 {
+		return existing[0].Type == "timeseries", true, nil
+	}
+
+	timeSeries = s.timeSeriesFor(tmpl)
+	if tmpl != nil || timeSeries {
+		opts := options.CreateCollection()
+		if timeSeries {
+			opts.SetTimeSeriesOptions(options.TimeSeries().
+				SetTimeField("timestamp").
+				SetMetaField(s.timeSeries.MetaField).
+				SetGranularity(s.timeSeries.Granularity))
+			// Time-series collections expire whole buckets instead of using a TTL index
+			if ttlDays := s.RetentionFor(name).TTLDays; ttlDays > 0 && s.partitioning.Interval == "" {
+				opts.SetExpireAfterSeconds(int64(ttlDays) * 24 * 60 * 60)
+			}
+		}
+		if tmpl != nil && tmpl.Validator != nil {
+			opts.SetValidator(tmpl.Validator)
+		}
+		if tmpl != nil && tmpl.ValidationLevel != "" {
+			opts.SetValidationLevel(tmpl.ValidationLevel)
+		}
+		if tmpl != nil && tmpl.ValidationAction != "" {
+			opts.SetValidationAction(tmpl.ValidationAction)
+		}
+
+		if err := s.database.CreateCollection(ctx, collName, opts); err != nil {
+			return false, false, fmt.Errorf("failed to create collection %s: %w", collName, err)
+		}
+
+		if tmpl != nil {
+			s.logger.Info("Created collection from template",
+				zap.String("collection", collName),
+				zap.String("template", tmpl.Name),
+				zap.Bool("time_series", timeSeries))
+		} else {
+			s.logger.Info("Created time-series collection", zap.String("collection", collName))
+		}
+
+		if tmpl != nil && len(tmpl.ShardKey) > 0 {
+			cmd := bson.D{
+				{Key: "shardCollection", Value: s.database.Name() + "." + collName},
+				{Key: "key", Value: tmpl.ShardKey},
+			}
+			if err := s.client.Database("admin").RunCommand(ctx, cmd).Err(); err != nil {
+				// Not fatal: unsharded deployments reject shardCollection
+				s.logger.Warn("Failed to shard collection", zap.String("collection", collName), zap.Error(err))
+			}
+		}
+	}
+
+	return timeSeries, false, nil
+}
+
+// prepareIndexes ensures a collection's indexes and keeps its expiry in
+// line with retention changes made since it was created. Partitions are
+// dropped by the retention job instead.
+func (s *Storage) prepareIndexes(ctx context.Context, collName, name string, timeSeries, existed bool) error {
+	collection := s.database.Collection(collName)
+	if err := s.ensureIndexes(ctx, collection, s.templateFor(name), timeSeries); err != nil {
+		return err
+	}
+
+	ttlDays := s.RetentionFor(name).TTLDays
+	switch {
+	case s.partitioning.Interval != "":
+		return nil
+	case timeSeries && existed:
+		return s.syncTimeSeriesExpiry(ctx, collName, ttlDays)
+	case timeSeries:
+		return nil
+	default:
+		return s.syncTTLIndex(ctx, collection, ttlDays)
+	}
+}
+
+// timeSeriesFor reports whether new collections using a template are
+// created as time-series collections
+func (s *Storage) timeSeriesFor(tmpl *CollectionTemplate) bool {
+	if tmpl != nil && tmpl.TimeSeries != nil {
+		return *tmpl.TimeSeries
+	}
+	return s.timeSeries.Enabled
+}
@@ -0,0 +1,426 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// apiKeyHeader carries a tenant API key
+const apiKeyHeader = "X-Logl-Api-Key"
+
+// tenantContextKey carries the tenant a request acts for
+type tenantContextKey struct{}
+
+// apiKeyContextKey carries the ID of a verified tenant API key
+type apiKeyContextKey struct{}
+
+// errUnknownTenant is returned when assigning a service to a tenant that
+// is not configured
+var errUnknownTenant = errors.New("unknown tenant")
+
+// tenantAPIKey is an API key and the tenant it belongs to
+type tenantAPIKey struct {
+	id     string
+	key    []byte
+	tenant string
+}
+
+// Tenancy isolates tenants from each other. Each service is owned by the
+// tenant that first sends it entries, or the one an admin assigns it to;
+// tenants other than admins can only ingest to and read their own
+// services. Ownership is kept in MongoDB so every instance agrees on it.
+type Tenancy struct {
+	collection      *mongo.Collection
+	storage         *Storage
+	tenants         map[string]config.TenantConfig
+	admins          map[string]bool
+	byOU            map[string]string
+	keys            []tenantAPIKey
+	quotas          *QuotaManager
+	refreshInterval time.Duration
+	logger          *zap.Logger
+
+	mu     sync.RWMutex
+	owners map[string]models.TenantService // By collection; no tenant is known to be unowned
+}
+
+// NewTenancy creates a new tenancy manager, counting tenant quotas with
+// notifications sent through the notifier
+func NewTenancy(storage *Storage, cfg config.TenancyConfig, notifier *Notifier, logger *zap.Logger) *Tenancy {
+	t := &Tenancy{
+		collection:      storage.database.Collection(cfg.Collection),
+		storage:         storage,
+		tenants:         make(map[string]config.TenantConfig),
+		admins:          make(map[string]bool),
+		byOU:            make(map[string]string),
+		refreshInterval: cfg.RefreshInterval,
+		logger:          logger,
+		owners:          make(map[string]models.TenantService),
+	}
+
+	limits := make(map[string]int64)
+	for _, tenant := range cfg.Tenants {
+		t.tenants[tenant.Name] = tenant
+		for _, ou := range tenant.OUs {
+			t.byOU[ou] = tenant.Name
+		}
+		for _, key := range tenant.APIKeys {
+			t.keys = append(t.keys, tenantAPIKey{id: key.ID, key: []byte(key.Key), tenant: tenant.Name})
+		}
+		if tenant.Quota > 0 {
+			limits[tenant.Name] = tenant.Quota
+		}
+	}
+	for _, admin := range cfg.AdminTenants {
+		t.admins[admin] = true
+	}
+
+	// Tenants are keyed by their configured names, which aren't normalized
+	// as service names are
+	t.quotas = newQuotaManager(config.QuotaConfig{Window: cfg.QuotaWindow, WarnRatio: 0.8, Services: limits}, notifier, "tenant",
+		func(name string) string { return name })
+	return t
+}
+
+// Start reloads service ownership every refresh interval until the
+// context is cancelled, picking up claims and assignments made on other
+// instances
+func (t *Tenancy) Start(ctx context.Context) {
+	ticker := time.NewTicker(t.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := t.Refresh(ctx); err != nil {
+			t.logger.Error("Failed to refresh service ownership", zap.Error(err))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Refresh reloads service ownership
+func (t *Tenancy) Refresh(ctx context.Context) error {
+	cursor, err := t.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return fmt.Errorf("failed to load service ownership: %w", err)
+	}
+	var stored []models.TenantService
+	if err := cursor.All(ctx, &stored); err != nil {
+		return fmt.Errorf("failed to decode service ownership: %w", err)
+	}
+
+	owners := make(map[string]models.TenantService, len(stored))
+	for _, s := range stored {
+		owners[s.Collection] = s
+	}
+	t.mu.Lock()
+	t.owners = owners
+	t.mu.Unlock()
+	return nil
+}
+
+// IsAdmin reports whether a tenant may use every service and the admin
+// APIs
+func (t *Tenancy) IsAdmin(tenant string) bool {
+	return t.admins[tenant]
+}
+
+// certTenant returns the tenant mapped to the first organizational unit
+// of the request's verified client certificate that maps to one
+func (t *Tenancy) certTenant(r *http.Request) (string, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return "", false
+	}
+	for _, ou := range r.TLS.VerifiedChains[0][0].Subject.OrganizationalUnit {
+		if tenant, ok := t.byOU[ou]; ok {
+			return tenant, true
+		}
+	}
+	return "", false
+}
+
+// apiKey returns the ID and tenant of an API key, comparing every key in
+// constant time
+func (t *Tenancy) apiKey(raw string) (string, string, bool) {
+	var id, tenant string
+	found := false
+	for _, k := range t.keys {
+		if subtle.ConstantTimeCompare(k.key, []byte(raw)) == 1 {
+			id, tenant, found = k.id, k.tenant, true
+		}
+	}
+	return id, tenant, found
+}
+
+// cachedOwner returns a collection's owner if it is known locally
+func (t *Tenancy) cachedOwner(collName string) (string, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	owner, ok := t.owners[collName]
+	return owner.Tenant, ok
+}
+
+// setOwner records a collection's ownership locally
+func (t *Tenancy) setOwner(collName string, owner models.TenantService) {
+	t.mu.Lock()
+	t.owners[collName] = owner
+	t.mu.Unlock()
+}
+
+// Owner returns the tenant owning a service, empty when unowned
+func (t *Tenancy) Owner(ctx context.Context, service string) (string, error) {
+	return t.ownerOf(ctx, t.storage.CollectionFor(service))
+}
+
+// ownerOf returns the tenant owning a collection, checking MongoDB for
+// collections not yet known locally
+func (t *Tenancy) ownerOf(ctx context.Context, collName string) (string, error) {
+	if owner, ok := t.cachedOwner(collName); ok {
+		return owner, nil
+	}
+
+	var stored models.TenantService
+	err := t.collection.FindOne(ctx, bson.M{"_id": collName}).Decode(&stored)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return "", fmt.Errorf("failed to look up service owner: %w", err)
+	}
+	t.setOwner(collName, stored)
+	return stored.Tenant, nil
+}
+
+// CanRead reports whether a tenant may read a log collection or one of
+// its partitions
+func (t *Tenancy) CanRead(ctx context.Context, tenant, collName string) bool {
+	if t.IsAdmin(tenant) {
+		return true
+	}
+	if base, _, _, ok := parsePartition(collName); ok {
+		collName = base
+	}
+	owner, err := t.ownerOf(ctx, collName)
+	return err == nil && owner == tenant
+}
+
+// Claim returns the tenant owning a service, first making the sending
+// tenant its owner when the service is unowned. Admin tenants and senders
+// without a tenant never claim services.
+func (t *Tenancy) Claim(ctx context.Context, service, tenant, sender string) (string, error) {
+	collName := t.storage.CollectionFor(service)
+	owner, err := t.ownerOf(ctx, collName)
+	if err != nil || owner != "" || tenant == "" || t.IsAdmin(tenant) {
+		return owner, err
+	}
+
+	claim := models.TenantService{
+		Collection: collName,
+		Service:    service,
+		Tenant:     tenant,
+		ClaimedBy:  sender,
+		ClaimedAt:  time.Now(),
+	}
+	_, err = t.collection.InsertOne(ctx, claim)
+	if mongo.IsDuplicateKeyError(err) {
+		// Another instance claimed it first
+		t.mu.Lock()
+		delete(t.owners, collName)
+		t.mu.Unlock()
+		return t.ownerOf(ctx, collName)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to claim service: %w", err)
+	}
+
+	t.setOwner(collName, claim)
+	t.logger.Info("Tenant claimed service",
+		zap.String("tenant", tenant),
+		zap.String("service", service),
+		zap.String("sender", sender))
+	return tenant, nil
+}
+
+// Assign makes a tenant the owner of a service, replacing any owner, and
+// applies the tenant's retention to the service's collection
+func (t *Tenancy) Assign(ctx context.Context, service, tenant, assignedBy string) error {
+	if _, ok := t.tenants[tenant]; !ok {
+		return errUnknownTenant
+	}
+	collName := t.storage.CollectionFor(service)
+	assignment := models.TenantService{
+		Collection: collName,
+		Service:    service,
+		Tenant:     tenant,
+		ClaimedBy:  assignedBy,
+		ClaimedAt:  time.Now(),
+	}
+	_, err := t.collection.ReplaceOne(ctx, bson.M{"_id": collName}, assignment, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to assign service: %w", err)
+	}
+	t.setOwner(collName, assignment)
+	return t.storage.applyRetention(ctx, collName, t.storage.RetentionFor(service).TTLDays)
+}
+
+// Unassign leaves a service unowned, so only admins can reach it until a
+// tenant sends it entries again
+func (t *Tenancy) Unassign(ctx context.Context, service string) error {
+	collName := t.storage.CollectionFor(service)
+	if _, err := t.collection.DeleteOne(ctx, bson.M{"_id": collName}); err != nil {
+		return fmt.Errorf("failed to unassign service: %w", err)
+	}
+	t.setOwner(collName, models.TenantService{Collection: collName})
+	return t.storage.applyRetention(ctx, collName, t.storage.RetentionFor(service).TTLDays)
+}
+
+// CheckQuota reports whether a batch fits in its tenant's quota
+func (t *Tenancy) CheckQuota(tenant string, entries int) QuotaStatus {
+	return t.quotas.Check(tenant, entries)
+}
+
+// ChargeQuota counts an accepted batch against its tenant's quota
+func (t *Tenancy) ChargeQuota(tenant string, entries int) {
+	t.quotas.Charge(tenant, entries)
+}
+
+// RetentionFor returns the retention of the tenant owning a collection,
+// if it sets one
+func (t *Tenancy) RetentionFor(collName string) (int, bool) {
+	owner, ok := t.cachedOwner(collName)
+	if !ok || owner == "" {
+		return 0, false
+	}
+	ttlDays := t.tenants[owner].TTLDays
+	return ttlDays, ttlDays > 0
+}
+
+// List returns each tenant with the services it owns and its quota usage
+func (t *Tenancy) List() []models.TenantInfo {
+	services := make(map[string][]string)
+	t.mu.RLock()
+	for _, owner := range t.owners {
+		if owner.Tenant != "" {
+			services[owner.Tenant] = append(services[owner.Tenant], owner.Service)
+		}
+	}
+	t.mu.RUnlock()
+
+	infos := make([]models.TenantInfo, 0, len(t.tenants))
+	for name, tenant := range t.tenants {
+		owned := services[name]
+		if owned == nil {
+			owned = []string{}
+		}
+		sort.Strings(owned)
+		infos = append(infos, models.TenantInfo{
+			Name:       name,
+			Admin:      t.admins[name],
+			Services:   owned,
+			TTLDays:    tenant.TTLDays,
+			QuotaLimit: tenant.Quota,
+			QuotaUsed:  t.quotas.Usage(name),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// requestTenant returns the tenant a request acts for, empty when tenancy
+// is disabled or the request was let through on an access token
+func requestTenant(r *http.Request) string {
+	tenant, _ := r.Context().Value(tenantContextKey{}).(string)
+	return tenant
+}
+
+// APIKeyMiddleware verifies tenant API keys, letting their holders through
+// the certificate checks that follow
+func APIKeyMiddleware(tenancy *Tenancy, logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			raw := r.Header.Get(apiKeyHeader)
+			if raw == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			id, tenant, ok := tenancy.apiKey(raw)
+			if !ok {
+				logger.Warn("Rejected API key", zap.String("remote_addr", r.RemoteAddr))
+				writeError(w, http.StatusUnauthorized, "Invalid API key")
+				return
+			}
+			ctx := context.WithValue(r.Context(), apiKeyContextKey{}, id)
+			ctx = context.WithValue(ctx, tenantContextKey{}, tenant)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// TenantMiddleware resolves the tenant a request acts for, from its API
+// key or client certificate OU, and confines tenants other than admins to
+// their own services. The admin APIs are left to admin tenants and to
+// callers admitted by admin.token or admin.clients.
+func TenantMiddleware(tenancy *Tenancy, logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if admin, _ := r.Context().Value(adminContextKey{}).(bool); admin {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			tenant := requestTenant(r)
+			if tenant == "" {
+				var ok bool
+				if tenant, ok = tenancy.certTenant(r); !ok {
+					// Access tokens are scoped by the admins who issue them
+					if _, token := r.Context().Value(tokenContextKey{}).(*models.AccessToken); token {
+						next.ServeHTTP(w, r)
+						return
+					}
+					logger.Warn("Request from client without a tenant",
+						zap.String("identity", clientIdentity(r)),
+						zap.String("path", r.URL.Path))
+					writeError(w, http.StatusForbidden, "Client is not mapped to a tenant")
+					return
+				}
+				r = r.WithContext(context.WithValue(r.Context(), tenantContextKey{}, tenant))
+			}
+
+			if !tenancy.IsAdmin(tenant) {
+				if strings.HasPrefix(r.URL.Path, "/v1/admin/") {
+					writeError(w, http.StatusForbidden, "Admin APIs require an admin tenant")
+					return
+				}
+				if service := r.URL.Query().Get("service"); service != "" {
+					owner, err := tenancy.Owner(r.Context(), service)
+					if err != nil {
+						logger.Error("Failed to check service owner", zap.String("service", service), zap.Error(err))
+						writeError(w, http.StatusInternalServerError, "Internal server error")
+						return
+					}
+					if owner != tenant {
+						writeErrorCode(w, http.StatusForbidden, models.ErrCodeWrongTenant, "Service is not owned by this tenant")
+						return
+					}
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
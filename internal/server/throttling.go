@@ -0,0 +1,137 @@
+package server
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/models"
+)
+
+// IngestThrottle samples and rate limits ingested entries per service, so
+// one chatty service cannot use up the storage budget
+type IngestThrottle struct {
+	defaults config.ServiceThrottleConfig
+	services map[string]config.ServiceThrottleConfig
+
+	mu    sync.Mutex
+	state map[string]*serviceThrottle
+}
+
+// serviceThrottle tracks a service's token bucket and counters
+type serviceThrottle struct {
+	tokens           float64
+	last             time.Time
+	sampled          int64
+	throttled        int64
+	throttledBatches int64
+}
+
+// NewIngestThrottle creates a new ingest throttle
+func NewIngestThrottle(cfg config.ThrottlingConfig) *IngestThrottle {
+	return &IngestThrottle{
+		defaults: cfg.Default,
+		services: cfg.Services,
+		state:    make(map[string]*serviceThrottle),
+	}
+}
+
+// configFor returns a service's settings. Service keys are matched
+// case-insensitively since the config loader lowercases them.
+func (t *IngestThrottle) configFor(service string) config.ServiceThrottleConfig {
+	if cfg, ok := t.services[strings.ToLower(service)]; ok {
+		return cfg
+	}
+	return t.defaults
+}
+
+// stateFor returns a service's state, creating it with a full bucket.
+// Callers must hold t.mu.
+func (t *IngestThrottle) stateFor(service string, cfg config.ServiceThrottleConfig) *serviceThrottle {
+	s, ok := t.state[service]
+	if !ok {
+		s = &serviceThrottle{tokens: float64(cfg.Burst), last: time.Now()}
+		t.state[service] = s
+	}
+	return s
+}
+
+// Sample keeps 1 in N entries of each sampled level and returns how many
+// were dropped
+func (t *IngestThrottle) Sample(batch *models.LogBatch) int {
+	cfg := t.configFor(batch.ServiceName)
+	if len(cfg.Sample) == 0 {
+		return 0
+	}
+
+	kept := batch.Entries[:0]
+	for _, entry := range batch.Entries {
+		if n := cfg.Sample[entry.Level]; n <= 1 || rand.Intn(n) == 0 {
+			kept = append(kept, entry)
+		}
+	}
+	dropped := len(batch.Entries) - len(kept)
+	batch.Entries = kept
+
+	if dropped > 0 {
+		t.mu.Lock()
+		t.stateFor(batch.ServiceName, cfg).sampled += int64(dropped)
+		t.mu.Unlock()
+	}
+	return dropped
+}
+
+// Allow takes a batch's entries from the service's rate allowance. When
+// the allowance is short, the batch is rejected and not counted, and Allow
+// returns how long until it would be accepted. Batches larger than the
+// burst are accepted once the bucket is full, borrowing against later
+// allowance.
+func (t *IngestThrottle) Allow(service string, entries int) (time.Duration, bool) {
+	cfg := t.configFor(service)
+	if cfg.EntriesPerSecond <= 0 || entries == 0 {
+		return 0, true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := t.stateFor(service, cfg)
+	now := time.Now()
+	s.tokens = min(s.tokens+now.Sub(s.last).Seconds()*cfg.EntriesPerSecond, float64(cfg.Burst))
+	s.last = now
+
+	need := min(float64(entries), float64(cfg.Burst))
+	if s.tokens < need {
+		s.throttled += int64(entries)
+		s.throttledBatches++
+		return time.Duration((need - s.tokens) / cfg.EntriesPerSecond * float64(time.Second)), false
+	}
+	s.tokens -= float64(entries)
+	return 0, true
+}
+
+// Status returns sampling and throttling counters for each service that
+// has been sampled or rate limited
+func (t *IngestThrottle) Status() []models.ServiceThrottleStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	statuses := make([]models.ServiceThrottleStatus, 0, len(t.state))
+	for service, s := range t.state {
+		cfg := t.configFor(service)
+		statuses = append(statuses, models.ServiceThrottleStatus{
+			Service:          service,
+			EntriesPerSecond: cfg.EntriesPerSecond,
+			Burst:            cfg.Burst,
+			Sample:           cfg.Sample,
+			Sampled:          s.sampled,
+			Throttled:        s.throttled,
+			ThrottledBatches: s.throttledBatches,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Service < statuses[j].Service })
+	return statuses
+}
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/oicur0t/logl/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// Token scopes
+const (
+	TokenScopeService = "service"
+	TokenScopeQuery   = "query"
+)
+
+// tokenClaims is the signed payload of an access token
+type tokenClaims struct {
+	ID     string `json:"id"`
+	Scope  string `json:"scope"`
+	Target string `json:"target"`
+	Expiry int64  `json:"exp"`
+}
+
+// TokenManager issues, verifies, and revokes signed read-only access tokens
+type TokenManager struct {
+	secret     []byte
+	maxTTL     time.Duration
+	collection *mongo.Collection
+	logger     *zap.Logger
+}
+
+// NewTokenManager creates a new token manager
+func NewTokenManager(storage *Storage, secret string, collection string, maxTTL time.Duration, logger *zap.Logger) *TokenManager {
+	return &TokenManager{
+		secret:     []byte(secret),
+		maxTTL:     maxTTL,
+		collection: storage.database.Collection(collection),
+		logger:     logger,
+	}
+}
+
+// Issue creates and records a new token
+func (m *TokenManager) Issue(ctx context.Context, scope, target string, ttl time.Duration, createdBy string) (string, models.AccessToken, error) {
+	if scope != TokenScopeService && scope != TokenScopeQuery {
+		return "", models.AccessToken{}, fmt.Errorf("scope must be %s or %s", TokenScopeService, TokenScopeQuery)
+	}
+	if target == "" {
+		return "", models.AccessToken{}, fmt.Errorf("target is required")
+	}
+	if ttl <= 0 || ttl > m.maxTTL {
+		return "", models.AccessToken{}, fmt.Errorf("ttl must be between 0 and %s", m.maxTTL)
+	}
+
+	now := time.Now()
+	record := models.AccessToken{
+		ID:        primitive.NewObjectID().Hex(),
+		Scope:     scope,
+		Target:    target,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+		CreatedBy: createdBy,
+	}
+
+	token, err := m.sign(tokenClaims{
+		ID:     record.ID,
+		Scope:  record.Scope,
+		Target: record.Target,
+		Expiry: record.ExpiresAt.Unix(),
+	})
+	if err != nil {
+		return "", models.AccessToken{}, err
+	}
+
+	if _, err := m.collection.InsertOne(ctx, record); err != nil {
+		return "", models.AccessToken{}, fmt.Errorf("failed to record token: %w", err)
+	}
+
+	return token, record, nil
+}
+
+// Verify checks a token's signature, expiry, and revocation status
+func (m *TokenManager) Verify(ctx context.Context, token string) (*models.AccessToken, error) {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	expected := m.mac(payload)
+	given, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(given, expected) {
+		return nil, fmt.Errorf("invalid token signature")
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, fmt.Errorf("malformed token")
+	}
+	var claims tokenClaims
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	if time.Now().Unix() >= claims.Expiry {
+		return nil, fmt.Errorf("token expired")
+	}
+
+	// Check revocation against the shared collection so every server agrees
+	var record models.AccessToken
+	if err := m.collection.FindOne(ctx, bson.M{"_id": claims.ID}).Decode(&record); err != nil {
+		return nil, fmt.Errorf("unknown token")
+	}
+	if record.Revoked {
+		return nil, fmt.Errorf("token revoked")
+	}
+
+	return &record, nil
+}
+
+// Revoke marks a token as revoked
+func (m *TokenManager) Revoke(ctx context.Context, id string) error {
+	result, err := m.collection.UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"revoked": true, "revoked_at": time.Now()}})
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("token not found")
+	}
+	return nil
+}
+
+// List returns all recorded tokens, newest first
+func (m *TokenManager) List(ctx context.Context) ([]models.AccessToken, error) {
+	cursor, err := m.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tokens: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	tokens := make([]models.AccessToken, 0)
+	if err := cursor.All(ctx, &tokens); err != nil {
+		return nil, fmt.Errorf("failed to decode tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+// sign encodes and signs claims
+func (m *TokenManager) sign(claims tokenClaims) (string, error) {
+	raw, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode token: %w", err)
+	}
+	payload := base64.RawURLEncoding.EncodeToString(raw)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(m.mac(payload)), nil
+}
+
+// mac computes the HMAC-SHA256 of a payload
+func (m *TokenManager) mac(payload string) []byte {
+	h := hmac.New(sha256.New, m.secret)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
+
+// tokenAllows reports whether a token grants access to a read request
+func tokenAllows(token *models.AccessToken, r *http.Request) bool {
+	switch token.Scope {
+	case TokenScopeService:
+		return r.URL.Path != "/v1/logs/saved" && strings.EqualFold(r.URL.Query().Get("service"), token.Target)
+	case TokenScopeQuery:
+		return r.URL.Path == "/v1/logs/saved" && r.URL.Query().Get("id") == token.Target
+	default:
+		return false
+	}
+}
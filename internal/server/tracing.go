@@ -0,0 +1,119 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+// TraceContext identifies the span that produced an ingest request
+type TraceContext struct {
+	TraceID string
+	SpanID  string
+}
+
+// traceContextFromHeaders reads W3C traceparent, falling back to B3
+// (single or multi header). It reports false when no valid context is present.
+func traceContextFromHeaders(h http.Header) (TraceContext, bool) {
+	// traceparent: version-traceid-spanid-flags
+	if v := h.Get("Traceparent"); v != "" {
+		parts := strings.Split(strings.TrimSpace(v), "-")
+		if len(parts) >= 4 && len(parts[0]) == 2 && parts[0] != "ff" &&
+			validTraceID(parts[1], 32) && validTraceID(parts[2], 16) {
+			return TraceContext{TraceID: parts[1], SpanID: parts[2]}, true
+		}
+	}
+
+	// b3: traceid-spanid[-sampled[-parentspanid]]
+	if v := h.Get("B3"); v != "" {
+		parts := strings.Split(strings.TrimSpace(v), "-")
+		if len(parts) >= 2 && validB3TraceID(parts[0]) && validTraceID(parts[1], 16) {
+			return TraceContext{TraceID: padTraceID(parts[0]), SpanID: parts[1]}, true
+		}
+	}
+
+	traceID, spanID := h.Get("X-B3-Traceid"), h.Get("X-B3-Spanid")
+	if validB3TraceID(traceID) && validTraceID(spanID, 16) {
+		return TraceContext{TraceID: padTraceID(traceID), SpanID: spanID}, true
+	}
+
+	return TraceContext{}, false
+}
+
+// Parsed fields holding trace and span IDs, covering OTel (trace_id,
+// traceId), ECS (trace.id), and the log4j/logback OTel appenders
+var (
+	traceIDFields = []string{"trace_id", "traceId", "traceID", "trace.id", "otelTraceID"}
+	spanIDFields  = []string{"span_id", "spanId", "spanID", "span.id", "otelSpanID"}
+)
+
+// traceContextFromParsed reads trace and span IDs from parsed fields. It
+// reports false when no valid trace ID is present.
+func traceContextFromParsed(parsed map[string]interface{}) (TraceContext, bool) {
+	if parsed == nil {
+		return TraceContext{}, false
+	}
+
+	var tc TraceContext
+	for _, field := range traceIDFields {
+		if v, ok := parsedString(parsed, field); ok {
+			if id := strings.ToLower(strings.TrimSpace(v)); validB3TraceID(id) {
+				tc.TraceID = padTraceID(id)
+				break
+			}
+		}
+	}
+	if tc.TraceID == "" {
+		return TraceContext{}, false
+	}
+
+	for _, field := range spanIDFields {
+		if v, ok := parsedString(parsed, field); ok {
+			if id := strings.ToLower(strings.TrimSpace(v)); validTraceID(id, 16) {
+				tc.SpanID = id
+				break
+			}
+		}
+	}
+	return tc, true
+}
+
+// parsedString reads a string field, accepting flat dotted keys (as ECS
+// loggers emit) as well as nested objects
+func parsedString(parsed map[string]interface{}, field string) (string, bool) {
+	if v, ok := parsed[field].(string); ok {
+		return v, true
+	}
+	v, ok := lookupParsed(parsed, field).(string)
+	return v, ok
+}
+
+// validB3TraceID accepts 64- or 128-bit B3 trace IDs
+func validB3TraceID(id string) bool {
+	return validTraceID(id, 16) || validTraceID(id, 32)
+}
+
+// validTraceID checks for a non-zero lowercase hex ID of the given length
+func validTraceID(id string, length int) bool {
+	if len(id) != length {
+		return false
+	}
+	nonZero := false
+	for _, c := range id {
+		switch {
+		case c == '0':
+		case c >= '1' && c <= '9', c >= 'a' && c <= 'f':
+			nonZero = true
+		default:
+			return false
+		}
+	}
+	return nonZero
+}
+
+// padTraceID widens 64-bit B3 trace IDs to the 128-bit W3C form
+func padTraceID(id string) string {
+	if len(id) == 16 {
+		return strings.Repeat("0", 16) + id
+	}
+	return id
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"crypto/sha256"
+	_ "embed"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// uiPage is the log browser served at /ui. Its script and styles are
+// inline so the page is one request, which token holders can make with
+// the token in the URL.
+//
+//go:embed ui/index.html
+var uiPage []byte
+
+// uiCSP allows only the page's own inline script and styles, by hash, and
+// requests back to this server
+var uiCSP = fmt.Sprintf("default-src 'none'; script-src %s; style-src %s; connect-src 'self'; img-src 'self'; base-uri 'none'; form-action 'none'; frame-ancestors 'none'",
+	inlineHash(string(uiPage), "script"), inlineHash(string(uiPage), "style"))
+
+// inlineHash returns the CSP source for the contents of a page's first
+// inline element with the given tag
+func inlineHash(page, tag string) string {
+	start := strings.Index(page, "<"+tag+">")
+	end := strings.Index(page, "</"+tag+">")
+	if start < 0 || end < start {
+		return "'none'"
+	}
+	sum := sha256.Sum256([]byte(page[start+len(tag)+2 : end]))
+	return "'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'"
+}
+
+// UI serves the embedded log browser. It calls the query and live tail
+// endpoints, so it is protected the same way they are.
+func (h *Handler) UI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if r.URL.Path != "/ui" && r.URL.Path != "/ui/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", uiCSP)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(uiPage)
+}
@@ -0,0 +1,324 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oicur0t/logl/internal/config"
+	"github.com/oicur0t/logl/pkg/models"
+	"go.uber.org/zap"
+)
+
+// ErrBufferFull is returned when a batch can't be buffered in memory or on disk
+var ErrBufferFull = errors.New("write buffer is full")
+
+// spillSuffix names batch files in the spill directory
+const spillSuffix = ".batch.json"
+
+// bufferedBatch is a batch held in memory with the time it was accepted
+type bufferedBatch struct {
+	batch      models.LogBatch
+	acceptedAt time.Time
+}
+
+// WriteBuffer holds acknowledged batches while MongoDB is unavailable and
+// writes them, oldest first, once it recovers. Batches beyond the memory
+// limit spill to disk, and spilled batches survive restarts. While the
+// buffer is non-empty new batches queue behind it, so ingest stays fast
+// and ordered during an outage.
+type WriteBuffer struct {
+	storage       *Storage
+	maxBatches    int
+	spillDir      string // empty disables spilling
+	maxSpillBytes int64
+	retryInterval time.Duration
+	insertTimeout time.Duration
+	logger        *zap.Logger
+
+	mu         sync.Mutex
+	memory     []bufferedBatch
+	spilled    []string // spill files, oldest first
+	spillBytes int64
+	spillSeq   int64
+	wake       chan struct{}
+}
+
+// NewWriteBuffer creates a write buffer, recovering batches spilled by a
+// previous run
+func NewWriteBuffer(storage *Storage, cfg config.WriteBufferConfig, logger *zap.Logger) (*WriteBuffer, error) {
+	b := &WriteBuffer{
+		storage:       storage,
+		maxBatches:    cfg.MaxBatches,
+		spillDir:      cfg.SpillDir,
+		maxSpillBytes: cfg.MaxSpillBytes,
+		retryInterval: cfg.RetryInterval,
+		insertTimeout: cfg.InsertTimeout,
+		logger:        logger,
+		wake:          make(chan struct{}, 1),
+	}
+
+	if b.spillDir != "" {
+		if err := os.MkdirAll(b.spillDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create spill directory: %w", err)
+		}
+		if err := b.recover(); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// recover picks up spill files left by a previous run
+func (b *WriteBuffer) recover() error {
+	entries, err := os.ReadDir(b.spillDir)
+	if err != nil {
+		return fmt.Errorf("failed to read spill directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !strings.HasSuffix(entry.Name(), spillSuffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		b.spilled = append(b.spilled, filepath.Join(b.spillDir, entry.Name()))
+		b.spillBytes += info.Size()
+	}
+	// Names start with a zero-padded timestamp, so they sort oldest first
+	sort.Strings(b.spilled)
+
+	if len(b.spilled) > 0 {
+		b.logger.Info("Recovered spilled batches",
+			zap.Int("batches", len(b.spilled)),
+			zap.Int64("bytes", b.spillBytes))
+	}
+	return nil
+}
+
+// Active reports whether batches are waiting, in which case new batches
+// must be buffered too rather than inserted directly
+func (b *WriteBuffer) Active() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.memory) > 0 || len(b.spilled) > 0
+}
+
+// Pending returns the number of buffered batches in memory and on disk
+func (b *WriteBuffer) Pending() (memory, spilled int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.memory), len(b.spilled)
+}
+
+// Enqueue buffers a batch for a later write
+func (b *WriteBuffer) Enqueue(batch models.LogBatch) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Once spilling has started, later batches go to disk to keep order
+	now := time.Now()
+	if len(b.spilled) == 0 && len(b.memory) < b.maxBatches {
+		b.memory = append(b.memory, bufferedBatch{batch: batch, acceptedAt: now})
+	} else if err := b.spill(batch, now); err != nil {
+		return err
+	}
+
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// spill writes a batch to the spill directory, named by when it was
+// accepted so files sort oldest first. Callers hold b.mu.
+func (b *WriteBuffer) spill(batch models.LogBatch, acceptedAt time.Time) error {
+	if b.spillDir == "" {
+		return ErrBufferFull
+	}
+
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("failed to marshal batch: %w", err)
+	}
+	if b.maxSpillBytes > 0 && b.spillBytes+int64(len(data)) > b.maxSpillBytes {
+		return ErrBufferFull
+	}
+
+	b.spillSeq++
+	path := filepath.Join(b.spillDir, fmt.Sprintf("%020d-%06d%s", acceptedAt.UnixNano(), b.spillSeq%1000000, spillSuffix))
+	if err := writeSpillFile(path, data); err != nil {
+		return fmt.Errorf("failed to spill batch: %w", err)
+	}
+
+	b.spilled = append(b.spilled, path)
+	b.spillBytes += int64(len(data))
+	return nil
+}
+
+// writeSpillFile writes a spill file atomically and syncs it, so a batch
+// acknowledged to its client survives a crash
+func writeSpillFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	// Persist the rename; directories can't be synced on Windows
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// Start writes buffered batches until the context is cancelled. Batches
+// still in memory at shutdown are spilled to disk when spilling is enabled.
+func (b *WriteBuffer) Start(ctx context.Context) {
+	for {
+		if !b.drain(ctx) {
+			// MongoDB still unavailable; wait before retrying the head batch
+			select {
+			case <-time.After(b.retryInterval):
+			case <-ctx.Done():
+				b.persist()
+				return
+			}
+			continue
+		}
+
+		select {
+		case <-b.wake:
+		case <-ctx.Done():
+			b.persist()
+			return
+		}
+	}
+}
+
+// drain writes batches oldest first, reporting false if a write failed
+func (b *WriteBuffer) drain(ctx context.Context) bool {
+	for ctx.Err() == nil {
+		batch, path, ok := b.head()
+		if !ok {
+			return true
+		}
+
+		insertCtx, cancel := context.WithTimeout(ctx, b.insertTimeout)
+		err := b.storage.InsertBatch(insertCtx, batch)
+		cancel()
+		if err != nil {
+			b.logger.Warn("Buffered batch write failed, will retry",
+				zap.String("service", batch.ServiceName),
+				zap.Error(err))
+			return false
+		}
+
+		b.pop(path)
+	}
+	return false
+}
+
+// head returns the oldest buffered batch and, if it was spilled, its file
+func (b *WriteBuffer) head() (models.LogBatch, string, bool) {
+	b.mu.Lock()
+	if len(b.memory) > 0 {
+		batch := b.memory[0].batch
+		b.mu.Unlock()
+		return batch, "", true
+	}
+	if len(b.spilled) == 0 {
+		b.mu.Unlock()
+		return models.LogBatch{}, "", false
+	}
+	path := b.spilled[0]
+	b.mu.Unlock()
+
+	var batch models.LogBatch
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &batch)
+	}
+	if err != nil {
+		// A corrupt file would block the buffer forever; set it aside
+		b.logger.Error("Discarding unreadable spilled batch", zap.String("path", path), zap.Error(err))
+		os.Rename(path, path+".corrupt")
+		b.pop(path)
+		return b.head()
+	}
+	return batch, path, true
+}
+
+// pop removes the oldest batch after it was written
+func (b *WriteBuffer) pop(path string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if path == "" {
+		b.memory = b.memory[1:]
+		return
+	}
+
+	if info, err := os.Stat(path); err == nil {
+		b.spillBytes -= info.Size()
+	}
+	os.Remove(path)
+	b.spilled = b.spilled[1:]
+}
+
+// persist spills batches still in memory so they survive the restart
+func (b *WriteBuffer) persist() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.memory) == 0 {
+		return
+	}
+	if b.spillDir == "" {
+		b.logger.Error("Discarding buffered batches on shutdown; set write_buffer.spill_dir to keep them",
+			zap.Int("batches", len(b.memory)))
+		return
+	}
+
+	// Memory batches are older than anything already spilled, so they go
+	// to the front of the queue (and sort first by name on recovery)
+	spilled := b.spilled
+	b.spilled = nil
+	for _, buffered := range b.memory {
+		if err := b.spill(buffered.batch, buffered.acceptedAt); err != nil {
+			b.logger.Error("Failed to spill buffered batch on shutdown", zap.Error(err))
+		}
+	}
+	b.spilled = append(b.spilled, spilled...)
+	b.memory = nil
+	b.logger.Info("Spilled buffered batches for the next start", zap.Int("batches", len(b.spilled)))
+}
@@ -0,0 +1,85 @@
+package tailer
+
+import (
+	"context"
+	"sync"
+
+	"github.com/oicur0t/logl/pkg/models"
+)
+
+// Backpressure policies, deciding what file reads do when the batcher
+// falls behind
+const (
+	BackpressureBlock      = "block"       // Stop reading; lines wait in the file until the batcher catches up
+	BackpressureDropNewest = "drop_newest" // Drop the line after waiting the backpressure timeout
+	BackpressureDropOldest = "drop_oldest" // Queue the line, dropping the oldest queued line when the queue is full
+)
+
+// dropQueue holds entries from drop_oldest files and feeds them to the
+// batcher in order. When it is full the oldest entry makes room.
+type dropQueue struct {
+	mu      sync.Mutex
+	entries []models.LogEntry
+	size    int
+	ready   chan struct{} // Signalled when entries are pushed
+}
+
+// newDropQueue creates a queue holding up to size entries
+func newDropQueue(size int) *dropQueue {
+	return &dropQueue{
+		entries: make([]models.LogEntry, 0, size),
+		size:    size,
+		ready:   make(chan struct{}, 1),
+	}
+}
+
+// push queues an entry, returning the entry dropped to make room, if any
+func (q *dropQueue) push(entry models.LogEntry) (models.LogEntry, bool) {
+	q.mu.Lock()
+	var dropped models.LogEntry
+	full := len(q.entries) >= q.size
+	if full {
+		dropped = q.entries[0]
+		q.entries = q.entries[1:]
+	}
+	q.entries = append(q.entries, entry)
+	q.mu.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return dropped, full
+}
+
+// pop removes the oldest entry
+func (q *dropQueue) pop() (models.LogEntry, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.entries) == 0 {
+		return models.LogEntry{}, false
+	}
+	entry := q.entries[0]
+	q.entries = q.entries[1:]
+	return entry, true
+}
+
+// run sends queued entries to out until the context is cancelled
+func (q *dropQueue) run(ctx context.Context, out chan<- models.LogEntry) {
+	for {
+		entry, ok := q.pop()
+		if !ok {
+			select {
+			case <-q.ready:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		select {
+		case out <- entry:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -2,6 +2,10 @@ package tailer
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"sync"
 	"time"
 
@@ -9,17 +13,40 @@ import (
 	"go.uber.org/zap"
 )
 
-// Batcher accumulates log entries and sends them in batches
+// Batcher accumulates log entries and sends them in batches. Sends run on
+// a bounded pool of workers, one batch per service at a time, so a slow
+// upstream call for one service doesn't hold up the others or the intake
+// loop.
 type Batcher struct {
-	serviceName string // Default service name for logging only
-	maxSize     int
-	maxWait     time.Duration
-	logger      *zap.Logger
-	sender      BatchSender
+	serviceName  string // Default service name for logging only
+	maxSize      int
+	maxBytes     int // Encoded size past which a batch is sent; 0 is unlimited
+	maxWait      time.Duration
+	drainTimeout time.Duration // How long the final flush may take
+	maxPending   int           // Entries buffered per service while its last batch is sent
+	logger       *zap.Logger
+	sender       BatchSender
+	processors   []Processor
+	preParsed    bool        // Entries are parsed by a ParseProcessor
+	deadLetter   *DeadLetter // Receives batches that could not be delivered, if set
+
+	// Delivery tracking
+	agentID   string
+	sessionID string
+	sequence  uint64
 
 	lineChan chan models.LogEntry
+	workers  chan struct{} // Semaphore bounding concurrent sends
+	sends    sync.WaitGroup
 	mu       sync.Mutex
 	batches  map[string][]models.LogEntry // service name -> entries
+	sizes    map[string][]int             // service name -> encoded size of each entry
+	bytes    map[string]int               // service name -> encoded size of its entries
+	since    map[string]time.Time         // service name -> when its oldest buffered entry arrived
+	inFlight map[string]bool              // services with a batch being sent
+	dropped  map[string]int               // entries dropped over maxPending, by service
+	sendErr  error                        // first send error since the last drain
+	rearm    chan struct{}                // Signalled when a send leaves entries waiting on maxWait
 }
 
 // BatchSender is an interface for sending log batches
@@ -27,117 +54,398 @@ type BatchSender interface {
 	SendBatch(ctx context.Context, batch models.LogBatch) error
 }
 
-// NewBatcher creates a new log batcher
-func NewBatcher(serviceName string, maxSize int, maxWait time.Duration, queueSize int, logger *zap.Logger, sender BatchSender) *Batcher {
+// NewBatcher creates a new log batcher. Processors run in order on every
+// entry before it is added to a batch. Batches are numbered per batcher
+// under agentID and a random session ID.
+func NewBatcher(serviceName, agentID string, maxSize int, maxWait time.Duration, queueSize int, logger *zap.Logger, sender BatchSender, processors ...Processor) *Batcher {
 	return &Batcher{
-		serviceName: serviceName,
-		maxSize:     maxSize,
-		maxWait:     maxWait,
-		logger:      logger,
-		sender:      sender,
-		lineChan:    make(chan models.LogEntry, queueSize),
-		batches:     make(map[string][]models.LogEntry),
+		serviceName:  serviceName,
+		maxSize:      maxSize,
+		maxWait:      maxWait,
+		drainTimeout: 10 * time.Second,
+		logger:       logger,
+		sender:       sender,
+		processors:   processors,
+		agentID:      agentID,
+		sessionID:    randomID(),
+		maxPending:   queueSize,
+		lineChan:     make(chan models.LogEntry, queueSize),
+		workers:      make(chan struct{}, 1),
+		batches:      make(map[string][]models.LogEntry),
+		sizes:        make(map[string][]int),
+		bytes:        make(map[string]int),
+		since:        make(map[string]time.Time),
+		rearm:        make(chan struct{}, 1),
+		inFlight:     make(map[string]bool),
+		dropped:      make(map[string]int),
 	}
 }
 
-// GetLineChan returns the channel for receiving log entries
+// SetPreParsed marks sent batches as parsed, so servers that trust this
+// tailer skip their parsing pipelines
+func (b *Batcher) SetPreParsed(preParsed bool) {
+	b.preParsed = preParsed
+}
+
+// SetDeadLetter sets where batches the server rejects, or that can't be
+// delivered before retries run out, are written. With none, they are only
+// logged.
+func (b *Batcher) SetDeadLetter(deadLetter *DeadLetter) {
+	b.deadLetter = deadLetter
+}
+
+// SetFlushWorkers sets how many batches are sent at once, and how many
+// entries a service may buffer while its last batch is sent before newer
+// ones are dropped. It must be called before Start.
+func (b *Batcher) SetFlushWorkers(workers, maxPending int) {
+	b.workers = make(chan struct{}, workers)
+	b.maxPending = maxPending
+}
+
+// SetMaxBytes sets the encoded size of a service's entries at which a
+// batch is sent before it reaches maxSize, so batches of long lines stay
+// under the server's request limit. A single larger entry is sent alone.
+// 0 sends batches by entry count only.
+func (b *Batcher) SetMaxBytes(maxBytes int) {
+	b.maxBytes = maxBytes
+}
+
+// SetDrainTimeout sets how long sends may take once Start's context is
+// cancelled before the batches still unsent are given up
+func (b *Batcher) SetDrainTimeout(timeout time.Duration) {
+	b.drainTimeout = timeout
+}
+
+// GetLineChan returns the channel for receiving log entries.
+// Closing it makes Start flush the remaining entries and return.
 func (b *Batcher) GetLineChan() chan<- models.LogEntry {
 	return b.lineChan
 }
 
-// Start begins the batching process
+// GetDeadLetter returns the dead-letter file batches fall back to, or nil
+func (b *Batcher) GetDeadLetter() *DeadLetter {
+	return b.deadLetter
+}
+
+// Start begins the batching process. Each service's batch is sent once it
+// is full or its oldest entry has waited maxWait, whichever comes first.
+// When ctx is cancelled, sends in flight carry on and the entries left,
+// including those still queued, are sent within the drain timeout.
 func (b *Batcher) Start(ctx context.Context) error {
-	ticker := time.NewTicker(b.maxWait)
-	defer ticker.Stop()
+	// Sends outlive ctx so the final flush can finish
+	sendCtx, cancelSends := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelSends()
+
+	timer := time.NewTimer(0)
+	if !timer.Stop() {
+		<-timer.C
+	}
+	defer timer.Stop()
+	var deadline time.Time // When the timer fires; zero while it is stopped
+
+	// schedule moves the timer to next if that is sooner
+	schedule := func(next time.Time) {
+		if next.IsZero() || (!deadline.IsZero() && !next.Before(deadline)) {
+			return
+		}
+		if !deadline.IsZero() && !timer.Stop() {
+			<-timer.C
+		}
+		deadline = next
+		timer.Reset(time.Until(next))
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
-			// Flush remaining entries before exiting
-			if err := b.flush(ctx); err != nil {
+			// Flush queued and buffered entries before exiting, giving up
+			// on sends still running after the drain timeout
+			stop := time.AfterFunc(b.drainTimeout, cancelSends)
+			defer stop.Stop()
+			b.logger.Info("Flushing remaining entries", zap.Duration("timeout", b.drainTimeout))
+			for queued := true; queued; {
+				select {
+				case entry, ok := <-b.lineChan:
+					if ok {
+						b.add(sendCtx, entry)
+					}
+					queued = ok
+				default:
+					queued = false
+				}
+			}
+			if err := b.drain(sendCtx); err != nil {
 				b.logger.Error("Failed to flush final batch", zap.Error(err))
 			}
 			return ctx.Err()
 
-		case entry := <-b.lineChan:
-			b.mu.Lock()
-			serviceName := entry.ServiceName
-			if _, exists := b.batches[serviceName]; !exists {
-				b.batches[serviceName] = make([]models.LogEntry, 0, b.maxSize)
+		case entry, ok := <-b.lineChan:
+			if !ok {
+				// Input finished (e.g. stdin EOF); ship what is left and stop
+				return b.drain(sendCtx)
 			}
-			b.batches[serviceName] = append(b.batches[serviceName], entry)
-			shouldFlush := len(b.batches[serviceName]) >= b.maxSize
-			b.mu.Unlock()
+			schedule(b.add(sendCtx, entry))
 
-			if shouldFlush {
-				if err := b.flushService(ctx, serviceName); err != nil {
-					b.logger.Error("Failed to flush batch", zap.Error(err), zap.String("service", serviceName))
-				}
-				ticker.Reset(b.maxWait)
-			}
+		case <-timer.C:
+			// A service's oldest entry has waited maxWait
+			deadline = time.Time{}
+			schedule(b.flushDue(sendCtx))
 
-		case <-ticker.C:
-			// Time threshold reached
-			if err := b.flush(ctx); err != nil {
-				b.logger.Error("Failed to flush batch on timer", zap.Error(err))
-			}
+		case <-b.rearm:
+			schedule(b.flushDue(sendCtx))
 		}
 	}
 }
 
-// flush sends all current batches to the server
-func (b *Batcher) flush(ctx context.Context) error {
+// add processes an entry and buffers it, sending its service's batch if
+// that is now full. It returns when the batch is due, if the entry is the
+// first one waiting.
+func (b *Batcher) add(ctx context.Context, entry models.LogEntry) time.Time {
+	if !b.process(&entry) {
+		return time.Time{}
+	}
+
 	b.mu.Lock()
-	services := make([]string, 0, len(b.batches))
+	defer b.mu.Unlock()
+	var due time.Time
+	serviceName := entry.ServiceName
+	if _, exists := b.batches[serviceName]; !exists {
+		b.batches[serviceName] = make([]models.LogEntry, 0, b.maxSize)
+	}
+	if len(b.batches[serviceName]) >= b.maxPending {
+		// The service's sends can't keep up; drop rather than stall
+		// every other service
+		b.dropped[serviceName]++
+		return due
+	}
+	b.batches[serviceName] = append(b.batches[serviceName], entry)
+	if _, waiting := b.since[serviceName]; !waiting {
+		b.since[serviceName] = time.Now()
+		due = b.since[serviceName].Add(b.maxWait)
+	}
+	if b.maxBytes > 0 {
+		size := entrySize(entry)
+		b.sizes[serviceName] = append(b.sizes[serviceName], size)
+		b.bytes[serviceName] += size
+	}
+	if b.full(serviceName) {
+		b.dispatch(ctx, serviceName)
+	}
+	return due
+}
+
+// process runs the processors over an entry, reporting whether to keep it
+func (b *Batcher) process(entry *models.LogEntry) bool {
+	for _, p := range b.processors {
+		if !p.Process(entry) {
+			return false
+		}
+	}
+	return true
+}
+
+// full reports whether a service has a full batch waiting, by entry count
+// or size. The caller must hold b.mu.
+func (b *Batcher) full(serviceName string) bool {
+	return len(b.batches[serviceName]) >= b.maxSize || (b.maxBytes > 0 && b.bytes[serviceName] >= b.maxBytes)
+}
+
+// entrySize returns an entry's encoded size in a batch
+func entrySize(entry models.LogEntry) int {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return len(entry.Line)
+	}
+	return len(data) + 1 // Separating comma
+}
+
+// flushDue starts sending the batches of services whose oldest entry has
+// waited maxWait, and returns when the next one is due, or zero if none
+// is waiting. Services with a batch being sent are left to send, which
+// signals rearm if entries remain.
+func (b *Batcher) flushDue(ctx context.Context) time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	var next time.Time
+	for serviceName, since := range b.since {
+		if b.inFlight[serviceName] {
+			continue
+		}
+		due := since.Add(b.maxWait)
+		if !due.After(now) {
+			b.dispatch(ctx, serviceName)
+		} else if next.IsZero() || due.Before(next) {
+			next = due
+		}
+	}
+	return next
+}
+
+// flush starts sending every service's batch, skipping services whose
+// last batch is still being sent
+func (b *Batcher) flush(ctx context.Context) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	for serviceName := range b.batches {
-		services = append(services, serviceName)
+		b.dispatch(ctx, serviceName)
 	}
+}
+
+// drain sends every buffered entry, waiting for sends in flight, and
+// returns the first error from the sends it made
+func (b *Batcher) drain(ctx context.Context) error {
+	b.sends.Wait()
+	b.mu.Lock()
+	b.sendErr = nil
 	b.mu.Unlock()
 
-	for _, serviceName := range services {
-		if err := b.flushService(ctx, serviceName); err != nil {
+	for {
+		b.flush(ctx)
+		b.sends.Wait()
+
+		b.mu.Lock()
+		pending := 0
+		for _, batch := range b.batches {
+			pending += len(batch)
+		}
+		err := b.sendErr
+		b.mu.Unlock()
+		if pending == 0 {
 			return err
 		}
 	}
-	return nil
 }
 
-// flushService sends the batch for a specific service to the server
-func (b *Batcher) flushService(ctx context.Context, serviceName string) error {
-	b.mu.Lock()
-	batch, exists := b.batches[serviceName]
-	if !exists || len(batch) == 0 {
-		b.mu.Unlock()
-		return nil
+// dispatch takes up to maxSize of a service's entries, and no more than
+// maxBytes of them, as a batch and sends it on a worker, unless the
+// service already has a batch being sent. The caller must hold b.mu.
+func (b *Batcher) dispatch(ctx context.Context, serviceName string) {
+	batch := b.batches[serviceName]
+	if b.inFlight[serviceName] || len(batch) == 0 {
+		return
 	}
 
-	// Create a copy of the batch for sending
+	n := min(len(batch), b.maxSize)
+	if b.maxBytes > 0 {
+		sizes := b.sizes[serviceName]
+		total := sizes[0]
+		cut := 1
+		for cut < n && total+sizes[cut] <= b.maxBytes {
+			total += sizes[cut]
+			cut++
+		}
+		n = cut
+		b.bytes[serviceName] -= total
+		b.sizes[serviceName] = sizes[:copy(sizes, sizes[n:])]
+	}
+
+	b.sequence++
 	batchToSend := models.LogBatch{
 		ServiceName: serviceName,
-		Entries:     make([]models.LogEntry, len(batch)),
+		Entries:     make([]models.LogEntry, n),
+		AgentID:     b.agentID,
+		SessionID:   b.sessionID,
+		BatchID:     randomID(),
+		Sequence:    b.sequence,
+		PreParsed:   b.preParsed,
 	}
 	copy(batchToSend.Entries, batch)
+	batchToSend.ContentHash = batchToSend.HashContent()
 
-	// Clear this service's batch
-	b.batches[serviceName] = b.batches[serviceName][:0]
-	b.mu.Unlock()
+	// Keep entries past this batch for the next one
+	remaining := copy(batch, batch[n:])
+	b.batches[serviceName] = batch[:remaining]
+	if remaining == 0 {
+		delete(b.since, serviceName)
+	}
+
+	b.inFlight[serviceName] = true
+	b.sends.Add(1)
+	go b.send(ctx, batchToSend)
+}
+
+// send sends a batch once a worker is free, then starts the service's next
+// batch if a full one is waiting, or has Start time the entries left
+func (b *Batcher) send(ctx context.Context, batch models.LogBatch) {
+	defer b.sends.Done()
 
+	b.workers <- struct{}{}
 	b.logger.Debug("Flushing batch",
-		zap.Int("size", len(batchToSend.Entries)),
-		zap.String("service", serviceName))
+		zap.Int("size", len(batch.Entries)),
+		zap.String("service", batch.ServiceName),
+		zap.Uint64("sequence", batch.Sequence))
+	err := b.sender.SendBatch(ctx, batch)
+	<-b.workers
 
-	// Send the batch
-	if err := b.sender.SendBatch(ctx, batchToSend); err != nil {
+	var rejected *RejectedError
+	if errors.As(err, &rejected) {
+		b.logger.Error("Server rejected batch",
+			zap.Int("status_code", rejected.StatusCode),
+			zap.String("code", rejected.Err.Code),
+			zap.String("message", rejected.Err.Message),
+			zap.Int("size", len(batch.Entries)),
+			zap.String("service", batch.ServiceName),
+			zap.Uint64("sequence", batch.Sequence))
+		b.writeDeadLetter(batch, err)
+	} else if err != nil {
 		b.logger.Error("Failed to send batch",
 			zap.Error(err),
-			zap.Int("size", len(batchToSend.Entries)),
-			zap.String("service", serviceName))
-		return err
+			zap.Int("size", len(batch.Entries)),
+			zap.String("service", batch.ServiceName),
+			zap.Uint64("sequence", batch.Sequence))
+		b.writeDeadLetter(batch, err)
+	} else {
+		b.logger.Info("Batch sent successfully",
+			zap.Int("size", len(batch.Entries)),
+			zap.String("service", batch.ServiceName))
 	}
 
-	b.logger.Info("Batch sent successfully",
-		zap.Int("size", len(batchToSend.Entries)),
-		zap.String("service", serviceName))
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.inFlight[batch.ServiceName] = false
+	if err != nil && b.sendErr == nil {
+		b.sendErr = err
+	}
+	if dropped := b.dropped[batch.ServiceName]; dropped > 0 {
+		b.logger.Warn("Dropped entries while waiting to send",
+			zap.String("service", batch.ServiceName),
+			zap.Int("dropped", dropped),
+			zap.Int("max_pending", b.maxPending))
+		delete(b.dropped, batch.ServiceName)
+	}
+	if b.full(batch.ServiceName) {
+		b.dispatch(ctx, batch.ServiceName)
+	} else if len(b.batches[batch.ServiceName]) > 0 {
+		select {
+		case b.rearm <- struct{}{}:
+		default:
+		}
+	}
+}
 
-	return nil
+// randomID returns 16 random bytes as hex
+func randomID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// writeDeadLetter keeps a batch that failed to send for replay
+func (b *Batcher) writeDeadLetter(batch models.LogBatch, sendErr error) {
+	if b.deadLetter == nil {
+		return
+	}
+	if err := b.deadLetter.Write(NewDeadLetterRecord(batch, sendErr)); errors.Is(err, ErrDeadLetterFull) {
+		b.logger.Warn("Dead-letter file is full, dropping batch",
+			zap.String("service", batch.ServiceName),
+			zap.Uint64("sequence", batch.Sequence),
+			zap.Int("size", len(batch.Entries)))
+	} else if err != nil {
+		b.logger.Error("Failed to write batch to dead-letter file",
+			zap.Error(err),
+			zap.String("service", batch.ServiceName),
+			zap.Uint64("sequence", batch.Sequence))
+	}
 }
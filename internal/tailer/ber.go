@@ -0,0 +1,200 @@
+package tailer
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// BER tags used by SNMP
+const (
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berNull        = 0x05
+	berOID         = 0x06
+	berSequence    = 0x30
+	berIPAddress   = 0x40
+	berCounter32   = 0x41
+	berGauge32     = 0x42
+	berTimeTicks   = 0x43
+	berOpaque      = 0x44
+	berCounter64   = 0x46
+	berNoSuchObj   = 0x80
+	berNoSuchInst  = 0x81
+	berEndOfMIB    = 0x82
+)
+
+// errBERTruncated is returned when a value runs past the end of its buffer
+var errBERTruncated = errors.New("truncated BER value")
+
+// berValue is a decoded BER type-length-value
+type berValue struct {
+	tag    byte
+	data   []byte // Contents
+	raw    []byte // Tag, length, and contents
+	offset int    // Offset of the contents in the outermost buffer
+}
+
+// berReader reads consecutive BER values from a buffer
+type berReader struct {
+	buf  []byte
+	pos  int
+	base int // Offset of buf in the outermost buffer
+}
+
+// newBERReader creates a reader over an outermost buffer
+func newBERReader(buf []byte) *berReader {
+	return &berReader{buf: buf}
+}
+
+// more reports whether values remain
+func (r *berReader) more() bool {
+	return r.pos < len(r.buf)
+}
+
+// next reads the next value
+func (r *berReader) next() (berValue, error) {
+	if r.pos+2 > len(r.buf) {
+		return berValue{}, errBERTruncated
+	}
+	start := r.pos
+	tag := r.buf[r.pos]
+	if tag&0x1f == 0x1f {
+		return berValue{}, fmt.Errorf("unsupported multi-byte BER tag")
+	}
+
+	length := int(r.buf[r.pos+1])
+	p := r.pos + 2
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 4 || p+n > len(r.buf) {
+			return berValue{}, fmt.Errorf("invalid BER length")
+		}
+		length = 0
+		for i := 0; i < n; i++ {
+			length = length<<8 | int(r.buf[p+i])
+		}
+		p += n
+	}
+	if length < 0 || p+length > len(r.buf) {
+		return berValue{}, errBERTruncated
+	}
+
+	r.pos = p + length
+	return berValue{tag: tag, data: r.buf[p:r.pos], raw: r.buf[start:r.pos], offset: r.base + p}, nil
+}
+
+// expect reads the next value, failing if it doesn't have the given tag
+func (r *berReader) expect(tag byte) (berValue, error) {
+	v, err := r.next()
+	if err != nil {
+		return v, err
+	}
+	if v.tag != tag {
+		return v, fmt.Errorf("expected BER tag 0x%02x, got 0x%02x", tag, v.tag)
+	}
+	return v, nil
+}
+
+// expectInt reads the next value as an INTEGER
+func (r *berReader) expectInt() (int64, error) {
+	v, err := r.expect(berInteger)
+	if err != nil {
+		return 0, err
+	}
+	return berInt(v.data)
+}
+
+// reader returns a reader over a constructed value's contents
+func (v berValue) reader() *berReader {
+	return &berReader{buf: v.data, base: v.offset}
+}
+
+// berInt decodes a two's complement INTEGER
+func berInt(data []byte) (int64, error) {
+	if len(data) == 0 || len(data) > 8 {
+		return 0, fmt.Errorf("invalid BER integer length %d", len(data))
+	}
+	n := int64(int8(data[0]))
+	for _, b := range data[1:] {
+		n = n<<8 | int64(b)
+	}
+	return n, nil
+}
+
+// berUint decodes an unsigned counter, gauge, or time ticks value
+func berUint(data []byte) (uint64, error) {
+	if len(data) == 0 || len(data) > 9 || (len(data) == 9 && data[0] != 0) {
+		return 0, fmt.Errorf("invalid BER unsigned length %d", len(data))
+	}
+	var n uint64
+	for _, b := range data {
+		n = n<<8 | uint64(b)
+	}
+	return n, nil
+}
+
+// berOIDString decodes an OBJECT IDENTIFIER into dotted form
+func berOIDString(data []byte) (string, error) {
+	if len(data) == 0 {
+		return "", fmt.Errorf("empty BER object identifier")
+	}
+	var parts []string
+	var n uint64
+	first := true
+	for i, b := range data {
+		n = n<<7 | uint64(b&0x7f)
+		if b&0x80 != 0 {
+			if i == len(data)-1 {
+				return "", errBERTruncated
+			}
+			continue
+		}
+		if first {
+			// The first subidentifier packs the first two arcs
+			switch {
+			case n < 40:
+				parts = append(parts, "0", strconv.FormatUint(n, 10))
+			case n < 80:
+				parts = append(parts, "1", strconv.FormatUint(n-40, 10))
+			default:
+				parts = append(parts, "2", strconv.FormatUint(n-80, 10))
+			}
+			first = false
+		} else {
+			parts = append(parts, strconv.FormatUint(n, 10))
+		}
+		n = 0
+	}
+	return strings.Join(parts, "."), nil
+}
+
+// berEncode encodes a value with the given tag
+func berEncode(tag byte, contents []byte) []byte {
+	out := []byte{tag}
+	switch n := len(contents); {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n <= 0xff:
+		out = append(out, 0x81, byte(n))
+	case n <= 0xffff:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	default:
+		out = append(out, 0x84, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(out, contents...)
+}
+
+// berEncodeInt encodes an INTEGER in its shortest two's complement form
+func berEncodeInt(n int64) []byte {
+	var contents []byte
+	for {
+		contents = append([]byte{byte(n)}, contents...)
+		if (n >= -0x80 && n < 0x80) || len(contents) == 8 {
+			break
+		}
+		n >>= 8
+	}
+	return berEncode(berInteger, contents)
+}
@@ -0,0 +1,197 @@
+package tailer
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestBERReaderNext(t *testing.T) {
+	tests := []struct {
+		name    string
+		buf     []byte
+		tag     byte
+		data    []byte
+		wantErr bool
+	}{
+		{name: "short length", buf: []byte{0x04, 0x02, 'h', 'i'}, tag: berOctetString, data: []byte("hi")},
+		{name: "empty contents", buf: []byte{0x05, 0x00}, tag: berNull, data: []byte{}},
+		{name: "long length", buf: append([]byte{0x04, 0x81, 0x03}, "abc"...), tag: berOctetString, data: []byte("abc")},
+		{name: "two byte length", buf: append([]byte{0x04, 0x82, 0x00, 0x01}, 'x'), tag: berOctetString, data: []byte("x")},
+		{name: "trailing values", buf: []byte{0x02, 0x01, 0x07, 0x05, 0x00}, tag: berInteger, data: []byte{0x07}},
+		{name: "empty", buf: nil, wantErr: true},
+		{name: "tag only", buf: []byte{0x30}, wantErr: true},
+		{name: "contents truncated", buf: []byte{0x04, 0x05, 'a', 'b'}, wantErr: true},
+		{name: "long length truncated", buf: []byte{0x04, 0x82, 0x01}, wantErr: true},
+		{name: "indefinite length", buf: []byte{0x30, 0x80, 0x00, 0x00}, wantErr: true},
+		{name: "length of more than four bytes", buf: []byte{0x04, 0x85, 0x00, 0x00, 0x00, 0x00, 0x01, 'a'}, wantErr: true},
+		{name: "overlong length", buf: []byte{0x04, 0x84, 0xff, 0xff, 0xff, 0xff, 'a'}, wantErr: true},
+		{name: "length past end", buf: []byte{0x30, 0x7f, 0x02, 0x01, 0x00}, wantErr: true},
+		{name: "multi-byte tag", buf: []byte{0x1f, 0x81, 0x00}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := newBERReader(tt.buf).next()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("next() = %x, want an error", v.raw)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("next() error: %v", err)
+			}
+			if v.tag != tt.tag || !bytes.Equal(v.data, tt.data) {
+				t.Errorf("next() = tag 0x%02x data %x, want tag 0x%02x data %x", v.tag, v.data, tt.tag, tt.data)
+			}
+		})
+	}
+}
+
+func TestBERReaderTruncatedError(t *testing.T) {
+	if _, err := newBERReader([]byte{0x04, 0x05, 'a'}).next(); !errors.Is(err, errBERTruncated) {
+		t.Errorf("next() error = %v, want errBERTruncated", err)
+	}
+}
+
+func TestBERReaderOffsets(t *testing.T) {
+	// SEQUENCE { INTEGER 1, OCTET STRING "ab" }
+	buf := []byte{0x30, 0x07, 0x02, 0x01, 0x01, 0x04, 0x02, 'a', 'b'}
+	seq, err := newBERReader(buf).expect(berSequence)
+	if err != nil {
+		t.Fatalf("expect(SEQUENCE) error: %v", err)
+	}
+	r := seq.reader()
+	if n, err := r.expectInt(); err != nil || n != 1 {
+		t.Fatalf("expectInt() = %d, %v, want 1", n, err)
+	}
+	s, err := r.expect(berOctetString)
+	if err != nil {
+		t.Fatalf("expect(OCTET STRING) error: %v", err)
+	}
+	if s.offset != 7 || !bytes.Equal(buf[s.offset:s.offset+len(s.data)], []byte("ab")) {
+		t.Errorf("offset = %d, want 7", s.offset)
+	}
+	if r.more() {
+		t.Error("more() = true after the last value")
+	}
+	if _, err := newBERReader(buf).expect(berInteger); err == nil {
+		t.Error("expect(INTEGER) on a SEQUENCE succeeded")
+	}
+}
+
+func TestBERInt(t *testing.T) {
+	tests := []struct {
+		data    []byte
+		want    int64
+		wantErr bool
+	}{
+		{data: []byte{0x00}, want: 0},
+		{data: []byte{0x7f}, want: 127},
+		{data: []byte{0x00, 0x80}, want: 128},
+		{data: []byte{0xff}, want: -1},
+		{data: []byte{0x80}, want: -128},
+		{data: []byte{0xff, 0x7f}, want: -129},
+		{data: []byte{0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, want: math.MaxInt64},
+		{data: []byte{0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, want: math.MinInt64},
+		{data: nil, wantErr: true},
+		{data: make([]byte, 9), wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := berInt(tt.data)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("berInt(%x) = %d, want an error", tt.data, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("berInt(%x) = %d, %v, want %d", tt.data, got, err, tt.want)
+		}
+	}
+}
+
+func TestBEREncodeIntRoundTrip(t *testing.T) {
+	for _, n := range []int64{0, 1, -1, 127, 128, -128, -129, 255, 256, 65535, -65536, 1 << 31, math.MaxInt64, math.MinInt64} {
+		v, err := newBERReader(berEncodeInt(n)).expect(berInteger)
+		if err != nil {
+			t.Fatalf("decoding berEncodeInt(%d): %v", n, err)
+		}
+		got, err := berInt(v.data)
+		if err != nil || got != n {
+			t.Errorf("berInt(berEncodeInt(%d)) = %d, %v", n, got, err)
+		}
+	}
+	if got := berEncodeInt(128); !bytes.Equal(got, []byte{0x02, 0x02, 0x00, 0x80}) {
+		t.Errorf("berEncodeInt(128) = %x, want 02020080", got)
+	}
+}
+
+func TestBERUint(t *testing.T) {
+	tests := []struct {
+		data    []byte
+		want    uint64
+		wantErr bool
+	}{
+		{data: []byte{0x00}, want: 0},
+		{data: []byte{0xff}, want: 255},
+		{data: []byte{0x00, 0xff, 0xff, 0xff, 0xff}, want: math.MaxUint32},
+		{data: []byte{0x00, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, want: math.MaxUint64},
+		{data: nil, wantErr: true},
+		{data: []byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, wantErr: true},
+		{data: make([]byte, 10), wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := berUint(tt.data)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("berUint(%x) = %d, want an error", tt.data, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("berUint(%x) = %d, %v, want %d", tt.data, got, err, tt.want)
+		}
+	}
+}
+
+func TestBEROIDString(t *testing.T) {
+	tests := []struct {
+		data    []byte
+		want    string
+		wantErr bool
+	}{
+		{data: []byte{0x2b, 0x06, 0x01, 0x02, 0x01, 0x01, 0x03, 0x00}, want: "1.3.6.1.2.1.1.3.0"},
+		{data: []byte{0x2b, 0x06, 0x01, 0x04, 0x01, 0x82, 0x37}, want: "1.3.6.1.4.1.311"},
+		{data: []byte{0x00}, want: "0.0"},
+		{data: []byte{0x88, 0x37}, want: "2.999"},
+		{data: nil, wantErr: true},
+		{data: []byte{0x2b, 0x86}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := berOIDString(tt.data)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("berOIDString(%x) = %q, want an error", tt.data, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("berOIDString(%x) = %q, %v, want %q", tt.data, got, err, tt.want)
+		}
+	}
+}
+
+func TestBEREncodeLengths(t *testing.T) {
+	for _, n := range []int{0, 1, 0x7f, 0x80, 0xff, 0x100, 0xffff, 0x10000} {
+		contents := bytes.Repeat([]byte{'x'}, n)
+		v, err := newBERReader(berEncode(berOctetString, contents)).expect(berOctetString)
+		if err != nil {
+			t.Fatalf("decoding a %d byte value: %v", n, err)
+		}
+		if len(v.data) != n {
+			t.Errorf("decoded %d bytes, want %d", len(v.data), n)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package tailer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/oicur0t/logl/internal/config"
+	"go.uber.org/zap"
+)
+
+// Circuit breaker states
+const (
+	BreakerClosed   = "closed"    // Requests flow; consecutive failures are counted
+	BreakerOpen     = "open"      // The server is skipped until open_timeout passes
+	BreakerHalfOpen = "half_open" // A few probe requests decide whether to close or reopen
+)
+
+// CircuitBreaker stops sending to a failing server. After
+// failure_threshold consecutive failed requests it opens, and the server
+// is skipped for open_timeout. It then lets half_open_probes requests
+// through at a time: success_threshold successes in a row close it, and
+// any failure opens it again.
+type CircuitBreaker struct {
+	server           string
+	failureThreshold int
+	successThreshold int
+	probes           int
+	openTimeout      time.Duration
+	logger           *zap.Logger
+
+	mu        sync.Mutex
+	state     string
+	failures  int // Consecutive failures while closed
+	successes int // Consecutive probe successes while half-open
+	inFlight  int // Probes in flight while half-open
+	openedAt  time.Time
+	downSince time.Time // When it first opened, until it closes again
+	changedAt time.Time
+	lastErrAt time.Time
+	stats     BreakerStats
+}
+
+// BreakerStats describes a server's circuit breaker, with counters since
+// the tailer started
+type BreakerStats struct {
+	Server              string     `json:"server"`
+	State               string     `json:"state"`
+	StateChangedAt      *time.Time `json:"state_changed_at,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastErrorAt         *time.Time `json:"last_error_at,omitempty"`
+	Successes           int64      `json:"successes"`
+	Failures            int64      `json:"failures"`
+	Rejected            int64      `json:"rejected"` // Requests skipped while open or out of probes
+	Opened              int64      `json:"opened"`   // Times it opened, including reopening after a failed probe
+}
+
+// NewCircuitBreaker creates a closed circuit breaker for a server
+func NewCircuitBreaker(server string, cfg config.CircuitBreakerConfig, logger *zap.Logger) *CircuitBreaker {
+	return &CircuitBreaker{
+		server:           server,
+		failureThreshold: cfg.FailureThreshold,
+		successThreshold: cfg.SuccessThreshold,
+		probes:           cfg.HalfOpenProbes,
+		openTimeout:      cfg.OpenTimeout,
+		logger:           logger,
+		state:            BreakerClosed,
+	}
+}
+
+// allow reports whether a request may be sent. While half-open it claims
+// a probe, which recordSuccess, recordFailure, or release gives back.
+func (cb *CircuitBreaker) allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == BreakerOpen && time.Since(cb.openedAt) >= cb.openTimeout {
+		cb.setState(BreakerHalfOpen)
+		cb.successes = 0
+		cb.inFlight = 0
+		cb.logger.Info("Circuit breaker half-open, probing server",
+			zap.String("server", cb.server),
+			zap.Duration("down_for", time.Since(cb.downSince).Round(time.Second)))
+	}
+
+	switch cb.state {
+	case BreakerClosed:
+		return true
+	case BreakerHalfOpen:
+		if cb.inFlight < cb.probes {
+			cb.inFlight++
+			return true
+		}
+	}
+	cb.stats.Rejected++
+	return false
+}
+
+// recordSuccess counts a request the server answered, closing the
+// breaker once enough probes succeed
+func (cb *CircuitBreaker) recordSuccess() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.stats.Successes++
+	switch cb.state {
+	case BreakerClosed:
+		cb.failures = 0
+	case BreakerHalfOpen:
+		cb.inFlight--
+		cb.successes++
+		if cb.successes >= cb.successThreshold {
+			cb.setState(BreakerClosed)
+			cb.failures = 0
+			cb.logger.Info("Circuit breaker closed, server recovered",
+				zap.String("server", cb.server),
+				zap.Duration("down_for", time.Since(cb.downSince).Round(time.Second)))
+		}
+	}
+}
+
+// recordFailure counts a failed request, opening the breaker at the
+// threshold or when a probe fails
+func (cb *CircuitBreaker) recordFailure(err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.stats.Failures++
+	cb.stats.LastError = err.Error()
+	cb.lastErrAt = time.Now()
+	switch cb.state {
+	case BreakerClosed:
+		cb.failures++
+		if cb.failures >= cb.failureThreshold {
+			cb.open()
+			cb.downSince = cb.openedAt
+			cb.logger.Warn("Circuit breaker opened, skipping server",
+				zap.String("server", cb.server),
+				zap.Int("consecutive_failures", cb.failures),
+				zap.Duration("open_timeout", cb.openTimeout),
+				zap.Error(err))
+		}
+	case BreakerHalfOpen:
+		cb.inFlight--
+		cb.open()
+		cb.logger.Warn("Probe failed, circuit breaker reopened",
+			zap.String("server", cb.server),
+			zap.Duration("open_timeout", cb.openTimeout),
+			zap.Error(err))
+	}
+}
+
+// release gives back a probe whose outcome says nothing about the server,
+// such as a request cancelled at shutdown
+func (cb *CircuitBreaker) release() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.state == BreakerHalfOpen {
+		cb.inFlight--
+	}
+}
+
+// open moves to the open state. The caller must hold cb.mu.
+func (cb *CircuitBreaker) open() {
+	cb.setState(BreakerOpen)
+	cb.openedAt = time.Now()
+	cb.stats.Opened++
+}
+
+// setState records a state change. The caller must hold cb.mu.
+func (cb *CircuitBreaker) setState(state string) {
+	cb.state = state
+	cb.changedAt = time.Now()
+}
+
+// lastError returns the error from the last failed request
+func (cb *CircuitBreaker) lastError() string {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.stats.LastError
+}
+
+// Stats returns the breaker's state and counters
+func (cb *CircuitBreaker) Stats() BreakerStats {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	stats := cb.stats
+	stats.Server = cb.server
+	stats.State = cb.state
+	stats.ConsecutiveFailures = cb.failures
+	if !cb.changedAt.IsZero() {
+		changedAt := cb.changedAt
+		stats.StateChangedAt = &changedAt
+	}
+	if !cb.lastErrAt.IsZero() {
+		lastErrAt := cb.lastErrAt
+		stats.LastErrorAt = &lastErrAt
+	}
+	return stats
+}
@@ -5,11 +5,17 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/oicur0t/logl/internal/config"
 	"github.com/oicur0t/logl/pkg/models"
 	"github.com/oicur0t/logl/pkg/retry"
 	"go.uber.org/zap"
@@ -17,66 +23,66 @@ import (
 
 // Client sends log batches to the server via HTTP
 type Client struct {
-	serverURL   string
+	endpoints   []*endpoint
+	ring        *HashRing // nil unless routing is consistent_hash
 	httpClient  *http.Client
 	logger      *zap.Logger
 	retryConfig retry.Config
-	circuitBreaker *CircuitBreaker
-}
 
-// CircuitBreaker prevents overwhelming a failing server
-type CircuitBreaker struct {
-	failures    int
-	lastFailure time.Time
-	threshold   int
-	timeout     time.Duration
-	mu          sync.Mutex
-}
+	assignMu    sync.Mutex
+	assignments map[string]string // stream key -> server URL that last accepted it
 
-// NewCircuitBreaker creates a new circuit breaker
-func NewCircuitBreaker(threshold int, timeout time.Duration) *CircuitBreaker {
-	return &CircuitBreaker{
-		threshold: threshold,
-		timeout:   timeout,
-	}
+	region           string // Empty sends to servers regardless of region
+	pinRegion        bool
+	regionsMu        sync.Mutex
+	regionsCheckedAt time.Time
 }
 
-// isOpen checks if the circuit breaker is open (blocking requests)
-func (cb *CircuitBreaker) isOpen() bool {
-	cb.mu.Lock()
-	defer cb.mu.Unlock()
-
-	if cb.failures >= cb.threshold && time.Since(cb.lastFailure) < cb.timeout {
-		return true
-	}
-
-	// Reset if timeout has passed
-	if time.Since(cb.lastFailure) >= cb.timeout {
-		cb.failures = 0
-	}
+// endpoint is a single upstream server with its own circuit breaker
+type endpoint struct {
+	url            string
+	circuitBreaker *CircuitBreaker
 
-	return false
+	regionMu sync.Mutex
+	region   string // As advertised by the server; empty until known
 }
 
-// recordSuccess resets the circuit breaker
-func (cb *CircuitBreaker) recordSuccess() {
-	cb.mu.Lock()
-	defer cb.mu.Unlock()
-	cb.failures = 0
+// Region returns the region the server advertised
+func (ep *endpoint) Region() string {
+	ep.regionMu.Lock()
+	defer ep.regionMu.Unlock()
+	return ep.region
 }
 
-// recordFailure increments the failure count
-func (cb *CircuitBreaker) recordFailure() {
-	cb.mu.Lock()
-	defer cb.mu.Unlock()
-	cb.failures++
-	cb.lastFailure = time.Now()
+// setRegion records the region the server advertised, reporting whether
+// it changed
+func (ep *endpoint) setRegion(region string) bool {
+	ep.regionMu.Lock()
+	defer ep.regionMu.Unlock()
+	changed := ep.region != region
+	ep.region = region
+	return changed
 }
 
-// NewClient creates a new HTTP client with mTLS
-func NewClient(serverURL string, tlsConfig *tls.Config, timeout time.Duration, maxRetries int, logger *zap.Logger) *Client {
+const (
+	// regionRefreshInterval is how often servers' regions are rechecked
+	regionRefreshInterval = 5 * time.Minute
+
+	// regionRetryInterval is how often they are rechecked while a server's
+	// region is unknown
+	regionRetryInterval = 30 * time.Second
+)
+
+// NewClient creates a new HTTP client with mTLS.
+// With routing "consistent_hash" each service stream is pinned to a server
+// chosen from a hash ring; otherwise servers are tried in configured order.
+// A nil proxy connects to servers directly; a nil dial uses the default dialer.
+// Each server gets its own circuit breaker configured by breaker.
+func NewClient(serverURLs []string, routing string, virtualNodes int, tlsConfig *tls.Config, proxy ProxyFunc, dial DialFunc, timeout time.Duration, maxRetries int, breaker config.CircuitBreakerConfig, logger *zap.Logger) *Client {
 	httpClient := &http.Client{
 		Transport: &http.Transport{
+			Proxy:               proxy,
+			DialContext:         dial,
 			TLSClientConfig:     tlsConfig,
 			MaxIdleConns:        100,
 			MaxIdleConnsPerHost: 10,
@@ -85,8 +91,22 @@ func NewClient(serverURL string, tlsConfig *tls.Config, timeout time.Duration, m
 		Timeout: timeout,
 	}
 
+	endpoints := make([]*endpoint, len(serverURLs))
+	for i, u := range serverURLs {
+		endpoints[i] = &endpoint{
+			url:            u,
+			circuitBreaker: NewCircuitBreaker(u, breaker, logger),
+		}
+	}
+
+	var ring *HashRing
+	if routing == "consistent_hash" && len(serverURLs) > 1 {
+		ring = NewHashRing(serverURLs, virtualNodes)
+	}
+
 	return &Client{
-		serverURL:  serverURL,
+		endpoints:  endpoints,
+		ring:       ring,
 		httpClient: httpClient,
 		logger:     logger,
 		retryConfig: retry.Config{
@@ -95,34 +115,302 @@ func NewClient(serverURL string, tlsConfig *tls.Config, timeout time.Duration, m
 			MaxWait:     60 * time.Second,
 			Multiplier:  2.0,
 		},
-		circuitBreaker: NewCircuitBreaker(5, 60*time.Second),
+		assignments: make(map[string]string),
+	}
+}
+
+// SetRegion prefers servers advertising the given region, failing over to
+// other regions only when pin is false
+func (c *Client) SetRegion(region string, pin bool) {
+	c.region = region
+	c.pinRegion = pin
+}
+
+// candidates returns the servers to try for a stream, most preferred first
+func (c *Client) candidates(streamKey string) []*endpoint {
+	candidates := c.endpoints
+	if c.ring != nil {
+		order := c.ring.Lookup(streamKey)
+		candidates = make([]*endpoint, len(order))
+		for i, idx := range order {
+			candidates[i] = c.endpoints[idx]
+		}
+	}
+	if c.region == "" {
+		return candidates
+	}
+
+	// Servers in the tailer's region come first, keeping their order
+	local := make([]*endpoint, 0, len(candidates))
+	var remote []*endpoint
+	for _, ep := range candidates {
+		if ep.Region() == c.region {
+			local = append(local, ep)
+		} else if !c.pinRegion {
+			remote = append(remote, ep)
+		}
+	}
+	return append(local, remote...)
+}
+
+// checkRegions learns the servers' regions when they are due to be
+// checked. The first check completes before sending, so the first batch
+// already goes to a local server; later checks run in the background.
+func (c *Client) checkRegions(ctx context.Context) {
+	if c.region == "" {
+		return
+	}
+
+	interval := regionRefreshInterval
+	for _, ep := range c.endpoints {
+		if ep.Region() == "" {
+			interval = regionRetryInterval
+			break
+		}
+	}
+
+	c.regionsMu.Lock()
+	first := c.regionsCheckedAt.IsZero()
+	due := time.Since(c.regionsCheckedAt) >= interval
+	if due {
+		c.regionsCheckedAt = time.Now()
+	}
+	c.regionsMu.Unlock()
+
+	switch {
+	case first:
+		c.discoverRegions(ctx)
+	case due:
+		go c.discoverRegions(context.Background())
+	}
+}
+
+// discoverRegions asks every server for its region in parallel
+func (c *Client) discoverRegions(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, ep := range c.endpoints {
+		wg.Add(1)
+		go func(ep *endpoint) {
+			defer wg.Done()
+			region, err := c.serverRegion(ctx, ep.url)
+			if err != nil {
+				c.logger.Debug("Failed to check server region", zap.String("server", ep.url), zap.Error(err))
+				return
+			}
+			c.recordRegion(ep, region)
+		}(ep)
+	}
+	wg.Wait()
+}
+
+// recordRegion stores a server's region and logs when it is learned or changes
+func (c *Client) recordRegion(ep *endpoint, region string) {
+	if ep.setRegion(region) {
+		c.logger.Info("Server region",
+			zap.String("server", ep.url),
+			zap.String("region", region),
+			zap.Bool("local", region == c.region))
+	}
+}
+
+// serverRegion returns the region a server advertises from its health
+// endpoint, empty when it has none
+func (c *Client) serverRegion(ctx context.Context, serverURL string) (string, error) {
+	healthURL, err := HealthURL(serverURL)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, min(c.httpClient.Timeout, 5*time.Second))
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, healthURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
 	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("health check failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("health check returned %d", resp.StatusCode)
+	}
+	var health struct {
+		Region string `json:"region"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return "", fmt.Errorf("invalid health response: %w", err)
+	}
+	return health.Region, nil
+}
+
+// HealthURL returns the health endpoint of the server behind an ingest URL
+func HealthURL(serverURL string) (string, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL: %w", err)
+	}
+	u.Path = "/v1/health"
+	u.RawQuery = ""
+	return u.String(), nil
+}
+
+// recordAssignment remembers which server accepted a stream and logs when it moves
+func (c *Client) recordAssignment(streamKey, serverURL string) {
+	c.assignMu.Lock()
+	defer c.assignMu.Unlock()
+
+	previous, exists := c.assignments[streamKey]
+	if exists && previous != serverURL {
+		c.logger.Info("Stream rebalanced to different server",
+			zap.String("stream", streamKey),
+			zap.String("from", previous),
+			zap.String("to", serverURL))
+	}
+	c.assignments[streamKey] = serverURL
 }
 
 // SendBatch sends a log batch to the server with retry logic
 func (c *Client) SendBatch(ctx context.Context, batch models.LogBatch) error {
-	// Check circuit breaker
-	if c.circuitBreaker.isOpen() {
-		return fmt.Errorf("circuit breaker is open, server may be down")
+	c.checkRegions(ctx)
+
+	candidates := c.candidates(batch.ServiceName)
+	if len(candidates) == 0 {
+		return fmt.Errorf("no servers known in region %s", c.region)
 	}
 
-	var lastErr error
+	var winner *endpoint
 	err := retry.Do(ctx, c.retryConfig, func() error {
-		lastErr = c.sendRequest(ctx, batch)
+		// Servers whose circuit breaker is open are skipped; their streams
+		// fall through to the next server on the ring until they recover
+		var lastErr error
+		for _, ep := range candidates {
+			if !ep.circuitBreaker.allow() {
+				continue
+			}
+			lastErr = c.sendRequest(ctx, ep, batch)
+			var rejected *RejectedError
+			var throttled *ThrottledError
+			switch {
+			case lastErr == nil:
+				ep.circuitBreaker.recordSuccess()
+				winner = ep
+				return nil
+			case errors.As(lastErr, &rejected):
+				// Other servers would refuse it too, and this one is healthy
+				ep.circuitBreaker.recordSuccess()
+				return retry.Permanent(lastErr)
+			case errors.As(lastErr, &throttled):
+				// The server is healthy but busy; wait as long as it asks
+				ep.circuitBreaker.recordSuccess()
+				if throttled.RetryAfter > 0 {
+					return retry.After(lastErr, throttled.RetryAfter)
+				}
+				return lastErr
+			case ctx.Err() != nil:
+				ep.circuitBreaker.release()
+				return lastErr
+			}
+			ep.circuitBreaker.recordFailure(lastErr)
+		}
+		if lastErr == nil {
+			return fmt.Errorf("circuit breakers open for all servers, last error from %s: %s", candidates[0].url, candidates[0].circuitBreaker.lastError())
+		}
 		return lastErr
 	})
-
 	if err != nil {
-		c.circuitBreaker.recordFailure()
 		return err
 	}
 
-	c.circuitBreaker.recordSuccess()
+	c.recordAssignment(batch.ServiceName, winner.url)
 	return nil
 }
 
+// ServerStats returns each server's circuit breaker state and counters
+func (c *Client) ServerStats() []BreakerStats {
+	stats := make([]BreakerStats, len(c.endpoints))
+	for i, ep := range c.endpoints {
+		stats[i] = ep.circuitBreaker.Stats()
+	}
+	return stats
+}
+
+// RejectedError is returned for a batch the server refused with an error
+// that isn't retryable, such as a malformed batch or an exhausted quota.
+// Sending the same batch again won't succeed.
+type RejectedError struct {
+	StatusCode int
+	Err        models.APIError
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("server rejected batch: %d %s: %s", e.StatusCode, e.Err.Code, e.Err.Message)
+}
+
+// ThrottledError is returned for a batch the server asked to have sent
+// again later, because it is rate limited, already handling the same
+// batch, or out of buffer space. It doesn't count against the server's
+// circuit breaker.
+type ThrottledError struct {
+	StatusCode int
+	Err        models.APIError
+	RetryAfter time.Duration // Zero when the server didn't say
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("server throttled batch: %d %s: %s", e.StatusCode, e.Err.Code, e.Err.Message)
+}
+
+// throttled reports whether a retryable error means the server is busy
+// rather than failing
+func throttled(statusCode int, apiErr models.APIError) bool {
+	switch apiErr.Code {
+	case models.ErrCodeRateLimited, models.ErrCodeBatchInProgress, models.ErrCodeBufferFull:
+		return true
+	}
+	return statusCode == http.StatusTooManyRequests
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP
+// date, returning zero if it is missing or invalid
+func retryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		if wait := time.Until(at); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// decodeAPIError reads an error response, falling back to the code and
+// retryability its status implies when the body isn't a JSON error
+func decodeAPIError(resp *http.Response) models.APIError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var errResp models.ErrorResponse
+	if json.Unmarshal(body, &errResp) == nil && errResp.Error.Code != "" {
+		return errResp.Error
+	}
+
+	apiErr := models.NewAPIError(resp.StatusCode, strings.TrimSpace(string(body)))
+	// Servers without error codes only had batches retried on 5xx
+	apiErr.Retryable = resp.StatusCode >= 500
+	return apiErr
+}
+
 // sendRequest makes a single HTTP request to send the batch
-func (c *Client) sendRequest(ctx context.Context, batch models.LogBatch) error {
+func (c *Client) sendRequest(ctx context.Context, ep *endpoint, batch models.LogBatch) error {
+	serverURL := ep.url
+
 	// Marshal batch to JSON
 	jsonData, err := json.Marshal(batch)
 	if err != nil {
@@ -130,7 +418,7 @@ func (c *Client) sendRequest(ctx context.Context, batch models.LogBatch) error {
 	}
 
 	// Create request
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.serverURL, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, serverURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
@@ -140,26 +428,52 @@ func (c *Client) sendRequest(ctx context.Context, batch models.LogBatch) error {
 	// Send request
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		c.logger.Warn("Request failed", zap.Error(err))
+		c.logger.Warn("Request failed", zap.String("server", serverURL), zap.Error(err))
 		return fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
-	// Check response status
-	if resp.StatusCode >= 500 {
-		// Server error - retry
-		return fmt.Errorf("server error: %d", resp.StatusCode)
+	if region := resp.Header.Get("X-Logl-Region"); region != "" && c.region != "" {
+		c.recordRegion(ep, region)
+	}
+
+	// Surface advisory quota warnings from the server
+	if resp.Header.Get("X-Logl-Quota-Warning") == "true" {
+		c.logger.Warn("Approaching server quota",
+			zap.String("service", batch.ServiceName),
+			zap.String("used", resp.Header.Get("X-Logl-Quota-Used")),
+			zap.String("limit", resp.Header.Get("X-Logl-Quota-Limit")))
 	}
 
+	// Check response status. The error's retryable flag decides whether
+	// the batch is sent again; older servers answer in plain text, so the
+	// status decides for them.
 	if resp.StatusCode >= 400 {
-		// Client error - don't retry
-		c.logger.Error("Client error, not retrying",
-			zap.Int("status_code", resp.StatusCode),
-			zap.Int("batch_size", len(batch.Entries)))
-		return nil // Don't retry 4xx errors
+		apiErr := decodeAPIError(resp)
+
+		if apiErr.Code == models.ErrCodeRegionMismatch || resp.StatusCode == http.StatusMisdirectedRequest {
+			// The server refuses entries from this region - try the next server
+			c.logger.Warn("Server rejected batch from another region",
+				zap.String("server", serverURL),
+				zap.String("server_region", resp.Header.Get("X-Logl-Region")))
+			return fmt.Errorf("server rejected region: %d", resp.StatusCode)
+		}
+		if apiErr.Retryable && throttled(resp.StatusCode, apiErr) {
+			return &ThrottledError{
+				StatusCode: resp.StatusCode,
+				Err:        apiErr,
+				RetryAfter: retryAfter(resp.Header.Get("Retry-After")),
+			}
+		}
+		if apiErr.Retryable {
+			return fmt.Errorf("server error: %d %s: %s", resp.StatusCode, apiErr.Code, apiErr.Message)
+		}
+
+		return &RejectedError{StatusCode: resp.StatusCode, Err: apiErr}
 	}
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+	// 202: the server buffered the batch while its storage is unavailable
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusAccepted {
 		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
@@ -0,0 +1,297 @@
+package tailer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/oicur0t/logl/pkg/awsauth"
+	"github.com/oicur0t/logl/pkg/models"
+	"go.uber.org/zap"
+)
+
+// cloudWatchPageSize is the most events FilterLogEvents returns per call
+const cloudWatchPageSize = 10000
+
+// cloudWatchEvent is an event returned by FilterLogEvents
+type cloudWatchEvent struct {
+	EventID       string `json:"eventId"`
+	LogStreamName string `json:"logStreamName"`
+	Message       string `json:"message"`
+	Timestamp     int64  `json:"timestamp"` // Milliseconds since the epoch
+}
+
+// cloudWatchCheckpoint is the persisted position of a CloudWatch reader
+type cloudWatchCheckpoint struct {
+	LogGroup  string `json:"log_group"`
+	Timestamp int64  `json:"timestamp"` // Newest event timestamp shipped, in milliseconds
+}
+
+// CloudWatchReader polls a CloudWatch Logs log group with FilterLogEvents
+// and ships its events, so managed services that only log to CloudWatch
+// are centralized alongside host logs. Each poll rereads an overlap window
+// before the checkpoint, since events can be ingested late; events are
+// deduplicated by ID, which is also sent as the entry ID so the server
+// drops events resent after a restart.
+type CloudWatchReader struct {
+	logGroup      string
+	streamPrefix  string
+	filterPattern string
+	region        string
+	endpoint      string
+	pollInterval  time.Duration
+	overlap       time.Duration
+	lookback      time.Duration
+	serviceName   string
+	hostname      string
+	stateFile     string
+	credentials   *awsauth.Credentials
+	httpClient    *http.Client
+	logger        *zap.Logger
+	lineChan      chan<- models.LogEntry
+
+	checkpoint int64            // Newest event timestamp shipped, in milliseconds
+	seen       map[string]int64 // Event ID -> timestamp, for events within the overlap window
+}
+
+// NewCloudWatchReader creates a new CloudWatch Logs reader. An empty
+// endpoint uses the public endpoint of region. The checkpoint is kept in
+// stateFile; without one, the first poll starts lookback ago.
+func NewCloudWatchReader(logGroup, streamPrefix, filterPattern, region, endpoint string, pollInterval, overlap, lookback time.Duration, serviceName, hostname, stateFile string, credentials *awsauth.Credentials, logger *zap.Logger, lineChan chan<- models.LogEntry) *CloudWatchReader {
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://logs.%s.amazonaws.com", region)
+	}
+	return &CloudWatchReader{
+		logGroup:      logGroup,
+		streamPrefix:  streamPrefix,
+		filterPattern: filterPattern,
+		region:        region,
+		endpoint:      endpoint,
+		pollInterval:  pollInterval,
+		overlap:       overlap,
+		lookback:      lookback,
+		serviceName:   serviceName,
+		hostname:      hostname,
+		stateFile:     stateFile,
+		credentials:   credentials,
+		httpClient:    &http.Client{Timeout: 30 * time.Second},
+		logger:        logger,
+		lineChan:      lineChan,
+		seen:          make(map[string]int64),
+	}
+}
+
+// CloudWatchStateFile returns the checkpoint file for a log group, next to
+// the tailer's state file
+func CloudWatchStateFile(stateFile, logGroup string) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '.' {
+			return r
+		}
+		return '_'
+	}, strings.TrimPrefix(logGroup, "/"))
+	return filepath.Join(filepath.Dir(stateFile), "cloudwatch-"+name+".json")
+}
+
+// Start polls the log group until the context is cancelled
+func (r *CloudWatchReader) Start(ctx context.Context) error {
+	if err := r.loadCheckpoint(); err != nil {
+		r.logger.Warn("Failed to load CloudWatch checkpoint, starting fresh",
+			zap.String("log_group", r.logGroup),
+			zap.Error(err))
+	}
+	if r.checkpoint == 0 {
+		r.checkpoint = time.Now().Add(-r.lookback).UnixMilli()
+	}
+
+	r.logger.Info("Polling CloudWatch Logs",
+		zap.String("log_group", r.logGroup),
+		zap.String("region", r.region),
+		zap.Time("from", time.UnixMilli(r.checkpoint)))
+
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.poll(ctx); err != nil && ctx.Err() == nil {
+			r.logger.Error("Failed to poll CloudWatch Logs", zap.String("log_group", r.logGroup), zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll ships events newer than the overlap window that haven't been shipped
+func (r *CloudWatchReader) poll(ctx context.Context) error {
+	start := r.checkpoint - r.overlap.Milliseconds()
+	newest := r.checkpoint
+	shipped := 0
+
+	var nextToken string
+	for {
+		events, token, err := r.filterLogEvents(ctx, start, nextToken)
+		if err != nil {
+			return err
+		}
+
+		for _, event := range events {
+			if _, exists := r.seen[event.EventID]; exists {
+				continue
+			}
+
+			entry := models.LogEntry{
+				ServiceName: r.serviceName,
+				Hostname:    r.hostname,
+				FilePath:    "cloudwatch://" + r.logGroup + "/" + event.LogStreamName,
+				Line:        strings.TrimRight(event.Message, "\r\n"),
+				Timestamp:   time.UnixMilli(event.Timestamp),
+				EntryID:     event.EventID,
+				Labels: map[string]string{
+					"log_group":  r.logGroup,
+					"log_stream": event.LogStreamName,
+				},
+			}
+			select {
+			case r.lineChan <- entry:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
+			r.seen[event.EventID] = event.Timestamp
+			if event.Timestamp > newest {
+				newest = event.Timestamp
+			}
+			shipped++
+		}
+
+		if token == "" || token == nextToken {
+			break
+		}
+		nextToken = token
+	}
+
+	// Forget events that later polls won't return
+	r.checkpoint = newest
+	cutoff := r.checkpoint - r.overlap.Milliseconds()
+	for id, timestamp := range r.seen {
+		if timestamp < cutoff {
+			delete(r.seen, id)
+		}
+	}
+
+	if shipped > 0 {
+		r.logger.Debug("Shipped CloudWatch events", zap.String("log_group", r.logGroup), zap.Int("events", shipped))
+		if err := r.saveCheckpoint(); err != nil {
+			r.logger.Warn("Failed to save CloudWatch checkpoint", zap.String("log_group", r.logGroup), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// filterLogEvents returns one page of the log group's events from start
+func (r *CloudWatchReader) filterLogEvents(ctx context.Context, start int64, nextToken string) ([]cloudWatchEvent, string, error) {
+	input := map[string]interface{}{
+		"logGroupName": r.logGroup,
+		"startTime":    start,
+		"limit":        cloudWatchPageSize,
+	}
+	if r.streamPrefix != "" {
+		input["logStreamNamePrefix"] = r.streamPrefix
+	}
+	if r.filterPattern != "" {
+		input["filterPattern"] = r.filterPattern
+	}
+	if nextToken != "" {
+		input["nextToken"] = nextToken
+	}
+	body, err := json.Marshal(input)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	creds, err := r.credentials.Get(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "Logs_20140328.FilterLogEvents")
+	awsauth.Sign(req, body, creds, r.region, "logs", time.Now())
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to call FilterLogEvents: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		json.Unmarshal(data, &apiErr)
+		return nil, "", fmt.Errorf("FilterLogEvents returned %d: %s %s", resp.StatusCode, apiErr.Type, apiErr.Message)
+	}
+
+	var output struct {
+		Events    []cloudWatchEvent `json:"events"`
+		NextToken string            `json:"nextToken"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&output); err != nil {
+		return nil, "", fmt.Errorf("failed to decode FilterLogEvents response: %w", err)
+	}
+	return output.Events, output.NextToken, nil
+}
+
+// loadCheckpoint reads the persisted checkpoint, if any
+func (r *CloudWatchReader) loadCheckpoint() error {
+	data, err := os.ReadFile(r.stateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	var checkpoint cloudWatchCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return fmt.Errorf("failed to parse checkpoint: %w", err)
+	}
+	if checkpoint.LogGroup == r.logGroup {
+		r.checkpoint = checkpoint.Timestamp
+	}
+	return nil
+}
+
+// saveCheckpoint persists the checkpoint atomically
+func (r *CloudWatchReader) saveCheckpoint() error {
+	data, err := json.Marshal(cloudWatchCheckpoint{LogGroup: r.logGroup, Timestamp: r.checkpoint})
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+
+	tmp := r.stateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, r.stateFile); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	return nil
+}
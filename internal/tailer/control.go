@@ -0,0 +1,156 @@
+package tailer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/oicur0t/logl/pkg/models"
+	"go.uber.org/zap"
+)
+
+// ControlServer serves the local control API, which lists tailed files and
+// pauses and resumes them without restarting the tailer, and reports the
+// state of each upstream server and the dead-letter file's disk usage. It
+// has no authentication, so it only listens on loopback addresses.
+type ControlServer struct {
+	address    string
+	watcher    *Watcher
+	client     *Client
+	deadLetter *DeadLetter // nil when there is no dead-letter file
+	logger     *zap.Logger
+}
+
+// NewControlServer creates a new control API server for a watcher, the
+// client sending its batches, and the dead-letter file they fall back to
+func NewControlServer(address string, watcher *Watcher, client *Client, deadLetter *DeadLetter, logger *zap.Logger) *ControlServer {
+	return &ControlServer{
+		address:    address,
+		watcher:    watcher,
+		client:     client,
+		deadLetter: deadLetter,
+		logger:     logger,
+	}
+}
+
+// Start serves the control API until the context is cancelled
+func (c *ControlServer) Start(ctx context.Context) error {
+	listener, err := net.Listen("tcp", c.address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", c.address, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/files", c.files)
+	mux.HandleFunc("/v1/files/pause", c.pause)
+	mux.HandleFunc("/v1/files/resume", c.resume)
+	mux.HandleFunc("/v1/servers", c.servers)
+	mux.HandleFunc("/v1/dead-letter", c.deadLetterUsage)
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	c.logger.Info("Control API listening", zap.String("address", listener.Addr().String()))
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("control API failed: %w", err)
+	}
+	return nil
+}
+
+// files lists every discovered file with its position and whether it is
+// paused
+func (c *ControlServer) files(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeControlError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"files": c.watcher.Files(),
+	})
+}
+
+// servers lists each upstream server's circuit breaker state and counters
+func (c *ControlServer) servers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeControlError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"servers": c.client.ServerStats(),
+	})
+}
+
+// deadLetterUsage reports the dead-letter file's size, its filesystem's
+// usage, and the batches dropped because either was full
+func (c *ControlServer) deadLetterUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeControlError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if c.deadLetter == nil {
+		writeControlError(w, http.StatusNotFound, "dead_letter.path is not set")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c.deadLetter.Usage())
+}
+
+// pause stops tailing a file
+func (c *ControlServer) pause(w http.ResponseWriter, r *http.Request) {
+	c.control(w, r, c.watcher.Pause)
+}
+
+// resume starts tailing a paused file again
+func (c *ControlServer) resume(w http.ResponseWriter, r *http.Request) {
+	c.control(w, r, c.watcher.Resume)
+}
+
+// control applies a pause or resume to the file named in the request body
+func (c *ControlServer) control(w http.ResponseWriter, r *http.Request, apply func(path string) error) {
+	if r.Method != http.MethodPost {
+		writeControlError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req struct {
+		Path string `json:"path"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeControlError(w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %v", err))
+		return
+	}
+	if req.Path == "" {
+		writeControlError(w, http.StatusBadRequest, "path is required")
+		return
+	}
+
+	if err := apply(req.Path); errors.Is(err, ErrUnknownFile) {
+		writeControlError(w, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		writeControlError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeControlError writes an error response in the server's JSON envelope
+func writeControlError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(models.ErrorResponse{Error: models.NewAPIError(status, message)})
+}
@@ -0,0 +1,21 @@
+//go:build windows
+
+package tailer
+
+import (
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// processCPUTime returns the user and kernel CPU time the process has used
+func processCPUTime() (time.Duration, error) {
+	var creation, exit, kernel, user windows.Filetime
+	if err := windows.GetProcessTimes(windows.CurrentProcess(), &creation, &exit, &kernel, &user); err != nil {
+		return 0, err
+	}
+	// Filetimes count 100ns intervals
+	ticks := int64(kernel.HighDateTime)<<32 | int64(kernel.LowDateTime)
+	ticks += int64(user.HighDateTime)<<32 | int64(user.LowDateTime)
+	return time.Duration(ticks * 100), nil
+}
@@ -0,0 +1,299 @@
+package tailer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/oicur0t/logl/pkg/models"
+	"go.uber.org/zap"
+)
+
+// Reasons a batch was written to the dead-letter file
+const (
+	DeadLetterRejected      = "rejected"      // The server refused it with a non-retryable error
+	DeadLetterUndeliverable = "undeliverable" // Retries ran out, or the tailer stopped first
+)
+
+// What happens to the dead-letter file when it reaches max_bytes
+const (
+	DeadLetterDropOldest = "drop_oldest" // Rotate, replacing the previous rotation
+	DeadLetterDropNewest = "drop_newest" // Keep both files and drop new batches
+)
+
+// ErrDeadLetterFull is returned for records dropped because the dead-letter
+// file or its filesystem is full
+var ErrDeadLetterFull = errors.New("dead-letter file is full")
+
+// DeadLetter appends batches that could not be delivered to a JSON lines
+// file, so they can be inspected and replayed instead of being lost. Past
+// maxBytes the file is rotated to path.1, replacing the previous one
+// unless the overflow policy keeps it. Records are dropped while the
+// filesystem is fuller than maxDiskPercent, so a long outage can't fill
+// the disk.
+type DeadLetter struct {
+	path           string
+	maxBytes       int64
+	maxDiskPercent float64
+	overflow       string
+	dropped        int64
+	mu             sync.Mutex
+}
+
+// DeadLetterUsage reports how much disk the dead-letter file takes
+type DeadLetterUsage struct {
+	Path            string  `json:"path"`
+	Bytes           int64   `json:"bytes"` // The file and its rotation
+	MaxBytes        int64   `json:"max_bytes"`
+	DiskUsedPercent float64 `json:"disk_used_percent"` // Of the filesystem holding the file; -1 if unknown
+	MaxDiskPercent  float64 `json:"max_disk_percent"`
+	Overflow        string  `json:"overflow"`
+	Dropped         int64   `json:"dropped"` // Records dropped since start because it was full
+}
+
+// DeadLetterRecord is one line of the dead-letter file
+type DeadLetterRecord struct {
+	Time       time.Time              `json:"time"`
+	Reason     string                 `json:"reason"`
+	StatusCode int                    `json:"status_code,omitempty"`
+	Code       string                 `json:"code,omitempty"` // Error code from the server
+	Error      string                 `json:"error"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+	Replays    int                    `json:"replays,omitempty"` // Times the batch was replayed and failed again
+	Batch      models.LogBatch        `json:"batch"`
+}
+
+// NewDeadLetterRecord describes a batch that failed to send with err
+func NewDeadLetterRecord(batch models.LogBatch, err error) DeadLetterRecord {
+	record := DeadLetterRecord{
+		Time:   time.Now().UTC(),
+		Reason: DeadLetterUndeliverable,
+		Error:  err.Error(),
+		Batch:  batch,
+	}
+	var rejected *RejectedError
+	if errors.As(err, &rejected) {
+		record.Reason = DeadLetterRejected
+		record.StatusCode = rejected.StatusCode
+		record.Code = rejected.Err.Code
+		record.Error = rejected.Err.Message
+		record.Details = rejected.Err.Details
+	}
+	return record
+}
+
+// ReplayResult counts the outcome of replaying a dead-letter file
+type ReplayResult struct {
+	Sent      int // Batches the server accepted
+	Failed    int // Batches written back to the dead-letter file
+	Malformed int // Lines that weren't records, written back as they were
+}
+
+// NewDeadLetter creates a dead-letter file writer, or returns nil when
+// path is empty
+func NewDeadLetter(path string, maxBytes int64) *DeadLetter {
+	if path == "" {
+		return nil
+	}
+	return &DeadLetter{path: path, maxBytes: maxBytes, overflow: DeadLetterDropOldest}
+}
+
+// SetLimits sets how full the file's filesystem may get, 0 for no limit,
+// and the overflow policy applied at maxBytes
+func (d *DeadLetter) SetLimits(maxDiskPercent float64, overflow string) {
+	d.maxDiskPercent = maxDiskPercent
+	d.overflow = overflow
+}
+
+// Usage reports the file's size, its filesystem's usage, and the records
+// dropped so far
+func (d *DeadLetter) Usage() DeadLetterUsage {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	usage := DeadLetterUsage{
+		Path:            d.path,
+		MaxBytes:        d.maxBytes,
+		DiskUsedPercent: -1,
+		MaxDiskPercent:  d.maxDiskPercent,
+		Overflow:        d.overflow,
+		Dropped:         d.dropped,
+	}
+	for _, path := range []string{d.path, d.path + ".1"} {
+		if info, err := os.Stat(path); err == nil {
+			usage.Bytes += info.Size()
+		}
+	}
+	if used, err := diskUsedPercent(filepath.Dir(d.path)); err == nil {
+		usage.DiskUsedPercent = used
+	}
+	return usage
+}
+
+// Write appends a record
+func (d *DeadLetter) Write(record DeadLetterRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode batch: %w", err)
+	}
+	return d.append(append(line, '\n'))
+}
+
+// append writes a line, rotating the file first if it would grow past
+// maxBytes
+func (d *DeadLetter) append(line []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(d.path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if d.maxBytes > 0 {
+		if info, err := os.Stat(d.path); err == nil && info.Size() > 0 && info.Size()+int64(len(line)) > d.maxBytes {
+			if _, err := os.Stat(d.path + ".1"); err == nil && d.overflow == DeadLetterDropNewest {
+				d.dropped++
+				return ErrDeadLetterFull
+			}
+			if err := os.Rename(d.path, d.path+".1"); err != nil {
+				return fmt.Errorf("failed to rotate %s: %w", d.path, err)
+			}
+		}
+	}
+	if !d.diskAllows() {
+		d.dropped++
+		return ErrDeadLetterFull
+	}
+
+	// Batches hold log lines, which may be sensitive
+	f, err := os.OpenFile(d.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", d.path, err)
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", d.path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", d.path, err)
+	}
+	return nil
+}
+
+// diskAllows reports whether the file's filesystem has room under
+// maxDiskPercent. With drop_oldest, the rotation is removed to make room
+// first. Usage that can't be read doesn't stop writes.
+func (d *DeadLetter) diskAllows() bool {
+	if d.maxDiskPercent <= 0 {
+		return true
+	}
+	dir := filepath.Dir(d.path)
+	used, err := diskUsedPercent(dir)
+	if err != nil || used < d.maxDiskPercent {
+		return true
+	}
+	if d.overflow == DeadLetterDropOldest && os.Remove(d.path+".1") == nil {
+		used, err = diskUsedPercent(dir)
+		return err != nil || used < d.maxDiskPercent
+	}
+	return false
+}
+
+// Replay resends the batches in the dead-letter file and its rotated
+// predecessor, oldest first. The files are moved aside to <file>.replay
+// first, so a running tailer keeps writing to a new file; a .replay file
+// left by an interrupted replay is resent in place of the file it came
+// from. Batches that fail again are written back with Replays counted, to
+// be picked up by the next replay rather than this one.
+func (d *DeadLetter) Replay(ctx context.Context, sender BatchSender, logger *zap.Logger) (ReplayResult, error) {
+	var result ReplayResult
+	var files []string
+	for _, path := range []string{d.path + ".1", d.path} {
+		replaying := path + ".replay"
+		if _, err := os.Stat(replaying); err == nil {
+			logger.Info("Resuming interrupted replay", zap.String("file", replaying))
+		} else if err := os.Rename(path, replaying); errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return result, fmt.Errorf("failed to move %s aside: %w", path, err)
+		}
+		files = append(files, replaying)
+	}
+
+	for _, file := range files {
+		if err := d.replayFile(ctx, file, sender, &result, logger); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// replayFile resends the batches in one file and removes it
+func (d *DeadLetter) replayFile(ctx context.Context, file string, sender BatchSender, result *ReplayResult, logger *zap.Logger) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", file, err)
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if err := d.replayLine(ctx, line, sender, result, logger); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", file, err)
+		}
+	}
+
+	f.Close()
+	if err := os.Remove(file); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", file, err)
+	}
+	return nil
+}
+
+// replayLine resends one record, writing it back if it fails again. Once
+// ctx is done, records are written back without being sent.
+func (d *DeadLetter) replayLine(ctx context.Context, line []byte, sender BatchSender, result *ReplayResult, logger *zap.Logger) error {
+	if line[len(line)-1] != '\n' {
+		line = append(line, '\n')
+	}
+	var record DeadLetterRecord
+	if err := json.Unmarshal(line, &record); err != nil || len(record.Batch.Entries) == 0 {
+		result.Malformed++
+		return d.append(line)
+	}
+
+	if ctx.Err() != nil {
+		result.Failed++
+		return d.append(line)
+	}
+	err := sender.SendBatch(ctx, record.Batch)
+	if err == nil {
+		result.Sent++
+		return nil
+	}
+
+	logger.Warn("Replayed batch failed again",
+		zap.Error(err),
+		zap.String("service", record.Batch.ServiceName),
+		zap.String("batch_id", record.Batch.BatchID),
+		zap.Int("size", len(record.Batch.Entries)))
+	failed := NewDeadLetterRecord(record.Batch, err)
+	failed.Replays = record.Replays + 1
+	result.Failed++
+	return d.Write(failed)
+}
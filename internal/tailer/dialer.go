@@ -0,0 +1,155 @@
+package tailer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// DialFunc opens network connections, as used by http.Transport.DialContext
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// NewDialFunc returns a dialer honoring an address-family preference:
+//
+//	any          system ordering with standard happy-eyeballs fallback
+//	ipv4, ipv6   only that family
+//	prefer_ipv4  happy eyeballs, IPv4 attempted first
+//	prefer_ipv6  happy eyeballs, IPv6 attempted first
+//
+// With a preference, the other family is raced after fallbackDelay, and
+// the first connection to succeed wins.
+func NewDialFunc(family string, fallbackDelay, timeout time.Duration) (DialFunc, error) {
+	dialer := &net.Dialer{
+		Timeout:       timeout,
+		KeepAlive:     30 * time.Second,
+		FallbackDelay: fallbackDelay,
+	}
+
+	switch family {
+	case "", "any":
+		return dialer.DialContext, nil
+	case "ipv4", "ipv6":
+		suffix := "4"
+		if family == "ipv6" {
+			suffix = "6"
+		}
+		return func(ctx context.Context, network, address string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network+suffix, address)
+		}, nil
+	case "prefer_ipv4", "prefer_ipv6":
+		preferV6 := family == "prefer_ipv6"
+		return func(ctx context.Context, network, address string) (net.Conn, error) {
+			return dialPreferred(ctx, dialer, network, address, preferV6, fallbackDelay)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported ip family %q, expected any, ipv4, ipv6, prefer_ipv4, or prefer_ipv6", family)
+	}
+}
+
+// dialResult is the outcome of one family's connection attempt
+type dialResult struct {
+	conn    net.Conn
+	err     error
+	primary bool
+}
+
+// dialPreferred resolves address and races the preferred family against
+// the other one, started after fallbackDelay or as soon as the preferred
+// family fails
+func dialPreferred(ctx context.Context, dialer *net.Dialer, network, address string, preferV6 bool, fallbackDelay time.Duration) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var primaries, fallbacks []string
+	for _, addr := range addrs {
+		target := net.JoinHostPort(addr.IP.String(), port)
+		if (addr.IP.To4() == nil) == preferV6 {
+			primaries = append(primaries, target)
+		} else {
+			fallbacks = append(fallbacks, target)
+		}
+	}
+	if len(primaries) == 0 {
+		primaries, fallbacks = fallbacks, nil
+	}
+	if len(fallbacks) == 0 {
+		return dialSerial(ctx, dialer, network, primaries)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan dialResult, 2)
+	start := func(targets []string, primary bool) {
+		conn, err := dialSerial(ctx, dialer, network, targets)
+		results <- dialResult{conn: conn, err: err, primary: primary}
+	}
+
+	go start(primaries, true)
+	fallbackTimer := time.NewTimer(fallbackDelay)
+	defer fallbackTimer.Stop()
+
+	fallbackStarted := false
+	var firstErr error
+	for pending := 1; pending > 0; {
+		select {
+		case <-fallbackTimer.C:
+			if !fallbackStarted {
+				fallbackStarted = true
+				pending++
+				go start(fallbacks, false)
+			}
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				// Close a connection that loses the race
+				go drainResults(results, pending)
+				return res.conn, nil
+			}
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			if res.primary && !fallbackStarted {
+				fallbackStarted = true
+				pending++
+				go start(fallbacks, false)
+			}
+		}
+	}
+	return nil, firstErr
+}
+
+// dialSerial tries each target in order, returning the first connection
+func dialSerial(ctx context.Context, dialer *net.Dialer, network string, targets []string) (net.Conn, error) {
+	var firstErr error
+	for _, target := range targets {
+		conn, err := dialer.DialContext(ctx, network, target)
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr == nil {
+		firstErr = fmt.Errorf("no addresses to dial")
+	}
+	return nil, firstErr
+}
+
+// drainResults closes connections from attempts still in flight
+func drainResults(results <-chan dialResult, pending int) {
+	for ; pending > 0; pending-- {
+		if res := <-results; res.conn != nil {
+			res.conn.Close()
+		}
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+
+package tailer
+
+import "syscall"
+
+// diskUsedPercent returns how full the filesystem holding dir is, counted
+// as df does
+func diskUsedPercent(dir string) (float64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	used := uint64(stat.Blocks) - uint64(stat.Bfree)
+	total := used + uint64(stat.Bavail)
+	if total == 0 {
+		return 0, nil
+	}
+	return float64(used) * 100 / float64(total), nil
+}
@@ -0,0 +1,21 @@
+//go:build windows
+
+package tailer
+
+import "golang.org/x/sys/windows"
+
+// diskUsedPercent returns how full the volume holding dir is
+func diskUsedPercent(dir string) (float64, error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+	var available, total, free uint64
+	if err := windows.GetDiskFreeSpaceEx(path, &available, &total, &free); err != nil {
+		return 0, err
+	}
+	if total == 0 {
+		return 0, nil
+	}
+	return float64(total-available) * 100 / float64(total), nil
+}
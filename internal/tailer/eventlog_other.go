@@ -0,0 +1,26 @@
+//go:build !windows
+
+package tailer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/oicur0t/logl/pkg/models"
+	"go.uber.org/zap"
+)
+
+// EventLogReader is unavailable outside Windows
+type EventLogReader struct {
+	channel string
+}
+
+// NewEventLogReader creates a reader that fails on start on non-Windows platforms
+func NewEventLogReader(channel, query, serviceName, hostname string, logger *zap.Logger, lineChan chan<- models.LogEntry) *EventLogReader {
+	return &EventLogReader{channel: channel}
+}
+
+// Start always fails since the Windows Event Log is not available
+func (r *EventLogReader) Start(ctx context.Context) error {
+	return fmt.Errorf("event log channel %s: Windows Event Log input is only supported on Windows", r.channel)
+}
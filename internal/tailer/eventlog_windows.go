@@ -0,0 +1,184 @@
+//go:build windows
+
+package tailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"unsafe"
+
+	"github.com/oicur0t/logl/pkg/models"
+	"go.uber.org/zap"
+	"golang.org/x/sys/windows"
+)
+
+var (
+	modwevtapi       = windows.NewLazySystemDLL("wevtapi.dll")
+	procEvtSubscribe = modwevtapi.NewProc("EvtSubscribe")
+	procEvtNext      = modwevtapi.NewProc("EvtNext")
+	procEvtRender    = modwevtapi.NewProc("EvtRender")
+	procEvtClose     = modwevtapi.NewProc("EvtClose")
+)
+
+const (
+	evtSubscribeToFutureEvents = 1
+	evtRenderEventXML          = 1
+	eventBatchSize             = 16
+)
+
+// EventLogReader subscribes to a Windows Event Log channel and sends each
+// event, rendered as XML, to a channel as a log entry
+type EventLogReader struct {
+	channel     string
+	query       string
+	serviceName string
+	hostname    string
+	logger      *zap.Logger
+	lineChan    chan<- models.LogEntry
+}
+
+// NewEventLogReader creates a new Windows Event Log reader
+func NewEventLogReader(channel, query, serviceName, hostname string, logger *zap.Logger, lineChan chan<- models.LogEntry) *EventLogReader {
+	if query == "" {
+		query = "*"
+	}
+	return &EventLogReader{
+		channel:     channel,
+		query:       query,
+		serviceName: serviceName,
+		hostname:    hostname,
+		logger:      logger,
+		lineChan:    lineChan,
+	}
+}
+
+// Start subscribes to new events on the channel until the context is cancelled
+func (r *EventLogReader) Start(ctx context.Context) error {
+	r.logger.Info("Subscribing to event log", zap.String("channel", r.channel), zap.String("query", r.query))
+
+	// Manual-reset event, signalled by the subscription when events are available
+	signal, err := windows.CreateEvent(nil, 1, 1, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create signal event: %w", err)
+	}
+	defer windows.CloseHandle(signal)
+
+	channelPtr, err := windows.UTF16PtrFromString(r.channel)
+	if err != nil {
+		return fmt.Errorf("invalid event log channel %q: %w", r.channel, err)
+	}
+	queryPtr, err := windows.UTF16PtrFromString(r.query)
+	if err != nil {
+		return fmt.Errorf("invalid event log query %q: %w", r.query, err)
+	}
+
+	sub, _, callErr := procEvtSubscribe.Call(
+		0,
+		uintptr(signal),
+		uintptr(unsafe.Pointer(channelPtr)),
+		uintptr(unsafe.Pointer(queryPtr)),
+		0,
+		0,
+		0,
+		evtSubscribeToFutureEvents,
+	)
+	if sub == 0 {
+		return fmt.Errorf("failed to subscribe to event log %s: %w", r.channel, callErr)
+	}
+	defer procEvtClose.Call(sub)
+
+	var recordNumber int64
+	for {
+		if ctx.Err() != nil {
+			r.logger.Info("Stopping event log subscription", zap.String("channel", r.channel))
+			return ctx.Err()
+		}
+
+		// Wake up periodically to notice cancellation
+		event, err := windows.WaitForSingleObject(signal, 1000)
+		if err != nil {
+			return fmt.Errorf("failed waiting for events on %s: %w", r.channel, err)
+		}
+		if event == uint32(windows.WAIT_TIMEOUT) {
+			continue
+		}
+
+		if err := r.drain(ctx, sub, signal, &recordNumber); err != nil {
+			return err
+		}
+	}
+}
+
+// drain reads all available events from the subscription
+func (r *EventLogReader) drain(ctx context.Context, sub uintptr, signal windows.Handle, recordNumber *int64) error {
+	handles := make([]uintptr, eventBatchSize)
+	for {
+		var returned uint32
+		ok, _, callErr := procEvtNext.Call(
+			sub,
+			eventBatchSize,
+			uintptr(unsafe.Pointer(&handles[0])),
+			0,
+			0,
+			uintptr(unsafe.Pointer(&returned)),
+		)
+		if ok == 0 {
+			if errors.Is(callErr, windows.ERROR_NO_MORE_ITEMS) {
+				return windows.ResetEvent(signal)
+			}
+			return fmt.Errorf("failed to read events from %s: %w", r.channel, callErr)
+		}
+
+		for i := 0; i < int(returned); i++ {
+			xml, err := renderEvent(handles[i])
+			procEvtClose.Call(handles[i])
+			if err != nil {
+				r.logger.Warn("Failed to render event", zap.String("channel", r.channel), zap.Error(err))
+				continue
+			}
+
+			*recordNumber++
+			entry := models.LogEntry{
+				ServiceName: r.serviceName,
+				Hostname:    r.hostname,
+				FilePath:    "eventlog:" + r.channel,
+				Line:        xml,
+				Timestamp:   time.Now(),
+				LineNumber:  *recordNumber,
+			}
+
+			select {
+			case r.lineChan <- entry:
+			case <-ctx.Done():
+				for _, h := range handles[i+1 : returned] {
+					procEvtClose.Call(h)
+				}
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// renderEvent renders an event handle as XML
+func renderEvent(event uintptr) (string, error) {
+	var used, propertyCount uint32
+
+	// First call reports the required buffer size
+	procEvtRender.Call(0, event, evtRenderEventXML, 0, 0,
+		uintptr(unsafe.Pointer(&used)), uintptr(unsafe.Pointer(&propertyCount)))
+	if used == 0 {
+		return "", fmt.Errorf("failed to size event buffer")
+	}
+
+	buf := make([]uint16, used/2+1)
+	ok, _, callErr := procEvtRender.Call(0, event, evtRenderEventXML,
+		uintptr(len(buf)*2), uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(unsafe.Pointer(&used)), uintptr(unsafe.Pointer(&propertyCount)))
+	if ok == 0 {
+		return "", fmt.Errorf("failed to render event: %w", callErr)
+	}
+
+	return windows.UTF16ToString(buf), nil
+}
@@ -0,0 +1,79 @@
+package tailer
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// LineFilter decides which lines are shipped using include/exclude regexes
+type LineFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// NewLineFilter compiles include and exclude patterns. It returns nil when
+// both lists are empty so callers can skip filtering entirely.
+func NewLineFilter(include, exclude []string) (*LineFilter, error) {
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil, nil
+	}
+
+	f := &LineFilter{}
+	for _, pattern := range include {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include pattern %q: %w", pattern, err)
+		}
+		f.include = append(f.include, re)
+	}
+	for _, pattern := range exclude {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+		}
+		f.exclude = append(f.exclude, re)
+	}
+
+	return f, nil
+}
+
+// Allow reports whether a line should be shipped. A line must match at least
+// one include pattern (if any are configured) and no exclude pattern.
+func (f *LineFilter) Allow(line string) bool {
+	for _, re := range f.exclude {
+		if re.MatchString(line) {
+			return false
+		}
+	}
+
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, re := range f.include {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameFilter reports whether two filters have the same patterns
+func sameFilter(a, b *LineFilter) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return samePatterns(a.include, b.include) && samePatterns(a.exclude, b.exclude)
+}
+
+// samePatterns reports whether two regex lists are the same, in order
+func samePatterns(a, b []*regexp.Regexp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].String() != b[i].String() {
+			return false
+		}
+	}
+	return true
+}
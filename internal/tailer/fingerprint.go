@@ -0,0 +1,95 @@
+package tailer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+
+	"github.com/oicur0t/logl/pkg/models"
+)
+
+// fingerprintBytes is how much of the start of a file identifies it
+const fingerprintBytes = 1024
+
+// fileIdentity tells generations of a log path apart: the file's inode,
+// where the platform has one, and a hash of its first bytes, which a copy
+// or compressed copy keeps and a recreated file almost never shares
+type fileIdentity struct {
+	inode       uint64
+	fingerprint string
+	size        int64 // Bytes hashed; fewer than fingerprintBytes while the file is short
+}
+
+// identify returns the identity of the file at path. A compressed rotated
+// file is fingerprinted by its decompressed content.
+func identify(path string) (fileIdentity, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return fileIdentity{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fileIdentity{}, err
+	}
+	r, err := decompress(path, f)
+	if err != nil {
+		return fileIdentity{}, err
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, io.LimitReader(r, fingerprintBytes))
+	if err != nil {
+		return fileIdentity{}, err
+	}
+	return fileIdentity{
+		inode:       fileInode(f, info),
+		fingerprint: hex.EncodeToString(h.Sum(nil)),
+		size:        n,
+	}, nil
+}
+
+// stateIdentity returns the identity saved with a file's state
+func stateIdentity(state *models.FileState) fileIdentity {
+	return fileIdentity{inode: state.Inode, fingerprint: state.Fingerprint, size: state.FingerprintSize}
+}
+
+// known reports whether the identity was recorded. State saved before
+// fingerprints were kept has none, and an empty file's says nothing.
+func (id fileIdentity) known() bool {
+	return id.fingerprint != "" && id.size > 0
+}
+
+// sameFile reports whether path still holds the identified file: the same
+// inode, where both are known, starting with the same bytes
+func (id fileIdentity) sameFile(path string) bool {
+	current, err := identify(path)
+	if err != nil || (id.inode != 0 && current.inode != 0 && id.inode != current.inode) {
+		return false
+	}
+	return id.sameContent(path)
+}
+
+// sameContent reports whether the file at path starts with the identified
+// file's bytes, as a renamed, copied, or compressed file does
+func (id fileIdentity) sameContent(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	r, err := decompress(path, f)
+	if err != nil {
+		return false
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	if n, err := io.Copy(h, io.LimitReader(r, id.size)); err != nil || n < id.size {
+		return false
+	}
+	return hex.EncodeToString(h.Sum(nil)) == id.fingerprint
+}
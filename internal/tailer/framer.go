@@ -0,0 +1,101 @@
+package tailer
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// maxFramedLines bounds how many lines a single JSON document may span
+// before the framer gives up and emits the buffered text as-is
+const maxFramedLines = 1000
+
+// JSONFramer reassembles JSON documents that span several lines, such as
+// pretty-printed JSON logs, by tracking brace and bracket balance.
+// Lines outside a document are passed through unchanged.
+type JSONFramer struct {
+	maxLines int
+	buf      strings.Builder
+	lines    int
+	depth    int
+	inString bool
+	escaped  bool
+}
+
+// NewJSONFramer creates a new JSON framer
+func NewJSONFramer(maxLines int) *JSONFramer {
+	return &JSONFramer{maxLines: maxLines}
+}
+
+// Pending reports whether a partial document is buffered
+func (f *JSONFramer) Pending() bool {
+	return f.lines > 0
+}
+
+// Push feeds one line to the framer. It returns the completed entry and true
+// when the line finishes a document (or is not part of one), otherwise false.
+func (f *JSONFramer) Push(line string) (string, bool) {
+	if !f.Pending() {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+			return line, true
+		}
+	}
+
+	if f.Pending() {
+		f.buf.WriteByte('\n')
+	}
+	f.buf.WriteString(line)
+	f.lines++
+	f.scan(line)
+
+	if f.depth > 0 && f.lines < f.maxLines {
+		return "", false
+	}
+
+	return f.flush(), true
+}
+
+// scan updates nesting depth, ignoring braces inside strings
+func (f *JSONFramer) scan(line string) {
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if f.inString {
+			switch {
+			case f.escaped:
+				f.escaped = false
+			case c == '\\':
+				f.escaped = true
+			case c == '"':
+				f.inString = false
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			f.inString = true
+		case '{', '[':
+			f.depth++
+		case '}', ']':
+			f.depth--
+		}
+	}
+}
+
+// flush returns the buffered document, compacted to one line when it is
+// valid JSON, and resets the framer
+func (f *JSONFramer) flush() string {
+	raw := f.buf.String()
+	f.buf.Reset()
+	f.lines = 0
+	f.depth = 0
+	f.inString = false
+	f.escaped = false
+
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, []byte(raw)); err == nil {
+		return compact.String()
+	}
+	return raw
+}
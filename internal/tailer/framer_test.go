@@ -0,0 +1,156 @@
+package tailer
+
+import (
+	"reflect"
+	"testing"
+)
+
+// frame pushes lines through a framer, returning the entries it emits and
+// whether a document is still buffered at the end
+func frame(f *JSONFramer, lines []string) ([]string, bool) {
+	var out []string
+	for _, line := range lines {
+		if entry, ok := f.Push(line); ok {
+			out = append(out, entry)
+		}
+	}
+	return out, f.Pending()
+}
+
+func TestJSONFramer(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxLines int // Defaults to maxFramedLines
+		lines    []string
+		want     []string
+		pending  bool
+	}{
+		{
+			name:  "plain lines pass through",
+			lines: []string{"starting up", "  indented", ""},
+			want:  []string{"starting up", "  indented", ""},
+		},
+		{
+			name:  "single-line document is compacted",
+			lines: []string{`  { "a": 1, "b": [1, 2] }  `},
+			want:  []string{`{"a":1,"b":[1,2]}`},
+		},
+		{
+			name:  "pretty-printed document",
+			lines: []string{"{", `  "level": "info",`, `  "msg": "hi"`, "}", "after"},
+			want:  []string{`{"level":"info","msg":"hi"}`, "after"},
+		},
+		{
+			name: "nested objects and arrays",
+			lines: []string{
+				`{"request": {`,
+				`  "headers": [{"k": "a"}, {"k": "b"}],`,
+				`  "body": {"items": [[1, 2], [3, [4]]]}`,
+				`}}`,
+			},
+			want: []string{`{"request":{"headers":[{"k":"a"},{"k":"b"}],"body":{"items":[[1,2],[3,[4]]]}}}`},
+		},
+		{
+			name:  "top-level array",
+			lines: []string{"[", `  {"a": 1},`, `  {"b": 2}`, "]"},
+			want:  []string{`[{"a":1},{"b":2}]`},
+		},
+		{
+			name:  "braces inside strings",
+			lines: []string{`{"msg": "unclosed { and [",`, `"other": "}}]]"`, `}`},
+			want:  []string{`{"msg":"unclosed { and [","other":"}}]]"}`},
+		},
+		{
+			name:  "escaped quotes before braces",
+			lines: []string{`{"msg": "say \"}\" twice",`, `"n": 1}`},
+			want:  []string{`{"msg":"say \"}\" twice","n":1}`},
+		},
+		{
+			name:  "escaped backslash ends the string",
+			lines: []string{`{"path": "C:\\",`, `"n": 1}`},
+			want:  []string{`{"path":"C:\\","n":1}`},
+		},
+		{
+			name:  "escaped unicode",
+			lines: []string{`{"msg": "\u007b\"",`, `"n": 1}`},
+			want:  []string{`{"msg":"\u007b\"","n":1}`},
+		},
+		{
+			name:  "string split across lines",
+			lines: []string{`{"msg": "first \`, `} half"}`, `next`},
+			want:  []string{"{\"msg\": \"first \\\n} half\"}", "next"},
+		},
+		{
+			name:  "consecutive documents",
+			lines: []string{"{", `"a": 1`, "}", `{"b":`, "2}"},
+			want:  []string{`{"a":1}`, `{"b":2}`},
+		},
+		{
+			name:  "bracketed text that isn't JSON",
+			lines: []string{"[INFO] started", "{not json}"},
+			want:  []string{"[INFO] started", "{not json}"},
+		},
+		{
+			name:  "extra closing braces",
+			lines: []string{`{"a": 1}}`, "next"},
+			want:  []string{`{"a": 1}}`, "next"},
+		},
+		{
+			name:    "incomplete document stays buffered",
+			lines:   []string{`{"a": {`, `"b": 1`},
+			pending: true,
+		},
+		{
+			name:     "over-long document is emitted raw",
+			maxLines: 3,
+			lines:    []string{"{", `"a": 1,`, `"b": 2,`, `"c": 3`, "}"},
+			want:     []string{"{\n\"a\": 1,\n\"b\": 2,", `"c": 3`, "}"},
+		},
+		{
+			name:     "document at the line limit",
+			maxLines: 3,
+			lines:    []string{"{", `"a": 1`, "}"},
+			want:     []string{`{"a":1}`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			maxLines := tt.maxLines
+			if maxLines == 0 {
+				maxLines = maxFramedLines
+			}
+			got, pending := frame(NewJSONFramer(maxLines), tt.lines)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entries = %q, want %q", got, tt.want)
+			}
+			if pending != tt.pending {
+				t.Errorf("Pending() = %v, want %v", pending, tt.pending)
+			}
+		})
+	}
+}
+
+func TestJSONFramerSplits(t *testing.T) {
+	// However a document is broken into lines, the framer reassembles the
+	// same entry, including when a split lands inside a string or escape
+	doc := `{"msg":"a \"{[\" b","nested":{"list":[1,{"x":"\\"}],"empty":{}},"tail":"]}"}`
+	for i := 1; i < len(doc); i++ {
+		f := NewJSONFramer(maxFramedLines)
+		first, ok := f.Push(doc[:i])
+		if ok {
+			t.Fatalf("split at %d: first half emitted %q", i, first)
+		}
+		got, ok := f.Push(doc[i:])
+		if !ok {
+			t.Fatalf("split at %d: document still pending", i)
+		}
+		// Compaction only succeeds when the split falls between tokens,
+		// otherwise the lines come back joined as-is
+		if got != doc && got != doc[:i]+"\n"+doc[i:] {
+			t.Errorf("split at %d: entry = %q", i, got)
+		}
+		if f.Pending() {
+			t.Errorf("split at %d: framer still pending after the document", i)
+		}
+	}
+}
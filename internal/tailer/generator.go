@@ -0,0 +1,140 @@
+package tailer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/oicur0t/logl/pkg/models"
+	"go.uber.org/zap"
+)
+
+// generatorTick is how often a generator emits; higher rates emit several
+// lines per tick
+const generatorTick = 10 * time.Millisecond
+
+// Sample values used to build fake lines
+var (
+	generatorLevels   = []string{"debug", "info", "info", "info", "warn", "error"}
+	generatorMethods  = []string{"GET", "GET", "GET", "POST", "PUT", "DELETE"}
+	generatorPaths    = []string{"/", "/api/users", "/api/orders", "/api/orders/42", "/login", "/static/app.js", "/health"}
+	generatorStatuses = []int{200, 200, 200, 201, 204, 301, 400, 401, 404, 500, 503}
+	generatorMessages = []string{"request completed", "cache miss", "user logged in", "order created", "retrying upstream call", "connection reset by peer", "slow query detected"}
+	generatorAgents   = []string{"Mozilla/5.0 (X11; Linux x86_64)", "curl/8.4.0", "Go-http-client/1.1"}
+	generatorWords    = []string{"alpha", "bravo", "charlie", "delta", "echo", "foxtrot", "golf", "hotel", "india", "juliet"}
+)
+
+// Generator emits synthetic log lines for demos and load testing
+type Generator struct {
+	format      string // json, apache, or random
+	rate        float64
+	count       int64 // 0 emits until cancelled
+	serviceName string
+	hostname    string
+	logger      *zap.Logger
+	lineChan    chan<- models.LogEntry
+	rand        *rand.Rand
+}
+
+// NewGenerator creates a new synthetic line generator emitting rate lines per second
+func NewGenerator(format string, rate float64, count int64, serviceName, hostname string, logger *zap.Logger, lineChan chan<- models.LogEntry) *Generator {
+	return &Generator{
+		format:      format,
+		rate:        rate,
+		count:       count,
+		serviceName: serviceName,
+		hostname:    hostname,
+		logger:      logger,
+		lineChan:    lineChan,
+		rand:        rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Start emits lines until the context is cancelled or count lines are sent
+func (g *Generator) Start(ctx context.Context) error {
+	g.logger.Info("Generating log lines",
+		zap.String("format", g.format),
+		zap.Float64("rate", g.rate),
+		zap.String("service", g.serviceName))
+
+	ticker := time.NewTicker(generatorTick)
+	defer ticker.Stop()
+
+	source := "generator://" + g.format
+	perTick := g.rate * generatorTick.Seconds()
+	var owed float64
+	var lineNumber int64
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		// Carry fractional lines over so low rates still emit
+		owed += perTick
+		for ; owed >= 1; owed-- {
+			lineNumber++
+			now := time.Now()
+			entry := models.LogEntry{
+				ServiceName: g.serviceName,
+				Hostname:    g.hostname,
+				FilePath:    source,
+				Line:        g.line(now),
+				Timestamp:   now,
+				LineNumber:  lineNumber,
+			}
+
+			select {
+			case g.lineChan <- entry:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
+			if g.count > 0 && lineNumber >= g.count {
+				g.logger.Info("Generator finished", zap.Int64("lines", lineNumber))
+				return nil
+			}
+		}
+	}
+}
+
+// line builds a fake line in the generator's format
+func (g *Generator) line(now time.Time) string {
+	switch g.format {
+	case "json":
+		data, _ := json.Marshal(map[string]interface{}{
+			"timestamp":   now.Format(time.RFC3339Nano),
+			"level":       pick(g.rand, generatorLevels),
+			"message":     pick(g.rand, generatorMessages),
+			"request_id":  fmt.Sprintf("%016x", g.rand.Uint64()),
+			"user_id":     g.rand.Intn(1000),
+			"duration_ms": g.rand.Intn(2000),
+		})
+		return string(data)
+	case "apache":
+		return fmt.Sprintf(`%d.%d.%d.%d - - [%s] "%s %s HTTP/1.1" %d %d "-" "%s"`,
+			10, g.rand.Intn(256), g.rand.Intn(256), 1+g.rand.Intn(254),
+			now.Format("02/Jan/2006:15:04:05 -0700"),
+			pick(g.rand, generatorMethods),
+			pick(g.rand, generatorPaths),
+			generatorStatuses[g.rand.Intn(len(generatorStatuses))],
+			g.rand.Intn(50000),
+			pick(g.rand, generatorAgents))
+	default:
+		words := make([]string, 3+g.rand.Intn(10))
+		for i := range words {
+			words[i] = pick(g.rand, generatorWords)
+		}
+		return strings.ToUpper(pick(g.rand, generatorLevels)) + " " + strings.Join(words, " ")
+	}
+}
+
+// pick returns a random element
+func pick(r *rand.Rand, values []string) string {
+	return values[r.Intn(len(values))]
+}
@@ -0,0 +1,64 @@
+package tailer
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+// HashRing maps stream keys onto a fixed set of nodes using consistent hashing
+type HashRing struct {
+	points []uint32
+	owners map[uint32]int // ring point -> node index
+	nodes  int
+}
+
+// NewHashRing creates a ring for the given nodes with virtualNodes points per node
+func NewHashRing(nodes []string, virtualNodes int) *HashRing {
+	if virtualNodes <= 0 {
+		virtualNodes = 1
+	}
+
+	r := &HashRing{
+		owners: make(map[uint32]int, len(nodes)*virtualNodes),
+		nodes:  len(nodes),
+	}
+
+	for i, node := range nodes {
+		for v := 0; v < virtualNodes; v++ {
+			point := crc32.ChecksumIEEE([]byte(node + "#" + strconv.Itoa(v)))
+			if _, taken := r.owners[point]; taken {
+				continue
+			}
+			r.owners[point] = i
+			r.points = append(r.points, point)
+		}
+	}
+
+	sort.Slice(r.points, func(a, b int) bool { return r.points[a] < r.points[b] })
+	return r
+}
+
+// Lookup returns every node index ordered by preference for the given key.
+// The first index owns the key; the rest are the successors that take over
+// when the owner is unavailable, so keys only move when their owner changes.
+func (r *HashRing) Lookup(key string) []int {
+	if len(r.points) == 0 {
+		return nil
+	}
+
+	hash := crc32.ChecksumIEEE([]byte(key))
+	start := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= hash })
+
+	order := make([]int, 0, r.nodes)
+	seen := make(map[int]bool, r.nodes)
+	for i := 0; i < len(r.points) && len(order) < r.nodes; i++ {
+		owner := r.owners[r.points[(start+i)%len(r.points)]]
+		if !seen[owner] {
+			seen[owner] = true
+			order = append(order, owner)
+		}
+	}
+
+	return order
+}
@@ -0,0 +1,423 @@
+//go:build linux
+
+package tailer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/oicur0t/logl/pkg/models"
+	"go.uber.org/zap"
+)
+
+const (
+	kmsgPath   = "/dev/kmsg"
+	bootIDPath = "/proc/sys/kernel/random/boot_id"
+)
+
+var (
+	// e.g. "Out of memory: Killed process 1234 (java) total-vm:..."
+	oomKillPattern = regexp.MustCompile(`(?:Out of memory|Memory cgroup out of memory): Killed process (\d+) \((.+?)\)`)
+	// e.g. "java[1234]: segfault at 0 ip ..." or "traps: java[1234] general protection fault ..."
+	crashPattern = regexp.MustCompile(`^(?:traps: )?(.+?)\[(\d+)\]:? (segfault at|general protection|trap )`)
+)
+
+// hostEventsState is the persisted position of the host-events reader
+type hostEventsState struct {
+	BootID       string    `json:"boot_id"`
+	KmsgSeq      uint64    `json:"kmsg_seq"`      // Last kernel message read during BootID
+	CoredumpTime time.Time `json:"coredump_time"` // Modification time of the newest coredump shipped
+	LastSeen     time.Time `json:"last_seen"`     // When the reader last ran, bounding downtime across reboots
+}
+
+// HostEventsReader ships host-level events that explain gaps in
+// application logs: OOM-killer kills and segfaults from the kernel log,
+// coredumps written by systemd-coredump, and a marker for each reboot.
+// Entries carry a host_event label and IDs derived from the boot ID, so
+// events reread after a restart are dropped by the server.
+type HostEventsReader struct {
+	coredumpDir  string
+	pollInterval time.Duration
+	serviceName  string
+	hostname     string
+	stateFile    string
+	logger       *zap.Logger
+	lineChan     chan<- models.LogEntry
+
+	bootID   string
+	bootTime time.Time
+
+	mu    sync.Mutex
+	state hostEventsState
+}
+
+// NewHostEventsReader creates a new host-events reader. An empty
+// coredumpDir disables coredump events.
+func NewHostEventsReader(coredumpDir string, pollInterval time.Duration, serviceName, hostname, stateFile string, logger *zap.Logger, lineChan chan<- models.LogEntry) *HostEventsReader {
+	return &HostEventsReader{
+		coredumpDir:  coredumpDir,
+		pollInterval: pollInterval,
+		serviceName:  serviceName,
+		hostname:     hostname,
+		stateFile:    stateFile,
+		logger:       logger,
+		lineChan:     lineChan,
+	}
+}
+
+// HostEventsStateFile returns the host-events state file, next to the
+// tailer's state file
+func HostEventsStateFile(stateFile string) string {
+	return filepath.Join(filepath.Dir(stateFile), "host-events.json")
+}
+
+// Start reads the kernel log and scans for coredumps until the context is
+// cancelled
+func (r *HostEventsReader) Start(ctx context.Context) error {
+	bootID, err := os.ReadFile(bootIDPath)
+	if err != nil {
+		return fmt.Errorf("failed to read boot ID: %w", err)
+	}
+	r.bootID = strings.TrimSpace(string(bootID))
+	if r.bootTime, err = readBootTime(); err != nil {
+		return err
+	}
+
+	if err := r.loadState(); err != nil {
+		r.logger.Warn("Failed to load host-events state, starting fresh", zap.Error(err))
+	}
+
+	if r.state.BootID != "" && r.state.BootID != r.bootID {
+		if err := r.send(ctx, r.rebootEntry()); err != nil {
+			return err
+		}
+		r.state.KmsgSeq = 0
+	}
+	r.state.BootID = r.bootID
+	// Coredumps from before the first run are not shipped
+	if r.state.CoredumpTime.IsZero() {
+		r.state.CoredumpTime = time.Now()
+	}
+
+	r.logger.Info("Reading host events",
+		zap.String("boot_id", r.bootID),
+		zap.Time("boot_time", r.bootTime),
+		zap.String("coredump_dir", r.coredumpDir))
+
+	go func() {
+		if err := r.readKmsg(ctx); err != nil && ctx.Err() == nil {
+			r.logger.Error("Failed to read kernel log, OOM and segfault events are disabled", zap.Error(err))
+		}
+	}()
+
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.scanCoredumps(ctx); err != nil && ctx.Err() == nil {
+			r.logger.Error("Failed to scan coredumps", zap.String("dir", r.coredumpDir), zap.Error(err))
+		}
+
+		r.mu.Lock()
+		r.state.LastSeen = time.Now()
+		err := r.saveState()
+		r.mu.Unlock()
+		if err != nil {
+			r.logger.Warn("Failed to save host-events state", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// rebootEntry marks the boot that started since the state was saved
+func (r *HostEventsReader) rebootEntry() models.LogEntry {
+	line := fmt.Sprintf("Host booted at %s (boot %s), previous boot %s",
+		r.bootTime.UTC().Format(time.RFC3339), r.bootID, r.state.BootID)
+	if !r.state.LastSeen.IsZero() {
+		line += " last seen at " + r.state.LastSeen.UTC().Format(time.RFC3339)
+	}
+	return models.LogEntry{
+		FilePath:  bootIDPath,
+		Line:      line,
+		Timestamp: r.bootTime,
+		EntryID:   "boot-" + r.bootID,
+		Labels: map[string]string{
+			"host_event":       "reboot",
+			"boot_id":          r.bootID,
+			"previous_boot_id": r.state.BootID,
+		},
+	}
+}
+
+// readKmsg ships OOM kills and crashes from the kernel log, starting
+// after the last message read during this boot
+func (r *HostEventsReader) readKmsg(ctx context.Context) error {
+	// Non-blocking so closing the file interrupts a pending read
+	f, err := os.OpenFile(kmsgPath, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", kmsgPath, err)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		f.Close()
+	}()
+
+	// Each read returns one record
+	buf := make([]byte, 8192)
+	for {
+		n, err := f.Read(buf)
+		switch {
+		case errors.Is(err, syscall.EPIPE):
+			r.logger.Warn("Kernel log messages were overwritten before they were read")
+			continue
+		case errors.Is(err, syscall.EAGAIN):
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Second):
+			}
+			continue
+		case err != nil:
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("failed to read %s: %w", kmsgPath, err)
+		}
+
+		seq, sinceBoot, message, ok := parseKmsg(string(buf[:n]))
+		if !ok {
+			continue
+		}
+
+		r.mu.Lock()
+		skip := seq <= r.state.KmsgSeq && r.state.KmsgSeq > 0
+		if !skip {
+			r.state.KmsgSeq = seq
+		}
+		r.mu.Unlock()
+		if skip {
+			continue
+		}
+
+		if entry, ok := r.kmsgEntry(seq, sinceBoot, message); ok {
+			if err := r.send(ctx, entry); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// kmsgEntry converts a kernel message into an entry if it reports an OOM
+// kill or a crash
+func (r *HostEventsReader) kmsgEntry(seq uint64, sinceBoot time.Duration, message string) (models.LogEntry, bool) {
+	labels := map[string]string{"boot_id": r.bootID}
+	if m := oomKillPattern.FindStringSubmatch(message); m != nil {
+		labels["host_event"] = "oom_kill"
+		labels["pid"] = m[1]
+		labels["process"] = m[2]
+	} else if m := crashPattern.FindStringSubmatch(message); m != nil {
+		labels["host_event"] = "segfault"
+		if m[3] != "segfault at" {
+			labels["host_event"] = "trap"
+		}
+		labels["process"] = m[1]
+		labels["pid"] = m[2]
+	} else {
+		return models.LogEntry{}, false
+	}
+
+	return models.LogEntry{
+		FilePath:   kmsgPath,
+		Line:       message,
+		Timestamp:  r.bootTime.Add(sinceBoot),
+		LineNumber: int64(seq),
+		EntryID:    fmt.Sprintf("kmsg-%s-%d", r.bootID, seq),
+		Labels:     labels,
+	}, true
+}
+
+// parseKmsg parses a /dev/kmsg record: "priority,seq,usec,flags;message"
+// followed by optional continuation lines
+func parseKmsg(record string) (seq uint64, sinceBoot time.Duration, message string, ok bool) {
+	header, rest, ok := strings.Cut(record, ";")
+	if !ok {
+		return 0, 0, "", false
+	}
+	fields := strings.Split(header, ",")
+	if len(fields) < 3 {
+		return 0, 0, "", false
+	}
+	seq, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0, 0, "", false
+	}
+	usec, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return 0, 0, "", false
+	}
+	message, _, _ = strings.Cut(rest, "\n")
+	return seq, time.Duration(usec) * time.Microsecond, message, true
+}
+
+// scanCoredumps ships coredumps written since the newest one shipped
+func (r *HostEventsReader) scanCoredumps(ctx context.Context) error {
+	if r.coredumpDir == "" {
+		return nil
+	}
+	dirEntries, err := os.ReadDir(r.coredumpDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list coredumps: %w", err)
+	}
+
+	r.mu.Lock()
+	since := r.state.CoredumpTime
+	r.mu.Unlock()
+
+	type coredump struct {
+		name    string
+		modTime time.Time
+	}
+	var cores []coredump
+	for _, de := range dirEntries {
+		if de.IsDir() || !strings.HasPrefix(de.Name(), "core.") {
+			continue
+		}
+		info, err := de.Info()
+		if err != nil || !info.ModTime().After(since) {
+			continue
+		}
+		cores = append(cores, coredump{name: de.Name(), modTime: info.ModTime()})
+	}
+	sort.Slice(cores, func(i, j int) bool {
+		return cores[i].modTime.Before(cores[j].modTime)
+	})
+
+	for _, core := range cores {
+		path := filepath.Join(r.coredumpDir, core.name)
+		labels := map[string]string{"host_event": "coredump", "boot_id": r.bootID}
+		line := "Process dumped core to " + path
+		if process, uid, pid, ok := parseCoredumpName(core.name); ok {
+			labels["process"] = process
+			labels["uid"] = uid
+			labels["pid"] = pid
+			line = fmt.Sprintf("Process %s (pid %s, uid %s) dumped core to %s", process, pid, uid, path)
+		}
+
+		entry := models.LogEntry{
+			FilePath:  path,
+			Line:      line,
+			Timestamp: core.modTime,
+			EntryID:   "coredump-" + core.name,
+			Labels:    labels,
+		}
+		if err := r.send(ctx, entry); err != nil {
+			return err
+		}
+
+		r.mu.Lock()
+		r.state.CoredumpTime = core.modTime
+		r.mu.Unlock()
+	}
+	return nil
+}
+
+// parseCoredumpName parses systemd-coredump file names:
+// core.<comm>.<uid>.<boot id>.<pid>.<usec>[.zst|.lz4|.xz]
+func parseCoredumpName(name string) (process, uid, pid string, ok bool) {
+	name = strings.TrimPrefix(name, "core.")
+	for _, ext := range []string{".zst", ".lz4", ".xz"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+	parts := strings.Split(name, ".")
+	n := len(parts)
+	if n < 5 {
+		return "", "", "", false
+	}
+	return strings.Join(parts[:n-4], "."), parts[n-4], parts[n-2], true
+}
+
+// send ships an entry under the host-events service
+func (r *HostEventsReader) send(ctx context.Context, entry models.LogEntry) error {
+	entry.ServiceName = r.serviceName
+	entry.Hostname = r.hostname
+	select {
+	case r.lineChan <- entry:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// readBootTime returns the boot time from /proc/stat
+func readBootTime() (time.Time, error) {
+	data, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read /proc/stat: %w", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if v, ok := strings.CutPrefix(line, "btime "); ok {
+			sec, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("invalid btime in /proc/stat: %w", err)
+			}
+			return time.Unix(sec, 0), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("no btime in /proc/stat")
+}
+
+// loadState reads the persisted state, if any
+func (r *HostEventsReader) loadState() error {
+	data, err := os.ReadFile(r.stateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read state: %w", err)
+	}
+	if err := json.Unmarshal(data, &r.state); err != nil {
+		return fmt.Errorf("failed to parse state: %w", err)
+	}
+	return nil
+}
+
+// saveState persists the state atomically; callers hold mu
+func (r *HostEventsReader) saveState() error {
+	data, err := json.Marshal(r.state)
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	tmp := r.stateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	if err := os.Rename(tmp, r.stateFile); err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+	return nil
+}
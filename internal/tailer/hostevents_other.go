@@ -0,0 +1,32 @@
+//go:build !linux
+
+package tailer
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/oicur0t/logl/pkg/models"
+	"go.uber.org/zap"
+)
+
+// HostEventsReader is unavailable outside Linux
+type HostEventsReader struct{}
+
+// NewHostEventsReader creates a reader that fails on start on non-Linux platforms
+func NewHostEventsReader(coredumpDir string, pollInterval time.Duration, serviceName, hostname, stateFile string, logger *zap.Logger, lineChan chan<- models.LogEntry) *HostEventsReader {
+	return &HostEventsReader{}
+}
+
+// HostEventsStateFile returns the host-events state file, next to the
+// tailer's state file
+func HostEventsStateFile(stateFile string) string {
+	return filepath.Join(filepath.Dir(stateFile), "host-events.json")
+}
+
+// Start always fails since host events are read from Linux interfaces
+func (r *HostEventsReader) Start(ctx context.Context) error {
+	return fmt.Errorf("host_events input is only supported on Linux")
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package tailer
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileInode returns an open file's inode number
+func fileInode(f *os.File, info os.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Ino)
+	}
+	return 0
+}
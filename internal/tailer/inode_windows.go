@@ -0,0 +1,19 @@
+//go:build windows
+
+package tailer
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// fileInode returns an open file's NTFS file index, which plays the part
+// of an inode number
+func fileInode(f *os.File, info os.FileInfo) uint64 {
+	var data windows.ByHandleFileInformation
+	if err := windows.GetFileInformationByHandle(windows.Handle(f.Fd()), &data); err != nil {
+		return 0
+	}
+	return uint64(data.FileIndexHigh)<<32 | uint64(data.FileIndexLow)
+}
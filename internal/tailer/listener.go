@@ -0,0 +1,129 @@
+package tailer
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oicur0t/logl/pkg/models"
+	"go.uber.org/zap"
+)
+
+// maxSocketLineSize bounds a single line received on a socket
+const maxSocketLineSize = 1024 * 1024
+
+// SocketListener accepts newline-delimited log lines on a TCP or Unix socket
+type SocketListener struct {
+	network     string // tcp, tcp4, tcp6, or unix
+	address     string
+	serviceName string
+	hostname    string
+	logger      *zap.Logger
+	lineChan    chan<- models.LogEntry
+	lineNumber  atomic.Int64
+}
+
+// NewSocketListener creates a new socket line listener
+func NewSocketListener(network, address, serviceName, hostname string, logger *zap.Logger, lineChan chan<- models.LogEntry) *SocketListener {
+	return &SocketListener{
+		network:     network,
+		address:     address,
+		serviceName: serviceName,
+		hostname:    hostname,
+		logger:      logger,
+		lineChan:    lineChan,
+	}
+}
+
+// Start accepts connections until the context is cancelled
+func (l *SocketListener) Start(ctx context.Context) error {
+	if l.network == "unix" {
+		// Remove a stale socket left by a previous run
+		if err := os.Remove(l.address); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove stale socket %s: %w", l.address, err)
+		}
+	}
+
+	listener, err := net.Listen(l.network, l.address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s %s: %w", l.network, l.address, err)
+	}
+
+	l.logger.Info("Listening for log lines",
+		zap.String("network", l.network),
+		zap.String("address", l.address),
+		zap.String("service", l.serviceName))
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			l.logger.Warn("Failed to accept connection", zap.String("address", l.address), zap.Error(err))
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.handleConn(ctx, conn)
+		}()
+	}
+}
+
+// handleConn reads lines from a single connection
+func (l *SocketListener) handleConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	// Unblock the scanner on shutdown
+	go func() {
+		<-ctx.Done()
+		conn.SetReadDeadline(time.Now())
+	}()
+
+	source := l.network + "://" + l.address
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSocketLineSize)
+
+	for scanner.Scan() {
+		entry := models.LogEntry{
+			ServiceName: l.serviceName,
+			Hostname:    l.hostname,
+			FilePath:    source,
+			Line:        scanner.Text(),
+			Timestamp:   time.Now(),
+			LineNumber:  l.lineNumber.Add(1),
+		}
+
+		select {
+		case l.lineChan <- entry:
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		l.logger.Warn("Error reading from connection",
+			zap.String("address", l.address),
+			zap.String("remote", conn.RemoteAddr().String()),
+			zap.Error(err))
+	}
+}
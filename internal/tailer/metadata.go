@@ -0,0 +1,222 @@
+package tailer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/oicur0t/logl/pkg/models"
+)
+
+// Cloud instance metadata endpoints
+const (
+	awsMetadataURL   = "http://169.254.169.254/latest"
+	gcpMetadataURL   = "http://metadata.google.internal/computeMetadata/v1/instance"
+	azureMetadataURL = "http://169.254.169.254/metadata/instance/compute?api-version=2021-02-01"
+)
+
+// LabelProcessor attaches host-wide labels to every entry. Labels already
+// set on an entry take precedence.
+type LabelProcessor struct {
+	labels atomic.Pointer[map[string]string]
+}
+
+// NewLabelProcessor creates a new label processor
+func NewLabelProcessor(labels map[string]string) *LabelProcessor {
+	p := &LabelProcessor{}
+	p.SetLabels(labels)
+	return p
+}
+
+// SetLabels replaces the labels, e.g. on a config reload
+func (p *LabelProcessor) SetLabels(labels map[string]string) {
+	p.labels.Store(&labels)
+}
+
+// Process adds the labels to the entry
+func (p *LabelProcessor) Process(entry *models.LogEntry) bool {
+	labels := *p.labels.Load()
+	if len(labels) == 0 {
+		return true
+	}
+	if entry.Labels == nil {
+		entry.Labels = make(map[string]string, len(labels))
+	}
+	for k, v := range labels {
+		if _, exists := entry.Labels[k]; !exists {
+			entry.Labels[k] = v
+		}
+	}
+	return true
+}
+
+// copyLabels returns a copy of labels so each entry owns its map, or nil
+func copyLabels(labels map[string]string) map[string]string {
+	if len(labels) == 0 {
+		return nil
+	}
+	c := make(map[string]string, len(labels))
+	for k, v := range labels {
+		c[k] = v
+	}
+	return c
+}
+
+// EnvLabels resolves labels from environment variables, keyed label -> variable.
+// Unset variables are skipped.
+func EnvLabels(mapping map[string]string) map[string]string {
+	labels := make(map[string]string)
+	for label, name := range mapping {
+		if v, ok := os.LookupEnv(name); ok {
+			labels[label] = v
+		}
+	}
+	return labels
+}
+
+// FileLabels resolves labels from file contents, keyed label -> path, such
+// as Kubernetes downward API files holding the namespace or pod name
+func FileLabels(mapping map[string]string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for label, path := range mapping {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read label %s: %w", label, err)
+		}
+		labels[label] = strings.TrimSpace(string(data))
+	}
+	return labels, nil
+}
+
+// KubernetesLabels parses a downward API labels or annotations file
+// (key="value" per line) into labels named prefix + key, with characters
+// that are awkward in field names replaced by underscores
+func KubernetesLabels(path, prefix string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	sanitize := strings.NewReplacer(".", "_", "/", "_", "-", "_")
+	labels := make(map[string]string)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		labels[prefix+sanitize.Replace(key)] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return labels, nil
+}
+
+// CloudLabels queries the instance metadata service of aws, gcp, or azure
+// for cloud_provider, region, zone, instance_id, and instance_type
+func CloudLabels(ctx context.Context, provider string) (map[string]string, error) {
+	client := &http.Client{}
+	labels := map[string]string{"cloud_provider": provider}
+
+	switch provider {
+	case "aws":
+		// IMDSv2 session token
+		token, err := metadataRequest(ctx, client, http.MethodPut, awsMetadataURL+"/api/token",
+			map[string]string{"X-aws-ec2-metadata-token-ttl-seconds": "60"})
+		if err != nil {
+			return nil, err
+		}
+		headers := map[string]string{"X-aws-ec2-metadata-token": token}
+		for label, path := range map[string]string{
+			"region":        "/meta-data/placement/region",
+			"zone":          "/meta-data/placement/availability-zone",
+			"instance_id":   "/meta-data/instance-id",
+			"instance_type": "/meta-data/instance-type",
+		} {
+			if labels[label], err = metadataRequest(ctx, client, http.MethodGet, awsMetadataURL+path, headers); err != nil {
+				return nil, err
+			}
+		}
+
+	case "gcp":
+		headers := map[string]string{"Metadata-Flavor": "Google"}
+		for label, path := range map[string]string{
+			"zone":          "/zone",
+			"instance_id":   "/id",
+			"instance_type": "/machine-type",
+		} {
+			value, err := metadataRequest(ctx, client, http.MethodGet, gcpMetadataURL+path, headers)
+			if err != nil {
+				return nil, err
+			}
+			// zone and machine-type are resource paths, e.g. projects/1/zones/us-central1-a
+			labels[label] = value[strings.LastIndex(value, "/")+1:]
+		}
+		if i := strings.LastIndex(labels["zone"], "-"); i > 0 {
+			labels["region"] = labels["zone"][:i]
+		}
+
+	case "azure":
+		body, err := metadataRequest(ctx, client, http.MethodGet, azureMetadataURL, map[string]string{"Metadata": "true"})
+		if err != nil {
+			return nil, err
+		}
+		var compute struct {
+			Location string `json:"location"`
+			Zone     string `json:"zone"`
+			VMID     string `json:"vmId"`
+			VMSize   string `json:"vmSize"`
+		}
+		if err := json.Unmarshal([]byte(body), &compute); err != nil {
+			return nil, fmt.Errorf("invalid azure metadata: %w", err)
+		}
+		labels["region"] = compute.Location
+		labels["zone"] = compute.Zone
+		labels["instance_id"] = compute.VMID
+		labels["instance_type"] = compute.VMSize
+
+	default:
+		return nil, fmt.Errorf("unsupported cloud provider %q, expected aws, gcp, or azure", provider)
+	}
+
+	return labels, nil
+}
+
+// metadataRequest performs a metadata service request and returns the body
+func metadataRequest(ctx context.Context, client *http.Client, method, url string, headers map[string]string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create metadata request: %w", err)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to query instance metadata: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return "", fmt.Errorf("failed to read instance metadata: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("instance metadata %s returned status %d", url, resp.StatusCode)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
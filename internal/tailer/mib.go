@@ -0,0 +1,288 @@
+package tailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// builtinOIDs names the SMI roots MIB modules are defined under, and the
+// standard trap and varbind OIDs, so common traps resolve without MIBs
+var builtinOIDs = map[string]string{
+	"iso":                   "1",
+	"org":                   "1.3",
+	"dod":                   "1.3.6",
+	"internet":              "1.3.6.1",
+	"directory":             "1.3.6.1.1",
+	"mgmt":                  "1.3.6.1.2",
+	"mib-2":                 "1.3.6.1.2.1",
+	"system":                "1.3.6.1.2.1.1",
+	"sysDescr":              "1.3.6.1.2.1.1.1",
+	"sysObjectID":           "1.3.6.1.2.1.1.2",
+	"sysUpTime":             "1.3.6.1.2.1.1.3",
+	"sysName":               "1.3.6.1.2.1.1.5",
+	"interfaces":            "1.3.6.1.2.1.2",
+	"ifIndex":               "1.3.6.1.2.1.2.2.1.1",
+	"ifDescr":               "1.3.6.1.2.1.2.2.1.2",
+	"ifAdminStatus":         "1.3.6.1.2.1.2.2.1.7",
+	"ifOperStatus":          "1.3.6.1.2.1.2.2.1.8",
+	"transmission":          "1.3.6.1.2.1.10",
+	"experimental":          "1.3.6.1.3",
+	"private":               "1.3.6.1.4",
+	"enterprises":           "1.3.6.1.4.1",
+	"security":              "1.3.6.1.5",
+	"snmpV2":                "1.3.6.1.6",
+	"snmpDomains":           "1.3.6.1.6.1",
+	"snmpProxys":            "1.3.6.1.6.2",
+	"snmpModules":           "1.3.6.1.6.3",
+	"snmpTrapOID":           "1.3.6.1.6.3.1.1.4.1",
+	"snmpTrapEnterprise":    "1.3.6.1.6.3.1.1.4.3",
+	"coldStart":             "1.3.6.1.6.3.1.1.5.1",
+	"warmStart":             "1.3.6.1.6.3.1.1.5.2",
+	"linkDown":              "1.3.6.1.6.3.1.1.5.3",
+	"linkUp":                "1.3.6.1.6.3.1.1.5.4",
+	"authenticationFailure": "1.3.6.1.6.3.1.1.5.5",
+}
+
+// mibMacros are the SMI macros whose values are object identifiers
+var mibMacros = map[string]bool{
+	"OBJECT-TYPE":        true,
+	"NOTIFICATION-TYPE":  true,
+	"MODULE-IDENTITY":    true,
+	"OBJECT-IDENTITY":    true,
+	"OBJECT-GROUP":       true,
+	"NOTIFICATION-GROUP": true,
+	"MODULE-COMPLIANCE":  true,
+	"AGENT-CAPABILITIES": true,
+}
+
+// MIB resolves numeric OIDs to the names defined in MIB modules
+type MIB struct {
+	names map[string]string // Dotted OID -> name
+}
+
+// mibAssignment is an OID value assignment: name ::= { parent 1 2 }
+type mibAssignment struct {
+	name   string
+	parent string
+	arcs   []string
+}
+
+// LoadMIBs reads the OID assignments of MIB module files, or of every file
+// in a directory. Only names and OIDs are read; types, imports, and
+// SMIv1 TRAP-TYPE definitions are ignored. Names are global, so a name
+// defined by several modules resolves to the last definition read.
+func LoadMIBs(paths []string) (*MIB, error) {
+	var assignments []mibAssignment
+	for _, p := range paths {
+		files := []string{p}
+		if info, err := os.Stat(p); err != nil {
+			return nil, fmt.Errorf("failed to read MIB %s: %w", p, err)
+		} else if info.IsDir() {
+			entries, err := os.ReadDir(p)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list MIB directory %s: %w", p, err)
+			}
+			files = files[:0]
+			for _, e := range entries {
+				if !e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+					files = append(files, filepath.Join(p, e.Name()))
+				}
+			}
+		}
+
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read MIB %s: %w", file, err)
+			}
+			assignments = append(assignments, parseMIBAssignments(string(data))...)
+		}
+	}
+
+	oids := make(map[string]string, len(builtinOIDs)+len(assignments))
+	for name, oid := range builtinOIDs {
+		oids[name] = oid
+	}
+
+	// Resolve assignments whose parent is known until none resolve, since
+	// modules may define names before their parents
+	pending := assignments
+	for len(pending) > 0 {
+		var unresolved []mibAssignment
+		for _, a := range pending {
+			oid, ok := a.resolve(oids)
+			if !ok {
+				unresolved = append(unresolved, a)
+				continue
+			}
+			oids[a.name] = oid
+		}
+		if len(unresolved) == len(pending) {
+			break
+		}
+		pending = unresolved
+	}
+
+	mib := &MIB{names: make(map[string]string, len(oids))}
+	for name, oid := range oids {
+		mib.names[oid] = name
+	}
+	return mib, nil
+}
+
+// resolve returns the assignment's OID if its parent is known
+func (a mibAssignment) resolve(oids map[string]string) (string, bool) {
+	parent := a.parent
+	if _, err := strconv.Atoi(parent); err != nil {
+		var ok bool
+		if parent, ok = oids[parent]; !ok {
+			return "", false
+		}
+	}
+	if len(a.arcs) == 0 {
+		return parent, true
+	}
+	return parent + "." + strings.Join(a.arcs, "."), true
+}
+
+// parseMIBAssignments finds the OID value assignments in a MIB module
+func parseMIBAssignments(text string) []mibAssignment {
+	tokens := tokenizeMIB(text)
+	var assignments []mibAssignment
+	name := ""
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		switch {
+		case mibMacros[tok] && i > 0 && isMIBValueName(tokens[i-1]):
+			name = tokens[i-1]
+		case tok == "OBJECT" && i > 0 && i+2 < len(tokens) && tokens[i+1] == "IDENTIFIER" && tokens[i+2] == "::=" && isMIBValueName(tokens[i-1]):
+			name = tokens[i-1]
+		case tok == "::=" && name != "" && i+1 < len(tokens) && tokens[i+1] == "{":
+			var value []string
+			j := i + 2
+			for ; j < len(tokens) && tokens[j] != "}"; j++ {
+				value = append(value, tokens[j])
+			}
+			if a, ok := parseMIBValue(name, value); ok {
+				assignments = append(assignments, a)
+			}
+			name = ""
+			i = j
+		}
+	}
+	return assignments
+}
+
+// parseMIBValue parses the contents of an OID value: a parent name or
+// number followed by arcs, each a number or name(number)
+func parseMIBValue(name string, value []string) (mibAssignment, bool) {
+	if len(value) == 0 {
+		return mibAssignment{}, false
+	}
+	a := mibAssignment{name: name, parent: mibArc(value[0])}
+	for _, v := range value[1:] {
+		arc := mibArc(v)
+		if _, err := strconv.Atoi(arc); err != nil {
+			return mibAssignment{}, false
+		}
+		a.arcs = append(a.arcs, arc)
+	}
+	return a, true
+}
+
+// mibArc returns the number in "name(number)", or the token itself
+func mibArc(tok string) string {
+	if open := strings.IndexByte(tok, '('); open > 0 && strings.HasSuffix(tok, ")") {
+		return tok[open+1 : len(tok)-1]
+	}
+	return tok
+}
+
+// isMIBValueName reports whether a token can name a value, which in SMI
+// starts with a lowercase letter
+func isMIBValueName(tok string) bool {
+	return tok != "" && unicode.IsLower(rune(tok[0]))
+}
+
+// tokenizeMIB splits a MIB module into tokens, dropping comments and
+// quoted strings. "name(1)" is kept as one token.
+func tokenizeMIB(text string) []string {
+	var tokens []string
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '-' && i+1 < len(text) && text[i+1] == '-':
+			// Comments run to the end of the line or the next --
+			end := i + 2
+			for end < len(text) && text[end] != '\n' && !(text[end] == '-' && end+1 < len(text) && text[end+1] == '-') {
+				end++
+			}
+			if end < len(text) && text[end] == '-' {
+				end += 2
+			}
+			i = end
+		case c == '"':
+			end := strings.IndexByte(text[i+1:], '"')
+			if end < 0 {
+				return tokens
+			}
+			i += end + 2
+		case c == '{' || c == '}' || c == ',' || c == ';':
+			tokens = append(tokens, string(c))
+			i++
+		case unicode.IsSpace(rune(c)):
+			i++
+		default:
+			end := i
+			for end < len(text) && !unicode.IsSpace(rune(text[end])) && !strings.ContainsRune(`{},;"`, rune(text[end])) {
+				if text[end] == '-' && end+1 < len(text) && text[end+1] == '-' {
+					break
+				}
+				end++
+			}
+			tok := text[i:end]
+			// Keep name(1) together when written as name (1)
+			if j := skipSpace(text, end); j < len(text) && text[j] == '(' && !strings.ContainsRune(tok, '(') {
+				if close := strings.IndexByte(text[j:], ')'); close > 0 {
+					tok += strings.Join(strings.Fields(text[j:j+close+1]), "")
+					end = j + close + 1
+				}
+			}
+			tokens = append(tokens, tok)
+			i = end
+		}
+	}
+	return tokens
+}
+
+// skipSpace returns the index of the first non-space byte at or after i
+func skipSpace(text string, i int) int {
+	for i < len(text) && unicode.IsSpace(rune(text[i])) {
+		i++
+	}
+	return i
+}
+
+// Name returns the name of an OID, with the numeric suffix below the
+// longest named prefix, e.g. ifIndex.3. OIDs without a named prefix are
+// returned unchanged.
+func (m *MIB) Name(oid string) string {
+	if m == nil {
+		return oid
+	}
+	for prefix := oid; prefix != ""; {
+		if name, ok := m.names[prefix]; ok {
+			return name + oid[len(prefix):]
+		}
+		dot := strings.LastIndexByte(prefix, '.')
+		if dot < 0 {
+			break
+		}
+		prefix = prefix[:dot]
+	}
+	return oid
+}
@@ -0,0 +1,102 @@
+package tailer
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/oicur0t/logl/pkg/ids"
+	"github.com/oicur0t/logl/pkg/models"
+	"github.com/oicur0t/logl/pkg/redact"
+)
+
+// Processor transforms entries before they are batched.
+// Returning false drops the entry.
+type Processor interface {
+	Process(entry *models.LogEntry) bool
+}
+
+// RedactionProcessor masks sensitive data in lines before they leave the host
+type RedactionProcessor struct {
+	redactor *redact.Redactor
+}
+
+// NewRedactionProcessor creates a new redaction processor
+func NewRedactionProcessor(redactor *redact.Redactor) *RedactionProcessor {
+	return &RedactionProcessor{redactor: redactor}
+}
+
+// Process redacts the entry's line
+func (p *RedactionProcessor) Process(entry *models.LogEntry) bool {
+	entry.Line = p.redactor.Redact(entry.Line)
+	return true
+}
+
+// IDProcessor assigns each entry a client-generated ID so it can be
+// identified before the server stores it
+type IDProcessor struct {
+	generator ids.Generator
+}
+
+// NewIDProcessor creates a new ID processor
+func NewIDProcessor(generator ids.Generator) *IDProcessor {
+	return &IDProcessor{generator: generator}
+}
+
+// Process sets the entry's ID unless it already has one
+func (p *IDProcessor) Process(entry *models.LogEntry) bool {
+	if entry.EntryID == "" {
+		entry.EntryID = p.generator.New()
+	}
+	return true
+}
+
+// ParseProcessor decodes lines holding a JSON object into the entry's
+// parsed fields and takes its level from the first level field present.
+// Other lines are sent as they are.
+type ParseProcessor struct {
+	levelFields []string
+}
+
+// NewParseProcessor creates a new parse processor
+func NewParseProcessor(levelFields []string) *ParseProcessor {
+	return &ParseProcessor{levelFields: levelFields}
+}
+
+// Process parses the entry's line
+func (p *ParseProcessor) Process(entry *models.LogEntry) bool {
+	line := strings.TrimSpace(entry.Line)
+	if !strings.HasPrefix(line, "{") {
+		return true
+	}
+	var parsed map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &parsed); err != nil {
+		return true
+	}
+	entry.Parsed = parsed
+
+	// The server maps the value onto its canonical level names
+	for _, field := range p.levelFields {
+		if level, ok := lookupField(parsed, field).(string); ok && level != "" {
+			entry.Level = level
+			break
+		}
+	}
+	return true
+}
+
+// lookupField returns the value at a dotted path in parsed JSON, trying
+// the path as a flat key first
+func lookupField(parsed map[string]interface{}, path string) interface{} {
+	if v, ok := parsed[path]; ok {
+		return v
+	}
+	var current interface{} = parsed
+	for _, key := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = m[key]
+	}
+	return current
+}
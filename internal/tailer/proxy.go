@@ -0,0 +1,133 @@
+package tailer
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ProxyFunc selects the proxy for a request, as used by http.Transport.Proxy
+type ProxyFunc func(*http.Request) (*url.URL, error)
+
+// NewProxyFunc returns a ProxyFunc sending requests through proxyURL
+// (http, https, or socks5) unless the target host matches a noProxy rule.
+// Credentials, if set, override any embedded in the URL.
+//
+// noProxy entries follow NO_PROXY conventions: "*" bypasses the proxy for
+// every host, "example.com" and ".example.com" match the domain and its
+// subdomains, and IPs or CIDR ranges match literal addresses. An entry may
+// carry a ":port" suffix to apply only to that port.
+func NewProxyFunc(proxyURL, username, password string, noProxy []string) (ProxyFunc, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, expected http, https, or socks5", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy URL %q has no host", proxyURL)
+	}
+	if username != "" {
+		u.User = url.UserPassword(username, password)
+	}
+
+	rules := make([]noProxyRule, 0, len(noProxy))
+	for _, entry := range noProxy {
+		rule, err := parseNoProxyRule(entry)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	return func(req *http.Request) (*url.URL, error) {
+		host, port := req.URL.Hostname(), req.URL.Port()
+		if port == "" {
+			port = defaultPort(req.URL.Scheme)
+		}
+		for _, rule := range rules {
+			if rule.matches(host, port) {
+				return nil, nil
+			}
+		}
+		return u, nil
+	}, nil
+}
+
+// noProxyRule is a single parsed NO_PROXY entry
+type noProxyRule struct {
+	all    bool
+	domain string // lowercased, without leading dot
+	ip     net.IP
+	cidr   *net.IPNet
+	port   string // empty matches any port
+}
+
+// parseNoProxyRule parses a NO_PROXY entry
+func parseNoProxyRule(entry string) (noProxyRule, error) {
+	entry = strings.ToLower(strings.TrimSpace(entry))
+	if entry == "" {
+		return noProxyRule{}, fmt.Errorf("empty no_proxy entry")
+	}
+	if entry == "*" {
+		return noProxyRule{all: true}, nil
+	}
+
+	if _, cidr, err := net.ParseCIDR(entry); err == nil {
+		return noProxyRule{cidr: cidr}, nil
+	}
+
+	var rule noProxyRule
+	host := entry
+	if h, p, err := net.SplitHostPort(entry); err == nil {
+		host, rule.port = h, p
+	}
+	host = strings.Trim(host, "[]")
+
+	if ip := net.ParseIP(host); ip != nil {
+		rule.ip = ip
+		return rule, nil
+	}
+
+	rule.domain = strings.TrimPrefix(host, ".")
+	if rule.domain == "" {
+		return noProxyRule{}, fmt.Errorf("invalid no_proxy entry %q", entry)
+	}
+	return rule, nil
+}
+
+// matches reports whether a request target bypasses the proxy
+func (r noProxyRule) matches(host, port string) bool {
+	if r.all {
+		return true
+	}
+	if r.port != "" && r.port != port {
+		return false
+	}
+
+	host = strings.ToLower(host)
+	if ip := net.ParseIP(host); ip != nil {
+		if r.cidr != nil {
+			return r.cidr.Contains(ip)
+		}
+		return r.ip != nil && r.ip.Equal(ip)
+	}
+
+	if r.domain == "" {
+		return false
+	}
+	return host == r.domain || strings.HasSuffix(host, "."+r.domain)
+}
+
+// defaultPort returns the implied port for a URL scheme
+func defaultPort(scheme string) string {
+	if scheme == "http" {
+		return "80"
+	}
+	return "443"
+}
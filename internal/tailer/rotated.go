@@ -0,0 +1,128 @@
+package tailer
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// unreadableExtensions are compressed formats rotated files can't be read
+// in
+var unreadableExtensions = map[string]bool{".bz2": true, ".xz": true, ".lz4": true, ".zip": true, ".Z": true}
+
+// compressed reports whether a rotated file is gzip or zstd compressed
+func compressed(path string) bool {
+	ext := filepath.Ext(path)
+	return ext == ".gz" || ext == ".zst"
+}
+
+// rotatedName reports whether a file in a directory holding names is a
+// rotated generation: compressed, or another name with a numbered or dated
+// suffix, such as app.log.1 or app.log-20240101
+func rotatedName(name string, names map[string]bool) bool {
+	if compressed(name) || unreadableExtensions[filepath.Ext(name)] {
+		return true
+	}
+	stem := strings.TrimRight(name, "0123456789-_.")
+	return stem != name && stem != "" && names[stem]
+}
+
+// decompress returns a reader over a file's content, decompressing gzip
+// and zstd files by their extension
+func decompress(path string, f *os.File) (io.ReadCloser, error) {
+	switch filepath.Ext(path) {
+	case ".gz":
+		return gzip.NewReader(f)
+	case ".zst":
+		d, err := zstd.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	}
+	return io.NopCloser(f), nil
+}
+
+// generation is a file rotation left next to a log path
+type generation struct {
+	path    string
+	modTime time.Time
+}
+
+// generations lists the files rotation left next to path, oldest first:
+// path with a suffix, such as app.log.1, app.log.2.gz, or
+// app.log-20240101.zst. Formats that can't be read are skipped.
+func generations(path string) []generation {
+	dir, base := filepath.Dir(path), filepath.Base(path)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var gens []generation
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || !(strings.HasPrefix(name, base+".") || strings.HasPrefix(name, base+"-")) {
+			continue
+		}
+		if unreadableExtensions[filepath.Ext(name)] {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		gens = append(gens, generation{path: filepath.Join(dir, name), modTime: info.ModTime()})
+	}
+	sort.SliceStable(gens, func(i, j int) bool { return gens[i].modTime.Before(gens[j].modTime) })
+	return gens
+}
+
+// findGeneration returns the index of the identified file among gens: the
+// one with its inode, else the first starting with its bytes, as a copy
+// or compressed copy does. It returns -1 when there is none.
+func findGeneration(gens []generation, id fileIdentity) int {
+	copied := -1
+	for i, gen := range gens {
+		current, err := identify(gen.path)
+		if err != nil || !id.sameContent(gen.path) {
+			continue
+		}
+		if id.inode != 0 && current.inode == id.inode {
+			return i
+		}
+		if copied < 0 {
+			copied = i
+		}
+	}
+	return copied
+}
+
+// findRotated looks anywhere next to path for the identified file, for
+// rotation schemes that don't name files after the path. It returns an
+// empty string when there is none.
+func findRotated(path string, id fileIdentity) string {
+	dir := filepath.Dir(path)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+
+	var gens []generation
+	for _, entry := range entries {
+		candidate := filepath.Join(dir, entry.Name())
+		if candidate != path && entry.Type().IsRegular() && !unreadableExtensions[filepath.Ext(candidate)] {
+			gens = append(gens, generation{path: candidate})
+		}
+	}
+	if i := findGeneration(gens, id); i >= 0 {
+		return gens[i].path
+	}
+	return ""
+}
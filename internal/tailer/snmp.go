@@ -0,0 +1,474 @@
+package tailer
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/oicur0t/logl/pkg/models"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxSNMPMessageSize bounds a single trap datagram
+	maxSNMPMessageSize = 65535
+
+	snmpVersion2c = 1
+	snmpVersion3  = 3
+
+	snmpPDUResponse = 0xa2
+	snmpPDUInform   = 0xa6
+	snmpPDUTrapV2   = 0xa7
+
+	// msgFlags bits
+	snmpFlagAuth = 0x01
+	snmpFlagPriv = 0x02
+
+	usmSecurityModel = 3
+
+	sysUpTimeOID   = "1.3.6.1.2.1.1.3.0"
+	snmpTrapOIDOID = "1.3.6.1.6.3.1.1.4.1.0"
+)
+
+// snmpTrap is the structured form of a trap shipped as the entry's line
+type snmpTrap struct {
+	Trap     string                 `json:"trap"`
+	TrapOID  string                 `json:"trap_oid"`
+	Agent    string                 `json:"agent"`
+	Version  string                 `json:"version"`
+	Uptime   uint64                 `json:"uptime,omitempty"` // sysUpTime in hundredths of a second
+	User     string                 `json:"user,omitempty"`   // SNMPv3 user
+	Inform   bool                   `json:"inform,omitempty"`
+	Varbinds map[string]interface{} `json:"varbinds"`
+}
+
+// SNMPTrapReceiver receives SNMPv2c and SNMPv3 traps and informs on a UDP
+// address and ships each as a JSON line, with OIDs resolved to names from
+// the loaded MIBs. v2c informs are acknowledged; v3 informs are not, since
+// that requires acting as an authoritative engine.
+type SNMPTrapReceiver struct {
+	address     string
+	communities map[string]bool // nil accepts any community
+	users       map[string]*usmUser
+	mib         *MIB
+	serviceName string
+	hostname    string
+	logger      *zap.Logger
+	lineChan    chan<- models.LogEntry
+	lineNumber  atomic.Int64
+}
+
+// NewSNMPTrapReceiver creates a new SNMP trap receiver. An empty
+// communities list accepts v2c traps with any community; v3 traps are only
+// accepted from users.
+func NewSNMPTrapReceiver(address string, communities []string, users []SNMPUser, mib *MIB, serviceName, hostname string, logger *zap.Logger, lineChan chan<- models.LogEntry) (*SNMPTrapReceiver, error) {
+	r := &SNMPTrapReceiver{
+		address:     address,
+		users:       make(map[string]*usmUser, len(users)),
+		mib:         mib,
+		serviceName: serviceName,
+		hostname:    hostname,
+		logger:      logger,
+		lineChan:    lineChan,
+	}
+	if len(communities) > 0 {
+		r.communities = make(map[string]bool, len(communities))
+		for _, c := range communities {
+			r.communities[c] = true
+		}
+	}
+	for _, u := range users {
+		user, err := newUSMUser(u)
+		if err != nil {
+			return nil, err
+		}
+		r.users[u.Username] = user
+	}
+	return r, nil
+}
+
+// Start receives traps until the context is cancelled
+func (r *SNMPTrapReceiver) Start(ctx context.Context) error {
+	conn, err := net.ListenPacket("udp", r.address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on udp %s: %w", r.address, err)
+	}
+
+	r.logger.Info("Listening for SNMP traps",
+		zap.String("address", r.address),
+		zap.String("service", r.serviceName),
+		zap.Int("v3_users", len(r.users)))
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	buf := make([]byte, maxSNMPMessageSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			r.logger.Warn("Failed to read SNMP trap", zap.String("address", r.address), zap.Error(err))
+			continue
+		}
+
+		msg := make([]byte, n)
+		copy(msg, buf[:n])
+		trap, response, err := r.decode(msg, addr)
+		if err != nil {
+			r.logger.Debug("Dropped SNMP message", zap.Stringer("from", addr), zap.Error(err))
+			continue
+		}
+		if response != nil {
+			if _, err := conn.WriteTo(response, addr); err != nil {
+				r.logger.Warn("Failed to acknowledge SNMP inform", zap.Stringer("to", addr), zap.Error(err))
+			}
+		}
+		if trap == nil {
+			continue
+		}
+
+		if err := r.send(ctx, trap); err != nil {
+			return err
+		}
+	}
+}
+
+// decode decodes a trap or inform, returning the response to send for
+// informs
+func (r *SNMPTrapReceiver) decode(msg []byte, addr net.Addr) (*snmpTrap, []byte, error) {
+	outer, err := newBERReader(msg).expect(berSequence)
+	if err != nil {
+		return nil, nil, err
+	}
+	fields := outer.reader()
+	version, err := fields.expectInt()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	agent := addr.String()
+	if host, _, err := net.SplitHostPort(agent); err == nil {
+		agent = host
+	}
+
+	switch version {
+	case snmpVersion2c:
+		community, err := fields.expect(berOctetString)
+		if err != nil {
+			return nil, nil, err
+		}
+		if r.communities != nil && !r.communities[string(community.data)] {
+			return nil, nil, fmt.Errorf("unknown community")
+		}
+		pdu, err := fields.next()
+		if err != nil {
+			return nil, nil, err
+		}
+		trap, err := r.decodePDU(pdu, agent)
+		if err != nil {
+			return nil, nil, err
+		}
+		trap.Version = "2c"
+
+		var response []byte
+		if pdu.tag == snmpPDUInform {
+			response = informResponse(community, pdu)
+		}
+		return trap, response, nil
+
+	case snmpVersion3:
+		trap, err := r.decodeV3(msg, fields, agent)
+		if err != nil {
+			return nil, nil, err
+		}
+		trap.Version = "3"
+		return trap, nil, nil
+
+	default:
+		return nil, nil, fmt.Errorf("unsupported SNMP version %d", version)
+	}
+}
+
+// decodeV3 authenticates and decrypts an SNMPv3 message with the USM
+func (r *SNMPTrapReceiver) decodeV3(msg []byte, fields *berReader, agent string) (*snmpTrap, error) {
+	global, err := fields.expect(berSequence)
+	if err != nil {
+		return nil, err
+	}
+	g := global.reader()
+	if _, err := g.expectInt(); err != nil { // msgID
+		return nil, err
+	}
+	if _, err := g.expectInt(); err != nil { // msgMaxSize
+		return nil, err
+	}
+	flags, err := g.expect(berOctetString)
+	if err != nil || len(flags.data) != 1 {
+		return nil, fmt.Errorf("invalid msgFlags")
+	}
+	model, err := g.expectInt()
+	if err != nil {
+		return nil, err
+	}
+	if model != usmSecurityModel {
+		return nil, fmt.Errorf("unsupported security model %d", model)
+	}
+
+	secParams, err := fields.expect(berOctetString)
+	if err != nil {
+		return nil, err
+	}
+	usm, err := secParams.reader().expect(berSequence)
+	if err != nil {
+		return nil, err
+	}
+	u := usm.reader()
+	engineID, err := u.expect(berOctetString)
+	if err != nil {
+		return nil, err
+	}
+	boots, err := u.expectInt()
+	if err != nil {
+		return nil, err
+	}
+	engineTime, err := u.expectInt()
+	if err != nil {
+		return nil, err
+	}
+	userName, err := u.expect(berOctetString)
+	if err != nil {
+		return nil, err
+	}
+	authParams, err := u.expect(berOctetString)
+	if err != nil {
+		return nil, err
+	}
+	privParams, err := u.expect(berOctetString)
+	if err != nil {
+		return nil, err
+	}
+
+	user, ok := r.users[string(userName.data)]
+	if !ok {
+		return nil, fmt.Errorf("unknown SNMPv3 user %q", userName.data)
+	}
+
+	// The message must use the security level the user is configured for
+	authFlag, privFlag := flags.data[0]&snmpFlagAuth != 0, flags.data[0]&snmpFlagPriv != 0
+	if (user.auth != nil) != authFlag || (user.priv != "") != privFlag {
+		return nil, fmt.Errorf("security level of user %s doesn't match the message", user.name)
+	}
+	if authFlag && !user.authenticate(msg, authParams.offset, authParams.data, engineID.data) {
+		return nil, fmt.Errorf("authentication failed for user %s", user.name)
+	}
+
+	scoped, err := fields.next()
+	if err != nil {
+		return nil, err
+	}
+	if privFlag {
+		if scoped.tag != berOctetString {
+			return nil, fmt.Errorf("expected an encrypted scoped PDU")
+		}
+		plain, err := user.decrypt(scoped.data, privParams.data, engineID.data, boots, engineTime)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt scoped PDU: %w", err)
+		}
+		// DES pads the plaintext, so only the first value is read
+		if scoped, err = newBERReader(plain).next(); err != nil {
+			return nil, fmt.Errorf("failed to decrypt scoped PDU for user %s: %w", user.name, err)
+		}
+	}
+	if scoped.tag != berSequence {
+		return nil, fmt.Errorf("expected a scoped PDU")
+	}
+
+	s := scoped.reader()
+	if _, err := s.expect(berOctetString); err != nil { // contextEngineID
+		return nil, err
+	}
+	if _, err := s.expect(berOctetString); err != nil { // contextName
+		return nil, err
+	}
+	pdu, err := s.next()
+	if err != nil {
+		return nil, err
+	}
+	trap, err := r.decodePDU(pdu, agent)
+	if err != nil {
+		return nil, err
+	}
+	trap.User = user.name
+	return trap, nil
+}
+
+// decodePDU decodes an SNMPv2-Trap or InformRequest PDU
+func (r *SNMPTrapReceiver) decodePDU(pdu berValue, agent string) (*snmpTrap, error) {
+	if pdu.tag != snmpPDUTrapV2 && pdu.tag != snmpPDUInform {
+		return nil, fmt.Errorf("unsupported PDU type 0x%02x", pdu.tag)
+	}
+
+	p := pdu.reader()
+	for i := 0; i < 3; i++ { // request-id, error-status, error-index
+		if _, err := p.expectInt(); err != nil {
+			return nil, err
+		}
+	}
+	varbinds, err := p.expect(berSequence)
+	if err != nil {
+		return nil, err
+	}
+
+	trap := &snmpTrap{
+		Agent:    agent,
+		Inform:   pdu.tag == snmpPDUInform,
+		Varbinds: make(map[string]interface{}),
+	}
+	list := varbinds.reader()
+	for list.more() {
+		vb, err := list.expect(berSequence)
+		if err != nil {
+			return nil, err
+		}
+		v := vb.reader()
+		oidValue, err := v.expect(berOID)
+		if err != nil {
+			return nil, err
+		}
+		oid, err := berOIDString(oidValue.data)
+		if err != nil {
+			return nil, err
+		}
+		value, err := v.next()
+		if err != nil {
+			return nil, err
+		}
+
+		switch oid {
+		case sysUpTimeOID:
+			trap.Uptime, _ = berUint(value.data)
+		case snmpTrapOIDOID:
+			if value.tag != berOID {
+				return nil, fmt.Errorf("snmpTrapOID.0 is not an object identifier")
+			}
+			if trap.TrapOID, err = berOIDString(value.data); err != nil {
+				return nil, err
+			}
+		default:
+			trap.Varbinds[r.mib.Name(oid)] = r.varbindValue(value)
+		}
+	}
+	if trap.TrapOID == "" {
+		return nil, fmt.Errorf("trap has no snmpTrapOID.0")
+	}
+	trap.Trap = r.mib.Name(trap.TrapOID)
+	return trap, nil
+}
+
+// varbindValue converts a varbind value for JSON: numbers, strings, names
+// for OIDs, dotted IP addresses, and hex for binary strings
+func (r *SNMPTrapReceiver) varbindValue(v berValue) interface{} {
+	switch v.tag {
+	case berInteger:
+		n, err := berInt(v.data)
+		if err != nil {
+			return nil
+		}
+		return n
+	case berCounter32, berGauge32, berTimeTicks, berCounter64:
+		n, err := berUint(v.data)
+		if err != nil {
+			return nil
+		}
+		return n
+	case berOctetString, berOpaque:
+		if utf8.Valid(v.data) && !bytes.ContainsFunc(v.data, func(c rune) bool { return c < 0x20 && c != '\t' && c != '\n' && c != '\r' }) {
+			return string(v.data)
+		}
+		return "0x" + hex.EncodeToString(v.data)
+	case berOID:
+		oid, err := berOIDString(v.data)
+		if err != nil {
+			return nil
+		}
+		return r.mib.Name(oid)
+	case berIPAddress:
+		if len(v.data) == 4 {
+			return net.IP(v.data).String()
+		}
+		return "0x" + hex.EncodeToString(v.data)
+	case berNoSuchObj:
+		return "noSuchObject"
+	case berNoSuchInst:
+		return "noSuchInstance"
+	case berEndOfMIB:
+		return "endOfMibView"
+	default:
+		return nil
+	}
+}
+
+// informResponse builds the v2c Response acknowledging an inform, echoing
+// its request ID and varbinds
+func informResponse(community, inform berValue) []byte {
+	p := inform.reader()
+	requestID, _ := p.next()
+	p.next() // error-status
+	p.next() // error-index
+	varbinds, _ := p.next()
+
+	var pdu []byte
+	pdu = append(pdu, requestID.raw...)
+	pdu = append(pdu, berEncodeInt(0)...)
+	pdu = append(pdu, berEncodeInt(0)...)
+	pdu = append(pdu, varbinds.raw...)
+
+	var body []byte
+	body = append(body, berEncodeInt(snmpVersion2c)...)
+	body = append(body, community.raw...)
+	body = append(body, berEncode(snmpPDUResponse, pdu)...)
+	return berEncode(berSequence, body)
+}
+
+// send ships a trap as a JSON line
+func (r *SNMPTrapReceiver) send(ctx context.Context, trap *snmpTrap) error {
+	line, err := json.Marshal(trap)
+	if err != nil {
+		return fmt.Errorf("failed to encode trap: %w", err)
+	}
+
+	entry := models.LogEntry{
+		ServiceName: r.serviceName,
+		Hostname:    r.hostname,
+		FilePath:    "snmp://" + r.address,
+		Line:        string(line),
+		Timestamp:   time.Now(),
+		LineNumber:  r.lineNumber.Add(1),
+		Labels: map[string]string{
+			"snmp_agent":   trap.Agent,
+			"snmp_trap":    trap.Trap,
+			"snmp_version": trap.Version,
+		},
+	}
+
+	select {
+	case r.lineChan <- entry:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
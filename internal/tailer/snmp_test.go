@@ -0,0 +1,245 @@
+package tailer
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// testAgent is the address test traps come from
+var testAgent = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 162}
+
+// encodeOID encodes a dotted object identifier
+func encodeOID(oid string) []byte {
+	var arcs []uint64
+	for _, part := range strings.Split(oid, ".") {
+		n, _ := strconv.ParseUint(part, 10, 64)
+		arcs = append(arcs, n)
+	}
+	arcs = append([]uint64{arcs[0]*40 + arcs[1]}, arcs[2:]...)
+
+	var contents []byte
+	for _, arc := range arcs {
+		sub := []byte{byte(arc & 0x7f)}
+		for arc >>= 7; arc > 0; arc >>= 7 {
+			sub = append([]byte{byte(arc&0x7f) | 0x80}, sub...)
+		}
+		contents = append(contents, sub...)
+	}
+	return berEncode(berOID, contents)
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func varbind(oid string, value []byte) []byte {
+	return berEncode(berSequence, concat(encodeOID(oid), value))
+}
+
+// trapPDU builds a PDU with the standard sysUpTime.0 and snmpTrapOID.0
+// varbinds followed by extra ones
+func trapPDU(tag byte, trapOID string, extra ...[]byte) []byte {
+	varbinds := concat(
+		varbind(sysUpTimeOID, berEncode(berTimeTicks, []byte{0x01, 0x00})),
+		varbind(snmpTrapOIDOID, encodeOID(trapOID)),
+	)
+	varbinds = concat(varbinds, concat(extra...))
+	return berEncode(tag, concat(berEncodeInt(42), berEncodeInt(0), berEncodeInt(0), berEncode(berSequence, varbinds)))
+}
+
+func v2cMessage(community string, pdu []byte) []byte {
+	return berEncode(berSequence, concat(berEncodeInt(snmpVersion2c), berEncode(berOctetString, []byte(community)), pdu))
+}
+
+func newTestReceiver(t *testing.T, communities []string, users []SNMPUser) *SNMPTrapReceiver {
+	t.Helper()
+	r, err := NewSNMPTrapReceiver("127.0.0.1:0", communities, users, nil, "snmp", "host", zap.NewNop(), nil)
+	if err != nil {
+		t.Fatalf("NewSNMPTrapReceiver: %v", err)
+	}
+	return r
+}
+
+const linkDownOID = "1.3.6.1.6.3.1.1.5.3"
+
+func TestSNMPDecodeV2c(t *testing.T) {
+	r := newTestReceiver(t, []string{"public"}, nil)
+
+	tests := []struct {
+		name     string
+		msg      []byte
+		inform   bool
+		varbinds map[string]interface{}
+		wantErr  bool
+	}{
+		{
+			name: "trap",
+			msg: v2cMessage("public", trapPDU(snmpPDUTrapV2, linkDownOID,
+				varbind("1.3.6.1.2.1.2.2.1.1.2", berEncodeInt(2)),
+				varbind("1.3.6.1.2.1.2.2.1.2.2", berEncode(berOctetString, []byte("eth0"))),
+				varbind("1.3.6.1.2.1.4.20.1.1", berEncode(berIPAddress, []byte{10, 0, 0, 1})),
+				varbind("1.3.6.1.2.1.2.2.1.10.2", berEncode(berCounter32, []byte{0x00, 0xff, 0xff, 0xff, 0xff})),
+				varbind("1.3.6.1.2.1.2.2.1.6.2", berEncode(berOctetString, []byte{0x00, 0x1a, 0x2b})),
+				varbind("1.3.6.1.2.1.2.2.1.3.2", berEncode(berNoSuchInst, nil)),
+			)),
+			varbinds: map[string]interface{}{
+				"1.3.6.1.2.1.2.2.1.1.2":  int64(2),
+				"1.3.6.1.2.1.2.2.1.2.2":  "eth0",
+				"1.3.6.1.2.1.4.20.1.1":   "10.0.0.1",
+				"1.3.6.1.2.1.2.2.1.10.2": uint64(0xffffffff),
+				"1.3.6.1.2.1.2.2.1.6.2":  "0x001a2b",
+				"1.3.6.1.2.1.2.2.1.3.2":  "noSuchInstance",
+			},
+		},
+		{
+			name:     "inform",
+			msg:      v2cMessage("public", trapPDU(snmpPDUInform, linkDownOID)),
+			inform:   true,
+			varbinds: map[string]interface{}{},
+		},
+		{name: "unknown community", msg: v2cMessage("private", trapPDU(snmpPDUTrapV2, linkDownOID)), wantErr: true},
+		{name: "get request", msg: v2cMessage("public", trapPDU(0xa0, linkDownOID)), wantErr: true},
+		{
+			name: "no snmpTrapOID",
+			msg: v2cMessage("public", berEncode(snmpPDUTrapV2, concat(berEncodeInt(1), berEncodeInt(0), berEncodeInt(0),
+				berEncode(berSequence, varbind(sysUpTimeOID, berEncode(berTimeTicks, []byte{0x01})))))),
+			wantErr: true,
+		},
+		{
+			name: "snmpTrapOID not an OID",
+			msg: v2cMessage("public", berEncode(snmpPDUTrapV2, concat(berEncodeInt(1), berEncodeInt(0), berEncodeInt(0),
+				berEncode(berSequence, varbind(snmpTrapOIDOID, berEncodeInt(3)))))),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trap, response, err := r.decode(tt.msg, testAgent)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("decode() = %+v, want an error", trap)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decode() error: %v", err)
+			}
+			if trap.Version != "2c" || trap.TrapOID != linkDownOID || trap.Agent != "192.0.2.1" || trap.Uptime != 256 || trap.Inform != tt.inform {
+				t.Errorf("decode() = %+v", trap)
+			}
+			if len(trap.Varbinds) != len(tt.varbinds) {
+				t.Errorf("varbinds = %v, want %v", trap.Varbinds, tt.varbinds)
+			}
+			for oid, want := range tt.varbinds {
+				if got := trap.Varbinds[oid]; got != want {
+					t.Errorf("varbind %s = %#v, want %#v", oid, got, want)
+				}
+			}
+			if (response != nil) != tt.inform {
+				t.Fatalf("response = %x, want one only for informs", response)
+			}
+			if tt.inform {
+				checkInformResponse(t, response)
+			}
+		})
+	}
+}
+
+// checkInformResponse checks a response echoes the inform's request ID
+// with no error
+func checkInformResponse(t *testing.T, response []byte) {
+	t.Helper()
+	outer, err := newBERReader(response).expect(berSequence)
+	if err != nil {
+		t.Fatalf("response: %v", err)
+	}
+	fields := outer.reader()
+	if version, err := fields.expectInt(); err != nil || version != snmpVersion2c {
+		t.Fatalf("response version = %d, %v", version, err)
+	}
+	if community, err := fields.expect(berOctetString); err != nil || string(community.data) != "public" {
+		t.Fatalf("response community = %q, %v", community.data, err)
+	}
+	pdu, err := fields.expect(snmpPDUResponse)
+	if err != nil {
+		t.Fatalf("response PDU: %v", err)
+	}
+	p := pdu.reader()
+	for i, want := range []int64{42, 0, 0} {
+		if n, err := p.expectInt(); err != nil || n != want {
+			t.Errorf("response field %d = %d, %v, want %d", i, n, err, want)
+		}
+	}
+}
+
+func TestSNMPDecodeAnyCommunity(t *testing.T) {
+	r := newTestReceiver(t, nil, nil)
+	if _, _, err := r.decode(v2cMessage("anything", trapPDU(snmpPDUTrapV2, linkDownOID)), testAgent); err != nil {
+		t.Errorf("decode() error: %v", err)
+	}
+}
+
+func TestSNMPDecodeV1(t *testing.T) {
+	// SNMPv1 Trap-PDUs carry enterprise, agent address, and generic and
+	// specific trap fields in place of snmpTrapOID.0; they aren't accepted
+	pdu := berEncode(0xa4, concat(
+		encodeOID("1.3.6.1.4.1.8072"),
+		berEncode(berIPAddress, []byte{192, 0, 2, 1}),
+		berEncodeInt(2),
+		berEncodeInt(0),
+		berEncode(berTimeTicks, []byte{0x01}),
+		berEncode(berSequence, nil),
+	))
+	msg := berEncode(berSequence, concat(berEncodeInt(0), berEncode(berOctetString, []byte("public")), pdu))
+
+	r := newTestReceiver(t, nil, nil)
+	_, _, err := r.decode(msg, testAgent)
+	if err == nil || !strings.Contains(err.Error(), "unsupported SNMP version 0") {
+		t.Errorf("decode() error = %v, want unsupported version", err)
+	}
+}
+
+func TestSNMPDecodeMalformed(t *testing.T) {
+	user := SNMPUser{Username: "auth", AuthProtocol: "sha", AuthPassphrase: rfc3414Passphrase, PrivProtocol: "aes", PrivPassphrase: rfc3414Passphrase}
+	r := newTestReceiver(t, nil, []SNMPUser{user})
+
+	messages := map[string][]byte{
+		"v2c trap":   v2cMessage("public", trapPDU(snmpPDUTrapV2, linkDownOID, varbind("1.3.6.1.2.1.1.5.0", berEncode(berOctetString, []byte("host"))))),
+		"v2c inform": v2cMessage("public", trapPDU(snmpPDUInform, linkDownOID)),
+		"v3 authPriv": v3Message(t, v3Params{
+			user:  user,
+			key:   rfc3414SHAKey,
+			flags: snmpFlagAuth | snmpFlagPriv,
+			pdu:   trapPDU(snmpPDUTrapV2, linkDownOID),
+		}),
+	}
+	for name, msg := range messages {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := r.decode(msg, testAgent); err != nil {
+				t.Fatalf("decode() of the whole message error: %v", err)
+			}
+
+			// Every truncation must fail cleanly
+			for n := 0; n < len(msg); n++ {
+				if _, _, err := r.decode(msg[:n], testAgent); err == nil {
+					t.Errorf("decode() of the first %d bytes succeeded", n)
+				}
+			}
+
+			// Lengths pointing past the end, or long-form lengths of any
+			// size, must not panic
+			for i := range msg {
+				for _, b := range []byte{0x7f, 0x80, 0x84, 0x85, 0xff} {
+					corrupt := append([]byte(nil), msg...)
+					corrupt[i] = b
+					r.decode(corrupt, testAgent)
+				}
+			}
+		})
+	}
+}
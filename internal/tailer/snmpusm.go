@@ -0,0 +1,184 @@
+package tailer
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"strings"
+	"sync"
+)
+
+// SNMPUser is an SNMPv3 user traps are accepted from
+type SNMPUser struct {
+	Username       string
+	AuthProtocol   string // md5, sha, sha224, sha256, sha384, sha512, or empty for noAuthNoPriv
+	AuthPassphrase string
+	PrivProtocol   string // des, aes, or empty for no privacy
+	PrivPassphrase string
+}
+
+// snmpAuthProtocol is an HMAC authentication protocol from RFC 3414 or RFC 7860
+type snmpAuthProtocol struct {
+	hash    func() hash.Hash
+	macSize int // Truncated HMAC length carried in msgAuthenticationParameters
+}
+
+var snmpAuthProtocols = map[string]snmpAuthProtocol{
+	"md5":    {md5.New, 12},
+	"sha":    {sha1.New, 12},
+	"sha224": {sha256.New224, 16},
+	"sha256": {sha256.New, 24},
+	"sha384": {sha512.New384, 32},
+	"sha512": {sha512.New, 48},
+}
+
+// usmUser holds a user's keys before localization to an engine ID
+type usmUser struct {
+	name     string
+	auth     *snmpAuthProtocol
+	priv     string
+	authKey  []byte // Ku from the auth passphrase
+	privKey  []byte // Ku from the privacy passphrase
+	mu       sync.Mutex
+	localize map[string][2][]byte // Engine ID -> localized auth and privacy keys
+}
+
+// newUSMUser derives a user's keys from its passphrases
+func newUSMUser(u SNMPUser) (*usmUser, error) {
+	user := &usmUser{name: u.Username, localize: make(map[string][2][]byte)}
+
+	if u.AuthProtocol == "" {
+		if u.PrivProtocol != "" {
+			return nil, fmt.Errorf("snmp user %s: privacy requires authentication", u.Username)
+		}
+		return user, nil
+	}
+	auth, ok := snmpAuthProtocols[strings.ToLower(u.AuthProtocol)]
+	if !ok {
+		return nil, fmt.Errorf("snmp user %s: unknown auth protocol %q", u.Username, u.AuthProtocol)
+	}
+	user.auth = &auth
+	user.authKey = passwordToKey(auth.hash, u.AuthPassphrase)
+
+	switch strings.ToLower(u.PrivProtocol) {
+	case "":
+	case "des", "aes":
+		user.priv = strings.ToLower(u.PrivProtocol)
+		user.privKey = passwordToKey(auth.hash, u.PrivPassphrase)
+	default:
+		return nil, fmt.Errorf("snmp user %s: unknown privacy protocol %q", u.Username, u.PrivProtocol)
+	}
+	return user, nil
+}
+
+// passwordToKey derives Ku by hashing a megabyte of the repeated
+// passphrase (RFC 3414 A.2)
+func passwordToKey(newHash func() hash.Hash, passphrase string) []byte {
+	h := newHash()
+	if passphrase == "" {
+		return h.Sum(nil)
+	}
+	const total = 1024 * 1024
+	buf := make([]byte, 64)
+	p := []byte(passphrase)
+	for written, i := 0, 0; written < total; written += len(buf) {
+		for j := range buf {
+			buf[j] = p[i%len(p)]
+			i++
+		}
+		h.Write(buf)
+	}
+	return h.Sum(nil)
+}
+
+// keys returns the user's auth and privacy keys localized to an engine
+func (u *usmUser) keys(engineID []byte) (authKey, privKey []byte) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if k, ok := u.localize[string(engineID)]; ok {
+		return k[0], k[1]
+	}
+	localize := func(ku []byte) []byte {
+		if ku == nil {
+			return nil
+		}
+		h := u.auth.hash()
+		h.Write(ku)
+		h.Write(engineID)
+		h.Write(ku)
+		return h.Sum(nil)
+	}
+	k := [2][]byte{localize(u.authKey), localize(u.privKey)}
+	u.localize[string(engineID)] = k
+	return k[0], k[1]
+}
+
+// authenticate checks a message's HMAC. authOffset locates the
+// msgAuthenticationParameters contents in msg, which are zeroed while the
+// HMAC is computed.
+func (u *usmUser) authenticate(msg []byte, authOffset int, authParams, engineID []byte) bool {
+	if len(authParams) != u.auth.macSize {
+		return false
+	}
+	authKey, _ := u.keys(engineID)
+
+	zeroed := make([]byte, len(msg))
+	copy(zeroed, msg)
+	for i := range authParams {
+		zeroed[authOffset+i] = 0
+	}
+	mac := hmac.New(u.auth.hash, authKey)
+	mac.Write(zeroed)
+	return hmac.Equal(mac.Sum(nil)[:u.auth.macSize], authParams)
+}
+
+// decrypt decrypts an encrypted scoped PDU with CBC-DES (RFC 3414) or
+// CFB-AES-128 (RFC 3826)
+func (u *usmUser) decrypt(data, privParams, engineID []byte, boots, engineTime int64) ([]byte, error) {
+	if len(privParams) != 8 {
+		return nil, fmt.Errorf("invalid privacy parameters length %d", len(privParams))
+	}
+	_, privKey := u.keys(engineID)
+	if len(privKey) < 16 {
+		return nil, fmt.Errorf("privacy key too short")
+	}
+	out := make([]byte, len(data))
+
+	switch u.priv {
+	case "des":
+		if len(data)%des.BlockSize != 0 {
+			return nil, fmt.Errorf("encrypted PDU is not a multiple of the DES block size")
+		}
+		block, err := des.NewCipher(privKey[:8])
+		if err != nil {
+			return nil, err
+		}
+		iv := make([]byte, 8)
+		for i := range iv {
+			iv[i] = privKey[8+i] ^ privParams[i]
+		}
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+	case "aes":
+		block, err := aes.NewCipher(privKey[:16])
+		if err != nil {
+			return nil, err
+		}
+		iv := make([]byte, 16)
+		binary.BigEndian.PutUint32(iv[0:], uint32(boots))
+		binary.BigEndian.PutUint32(iv[4:], uint32(engineTime))
+		copy(iv[8:], privParams)
+		cipher.NewCFBDecrypter(block, iv).XORKeyStream(out, data)
+	default:
+		return nil, fmt.Errorf("user has no privacy protocol")
+	}
+	return out, nil
+}
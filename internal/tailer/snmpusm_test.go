@@ -0,0 +1,231 @@
+package tailer
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"strings"
+	"testing"
+)
+
+// The RFC 3414 A.3 key localization test vectors
+const rfc3414Passphrase = "maplesyrup"
+
+var (
+	rfc3414EngineID = mustHex("000000000000000000000002")
+	rfc3414MD5Key   = mustHex("526f5eed9fcce26f8964c2930787d82b")
+	rfc3414SHAKey   = mustHex("6695febc9288e36282235fc7151f128497b38f3f")
+)
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestPasswordToKey(t *testing.T) {
+	tests := []struct {
+		name      string
+		protocol  string
+		newHash   func() hash.Hash
+		key       string // Ku
+		localized []byte // Kul for rfc3414EngineID
+	}{
+		{name: "md5", protocol: "md5", newHash: md5.New, key: "9faf3283884e92834ebc9847d8edd963", localized: rfc3414MD5Key},
+		{name: "sha", protocol: "sha", newHash: sha1.New, key: "9fb5cc0381497b3793528939ff788d5d79145211", localized: rfc3414SHAKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hex.EncodeToString(passwordToKey(tt.newHash, rfc3414Passphrase)); got != tt.key {
+				t.Errorf("passwordToKey() = %s, want %s", got, tt.key)
+			}
+
+			user, err := newUSMUser(SNMPUser{Username: "u", AuthProtocol: tt.protocol, AuthPassphrase: rfc3414Passphrase, PrivProtocol: "des", PrivPassphrase: rfc3414Passphrase})
+			if err != nil {
+				t.Fatalf("newUSMUser: %v", err)
+			}
+			authKey, privKey := user.keys(rfc3414EngineID)
+			if !bytes.Equal(authKey, tt.localized) || !bytes.Equal(privKey, tt.localized) {
+				t.Errorf("keys() = %x, %x, want %x", authKey, privKey, tt.localized)
+			}
+		})
+	}
+}
+
+func TestNewUSMUser(t *testing.T) {
+	tests := []struct {
+		name    string
+		user    SNMPUser
+		wantErr bool
+	}{
+		{name: "noAuthNoPriv", user: SNMPUser{Username: "u"}},
+		{name: "authNoPriv", user: SNMPUser{Username: "u", AuthProtocol: "SHA256", AuthPassphrase: "secretpass"}},
+		{name: "authPriv", user: SNMPUser{Username: "u", AuthProtocol: "sha512", AuthPassphrase: "secretpass", PrivProtocol: "AES", PrivPassphrase: "privpass"}},
+		{name: "privacy without auth", user: SNMPUser{Username: "u", PrivProtocol: "des", PrivPassphrase: "privpass"}, wantErr: true},
+		{name: "unknown auth", user: SNMPUser{Username: "u", AuthProtocol: "sha3", AuthPassphrase: "secretpass"}, wantErr: true},
+		{name: "unknown privacy", user: SNMPUser{Username: "u", AuthProtocol: "sha", AuthPassphrase: "secretpass", PrivProtocol: "3des", PrivPassphrase: "privpass"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newUSMUser(tt.user)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newUSMUser() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// v3Params describes an SNMPv3 message built by v3Message
+type v3Params struct {
+	user     SNMPUser
+	key      []byte // Localized key for auth and privacy, computed independently of the code under test
+	flags    byte
+	pdu      []byte
+	engineID []byte // Defaults to rfc3414EngineID
+	tamper   bool   // Flip a byte of the PDU after authenticating
+}
+
+// v3Message builds an SNMPv3 message, encrypting and authenticating it as
+// an agent would
+func v3Message(t *testing.T, p v3Params) []byte {
+	t.Helper()
+	if p.engineID == nil {
+		p.engineID = rfc3414EngineID
+	}
+	const boots, engineTime = 3, 1234
+	salt := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+	var authParams, privParams []byte
+	var macSize int
+	if p.flags&snmpFlagAuth != 0 {
+		macSize = snmpAuthProtocols[strings.ToLower(p.user.AuthProtocol)].macSize
+		authParams = make([]byte, macSize)
+	}
+	if p.flags&snmpFlagPriv != 0 {
+		privParams = salt
+	}
+
+	scoped := berEncode(berSequence, concat(berEncode(berOctetString, p.engineID), berEncode(berOctetString, nil), p.pdu))
+	if p.flags&snmpFlagPriv != 0 {
+		var encrypted []byte
+		switch strings.ToLower(p.user.PrivProtocol) {
+		case "des":
+			block, err := des.NewCipher(p.key[:8])
+			if err != nil {
+				t.Fatal(err)
+			}
+			iv := make([]byte, 8)
+			for i := range iv {
+				iv[i] = p.key[8+i] ^ salt[i]
+			}
+			padded := append(scoped, make([]byte, (8-len(scoped)%8)%8)...)
+			encrypted = make([]byte, len(padded))
+			cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, padded)
+		case "aes":
+			block, err := aes.NewCipher(p.key[:16])
+			if err != nil {
+				t.Fatal(err)
+			}
+			iv := make([]byte, 16)
+			binary.BigEndian.PutUint32(iv[0:], boots)
+			binary.BigEndian.PutUint32(iv[4:], engineTime)
+			copy(iv[8:], salt)
+			encrypted = make([]byte, len(scoped))
+			cipher.NewCFBEncrypter(block, iv).XORKeyStream(encrypted, scoped)
+		}
+		scoped = berEncode(berOctetString, encrypted)
+	}
+
+	global := berEncode(berSequence, concat(berEncodeInt(7), berEncodeInt(65507), berEncode(berOctetString, []byte{p.flags}), berEncodeInt(usmSecurityModel)))
+	usm := berEncode(berSequence, concat(
+		berEncode(berOctetString, p.engineID),
+		berEncodeInt(boots),
+		berEncodeInt(engineTime),
+		berEncode(berOctetString, []byte(p.user.Username)),
+		berEncode(berOctetString, authParams),
+		berEncode(berOctetString, privParams),
+	))
+	msg := berEncode(berSequence, concat(berEncodeInt(snmpVersion3), global, berEncode(berOctetString, usm), scoped))
+
+	if p.flags&snmpFlagAuth != 0 {
+		newHash := md5.New
+		if strings.ToLower(p.user.AuthProtocol) == "sha" {
+			newHash = sha1.New
+		}
+		mac := hmac.New(newHash, p.key)
+		mac.Write(msg)
+		at := bytes.Index(msg, berEncode(berOctetString, authParams)) + 2
+		copy(msg[at:], mac.Sum(nil)[:macSize])
+	}
+	if p.tamper {
+		msg[len(msg)-1] ^= 0xff
+	}
+	return msg
+}
+
+func TestSNMPDecodeV3(t *testing.T) {
+	users := map[string]SNMPUser{
+		"noauth":  {Username: "noauth"},
+		"md5":     {Username: "md5", AuthProtocol: "md5", AuthPassphrase: rfc3414Passphrase},
+		"sha":     {Username: "sha", AuthProtocol: "sha", AuthPassphrase: rfc3414Passphrase},
+		"md5des":  {Username: "md5des", AuthProtocol: "md5", AuthPassphrase: rfc3414Passphrase, PrivProtocol: "des", PrivPassphrase: rfc3414Passphrase},
+		"shades":  {Username: "shades", AuthProtocol: "sha", AuthPassphrase: rfc3414Passphrase, PrivProtocol: "des", PrivPassphrase: rfc3414Passphrase},
+		"shaaes":  {Username: "shaaes", AuthProtocol: "sha", AuthPassphrase: rfc3414Passphrase, PrivProtocol: "aes", PrivPassphrase: rfc3414Passphrase},
+		"wrongpw": {Username: "wrongpw", AuthProtocol: "sha", AuthPassphrase: "not maplesyrup"},
+	}
+	var configured []SNMPUser
+	for _, u := range users {
+		configured = append(configured, u)
+	}
+	r := newTestReceiver(t, nil, configured)
+	pdu := trapPDU(snmpPDUTrapV2, linkDownOID, varbind("1.3.6.1.2.1.2.2.1.1.2", berEncodeInt(2)))
+
+	tests := []struct {
+		name    string
+		params  v3Params
+		wantErr bool
+	}{
+		{name: "noAuthNoPriv", params: v3Params{user: users["noauth"]}},
+		{name: "authNoPriv md5", params: v3Params{user: users["md5"], key: rfc3414MD5Key, flags: snmpFlagAuth}},
+		{name: "authNoPriv sha", params: v3Params{user: users["sha"], key: rfc3414SHAKey, flags: snmpFlagAuth}},
+		{name: "authPriv md5 des", params: v3Params{user: users["md5des"], key: rfc3414MD5Key, flags: snmpFlagAuth | snmpFlagPriv}},
+		{name: "authPriv sha des", params: v3Params{user: users["shades"], key: rfc3414SHAKey, flags: snmpFlagAuth | snmpFlagPriv}},
+		{name: "authPriv sha aes", params: v3Params{user: users["shaaes"], key: rfc3414SHAKey, flags: snmpFlagAuth | snmpFlagPriv}},
+		{name: "wrong passphrase", params: v3Params{user: users["wrongpw"], key: rfc3414SHAKey, flags: snmpFlagAuth}, wantErr: true},
+		{name: "tampered", params: v3Params{user: users["sha"], key: rfc3414SHAKey, flags: snmpFlagAuth, tamper: true}, wantErr: true},
+		{name: "other engine", params: v3Params{user: users["sha"], key: rfc3414SHAKey, flags: snmpFlagAuth, engineID: mustHex("000000000000000000000003")}, wantErr: true},
+		{name: "missing auth", params: v3Params{user: users["sha"]}, wantErr: true},
+		{name: "missing privacy", params: v3Params{user: users["shaaes"], key: rfc3414SHAKey, flags: snmpFlagAuth}, wantErr: true},
+		{name: "unknown user", params: v3Params{user: SNMPUser{Username: "nobody"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.params.pdu = pdu
+			trap, response, err := r.decode(v3Message(t, tt.params), testAgent)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("decode() = %+v, want an error", trap)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decode() error: %v", err)
+			}
+			if trap.Version != "3" || trap.User != tt.params.user.Username || trap.TrapOID != linkDownOID || trap.Varbinds["1.3.6.1.2.1.2.2.1.1.2"] != int64(2) {
+				t.Errorf("decode() = %+v", trap)
+			}
+			if response != nil {
+				t.Errorf("response = %x, want none for v3", response)
+			}
+		})
+	}
+}
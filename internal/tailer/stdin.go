@@ -0,0 +1,65 @@
+package tailer
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/oicur0t/logl/pkg/models"
+	"go.uber.org/zap"
+)
+
+// StdinReader ships lines read from a stream, such as a process's stdout
+// piped into the tailer, without any state tracking
+type StdinReader struct {
+	reader      io.Reader
+	serviceName string
+	hostname    string
+	logger      *zap.Logger
+	lineChan    chan<- models.LogEntry
+}
+
+// NewStdinReader creates a new stream reader
+func NewStdinReader(reader io.Reader, serviceName, hostname string, logger *zap.Logger, lineChan chan<- models.LogEntry) *StdinReader {
+	return &StdinReader{
+		reader:      reader,
+		serviceName: serviceName,
+		hostname:    hostname,
+		logger:      logger,
+		lineChan:    lineChan,
+	}
+}
+
+// Start reads until EOF or cancellation and returns the number of lines read
+func (r *StdinReader) Start(ctx context.Context) (int64, error) {
+	scanner := bufio.NewScanner(r.reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSocketLineSize)
+
+	var lineNumber int64
+	for scanner.Scan() {
+		lineNumber++
+		entry := models.LogEntry{
+			ServiceName: r.serviceName,
+			Hostname:    r.hostname,
+			FilePath:    "stdin",
+			Line:        scanner.Text(),
+			Timestamp:   time.Now(),
+			LineNumber:  lineNumber,
+		}
+
+		select {
+		case r.lineChan <- entry:
+		case <-ctx.Done():
+			return lineNumber, ctx.Err()
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return lineNumber, fmt.Errorf("failed to read stdin: %w", err)
+	}
+
+	r.logger.Debug("Reached end of stdin", zap.Int64("lines", lineNumber))
+	return lineNumber, nil
+}
@@ -0,0 +1,222 @@
+package tailer
+
+import (
+	"context"
+	"runtime/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oicur0t/logl/internal/config"
+	"go.uber.org/zap"
+)
+
+const (
+	// minThrottleRate keeps files moving however hard the tailer is throttled
+	minThrottleRate = 10.0
+
+	// throttleHighWater is the share of a limit at which reads slow down
+	throttleHighWater = 0.9
+
+	// throttleLowWater is the share of a limit below which reads speed up
+	throttleLowWater = 0.75
+)
+
+// Throttle paces file reads, capping lines per second and slowing reads
+// further while the tailer's CPU or memory use nears its limits. Lines
+// not yet read stay in the files, so slowing down delays shipping rather
+// than losing lines.
+type Throttle struct {
+	maxCPU        float64 // Share of one core; 0 is unlimited
+	maxMemory     uint64  // Bytes; 0 is unlimited
+	maxRate       float64 // Lines per second; 0 is unlimited
+	checkInterval time.Duration
+	logger        *zap.Logger
+
+	limited atomic.Bool
+	lines   atomic.Int64
+
+	mu     sync.Mutex
+	rate   float64 // Current lines per second; 0 while unlimited
+	tokens float64
+	last   time.Time
+}
+
+// NewThrottle creates a new throttle for the configured limits
+func NewThrottle(cfg config.ResourcesConfig, logger *zap.Logger) *Throttle {
+	t := &Throttle{
+		maxCPU:        cfg.MaxCPUPercent / 100,
+		maxMemory:     uint64(cfg.MaxMemoryMB) << 20,
+		maxRate:       float64(cfg.MaxLinesPerSecond),
+		checkInterval: cfg.CheckInterval,
+		logger:        logger,
+	}
+	t.setRate(t.maxRate)
+	return t
+}
+
+// Wait blocks until the next line may be read
+func (t *Throttle) Wait(ctx context.Context) error {
+	t.lines.Add(1)
+	if !t.limited.Load() {
+		return nil
+	}
+
+	t.mu.Lock()
+	if t.rate == 0 {
+		t.mu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	t.tokens += now.Sub(t.last).Seconds() * t.rate
+	if t.tokens > t.rate {
+		t.tokens = t.rate // Bursts up to one second of lines
+	}
+	t.last = now
+	t.tokens--
+	var delay time.Duration
+	if t.tokens < 0 {
+		delay = time.Duration(-t.tokens / t.rate * float64(time.Second))
+	}
+	t.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// setRate changes the lines per second allowed; 0 is unlimited
+func (t *Throttle) setRate(rate float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.rate == 0 && rate > 0 {
+		t.tokens = rate
+		t.last = time.Now()
+	}
+	t.rate = rate
+	t.limited.Store(rate > 0)
+}
+
+// Start samples CPU and memory use every check interval until the context
+// is cancelled, adjusting the read rate to keep them under their limits
+func (t *Throttle) Start(ctx context.Context) {
+	if t.maxCPU == 0 && t.maxMemory == 0 {
+		return // Only the fixed line rate applies
+	}
+
+	ticker := time.NewTicker(t.checkInterval)
+	defer ticker.Stop()
+
+	lastCPU, _ := processCPUTime()
+	lastAt := time.Now()
+	lastLines := t.lines.Load()
+
+	for {
+		select {
+		case <-ticker.C:
+			now := time.Now()
+			elapsed := now.Sub(lastAt).Seconds()
+			cpu, err := processCPUTime()
+			if err != nil {
+				t.logger.Warn("Failed to read CPU time", zap.Error(err))
+				continue
+			}
+			lines := t.lines.Load()
+
+			var cpuShare, pressure float64
+			if elapsed > 0 {
+				cpuShare = (cpu - lastCPU).Seconds() / elapsed
+			}
+			if t.maxCPU > 0 {
+				pressure = cpuShare / t.maxCPU
+			}
+			memory := memoryInUse()
+			if t.maxMemory > 0 {
+				pressure = max(pressure, float64(memory)/float64(t.maxMemory))
+			}
+			var observed float64
+			if elapsed > 0 {
+				observed = float64(lines-lastLines) / elapsed
+			}
+			t.adjust(pressure, observed, cpuShare, memory)
+
+			lastCPU, lastAt, lastLines = cpu, now, lines
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// adjust cuts the read rate while use is near or over a limit and raises
+// it gradually once use drops well below
+func (t *Throttle) adjust(pressure, observed, cpuShare float64, memory uint64) {
+	t.mu.Lock()
+	rate := t.rate
+	t.mu.Unlock()
+
+	current := rate
+	if current == 0 {
+		current = observed
+	}
+
+	next := rate
+	switch {
+	case pressure >= 1:
+		next = max(current*0.5, minThrottleRate)
+	case pressure >= throttleHighWater:
+		next = max(current*0.8, minThrottleRate)
+	case pressure < throttleLowWater && rate > 0:
+		next = rate * 1.25
+		if t.maxRate > 0 {
+			next = min(next, t.maxRate)
+		} else if next >= 2*observed && next > minThrottleRate*2 {
+			// Reads no longer use the allowance, so stop throttling
+			next = 0
+		}
+	}
+	if t.maxRate > 0 && (next == 0 || next > t.maxRate) {
+		next = t.maxRate
+	}
+	if next == rate {
+		return
+	}
+
+	fields := []zap.Field{
+		zap.Float64("cpu_percent", cpuShare*100),
+		zap.Uint64("memory_mb", memory>>20),
+	}
+	switch {
+	case next == t.maxRate && t.maxRate > 0, next == 0:
+		t.logger.Info("Resource use back under limits, throttling lifted", fields...)
+	case rate == 0 || rate == t.maxRate:
+		t.logger.Warn("Resource use near limits, throttling file reads",
+			append(fields, zap.Float64("lines_per_second", next))...)
+	default:
+		t.logger.Debug("Adjusted file read rate",
+			append(fields, zap.Float64("lines_per_second", next))...)
+	}
+	t.setRate(next)
+}
+
+// memoryInUse returns the memory the Go runtime holds from the OS, which
+// is what the soft memory limit bounds
+func memoryInUse() uint64 {
+	samples := []metrics.Sample{
+		{Name: "/memory/classes/total:bytes"},
+		{Name: "/memory/classes/heap/released:bytes"},
+	}
+	metrics.Read(samples)
+	if samples[0].Value.Kind() != metrics.KindUint64 || samples[1].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return samples[0].Value.Uint64() - samples[1].Value.Uint64()
+}
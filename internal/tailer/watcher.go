@@ -1,43 +1,155 @@
 package tailer
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/nxadm/tail"
+	"github.com/nxadm/tail/watch"
 	"github.com/oicur0t/logl/pkg/models"
 	"go.uber.org/zap"
 )
 
+// FileSource describes a configured log file pattern and how to read it
+type FileSource struct {
+	Pattern      string // path, glob, or directory
+	ServiceName  string
+	Framing      string      // "line" or "json"
+	Filter       *LineFilter // nil ships every line
+	Labels       map[string]string
+	Backpressure string // Empty uses the watcher's policy
+	Backfill     bool   // Read rotated files and the whole file when first seen
+	ReadFrom     string // Where a file first seen is read from: ReadFromEnd (default) or ReadFromBeginning
+}
+
+// How files are watched for new lines
+const (
+	TailModePoll    = "poll"    // Check each file every poll interval
+	TailModeInotify = "inotify" // Wait for filesystem notifications
+	TailModeAuto    = "auto"    // Notifications, polling files that can't be watched
+)
+
+// Where files without saved state are read from
+const (
+	ReadFromBeginning = "beginning"
+	ReadFromEnd       = "end"
+)
+
+// ErrUnknownFile is returned when pausing a file the watcher hasn't
+// discovered, or resuming one that isn't paused
+var ErrUnknownFile = errors.New("file is not being tailed")
+
+// activeTail is a running tail of one file
+type activeTail struct {
+	cancel context.CancelFunc
+	done   chan struct{} // Closed once the tail has stopped
+}
+
 // Watcher tails log files and sends lines to a channel
 type Watcher struct {
-	serviceNames map[string]string // filepath -> service name mapping
-	hostname     string
-	logFiles     []string
-	stateFile    string
-	logger       *zap.Logger
-	lineChan     chan<- models.LogEntry
-	state        map[string]*models.FileState
-	stateMu      sync.RWMutex
+	sources        []FileSource
+	hostname       string
+	rescanInterval time.Duration
+	stateFile      string
+	logger         *zap.Logger
+	lineChan       chan<- models.LogEntry
+	state          map[string]*models.FileState
+	stateMu        sync.RWMutex
+	throttle       *Throttle // nil reads files as fast as lines arrive
+	backfill       bool      // Backfill every file first seen, as with FileSource.Backfill
+	tailMode       string
+	reopen         bool            // Follow the path to a recreated file
+	polled         map[string]bool // filepaths auto mode polls because they couldn't be watched
+
+	// Backpressure when the batcher falls behind
+	backpressure string
+	timeout      time.Duration // How long drop_newest waits before dropping
+	queue        *dropQueue    // Entries from drop_oldest files
+	droppedMu    sync.Mutex
+	dropped      map[string]int64 // filepath -> lines dropped since start
+	reported     map[string]int64 // filepath -> dropped count last logged
+
+	activeMu    sync.Mutex
+	active      map[string]*activeTail // filepath -> its tail goroutine
+	fileSources map[string]FileSource  // filepath -> source whose pattern matched it
+	appeared    map[string]bool        // filepaths found by a rescan after startup, read from their start
+	missing     map[string]time.Time   // filepaths gone since, whose state is kept for missingStateGrace
+	paused      map[string]bool        // filepaths paused through the control API
+	rescanNow   chan struct{}          // Starts resumed files without waiting for the next rescan
+	reload      chan []FileSource      // Sources from a config reload, applied by Start
 }
 
 // NewWatcher creates a new log file watcher
-func NewWatcher(serviceNames map[string]string, hostname string, logFiles []string, stateFile string, logger *zap.Logger, lineChan chan<- models.LogEntry) *Watcher {
+func NewWatcher(sources []FileSource, hostname string, rescanInterval time.Duration, stateFile string, logger *zap.Logger, lineChan chan<- models.LogEntry) *Watcher {
 	return &Watcher{
-		serviceNames: serviceNames,
-		hostname:     hostname,
-		logFiles:     logFiles,
-		stateFile:    stateFile,
-		logger:       logger,
-		lineChan:     lineChan,
-		state:        make(map[string]*models.FileState),
+		sources:        sources,
+		hostname:       hostname,
+		rescanInterval: rescanInterval,
+		stateFile:      stateFile,
+		logger:         logger,
+		lineChan:       lineChan,
+		state:          make(map[string]*models.FileState),
+		active:         make(map[string]*activeTail),
+		fileSources:    make(map[string]FileSource),
+		appeared:       make(map[string]bool),
+		missing:        make(map[string]time.Time),
+		paused:         make(map[string]bool),
+		rescanNow:      make(chan struct{}, 1),
+		reload:         make(chan []FileSource, 1),
+		tailMode:       TailModePoll,
+		polled:         make(map[string]bool),
+		reopen:         true,
+		backpressure:   BackpressureDropNewest,
+		timeout:        5 * time.Second,
+		queue:          newDropQueue(1000),
+		dropped:        make(map[string]int64),
+		reported:       make(map[string]int64),
 	}
 }
 
+// SetBackpressure sets what reads from files without their own policy do
+// when the batcher falls behind, how long drop_newest waits before
+// dropping a line, and how many lines drop_oldest queues. It must be
+// called before Start.
+func (w *Watcher) SetBackpressure(policy string, timeout time.Duration, queueSize int) {
+	w.backpressure = policy
+	w.timeout = timeout
+	w.queue = newDropQueue(queueSize)
+}
+
+// SetTailing sets how files are watched for new lines, how often polled
+// files are checked, and whether a recreated file is followed. The poll
+// interval applies to every watcher in the process. It must be called
+// before Start.
+func (w *Watcher) SetTailing(mode string, pollInterval time.Duration, reopen bool) {
+	w.tailMode = mode
+	w.reopen = reopen
+	watch.POLL_DURATION = pollInterval
+}
+
+// SetBackfill makes every file without saved state ship its rotated
+// files and its whole content, as if each source set Backfill
+func (w *Watcher) SetBackfill(backfill bool) {
+	w.backfill = backfill
+}
+
+// SetThrottle paces file reads with the given throttle
+func (w *Watcher) SetThrottle(throttle *Throttle) {
+	w.throttle = throttle
+}
+
 // Start begins tailing all configured log files
 func (w *Watcher) Start(ctx context.Context) error {
 	// Load previous state
@@ -47,17 +159,28 @@ func (w *Watcher) Start(ctx context.Context) error {
 
 	// Start state saver goroutine
 	go w.stateSaver(ctx)
+	go w.queue.run(ctx, w.lineChan)
 
-	// Start a goroutine for each log file
+	// Start a goroutine for each discovered log file and keep rescanning
+	// so files matching a glob or directory are picked up and dropped
 	var wg sync.WaitGroup
-	for _, logFile := range w.logFiles {
-		wg.Add(1)
-		go func(filepath string) {
-			defer wg.Done()
-			if err := w.tailFile(ctx, filepath); err != nil {
-				w.logger.Error("Error tailing file", zap.String("file", filepath), zap.Error(err))
-			}
-		}(logFile)
+	w.rescan(ctx, &wg, true)
+
+	ticker := time.NewTicker(w.rescanInterval)
+	defer ticker.Stop()
+
+	for running := true; running; {
+		select {
+		case <-ticker.C:
+			w.rescan(ctx, &wg, false)
+		case <-w.rescanNow:
+			w.rescan(ctx, &wg, false)
+		case sources := <-w.reload:
+			w.applySources(sources)
+			w.rescan(ctx, &wg, true)
+		case <-ctx.Done():
+			running = false
+		}
 	}
 
 	// Wait for all goroutines to finish
@@ -71,37 +194,368 @@ func (w *Watcher) Start(ctx context.Context) error {
 	return nil
 }
 
+// missingStateGrace is how long, and for at least two rescans, the state
+// of a file no longer found is kept. A file renamed away by rotation is
+// back under its path by then, and its state tells whether it is still the
+// same file, to resume, or a new one, read from the start once the rotated
+// one is finished.
+const missingStateGrace = 5 * time.Minute
+
+// rescan starts tailing newly discovered files and stops files that
+// disappeared. Files the initial scan, or one after a config reload, finds
+// already existed and are read as read_from says; files a later rescan
+// finds were created since, so all of their lines are new.
+func (w *Watcher) rescan(ctx context.Context, wg *sync.WaitGroup, initial bool) {
+	w.activeMu.Lock()
+	sources := w.sources
+	w.activeMu.Unlock()
+	discovered := w.discoverFiles(sources)
+
+	w.activeMu.Lock()
+	defer w.activeMu.Unlock()
+
+	now := time.Now()
+	grace := missingStateGrace
+	if 2*w.rescanInterval > grace {
+		grace = 2 * w.rescanInterval
+	}
+	for path, since := range w.missing {
+		if _, back := discovered[path]; back {
+			delete(w.missing, path)
+			continue
+		}
+		if now.Sub(since) >= grace {
+			delete(w.missing, path)
+			w.stateMu.Lock()
+			delete(w.state, path)
+			w.stateMu.Unlock()
+		}
+	}
+
+	for path, source := range discovered {
+		if _, known := w.fileSources[path]; !known && !initial {
+			w.appeared[path] = true
+		}
+		w.fileSources[path] = source
+		if _, running := w.active[path]; running {
+			continue
+		}
+		if _, paused := w.paused[path]; paused {
+			continue
+		}
+
+		fileCtx, cancel := context.WithCancel(ctx)
+		tail := &activeTail{cancel: cancel, done: make(chan struct{})}
+		w.active[path] = tail
+
+		wg.Add(1)
+		go func(filepath string) {
+			defer wg.Done()
+			defer close(tail.done)
+			if err := w.tailFile(fileCtx, filepath); err != nil && err != context.Canceled {
+				w.logger.Error("Error tailing file", zap.String("file", filepath), zap.Error(err))
+			}
+
+			// Allow a later rescan to restart the file if it stopped on its own
+			if ctx.Err() == nil {
+				w.activeMu.Lock()
+				if w.active[filepath] == tail {
+					delete(w.active, filepath)
+				}
+				w.activeMu.Unlock()
+			}
+		}(path)
+	}
+
+	for path := range w.fileSources {
+		if _, exists := discovered[path]; exists {
+			continue
+		}
+		if _, paused := w.paused[path]; paused {
+			continue // Kept until resumed, as it may be away for manual rotation
+		}
+
+		if tail, running := w.active[path]; running {
+			w.logger.Info("Log file no longer present, stopping tail", zap.String("file", path))
+			tail.cancel()
+			delete(w.active, path)
+		}
+		delete(w.fileSources, path)
+		delete(w.appeared, path)
+		w.missing[path] = now
+	}
+}
+
+// SetSources replaces the configured files, e.g. on a config reload. Files
+// no longer matched stop, newly matched files start, and files whose
+// service, framing, filter, or labels changed restart from their saved
+// position. Other files carry on undisturbed.
+func (w *Watcher) SetSources(sources []FileSource) {
+	// Only the latest reload matters if Start hasn't applied an earlier one
+	select {
+	case <-w.reload:
+	default:
+	}
+	w.reload <- sources
+}
+
+// applySources switches to new sources, stopping the tails of files whose
+// settings changed so the following rescan restarts them
+func (w *Watcher) applySources(sources []FileSource) {
+	discovered := w.discoverFiles(sources)
+
+	w.activeMu.Lock()
+	w.sources = sources
+	var restart []*activeTail
+	for path, source := range discovered {
+		old, known := w.fileSources[path]
+		if !known || sameSource(old, source) {
+			continue
+		}
+		w.fileSources[path] = source
+		if tail, running := w.active[path]; running {
+			w.logger.Info("Log file settings changed, restarting tail", zap.String("file", path))
+			delete(w.active, path)
+			restart = append(restart, tail)
+		}
+	}
+	w.activeMu.Unlock()
+
+	for _, tail := range restart {
+		tail.cancel()
+		<-tail.done
+	}
+}
+
+// sameSource reports whether a file would be read the same way under both
+// sources
+func sameSource(a, b FileSource) bool {
+	return a.ServiceName == b.ServiceName && a.Framing == b.Framing &&
+		sameFilter(a.Filter, b.Filter) && maps.Equal(a.Labels, b.Labels) &&
+		a.Backpressure == b.Backpressure
+}
+
+// Pause stops tailing a file, keeping its position so Resume carries on
+// from it. The file is closed before Pause returns, so it can be rotated or
+// compressed by hand. Pauses last until Resume or a restart.
+func (w *Watcher) Pause(path string) error {
+	w.activeMu.Lock()
+	if _, known := w.fileSources[path]; !known {
+		w.activeMu.Unlock()
+		return ErrUnknownFile
+	}
+	if _, paused := w.paused[path]; paused {
+		w.activeMu.Unlock()
+		return nil
+	}
+	tail := w.active[path]
+	delete(w.active, path)
+	w.paused[path] = true
+	w.activeMu.Unlock()
+
+	if tail != nil {
+		tail.cancel()
+		<-tail.done
+	}
+
+	w.logger.Info("Paused tailing file", zap.String("file", path))
+	return nil
+}
+
+// Resume starts tailing a paused file again from where it stopped. A file
+// rotated while paused is finished first, as on startup.
+func (w *Watcher) Resume(path string) error {
+	w.activeMu.Lock()
+	if _, paused := w.paused[path]; !paused {
+		w.activeMu.Unlock()
+		return ErrUnknownFile
+	}
+	delete(w.paused, path)
+	w.activeMu.Unlock()
+
+	select {
+	case w.rescanNow <- struct{}{}:
+	default:
+	}
+	w.logger.Info("Resumed tailing file", zap.String("file", path))
+	return nil
+}
+
+// Files reports every discovered file, including paused ones
+func (w *Watcher) Files() []models.TailedFile {
+	w.activeMu.Lock()
+	files := make([]models.TailedFile, 0, len(w.fileSources))
+	for path, source := range w.fileSources {
+		_, paused := w.paused[path]
+		files = append(files, models.TailedFile{Path: path, Service: source.ServiceName, Paused: paused})
+	}
+	w.activeMu.Unlock()
+
+	w.stateMu.RLock()
+	for i := range files {
+		if state, ok := w.state[files[i].Path]; ok {
+			files[i].Offset = state.Offset
+			files[i].LineNumber = state.LineNumber
+			files[i].LastRead = state.LastRead
+		}
+	}
+	w.stateMu.RUnlock()
+
+	w.droppedMu.Lock()
+	for i := range files {
+		files[i].Dropped = w.dropped[files[i].Path]
+	}
+	w.droppedMu.Unlock()
+
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files
+}
+
+// discoverFiles expands the configured patterns into concrete file paths.
+// A file matched by several patterns belongs to the first one.
+func (w *Watcher) discoverFiles(sources []FileSource) map[string]FileSource {
+	files := make(map[string]FileSource)
+	for _, source := range sources {
+		for _, path := range w.expandPattern(source.Pattern) {
+			if _, claimed := files[path]; !claimed {
+				files[path] = source
+			}
+		}
+	}
+	return files
+}
+
+// expandPattern resolves a pattern, logging unreadable directories and
+// invalid globs
+func (w *Watcher) expandPattern(pattern string) []string {
+	paths, err := ExpandPattern(pattern)
+	if err != nil {
+		w.logger.Warn("Failed to expand log file pattern", zap.String("pattern", pattern), zap.Error(err))
+	}
+	return paths
+}
+
+// ExpandPattern resolves a directory, glob, or plain path to files. A
+// directory's rotated and compressed files are left out. Plain paths are
+// returned as-is so they are tailed even before they exist.
+func ExpandPattern(pattern string) ([]string, error) {
+	if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+		entries, err := os.ReadDir(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read log directory: %w", err)
+		}
+
+		names := make(map[string]bool, len(entries))
+		for _, entry := range entries {
+			names[entry.Name()] = true
+		}
+
+		// Rotated generations are read through the file they rotated from
+		var paths []string
+		for _, entry := range entries {
+			if entry.Type().IsRegular() && !rotatedName(entry.Name(), names) {
+				paths = append(paths, filepath.Join(pattern, entry.Name()))
+			}
+		}
+		return paths, nil
+	}
+
+	if !strings.ContainsAny(pattern, "*?[") {
+		return []string{pattern}, nil
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log file pattern: %w", err)
+	}
+
+	var paths []string
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil && info.Mode().IsRegular() {
+			paths = append(paths, match)
+		}
+	}
+	return paths, nil
+}
+
+// sourceFor returns the source configuration for a discovered file
+func (w *Watcher) sourceFor(filepath string) FileSource {
+	w.activeMu.Lock()
+	defer w.activeMu.Unlock()
+	return w.fileSources[filepath]
+}
+
 // tailFile tails a single log file
 func (w *Watcher) tailFile(ctx context.Context, filepath string) error {
 	w.logger.Info("Starting to tail file", zap.String("file", filepath))
 
 	// Configure tail
+	w.activeMu.Lock()
+	poll := w.tailMode == TailModePoll || (w.tailMode == TailModeAuto && w.polled[filepath])
+	appeared := w.appeared[filepath]
+	delete(w.appeared, filepath)
+	w.activeMu.Unlock()
 	config := tail.Config{
 		Follow:    true,
-		ReOpen:    true,
+		ReOpen:    w.reopen,
 		MustExist: false,
-		Poll:      true, // Use polling for better compatibility
+		Poll:      poll,
 		Location:  &tail.SeekInfo{Offset: 0, Whence: os.SEEK_END},
 	}
 
-	// If we have previous state, seek to that position
-	w.stateMu.RLock()
-	if state, exists := w.state[filepath]; exists {
-		config.Location = &tail.SeekInfo{Offset: state.Offset, Whence: os.SEEK_SET}
-		w.logger.Info("Resuming from saved position",
-			zap.String("file", filepath),
-			zap.Int64("offset", state.Offset))
+	source := w.sourceFor(filepath)
+
+	policy := source.Backpressure
+	if policy == "" {
+		policy = w.backpressure
 	}
+
+	// If we have previous state, seek to that position and carry on its
+	// line numbering. Otherwise count the lines already in the file, so
+	// line numbers match the file's from the first run, and start after
+	// them unless the file is read from the beginning or appeared while
+	// running.
+	var lineNumber int64
+	w.stateMu.RLock()
+	state, exists := w.state[filepath]
 	w.stateMu.RUnlock()
+	if exists {
+		offset, lines, err := w.resumeState(ctx, filepath, state, source, policy)
+		if err != nil {
+			return err
+		}
+		config.Location = &tail.SeekInfo{Offset: offset, Whence: os.SEEK_SET}
+		lineNumber = lines
+	} else if source.Backfill || w.backfill {
+		lines, err := w.backfillFile(ctx, filepath, source, policy)
+		if err != nil {
+			return err
+		}
+		config.Location = &tail.SeekInfo{Offset: 0, Whence: os.SEEK_SET}
+		lineNumber = lines
+	} else if source.ReadFrom == ReadFromBeginning || appeared {
+		w.logger.Info("Reading new file from the beginning", zap.String("file", filepath))
+		config.Location = &tail.SeekInfo{Offset: 0, Whence: os.SEEK_SET}
+	} else if offset, lines, err := countLines(filepath); err == nil {
+		config.Location = &tail.SeekInfo{Offset: offset, Whence: os.SEEK_SET}
+		lineNumber = lines
+	}
 
 	// Start tailing
+	id, _ := identify(filepath)
 	t, err := tail.TailFile(filepath, config)
 	if err != nil {
 		return fmt.Errorf("failed to tail file %s: %w", filepath, err)
 	}
 	defer t.Cleanup()
 
-	var lineNumber int64
+	// Pretty-printed JSON documents are reassembled before shipping
+	var framer *JSONFramer
+	if source.Framing == "json" {
+		framer = NewJSONFramer(maxFramedLines)
+	}
+
+	var entryLine, lastOffset int64
 	for {
 		select {
 		case <-ctx.Done():
@@ -110,7 +564,18 @@ func (w *Watcher) tailFile(ctx context.Context, filepath string) error {
 
 		case line, ok := <-t.Lines:
 			if !ok {
-				w.logger.Warn("Tail channel closed", zap.String("file", filepath))
+				// In auto mode, a file that can't be watched, for example
+				// past fs.inotify.max_user_watches, is polled from its saved
+				// position once the next rescan restarts it
+				err := t.Wait()
+				if err != nil && !poll && w.tailMode == TailModeAuto {
+					w.logger.Warn("Can't watch file for changes, polling it instead", zap.String("file", filepath), zap.Error(err))
+					w.activeMu.Lock()
+					w.polled[filepath] = true
+					w.activeMu.Unlock()
+					return nil
+				}
+				w.logger.Warn("Tail channel closed", zap.String("file", filepath), zap.Error(err))
 				return nil
 			}
 
@@ -119,48 +584,330 @@ func (w *Watcher) tailFile(ctx context.Context, filepath string) error {
 				continue
 			}
 
+			if w.throttle != nil {
+				if err := w.throttle.Wait(ctx); err != nil {
+					return err
+				}
+			}
+
 			lineNumber++
 
-			// Create log entry
-			entry := models.LogEntry{
-				ServiceName: w.serviceNames[filepath],
-				Hostname:    w.hostname,
-				FilePath:    filepath,
-				Line:        line.Text,
-				Timestamp:   time.Now(),
-				LineNumber:  lineNumber,
+			text := line.Text
+			if framer != nil {
+				if !framer.Pending() {
+					entryLine = lineNumber
+				}
+				doc, complete := framer.Push(text)
+				if !complete {
+					// Don't advance saved state mid-document so a restart rereads it whole
+					continue
+				}
+				text = doc
+			} else {
+				entryLine = lineNumber
 			}
 
-			// Send to batch channel (non-blocking with timeout)
-			select {
-			case w.lineChan <- entry:
-				// Successfully sent
-			case <-time.After(5 * time.Second):
-				w.logger.Warn("Timeout sending line to batcher, dropping line",
-					zap.String("file", filepath),
-					zap.Int64("line_number", lineNumber))
-			case <-ctx.Done():
-				return ctx.Err()
+			if err := w.ship(ctx, source, policy, filepath, text, entryLine); err != nil {
+				return err
 			}
 
-			// Update state
+			// Update state, identifying the file again once the tail has
+			// reopened it after rotation or it has grown past a short
+			// fingerprint
 			offset, err := t.Tell()
 			if err == nil {
-				w.updateState(filepath, offset, lineNumber)
+				if offset < lastOffset || (id.size < fingerprintBytes && offset > id.size) {
+					if current, err := identify(filepath); err == nil {
+						id = current
+					}
+				}
+				lastOffset = offset
+				w.updateState(filepath, offset, lineNumber, id)
 			}
 		}
 	}
 }
 
+// resumeState returns the offset and line number to carry on reading a
+// file from. When the file at the path isn't the one the state was saved
+// for, the lines the saved file gained since are shipped from wherever
+// rotation moved it, followed by any later generations rotated away while
+// the file wasn't tailed, and the new file is read from the start. A file
+// truncated in place is also read from the start.
+func (w *Watcher) resumeState(ctx context.Context, path string, state *models.FileState, source FileSource, policy string) (int64, int64, error) {
+	saved := stateIdentity(state)
+	if !saved.known() || saved.sameFile(path) {
+		if info, err := os.Stat(path); err == nil && info.Size() < state.Offset {
+			w.logger.Info("File was truncated, reading it from the start", zap.String("file", path))
+			return 0, state.LineNumber, nil
+		}
+		w.logger.Info("Resuming from saved position",
+			zap.String("file", path),
+			zap.Int64("offset", state.Offset))
+		return state.Offset, state.LineNumber, nil
+	}
+
+	gens := generations(path)
+	start := findGeneration(gens, saved)
+	if start < 0 {
+		if rotated := findRotated(path, saved); rotated != "" {
+			gens, start = []generation{{path: rotated}}, 0
+		}
+	}
+	if start < 0 {
+		w.logger.Warn("File was replaced and the previous one wasn't found, lines it gained may be missing",
+			zap.String("file", path))
+		return 0, state.LineNumber, nil
+	}
+
+	w.logger.Info("File was rotated, finishing rotated files first",
+		zap.String("file", path),
+		zap.Int("rotated_files", len(gens)-start))
+	lineNumber, err := w.readGenerations(ctx, path, gens[start:], state.Offset, state.LineNumber, saved, source, policy)
+	if err != nil {
+		return 0, 0, err
+	}
+	w.logger.Info("Reading replaced file from the start", zap.String("file", path))
+	return 0, lineNumber, nil
+}
+
+// backfillFile ships every generation rotation left next to a file not
+// seen before, oldest first, returning the line number reached. The file
+// itself is then read from the start.
+func (w *Watcher) backfillFile(ctx context.Context, path string, source FileSource, policy string) (int64, error) {
+	gens := generations(path)
+	w.logger.Info("Backfilling rotated files", zap.String("file", path), zap.Int("rotated_files", len(gens)))
+	return w.readGenerations(ctx, path, gens, 0, 0, fileIdentity{}, source, policy)
+}
+
+// readGenerations ships rotated files in order, the first from offset,
+// skipping copies of a file already read, such as a rotated file caught
+// while being compressed. first is the first file's identity, if known.
+func (w *Watcher) readGenerations(ctx context.Context, path string, gens []generation, offset, lineNumber int64, first fileIdentity, source FileSource, policy string) (int64, error) {
+	read := make(map[string]bool)
+	for i, gen := range gens {
+		id := first
+		if i > 0 {
+			offset = 0
+		}
+		if i > 0 || !id.known() {
+			var err error
+			if id, err = identify(gen.path); err != nil {
+				w.logger.Warn("Skipping unreadable rotated file", zap.String("rotated", gen.path), zap.Error(err))
+				continue
+			}
+		}
+		if read[id.fingerprint] {
+			continue
+		}
+		read[id.fingerprint] = true
+
+		w.logger.Info("Reading rotated file",
+			zap.String("file", path),
+			zap.String("rotated", gen.path),
+			zap.Int64("offset", offset))
+		var err error
+		if lineNumber, err = w.readRotated(ctx, path, gen.path, offset, lineNumber, id, source, policy); err != nil {
+			return lineNumber, err
+		}
+	}
+	return lineNumber, nil
+}
+
+// readRotated ships the lines a rotated file holds past offset, returning
+// the line number reached. Compressed files are read through, with offset
+// counting decompressed bytes. The saved position follows along under the
+// rotated file's identity, so a restart partway carries on from there.
+func (w *Watcher) readRotated(ctx context.Context, path, rotated string, offset, lineNumber int64, id fileIdentity, source FileSource, policy string) (int64, error) {
+	f, err := os.Open(rotated)
+	if err != nil {
+		return lineNumber, fmt.Errorf("failed to open rotated file %s: %w", rotated, err)
+	}
+	defer f.Close()
+	if !compressed(rotated) {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return lineNumber, fmt.Errorf("failed to seek rotated file %s: %w", rotated, err)
+		}
+	}
+	r, err := decompress(rotated, f)
+	if err != nil {
+		return lineNumber, fmt.Errorf("failed to decompress rotated file %s: %w", rotated, err)
+	}
+	defer r.Close()
+	if compressed(rotated) {
+		if _, err := io.CopyN(io.Discard, r, offset); err != nil {
+			return lineNumber, fmt.Errorf("failed to skip to offset in rotated file %s: %w", rotated, err)
+		}
+	}
+
+	var framer *JSONFramer
+	if source.Framing == "json" {
+		framer = NewJSONFramer(maxFramedLines)
+	}
+
+	reader := bufio.NewReader(r)
+	var entryLine int64
+	for {
+		line, readErr := reader.ReadString('\n')
+		if len(line) > 0 {
+			if w.throttle != nil {
+				if err := w.throttle.Wait(ctx); err != nil {
+					return lineNumber, err
+				}
+			}
+			lineNumber++
+			offset += int64(len(line))
+
+			text := strings.TrimRight(line, "\n")
+			if framer != nil {
+				if !framer.Pending() {
+					entryLine = lineNumber
+				}
+				doc, complete := framer.Push(text)
+				if !complete {
+					continue
+				}
+				text = doc
+			} else {
+				entryLine = lineNumber
+			}
+
+			if err := w.ship(ctx, source, policy, path, text, entryLine); err != nil {
+				return lineNumber, err
+			}
+			w.updateState(path, offset, lineNumber, id)
+		}
+		if readErr == io.EOF {
+			return lineNumber, nil
+		}
+		if readErr != nil {
+			return lineNumber, fmt.Errorf("failed to read rotated file %s: %w", rotated, readErr)
+		}
+	}
+}
+
+// ship sends a line from a file as an entry. Lines the source's filter
+// drops still advance the saved position.
+func (w *Watcher) ship(ctx context.Context, source FileSource, policy, path, text string, lineNumber int64) error {
+	if source.Filter != nil && !source.Filter.Allow(text) {
+		return nil
+	}
+	entry := models.LogEntry{
+		ServiceName: source.ServiceName,
+		Hostname:    w.hostname,
+		FilePath:    path,
+		Line:        text,
+		Timestamp:   time.Now(),
+		LineNumber:  lineNumber,
+		Labels:      copyLabels(source.Labels),
+	}
+	return w.send(ctx, entry, policy)
+}
+
+// send passes an entry to the batcher, applying the backpressure policy
+// when the batcher is behind
+func (w *Watcher) send(ctx context.Context, entry models.LogEntry, policy string) error {
+	switch policy {
+	case BackpressureDropOldest:
+		if dropped, ok := w.queue.push(entry); ok {
+			w.recordDrop(dropped.FilePath)
+		}
+		return nil
+
+	case BackpressureBlock:
+		select {
+		case w.lineChan <- entry:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		w.logger.Warn("Batcher is behind, pausing reads", zap.String("file", entry.FilePath))
+		start := time.Now()
+		select {
+		case w.lineChan <- entry:
+			w.logger.Info("Resumed reading",
+				zap.String("file", entry.FilePath),
+				zap.Duration("paused_for", time.Since(start).Round(time.Millisecond)))
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	timer := time.NewTimer(w.timeout)
+	defer timer.Stop()
+	select {
+	case w.lineChan <- entry:
+	case <-timer.C:
+		w.recordDrop(entry.FilePath)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+// recordDrop counts a line dropped under backpressure
+func (w *Watcher) recordDrop(filepath string) {
+	w.droppedMu.Lock()
+	w.dropped[filepath]++
+	w.droppedMu.Unlock()
+}
+
+// reportDrops logs the lines each file dropped since the last report
+func (w *Watcher) reportDrops() {
+	w.droppedMu.Lock()
+	defer w.droppedMu.Unlock()
+	for path, dropped := range w.dropped {
+		if n := dropped - w.reported[path]; n > 0 {
+			w.logger.Warn("Dropped lines while the batcher was behind",
+				zap.String("file", path),
+				zap.Int64("dropped", n),
+				zap.Int64("dropped_total", dropped))
+			w.reported[path] = dropped
+		}
+	}
+}
+
 // updateState updates the in-memory state for a file
-func (w *Watcher) updateState(filepath string, offset int64, lineNumber int64) {
+func (w *Watcher) updateState(filepath string, offset int64, lineNumber int64, id fileIdentity) {
 	w.stateMu.Lock()
 	defer w.stateMu.Unlock()
 
 	w.state[filepath] = &models.FileState{
-		Offset:   offset,
-		Inode:    0, // tail library doesn't expose inode easily
-		LastRead: time.Now(),
+		Offset:          offset,
+		LineNumber:      lineNumber,
+		Inode:           id.inode,
+		Fingerprint:     id.fingerprint,
+		FingerprintSize: id.size,
+		LastRead:        time.Now(),
+	}
+}
+
+// countLines returns the offset just past a file's last complete line and
+// the number of lines before it
+func countLines(path string) (int64, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	var offset, end, lines int64
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := f.Read(buf)
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			lines += int64(bytes.Count(buf[:n], []byte{'\n'}))
+			end = offset + int64(i) + 1
+		}
+		offset += int64(n)
+		if err == io.EOF {
+			return end, lines, nil
+		}
+		if err != nil {
+			return 0, 0, err
+		}
 	}
 }
 
@@ -175,23 +922,25 @@ func (w *Watcher) stateSaver(ctx context.Context) {
 			if err := w.saveState(); err != nil {
 				w.logger.Error("Failed to save state", zap.Error(err))
 			}
+			w.reportDrops()
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
-// saveState saves the current state to disk
+// saveState saves the current state to disk. The file is replaced
+// atomically, keeping the previous generation as <state_file>.bak, so a
+// crash mid-write never leaves it half written.
 func (w *Watcher) saveState() error {
 	w.stateMu.RLock()
-	defer w.stateMu.RUnlock()
-
 	data, err := json.MarshalIndent(w.state, "", "  ")
+	w.stateMu.RUnlock()
 	if err != nil {
 		return fmt.Errorf("failed to marshal state: %w", err)
 	}
 
-	if err := os.WriteFile(w.stateFile, data, 0644); err != nil {
+	if err := writeStateFile(w.stateFile, data); err != nil {
 		return fmt.Errorf("failed to write state file: %w", err)
 	}
 
@@ -199,20 +948,86 @@ func (w *Watcher) saveState() error {
 	return nil
 }
 
-// loadState loads the previous state from disk
-func (w *Watcher) loadState() error {
-	data, err := os.ReadFile(w.stateFile)
+// writeStateFile writes data to a temporary file, syncs it, and renames it
+// into place after moving the current file to path.bak
+func writeStateFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
-		if os.IsNotExist(err) {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(path, path+".bak"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	// Persist the renames; directories can't be synced on Windows
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// loadState loads the previous state from disk. A state file that is
+// missing or corrupt, as after a crash before the atomic save existed or
+// a damaged disk, is set aside as <state_file>.corrupt and the backup
+// generation loaded instead.
+func (w *Watcher) loadState() error {
+	state, err := readStateFile(w.stateFile)
+	if err == nil {
+		w.state = state
+		w.logger.Info("State loaded", zap.String("state_file", w.stateFile), zap.Int("files", len(w.state)))
+		return nil
+	}
+
+	backup := w.stateFile + ".bak"
+	if errors.Is(err, os.ErrNotExist) {
+		if _, statErr := os.Stat(backup); statErr != nil {
 			return nil // No state file yet, not an error
 		}
-		return fmt.Errorf("failed to read state file: %w", err)
+	} else {
+		w.logger.Error("State file is unreadable, trying its backup", zap.String("state_file", w.stateFile), zap.Error(err))
+		os.Rename(w.stateFile, w.stateFile+".corrupt")
 	}
 
-	if err := json.Unmarshal(data, &w.state); err != nil {
-		return fmt.Errorf("failed to unmarshal state: %w", err)
+	state, backupErr := readStateFile(backup)
+	if backupErr != nil {
+		return fmt.Errorf("failed to load state or its backup: %w", errors.Join(err, backupErr))
 	}
-
-	w.logger.Info("State loaded", zap.String("state_file", w.stateFile), zap.Int("files", len(w.state)))
+	w.state = state
+	w.logger.Warn("Recovered state from backup, lines read since it was saved may be sent again",
+		zap.String("state_file", backup),
+		zap.Int("files", len(w.state)))
 	return nil
 }
+
+// readStateFile reads and parses a state file
+func readStateFile(path string) (map[string]*models.FileState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var state map[string]*models.FileState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal state: %w", err)
+	}
+	if state == nil {
+		return nil, fmt.Errorf("state file holds no state")
+	}
+	return state, nil
+}
@@ -0,0 +1,208 @@
+// Package awsauth resolves AWS credentials and signs requests with
+// Signature Version 4, without the AWS SDK
+package awsauth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// containerCredentialsURL serves task role credentials on ECS
+	containerCredentialsURL = "http://169.254.170.2"
+
+	// instanceMetadataURL is the EC2 instance metadata service
+	instanceMetadataURL = "http://169.254.169.254/latest"
+)
+
+// Keys are the credentials used to sign AWS requests
+type Keys struct {
+	AccessKeyID     string    `json:"AccessKeyId"`
+	SecretAccessKey string    `json:"SecretAccessKey"`
+	SessionToken    string    `json:"Token"`
+	Expiration      time.Time `json:"Expiration"` // Zero for static keys
+}
+
+// Credentials resolves AWS credentials the way the AWS CLI does for
+// hosts and containers: environment variables, then ECS task role, then
+// EC2 instance role. Temporary credentials are cached until shortly
+// before they expire.
+type Credentials struct {
+	client *http.Client
+
+	mu     sync.Mutex
+	cached Keys
+}
+
+// NewCredentials creates a new credential resolver
+func NewCredentials() *Credentials {
+	return &Credentials{client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+// Get returns current credentials, refreshing them if they expire soon
+func (c *Credentials) Get(ctx context.Context) (Keys, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cached.AccessKeyID != "" && (c.cached.Expiration.IsZero() || time.Until(c.cached.Expiration) > 5*time.Minute) {
+		return c.cached, nil
+	}
+
+	creds, err := c.resolve(ctx)
+	if err != nil {
+		return Keys{}, err
+	}
+	c.cached = creds
+	return creds, nil
+}
+
+// resolve walks the credential chain
+func (c *Credentials) resolve(ctx context.Context) (Keys, error) {
+	if id, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"); id != "" && secret != "" {
+		return Keys{AccessKeyID: id, SecretAccessKey: secret, SessionToken: os.Getenv("AWS_SESSION_TOKEN")}, nil
+	}
+
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+		return c.fetch(ctx, containerCredentialsURL+uri, nil)
+	}
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI"); uri != "" {
+		var headers map[string]string
+		if token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"); token != "" {
+			headers = map[string]string{"Authorization": token}
+		}
+		return c.fetch(ctx, uri, headers)
+	}
+
+	// EC2 instance role via IMDSv2
+	token, err := metadataRequest(ctx, c.client, http.MethodPut, instanceMetadataURL+"/api/token",
+		map[string]string{"X-aws-ec2-metadata-token-ttl-seconds": "300"})
+	if err != nil {
+		return Keys{}, fmt.Errorf("no AWS credentials in the environment, container, or instance metadata: %w", err)
+	}
+	headers := map[string]string{"X-aws-ec2-metadata-token": token}
+	roles, err := metadataRequest(ctx, c.client, http.MethodGet, instanceMetadataURL+"/meta-data/iam/security-credentials/", headers)
+	if err != nil {
+		return Keys{}, fmt.Errorf("no instance role: %w", err)
+	}
+	role, _, _ := strings.Cut(roles, "\n")
+	return c.fetch(ctx, instanceMetadataURL+"/meta-data/iam/security-credentials/"+role, headers)
+}
+
+// fetch reads credentials from a container or instance metadata endpoint
+func (c *Credentials) fetch(ctx context.Context, url string, headers map[string]string) (Keys, error) {
+	body, err := metadataRequest(ctx, c.client, http.MethodGet, url, headers)
+	if err != nil {
+		return Keys{}, err
+	}
+	var creds Keys
+	if err := json.Unmarshal([]byte(body), &creds); err != nil {
+		return Keys{}, fmt.Errorf("invalid AWS credentials response: %w", err)
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return Keys{}, fmt.Errorf("AWS credentials response from %s has no keys", url)
+	}
+	return creds, nil
+}
+
+// Sign signs a request with AWS Signature Version 4. The host, content
+// type, and x-amz-* headers are signed.
+func Sign(req *http.Request, body []byte, creds Keys, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	// Canonical headers, sorted by lowercase name
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	bodyHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data under key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// metadataRequest performs a metadata service request and returns the body
+func metadataRequest(ctx context.Context, client *http.Client, method, url string, headers map[string]string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create metadata request: %w", err)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to query instance metadata: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return "", fmt.Errorf("failed to read instance metadata: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("instance metadata %s returned status %d", url, resp.StatusCode)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
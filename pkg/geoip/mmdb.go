@@ -0,0 +1,335 @@
+// Package geoip reads MaxMind DB (.mmdb) files such as GeoLite2-City and
+// GeoLite2-ASN.
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"os"
+)
+
+// metadataMarker precedes the metadata map at the end of the file
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// dataSectionSeparator is the gap between the search tree and data section
+const dataSectionSeparator = 16
+
+// maxPointerDepth bounds pointer chains in malformed files
+const maxPointerDepth = 32
+
+// Reader looks up IP addresses in a MaxMind DB
+type Reader struct {
+	tree         []byte
+	data         []byte
+	nodeCount    uint
+	recordSize   uint
+	ipVersion    uint
+	ipv4Start    uint
+	DatabaseType string
+}
+
+// Open reads a MaxMind DB file into memory
+func Open(path string) (*Reader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return FromBytes(buf)
+}
+
+// FromBytes parses a MaxMind DB held in memory
+func FromBytes(buf []byte) (*Reader, error) {
+	idx := bytes.LastIndex(buf, metadataMarker)
+	if idx < 0 {
+		return nil, fmt.Errorf("not a MaxMind DB: metadata marker not found")
+	}
+
+	metaBuf := buf[idx+len(metadataMarker):]
+	raw, _, err := decode(metaBuf, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metadata: %w", err)
+	}
+	meta, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid metadata: not a map")
+	}
+
+	r := &Reader{
+		nodeCount:  metaUint(meta, "node_count"),
+		recordSize: metaUint(meta, "record_size"),
+		ipVersion:  metaUint(meta, "ip_version"),
+	}
+	r.DatabaseType, _ = meta["database_type"].(string)
+
+	switch r.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("unsupported record size %d", r.recordSize)
+	}
+
+	// Checked before multiplying, so a huge node count can't overflow
+	if r.nodeCount > uint(idx)/(r.recordSize/4) {
+		return nil, fmt.Errorf("invalid search tree size")
+	}
+	treeSize := r.nodeCount * r.recordSize / 4
+	if treeSize+dataSectionSeparator > uint(idx) {
+		return nil, fmt.Errorf("invalid search tree size")
+	}
+	r.tree = buf[:treeSize]
+	r.data = buf[treeSize+dataSectionSeparator : idx]
+
+	// IPv4 addresses live under ::/96 in IPv6 databases
+	if r.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < r.nodeCount; i++ {
+			node = r.record(node, 0)
+		}
+		r.ipv4Start = node
+	}
+
+	return r, nil
+}
+
+// Lookup returns the record for an IP, or nil if the IP is not in the database
+func (r *Reader) Lookup(ip net.IP) (map[string]interface{}, error) {
+	node := uint(0)
+	bits := 128
+
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		bits = 32
+		if r.ipVersion == 6 {
+			node = r.ipv4Start
+		}
+	} else if r.ipVersion == 4 {
+		return nil, fmt.Errorf("IPv6 lookup in an IPv4-only database")
+	} else {
+		ip = ip.To16()
+	}
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address")
+	}
+
+	for i := 0; i < bits && node < r.nodeCount; i++ {
+		bit := uint(ip[i/8]>>(7-uint(i%8))) & 1
+		node = r.record(node, bit)
+	}
+
+	if node == r.nodeCount {
+		return nil, nil
+	}
+	if node < r.nodeCount {
+		return nil, fmt.Errorf("invalid search tree")
+	}
+
+	offset := node - r.nodeCount - dataSectionSeparator
+	value, _, err := decode(r.data, offset, 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid record: %w", err)
+	}
+	record, _ := value.(map[string]interface{})
+	return record, nil
+}
+
+// record returns the left (bit 0) or right (bit 1) record of a node
+func (r *Reader) record(node, bit uint) uint {
+	b := r.tree[node*r.recordSize/4:]
+	switch r.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// Data section field types
+const (
+	typeExtended = 0
+	typePointer  = 1
+	typeString   = 2
+	typeDouble   = 3
+	typeBytes    = 4
+	typeUint16   = 5
+	typeUint32   = 6
+	typeMap      = 7
+	typeInt32    = 8
+	typeUint64   = 9
+	typeUint128  = 10
+	typeArray    = 11
+	typeBool     = 14
+	typeFloat    = 15
+)
+
+// decode decodes the value at offset, returning it and the offset just past it.
+// Pointers resolve relative to the start of buf.
+func decode(buf []byte, offset uint, depth int) (interface{}, uint, error) {
+	if offset >= uint(len(buf)) {
+		return nil, 0, fmt.Errorf("offset %d out of range", offset)
+	}
+
+	ctrl := buf[offset]
+	offset++
+	kind := int(ctrl >> 5)
+
+	if kind == typePointer {
+		if depth > maxPointerDepth {
+			return nil, 0, fmt.Errorf("pointer chain too deep")
+		}
+		target, next, err := pointer(buf, ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := decode(buf, target, depth+1)
+		return value, next, err
+	}
+
+	if kind == typeExtended {
+		if offset >= uint(len(buf)) {
+			return nil, 0, fmt.Errorf("truncated extended type")
+		}
+		kind = 7 + int(buf[offset])
+		offset++
+	}
+
+	size := uint(ctrl & 0x1F)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > uint(len(buf)) {
+			return nil, 0, fmt.Errorf("truncated size")
+		}
+		extra := uint(0)
+		for _, b := range buf[offset : offset+n] {
+			extra = extra<<8 | uint(b)
+		}
+		offset += n
+		switch n {
+		case 1:
+			size = 29 + extra
+		case 2:
+			size = 285 + extra
+		default:
+			size = 65821 + extra
+		}
+	}
+
+	// Every map entry and array element takes at least a byte, so larger
+	// sizes are corrupt and would allocate too much
+	if (kind == typeMap || kind == typeArray) && size > uint(len(buf))-offset {
+		return nil, 0, fmt.Errorf("truncated container")
+	}
+
+	switch kind {
+	case typeMap:
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := decode(buf, offset, depth)
+			if err != nil {
+				return nil, 0, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("map key is not a string")
+			}
+			value, next, err := decode(buf, next, depth)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[k] = value
+			offset = next
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			value, next, err := decode(buf, offset, depth)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+			offset = next
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > uint(len(buf)) {
+		return nil, 0, fmt.Errorf("truncated value")
+	}
+	b := buf[offset : offset+size]
+	next := offset + size
+
+	switch kind {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes:
+		return append([]byte(nil), b...), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("invalid double size %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("invalid float size %d", size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), next, nil
+	case typeUint16, typeUint32, typeUint64:
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, next, nil
+	case typeInt32:
+		var v uint32
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		return int64(int32(v)), next, nil
+	case typeUint128:
+		return new(big.Int).SetBytes(b), next, nil
+	default:
+		// Data cache containers and end markers never appear in records
+		return nil, 0, fmt.Errorf("unsupported data type %d", kind)
+	}
+}
+
+// pointer decodes a pointer's target, returning it and the offset past the pointer
+func pointer(buf []byte, ctrl byte, offset uint) (uint, uint, error) {
+	n := uint((ctrl>>3)&0x3) + 1
+	if offset+n > uint(len(buf)) {
+		return 0, 0, fmt.Errorf("truncated pointer")
+	}
+
+	var v uint
+	if n < 4 {
+		v = uint(ctrl & 0x7)
+	}
+	for _, b := range buf[offset : offset+n] {
+		v = v<<8 | uint(b)
+	}
+
+	switch n {
+	case 2:
+		v += 2048
+	case 3:
+		v += 526336
+	}
+	return v, offset + n, nil
+}
+
+// metaUint reads an unsigned metadata field
+func metaUint(meta map[string]interface{}, key string) uint {
+	v, _ := meta[key].(uint64)
+	return uint(v)
+}
@@ -0,0 +1,429 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the testdata databases")
+
+// fixture names the test database built with a record size
+func fixture(recordSize uint) string {
+	return filepath.Join("testdata", fmt.Sprintf("test-%d.mmdb", recordSize))
+}
+
+var recordSizes = []uint{24, 28, 32}
+
+func TestFixtures(t *testing.T) {
+	for _, size := range recordSizes {
+		built := buildTestDB(size)
+		if *update {
+			if err := os.WriteFile(fixture(size), built, 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		stored, err := os.ReadFile(fixture(size))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(stored, built) {
+			t.Errorf("%s is out of date; run go test ./pkg/geoip -run TestFixtures -update", fixture(size))
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	testville := map[string]interface{}{
+		"city":                     map[string]interface{}{"names": map[string]interface{}{"en": "Testville"}},
+		"country":                  map[string]interface{}{"iso_code": "TV"},
+		"location":                 map[string]interface{}{"latitude": 1.5, "longitude": -2.25},
+		"autonomous_system_number": uint64(64500),
+	}
+	docnet := map[string]interface{}{
+		"country": map[string]interface{}{"iso_code": "TV"},
+		"anycast": true,
+	}
+
+	tests := []struct {
+		ip   string
+		want map[string]interface{}
+	}{
+		{ip: "1.2.3.4", want: testville},
+		{ip: "1.2.3.255", want: testville},
+		{ip: "1.2.4.1"},
+		{ip: "9.9.9.9"},
+		{ip: "2001:db8::1", want: docnet},
+		{ip: "2001:db8:ffff::1", want: docnet},
+		{ip: "2001:db9::1"},
+		{ip: "::ffff:1.2.3.4", want: testville},
+	}
+	for _, size := range recordSizes {
+		t.Run(fmt.Sprintf("record size %d", size), func(t *testing.T) {
+			r, err := Open(fixture(size))
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			if r.DatabaseType != "Logl-Test" {
+				t.Errorf("DatabaseType = %q", r.DatabaseType)
+			}
+			for _, tt := range tests {
+				got, err := r.Lookup(net.ParseIP(tt.ip))
+				if err != nil {
+					t.Errorf("Lookup(%s) error: %v", tt.ip, err)
+					continue
+				}
+				if tt.want == nil && got != nil || tt.want != nil && !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Lookup(%s) = %v, want %v", tt.ip, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLookupIPv4Database(t *testing.T) {
+	r, err := FromBytes(buildDB(24, 4, []network{{ip: net.ParseIP("10.0.0.0").To4(), bits: 8, data: 0}}, mmdbString("ten")))
+	if err != nil {
+		t.Fatalf("FromBytes: %v", err)
+	}
+	if _, err := r.Lookup(net.ParseIP("2001:db8::1")); err == nil {
+		t.Error("IPv6 lookup in an IPv4 database succeeded")
+	}
+	// Records that aren't maps are found but have no fields
+	if got, err := r.Lookup(net.ParseIP("10.1.2.3")); err != nil || got != nil {
+		t.Errorf("Lookup(10.1.2.3) = %v, %v", got, err)
+	}
+}
+
+func TestOpenMissing(t *testing.T) {
+	if _, err := Open(filepath.Join(t.TempDir(), "missing.mmdb")); err == nil {
+		t.Error("Open of a missing file succeeded")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		buf     []byte
+		want    interface{}
+		wantErr bool
+	}{
+		{name: "string", buf: mmdbString("hi"), want: "hi"},
+		{name: "empty string", buf: mmdbString(""), want: ""},
+		{name: "long string", buf: mmdbString(string(bytes.Repeat([]byte{'a'}, 300))), want: string(bytes.Repeat([]byte{'a'}, 300))},
+		{name: "double", buf: mmdbDouble(-2.25), want: -2.25},
+		{name: "float", buf: append([]byte{0x04, 0x08}, 0x3f, 0xc0, 0x00, 0x00), want: 1.5},
+		{name: "bytes", buf: []byte{0x82, 0xde, 0xad}, want: []byte{0xde, 0xad}},
+		{name: "uint16", buf: []byte{0xa2, 0x01, 0x00}, want: uint64(256)},
+		{name: "uint32", buf: mmdbUint32(64500), want: uint64(64500)},
+		{name: "uint64", buf: []byte{0x08, 0x02, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, want: uint64(math.MaxUint64)},
+		{name: "uint128", buf: append([]byte{0x10, 0x03}, bytes.Repeat([]byte{0xff}, 16)...), want: new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 128), big.NewInt(1))},
+		{name: "int32", buf: []byte{0x04, 0x01, 0xff, 0xff, 0xff, 0xfe}, want: int64(-2)},
+		{name: "bool", buf: mmdbBool(true), want: true},
+		{name: "array", buf: append(append([]byte{0x02, 0x04}, mmdbString("a")...), mmdbBool(false)...), want: []interface{}{"a", false}},
+		{name: "map", buf: mmdbMap("k", mmdbString("v")), want: map[string]interface{}{"k": "v"}},
+		{name: "pointer", buf: append(mmdbPointer(2), mmdbString("ab")...), want: "ab"},
+		{name: "empty", buf: nil, wantErr: true},
+		{name: "truncated string", buf: []byte{0x45, 'a', 'b'}, wantErr: true},
+		{name: "truncated size", buf: []byte{0x5e, 0x01}, wantErr: true},
+		{name: "truncated extended type", buf: []byte{0x01}, wantErr: true},
+		{name: "truncated pointer", buf: []byte{0x28, 0x00}, wantErr: true},
+		{name: "pointer out of range", buf: mmdbPointer(100), wantErr: true},
+		{name: "pointer loop", buf: mmdbPointer(0), wantErr: true},
+		{name: "map key not a string", buf: append([]byte{0xe1}, append(mmdbUint32(1), mmdbString("v")...)...), wantErr: true},
+		{name: "map larger than its buffer", buf: []byte{0xff, 0xff, 0xff, 0xff}, wantErr: true},
+		{name: "array larger than its buffer", buf: []byte{0x1f, 0x04, 0xff, 0xff, 0xff}, wantErr: true},
+		{name: "bad double size", buf: []byte{0x64, 0x00, 0x00, 0x00, 0x00}, wantErr: true},
+		{name: "data cache container", buf: []byte{0x00, 0x05}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := decode(tt.buf, 0, 0)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("decode() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decode() error: %v", err)
+			}
+			if want, ok := tt.want.(*big.Int); ok {
+				if got, ok := got.(*big.Int); !ok || got.Cmp(want) != 0 {
+					t.Errorf("decode() = %v, want %v", got, tt.want)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decode() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCorrupt(t *testing.T) {
+	db, err := os.ReadFile(fixture(28))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ips := []net.IP{net.ParseIP("1.2.3.4"), net.ParseIP("2001:db8::1"), net.ParseIP("9.9.9.9")}
+
+	// lookupAll must not panic, whatever the file holds
+	lookupAll := func(buf []byte) {
+		r, err := FromBytes(buf)
+		if err != nil {
+			return
+		}
+		for _, ip := range ips {
+			r.Lookup(ip)
+		}
+	}
+
+	t.Run("truncated", func(t *testing.T) {
+		marker := bytes.LastIndex(db, metadataMarker)
+		for n := 0; n < len(db); n++ {
+			buf := db[:n]
+			if _, err := FromBytes(buf); err == nil && n < marker+len(metadataMarker) {
+				t.Errorf("FromBytes of the first %d bytes succeeded", n)
+			}
+			lookupAll(buf)
+		}
+	})
+
+	t.Run("flipped bytes", func(t *testing.T) {
+		for i := range db {
+			for _, mask := range []byte{0x01, 0x80, 0xff} {
+				buf := append([]byte(nil), db...)
+				buf[i] ^= mask
+				lookupAll(buf)
+			}
+		}
+	})
+
+	t.Run("bad metadata", func(t *testing.T) {
+		tests := map[string][]byte{
+			"no marker":           db[:bytes.LastIndex(db, metadataMarker)],
+			"not a map":           append(append([]byte{}, metadataMarker...), mmdbString("x")...),
+			"record size":         withMetadata(db, "record_size", []byte{0xa1, 0x10}),
+			"node count overflow": withMetadata(db, "node_count", []byte{0x08, 0x02, 0x40, 0, 0, 0, 0, 0, 0, 0}),
+			"tree past the data":  withMetadata(db, "node_count", mmdbUint32(1<<20)),
+		}
+		for name, buf := range tests {
+			if _, err := FromBytes(buf); err == nil {
+				t.Errorf("%s: FromBytes succeeded", name)
+			}
+		}
+	})
+}
+
+// withMetadata returns db with one metadata field replaced
+func withMetadata(db []byte, key string, value []byte) []byte {
+	idx := bytes.LastIndex(db, metadataMarker)
+	raw, _, _ := decode(db[idx+len(metadataMarker):], 0, 0)
+	meta := raw.(map[string]interface{})
+
+	out := append([]byte(nil), db[:idx+len(metadataMarker)]...)
+	out = append(out, 0xe0|byte(len(meta)))
+	for k := range meta {
+		out = append(out, mmdbString(k)...)
+		if k == key {
+			out = append(out, value...)
+			continue
+		}
+		out = append(out, mmdbMetaValue(meta[k])...)
+	}
+	return out
+}
+
+// mmdbMetaValue re-encodes the metadata values buildDB writes
+func mmdbMetaValue(v interface{}) []byte {
+	switch v := v.(type) {
+	case string:
+		return mmdbString(v)
+	case uint64:
+		return mmdbUint32(uint32(v))
+	case []interface{}:
+		out := []byte{byte(len(v)), 0x04}
+		for _, e := range v {
+			out = append(out, mmdbMetaValue(e)...)
+		}
+		return out
+	}
+	panic(fmt.Sprintf("unexpected metadata value %T", v))
+}
+
+// The test database maps 1.2.3.0/24 and 2001:db8::/32 to records that
+// share their country through a pointer
+
+func buildTestDB(recordSize uint) []byte {
+	country := mmdbMap("iso_code", mmdbString("TV"))
+	testville := mmdbMap(
+		"city", mmdbMap("names", mmdbMap("en", mmdbString("Testville"))),
+		"country", country,
+		"location", mmdbMap("latitude", mmdbDouble(1.5), "longitude", mmdbDouble(-2.25)),
+		"autonomous_system_number", mmdbUint32(64500),
+	)
+	// The country map is the first value in testville's "country" entry;
+	// find it to point at it from the second record
+	countryAt := bytes.Index(testville, country)
+	docnet := mmdbMap("country", mmdbPointer(uint(countryAt)), "anycast", mmdbBool(true))
+
+	data := append(append([]byte(nil), testville...), docnet...)
+	return buildDB(recordSize, 6, []network{
+		{ip: net.ParseIP("::1.2.3.0"), bits: 96 + 24, data: 0},
+		{ip: net.ParseIP("2001:db8::"), bits: 32, data: uint(len(testville))},
+	}, data)
+}
+
+// network maps a prefix to a record at an offset in the data section
+type network struct {
+	ip   net.IP
+	bits int
+	data uint
+}
+
+// treeNode is a node of the search tree being built
+type treeNode struct {
+	children [2]*treeNode
+	data     [2]*uint
+}
+
+// buildDB writes a MaxMind DB holding networks, whose records are at
+// offsets in data
+func buildDB(recordSize, ipVersion uint, networks []network, data []byte) []byte {
+	root := &treeNode{}
+	for _, n := range networks {
+		ip := n.ip.To16()
+		if ipVersion == 4 {
+			ip = n.ip.To4()
+		}
+		node := root
+		for i := 0; i < n.bits; i++ {
+			bit := ip[i/8] >> (7 - uint(i%8)) & 1
+			if i == n.bits-1 {
+				offset := n.data
+				node.data[bit] = &offset
+				break
+			}
+			if node.children[bit] == nil {
+				node.children[bit] = &treeNode{}
+			}
+			node = node.children[bit]
+		}
+	}
+
+	// Number nodes breadth first
+	nodes := []*treeNode{root}
+	index := map[*treeNode]uint{root: 0}
+	for i := 0; i < len(nodes); i++ {
+		for _, child := range nodes[i].children {
+			if child != nil {
+				index[child] = uint(len(nodes))
+				nodes = append(nodes, child)
+			}
+		}
+	}
+	nodeCount := uint(len(nodes))
+
+	var tree []byte
+	for _, node := range nodes {
+		var records [2]uint
+		for bit := range records {
+			switch {
+			case node.children[bit] != nil:
+				records[bit] = index[node.children[bit]]
+			case node.data[bit] != nil:
+				records[bit] = nodeCount + dataSectionSeparator + *node.data[bit]
+			default:
+				records[bit] = nodeCount
+			}
+		}
+		left, right := records[0], records[1]
+		switch recordSize {
+		case 24:
+			tree = append(tree, byte(left>>16), byte(left>>8), byte(left), byte(right>>16), byte(right>>8), byte(right))
+		case 28:
+			tree = append(tree, byte(left>>16), byte(left>>8), byte(left), byte(left>>20&0xf0|right>>24&0x0f), byte(right>>16), byte(right>>8), byte(right))
+		case 32:
+			tree = binary.BigEndian.AppendUint32(tree, uint32(left))
+			tree = binary.BigEndian.AppendUint32(tree, uint32(right))
+		}
+	}
+
+	out := append(tree, make([]byte, dataSectionSeparator)...)
+	out = append(out, data...)
+	out = append(out, metadataMarker...)
+	return append(out, mmdbMap(
+		"binary_format_major_version", mmdbUint32(2),
+		"database_type", mmdbString("Logl-Test"),
+		"ip_version", mmdbUint32(uint32(ipVersion)),
+		"languages", append([]byte{0x01, 0x04}, mmdbString("en")...),
+		"node_count", mmdbUint32(uint32(nodeCount)),
+		"record_size", mmdbUint32(uint32(recordSize)),
+	)...)
+}
+
+// mmdbControl encodes a type and size
+func mmdbControl(kind int, size uint) []byte {
+	var ctrl []byte
+	switch {
+	case size < 29:
+		ctrl = []byte{byte(size)}
+	case size < 285:
+		ctrl = []byte{29, byte(size - 29)}
+	default:
+		ctrl = []byte{30, byte((size - 285) >> 8), byte(size - 285)}
+	}
+	if kind <= 7 {
+		ctrl[0] |= byte(kind) << 5
+		return ctrl
+	}
+	return append([]byte{ctrl[0]}, append([]byte{byte(kind - 7)}, ctrl[1:]...)...)
+}
+
+func mmdbString(s string) []byte {
+	return append(mmdbControl(typeString, uint(len(s))), s...)
+}
+
+func mmdbDouble(f float64) []byte {
+	return binary.BigEndian.AppendUint64(mmdbControl(typeDouble, 8), math.Float64bits(f))
+}
+
+func mmdbUint32(n uint32) []byte {
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	return append(mmdbControl(typeUint32, uint(len(b))), b...)
+}
+
+func mmdbBool(v bool) []byte {
+	if v {
+		return mmdbControl(typeBool, 1)
+	}
+	return mmdbControl(typeBool, 0)
+}
+
+// mmdbPointer encodes a pointer below 2048
+func mmdbPointer(offset uint) []byte {
+	return []byte{byte(typePointer<<5) | byte(offset>>8&0x7), byte(offset)}
+}
+
+// mmdbMap encodes a map from alternating keys and encoded values
+func mmdbMap(pairs ...interface{}) []byte {
+	out := mmdbControl(typeMap, uint(len(pairs)/2))
+	for i := 0; i < len(pairs); i += 2 {
+		out = append(out, mmdbString(pairs[i].(string))...)
+		out = append(out, pairs[i+1].([]byte)...)
+	}
+	return out
+}
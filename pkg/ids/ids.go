@@ -0,0 +1,139 @@
+package ids
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Generator produces unique, time-ordered entry IDs
+type Generator interface {
+	New() string
+}
+
+// NewGenerator returns the generator for a format: "ulid" or "uuidv7"
+func NewGenerator(format string) (Generator, error) {
+	switch format {
+	case "ulid":
+		return &ULID{}, nil
+	case "uuidv7":
+		return &UUIDv7{}, nil
+	default:
+		return nil, fmt.Errorf("unknown ID format %q, must be ulid or uuidv7", format)
+	}
+}
+
+// crockford is the ULID base32 alphabet
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULID generates 26-character ULIDs: a 48-bit millisecond timestamp and
+// 80 random bits. IDs generated in the same millisecond increment the
+// random part, so they sort in generation order.
+type ULID struct {
+	mu      sync.Mutex
+	lastMS  uint64
+	entropy [10]byte
+}
+
+// New returns the next ULID
+func (g *ULID) New() string {
+	g.mu.Lock()
+	if ms := uint64(time.Now().UnixMilli()); ms > g.lastMS {
+		g.lastMS = ms
+		rand.Read(g.entropy[:])
+	} else if !increment(g.entropy[:]) {
+		// The random part overflowed within one millisecond; borrow the next
+		g.lastMS++
+		rand.Read(g.entropy[:])
+	}
+	ms := g.lastMS
+
+	var id [16]byte
+	id[0] = byte(ms >> 40)
+	id[1] = byte(ms >> 32)
+	binary.BigEndian.PutUint32(id[2:], uint32(ms))
+	copy(id[6:], g.entropy[:])
+	g.mu.Unlock()
+
+	return encodeCrockford(id)
+}
+
+// encodeCrockford encodes 128 bits as 26 base32 characters, most
+// significant first (the leading character holds only 3 bits)
+func encodeCrockford(id [16]byte) string {
+	hi := binary.BigEndian.Uint64(id[:8])
+	lo := binary.BigEndian.Uint64(id[8:])
+
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// UUIDv7 generates RFC 9562 version 7 UUIDs: a 48-bit millisecond
+// timestamp followed by random bits, in the canonical hyphenated form.
+// The 12 bits after the version count IDs within a millisecond so they
+// sort in generation order.
+type UUIDv7 struct {
+	mu     sync.Mutex
+	lastMS uint64
+	seq    uint16
+}
+
+// New returns the next UUIDv7
+func (g *UUIDv7) New() string {
+	g.mu.Lock()
+	ms := uint64(time.Now().UnixMilli())
+	if ms > g.lastMS {
+		g.lastMS = ms
+		var b [2]byte
+		rand.Read(b[:])
+		g.seq = binary.BigEndian.Uint16(b[:]) & 0x07ff // Leave headroom to count up
+	} else {
+		g.seq++
+		if g.seq > 0x0fff {
+			g.lastMS++
+			g.seq = 0
+		}
+		ms = g.lastMS
+	}
+	seq := g.seq
+	g.mu.Unlock()
+
+	var id [16]byte
+	rand.Read(id[8:])
+	id[0] = byte(ms >> 40)
+	id[1] = byte(ms >> 32)
+	binary.BigEndian.PutUint32(id[2:], uint32(ms))
+	binary.BigEndian.PutUint16(id[6:], 0x7000|seq)
+	id[8] = id[8]&0x3f | 0x80 // RFC 9562 variant
+
+	var out [36]byte
+	hex.Encode(out[0:8], id[0:4])
+	out[8] = '-'
+	hex.Encode(out[9:13], id[4:6])
+	out[13] = '-'
+	hex.Encode(out[14:18], id[6:8])
+	out[18] = '-'
+	hex.Encode(out[19:23], id[8:10])
+	out[23] = '-'
+	hex.Encode(out[24:], id[10:])
+	return string(out[:])
+}
+
+// increment adds one to a big-endian number, reporting false on overflow
+func increment(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,201 @@
+package ids
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var formats = []string{"ulid", "uuidv7"}
+
+func newTestGenerator(t *testing.T, format string) Generator {
+	t.Helper()
+	g, err := NewGenerator(format)
+	if err != nil {
+		t.Fatalf("NewGenerator(%q): %v", format, err)
+	}
+	return g
+}
+
+func TestNewGeneratorUnknown(t *testing.T) {
+	if _, err := NewGenerator("uuidv4"); err == nil {
+		t.Error("NewGenerator(uuidv4) succeeded")
+	}
+}
+
+func TestMonotonic(t *testing.T) {
+	for _, format := range formats {
+		t.Run(format, func(t *testing.T) {
+			g := newTestGenerator(t, format)
+			prev := g.New()
+			for i := 0; i < 100000; i++ {
+				id := g.New()
+				if id <= prev {
+					t.Fatalf("ID %d %s doesn't sort after %s", i, id, prev)
+				}
+				prev = id
+			}
+		})
+	}
+}
+
+func TestUniqueConcurrent(t *testing.T) {
+	const goroutines, perGoroutine = 8, 20000
+	for _, format := range formats {
+		t.Run(format, func(t *testing.T) {
+			g := newTestGenerator(t, format)
+			results := make([][]string, goroutines)
+			var wg sync.WaitGroup
+			for i := range results {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					ids := make([]string, perGoroutine)
+					for j := range ids {
+						ids[j] = g.New()
+					}
+					results[i] = ids
+				}(i)
+			}
+			wg.Wait()
+
+			seen := make(map[string]bool, goroutines*perGoroutine)
+			for _, ids := range results {
+				for j, id := range ids {
+					if seen[id] {
+						t.Fatalf("duplicate ID %s", id)
+					}
+					seen[id] = true
+					// Each goroutine sees its own IDs in order
+					if j > 0 && id <= ids[j-1] {
+						t.Fatalf("ID %s doesn't sort after %s", id, ids[j-1])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestULIDFormat(t *testing.T) {
+	before := uint64(time.Now().UnixMilli())
+	id := (&ULID{}).New()
+	after := uint64(time.Now().UnixMilli())
+
+	if len(id) != 26 || id[0] > '7' {
+		t.Fatalf("ULID %q is not 26 characters starting at most 7", id)
+	}
+	var ms uint64
+	for _, c := range id[:10] {
+		i := strings.IndexRune(crockford, c)
+		if i < 0 {
+			t.Fatalf("ULID %q has character %q outside the alphabet", id, c)
+		}
+		ms = ms<<5 | uint64(i)
+	}
+	if ms < before || ms > after {
+		t.Errorf("ULID timestamp %d outside [%d, %d]", ms, before, after)
+	}
+	for _, c := range id[10:] {
+		if !strings.ContainsRune(crockford, c) {
+			t.Fatalf("ULID %q has character %q outside the alphabet", id, c)
+		}
+	}
+}
+
+func TestUUIDv7Format(t *testing.T) {
+	before := uint64(time.Now().UnixMilli())
+	id := (&UUIDv7{}).New()
+	after := uint64(time.Now().UnixMilli())
+
+	parts := strings.Split(id, "-")
+	if len(parts) != 5 || len(parts[0]) != 8 || len(parts[1]) != 4 || len(parts[2]) != 4 || len(parts[3]) != 4 || len(parts[4]) != 12 {
+		t.Fatalf("UUID %q is not in the canonical form", id)
+	}
+	b, err := hex.DecodeString(strings.Join(parts, ""))
+	if err != nil {
+		t.Fatalf("UUID %q is not hex: %v", id, err)
+	}
+	if b[6]>>4 != 7 {
+		t.Errorf("UUID %q has version %d, want 7", id, b[6]>>4)
+	}
+	if b[8]>>6 != 2 {
+		t.Errorf("UUID %q has variant bits %b, want 10", id, b[8]>>6)
+	}
+	var ms uint64
+	for _, c := range b[:6] {
+		ms = ms<<8 | uint64(c)
+	}
+	if ms < before || ms > after {
+		t.Errorf("UUID timestamp %d outside [%d, %d]", ms, before, after)
+	}
+}
+
+func TestULIDOverflow(t *testing.T) {
+	// A clock behind the last ID, with the random part about to overflow
+	future := uint64(time.Now().Add(time.Hour).UnixMilli())
+	g := &ULID{lastMS: future}
+	for i := range g.entropy {
+		g.entropy[i] = 0xff
+	}
+	g.entropy[9] = 0xfe
+
+	first := g.New()
+	second := g.New()
+	if second <= first {
+		t.Errorf("ID %s after overflow doesn't sort after %s", second, first)
+	}
+	if g.lastMS != future+1 {
+		t.Errorf("lastMS = %d, want the next millisecond %d", g.lastMS, future+1)
+	}
+}
+
+func TestUUIDv7Overflow(t *testing.T) {
+	future := uint64(time.Now().Add(time.Hour).UnixMilli())
+	g := &UUIDv7{lastMS: future, seq: 0x0ffe}
+
+	first := g.New()
+	second := g.New()
+	if second <= first {
+		t.Errorf("ID %s after overflow doesn't sort after %s", second, first)
+	}
+	if g.lastMS != future+1 || g.seq != 0 {
+		t.Errorf("lastMS, seq = %d, %d, want %d, 0", g.lastMS, g.seq, future+1)
+	}
+}
+
+func TestEncodeCrockford(t *testing.T) {
+	tests := []struct {
+		id   [16]byte
+		want string
+	}{
+		{want: "00000000000000000000000000"},
+		{id: [16]byte{15: 1}, want: "00000000000000000000000001"},
+		{id: [16]byte{15: 32}, want: "00000000000000000000000010"},
+		{id: [16]byte(bytes.Repeat([]byte{0xff}, 16)), want: "7ZZZZZZZZZZZZZZZZZZZZZZZZZ"},
+	}
+	for _, tt := range tests {
+		if got := encodeCrockford(tt.id); got != tt.want {
+			t.Errorf("encodeCrockford(%x) = %s, want %s", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestIncrement(t *testing.T) {
+	tests := []struct {
+		in, want []byte
+		ok       bool
+	}{
+		{in: []byte{0x00, 0x00}, want: []byte{0x00, 0x01}, ok: true},
+		{in: []byte{0x00, 0xff}, want: []byte{0x01, 0x00}, ok: true},
+		{in: []byte{0xff, 0xff}, want: []byte{0x00, 0x00}, ok: false},
+	}
+	for _, tt := range tests {
+		b := append([]byte(nil), tt.in...)
+		if ok := increment(b); ok != tt.ok || !bytes.Equal(b, tt.want) {
+			t.Errorf("increment(%x) = %x, %v, want %x, %v", tt.in, b, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+// Package logstore defines the contract a log storage backend provides to
+// the server. MongoDB is the built-in backend; other backends can check
+// that they meet the contract with storagetest.RunConformance.
+package logstore
+
+import (
+	"context"
+
+	"github.com/oicur0t/logl/pkg/models"
+)
+
+// Backend stores log entries per service and queries them
+type Backend interface {
+	// InsertBatch stores a batch's entries under its service. Entries with
+	// an entry_id already stored for the service are skipped without an
+	// error, so retried batches are stored once. An error means the batch
+	// may be retried as a whole.
+	InsertBatch(ctx context.Context, batch models.LogBatch) error
+
+	// Query returns a service's entries matching the query, newest first
+	// and at most Limit of them. From is inclusive and To exclusive; zero
+	// times leave the range open. Labels must all match exactly, and
+	// Contains matches a literal substring of the line.
+	Query(ctx context.Context, q models.LogQuery) ([]models.LogEntry, error)
+
+	// SetRetention sets how many days a service's entries are kept, 0
+	// keeping them forever. Expiry may happen in the background, but
+	// entries newer than the retention must never be removed.
+	SetRetention(ctx context.Context, service string, ttlDays int) error
+
+	// Retention returns the days a service's entries are kept, 0 for
+	// forever
+	Retention(ctx context.Context, service string) (int, error)
+}
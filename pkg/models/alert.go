@@ -0,0 +1,115 @@
+package models
+
+import "time"
+
+// Alert is an alerting rule firing, or resolved, for one service. It is
+// the body sent to webhook channels and listed at /v1/admin/alerts.
+type Alert struct {
+	Rule        string     `json:"rule"`
+	Service     string     `json:"service"`
+	Status      string     `json:"status"` // firing or resolved
+	Severity    string     `json:"severity"`
+	Description string     `json:"description,omitempty"`
+	Count       int64      `json:"count"` // Matches within the window when last evaluated
+	Threshold   int64      `json:"threshold"`
+	Window      string     `json:"window"`
+	Hostname    string     `json:"hostname,omitempty"` // Host of the latest match
+	Sample      string     `json:"sample,omitempty"`   // Line of the latest match
+	StartedAt   time.Time  `json:"started_at"`
+	ResolvedAt  *time.Time `json:"resolved_at,omitempty"`
+}
+
+// ForwardTargetStatus reports a forwarding webhook's delivery counters
+// since the server started
+type ForwardTargetStatus struct {
+	Name        string     `json:"name"`
+	Queued      int        `json:"queued"`  // Entries waiting to be sent
+	Sent        int64      `json:"sent"`    // Entries delivered
+	Dropped     int64      `json:"dropped"` // Entries dropped because the queue was full
+	Failed      int64      `json:"failed"`  // Entries in batches that failed after every retry
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+	OutputProgress
+}
+
+// KafkaStatus reports the Kafka output's delivery counters since the
+// server started
+type KafkaStatus struct {
+	Topics      int        `json:"topics"`  // Services published to so far
+	Queued      int        `json:"queued"`  // Entries waiting to be written
+	Sent        int64      `json:"sent"`    // Entries acknowledged by the brokers
+	Dropped     int64      `json:"dropped"` // Entries dropped because the queue was full
+	Failed      int64      `json:"failed"`  // Entries whose writes failed after every retry
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+	OutputProgress
+}
+
+// NATSStatus reports the NATS output's connection and delivery counters
+// since the server started
+type NATSStatus struct {
+	Connected   bool       `json:"connected"`
+	Subjects    int        `json:"subjects"` // Subjects published to so far
+	Queued      int        `json:"queued"`   // Entries waiting to be published
+	Sent        int64      `json:"sent"`     // Entries acknowledged by JetStream
+	Dropped     int64      `json:"dropped"`  // Entries dropped because the queue was full
+	Failed      int64      `json:"failed"`   // Entries whose publishes failed after every retry
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+	OutputProgress
+}
+
+// OutputProgress reports how far an output's deliveries trail ingestion,
+// so a broken destination shows up before its queue fills and entries are
+// dropped
+type OutputProgress struct {
+	State           string     `json:"state"` // ok, backlogged, or failing
+	QueueCapacity   int        `json:"queue_capacity"`
+	QueueUsage      float64    `json:"queue_usage"`     // Share of the queue in use; entries are dropped at 1
+	Sending         int64      `json:"sending"`         // Entries in the batch being sent, including retries
+	Retrying        int64      `json:"retrying"`        // Entries waiting to be retried after a failed attempt
+	FailedAttempts  int64      `json:"failed_attempts"` // Send attempts that failed, including ones later retried
+	LagSeconds      float64    `json:"lag_seconds"`     // From queueing to delivery, for the last delivered batch
+	PendingSeconds  float64    `json:"pending_seconds"` // Age of the oldest entry not yet delivered
+	LastDeliveredAt *time.Time `json:"last_delivered_at,omitempty"`
+}
+
+// OutputStatus reports one downstream destination, as listed across every
+// output at /v1/admin/outputs
+type OutputStatus struct {
+	Output      string     `json:"output"` // kafka, nats, or forward:<target>
+	Queued      int        `json:"queued"`
+	Sent        int64      `json:"sent"`
+	Dropped     int64      `json:"dropped"`
+	Failed      int64      `json:"failed"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+	OutputProgress
+}
+
+// RoutingStatus reports how many entries each routing rule matched and
+// each file and S3 sink's delivery counters since the server started
+type RoutingStatus struct {
+	Rules     []RoutingRuleStatus `json:"rules"`
+	Unmatched int64               `json:"unmatched"` // Entries sent to the default sinks
+	Sinks     []RoutingSinkStatus `json:"sinks"`
+}
+
+// RoutingRuleStatus reports the entries a routing rule matched
+type RoutingRuleStatus struct {
+	Name    string   `json:"name"`
+	Sinks   []string `json:"sinks"`
+	Matched int64    `json:"matched"`
+}
+
+// RoutingSinkStatus reports a file or S3 sink's delivery counters
+type RoutingSinkStatus struct {
+	Name        string     `json:"name"`
+	Type        string     `json:"type"`
+	Queued      int        `json:"queued"`  // Entries waiting to be written
+	Sent        int64      `json:"sent"`    // Entries written
+	Dropped     int64      `json:"dropped"` // Entries dropped because the queue was full
+	Failed      int64      `json:"failed"`  // Entries in batches that failed after every retry
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
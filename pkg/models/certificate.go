@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// CertificateStatus reports the expiry of a certificate the server uses
+// or has seen from a client
+type CertificateStatus struct {
+	Role          string    `json:"role"`           // ca, server, or client
+	Path          string    `json:"path,omitempty"` // For configured certificates
+	Subject       string    `json:"subject"`
+	Issuer        string    `json:"issuer"`
+	Serial        string    `json:"serial"`
+	NotAfter      time.Time `json:"not_after"`
+	DaysRemaining int       `json:"days_remaining"`
+	Expiring      bool      `json:"expiring"`            // Within the warning window
+	LastSeen      time.Time `json:"last_seen,omitempty"` // For client certificates
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// DeliveryGap is a run of batch sequence numbers from one tailer session
+// that never reached the server within the grace period
+type DeliveryGap struct {
+	AgentID       string    `json:"agent_id" bson:"agent_id"`
+	SessionID     string    `json:"session_id" bson:"session_id"`
+	FirstSequence uint64    `json:"first_sequence" bson:"first_sequence"`
+	LastSequence  uint64    `json:"last_sequence" bson:"last_sequence"`
+	Missing       int64     `json:"missing" bson:"missing"` // Batches in the run
+	DetectedAt    time.Time `json:"detected_at" bson:"detected_at"`
+}
+
+// DeliveryReport summarizes delivery for one agent
+type DeliveryReport struct {
+	AgentID         string        `json:"agent_id"`
+	MissingBatches  int64         `json:"missing_batches"`  // Recorded gaps in the requested window
+	PendingBatches  int           `json:"pending_batches"`  // Missing but still within the grace period
+	HighestSequence uint64        `json:"highest_sequence"` // Of the current session, if active
+	LastSeen        time.Time     `json:"last_seen,omitempty"`
+	Gaps            []DeliveryGap `json:"gaps"`
+}
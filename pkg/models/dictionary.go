@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// CompressionDictionary is a versioned zstd dictionary trained on a
+// collection's stored lines
+type CompressionDictionary struct {
+	Collection    string    `json:"collection" bson:"collection"`
+	Version       int       `json:"version" bson:"version"`
+	ID            uint32    `json:"id" bson:"dict_id"` // zstd dictionary ID
+	Dictionary    []byte    `json:"-" bson:"dictionary"`
+	Size          int       `json:"size" bson:"size"`
+	Samples       int       `json:"samples" bson:"samples"`
+	Ratio         float64   `json:"ratio" bson:"ratio"`                   // Held-out lines, compressed per line with the dictionary
+	BaselineRatio float64   `json:"baseline_ratio" bson:"baseline_ratio"` // The same lines compressed without it
+	TrainedAt     time.Time `json:"trained_at" bson:"trained_at"`
+}
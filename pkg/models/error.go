@@ -0,0 +1,87 @@
+package models
+
+import "net/http"
+
+// Error codes in APIError responses. Codes not listed here follow the HTTP
+// status, e.g. not_found or internal.
+const (
+	ErrCodeBadRequest          = "bad_request"
+	ErrCodeUnauthorized        = "unauthorized"
+	ErrCodeForbidden           = "forbidden"
+	ErrCodeNotFound            = "not_found"
+	ErrCodeMethodNotAllowed    = "method_not_allowed"
+	ErrCodeConflict            = "conflict"
+	ErrCodeUnsupportedMedia    = "unsupported_media_type"
+	ErrCodeMisdirected         = "misdirected"
+	ErrCodeUnprocessable       = "unprocessable"
+	ErrCodeRateLimited         = "rate_limited"
+	ErrCodeInternal            = "internal"
+	ErrCodeUnavailable         = "unavailable"
+	ErrCodeRequestTooLarge     = "request_too_large"
+	ErrCodeTooManyEntries      = "too_many_entries"
+	ErrCodeLineTooLong         = "line_too_long"
+	ErrCodeContentHashMismatch = "content_hash_mismatch"
+	ErrCodeRegionMismatch      = "region_mismatch"
+	ErrCodeBatchInProgress     = "batch_in_progress"
+	ErrCodeBatchIDConflict     = "batch_id_conflict"
+	ErrCodeQuotaExceeded       = "quota_exceeded"
+	ErrCodeTenantQuotaExceeded = "tenant_quota_exceeded"
+	ErrCodeWrongTenant         = "wrong_tenant"
+	ErrCodeCertificateRevoked  = "certificate_revoked"
+	ErrCodeBufferFull          = "buffer_full"
+)
+
+// APIError describes a failed request. Retryable tells clients whether
+// sending the same request again later may succeed.
+type APIError struct {
+	Code      string                 `json:"code"`
+	Message   string                 `json:"message"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	Retryable bool                   `json:"retryable"`
+}
+
+// Error returns the message
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// ErrorResponse is the body of every error response from the server and
+// the tailer's control API
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// NewAPIError creates an error with the code and retryability that
+// follow from an HTTP status
+func NewAPIError(status int, message string) APIError {
+	code := ErrCodeInternal
+	switch status {
+	case http.StatusBadRequest:
+		code = ErrCodeBadRequest
+	case http.StatusUnauthorized:
+		code = ErrCodeUnauthorized
+	case http.StatusForbidden:
+		code = ErrCodeForbidden
+	case http.StatusNotFound:
+		code = ErrCodeNotFound
+	case http.StatusMethodNotAllowed:
+		code = ErrCodeMethodNotAllowed
+	case http.StatusConflict:
+		code = ErrCodeConflict
+	case http.StatusRequestEntityTooLarge:
+		code = ErrCodeRequestTooLarge
+	case http.StatusUnsupportedMediaType:
+		code = ErrCodeUnsupportedMedia
+	case http.StatusMisdirectedRequest:
+		code = ErrCodeMisdirected
+	case http.StatusUnprocessableEntity:
+		code = ErrCodeUnprocessable
+	case http.StatusTooManyRequests:
+		code = ErrCodeRateLimited
+	case http.StatusServiceUnavailable:
+		code = ErrCodeUnavailable
+	}
+	// 421 is retryable against another server
+	retryable := status >= 500 || status == http.StatusMisdirectedRequest || status == http.StatusTooManyRequests
+	return APIError{Code: code, Message: message, Retryable: retryable}
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// FieldSummary describes a field seen in a service's recent entries, named
+// the way queries and stats refer to it: level, hostname, file_path,
+// label:<key>, or parsed.<path>
+type FieldSummary struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`             // string, number, bool, array, null, or mixed
+	Count    int      `json:"count"`            // Sampled entries holding the field
+	Distinct int      `json:"distinct"`         // Distinct values seen, capped at the tracking limit
+	Values   []string `json:"values,omitempty"` // Most frequent values first
+}
+
+// FieldCatalog lists the fields found in a sample of a service's newest
+// entries, for autocomplete
+type FieldCatalog struct {
+	Service    string         `json:"service"`
+	SampleSize int            `json:"sample_size"` // Entries sampled
+	SampledAt  time.Time      `json:"sampled_at"`
+	Fields     []FieldSummary `json:"fields"`
+}
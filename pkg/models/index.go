@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// IndexUsage reports how often an index has been used since Since
+type IndexUsage struct {
+	Collection string                 `json:"collection"`
+	Name       string                 `json:"name"`
+	Key        map[string]interface{} `json:"key"`
+	Ops        int64                  `json:"ops"`
+	Since      time.Time              `json:"since"`
+	Unused     bool                   `json:"unused"`
+}
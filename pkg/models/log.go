@@ -1,6 +1,9 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -9,24 +12,74 @@ import (
 // LogEntry represents a single log line with metadata
 type LogEntry struct {
 	ID          primitive.ObjectID     `json:"id" bson:"_id,omitempty"`
+	EntryID     string                 `json:"entry_id,omitempty" bson:"entry_id,omitempty"` // ULID or UUIDv7 assigned by the tailer, if configured, or the CloudWatch event ID
 	ServiceName string                 `json:"service_name" bson:"service_name"`
 	Hostname    string                 `json:"hostname" bson:"hostname"`
 	FilePath    string                 `json:"file_path" bson:"file_path"`
 	Line        string                 `json:"line" bson:"line"`
 	Timestamp   time.Time              `json:"timestamp" bson:"timestamp"`
 	LineNumber  int64                  `json:"line_number" bson:"line_number"`
+	Labels      map[string]string      `json:"labels,omitempty" bson:"labels,omitempty"`
+	Level       string                 `json:"level,omitempty" bson:"level,omitempty"` // Detected severity, set by the server
 	Parsed      map[string]interface{} `json:"parsed,omitempty" bson:"parsed,omitempty"`
+	TraceID     string                 `json:"trace_id,omitempty" bson:"trace_id,omitempty"` // W3C trace ID from ingest headers or the client
+	SpanID      string                 `json:"span_id,omitempty" bson:"span_id,omitempty"`
+	IngestedBy  string                 `json:"ingested_by,omitempty" bson:"ingested_by,omitempty"` // Authenticated sender, set by the server
+	Tenant      string                 `json:"tenant,omitempty" bson:"tenant,omitempty"`           // Tenant owning the service, set by the server
 }
 
 // LogBatch wraps multiple log entries for efficient transmission
 type LogBatch struct {
 	ServiceName string     `json:"service_name"`
 	Entries     []LogEntry `json:"entries"`
+
+	// Delivery tracking: each tailer run numbers its batches 1, 2, 3, ...
+	// so the server can detect batches lost in transit
+	AgentID     string `json:"agent_id,omitempty"`
+	SessionID   string `json:"session_id,omitempty"` // Random per tailer process start
+	BatchID     string `json:"batch_id,omitempty"`   // Client-generated, identifies retries of the same batch
+	Sequence    uint64 `json:"sequence,omitempty"`
+	ContentHash string `json:"content_hash,omitempty"` // HashContent() of the entries as sent
+
+	// PreParsed marks entries already parsed by the sender. Servers that
+	// trust the sender store them without running their parsing pipelines.
+	PreParsed bool `json:"pre_parsed,omitempty"`
+}
+
+// HashContent returns a SHA-256 over each entry's source, line number, and
+// line, identifying a batch's content independently of JSON encoding
+func (b LogBatch) HashContent() string {
+	h := sha256.New()
+	for _, entry := range b.Entries {
+		h.Write([]byte(entry.FilePath))
+		h.Write([]byte{0})
+		h.Write([]byte(strconv.FormatInt(entry.LineNumber, 10)))
+		h.Write([]byte{0})
+		h.Write([]byte(entry.Line))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
 }
 
-// FileState tracks the reading position of a log file
+// FileState tracks the reading position of a log file, and which file it
+// was, so a replaced or rotated file is recognized even when its inode is
+// reused or unknown
 type FileState struct {
-	Offset   int64     `json:"offset"`
-	Inode    uint64    `json:"inode"`
-	LastRead time.Time `json:"last_read"`
+	Offset          int64     `json:"offset"`
+	LineNumber      int64     `json:"line_number,omitempty"` // Lines read up to the offset
+	Inode           uint64    `json:"inode"`
+	Fingerprint     string    `json:"fingerprint,omitempty"`      // SHA-256 of the file's first bytes
+	FingerprintSize int64     `json:"fingerprint_size,omitempty"` // Bytes hashed, up to 1024
+	LastRead        time.Time `json:"last_read"`
+}
+
+// TailedFile reports a file the tailer has discovered and how far it has read
+type TailedFile struct {
+	Path       string    `json:"path"`
+	Service    string    `json:"service"`
+	Paused     bool      `json:"paused"`
+	Offset     int64     `json:"offset"`
+	LineNumber int64     `json:"line_number,omitempty"`
+	LastRead   time.Time `json:"last_read,omitempty"`
+	Dropped    int64     `json:"dropped"` // Lines dropped under backpressure since the tailer started
 }
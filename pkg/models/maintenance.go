@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// MaintenanceWindow mutes notifications, and optionally samples ingestion,
+// for matching services and hosts until it ends
+type MaintenanceWindow struct {
+	ID         string    `json:"id" bson:"_id"`
+	Service    string    `json:"service,omitempty" bson:"service,omitempty"`   // Glob, empty matches every service
+	Hostname   string    `json:"hostname,omitempty" bson:"hostname,omitempty"` // Glob, empty matches every host
+	Reason     string    `json:"reason,omitempty" bson:"reason,omitempty"`
+	SampleRate float64   `json:"sample_rate,omitempty" bson:"sample_rate,omitempty"` // Fraction of entries kept; 0 keeps all
+	StartsAt   time.Time `json:"starts_at" bson:"starts_at"`
+	EndsAt     time.Time `json:"ends_at" bson:"ends_at"`
+	CreatedBy  string    `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
+	Static     bool      `json:"static,omitempty" bson:"-"` // From configuration, can't be deleted through the API
+}
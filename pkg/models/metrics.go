@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// MetricsSample is one interval of a server's operational metrics, kept
+// in the metrics history collection
+type MetricsSample struct {
+	Instance  string    `json:"instance" bson:"instance"`   // Server hostname
+	Timestamp time.Time `json:"timestamp" bson:"timestamp"` // End of the interval
+	Interval  float64   `json:"interval_seconds" bson:"interval_seconds"`
+
+	Requests     int64   `json:"requests" bson:"requests"`
+	ClientErrors int64   `json:"client_errors" bson:"client_errors"` // 4xx responses
+	ServerErrors int64   `json:"server_errors" bson:"server_errors"` // 5xx responses
+	ErrorRate    float64 `json:"error_rate" bson:"error_rate"`       // Share of requests answered with 5xx
+
+	IngestBatches int64   `json:"ingest_batches" bson:"ingest_batches"` // Batches stored or buffered
+	IngestEntries int64   `json:"ingest_entries" bson:"ingest_entries"`
+	IngestRate    float64 `json:"ingest_rate" bson:"ingest_rate"`     // Entries per second
+	IngestErrors  int64   `json:"ingest_errors" bson:"ingest_errors"` // Ingest requests answered with 5xx
+
+	// Queue depths at the end of the interval
+	WriteBufferBatches int `json:"write_buffer_batches" bson:"write_buffer_batches"`
+	WriteBufferSpilled int `json:"write_buffer_spilled" bson:"write_buffer_spilled"`
+	BulkWriterQueued   int `json:"bulk_writer_queued" bson:"bulk_writer_queued"`
+	LiveTailSessions   int `json:"live_tail_sessions" bson:"live_tail_sessions"`
+
+	Outputs []OutputSample `json:"outputs,omitempty" bson:"outputs,omitempty"` // Downstream destinations
+}
+
+// OutputSample is a downstream destination's delivery during a metrics
+// interval, with its queue and lag at the end of it
+type OutputSample struct {
+	Output         string  `json:"output" bson:"output"` // kafka, nats, or forward:<target>
+	State          string  `json:"state" bson:"state"`
+	Queued         int     `json:"queued" bson:"queued"`
+	QueueUsage     float64 `json:"queue_usage" bson:"queue_usage"`
+	Retrying       int64   `json:"retrying" bson:"retrying"`
+	LagSeconds     float64 `json:"lag_seconds" bson:"lag_seconds"`
+	PendingSeconds float64 `json:"pending_seconds" bson:"pending_seconds"`
+	Sent           int64   `json:"sent" bson:"sent"` // During the interval, as are the counts below
+	Dropped        int64   `json:"dropped" bson:"dropped"`
+	Failed         int64   `json:"failed" bson:"failed"`
+	FailedAttempts int64   `json:"failed_attempts" bson:"failed_attempts"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// PatternChange compares how often one log pattern occurred in two windows.
+// Counts are estimated from a sample when a window has more entries than
+// the sample size.
+type PatternChange struct {
+	Pattern       string  `json:"pattern"`
+	Example       string  `json:"example"`
+	BaselineCount int64   `json:"baseline_count"`
+	CurrentCount  int64   `json:"current_count"`
+	BaselineShare float64 `json:"baseline_share"` // Fraction of the window's entries
+	CurrentShare  float64 `json:"current_share"`
+	Ratio         float64 `json:"ratio,omitempty"` // current_share / baseline_share, for shifted patterns
+}
+
+// PatternDiff reports pattern distribution changes between a baseline
+// window and a current window for one service
+type PatternDiff struct {
+	Service       string          `json:"service"`
+	BaselineFrom  time.Time       `json:"baseline_from"`
+	BaselineTo    time.Time       `json:"baseline_to"`
+	CurrentFrom   time.Time       `json:"current_from"`
+	CurrentTo     time.Time       `json:"current_to"`
+	BaselineTotal int64           `json:"baseline_total"`
+	CurrentTotal  int64           `json:"current_total"`
+	Sampled       bool            `json:"sampled"` // Counts are estimates
+	New           []PatternChange `json:"new"`
+	Vanished      []PatternChange `json:"vanished"`
+	Shifted       []PatternChange `json:"shifted"`
+}
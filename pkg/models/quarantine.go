@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// QuarantinedEntry is a log entry MongoDB rejected on insert, kept aside
+// so the rest of its batch can be stored
+type QuarantinedEntry struct {
+	Collection    string    `json:"collection" bson:"collection"`
+	Code          int       `json:"code" bson:"code"`
+	Error         string    `json:"error" bson:"error"`
+	Entry         LogEntry  `json:"entry" bson:"entry"`
+	Truncated     bool      `json:"truncated" bson:"truncated"` // Line shortened or parsed fields removed to fit
+	QuarantinedAt time.Time `json:"quarantined_at" bson:"quarantined_at"`
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LogQuery describes a search over a single service's log entries
+type LogQuery struct {
+	ServiceName string            `json:"service_name"`
+	Hostname    string            `json:"hostname,omitempty"`
+	FilePath    string            `json:"file_path,omitempty"`
+	Contains    string            `json:"contains,omitempty"`
+	Search      string            `json:"search,omitempty"` // Text search, needs mongodb.indexes.line_text
+	Levels      []string          `json:"levels,omitempty"`
+	TraceID     string            `json:"trace_id,omitempty"`
+	EntryID     string            `json:"entry_id,omitempty"`
+	IngestedBy  string            `json:"ingested_by,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	From        time.Time         `json:"from,omitempty"`
+	To          time.Time         `json:"to,omitempty"`
+	Limit       int64             `json:"limit"`
+}
+
+// QueryAuditEntry records an executed query for auditing and slow-query analysis
+type QueryAuditEntry struct {
+	ID                  primitive.ObjectID     `json:"id" bson:"_id,omitempty"`
+	Identity            string                 `json:"identity" bson:"identity"`
+	Collection          string                 `json:"collection" bson:"collection"`
+	Kind                string                 `json:"kind,omitempty" bson:"kind,omitempty"` // "export" for exports; empty for queries
+	Filter              map[string]interface{} `json:"filter" bson:"filter"`
+	Limit               int64                  `json:"limit" bson:"limit"`
+	DurationMS          int64                  `json:"duration_ms" bson:"duration_ms"`
+	DocsReturned        int                    `json:"docs_returned" bson:"docs_returned"`
+	DocsExamined        int64                  `json:"docs_examined" bson:"docs_examined"`                   // From explaining this query; -1 when it wasn't
+	DocsExaminedSampled int64                  `json:"docs_examined_sampled" bson:"docs_examined_sampled"`   // From the latest explain of the query's shape, when it wasn't explained itself; -1 otherwise
+	ExplainedAt         *time.Time             `json:"explained_at,omitempty" bson:"explained_at,omitempty"` // When DocsExamined or DocsExaminedSampled was measured
+	Slow                bool                   `json:"slow" bson:"slow"`
+	Timestamp           time.Time              `json:"timestamp" bson:"timestamp"`
+}
+
+// StreamSessionEntry records a live-tail session for auditing
+type StreamSessionEntry struct {
+	ID               primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Identity         string             `json:"identity" bson:"identity"`
+	Service          string             `json:"service" bson:"service"`
+	Filter           map[string]string  `json:"filter" bson:"filter"`
+	StartedAt        time.Time          `json:"started_at" bson:"started_at"`
+	EndedAt          time.Time          `json:"ended_at" bson:"ended_at"`
+	DurationMS       int64              `json:"duration_ms" bson:"duration_ms"`
+	EntriesDelivered int64              `json:"entries_delivered" bson:"entries_delivered"`
+	EntriesDropped   int64              `json:"entries_dropped" bson:"entries_dropped"`
+}
+
+// BucketCount is the number of entries in one histogram bucket
+type BucketCount struct {
+	Start time.Time `json:"start"`
+	Count int64     `json:"count"`
+}
+
+// ValueCount is the number of entries sharing a field value. Value is nil
+// for entries without the field.
+type ValueCount struct {
+	Value interface{} `json:"value"`
+	Count int64       `json:"count"`
+}
+
+// FileGap is a run of a file's lines with no stored entry
+type FileGap struct {
+	FromLine int64 `json:"from_line"`
+	ToLine   int64 `json:"to_line"`
+}
+
+// FileReadSummary describes a file read in line order
+type FileReadSummary struct {
+	Entries      int64 `json:"entries"`
+	Gaps         int64 `json:"gaps"`
+	MissingLines int64 `json:"missing_lines"`
+	Duplicates   int64 `json:"duplicates"` // Entries stored more than once, written once
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// RetentionPreview reports what a retention policy would delete from a collection
+type RetentionPreview struct {
+	Collection string    `json:"collection"`
+	Cutoff     time.Time `json:"cutoff"`
+	Documents  int64     `json:"documents"`
+	Bytes      int64     `json:"bytes"`
+}
+
+// ServiceRetention is the retention in effect for a service's collection
+type ServiceRetention struct {
+	Service    string    `json:"service,omitempty"`
+	Collection string    `json:"collection"`
+	TTLDays    int       `json:"ttl_days"` // 0 keeps entries forever
+	Source     string    `json:"source"`   // override, config, template, or default
+	UpdatedBy  string    `json:"updated_by,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at,omitempty"`
+}
+
+// RetentionOverride is a service's retention set through the API, taking
+// precedence over configuration
+type RetentionOverride struct {
+	Collection string    `bson:"_id"`
+	Service    string    `bson:"service"`
+	TTLDays    int       `bson:"ttl_days"`
+	UpdatedBy  string    `bson:"updated_by"`
+	UpdatedAt  time.Time `bson:"updated_at"`
+}
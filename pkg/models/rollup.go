@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// MinuteCount is a materialized per-minute entry count for one
+// service, host, and level
+type MinuteCount struct {
+	Service  string    `json:"service" bson:"service"`
+	Hostname string    `json:"hostname" bson:"hostname"`
+	Level    string    `json:"level" bson:"level"` // empty when no level was detected
+	Minute   time.Time `json:"minute" bson:"minute"`
+	Count    int64     `json:"count" bson:"count"`
+}
@@ -0,0 +1,23 @@
+package models
+
+// ServiceInfo summarizes a service's log collections
+type ServiceInfo struct {
+	Service      string   `json:"service"`     // Collection name without the prefix
+	Collections  []string `json:"collections"` // The service collection and its partitions
+	Documents    int64    `json:"documents"`
+	SizeBytes    int64    `json:"size_bytes"`    // Uncompressed document size
+	StorageBytes int64    `json:"storage_bytes"` // On disk, after compression
+	IndexBytes   int64    `json:"index_bytes"`
+	TTLDays      int      `json:"ttl_days"` // 0 keeps entries forever
+}
+
+// ServiceThrottleStatus reports a service's ingest sampling and rate limit
+type ServiceThrottleStatus struct {
+	Service          string         `json:"service"`
+	EntriesPerSecond float64        `json:"entries_per_second"` // 0 = unlimited
+	Burst            int64          `json:"burst"`
+	Sample           map[string]int `json:"sample,omitempty"`  // Level -> keep 1 in N entries
+	Sampled          int64          `json:"sampled"`           // Entries dropped by sampling
+	Throttled        int64          `json:"throttled"`         // Entries in batches rejected over the rate
+	ThrottledBatches int64          `json:"throttled_batches"` // Batches rejected with 429
+}
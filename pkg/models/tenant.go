@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// TenantService records the tenant owning a service's collection
+type TenantService struct {
+	Collection string    `json:"collection" bson:"_id"`
+	Service    string    `json:"service" bson:"service"`
+	Tenant     string    `json:"tenant" bson:"tenant"`
+	ClaimedBy  string    `json:"claimed_by" bson:"claimed_by"` // Sender of the first batch, or the admin who assigned it
+	ClaimedAt  time.Time `json:"claimed_at" bson:"claimed_at"`
+}
+
+// TenantInfo summarizes a tenant's services and usage
+type TenantInfo struct {
+	Name       string   `json:"name"`
+	Admin      bool     `json:"admin"`
+	Services   []string `json:"services"`
+	TTLDays    int      `json:"ttl_days,omitempty"`    // 0 = the server default
+	QuotaLimit int64    `json:"quota_limit,omitempty"` // 0 = unlimited
+	QuotaUsed  int64    `json:"quota_used"`            // In the current quota window
+}
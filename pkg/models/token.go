@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// AccessToken is a scoped, time-limited grant of read access
+type AccessToken struct {
+	ID        string    `json:"id" bson:"_id"`
+	Scope     string    `json:"scope" bson:"scope"`   // service or query
+	Target    string    `json:"target" bson:"target"` // service name or saved query id
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	CreatedBy string    `json:"created_by" bson:"created_by"`
+	Revoked   bool      `json:"revoked" bson:"revoked"`
+	RevokedAt time.Time `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+}
@@ -7,52 +7,63 @@ import (
 	"os"
 )
 
-// LoadClientTLSConfig creates a TLS configuration for mTLS clients
-func LoadClientTLSConfig(caCertPath, clientCertPath, clientKeyPath, serverName string) (*tls.Config, error) {
-	// Load CA cert
-	caCert, err := os.ReadFile(caCertPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
-	}
-
-	caCertPool := x509.NewCertPool()
-	if !caCertPool.AppendCertsFromPEM(caCert) {
-		return nil, fmt.Errorf("failed to append CA certificate")
-	}
-
+// LoadClientTLSConfig creates a TLS configuration for mTLS clients.
+// passphrase decrypts an encrypted client key and may be nil.
+func LoadClientTLSConfig(caCertPath, clientCertPath, clientKeyPath, serverName string, passphrase Passphrase) (*tls.Config, error) {
 	// Load client cert and key
-	clientCert, err := tls.LoadX509KeyPair(clientCertPath, clientKeyPath)
+	clientCert, err := LoadKeyPair(clientCertPath, clientKeyPath, passphrase)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load client certificate: %w", err)
 	}
-
-	return &tls.Config{
-		RootCAs:      caCertPool,
-		Certificates: []tls.Certificate{clientCert},
-		ServerName:   serverName,
-		MinVersion:   tls.VersionTLS13,
-	}, nil
+	return ClientTLSConfig(caCertPath, clientCert, serverName)
 }
 
-// LoadServerTLSConfig creates a TLS configuration for mTLS servers
-func LoadServerTLSConfig(caCertPath, serverCertPath, serverKeyPath string, requireClientCert bool) (*tls.Config, error) {
-	// Load CA cert for client verification
-	caCert, err := os.ReadFile(caCertPath)
+// ClientTLSConfig creates a TLS configuration for mTLS clients presenting
+// a reloadable client certificate
+func ClientTLSConfig(caCertPath string, clientCert *KeyPair, serverName string) (*tls.Config, error) {
+	caCertPool, err := loadCAPool(caCertPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		return nil, err
 	}
+	return ClientTLSConfigWithCAs(caCertPool, clientCert, serverName), nil
+}
 
-	caCertPool := x509.NewCertPool()
-	if !caCertPool.AppendCertsFromPEM(caCert) {
-		return nil, fmt.Errorf("failed to append CA certificate")
+// ClientTLSConfigWithCAs creates a TLS configuration for mTLS clients
+// trusting an already loaded CA pool
+func ClientTLSConfigWithCAs(caCertPool *x509.CertPool, clientCert *KeyPair, serverName string) *tls.Config {
+	return &tls.Config{
+		RootCAs:              caCertPool,
+		GetClientCertificate: clientCert.GetClientCertificate,
+		ServerName:           serverName,
+		MinVersion:           tls.VersionTLS13,
 	}
+}
 
+// LoadServerTLSConfig creates a TLS configuration for mTLS servers.
+// passphrase decrypts an encrypted server key and may be nil.
+func LoadServerTLSConfig(caCertPath, serverCertPath, serverKeyPath string, requireClientCert bool, passphrase Passphrase) (*tls.Config, error) {
 	// Load server cert and key
-	serverCert, err := tls.LoadX509KeyPair(serverCertPath, serverKeyPath)
+	serverCert, err := LoadKeyPair(serverCertPath, serverKeyPath, passphrase)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load server certificate: %w", err)
 	}
+	return ServerTLSConfig(caCertPath, serverCert, requireClientCert)
+}
+
+// ServerTLSConfig creates a TLS configuration for mTLS servers presenting
+// a reloadable server certificate
+func ServerTLSConfig(caCertPath string, serverCert *KeyPair, requireClientCert bool) (*tls.Config, error) {
+	// Load CA cert for client verification
+	caCertPool, err := loadCAPool(caCertPath)
+	if err != nil {
+		return nil, err
+	}
+	return ServerTLSConfigWithCAs(caCertPool, serverCert, requireClientCert), nil
+}
 
+// ServerTLSConfigWithCAs creates a TLS configuration for mTLS servers
+// verifying clients against an already loaded CA pool
+func ServerTLSConfigWithCAs(caCertPool *x509.CertPool, serverCert *KeyPair, requireClientCert bool) *tls.Config {
 	clientAuth := tls.NoClientCert
 	if requireClientCert {
 		// Request (but don't require) client certs at TLS layer
@@ -61,9 +72,23 @@ func LoadServerTLSConfig(caCertPath, serverCertPath, serverKeyPath string, requi
 	}
 
 	return &tls.Config{
-		Certificates: []tls.Certificate{serverCert},
-		ClientCAs:    caCertPool,
-		ClientAuth:   clientAuth,
-		MinVersion:   tls.VersionTLS13,
-	}, nil
+		GetCertificate: serverCert.GetCertificate,
+		ClientCAs:      caCertPool,
+		ClientAuth:     clientAuth,
+		MinVersion:     tls.VersionTLS13,
+	}
+}
+
+// loadCAPool reads a CA bundle into a certificate pool
+func loadCAPool(caCertPath string) (*x509.CertPool, error) {
+	caCert, err := os.ReadFile(caCertPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+
+	caCertPool := x509.NewCertPool()
+	if !caCertPool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("failed to append CA certificate")
+	}
+	return caCertPool, nil
 }
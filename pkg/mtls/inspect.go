@@ -0,0 +1,94 @@
+package mtls
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"time"
+)
+
+// CertificateInfo describes a certificate read from a PEM file
+type CertificateInfo struct {
+	Path      string    `json:"path"`
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+}
+
+// DaysRemaining returns whole days until expiry, negative once expired
+func (c CertificateInfo) DaysRemaining(now time.Time) int {
+	return int(c.NotAfter.Sub(now).Hours() / 24)
+}
+
+// Describe summarizes a parsed certificate
+func Describe(path string, cert *x509.Certificate) CertificateInfo {
+	return CertificateInfo{
+		Path:      path,
+		Subject:   cert.Subject.String(),
+		Issuer:    cert.Issuer.String(),
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+	}
+}
+
+// ParseCertificateFile parses every certificate in a PEM file
+func ParseCertificateFile(path string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate: %w", err)
+	}
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate in %s: %w", path, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return certs, nil
+}
+
+// VerifyCertificateFile checks that the leaf certificate in certPath chains
+// to the CA in caPath for the given usage
+func VerifyCertificateFile(certPath, caPath string, usage x509.ExtKeyUsage) error {
+	certs, err := ParseCertificateFile(certPath)
+	if err != nil {
+		return err
+	}
+	cas, err := ParseCertificateFile(caPath)
+	if err != nil {
+		return err
+	}
+
+	roots := x509.NewCertPool()
+	for _, ca := range cas {
+		roots.AddCert(ca)
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	if _, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+	}); err != nil {
+		return fmt.Errorf("certificate %s does not verify against %s: %w", certPath, caPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package mtls
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// certOrganization is the organization named in issued certificates
+const certOrganization = "logl"
+
+// clockSkew backdates issued certificates so hosts whose clocks run
+// slightly behind accept them straight away
+const clockSkew = 5 * time.Minute
+
+// Issued is a certificate and its private key
+type Issued struct {
+	Cert *x509.Certificate
+	Key  crypto.Signer
+}
+
+// IssueOptions describes a certificate to issue from a CA
+type IssueOptions struct {
+	CommonName         string
+	OrganizationalUnit []string // Mapped to tenants by the server's tenancy config
+	DNSNames           []string
+	IPAddresses        []net.IP
+	Validity           time.Duration
+	Server             bool // Issue for server rather than client authentication
+}
+
+// NewCA creates a self-signed CA certificate
+func NewCA(commonName string, validity time.Duration) (*Issued, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate CA key: %w", err)
+	}
+	template, err := newTemplate(commonName, validity)
+	if err != nil {
+		return nil, err
+	}
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.MaxPathLenZero = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+
+	return sign(template, template, key, key)
+}
+
+// LoadCA loads a CA certificate and key written by WriteFiles. passphrase
+// decrypts an encrypted key and may be nil.
+func LoadCA(certPath, keyPath string, passphrase Passphrase) (*Issued, error) {
+	pair, err := LoadX509KeyPair(certPath, keyPath, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load CA: %w", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+	if !cert.IsCA {
+		return nil, fmt.Errorf("%s is not a CA certificate", certPath)
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported CA key type in %s", keyPath)
+	}
+	return &Issued{Cert: cert, Key: key}, nil
+}
+
+// Issue creates a server or client certificate signed by the CA. It
+// expires no later than the CA does.
+func (ca *Issued) Issue(opts IssueOptions) (*Issued, error) {
+	if opts.CommonName == "" {
+		return nil, fmt.Errorf("a common name is required")
+	}
+	if opts.Server && len(opts.DNSNames) == 0 && len(opts.IPAddresses) == 0 {
+		return nil, fmt.Errorf("a server certificate needs at least one DNS name or IP address")
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	template, err := newTemplate(opts.CommonName, opts.Validity)
+	if err != nil {
+		return nil, err
+	}
+	if template.NotAfter.After(ca.Cert.NotAfter) {
+		template.NotAfter = ca.Cert.NotAfter
+	}
+	template.Subject.OrganizationalUnit = opts.OrganizationalUnit
+	template.DNSNames = opts.DNSNames
+	template.IPAddresses = opts.IPAddresses
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	if opts.Server {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	}
+
+	return sign(template, ca.Cert, key, ca.Key)
+}
+
+// newTemplate returns a certificate template with a random serial number
+func newTemplate(commonName string, validity time.Duration) (*x509.Certificate, error) {
+	if validity <= 0 {
+		return nil, fmt.Errorf("validity must be positive")
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   commonName,
+			Organization: []string{certOrganization},
+		},
+		NotBefore: now.Add(-clockSkew),
+		NotAfter:  now.Add(validity),
+	}, nil
+}
+
+// sign signs a template with the parent's key
+func sign(template, parent *x509.Certificate, key *ecdsa.PrivateKey, parentKey crypto.Signer) (*Issued, error) {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	return &Issued{Cert: cert, Key: key}, nil
+}
+
+// WriteFiles writes the certificate and key as PEM, the key readable only
+// by its owner and encrypted when a passphrase is given. Existing files are
+// only replaced when overwrite is set.
+func (i *Issued) WriteFiles(certPath, keyPath string, passphrase []byte, overwrite bool) error {
+	var keyPEM []byte
+	if passphrase != nil {
+		var err error
+		if keyPEM, err = EncryptKey(i.Key, passphrase); err != nil {
+			return err
+		}
+	} else {
+		keyDER, err := x509.MarshalPKCS8PrivateKey(i.Key)
+		if err != nil {
+			return fmt.Errorf("failed to encode key: %w", err)
+		}
+		keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	}
+	if !overwrite {
+		for _, path := range []string{certPath, keyPath} {
+			if _, err := os.Stat(path); err == nil {
+				return fmt.Errorf("%s: %w", path, os.ErrExist)
+			} else if !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: i.Cert.Raw})
+	if err := writeFileAtomic(keyPath, keyPEM, 0600); err != nil {
+		return fmt.Errorf("failed to write key: %w", err)
+	}
+	if err := writeFileAtomic(certPath, certPEM, 0644); err != nil {
+		return fmt.Errorf("failed to write certificate: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes a file through a temporary file in the same
+// directory and renames it into place
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,186 @@
+package mtls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/youmark/pkcs8"
+)
+
+// errNotTerminal is returned when a passphrase would be prompted for but
+// stdin is not a terminal
+var errNotTerminal = errors.New("stdin is not a terminal")
+
+// Passphrase returns the passphrase of the encrypted private key at
+// keyPath. It is only called for keys that are encrypted.
+type Passphrase func(keyPath string) ([]byte, error)
+
+// PassphraseFrom returns a Passphrase read from a file, or failing that an
+// environment variable. The file and variable are read on every call, so
+// a re-encrypted key can be rotated along with its passphrase. With
+// neither set, the passphrase is prompted for when stdin is a terminal
+// and remembered for reloads.
+func PassphraseFrom(file, env string) Passphrase {
+	var mu sync.Mutex
+	var prompted []byte
+	return func(keyPath string) ([]byte, error) {
+		switch {
+		case file != "":
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read key passphrase: %w", err)
+			}
+			return []byte(strings.TrimRight(string(data), "\r\n")), nil
+		case env != "":
+			value, ok := os.LookupEnv(env)
+			if !ok {
+				return nil, fmt.Errorf("key passphrase variable %s is not set", env)
+			}
+			return []byte(value), nil
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if prompted != nil {
+			return prompted, nil
+		}
+		passphrase, err := readPassword(os.Stdin, fmt.Sprintf("Passphrase for %s: ", keyPath))
+		if errors.Is(err, errNotTerminal) {
+			return nil, fmt.Errorf("%s is encrypted, no passphrase file or variable is set, and %w to prompt for one", keyPath, err)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key passphrase: %w", err)
+		}
+		prompted = passphrase
+		return prompted, nil
+	}
+}
+
+// LoadX509KeyPair reads a certificate and key pair from PEM files like
+// tls.LoadX509KeyPair, decrypting the key with passphrase when it is
+// encrypted. Both PKCS #8 "ENCRYPTED PRIVATE KEY" blocks and legacy
+// OpenSSL encrypted PEM are accepted. passphrase may be nil when keys
+// are never encrypted.
+func LoadX509KeyPair(certPath, keyPath string, passphrase Passphrase) (tls.Certificate, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if keyPEM, err = decryptKeyPEM(keyPEM, keyPath, passphrase); err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// decryptKeyPEM returns an encrypted PEM key decrypted to a PKCS #8
+// "PRIVATE KEY" block, and any other key unchanged
+func decryptKeyPEM(keyPEM []byte, keyPath string, passphrase Passphrase) ([]byte, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return keyPEM, nil
+	}
+	// Deprecated as insecure, but older OpenSSL versions still write it
+	legacy := x509.IsEncryptedPEMBlock(block)
+	if block.Type != "ENCRYPTED PRIVATE KEY" && !legacy {
+		return keyPEM, nil
+	}
+	if passphrase == nil {
+		return nil, fmt.Errorf("%s is encrypted and no passphrase is configured", keyPath)
+	}
+	secret, err := passphrase(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var key interface{}
+	if legacy {
+		key, err = decryptLegacyKey(block, secret)
+	} else {
+		key, err = decryptPKCS8Key(block.Bytes, secret)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %w", keyPath, err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode key from %s: %w", keyPath, err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// decryptPKCS8Key decrypts a PBES2 encrypted PKCS #8 key
+func decryptPKCS8Key(der, secret []byte) (key interface{}, err error) {
+	// The decrypter panics on ciphertext that isn't a whole number of
+	// blocks, which only a damaged file has
+	defer func() {
+		if recover() != nil {
+			key, err = nil, fmt.Errorf("malformed encrypted key")
+		}
+	}()
+	return pkcs8.ParsePKCS8PrivateKey(append([]byte(nil), der...), secret)
+}
+
+// decryptLegacyKey decrypts an OpenSSL "Proc-Type: 4,ENCRYPTED" PEM block
+func decryptLegacyKey(block *pem.Block, secret []byte) (interface{}, error) {
+	der, err := x509.DecryptPEMBlock(block, secret)
+	if err != nil {
+		return nil, err
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(der)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(der)
+	}
+	return x509.ParsePKCS8PrivateKey(der)
+}
+
+// EncryptKey encodes a private key as a PKCS #8 "ENCRYPTED PRIVATE KEY"
+// PEM block, using AES-256-CBC with a PBKDF2-derived key
+func EncryptKey(key interface{}, passphrase []byte) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("an empty passphrase can't encrypt a key")
+	}
+	der, err := pkcs8.ConvertPrivateKeyToPKCS8(key, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: der}), nil
+}
+
+// readLine prints a prompt to stderr and reads up to a newline one byte at
+// a time, so nothing after it is consumed from the terminal
+func readLine(f *os.File, prompt string) ([]byte, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	defer fmt.Fprintln(os.Stderr)
+
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			if buf[0] == '\n' {
+				return []byte(strings.TrimRight(string(line), "\r")), nil
+			}
+			line = append(line, buf[0])
+		}
+		if err != nil {
+			if err == io.EOF && len(line) > 0 {
+				return line, nil
+			}
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package mtls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// KeyPair is a certificate and key loaded from files. Reloading it swaps
+// the certificate handed to new TLS handshakes through GetCertificate and
+// GetClientCertificate, so rotated certificates are used without a
+// restart. Connections already established keep the certificate they
+// negotiated with.
+type KeyPair struct {
+	certPath   string
+	keyPath    string
+	passphrase Passphrase
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	leaf      *x509.Certificate
+	certStamp fileStamp
+	keyStamp  fileStamp
+}
+
+// fileStamp identifies a version of a file by its modification time and size
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// LoadKeyPair loads a certificate and key pair for reloading. passphrase
+// decrypts an encrypted key and may be nil when the key is never encrypted.
+func LoadKeyPair(certPath, keyPath string, passphrase Passphrase) (*KeyPair, error) {
+	k := &KeyPair{certPath: certPath, keyPath: keyPath, passphrase: passphrase}
+	if err := k.load(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// NewKeyPair holds a certificate obtained other than from files, such as
+// from a secrets manager. It is replaced with Set rather than reloaded.
+func NewKeyPair(cert tls.Certificate) (*KeyPair, error) {
+	k := &KeyPair{}
+	if err := k.Set(cert); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Set makes a certificate current
+func (k *KeyPair) Set(cert tls.Certificate) error {
+	if len(cert.Certificate) == 0 {
+		return fmt.Errorf("no certificate in key pair")
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	k.mu.Lock()
+	k.cert = &cert
+	k.leaf = leaf
+	k.mu.Unlock()
+	return nil
+}
+
+// load reads the pair from its files and makes it current
+func (k *KeyPair) load() error {
+	certStamp, err := stampFile(k.certPath)
+	if err != nil {
+		return err
+	}
+	keyStamp, err := stampFile(k.keyPath)
+	if err != nil {
+		return err
+	}
+
+	cert, err := LoadX509KeyPair(k.certPath, k.keyPath, k.passphrase)
+	if err != nil {
+		return err
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("failed to parse certificate in %s: %w", k.certPath, err)
+	}
+
+	k.mu.Lock()
+	k.cert = &cert
+	k.leaf = leaf
+	k.certStamp = certStamp
+	k.keyStamp = keyStamp
+	k.mu.Unlock()
+	return nil
+}
+
+// stampFile returns a file's current stamp
+func stampFile(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// Reload re-reads the pair when either file changed since it was loaded,
+// or always when forced, reporting whether it did. A pair that fails to
+// load, e.g. while a rotation has written the certificate but not yet the
+// key, leaves the current one in use.
+func (k *KeyPair) Reload(force bool) (bool, error) {
+	if k.certPath == "" {
+		return false, nil // Not loaded from files
+	}
+	if !force {
+		certStamp, err := stampFile(k.certPath)
+		if err != nil {
+			return false, err
+		}
+		keyStamp, err := stampFile(k.keyPath)
+		if err != nil {
+			return false, err
+		}
+		k.mu.RLock()
+		unchanged := certStamp == k.certStamp && keyStamp == k.keyStamp
+		k.mu.RUnlock()
+		if unchanged {
+			return false, nil
+		}
+	}
+
+	if err := k.load(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Watch reloads the pair every interval, if it changed, and whenever a
+// value arrives on trigger, until the context is cancelled. Every reload
+// that replaced the pair or failed is passed to report. An interval of 0
+// only reloads on trigger.
+func (k *KeyPair) Watch(ctx context.Context, interval time.Duration, trigger <-chan os.Signal, report func(leaf *x509.Certificate, err error)) {
+	var poll <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	for {
+		var force bool
+		select {
+		case <-poll:
+		case <-trigger:
+			force = true
+		case <-ctx.Done():
+			return
+		}
+
+		reloaded, err := k.Reload(force)
+		if reloaded || err != nil {
+			report(k.Leaf(), err)
+		}
+	}
+}
+
+// Leaf returns the current certificate, parsed
+func (k *KeyPair) Leaf() *x509.Certificate {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.leaf
+}
+
+// GetCertificate returns the current certificate to servers
+func (k *KeyPair) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.cert, nil
+}
+
+// GetClientCertificate returns the current certificate to clients. As with
+// a static certificate, none is sent when the server would not accept it.
+func (k *KeyPair) GetClientCertificate(cri *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	k.mu.RLock()
+	cert := k.cert
+	k.mu.RUnlock()
+
+	if err := cri.SupportsCertificate(cert); err != nil {
+		return &tls.Certificate{}, nil
+	}
+	return cert, nil
+}
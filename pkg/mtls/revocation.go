@@ -0,0 +1,276 @@
+package mtls
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// ErrRevoked is returned for a certificate its issuer has revoked
+var ErrRevoked = errors.New("certificate revoked")
+
+// Bounds on cached OCSP answers
+const (
+	maxCachedOCSP   = 10000
+	ocspFailureTTL  = 30 * time.Second // Failed lookups are retried after this
+	maxRevocationIO = 10 << 20         // Largest CRL or OCSP response read
+)
+
+// RevocationOptions configures where revocation status comes from
+type RevocationOptions struct {
+	CRLFile  string        // PEM or DER CRL on disk
+	CRLURL   string        // PEM or DER CRL fetched over HTTP
+	OCSP     bool          // Query the OCSP responder named in each certificate
+	OCSPURL  string        // Responder used instead of the certificates' own
+	CacheTTL time.Duration // How long OCSP answers are reused, at most until their next update
+	Timeout  time.Duration // For fetching the CRL and OCSP queries
+}
+
+// ocspAnswer is a cached OCSP result: nil for good, ErrRevoked, or the
+// reason the status is unknown
+type ocspAnswer struct {
+	err     error
+	expires time.Time
+}
+
+// RevocationChecker checks certificates against a CRL, an OCSP responder,
+// or both. The CRL is held in memory and replaced by RefreshCRL; OCSP
+// answers are cached per certificate.
+type RevocationChecker struct {
+	opts       RevocationOptions
+	httpClient *http.Client
+
+	mu        sync.RWMutex
+	crl       *x509.RevocationList
+	revoked   map[string]time.Time // Serial -> revocation time
+	crlSigner []byte               // Raw issuer certificate the CRL's signature was verified with
+
+	cacheMu sync.Mutex
+	cache   map[string]ocspAnswer // Issuer + serial -> answer
+}
+
+// NewRevocationChecker creates a new revocation checker. Call RefreshCRL to
+// load the CRL before checking when one is configured.
+func NewRevocationChecker(opts RevocationOptions) *RevocationChecker {
+	return &RevocationChecker{
+		opts:       opts,
+		httpClient: &http.Client{Timeout: opts.Timeout},
+		cache:      make(map[string]ocspAnswer),
+	}
+}
+
+// HasCRL reports whether a CRL is configured
+func (c *RevocationChecker) HasCRL() bool {
+	return c.opts.CRLFile != "" || c.opts.CRLURL != ""
+}
+
+// RefreshCRL loads the CRL from its file or URL, replacing the current one.
+// On failure the current one stays in use until its next update passes.
+func (c *RevocationChecker) RefreshCRL(ctx context.Context) (*x509.RevocationList, error) {
+	var data []byte
+	var err error
+	switch {
+	case c.opts.CRLFile != "":
+		data, err = os.ReadFile(c.opts.CRLFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CRL: %w", err)
+		}
+	case c.opts.CRLURL != "":
+		data, err = c.fetch(ctx, http.MethodGet, c.opts.CRLURL, "", nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch CRL: %w", err)
+		}
+	default:
+		return nil, nil
+	}
+
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	crl, err := x509.ParseRevocationList(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CRL: %w", err)
+	}
+
+	revoked := make(map[string]time.Time, len(crl.RevokedCertificateEntries))
+	for _, entry := range crl.RevokedCertificateEntries {
+		revoked[entry.SerialNumber.String()] = entry.RevocationTime
+	}
+
+	c.mu.Lock()
+	c.crl = crl
+	c.revoked = revoked
+	c.crlSigner = nil
+	c.mu.Unlock()
+	return crl, nil
+}
+
+// Check returns nil when cert is known not to be revoked, an error wrapping
+// ErrRevoked when it is, and any other error when its status can't be
+// determined. issuer is the certificate that signed cert. Revocation by
+// either source wins; otherwise a good answer from either is enough.
+func (c *RevocationChecker) Check(ctx context.Context, cert, issuer *x509.Certificate) error {
+	var errs []error
+	if c.HasCRL() {
+		err := c.checkCRL(cert, issuer)
+		if err == nil && !c.opts.OCSP {
+			return nil
+		}
+		if errors.Is(err, ErrRevoked) {
+			return err
+		}
+		errs = append(errs, err)
+	}
+	if c.opts.OCSP {
+		err := c.checkOCSP(ctx, cert, issuer)
+		if err == nil || errors.Is(err, ErrRevoked) {
+			return err
+		}
+		errs = append(errs, err)
+	}
+
+	for _, err := range errs {
+		if err == nil {
+			return nil
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkCRL looks a certificate up in the CRL, verifying on first use that
+// the CRL was signed by the certificate's issuer
+func (c *RevocationChecker) checkCRL(cert, issuer *x509.Certificate) error {
+	c.mu.RLock()
+	crl, revoked, signer := c.crl, c.revoked, c.crlSigner
+	c.mu.RUnlock()
+
+	if crl == nil {
+		return fmt.Errorf("no CRL loaded")
+	}
+	if !bytes.Equal(crl.RawIssuer, issuer.RawSubject) {
+		return fmt.Errorf("CRL is not issued by %s", issuer.Subject)
+	}
+	if !crl.NextUpdate.IsZero() && time.Now().After(crl.NextUpdate) {
+		return fmt.Errorf("CRL expired at %s", crl.NextUpdate.Format(time.RFC3339))
+	}
+	if !bytes.Equal(signer, issuer.Raw) {
+		if err := crl.CheckSignatureFrom(issuer); err != nil {
+			return fmt.Errorf("CRL signature does not verify: %w", err)
+		}
+		c.mu.Lock()
+		if c.crl == crl {
+			c.crlSigner = issuer.Raw
+		}
+		c.mu.Unlock()
+	}
+
+	if at, ok := revoked[cert.SerialNumber.String()]; ok {
+		return fmt.Errorf("%w at %s (CRL)", ErrRevoked, at.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// checkOCSP asks the certificate's OCSP responder for its status, reusing
+// a cached answer while it is fresh
+func (c *RevocationChecker) checkOCSP(ctx context.Context, cert, issuer *x509.Certificate) error {
+	key := string(issuer.RawSubject) + "/" + cert.SerialNumber.String()
+	now := time.Now()
+
+	c.cacheMu.Lock()
+	answer, ok := c.cache[key]
+	c.cacheMu.Unlock()
+	if ok && now.Before(answer.expires) {
+		return answer.err
+	}
+
+	expires, err := c.queryOCSP(ctx, cert, issuer)
+	if ctx.Err() != nil {
+		return err // Not the responder's fault, so not cached
+	}
+
+	c.cacheMu.Lock()
+	if len(c.cache) >= maxCachedOCSP {
+		for k, a := range c.cache {
+			if now.After(a.expires) {
+				delete(c.cache, k)
+			}
+		}
+	}
+	if len(c.cache) < maxCachedOCSP {
+		c.cache[key] = ocspAnswer{err: err, expires: expires}
+	}
+	c.cacheMu.Unlock()
+	return err
+}
+
+// queryOCSP sends one OCSP request, returning the status and how long it
+// may be cached
+func (c *RevocationChecker) queryOCSP(ctx context.Context, cert, issuer *x509.Certificate) (time.Time, error) {
+	now := time.Now()
+	failed := now.Add(ocspFailureTTL)
+
+	responder := c.opts.OCSPURL
+	if responder == "" {
+		if len(cert.OCSPServer) == 0 {
+			return now.Add(c.opts.CacheTTL), fmt.Errorf("certificate names no OCSP responder")
+		}
+		responder = cert.OCSPServer[0]
+	}
+
+	req, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return failed, fmt.Errorf("failed to create OCSP request: %w", err)
+	}
+	data, err := c.fetch(ctx, http.MethodPost, responder, "application/ocsp-request", req)
+	if err != nil {
+		return failed, fmt.Errorf("OCSP query failed: %w", err)
+	}
+	resp, err := ocsp.ParseResponseForCert(data, cert, issuer)
+	if err != nil {
+		return failed, fmt.Errorf("invalid OCSP response: %w", err)
+	}
+
+	expires := now.Add(c.opts.CacheTTL)
+	if !resp.NextUpdate.IsZero() && resp.NextUpdate.Before(expires) {
+		expires = resp.NextUpdate
+	}
+	switch resp.Status {
+	case ocsp.Good:
+		return expires, nil
+	case ocsp.Revoked:
+		return now.Add(c.opts.CacheTTL), fmt.Errorf("%w at %s (OCSP)", ErrRevoked, resp.RevokedAt.Format(time.RFC3339))
+	}
+	return expires, fmt.Errorf("OCSP responder does not know the certificate")
+}
+
+// fetch makes an HTTP request and returns the response body
+func (c *RevocationChecker) fetch(ctx context.Context, method, url, contentType string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxRevocationIO))
+}
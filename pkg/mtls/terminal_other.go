@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !windows
+
+package mtls
+
+import "os"
+
+// readPassword is unsupported here, so passphrases come from a file or
+// environment variable
+func readPassword(*os.File, string) ([]byte, error) {
+	return nil, errNotTerminal
+}
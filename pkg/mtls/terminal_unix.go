@@ -0,0 +1,30 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package mtls
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// readPassword prompts for a line and reads it from a terminal with echo
+// turned off
+func readPassword(f *os.File, prompt string) ([]byte, error) {
+	fd := int(f.Fd())
+	termios, err := unix.IoctlGetTermios(fd, ioctlReadTermios)
+	if err != nil {
+		return nil, errNotTerminal
+	}
+
+	noEcho := *termios
+	noEcho.Lflag &^= unix.ECHO
+	noEcho.Lflag |= unix.ICANON | unix.ISIG
+	noEcho.Iflag |= unix.ICRNL
+	if err := unix.IoctlSetTermios(fd, ioctlWriteTermios, &noEcho); err != nil {
+		return nil, err
+	}
+	defer unix.IoctlSetTermios(fd, ioctlWriteTermios, termios)
+
+	return readLine(f, prompt)
+}
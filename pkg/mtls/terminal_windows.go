@@ -0,0 +1,25 @@
+package mtls
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// readPassword prompts for a line and reads it from the console with echo
+// turned off
+func readPassword(f *os.File, prompt string) ([]byte, error) {
+	handle := windows.Handle(f.Fd())
+	var mode uint32
+	if err := windows.GetConsoleMode(handle, &mode); err != nil {
+		return nil, errNotTerminal
+	}
+
+	noEcho := mode&^windows.ENABLE_ECHO_INPUT | windows.ENABLE_PROCESSED_INPUT | windows.ENABLE_LINE_INPUT
+	if err := windows.SetConsoleMode(handle, noEcho); err != nil {
+		return nil, err
+	}
+	defer windows.SetConsoleMode(handle, mode)
+
+	return readLine(f, prompt)
+}
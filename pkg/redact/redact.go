@@ -0,0 +1,77 @@
+package redact
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Rule replaces every match of Pattern with Replacement.
+// Replacement may reference capture groups, e.g. "${1}[REDACTED]".
+type Rule struct {
+	Name        string
+	Pattern     string
+	Replacement string
+}
+
+// Builtins are ready-made rules for common sensitive data
+var Builtins = map[string]Rule{
+	"credit_card": {
+		Name:        "credit_card",
+		Pattern:     `\b(?:\d[ -]?){12,18}\d\b`,
+		Replacement: "[REDACTED_CC]",
+	},
+	"email": {
+		Name:        "email",
+		Pattern:     `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+		Replacement: "[REDACTED_EMAIL]",
+	},
+	"bearer_token": {
+		Name:        "bearer_token",
+		Pattern:     `(?i)(bearer\s+)[A-Za-z0-9\-._~+/]+=*`,
+		Replacement: "${1}[REDACTED]",
+	},
+}
+
+// Redactor applies an ordered list of compiled rules
+type Redactor struct {
+	patterns     []*regexp.Regexp
+	replacements []string
+}
+
+// New compiles the named builtins followed by the custom rules
+func New(builtins []string, rules []Rule) (*Redactor, error) {
+	all := make([]Rule, 0, len(builtins)+len(rules))
+	for _, name := range builtins {
+		rule, ok := Builtins[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown builtin redaction rule %q", name)
+		}
+		all = append(all, rule)
+	}
+	all = append(all, rules...)
+
+	r := &Redactor{}
+	for _, rule := range all {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction rule %q: %w", rule.Name, err)
+		}
+		r.patterns = append(r.patterns, re)
+		r.replacements = append(r.replacements, rule.Replacement)
+	}
+
+	return r, nil
+}
+
+// Empty reports whether the redactor has no rules
+func (r *Redactor) Empty() bool {
+	return len(r.patterns) == 0
+}
+
+// Redact returns s with all rules applied in order
+func (r *Redactor) Redact(s string) string {
+	for i, re := range r.patterns {
+		s = re.ReplaceAllString(s, r.replacements[i])
+	}
+	return s
+}
@@ -2,6 +2,7 @@ package retry
 
 import (
 	"context"
+	"errors"
 	"math"
 	"math/rand"
 	"time"
@@ -25,6 +26,44 @@ func DefaultConfig() Config {
 	}
 }
 
+// permanentError marks an error that retrying won't fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent wraps err so Do returns it without retrying
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// delayedError carries the wait the failed call asked for
+type delayedError struct {
+	err  error
+	wait time.Duration
+}
+
+func (e *delayedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *delayedError) Unwrap() error {
+	return e.err
+}
+
+// After wraps err so Do waits wait, capped at MaxWait, before the next
+// attempt instead of backing off, such as for a server's Retry-After
+func After(err error, wait time.Duration) error {
+	return &delayedError{err: err, wait: wait}
+}
+
 // Do executes the given function with exponential backoff retry logic
 func Do(ctx context.Context, cfg Config, fn func() error) error {
 	var lastErr error
@@ -35,6 +74,10 @@ func Do(ctx context.Context, cfg Config, fn func() error) error {
 		if lastErr == nil {
 			return nil
 		}
+		var permanent *permanentError
+		if errors.As(lastErr, &permanent) {
+			return permanent.err
+		}
 
 		// Don't wait after the last attempt
 		if attempt == cfg.MaxRetries {
@@ -43,6 +86,13 @@ func Do(ctx context.Context, cfg Config, fn func() error) error {
 
 		// Calculate exponential backoff with jitter
 		waitTime := calculateBackoff(attempt, cfg)
+		var delayed *delayedError
+		if errors.As(lastErr, &delayed) {
+			waitTime = delayed.wait
+			if cfg.MaxWait > 0 && waitTime > cfg.MaxWait {
+				waitTime = cfg.MaxWait
+			}
+		}
 
 		// Wait with context cancellation support
 		select {
@@ -53,6 +103,10 @@ func Do(ctx context.Context, cfg Config, fn func() error) error {
 		}
 	}
 
+	var delayed *delayedError
+	if errors.As(lastErr, &delayed) {
+		return delayed.err
+	}
 	return lastErr
 }
 
@@ -0,0 +1,85 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/oicur0t/logl/pkg/awsauth"
+)
+
+// AWSSecretsManager reads secrets from AWS Secrets Manager
+type AWSSecretsManager struct {
+	region      string
+	endpoint    string
+	credentials *awsauth.Credentials
+	httpClient  *http.Client
+}
+
+// NewAWSSecretsManager creates a new Secrets Manager client. endpoint
+// defaults to the region's.
+func NewAWSSecretsManager(region, endpoint string, timeout time.Duration) *AWSSecretsManager {
+	if endpoint == "" {
+		endpoint = "https://secretsmanager." + region + ".amazonaws.com"
+	}
+	return &AWSSecretsManager{
+		region:      region,
+		endpoint:    endpoint,
+		credentials: awsauth.NewCredentials(),
+		httpClient:  &http.Client{Timeout: timeout},
+	}
+}
+
+// GetSecretString returns the current version of a secret's string value
+func (m *AWSSecretsManager) GetSecretString(ctx context.Context, secretID string) (string, error) {
+	body, err := json.Marshal(map[string]string{"SecretId": secretID})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode request: %w", err)
+	}
+	creds, err := m.credentials.Get(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	awsauth.Sign(req, body, creds, m.region, "secretsmanager", time.Now())
+
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to call GetSecretValue: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return "", fmt.Errorf("failed to read GetSecretValue response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(data, &apiErr)
+		return "", fmt.Errorf("GetSecretValue returned %d: %s %s", resp.StatusCode, apiErr.Type, apiErr.Message)
+	}
+
+	var output struct {
+		SecretString *string `json:"SecretString"`
+	}
+	if err := json.Unmarshal(data, &output); err != nil {
+		return "", fmt.Errorf("failed to decode GetSecretValue response: %w", err)
+	}
+	if output.SecretString == nil {
+		return "", fmt.Errorf("secret %s has no string value", secretID)
+	}
+	return *output.SecretString, nil
+}
@@ -0,0 +1,135 @@
+package secrets
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/oicur0t/logl/pkg/mtls"
+)
+
+// Bounds on retrying a failed certificate renewal
+const (
+	minRenewRetry = 10 * time.Second
+	maxRenewRetry = 5 * time.Minute
+)
+
+// PKIRequest describes a certificate to issue from a Vault PKI role
+type PKIRequest struct {
+	Mount      string // Where the PKI secrets engine is mounted, e.g. pki
+	Role       string
+	CommonName string
+	AltNames   []string
+	IPSANs     []string
+	TTL        time.Duration // Zero uses the role's default
+}
+
+// PKICertificate is a certificate issued by Vault, with the CA that issued
+// it
+type PKICertificate struct {
+	Certificate tls.Certificate
+	Leaf        *x509.Certificate
+	CAs         *x509.CertPool
+}
+
+// IssueCertificate issues a certificate and key from a PKI role. The key
+// is generated by Vault and only held in memory.
+func (v *Vault) IssueCertificate(ctx context.Context, req PKIRequest) (*PKICertificate, error) {
+	body := map[string]string{"common_name": req.CommonName}
+	if len(req.AltNames) > 0 {
+		body["alt_names"] = strings.Join(req.AltNames, ",")
+	}
+	if len(req.IPSANs) > 0 {
+		body["ip_sans"] = strings.Join(req.IPSANs, ",")
+	}
+	if req.TTL > 0 {
+		body["ttl"] = req.TTL.String()
+	}
+
+	var resp struct {
+		Data struct {
+			Certificate string   `json:"certificate"`
+			PrivateKey  string   `json:"private_key"`
+			IssuingCA   string   `json:"issuing_ca"`
+			CAChain     []string `json:"ca_chain"`
+		} `json:"data"`
+	}
+	path := strings.Trim(req.Mount, "/") + "/issue/" + req.Role
+	if err := v.call(ctx, http.MethodPost, path, body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to issue certificate from %s: %w", path, err)
+	}
+
+	// Intermediates follow the leaf so peers that only trust the root can
+	// build the chain
+	chain := resp.Data.CAChain
+	if len(chain) == 0 && resp.Data.IssuingCA != "" {
+		chain = []string{resp.Data.IssuingCA}
+	}
+	certPEM := resp.Data.Certificate + "\n" + strings.Join(chain, "\n")
+	cert, err := tls.X509KeyPair([]byte(certPEM), []byte(resp.Data.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate from %s: %w", path, err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate from %s: %w", path, err)
+	}
+
+	cas := x509.NewCertPool()
+	if !cas.AppendCertsFromPEM([]byte(resp.Data.IssuingCA)) {
+		return nil, fmt.Errorf("no issuing CA in the response from %s", path)
+	}
+	return &PKICertificate{Certificate: cert, Leaf: leaf, CAs: cas}, nil
+}
+
+// RenewCertificate issues a new certificate into pair once two thirds of
+// the current one's lifetime has passed, until the context is cancelled.
+// Failed renewals are retried with backoff while the current certificate
+// is still valid. Every renewal or failure is passed to report.
+func (v *Vault) RenewCertificate(ctx context.Context, req PKIRequest, pair *mtls.KeyPair, report func(leaf *x509.Certificate, err error)) {
+	retry := minRenewRetry
+	for {
+		leaf := pair.Leaf()
+		wait := time.Until(leaf.NotBefore.Add(leaf.NotAfter.Sub(leaf.NotBefore) * 2 / 3))
+		if wait < minRenewRetry {
+			// Backdated or very short-lived certificates would otherwise be
+			// renewed back to back
+			wait = minRenewRetry
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+
+		issued, err := v.IssueCertificate(ctx, req)
+		if err == nil {
+			err = pair.Set(issued.Certificate)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			report(nil, err)
+			select {
+			case <-time.After(retry):
+			case <-ctx.Done():
+				return
+			}
+			retry *= 2
+			if retry > maxRenewRetry {
+				retry = maxRenewRetry
+			}
+			continue
+		}
+		retry = minRenewRetry
+		report(pair.Leaf(), nil)
+	}
+}
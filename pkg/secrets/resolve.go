@@ -0,0 +1,78 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Reference prefixes for secret values in configuration
+const (
+	vaultPrefix = "vault:"  // vault:<KV path>#<key>
+	awsPrefix   = "aws-sm:" // aws-sm:<secret ID>[#<JSON key>]
+)
+
+// Resolver replaces secret references in configuration values with the
+// secrets they name. Either backend may be nil when not configured.
+type Resolver struct {
+	vault *Vault
+	aws   *AWSSecretsManager
+}
+
+// NewResolver creates a new secret reference resolver
+func NewResolver(vault *Vault, aws *AWSSecretsManager) *Resolver {
+	return &Resolver{vault: vault, aws: aws}
+}
+
+// IsReference reports whether a configuration value names a secret
+func IsReference(value string) bool {
+	return strings.HasPrefix(value, vaultPrefix) || strings.HasPrefix(value, awsPrefix)
+}
+
+// Resolve returns the secret a reference names, or the value unchanged
+// when it isn't a reference
+func (r *Resolver) Resolve(ctx context.Context, value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, vaultPrefix):
+		if r.vault == nil {
+			return "", fmt.Errorf("%s needs secrets.vault configured", value)
+		}
+		path, key, ok := strings.Cut(strings.TrimPrefix(value, vaultPrefix), "#")
+		if !ok || path == "" || key == "" {
+			return "", fmt.Errorf("invalid Vault reference %q (expected vault:<path>#<key>)", value)
+		}
+		data, err := r.vault.ReadKV(ctx, path)
+		if err != nil {
+			return "", err
+		}
+		secret, ok := data[key].(string)
+		if !ok {
+			return "", fmt.Errorf("Vault secret %s has no string %q", path, key)
+		}
+		return secret, nil
+
+	case strings.HasPrefix(value, awsPrefix):
+		if r.aws == nil {
+			return "", fmt.Errorf("%s needs secrets.aws configured", value)
+		}
+		id, key, hasKey := strings.Cut(strings.TrimPrefix(value, awsPrefix), "#")
+		if id == "" {
+			return "", fmt.Errorf("invalid Secrets Manager reference %q (expected aws-sm:<id>[#<key>])", value)
+		}
+		secret, err := r.aws.GetSecretString(ctx, id)
+		if err != nil || !hasKey {
+			return secret, err
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+			return "", fmt.Errorf("secret %s is not a JSON object, so has no key %q", id, key)
+		}
+		field, ok := fields[key].(string)
+		if !ok {
+			return "", fmt.Errorf("secret %s has no string %q", id, key)
+		}
+		return field, nil
+	}
+	return value, nil
+}
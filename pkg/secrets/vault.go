@@ -0,0 +1,310 @@
+// Package secrets fetches secrets and certificates from HashiCorp Vault
+// and AWS Secrets Manager over their HTTP APIs, without their SDKs
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultJWTFile is where Kubernetes mounts a pod's service account token
+const defaultJWTFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// maxResponseSize bounds a Vault or AWS response read
+const maxResponseSize = 1 << 20
+
+// VaultOptions configures a Vault client
+type VaultOptions struct {
+	Address      string // e.g. https://vault.internal:8200
+	Namespace    string // Vault Enterprise namespace
+	AuthMethod   string // token, approle, or kubernetes
+	AuthMount    string // Defaults to the method's name
+	TokenFile    string // token: read instead of $VAULT_TOKEN
+	RoleID       string // approle
+	SecretIDFile string // approle
+	Role         string // kubernetes
+	JWTFile      string // kubernetes: defaults to the pod's service account token
+	CACert       string // Verifies Vault's certificate instead of the system roots
+	Timeout      time.Duration
+}
+
+// Vault is a Vault API client. Its token is obtained on first use and
+// renewed, or obtained again by logging in, once two thirds of its TTL
+// has passed.
+type Vault struct {
+	opts       VaultOptions
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	token     string
+	renewable bool
+	renewAt   time.Time // Zero for tokens that don't expire
+}
+
+// NewVault creates a new Vault client
+func NewVault(opts VaultOptions) (*Vault, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.CACert != "" {
+		caCert, err := os.ReadFile(opts.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Vault CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("failed to append Vault CA certificate")
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	if opts.AuthMount == "" {
+		opts.AuthMount = opts.AuthMethod
+	}
+	if opts.JWTFile == "" {
+		opts.JWTFile = defaultJWTFile
+	}
+	opts.Address = strings.TrimRight(opts.Address, "/")
+
+	return &Vault{
+		opts:       opts,
+		httpClient: &http.Client{Transport: transport, Timeout: opts.Timeout},
+	}, nil
+}
+
+// Login checks that a token can be obtained
+func (v *Vault) Login(ctx context.Context) error {
+	_, err := v.currentToken(ctx)
+	return err
+}
+
+// ReadKV reads a secret from a KV secrets engine. path is the API path
+// after /v1/, e.g. secret/data/logl for a version 2 engine mounted at
+// secret; version 2 responses are unwrapped.
+func (v *Vault) ReadKV(ctx context.Context, path string) (map[string]interface{}, error) {
+	var resp struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := v.call(ctx, http.MethodGet, strings.Trim(path, "/"), nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Data == nil {
+		return nil, fmt.Errorf("Vault secret %s has no data", path)
+	}
+	if data, ok := resp.Data["data"].(map[string]interface{}); ok {
+		if _, v2 := resp.Data["metadata"]; v2 {
+			return data, nil
+		}
+	}
+	return resp.Data, nil
+}
+
+// currentToken returns the Vault token, logging in or renewing it first
+// when it is due
+func (v *Vault) currentToken(ctx context.Context) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.token != "" && (v.renewAt.IsZero() || time.Now().Before(v.renewAt)) {
+		return v.token, nil
+	}
+	if v.token != "" && v.renewable {
+		var resp vaultAuthResponse
+		if err := v.do(ctx, http.MethodPost, "auth/token/renew-self", v.token, struct{}{}, &resp); err == nil {
+			v.setToken(v.token, resp.Auth.LeaseDuration, resp.Auth.Renewable)
+			return v.token, nil
+		}
+		// Past its max TTL; log in again, which fails for static tokens
+	}
+
+	switch v.opts.AuthMethod {
+	case "token":
+		token, err := v.staticToken()
+		if err != nil {
+			return "", err
+		}
+		var resp struct {
+			Data struct {
+				TTL       int  `json:"ttl"`
+				Renewable bool `json:"renewable"`
+			} `json:"data"`
+		}
+		if err := v.do(ctx, http.MethodGet, "auth/token/lookup-self", token, nil, &resp); err != nil {
+			return "", fmt.Errorf("Vault token lookup failed: %w", err)
+		}
+		v.setToken(token, resp.Data.TTL, resp.Data.Renewable)
+	case "approle":
+		secretID, err := readSecretFile(v.opts.SecretIDFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read AppRole secret ID: %w", err)
+		}
+		if err := v.login(ctx, map[string]string{"role_id": v.opts.RoleID, "secret_id": secretID}); err != nil {
+			return "", err
+		}
+	case "kubernetes":
+		jwt, err := readSecretFile(v.opts.JWTFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read service account token: %w", err)
+		}
+		if err := v.login(ctx, map[string]string{"role": v.opts.Role, "jwt": jwt}); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("unknown Vault auth method %q", v.opts.AuthMethod)
+	}
+	return v.token, nil
+}
+
+// staticToken reads the token for the token auth method
+func (v *Vault) staticToken() (string, error) {
+	if v.opts.TokenFile != "" {
+		token, err := readSecretFile(v.opts.TokenFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read Vault token: %w", err)
+		}
+		return token, nil
+	}
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+	return "", fmt.Errorf("no Vault token: set token_file or VAULT_TOKEN")
+}
+
+// vaultAuthResponse is the response to a login or token renewal
+type vaultAuthResponse struct {
+	Auth struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+}
+
+// login logs in with the configured auth method. The caller holds mu.
+func (v *Vault) login(ctx context.Context, body map[string]string) error {
+	var resp vaultAuthResponse
+	if err := v.do(ctx, http.MethodPost, "auth/"+v.opts.AuthMount+"/login", "", body, &resp); err != nil {
+		return fmt.Errorf("Vault %s login failed: %w", v.opts.AuthMethod, err)
+	}
+	if resp.Auth.ClientToken == "" {
+		return fmt.Errorf("Vault %s login returned no token", v.opts.AuthMethod)
+	}
+	v.setToken(resp.Auth.ClientToken, resp.Auth.LeaseDuration, resp.Auth.Renewable)
+	return nil
+}
+
+// setToken makes a token current, due for renewal after two thirds of its
+// TTL. The caller holds mu.
+func (v *Vault) setToken(token string, ttlSeconds int, renewable bool) {
+	v.token = token
+	v.renewable = renewable
+	v.renewAt = time.Time{}
+	if ttlSeconds > 0 {
+		v.renewAt = time.Now().Add(time.Duration(ttlSeconds) * time.Second * 2 / 3)
+	}
+}
+
+// call makes an authenticated API request, logging in again once if the
+// token was revoked
+func (v *Vault) call(ctx context.Context, method, path string, body, out interface{}) error {
+	token, err := v.currentToken(ctx)
+	if err != nil {
+		return err
+	}
+	err = v.do(ctx, method, path, token, body, out)
+	if apiErr, ok := err.(*vaultError); ok && apiErr.status == http.StatusForbidden && v.opts.AuthMethod != "token" {
+		v.mu.Lock()
+		if v.token == token {
+			v.token = ""
+		}
+		v.mu.Unlock()
+		if token, err = v.currentToken(ctx); err != nil {
+			return err
+		}
+		return v.do(ctx, method, path, token, body, out)
+	}
+	return err
+}
+
+// vaultError is an error response from Vault
+type vaultError struct {
+	status int
+	errors []string
+}
+
+func (e *vaultError) Error() string {
+	if len(e.errors) == 0 {
+		return fmt.Sprintf("Vault returned status %d", e.status)
+	}
+	return fmt.Sprintf("Vault returned status %d: %s", e.status, strings.Join(e.errors, "; "))
+}
+
+// do makes one API request, decoding a JSON response into out
+func (v *Vault) do(ctx context.Context, method, path, token string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, v.opts.Address+"/v1/"+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if v.opts.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.opts.Namespace)
+	}
+
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return fmt.Errorf("failed to read Vault response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &vaultError{status: resp.StatusCode}
+		var errResp struct {
+			Errors []string `json:"errors"`
+		}
+		if json.Unmarshal(data, &errResp) == nil {
+			apiErr.errors = errResp.Errors
+		}
+		return apiErr
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode Vault response: %w", err)
+	}
+	return nil
+}
+
+// readSecretFile reads a file holding a single secret value
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return value, nil
+}
@@ -0,0 +1,88 @@
+package selftest
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/oicur0t/logl/pkg/mtls"
+)
+
+// Status is the outcome of a single check
+type Status string
+
+// Check outcomes
+const (
+	Pass Status = "PASS"
+	Warn Status = "WARN"
+	Fail Status = "FAIL"
+)
+
+// Result is a single named check outcome
+type Result struct {
+	Status  Status
+	Check   string
+	Message string
+}
+
+// Report collects check results for printing
+type Report struct {
+	Results []Result
+}
+
+// Pass records a passing check
+func (r *Report) Pass(check, format string, args ...interface{}) {
+	r.add(Pass, check, format, args...)
+}
+
+// Warn records a check that passed with a problem worth fixing
+func (r *Report) Warn(check, format string, args ...interface{}) {
+	r.add(Warn, check, format, args...)
+}
+
+// Fail records a failing check
+func (r *Report) Fail(check, format string, args ...interface{}) {
+	r.add(Fail, check, format, args...)
+}
+
+func (r *Report) add(status Status, check, format string, args ...interface{}) {
+	r.Results = append(r.Results, Result{Status: status, Check: check, Message: fmt.Sprintf(format, args...)})
+}
+
+// CheckExpiry records a certificate's validity window, warning when it
+// expires within warnDays
+func (r *Report) CheckExpiry(info mtls.CertificateInfo, warnDays int) {
+	now := time.Now()
+	check := "certificate " + info.Path
+	days := info.DaysRemaining(now)
+	switch {
+	case now.Before(info.NotBefore):
+		r.Fail(check, "%s is not valid until %s", info.Subject, info.NotBefore.Format(time.RFC3339))
+	case now.After(info.NotAfter):
+		r.Fail(check, "%s expired on %s; issue a new certificate", info.Subject, info.NotAfter.Format(time.RFC3339))
+	case days < warnDays:
+		r.Warn(check, "%s expires in %d days (%s)", info.Subject, days, info.NotAfter.Format(time.RFC3339))
+	default:
+		r.Pass(check, "%s valid for %d more days", info.Subject, days)
+	}
+}
+
+// Failed reports whether any check failed
+func (r *Report) Failed() bool {
+	for _, result := range r.Results {
+		if result.Status == Fail {
+			return true
+		}
+	}
+	return false
+}
+
+// Print writes one line per check followed by a summary
+func (r *Report) Print(w io.Writer) {
+	counts := make(map[Status]int)
+	for _, result := range r.Results {
+		counts[result.Status]++
+		fmt.Fprintf(w, "%-4s  %s: %s\n", result.Status, result.Check, result.Message)
+	}
+	fmt.Fprintf(w, "\n%d passed, %d warnings, %d failed\n", counts[Pass], counts[Warn], counts[Fail])
+}
@@ -0,0 +1,269 @@
+// Package storagetest checks that a log storage backend meets the
+// logstore.Backend contract. Backends call RunConformance from their own
+// tests:
+//
+//	func TestConformance(t *testing.T) {
+//		storagetest.RunConformance(t, newBackend(t))
+//	}
+package storagetest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oicur0t/logl/pkg/logstore"
+	"github.com/oicur0t/logl/pkg/models"
+)
+
+// timeout bounds each backend call
+const timeout = 30 * time.Second
+
+// RunConformance runs the conformance suite against a backend. Each
+// subtest writes to its own service, named uniquely per run, so the suite
+// can run against a backend that already holds data.
+func RunConformance(t *testing.T, backend logstore.Backend) {
+	run := fmt.Sprintf("conformance-%d", time.Now().UnixNano())
+	t.Run("Insert", func(t *testing.T) { testInsert(t, backend, run+"-insert") })
+	t.Run("Dedup", func(t *testing.T) { testDedup(t, backend, run+"-dedup") })
+	t.Run("Retention", func(t *testing.T) { testRetention(t, backend, run+"-retention") })
+	t.Run("Query", func(t *testing.T) { testQuery(t, backend, run+"-query") })
+}
+
+// testInsert checks that every entry is stored with its fields intact and
+// that empty batches are accepted
+func testInsert(t *testing.T, backend logstore.Backend, service string) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	base := time.Now().UTC().Truncate(time.Millisecond).Add(-time.Hour)
+	want := entries(service, base, 5)
+	want[2].Labels = map[string]string{"component": "api"}
+	want[3].TraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	want[3].SpanID = "00f067aa0ba902b7"
+	insert(ctx, t, backend, service, want)
+
+	if err := backend.InsertBatch(ctx, models.LogBatch{ServiceName: service}); err != nil {
+		t.Fatalf("InsertBatch with no entries: %v", err)
+	}
+
+	got := query(ctx, t, backend, models.LogQuery{ServiceName: service, Limit: 100})
+	if len(got) != len(want) {
+		t.Fatalf("Query returned %d entries, want %d", len(got), len(want))
+	}
+	byLine := make(map[string]models.LogEntry)
+	for _, entry := range got {
+		byLine[entry.Line] = entry
+	}
+	for _, w := range want {
+		g, ok := byLine[w.Line]
+		if !ok {
+			t.Errorf("entry %q was not stored", w.Line)
+			continue
+		}
+		if g.ServiceName != w.ServiceName || g.Hostname != w.Hostname || g.FilePath != w.FilePath ||
+			g.LineNumber != w.LineNumber || g.Level != w.Level || g.EntryID != w.EntryID ||
+			g.TraceID != w.TraceID || g.SpanID != w.SpanID || !g.Timestamp.Equal(w.Timestamp) {
+			t.Errorf("entry %q stored as %+v, want %+v", w.Line, g, w)
+		}
+		if !sameLabels(g.Labels, w.Labels) {
+			t.Errorf("entry %q stored with labels %v, want %v", w.Line, g.Labels, w.Labels)
+		}
+	}
+}
+
+// testDedup checks that retried batches and repeated entry IDs are stored
+// once, while entries without an ID are stored each time
+func testDedup(t *testing.T, backend logstore.Backend, service string) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	base := time.Now().UTC().Truncate(time.Millisecond).Add(-time.Hour)
+	batch := entries(service, base, 3)
+	insert(ctx, t, backend, service, batch)
+	insert(ctx, t, backend, service, batch) // A retry of the same batch
+
+	// A new batch overlapping the first by one entry
+	overlap := append([]models.LogEntry{batch[2]}, entries(service, base.Add(time.Minute), 2)...)
+	overlap[1].EntryID = service + "-new-0"
+	overlap[2].EntryID = service + "-new-1"
+	insert(ctx, t, backend, service, overlap)
+
+	// Entries without an ID can't be told apart, so both copies are kept
+	anonymous := entries(service, base.Add(2*time.Minute), 1)
+	anonymous[0].EntryID = ""
+	insert(ctx, t, backend, service, anonymous)
+	insert(ctx, t, backend, service, anonymous)
+
+	got := query(ctx, t, backend, models.LogQuery{ServiceName: service, Limit: 100})
+	if len(got) != 7 {
+		t.Fatalf("Query returned %d entries, want 7 (5 unique IDs and 2 without one)", len(got))
+	}
+	seen := make(map[string]bool)
+	for _, entry := range got {
+		if entry.EntryID == "" {
+			continue
+		}
+		if seen[entry.EntryID] {
+			t.Errorf("entry_id %s was stored more than once", entry.EntryID)
+		}
+		seen[entry.EntryID] = true
+	}
+}
+
+// testRetention checks that retention settings are kept per service and
+// that setting a retention does not remove entries newer than it
+func testRetention(t *testing.T, backend logstore.Backend, service string) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	base := time.Now().UTC().Truncate(time.Millisecond).Add(-time.Hour)
+	insert(ctx, t, backend, service, entries(service, base, 3))
+
+	for _, days := range []int{7, 1, 0} {
+		if err := backend.SetRetention(ctx, service, days); err != nil {
+			t.Fatalf("SetRetention(%d): %v", days, err)
+		}
+		got, err := backend.Retention(ctx, service)
+		if err != nil {
+			t.Fatalf("Retention: %v", err)
+		}
+		if got != days {
+			t.Errorf("Retention returned %d days after setting %d", got, days)
+		}
+		if n := len(query(ctx, t, backend, models.LogQuery{ServiceName: service, Limit: 100})); n != 3 {
+			t.Errorf("%d of 3 entries newer than a %d day retention remain", n, days)
+		}
+	}
+
+	// Retention is per service
+	other := service + "-other"
+	if err := backend.SetRetention(ctx, other, 30); err != nil {
+		t.Fatalf("SetRetention: %v", err)
+	}
+	if got, err := backend.Retention(ctx, service); err != nil || got != 0 {
+		t.Errorf("Retention returned %d, %v after setting another service's retention, want 0", got, err)
+	}
+}
+
+// testQuery checks ordering, limits, the time range, and each filter
+func testQuery(t *testing.T, backend logstore.Backend, service string) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	base := time.Now().UTC().Truncate(time.Millisecond).Add(-time.Hour)
+	stored := entries(service, base, 10)
+	for i := range stored {
+		if i%2 == 0 {
+			stored[i].Hostname = "host-b"
+			stored[i].Labels = map[string]string{"env": "prod", "zone": "a"}
+		} else {
+			stored[i].Labels = map[string]string{"env": "staging", "zone": "a"}
+		}
+	}
+	stored[3].Level = "error"
+	stored[7].Level = "warn"
+	stored[5].Line = "payment failed: card declined (retry 1/3)"
+	stored[5].TraceID = "0af7651916cd43dd8448eb211c80319c"
+	insert(ctx, t, backend, service, stored)
+
+	// Another service's entries are never returned
+	insert(ctx, t, backend, service+"-other", entries(service+"-other", base, 3))
+
+	cases := []struct {
+		name  string
+		query models.LogQuery
+		want  []int // Indexes into stored, newest first
+	}{
+		{"all", models.LogQuery{}, []int{9, 8, 7, 6, 5, 4, 3, 2, 1, 0}},
+		{"limit", models.LogQuery{Limit: 3}, []int{9, 8, 7}},
+		{"from inclusive", models.LogQuery{From: base.Add(7 * time.Second)}, []int{9, 8, 7}},
+		{"to exclusive", models.LogQuery{To: base.Add(2 * time.Second)}, []int{1, 0}},
+		{"range", models.LogQuery{From: base.Add(3 * time.Second), To: base.Add(5 * time.Second)}, []int{4, 3}},
+		{"hostname", models.LogQuery{Hostname: "host-b"}, []int{8, 6, 4, 2, 0}},
+		{"file path", models.LogQuery{FilePath: "/var/log/app-1.log"}, []int{9, 7, 5, 3, 1}},
+		{"contains literal", models.LogQuery{Contains: "(retry 1/3)"}, []int{5}},
+		{"one level", models.LogQuery{Levels: []string{"error"}}, []int{3}},
+		{"levels", models.LogQuery{Levels: []string{"error", "warn"}}, []int{7, 3}},
+		{"trace", models.LogQuery{TraceID: "0af7651916cd43dd8448eb211c80319c"}, []int{5}},
+		{"entry id", models.LogQuery{EntryID: stored[6].EntryID}, []int{6}},
+		{"labels", models.LogQuery{Labels: map[string]string{"env": "prod", "zone": "a"}}, []int{8, 6, 4, 2, 0}},
+		{"labels all match", models.LogQuery{Labels: map[string]string{"env": "prod", "zone": "b"}}, nil},
+		{"combined", models.LogQuery{Hostname: "host-b", Labels: map[string]string{"env": "prod"}, From: base.Add(4 * time.Second), Limit: 2}, []int{8, 6}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := tc.query
+			q.ServiceName = service
+			if q.Limit == 0 {
+				q.Limit = 100
+			}
+			got := query(ctx, t, backend, q)
+			var lines []string
+			for _, entry := range got {
+				lines = append(lines, entry.Line)
+			}
+			var want []string
+			for _, i := range tc.want {
+				want = append(want, stored[i].Line)
+			}
+			if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+				t.Errorf("Query returned %q, want %q", lines, want)
+			}
+		})
+	}
+}
+
+// entries returns n entries one second apart from base, each with a
+// unique entry ID
+func entries(service string, base time.Time, n int) []models.LogEntry {
+	out := make([]models.LogEntry, n)
+	for i := range out {
+		out[i] = models.LogEntry{
+			EntryID:     fmt.Sprintf("%s-%d-%d", service, base.UnixNano(), i),
+			ServiceName: service,
+			Hostname:    "host-a",
+			FilePath:    fmt.Sprintf("/var/log/app-%d.log", i%2),
+			Line:        fmt.Sprintf("%s line %d", service, i),
+			Timestamp:   base.Add(time.Duration(i) * time.Second),
+			LineNumber:  int64(i + 1),
+			Level:       "info",
+		}
+	}
+	return out
+}
+
+// insert stores entries as one batch, failing the test on error
+func insert(ctx context.Context, t *testing.T, backend logstore.Backend, service string, entries []models.LogEntry) {
+	t.Helper()
+	batch := models.LogBatch{ServiceName: service, Entries: append([]models.LogEntry(nil), entries...)}
+	if err := backend.InsertBatch(ctx, batch); err != nil {
+		t.Fatalf("InsertBatch: %v", err)
+	}
+}
+
+// query runs a query, failing the test on error
+func query(ctx context.Context, t *testing.T, backend logstore.Backend, q models.LogQuery) []models.LogEntry {
+	t.Helper()
+	got, err := backend.Query(ctx, q)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	return got
+}
+
+// sameLabels reports whether two label sets are equal, treating nil and
+// empty as the same
+func sameLabels(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}